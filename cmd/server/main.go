@@ -1,7 +1,15 @@
 package main
 
-import "chat-backend/internal/app"
+import (
+	"os"
+
+	"chat-backend/internal/app"
+)
 
 func main() {
+	// Any arguments select a CLI mode (e.g. `server import ...`) instead of serving
+	if len(os.Args) > 1 {
+		os.Exit(app.RunCommand(os.Args[1:]))
+	}
 	app.Run()
 }
@@ -1,14 +1,20 @@
 package app
 
 import (
+	"context"
 	"errors"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	"chat-backend/internal/db"
+	"chat-backend/internal/db/migrations"
 	"chat-backend/internal/handlers"
+	"chat-backend/internal/metrics"
 	"chat-backend/internal/models"
 	"chat-backend/internal/services"
 	"chat-backend/internal/utils"
@@ -16,10 +22,11 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/fiber/v2/middleware/recover"
 )
 
-func Run() {
+// connectDB loads the environment and initializes the database pool from it.
+// Shared by the server and the CLI commands.
+func connectDB() {
 	// Load Env
 	if err := utils.LoadEnv(); err != nil {
 		log.Println("Warning: .env file not found")
@@ -36,22 +43,230 @@ func Run() {
 			utils.GetEnv("POSTGRES_DB", "chatdb") + "?sslmode=disable"
 	}
 
-	if err := db.InitDB(connString); err != nil {
+	poolOpts := db.DefaultPoolOptions()
+	poolOpts.MaxConns = int32(utils.GetEnvInt("DB_MAX_CONNS", int(poolOpts.MaxConns)))
+	poolOpts.MinConns = int32(utils.GetEnvInt("DB_MIN_CONNS", int(poolOpts.MinConns)))
+	poolOpts.MaxConnLifetime = utils.GetEnvDuration("DB_MAX_CONN_LIFETIME", poolOpts.MaxConnLifetime)
+	poolOpts.MaxConnIdleTime = utils.GetEnvDuration("DB_MAX_CONN_IDLE_TIME", poolOpts.MaxConnIdleTime)
+	poolOpts.HealthCheckPeriod = utils.GetEnvDuration("DB_HEALTH_CHECK_PERIOD", poolOpts.HealthCheckPeriod)
+	poolOpts.StatementCacheMode = utils.GetEnv("DB_STATEMENT_CACHE_MODE", poolOpts.StatementCacheMode)
+
+	if err := db.InitDB(connString, poolOpts); err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	db.SetFailoverRetry(utils.GetEnvInt("DB_FAILOVER_RETRIES", 2), utils.GetEnvDuration("DB_FAILOVER_BACKOFF", 250*time.Millisecond))
+
+	// Optional read replicas for history, room list and search
+	if urls := utils.GetEnv("DB_REPLICA_URLS", ""); urls != "" {
+		var replicaURLs []string
+		for _, u := range strings.Split(urls, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				replicaURLs = append(replicaURLs, u)
+			}
+		}
+		err := db.InitReplicas(context.Background(), replicaURLs, poolOpts,
+			utils.GetEnvDuration("DB_REPLICA_MAX_LAG", 2*time.Second), utils.GetEnvDuration("DB_REPLICA_CHECK_INTERVAL", 5*time.Second))
+		if err != nil {
+			log.Fatalf("Failed to connect to read replica: %v", err)
+		}
+	}
+}
+
+// migrate applies pending schema migrations to the primary
+func migrate() error {
+	applied, err := migrations.Up(context.Background(), db.Pool)
+	for _, m := range applied {
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+	return err
+}
+
+func Run() {
+	connectDB()
 	defer db.CloseDB()
+	if utils.GetEnv("MIGRATE_ON_START", "false") == "true" {
+		if err := migrate(); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
+
+	// Metrics
+	db.RegisterMetrics()
+	handlers.RegisterMetrics()
 
 	// Services
+	services.SetQueryTimeout(utils.GetEnvDuration("DB_QUERY_TIMEOUT", 5*time.Second))
+	if err := utils.SetLogLevel(utils.GetEnv("LOG_LEVEL", "info")); err != nil {
+		log.Fatalf("Invalid LOG_LEVEL: %v", err)
+	}
+	services.LoadFeatureFlags()
+	idGenerator, err := services.NewIDGenerator(utils.GetEnv("MESSAGE_ID_GENERATOR", "serial"), utils.GetEnvInt("MESSAGE_ID_NODE", 0))
+	if err != nil {
+		log.Fatalf("Invalid MESSAGE_ID_GENERATOR: %v", err)
+	}
+	services.SetMessageIDGenerator(idGenerator)
+	if err := services.ConfigurePasswordHashing(); err != nil {
+		log.Fatalf("Invalid password hashing configuration: %v", err)
+	}
+	if _, err := services.LoadEgressPolicy(); err != nil {
+		log.Fatalf("Invalid egress configuration: %v", err)
+	}
+	storage, err := services.NewStorageFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid storage configuration: %v", err)
+	}
+	services.SetUploadStorage(storage)
+	if err := services.SetEventClasses(utils.GetEnv("EVENT_CLASSES", "")); err != nil {
+		log.Fatalf("Invalid EVENT_CLASSES: %v", err)
+	}
 	userService := services.NewUserService()
 	chatService := services.NewChatService()
+	importService := services.NewImportService()
+	adminService := services.NewAdminService()
+	mailer := services.NewMailerFromEnv()
+
+	// Background jobs are stopped on shutdown
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	handlers.StartExpirySweeper(jobsCtx, chatService, utils.GetEnvDuration("MESSAGE_EXPIRY_SWEEP_INTERVAL", 30*time.Second))
+	// Cross-instance broadcast and presence; unset runs this instance alone
+	switch transport := utils.GetEnv("CLUSTER_TRANSPORT", ""); transport {
+	case "":
+	case "postgres":
+		handlers.StartCluster(jobsCtx, services.NewPGNotifyTransport(utils.GetEnv("CLUSTER_CHANNEL", "chat_events")),
+			utils.GetEnvDuration("CLUSTER_HEARTBEAT_INTERVAL", 10*time.Second))
+	default:
+		log.Fatalf("Unknown CLUSTER_TRANSPORT %q (expected postgres)", transport)
+	}
+	handlers.StartUsageRecorder(chatService, utils.GetEnvDuration("USAGE_FLUSH_INTERVAL", 30*time.Second))
+	handlers.StartAwayTracker(jobsCtx, chatService, utils.GetEnvDuration("AWAY_AFTER", 5*time.Minute))
+	handlers.StartConnectionReaper(jobsCtx, chatService, utils.GetEnvDuration("WS_REAP_INTERVAL", 30*time.Second))
+	handlers.StartPollSessions(jobsCtx, utils.GetEnvInt("POLL_QUEUE_SIZE", 200), utils.GetEnvDuration("POLL_SESSION_TTL", time.Minute))
+	handlers.StartReceiptRecorder(chatService, utils.GetEnvDuration("RECEIPT_FLUSH_INTERVAL", 500*time.Millisecond))
+	handlers.StartSeenBatcher(chatService, utils.GetEnvDuration("SEEN_BATCH_WINDOW", 200*time.Millisecond), utils.GetEnvInt("SEEN_BATCH_MAX", 500))
+	handlers.StartRetentionPurger(jobsCtx, chatService, utils.GetEnvDuration("RETENTION_PURGE_INTERVAL", time.Hour), utils.GetEnvInt("MESSAGE_RETENTION_DAYS", 0))
+	handlers.StartVoiceCleanup(jobsCtx, chatService, filepath.Join(utils.GetEnv("UPLOAD_DIR", "uploads"), "voices"),
+		utils.GetEnvDuration("VOICE_CLEANUP_INTERVAL", time.Hour), utils.GetEnvDuration("VOICE_MAX_AGE", 0),
+		int64(utils.GetEnvInt("VOICE_STORAGE_CAP_MB", 0))<<20)
+	handlers.StartDBHealthMonitor(jobsCtx, utils.GetEnvDuration("DB_HEALTH_INTERVAL", 2*time.Second),
+		utils.GetEnvInt("DB_OUTAGE_QUEUE_SIZE", 500), utils.GetEnvInt("DB_OUTAGE_QUEUE_PER_USER", 20), utils.GetEnvDuration("DB_OUTAGE_QUEUE_TTL", 30*time.Second))
+	handlers.StartRoomUnlocker(jobsCtx, chatService, utils.GetEnvDuration("ROOM_UNLOCK_INTERVAL", 30*time.Second))
+
+	// Roles are never changed at startup; the first admin comes from the promote-admin command
+	if utils.GetEnv("ADMIN_USERNAME", "") != "" {
+		log.Printf("Warning: ADMIN_USERNAME is ignored; run `server promote-admin <username>` once to create the first admin")
+	}
+
+	if err := services.LoadUploadNamespace(context.Background()); err != nil {
+		log.Fatalf("Failed to load upload namespace: %v", err)
+	}
+	handlers.StartUploadNamespaceRefresh(jobsCtx, utils.GetEnvDuration("UPLOAD_NAMESPACE_REFRESH", time.Minute))
+	handlers.StartUploadProbe(jobsCtx, utils.GetEnv("UPLOAD_DIR", "uploads"), utils.GetEnvDuration("UPLOAD_PROBE_INTERVAL", time.Minute),
+		utils.GetEnvInt("UPLOAD_PROBE_BYTES", 64<<10))
+	// Uploads interrupted by a crash leave their temp files behind
+	if n, err := services.CleanTempUploads(utils.GetEnvDuration("UPLOAD_TEMP_MAX_AGE", time.Hour)); err != nil {
+		utils.LogError(err, "clean temp uploads")
+	} else if n > 0 {
+		log.Printf("Removed %d stale temp uploads", n)
+	}
+
+	// Static archives of public rooms, regenerated as new messages arrive
+	mirrorDir := utils.GetEnv("MIRROR_DIR", "")
+	if mirrorDir != "" {
+		handlers.Mirror = services.NewMirrorExporter(mirrorDir, utils.GetEnv("UPLOAD_DIR", "uploads"), utils.GetEnvInt("MIRROR_PAGE_SIZE", 200))
+		handlers.StartMirrorExporter(jobsCtx, utils.GetEnvDuration("MIRROR_EXPORT_INTERVAL", time.Minute))
+	}
+
+	notifications, err := services.LoadNotificationTemplates(utils.GetEnv("NOTIFICATION_TEMPLATES_FILE", ""))
+	if err != nil {
+		log.Fatalf("Invalid notification templates: %v", err)
+	}
+	handlers.Notifications = notifications
+	handlers.Translator = services.NewTranslatorFromEnv()
+
+	bot := services.NewBotService()
+	if err := bot.Ensure(context.Background(), utils.GetEnv("BOT_USERNAME", "bot")); err != nil {
+		log.Fatalf("Failed to create bot account: %v", err)
+	}
+	handlers.Bot = bot
+	if err := handlers.InitDefaultRooms(context.Background(), chatService); err != nil {
+		log.Fatalf("Failed to create default rooms: %v", err)
+	}
+
+	if clientsFile := utils.GetEnv("OIDC_CLIENTS_FILE", ""); clientsFile != "" {
+		keyFile := utils.GetEnv("OIDC_SIGNING_KEY_FILE", "")
+		if keyFile == "" {
+			log.Printf("Warning: OIDC_SIGNING_KEY_FILE not set, using an ephemeral key; OIDC tokens won't survive a restart")
+		}
+		provider, err := services.LoadOIDCProvider(utils.GetEnv("OIDC_ISSUER", "http://localhost:3001"), clientsFile, keyFile,
+			utils.GetEnvDuration("OIDC_CODE_TTL", time.Minute), utils.GetEnvDuration("OIDC_TOKEN_TTL", time.Hour))
+		if err != nil {
+			log.Fatalf("Invalid OIDC configuration: %v", err)
+		}
+		handlers.OIDC = provider
+	}
+
+	push, err := services.NewNotificationServiceFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid push configuration: %v", err)
+	}
+	if push != nil {
+		push.Start(jobsCtx, utils.GetEnvInt("PUSH_WORKERS", 4))
+		handlers.Push = push
+	}
+	errorExporter, err := services.NewErrorExporterFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid SENTRY_DSN: %v", err)
+	}
+	handlers.Errors = services.NewErrorReporter(utils.GetEnvInt("ERROR_GROUPS_MAX", 200), utils.GetEnvDuration("ERROR_EXPORT_INTERVAL", time.Minute), errorExporter)
+
+	proxyHeader := utils.GetEnv("PROXY_HEADER", "")
+	trustedProxies, err := handlers.InitClientIP(proxyHeader, utils.GetEnv("TRUSTED_PROXIES", ""))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	if proxyHeader != "" && len(trustedProxies) == 0 {
+		log.Printf("Warning: PROXY_HEADER is ignored without TRUSTED_PROXIES")
+	}
+	if err := handlers.InitIPFilter(); err != nil {
+		log.Fatalf("Invalid IP filter configuration: %v", err)
+	}
+	if err := handlers.InitUploadPolicy(); err != nil {
+		log.Fatalf("Invalid upload policy: %v", err)
+	}
+	if err := handlers.LoadWSRateLimits(); err != nil {
+		log.Fatalf("Invalid WS rate limits: %v", err)
+	}
+	if err := handlers.LoadWSEventPolicy(); err != nil {
+		log.Fatalf("Invalid WS event policy: %v", err)
+	}
 
 	// Fiber App
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		// Behind a reverse proxy c.IP() reads the client address from PROXY_HEADER, only when
+		// sent by TRUSTED_PROXIES; security checks use handlers.ClientIP
+		ProxyHeader:             proxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          trustedProxies,
+		EnableIPValidation:      true,
+		// Upper bound for every upload; UPLOAD_POLICY can set lower limits per endpoint
+		BodyLimit: utils.GetEnvInt("HTTP_BODY_LIMIT_MB", 4) << 20,
+	})
 
 	// Middleware
-	app.Use(logger.New())
-	app.Use(recover.New())
+	app.Use(logger.New(logger.Config{
+		// LOG_LEVEL=error silences the access log; it can be changed with a config reload
+		Next: func(c *fiber.Ctx) bool { return !utils.LogEnabled(utils.LevelInfo) },
+	}))
+	app.Use(handlers.ErrorReportingMiddleware)
+	app.Use(handlers.IPFilterMiddleware)
 	app.Use(cors.New())
+	compression, err := handlers.CompressionMiddleware()
+	if err != nil {
+		log.Fatalf("Invalid COMPRESS_ROUTES: %v", err)
+	}
+	app.Use(compression)
+	app.Use(handlers.RequestContextMiddleware(utils.GetEnvDuration("REQUEST_TIMEOUT", 30*time.Second)))
 
 	// Ensure upload dir exists and serve uploaded files
 	uploadDir := utils.GetEnv("UPLOAD_DIR", "uploads")
@@ -63,87 +278,111 @@ func Run() {
 	if err := os.MkdirAll(voicesDir, 0755); err != nil {
 		log.Printf("Warning: failed to create voices dir: %v", err)
 	}
-	app.Static("/uploads", uploadDir)
+	// Files are served under the current upload namespace; see handlers.UploadsHandler
+	app.Get("/uploads/*", handlers.UploadsHandler(uploadDir))
+	if mirrorDir != "" && utils.GetEnv("MIRROR_SERVE", "true") == "true" {
+		app.Static("/mirror", mirrorDir)
+	}
 
 	// Routes
 	api := app.Group("/api")
 
 	// Public Routes
-	api.Post("/register", func(c *fiber.Ctx) error {
+	registerLimit, err := handlers.AuthRateLimiter("register", utils.GetEnv("REGISTER_RATE_LIMIT", "5/1h"), handlers.ClientIPKey)
+	if err != nil {
+		log.Fatalf("Invalid REGISTER_RATE_LIMIT: %v", err)
+	}
+	loginIPLimit, err := handlers.AuthRateLimiter("login", utils.GetEnv("LOGIN_RATE_LIMIT", "30/1m"), handlers.ClientIPKey)
+	if err != nil {
+		log.Fatalf("Invalid LOGIN_RATE_LIMIT: %v", err)
+	}
+	loginUserLimit, err := handlers.AuthRateLimiter("login", utils.GetEnv("LOGIN_USER_RATE_LIMIT", "10/5m"), handlers.LoginUsernameKey)
+	if err != nil {
+		log.Fatalf("Invalid LOGIN_USER_RATE_LIMIT: %v", err)
+	}
+
+	api.Post("/register", registerLimit, func(c *fiber.Ctx) error {
 		var req models.RegisterRequest
 		if err := c.BodyParser(&req); err != nil {
 			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
 		}
-		user, err := userService.Register(c.Context(), req)
+		user, err := userService.Register(c.UserContext(), req)
 		if err != nil {
 			if errors.Is(err, services.ErrUserExists) {
 				return c.Status(400).JSON(fiber.Map{"error": "username already exists"})
 			}
+			if errors.Is(err, services.ErrEmailInUse) {
+				return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+			}
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
+		go handlers.JoinDefaultRooms(chatService, user.ID, user.Username)
 		return c.Status(201).JSON(user)
 	})
 
-	api.Post("/login", func(c *fiber.Ctx) error {
-		var req models.LoginRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
-		}
-		res, err := userService.Login(c.Context(), req)
-		if err != nil {
-			return c.Status(401).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(res)
-	})
+	api.Post("/login", loginIPLimit, loginUserLimit, handlers.LoginHandler(userService, mailer))
 
-	// Refresh token endpoint
-	api.Post("/refresh", func(c *fiber.Ctx) error {
-		var body struct {
-			RefreshToken string `json:"refresh_token"`
-		}
-		if err := c.BodyParser(&body); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
-		}
-		if body.RefreshToken == "" {
-			return c.Status(400).JSON(fiber.Map{"error": "refresh_token required"})
-		}
+	// Password reset by emailed link
+	resetLimit, err := handlers.AuthRateLimiter("password_forgot", utils.GetEnv("PASSWORD_RESET_RATE_LIMIT", "5/1h"), handlers.ClientIPKey)
+	if err != nil {
+		log.Fatalf("Invalid PASSWORD_RESET_RATE_LIMIT: %v", err)
+	}
+	api.Post("/password/forgot", resetLimit, handlers.ForgotPasswordHandler(userService, mailer))
+	api.Post("/password/reset", handlers.ResetPasswordHandler(userService))
 
-		claims, err := services.ValidateRefreshToken(body.RefreshToken)
+	// Refresh token endpoint
+	api.Post("/refresh", handlers.RefreshHandler(userService))
+
+	// One-click revoke link sent in new device alerts
+	api.Get("/devices/revoke", handlers.RevokeDeviceLinkHandler(userService))
+
+	// Integration bots authenticate with an API key instead of a JWT
+	botAPI := api.Group("/bot", handlers.BotAuthMiddleware(userService))
+	botAPI.Post("/messages/bulk", handlers.BulkMessagesHandler(chatService))
+	botAPI.Post("/rooms/bulk", handlers.BulkCreateRoomsHandler(chatService))
+
+	// Admin automation authenticates with scoped API tokens instead of an admin JWT
+	adminAPI := api.Group("/admin-api")
+	adminAPI.Get("/stats", handlers.AdminTokenMiddleware(adminService, models.ScopeReadStats), handlers.AdminStatsHandler())
+	adminAPI.Put("/rooms/:id/announcement", handlers.AdminTokenMiddleware(adminService, models.ScopeWriteAnnouncements), handlers.SetAnnouncementHandler(chatService))
+	adminAPI.Delete("/rooms/:id/announcement", handlers.AdminTokenMiddleware(adminService, models.ScopeWriteAnnouncements), handlers.ClearAnnouncementHandler(chatService))
+	adminAPI.Delete("/messages/:id", handlers.AdminTokenMiddleware(adminService, models.ScopeModerateMessages), handlers.AdminDeleteMessageHandler(adminService))
+	adminAPI.Delete("/messages/:id/hard", handlers.AdminTokenMiddleware(adminService, models.ScopeModerateMessages), handlers.AdminHardDeleteMessageHandler(adminService))
+	adminAPI.Get("/content/scan", handlers.AdminTokenMiddleware(adminService, models.ScopeModerateMessages), handlers.AdminContentScanHandler(adminService))
+	adminAPI.Post("/content/takedown", handlers.AdminTokenMiddleware(adminService, models.ScopeModerateMessages), handlers.AdminTakedownHandler(adminService))
+
+	// OpenID Connect provider for first-party companion apps (authorization code flow)
+	if handlers.OIDC != nil {
+		app.Get("/.well-known/openid-configuration", handlers.OIDCDiscoveryHandler())
+		api.Get("/oidc/jwks", handlers.OIDCJWKSHandler())
+		api.Get("/oidc/authorize", handlers.OIDCAuthorizeHandler())
+		// The sign-in form checks passwords like /login and takes the same limits
+		oidcIPLimit, err := handlers.AuthRateLimiter("oidc_authorize", utils.GetEnv("LOGIN_RATE_LIMIT", "30/1m"), handlers.ClientIPKey)
 		if err != nil {
-			return c.Status(401).JSON(fiber.Map{"error": "invalid refresh token"})
+			log.Fatalf("Invalid LOGIN_RATE_LIMIT: %v", err)
 		}
-
-		// Extract user info
-		userIDf, ok := claims["user_id"].(float64)
-		if !ok {
-			return c.Status(401).JSON(fiber.Map{"error": "invalid token claims"})
-		}
-		username, ok := claims["username"].(string)
-		if !ok {
-			return c.Status(401).JSON(fiber.Map{"error": "invalid token claims"})
+		oidcUserLimit, err := handlers.AuthRateLimiter("oidc_authorize", utils.GetEnv("LOGIN_USER_RATE_LIMIT", "10/5m"), handlers.FormUsernameKey)
+		if err != nil {
+			log.Fatalf("Invalid LOGIN_USER_RATE_LIMIT: %v", err)
 		}
+		api.Post("/oidc/authorize", oidcIPLimit, oidcUserLimit, handlers.OIDCAuthorizeSubmitHandler(userService))
+		api.Post("/oidc/token", handlers.OIDCTokenHandler())
+		api.Get("/oidc/userinfo", handlers.OIDCUserInfoHandler())
+	}
 
-		userID := int(userIDf)
+	// Notification action buttons, authorized by the action token in the payload
+	api.Post("/notifications/act", handlers.NotificationActionHandler(chatService))
 
-		// Generate new tokens
-		access, err := services.GenerateJWT(userID, username)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "failed to generate access token"})
-		}
-		refresh, err := services.GenerateRefreshToken(userID, username)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "failed to generate refresh token"})
-		}
+	// Email change confirmation and rollback links
+	api.Get("/profile/email/confirm", handlers.ConfirmEmailChangeHandler(userService, mailer))
+	api.Get("/profile/email/rollback", handlers.RollbackEmailChangeHandler(userService))
 
-		return c.JSON(fiber.Map{
-			"access_token":  access,
-			"refresh_token": refresh,
-		})
-	})
+	// WebSocket discovery for multi-node deployments
+	api.Get("/ws-endpoints", handlers.WSEndpointsHandler())
 
 	// Protected Routes
 	protected := api.Group("/")
-	protected.Use(handlers.AuthMiddleware)
+	protected.Use(handlers.AuthMiddleware, handlers.UsageMiddleware)
 
 	// Chat Routes
 	protected.Post("/rooms/direct", func(c *fiber.Ctx) error {
@@ -159,7 +398,7 @@ func Run() {
 			return c.Status(400).JSON(fiber.Map{"error": "Recipient ID required"})
 		}
 
-		res, err := chatService.GetOrCreateDirectRoom(c.Context(), userID, req.RecipientID)
+		res, err := chatService.GetOrCreateDirectRoom(c.UserContext(), userID, req.RecipientID)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -167,12 +406,27 @@ func Run() {
 		return c.JSON(res)
 	})
 
+	// Group rooms; members have an owner, admin or member role
+	protected.Post("/rooms/group", handlers.CreateGroupHandler(chatService))
+
+	// Mark every room as read
+	protected.Post("/rooms/read-all", handlers.MarkAllReadHandler(chatService))
+	// Total unread count for app icon badges
+	protected.Get("/unread", handlers.UnreadCountHandler(chatService))
+
+	// Status and last_seen of many users at once
+	protected.Post("/presence", handlers.PresenceHandler(chatService))
+	protected.Get("/users/:id/presence", handlers.UserPresenceHandler(chatService))
+
+	// Long-polling fallback for clients that can't use WebSockets
+	protected.Get("/poll", handlers.PollHandler())
+
 	// List users (exclude admin). Returns online status per user.
 	protected.Get("/users", func(c *fiber.Ctx) error {
 		// Authenticated user
 		authUserID := c.Locals("user_id").(int)
 
-		users, err := userService.ListUsers(c.Context())
+		users, err := userService.ListUsers(c.UserContext())
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "failed to fetch users"})
 		}
@@ -184,10 +438,7 @@ func Run() {
 			if u.ID == authUserID {
 				continue
 			}
-			status := "offline"
-			if handlers.Manager.IsUserOnline(u.ID) {
-				status = "online"
-			}
+			status := handlers.UserStatus(u.ID)
 			resp = append(resp, map[string]interface{}{
 				"id":         u.ID,
 				"username":   u.Username,
@@ -199,46 +450,247 @@ func Run() {
 		return c.JSON(resp)
 	})
 
+	// Login devices
+	protected.Get("/devices", handlers.ListDevicesHandler(userService))
+	protected.Delete("/devices/:device_id", handlers.RevokeDeviceHandler(userService))
+	// Push tokens of mobile apps; offline participants get pushes for new messages
+	protected.Post("/devices", handlers.RegisterPushTokenHandler())
+	protected.Delete("/devices", handlers.UnregisterPushTokenHandler())
+
+	// Room membership
+	protected.Get("/rooms/:id/members/history", handlers.MembershipHistoryHandler(chatService))
+	protected.Delete("/rooms/:id/members/me", handlers.LeaveRoomHandler(chatService))
+
+	// Search messages within a room
+	protected.Get("/rooms/:id/search", handlers.SearchRoomHandler(chatService))
+
+	// Routes below are limited to the room's active participants
+	participantOnly := handlers.RoomParticipantMiddleware(chatService)
+
+	// Group management: rename, members and roles; changes are sent to every participant
+	protected.Patch("/rooms/group/:id", participantOnly, handlers.RenameGroupHandler(chatService))
+	protected.Get("/rooms/group/:id/members", participantOnly, handlers.ListGroupMembersHandler(chatService))
+	protected.Post("/rooms/group/:id/members", participantOnly, handlers.AddGroupMemberHandler(chatService))
+	protected.Delete("/rooms/group/:id/members/:userId", participantOnly, handlers.RemoveGroupMemberHandler(chatService))
+	protected.Put("/rooms/group/:id/members/:userId/role", participantOnly, handlers.SetGroupRoleHandler(chatService))
+
+	// Ordered pinned messages; every change broadcasts pin_changed with the full pin set
+	protected.Get("/rooms/:id/pins", participantOnly, handlers.ListPinsHandler(chatService))
+	protected.Post("/rooms/:id/pins", participantOnly, handlers.PinMessageHandler(chatService))
+	protected.Patch("/rooms/:id/pins/order", participantOnly, handlers.ReorderPinsHandler(chatService))
+	protected.Delete("/rooms/:id/pins/:messageId", participantOnly, handlers.UnpinMessageHandler(chatService))
+
+	// Room announcement banner; owners and admins set it, each user dismisses it for themselves
+	protected.Get("/rooms/:id/announcement", participantOnly, handlers.GetAnnouncementHandler(chatService))
+	protected.Put("/rooms/:id/announcement", participantOnly, handlers.SetAnnouncementHandler(chatService))
+	protected.Delete("/rooms/:id/announcement", participantOnly, handlers.ClearAnnouncementHandler(chatService))
+	protected.Post("/rooms/:id/announcement/dismiss", participantOnly, handlers.DismissAnnouncementHandler(chatService))
+
+	// Images, videos and documents sent to the room
+	protected.Post("/rooms/:id/attachments", participantOnly, handlers.UploadMetrics("attachment"), handlers.UploadAttachmentHandler(chatService))
+
+	// Lockdown: only owners and admins can post until unlocked or locked_until passes
+	protected.Put("/rooms/:id/lock", participantOnly, handlers.LockRoomHandler(chatService))
+	protected.Delete("/rooms/:id/lock", participantOnly, handlers.UnlockRoomHandler(chatService))
+
+	// Voice-only or text-only rooms
+	protected.Get("/rooms/:id/post-mode", participantOnly, handlers.GetRoomPostModeHandler(chatService))
+	protected.Put("/rooms/:id/post-mode", participantOnly, handlers.UpdateRoomPostModeHandler(chatService))
+	// Disappearing messages: new messages expire after the room's ttl (seconds, 0 = off)
+	protected.Get("/rooms/:id/message-ttl", participantOnly, handlers.GetRoomMessageTTLHandler(chatService))
+	protected.Put("/rooms/:id/message-ttl", participantOnly, handlers.UpdateRoomMessageTTLHandler(chatService))
+	protected.Get("/rooms/:id/welcome", participantOnly, handlers.GetRoomWelcomeHandler(chatService))
+	protected.Put("/rooms/:id/welcome", participantOnly, handlers.UpdateRoomWelcomeHandler(chatService))
+
+	// The caller's own settings for a room, such as muting it
+	protected.Put("/rooms/:id/settings", participantOnly, handlers.UpdateRoomSettingsHandler(chatService))
+
+	// Auto-translation into each participant's preferred language
+	protected.Get("/rooms/:id/translation", participantOnly, handlers.GetRoomTranslationHandler(chatService))
+	protected.Put("/rooms/:id/translation", participantOnly, handlers.UpdateRoomTranslationHandler(chatService))
+
+	// Consecutive voice messages for "play all"
+	protected.Get("/rooms/:id/voices/playlist", participantOnly, handlers.VoicePlaylistHandler(chatService))
+
+	// Top reacted messages, most active days and streaks, from rollup tables
+	protected.Get("/rooms/:id/insights", participantOnly, handlers.RoomInsightsHandler(chatService))
+
+	// Invite links; GET /invite/:code renders the preview for other apps
+	protected.Get("/rooms/:id/invites", participantOnly, handlers.ListInvitesHandler(chatService))
+	protected.Post("/rooms/:id/invites", participantOnly, handlers.CreateInviteHandler(chatService))
+	protected.Delete("/rooms/:id/invites/:code", participantOnly, handlers.RevokeInviteHandler(chatService))
+	protected.Post("/invites/:code/accept", handlers.AcceptInviteHandler(chatService))
+
+	// Incoming webhooks post messages into the room; owners and admins manage them
+	protected.Get("/rooms/:id/webhooks", participantOnly, handlers.ListWebhooksHandler(chatService))
+	protected.Post("/rooms/:id/webhooks", participantOnly, handlers.CreateWebhookHandler(chatService))
+	protected.Delete("/rooms/:id/webhooks/:webhookId", participantOnly, handlers.DeleteWebhookHandler(chatService))
+
+	// Support inbox: users open a conversation, any agent (SUPPORT_AGENTS) can claim it
+	protected.Post("/support", handlers.OpenSupportHandler(chatService))
+	protected.Post("/support/:id/resolve", handlers.ResolveSupportHandler(chatService))
+	protected.Get("/support/queue", handlers.SupportAgentMiddleware, handlers.SupportQueueHandler(chatService))
+	protected.Post("/support/:id/claim", handlers.SupportAgentMiddleware, handlers.ClaimSupportHandler(chatService))
+
 	// Profile endpoints
 	protected.Get("/profile", handlers.GetProfileHandler(userService))
 	protected.Put("/profile", handlers.UpdateProfileHandler(userService))
+	// Erase your account: personal data, photos, voice recordings and sessions
+	protected.Delete("/profile", handlers.DeleteAccountHandler(userService))
+	protected.Put("/profile/preferences", handlers.UpdatePreferencesHandler(userService))
+	protected.Get("/profile/notifications", handlers.GetNotificationSettingsHandler(userService))
+	protected.Put("/profile/notifications", handlers.UpdateNotificationSettingsHandler(userService))
+	protected.Post("/profile/email", handlers.RequestEmailChangeHandler(userService, mailer))
+	protected.Post("/profile/password", handlers.ChangePasswordHandler(userService))
+	protected.Get("/profile/email/history", handlers.EmailChangeAuditHandler(userService))
+	protected.Get("/profile/usage", handlers.UsageHandler(chatService))
 	// Upload a photo (field name: "photo")
-	protected.Put("/profile/photo", handlers.UploadPhotoHandler(userService))
+	protected.Put("/profile/photo", handlers.UploadMetrics("photo"), handlers.UploadPhotoHandler(userService))
 	// Delete a photo by id
 	protected.Delete("/profile/photo/:photo_id", handlers.DeletePhotoHandler(userService))
+	// Personal data archive; an export can be restored into another (new) account
+	protected.Get("/account/export", handlers.ExportAccountHandler(userService))
+	protected.Post("/account/import", handlers.ImportAccountHandler(userService))
+	// Signed links to uploads survive namespace rotation
+	protected.Get("/uploads/sign", handlers.SignUploadHandler(chatService))
+
+	// Edit or tombstone your own message; message_edited / message_deleted go to the room
+	protected.Patch("/messages/:id", handlers.EditMessageHandler(chatService))
+	protected.Delete("/messages/:id", handlers.DeleteMessageHandler(chatService))
+	// Undo send: removes the message outright within UNDO_SEND_WINDOW; message_retracted goes to participants
+	protected.Post("/messages/:id/retract", handlers.RetractMessageHandler(chatService))
+	// Per-recipient delivered/seen times of your own message
+	protected.Get("/messages/:id/receipts", handlers.MessageReceiptsHandler(chatService))
+	protected.Get("/messages/:id/thread", handlers.ThreadHandler(chatService))
+	// Direct replies to a message, paged back with ?before=&limit=
+	protected.Get("/messages/:id/replies", handlers.RepliesHandler(chatService))
 
 	// Voice message upload endpoints
 	// Standard upload - returns JSON response after completion
-	protected.Post("/messages/voice", handlers.UploadVoiceHandler(chatService))
+	protected.Post("/messages/voice", handlers.UploadMetrics("voice"), handlers.UploadVoiceHandler(chatService))
 	// Upload with SSE progress events - streams progress back to client
-	protected.Post("/messages/voice/progress", handlers.UploadVoiceWithProgressHandler(chatService))
+	protected.Post("/messages/voice/progress", handlers.UploadMetrics("voice"), handlers.UploadVoiceWithProgressHandler(chatService))
+	// Review-and-trim flow: stage the recording, optionally trim it, then publish
+	protected.Post("/voices", handlers.UploadMetrics("staged_voice"), handlers.StageMediaHandler(chatService))
+	protected.Post("/voices/:id/trim", handlers.TrimVoiceHandler(chatService))
+	protected.Post("/voices/:id/publish", handlers.PublishMediaHandler(chatService))
+
+	// Two-phase media send: stage, then publish over REST or a WS chat event with media_id
+	protected.Post("/media", handlers.StageMediaHandler(chatService))
+	protected.Post("/media/:id/publish", handlers.PublishMediaHandler(chatService))
+	protected.Delete("/media/:id", handlers.CancelStagedMediaHandler(chatService))
+
+	// Sticker and GIF packs; send one with a WS chat event carrying sticker_id
+	protected.Get("/stickers", handlers.StickersHandler(chatService))
+
+	// Admin Routes
+	admin := protected.Group("/admin")
+	admin.Use(handlers.AdminMiddleware)
+	admin.Get("/stats", handlers.AdminStatsHandler())
+	admin.Get("/info", handlers.AdminInfoHandler())
+	admin.Post("/import", handlers.AdminImportHandler(importService))
+	admin.Post("/rooms/bulk", handlers.BulkCreateRoomsHandler(chatService))
+	admin.Put("/rooms/:id/legal-hold", handlers.AdminRoomLegalHoldHandler(adminService))
+	admin.Put("/users/:id/legal-hold", handlers.AdminUserLegalHoldHandler(adminService))
+	admin.Post("/users/merge", handlers.AdminMergeUsersHandler(adminService))
+	admin.Post("/bots", handlers.AdminCreateBotHandler(userService))
+	admin.Get("/legal-holds/audit", handlers.AdminLegalHoldAuditHandler(adminService))
+	admin.Put("/rooms/:id/retention", handlers.AdminRoomRetentionHandler(adminService))
+	admin.Put("/rooms/:id/lock", handlers.LockRoomHandler(chatService))
+	admin.Delete("/rooms/:id/lock", handlers.UnlockRoomHandler(chatService))
+	admin.Get("/ip-filter", handlers.AdminGetIPFilterHandler())
+	admin.Put("/ip-filter", handlers.AdminUpdateIPFilterHandler())
+	admin.Get("/upload-policy", handlers.AdminGetUploadPolicyHandler())
+	admin.Put("/upload-policy", handlers.AdminUpdateUploadPolicyHandler())
+	admin.Post("/uploads/rotate", handlers.AdminRotateUploadsHandler(adminService))
+	admin.Get("/errors", handlers.AdminErrorGroupsHandler())
+	admin.Post("/config/reload", handlers.AdminReloadConfigHandler())
+	admin.Get("/mirrors", handlers.AdminListMirrorsHandler(adminService))
+	admin.Get("/tokens", handlers.AdminListTokensHandler(adminService))
+	admin.Post("/tokens", handlers.AdminCreateTokenHandler(adminService))
+	admin.Delete("/tokens/:id", handlers.AdminRevokeTokenHandler(adminService))
+	admin.Delete("/messages/:id", handlers.AdminDeleteMessageHandler(adminService))
+	admin.Delete("/messages/:id/hard", handlers.AdminHardDeleteMessageHandler(adminService))
+	admin.Get("/content/scan", handlers.AdminContentScanHandler(adminService))
+	admin.Post("/content/takedown", handlers.AdminTakedownHandler(adminService))
+	admin.Get("/users", handlers.AdminListUsersHandler(adminService))
+	admin.Put("/users/:id/role", handlers.AdminSetUserRoleHandler(adminService))
+	admin.Post("/users/:id/ban", handlers.AdminBanUserHandler(adminService))
+	admin.Delete("/users/:id/ban", handlers.AdminUnbanUserHandler(adminService))
+	admin.Delete("/rooms/:id", handlers.AdminDeleteRoomHandler(adminService))
+	admin.Post("/rooms/:id/purge", handlers.AdminPurgeRoomMessagesHandler(adminService, chatService))
+	admin.Get("/rooms/:id/stats", handlers.AdminRoomStatsHandler(adminService, chatService))
+	admin.Put("/rooms/:id/mirror", handlers.AdminEnableMirrorHandler(adminService))
+	admin.Post("/rooms/:id/mirror/rebuild", handlers.AdminRebuildMirrorHandler(adminService))
+	admin.Delete("/rooms/:id/mirror", handlers.AdminDisableMirrorHandler(adminService))
+	admin.Post("/sticker-packs", handlers.AdminCreateStickerPackHandler(adminService))
+	admin.Delete("/sticker-packs/:id", handlers.AdminDeleteStickerPackHandler(adminService))
+
+	// Invite link landing page with OpenGraph tags for link previews
+	app.Get("/invite/:code", handlers.InvitePageHandler(chatService))
+
+	// Incoming webhook URLs; the token is the credential
+	app.Post("/hooks/:token", handlers.IncomingWebhookHandler(chatService))
 
 	// Health Check
+	// Reports "degraded" while an external provider's circuit is open; the API itself still serves
 	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"status": "ok"})
+		status := "ok"
+		open := []string{}
+		for _, p := range services.ProvidersHealth() {
+			if p.State == "open" {
+				open = append(open, p.Name)
+			}
+		}
+		if len(open) > 0 {
+			status = "degraded"
+		}
+		return c.JSON(fiber.Map{"status": status, "providers_open": open})
 	})
 
+	// Readiness: 503 while the database is unreachable or the upload storage self-test fails
+	app.Get("/readyz", handlers.ReadyHandler())
+
+	// Prometheus metrics
+	app.Get("/metrics", metrics.Handler())
+
 	// WebSocket Route
 	// Note: Middleware order matters. AuthMiddleware checks token.
 	// WSUpgradeMiddleware checks if it's a WS request.
 	app.Use("/ws", handlers.WSUpgradeMiddleware)
-	app.Use("/ws", handlers.AuthMiddleware)
+	app.Use("/ws", handlers.WSAuthMiddleware)
 	app.Get("/ws", handlers.WebSocketHandler(chatService))
 
 	// Start Server
 	port := utils.GetEnv("PORT", "3001")
+	certFile, keyFile := utils.GetEnv("TLS_CERT_FILE", ""), utils.GetEnv("TLS_KEY_FILE", "")
 	go func() {
-		if err := app.Listen(":" + port); err != nil {
+		var err error
+		// fasthttp has no HTTP/2; TLS here is HTTP/1.1 and HTTP/2 is left to a reverse proxy
+		if certFile != "" && keyFile != "" {
+			err = app.ListenTLS(":"+port, certFile, keyFile)
+		} else {
+			err = app.Listen(":" + port)
+		}
+		if err != nil {
 			log.Panic(err)
 		}
 	}()
 
+	// SIGHUP reloads the hot-reloadable configuration, like POST /api/admin/config/reload
+	handlers.WatchReloadSignal(jobsCtx)
+
 	// Graceful Shutdown
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	<-c // Block until signal
 	log.Println("Gracefully shutting down...")
+	stopJobs()
+	handlers.ShutdownConnections()
 	_ = app.Shutdown()
+	handlers.StopSeenBatcher()
+	handlers.StopUsageRecorder()
+	handlers.StopReceiptRecorder()
 	log.Println("Server shutdown complete")
 }
@@ -0,0 +1,201 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+)
+
+// command is a CLI mode of the server binary, e.g. `server import ...`
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"import": {
+		usage: "import -room <id> [-format json|csv] [-user-map map.json] [-create-users] [-download-media] <file>",
+		run:   runImport,
+	},
+	"migrate": {
+		usage: "migrate",
+		run:   runMigrate,
+	},
+	"promote-admin": {
+		usage: "promote-admin <username>",
+		run:   runPromoteAdmin,
+	},
+	"seed-demo": {
+		usage: "seed-demo [-users n] [-messages n] [-password p] [-seed n] [-force]",
+		run:   runSeedDemo,
+	},
+}
+
+// RunCommand executes a CLI mode and returns the process exit code
+func RunCommand(args []string) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\nAvailable commands:\n", args[0])
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+		}
+		return 2
+	}
+	if err := cmd.run(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func runMigrate(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("migrate takes no arguments")
+	}
+	connectDB()
+	defer db.CloseDB()
+	return migrate()
+}
+
+// runPromoteAdmin gives the admin role to an existing account while there is no admin yet
+func runPromoteAdmin(args []string) error {
+	if len(args) != 1 || args[0] == "" {
+		return fmt.Errorf("expected exactly one username")
+	}
+	connectDB()
+	defer db.CloseDB()
+
+	userID, err := services.BootstrapAdmin(context.Background(), args[0])
+	if errors.Is(err, services.ErrNotFound) {
+		return fmt.Errorf("no active account named %q", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s (user %d) is now an admin\n", args[0], userID)
+	return nil
+}
+
+// demoSizes are the seed-demo defaults per APP_ENV: a small dataset for local development and
+// a larger one for shared QA and staging environments
+var demoSizes = map[string]models.DemoSeedOptions{
+	"development": {Users: 4, MessagesPerRoom: 20},
+	"qa":          {Users: 12, MessagesPerRoom: 150},
+	"staging":     {Users: 12, MessagesPerRoom: 150},
+}
+
+func runSeedDemo(args []string) error {
+	connectDB()
+	defer db.CloseDB()
+
+	env := utils.GetEnv("APP_ENV", "development")
+	defaults, ok := demoSizes[env]
+	if !ok {
+		defaults = demoSizes["development"]
+	}
+	fs := flag.NewFlagSet("seed-demo", flag.ContinueOnError)
+	users := fs.Int("users", defaults.Users, fmt.Sprintf("demo accounts to create (2-%d)", services.MaxDemoUsers))
+	messages := fs.Int("messages", defaults.MessagesPerRoom, "messages per room")
+	password := fs.String("password", "demo1234", "password of every demo account")
+	seed := fs.Int64("seed", 1, "random seed; the same seed gives the same dataset")
+	force := fs.Bool("force", false, "seed even when APP_ENV is production")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if env == "production" && !*force {
+		return fmt.Errorf("refusing to seed demo data in production without -force")
+	}
+
+	result, err := services.SeedDemo(context.Background(), models.DemoSeedOptions{
+		Users:           *users,
+		MessagesPerRoom: *messages,
+		Password:        *password,
+		Seed:            *seed,
+	})
+	if err != nil {
+		return err
+	}
+	out, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(out))
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	room := fs.String("room", "", "target room ID")
+	format := fs.String("format", "", "json or csv (defaults to the file extension)")
+	userMapPath := fs.String("user-map", "", "JSON file mapping export usernames to local usernames")
+	createUsers := fs.Bool("create-users", false, "create placeholder accounts for unknown users")
+	downloadMedia := fs.Bool("download-media", false, "download media_url files into the uploads directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected exactly one export file")
+	}
+	path := fs.Arg(0)
+
+	opts := models.ImportOptions{
+		Room:               *room,
+		CreateMissingUsers: *createUsers,
+		DownloadMedia:      *downloadMedia,
+	}
+	if *userMapPath != "" {
+		b, err := os.ReadFile(*userMapPath)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, &opts.UserMap); err != nil {
+			return fmt.Errorf("invalid user map: %w", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	var records []models.ImportRecord
+	switch *format {
+	case "json":
+		records, err = services.ParseImportJSON(f)
+	case "csv":
+		records, err = services.ParseImportCSV(f)
+	default:
+		return fmt.Errorf("format must be json or csv")
+	}
+	if err != nil {
+		return err
+	}
+
+	connectDB()
+	defer db.CloseDB()
+
+	result, err := services.NewImportService().Import(context.Background(), records, opts)
+	if err != nil {
+		return err
+	}
+	out, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(out))
+	return nil
+}
@@ -6,39 +6,134 @@ import (
 	"log"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var Pool *pgxpool.Pool
 
+// PoolOptions controls connection pool sizing and statement caching
+type PoolOptions struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	// StatementCacheMode is one of: cache_statement, cache_describe, describe_exec, exec, simple_protocol
+	StatementCacheMode string
+}
+
+// DefaultPoolOptions returns the pool settings used when nothing is configured
+func DefaultPoolOptions() PoolOptions {
+	return PoolOptions{
+		MaxConns:           10,
+		MinConns:           2,
+		MaxConnLifetime:    time.Hour,
+		MaxConnIdleTime:    30 * time.Minute,
+		HealthCheckPeriod:  time.Minute,
+		StatementCacheMode: "cache_statement",
+	}
+}
+
+var queryExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
 // InitDB initializes the PostgreSQL connection pool
-func InitDB(connString string) error {
+func InitDB(connString string, opts PoolOptions) error {
+	var err error
+	Pool, err = newPool(connString, opts)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Connected to PostgreSQL (max_conns=%d, min_conns=%d, cache_mode=%s)", opts.MaxConns, opts.MinConns, opts.StatementCacheMode)
+	return nil
+}
+
+// newPool creates and pings a connection pool with the given settings
+func newPool(connString string, opts PoolOptions) (*pgxpool.Pool, error) {
 	config, err := pgxpool.ParseConfig(connString)
 	if err != nil {
-		return fmt.Errorf("unable to parse connection string: %w", err)
+		return nil, fmt.Errorf("unable to parse connection string: %w", err)
 	}
 
-	config.MaxConns = 10
-	config.MinConns = 2
-	config.MaxConnLifetime = time.Hour
-	config.MaxConnIdleTime = 30 * time.Minute
+	config.MaxConns = opts.MaxConns
+	config.MinConns = opts.MinConns
+	config.MaxConnLifetime = opts.MaxConnLifetime
+	config.MaxConnIdleTime = opts.MaxConnIdleTime
+	config.HealthCheckPeriod = opts.HealthCheckPeriod
+
+	if opts.StatementCacheMode != "" {
+		mode, ok := queryExecModes[opts.StatementCacheMode]
+		if !ok {
+			return nil, fmt.Errorf("unknown statement cache mode %q", opts.StatementCacheMode)
+		}
+		config.ConnConfig.DefaultQueryExecMode = mode
+	}
 
-	Pool, err = pgxpool.NewWithConfig(context.Background(), config)
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
-		return fmt.Errorf("unable to create connection pool: %w", err)
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
 
 	// Test connection
-	if err := Pool.Ping(context.Background()); err != nil {
-		return fmt.Errorf("unable to ping database: %w", err)
+	if err := pool.Ping(context.Background()); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("unable to ping database: %w", err)
 	}
+	return pool, nil
+}
 
-	log.Println("Connected to PostgreSQL")
-	return nil
+// PoolStats is a JSON-friendly snapshot of pgxpool statistics
+type PoolStats struct {
+	MaxConns                int32   `json:"max_conns"`
+	TotalConns              int32   `json:"total_conns"`
+	AcquiredConns           int32   `json:"acquired_conns"`
+	IdleConns               int32   `json:"idle_conns"`
+	ConstructingConns       int32   `json:"constructing_conns"`
+	AcquireCount            int64   `json:"acquire_count"`
+	EmptyAcquireCount       int64   `json:"empty_acquire_count"`
+	CanceledAcquireCount    int64   `json:"canceled_acquire_count"`
+	AcquireDurationSeconds  float64 `json:"acquire_duration_seconds"`
+	NewConnsCount           int64   `json:"new_conns_count"`
+	MaxLifetimeDestroyCount int64   `json:"max_lifetime_destroy_count"`
+	MaxIdleDestroyCount     int64   `json:"max_idle_destroy_count"`
+}
+
+// Stats returns the current pool statistics. Zero values are returned before InitDB.
+func Stats() PoolStats {
+	if Pool == nil {
+		return PoolStats{}
+	}
+	return poolStats(Pool)
+}
+
+func poolStats(pool *pgxpool.Pool) PoolStats {
+	s := pool.Stat()
+	return PoolStats{
+		MaxConns:                s.MaxConns(),
+		TotalConns:              s.TotalConns(),
+		AcquiredConns:           s.AcquiredConns(),
+		IdleConns:               s.IdleConns(),
+		ConstructingConns:       s.ConstructingConns(),
+		AcquireCount:            s.AcquireCount(),
+		EmptyAcquireCount:       s.EmptyAcquireCount(),
+		CanceledAcquireCount:    s.CanceledAcquireCount(),
+		AcquireDurationSeconds:  s.AcquireDuration().Seconds(),
+		NewConnsCount:           s.NewConnsCount(),
+		MaxLifetimeDestroyCount: s.MaxLifetimeDestroyCount(),
+		MaxIdleDestroyCount:     s.MaxIdleDestroyCount(),
+	}
 }
 
 // CloseDB closes the database connection pool
 func CloseDB() {
+	closeReplicas()
 	if Pool != nil {
 		Pool.Close()
 	}
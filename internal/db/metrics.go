@@ -0,0 +1,31 @@
+package db
+
+import "chat-backend/internal/metrics"
+
+// failoverRetriesTotal counts queries retried by WithFailoverRetry
+var failoverRetriesTotal = metrics.NewCounter("db_failover_retries_total", "Queries retried while the primary was unavailable")
+
+// RegisterMetrics exposes pool statistics as gauges, read from Pool.Stat() at scrape time
+func RegisterMetrics() {
+	gauge := func(name, help string, fn func(s PoolStats) float64) {
+		metrics.NewGaugeFunc(name, help, func() float64 { return fn(Stats()) })
+	}
+	gauge("db_pool_max_conns", "Maximum size of the connection pool", func(s PoolStats) float64 { return float64(s.MaxConns) })
+	gauge("db_pool_total_conns", "Total connections currently in the pool", func(s PoolStats) float64 { return float64(s.TotalConns) })
+	gauge("db_pool_acquired_conns", "Connections currently acquired by the application", func(s PoolStats) float64 { return float64(s.AcquiredConns) })
+	gauge("db_pool_idle_conns", "Idle connections in the pool", func(s PoolStats) float64 { return float64(s.IdleConns) })
+	gauge("db_pool_constructing_conns", "Connections being established", func(s PoolStats) float64 { return float64(s.ConstructingConns) })
+	gauge("db_pool_acquire_total", "Cumulative successful acquires", func(s PoolStats) float64 { return float64(s.AcquireCount) })
+	gauge("db_pool_empty_acquire_total", "Cumulative acquires that had to wait for a connection", func(s PoolStats) float64 { return float64(s.EmptyAcquireCount) })
+	gauge("db_pool_canceled_acquire_total", "Cumulative acquires canceled by context", func(s PoolStats) float64 { return float64(s.CanceledAcquireCount) })
+	gauge("db_pool_acquire_duration_seconds_total", "Cumulative time spent waiting for connections", func(s PoolStats) float64 { return s.AcquireDurationSeconds })
+	metrics.NewGaugeFunc("db_replicas_healthy", "Read replicas currently used for reads", func() float64 {
+		n := 0
+		for _, r := range ReplicasStats() {
+			if r.Healthy {
+				n++
+			}
+		}
+		return float64(n)
+	})
+}
@@ -0,0 +1,741 @@
+-- Schema as of the introduction of versioned migrations: the former migrations/001 to 052,
+-- applied in order. Every statement is idempotent, so databases that were set up by running
+-- those files directly are brought under version control by applying this one.
+
+-- 001_create_users_and_messages
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(50) UNIQUE NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id SERIAL PRIMARY KEY,
+    room VARCHAR(100) NOT NULL,
+    user_id INTEGER REFERENCES users(id),
+    username VARCHAR(50) NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_room ON messages(room);
+CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
+
+-- 002_create_rooms
+CREATE TABLE IF NOT EXISTS rooms (
+    id VARCHAR(36) PRIMARY KEY, -- UUID string
+    type VARCHAR(20) NOT NULL DEFAULT 'direct',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS room_participants (
+    room_id VARCHAR(36) REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    joined_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (room_id, user_id)
+);
+
+-- Index to quickly find rooms for a user
+CREATE INDEX IF NOT EXISTS idx_room_participants_user_id ON room_participants(user_id);
+
+-- 003_add_has_seen_to_messages
+-- Add has_seen boolean to messages table
+ALTER TABLE messages
+ADD COLUMN IF NOT EXISTS has_seen BOOLEAN DEFAULT FALSE;
+
+-- Optional: Index if you plan to query unseen messages
+CREATE INDEX IF NOT EXISTS idx_messages_has_seen ON messages(has_seen);
+
+-- 004_add_reply_to_to_messages
+-- Add reply_to JSONB column to messages
+ALTER TABLE messages
+ADD COLUMN IF NOT EXISTS reply_to JSONB DEFAULT NULL;
+
+-- No index added since this is a JSONB payload; if you only need to reference by id consider storing reply_to_id separately.
+
+-- 005_add_user_names_and_photos
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS first_name VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS last_name VARCHAR(100);
+
+CREATE TABLE IF NOT EXISTS photos (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    url TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_photos_user_id ON photos(user_id);
+
+-- 006_add_voice_to_messages
+-- Add voice column to messages table for voice messages
+-- Either content (text) or voice must be non-null, but not both null at the same time
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS voice VARCHAR(500) NULL;
+
+-- Add a check constraint to ensure at least one of content or voice is not null/empty.
+-- It is replaced further down; NOT VALID so that rerunning this file on a database created by
+-- the old migration scripts doesn't check tombstones and attachments against it.
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS chk_message_content_or_voice;
+ALTER TABLE messages ADD CONSTRAINT chk_message_content_or_voice
+    CHECK (
+        (content IS NOT NULL AND content != '') OR
+        (voice IS NOT NULL AND voice != '')
+    ) NOT VALID;
+
+-- Make content nullable since voice messages may not have text
+ALTER TABLE messages ALTER COLUMN content DROP NOT NULL;
+
+-- 007_add_expires_at_to_messages
+-- Per-message TTL: messages with expires_at in the past are hidden and swept
+ALTER TABLE messages
+ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+
+-- Partial index so the sweeper only scans messages that can expire
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages(expires_at) WHERE expires_at IS NOT NULL;
+
+-- 008_add_retention_and_legal_hold
+-- Per-room retention override (NULL = use the deployment default) and legal hold flags
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS retention_days INTEGER DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS legal_hold BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS legal_hold BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Audit trail of holds being applied and released
+CREATE TABLE IF NOT EXISTS legal_hold_audit (
+    id SERIAL PRIMARY KEY,
+    target_type VARCHAR(10) NOT NULL, -- 'room' or 'user'
+    target_id VARCHAR(36) NOT NULL,
+    action VARCHAR(10) NOT NULL, -- 'applied' or 'released'
+    admin_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_legal_hold_audit_target ON legal_hold_audit(target_type, target_id);
+
+-- 009_add_voice_meta_to_messages
+-- Voice metadata (duration and waveform peaks) used for reply previews and room list thumbnails
+ALTER TABLE messages
+ADD COLUMN IF NOT EXISTS voice_meta JSONB DEFAULT NULL;
+
+-- 010_add_user_devices
+-- Optional email used for account notifications
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email VARCHAR(255) DEFAULT NULL;
+
+-- Devices seen at login; refresh tokens carry the device id so revoking a device ends its session
+CREATE TABLE IF NOT EXISTS user_devices (
+    id VARCHAR(36) PRIMARY KEY, -- UUID string
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    fingerprint VARCHAR(64) NOT NULL, -- sha256 hex of client device id + user agent
+    user_agent TEXT,
+    ip VARCHAR(45),
+    revoke_token VARCHAR(64) NOT NULL UNIQUE, -- secret used by the one-click revoke link
+    first_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    UNIQUE (user_id, fingerprint)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_devices_user_id ON user_devices(user_id);
+
+-- 011_add_user_notification_preferences
+-- Preferred language for notifications (and later translations) and message preview privacy
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS language VARCHAR(10) NOT NULL DEFAULT 'en',
+    ADD COLUMN IF NOT EXISTS message_preview BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- 012_add_room_membership_history
+-- Membership history: participants are soft-removed so past membership stays queryable
+ALTER TABLE room_participants
+    ADD COLUMN IF NOT EXISTS left_at TIMESTAMP WITH TIME ZONE NULL,
+    ADD COLUMN IF NOT EXISTS invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+-- member_added / member_removed events replayed into the room stream
+CREATE TABLE IF NOT EXISTS room_membership_events (
+    id SERIAL PRIMARY KEY,
+    room_id VARCHAR(36) REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    event VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_membership_events_room ON room_membership_events(room_id, created_at);
+
+-- Backfill a member_added event for existing participants
+INSERT INTO room_membership_events (room_id, user_id, event, created_at)
+SELECT p.room_id, p.user_id, 'member_added', p.joined_at
+FROM room_participants p
+WHERE NOT EXISTS (
+    SELECT 1 FROM room_membership_events e WHERE e.room_id = p.room_id AND e.user_id = p.user_id
+);
+
+-- 013_create_message_reactions
+-- Emoji reactions, one row per (message, user, emoji)
+CREATE TABLE IF NOT EXISTS message_reactions (
+    message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    emoji VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id, emoji)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_reactions_message_id ON message_reactions(message_id);
+
+-- 014_create_staged_media
+-- Uploads that are stored but not yet sent as a message (review/trim before send)
+CREATE TABLE IF NOT EXISTS staged_media (
+    id VARCHAR(36) PRIMARY KEY, -- UUID string
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    room VARCHAR(100) NOT NULL,
+    kind VARCHAR(20) NOT NULL DEFAULT 'voice',
+    filename VARCHAR(500) NOT NULL,
+    voice_meta JSONB DEFAULT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_staged_media_user_id ON staged_media(user_id);
+
+-- 015_create_email_changes
+-- Pending and completed email changes; both the old and the new address must confirm
+CREATE TABLE IF NOT EXISTS email_changes (
+    id VARCHAR(36) PRIMARY KEY, -- UUID string, referenced by the signed confirmation tokens
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_email VARCHAR(255),
+    new_email VARCHAR(255) NOT NULL,
+    old_confirmed_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    new_confirmed_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    applied_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    rolled_back_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    cancelled_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_changes_user_id ON email_changes(user_id);
+
+CREATE TABLE IF NOT EXISTS email_change_audit (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    change_id VARCHAR(36) REFERENCES email_changes(id) ON DELETE SET NULL,
+    action VARCHAR(30) NOT NULL, -- requested, confirmed_old, confirmed_new, applied, rolled_back, cancelled
+    old_email VARCHAR(255),
+    new_email VARCHAR(255),
+    ip VARCHAR(45),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_change_audit_user_id ON email_change_audit(user_id);
+
+-- 016_create_admin_audit_log
+-- General audit trail for administrative operations (user merges, ...)
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    id SERIAL PRIMARY KEY,
+    admin_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(50) NOT NULL,
+    target_type VARCHAR(20) NOT NULL,
+    target_id VARCHAR(36) NOT NULL,
+    details JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_target ON admin_audit_log(target_type, target_id);
+
+-- 017_add_room_templates_and_system_messages
+-- Named rooms created from configuration (DEFAULT_ROOMS); template_key keeps them unique
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS name VARCHAR(100) DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS template_key VARCHAR(100) DEFAULT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_rooms_template_key ON rooms(template_key);
+
+-- Messages posted by the bot account (welcome messages, status changes)
+ALTER TABLE messages
+    ADD COLUMN IF NOT EXISTS system BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 018_add_support_rooms
+-- Support inbox: rooms of type 'support' opened by a user and claimed by an agent
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS support_user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS support_status VARCHAR(20) DEFAULT NULL, -- 'open', 'claimed' or 'resolved'
+    ADD COLUMN IF NOT EXISTS claimed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS support_updated_at TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_rooms_support_status ON rooms(support_status) WHERE type = 'support';
+CREATE INDEX IF NOT EXISTS idx_rooms_support_user ON rooms(support_user_id) WHERE type = 'support';
+
+-- 019_add_oidc_auth_codes
+-- Authorization codes issued by the OIDC provider; only the SHA-256 hash of a code is stored
+CREATE TABLE IF NOT EXISTS oidc_auth_codes (
+    code_hash VARCHAR(64) PRIMARY KEY,
+    client_id VARCHAR(100) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    nonce TEXT DEFAULT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_auth_codes_expires ON oidc_auth_codes(expires_at);
+
+-- 020_create_bot_api_keys
+-- API keys for integration bots (users.is_bot); only the SHA-256 hash of a key is stored
+CREATE TABLE IF NOT EXISTS bot_api_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    last_used_at TIMESTAMP DEFAULT NULL,
+    revoked_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_bot_api_keys_user ON bot_api_keys(user_id);
+
+-- 021_create_pinned_messages
+-- Ordered pinned messages per room; position 0 is shown first
+CREATE TABLE IF NOT EXISTS pinned_messages (
+    room_id VARCHAR(36) NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    pinned_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    position INTEGER NOT NULL,
+    pinned_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (room_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pinned_messages_order ON pinned_messages(room_id, position);
+
+-- 022_add_room_translation
+-- Per-room auto-translation: messages are translated into each participant's users.language
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS language VARCHAR(10) DEFAULT NULL, -- Source language, NULL = detect
+    ADD COLUMN IF NOT EXISTS auto_translate BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 023_create_upload_namespaces
+-- Versioned URL prefixes for /uploads. Rotating retires every earlier prefix, which
+-- invalidates public links shared with it; signed URLs are redirected to the current prefix.
+CREATE TABLE IF NOT EXISTS upload_namespaces (
+    version SERIAL PRIMARY KEY,
+    prefix VARCHAR(32) NOT NULL UNIQUE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- 024_create_room_mirrors
+-- Public rooms exported as a static HTML archive; the counters drive incremental regeneration
+CREATE TABLE IF NOT EXISTS room_mirrors (
+    room_id VARCHAR(36) PRIMARY KEY REFERENCES rooms(id) ON DELETE CASCADE,
+    last_message_id INTEGER NOT NULL DEFAULT 0,
+    message_count INTEGER NOT NULL DEFAULT 0,
+    enabled_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    exported_at TIMESTAMP
+);
+
+-- 025_add_voice_expired_to_messages
+-- Set when the voice file was removed by the voice cleanup policy; the message row is kept
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS voice_expired BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_messages_live_voice ON messages(created_at) WHERE voice IS NOT NULL AND NOT voice_expired;
+
+-- 026_create_room_webhooks
+-- Incoming webhooks: POST /hooks/<token> posts a bot message into the room.
+-- Only the SHA-256 hash of the token is stored.
+CREATE TABLE IF NOT EXISTS room_webhooks (
+    id SERIAL PRIMARY KEY,
+    room_id VARCHAR(36) NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    template TEXT,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    last_used_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_webhooks_room ON room_webhooks(room_id);
+
+-- 027_create_room_insight_rollups
+-- Rollups behind GET /api/rooms/:id/insights, kept current by triggers so insights never scan messages.
+-- Daily activity is history: it is not decremented when messages expire or are purged.
+CREATE TABLE IF NOT EXISTS room_daily_activity (
+    room VARCHAR(100) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day DATE NOT NULL, -- UTC
+    messages INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (room, day, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_daily_activity_user ON room_daily_activity(user_id, room, day);
+
+-- Reaction totals per message; rows go away with the message
+CREATE TABLE IF NOT EXISTS message_reaction_counts (
+    message_id INTEGER PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    room VARCHAR(100) NOT NULL,
+    reactions INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_reaction_counts_room ON message_reaction_counts(room, reactions DESC);
+
+CREATE OR REPLACE FUNCTION rollup_message_activity() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.user_id IS NOT NULL AND NOT NEW.system THEN
+        INSERT INTO room_daily_activity (room, user_id, day, messages)
+        VALUES (NEW.room, NEW.user_id, (NEW.created_at AT TIME ZONE 'UTC')::date, 1)
+        ON CONFLICT (room, day, user_id) DO UPDATE SET messages = room_daily_activity.messages + 1;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS messages_rollup_activity ON messages;
+CREATE TRIGGER messages_rollup_activity AFTER INSERT ON messages
+    FOR EACH ROW EXECUTE FUNCTION rollup_message_activity();
+
+CREATE OR REPLACE FUNCTION rollup_message_reactions() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO message_reaction_counts (message_id, room, reactions)
+        SELECT m.id, m.room, 1 FROM messages m WHERE m.id = NEW.message_id
+        ON CONFLICT (message_id) DO UPDATE SET reactions = message_reaction_counts.reactions + 1;
+    ELSE
+        UPDATE message_reaction_counts SET reactions = GREATEST(reactions - 1, 0) WHERE message_id = OLD.message_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS message_reactions_rollup ON message_reactions;
+CREATE TRIGGER message_reactions_rollup AFTER INSERT OR DELETE ON message_reactions
+    FOR EACH ROW EXECUTE FUNCTION rollup_message_reactions();
+
+-- Backfill from existing data
+INSERT INTO room_daily_activity (room, user_id, day, messages)
+SELECT room, user_id, (created_at AT TIME ZONE 'UTC')::date, COUNT(*)
+FROM messages WHERE user_id IS NOT NULL AND NOT system
+GROUP BY 1, 2, 3
+ON CONFLICT (room, day, user_id) DO NOTHING;
+
+INSERT INTO message_reaction_counts (message_id, room, reactions)
+SELECT r.message_id, m.room, COUNT(*)
+FROM message_reactions r JOIN messages m ON m.id = r.message_id
+GROUP BY 1, 2
+ON CONFLICT (message_id) DO NOTHING;
+
+-- 028_add_silent_to_messages
+-- Silent messages are stored and broadcast but never notify (new_message, push)
+ALTER TABLE messages
+    ADD COLUMN IF NOT EXISTS silent BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 029_create_room_invites
+-- Shareable invite links: GET /invite/<code> previews the room, POST /api/invites/<code>/accept joins it
+CREATE TABLE IF NOT EXISTS room_invites (
+    code VARCHAR(32) PRIMARY KEY,
+    room_id VARCHAR(36) NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE DEFAULT NULL -- NULL never expires
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_invites_room ON room_invites(room_id);
+
+-- 030_add_group_rooms
+-- Group rooms (rooms.type = 'group'): participants have an owner, admin or member role
+ALTER TABLE room_participants
+    ADD COLUMN IF NOT EXISTS role VARCHAR(10) NOT NULL DEFAULT 'member';
+
+CREATE INDEX IF NOT EXISTS idx_room_participants_room_role ON room_participants(room_id, role) WHERE left_at IS NULL;
+
+-- 031_add_message_edit_delete
+-- Edited messages keep their id and get edited_at; deleted messages become tombstones
+-- (content and voice cleared, deleted_at set) so clients can update them in place
+ALTER TABLE messages
+    ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+
+-- A tombstone has neither content nor voice (replaced further down, hence NOT VALID)
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS chk_message_content_or_voice;
+ALTER TABLE messages ADD CONSTRAINT chk_message_content_or_voice
+    CHECK (
+        deleted_at IS NOT NULL OR
+        (content IS NOT NULL AND content != '') OR
+        (voice IS NOT NULL AND voice != '')
+    ) NOT VALID;
+
+-- 032_create_room_announcements
+-- One announcement per room: a message shown as a banner in the room list and on join
+CREATE TABLE IF NOT EXISTS room_announcements (
+    room_id VARCHAR(36) PRIMARY KEY REFERENCES rooms(id) ON DELETE CASCADE,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    set_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    set_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Users who dismissed the room's current announcement; cleared whenever a new one is set
+CREATE TABLE IF NOT EXISTS room_announcement_dismissals (
+    room_id VARCHAR(36) NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    dismissed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (room_id, user_id)
+);
+
+-- 033_create_admin_api_tokens
+-- Scoped tokens for admin automation; only the SHA-256 hash of a token is stored.
+-- Tokens die with the admin account that issued them.
+CREATE TABLE IF NOT EXISTS admin_api_tokens (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE DEFAULT NULL
+);
+
+-- 034_add_message_version
+-- Incremented by every edit; clients send the version they edited so stale offline edits are detected
+ALTER TABLE messages
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 0;
+
+-- 035_add_room_lock
+-- Lockdown: while locked_at is set only owners and admins may post; locked_until unlocks automatically
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS locked_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS locked_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS lock_reason VARCHAR(200) DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_rooms_locked_until ON rooms(locked_until) WHERE locked_until IS NOT NULL;
+
+-- 036_create_user_daily_usage
+-- Per-user usage behind GET /api/profile/usage. Messages are counted by a trigger; uploads,
+-- WS events and API requests are batched in memory by the server and added periodically.
+CREATE TABLE IF NOT EXISTS user_daily_usage (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day DATE NOT NULL, -- UTC
+    messages INTEGER NOT NULL DEFAULT 0,
+    uploads INTEGER NOT NULL DEFAULT 0,
+    upload_bytes BIGINT NOT NULL DEFAULT 0,
+    ws_events INTEGER NOT NULL DEFAULT 0,
+    api_requests INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day)
+);
+
+CREATE OR REPLACE FUNCTION rollup_user_message_usage() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.user_id IS NOT NULL AND NOT NEW.system THEN
+        INSERT INTO user_daily_usage (user_id, day, messages)
+        VALUES (NEW.user_id, (NEW.created_at AT TIME ZONE 'UTC')::date, 1)
+        ON CONFLICT (user_id, day) DO UPDATE SET messages = user_daily_usage.messages + 1;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS messages_rollup_user_usage ON messages;
+CREATE TRIGGER messages_rollup_user_usage AFTER INSERT ON messages
+    FOR EACH ROW EXECUTE FUNCTION rollup_user_message_usage();
+
+-- Backfill message counts from the room rollups
+INSERT INTO user_daily_usage (user_id, day, messages)
+SELECT user_id, day, SUM(messages) FROM room_daily_activity GROUP BY 1, 2
+ON CONFLICT (user_id, day) DO NOTHING;
+
+-- 037_create_cluster_event_payloads
+-- Cross-instance events larger than a NOTIFY payload (8000 bytes) are stored here and the
+-- notification carries only the row id. Rows are deleted by publishers after a few minutes.
+CREATE TABLE IF NOT EXISTS cluster_event_payloads (
+    id BIGSERIAL PRIMARY KEY,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_cluster_event_payloads_created_at ON cluster_event_payloads(created_at);
+
+-- 038_add_users_last_seen
+-- When the user last had a live WebSocket connection; updated on connect and disconnect
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+
+-- 039_create_files
+-- Attachments (images, video, documents) stored under UPLOAD_DIR/files. The message keeps
+-- a copy of the metadata in messages.file so history and broadcasts need no join.
+CREATE TABLE IF NOT EXISTS files (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    room VARCHAR(100) NOT NULL,
+    message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+    filename VARCHAR(500) NOT NULL, -- Stored name under UPLOAD_DIR/files
+    name VARCHAR(255) NOT NULL,     -- Name the file was uploaded with
+    content_type VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL,      -- image, video or document
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_files_room ON files(room);
+CREATE INDEX IF NOT EXISTS idx_files_user_id ON files(user_id);
+CREATE INDEX IF NOT EXISTS idx_files_message_id ON files(message_id);
+
+ALTER TABLE messages
+ADD COLUMN IF NOT EXISTS file JSONB DEFAULT NULL;
+
+-- A message may consist of just an attachment
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS chk_message_content_or_voice;
+ALTER TABLE messages ADD CONSTRAINT chk_message_content_or_voice
+    CHECK (
+        deleted_at IS NOT NULL OR
+        (content IS NOT NULL AND content != '') OR
+        (voice IS NOT NULL AND voice != '') OR
+        file IS NOT NULL
+    );
+
+-- 040_create_device_tokens
+-- Push tokens of the user's mobile apps. A token belongs to one app install, so registering
+-- it again (even for another account) moves it.
+CREATE TABLE IF NOT EXISTS device_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    platform VARCHAR(10) NOT NULL CHECK (platform IN ('fcm', 'apns')),
+    token VARCHAR(512) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_tokens_user_id ON device_tokens(user_id);
+
+-- 041_create_message_receipts
+-- Per-recipient receipts: delivered when a chat event reached one of the recipient's
+-- connections, seen when they marked the message seen. has_seen on messages stays the
+-- room-wide flag.
+CREATE TABLE IF NOT EXISTS message_receipts (
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    delivered_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    seen_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_receipts_user_unseen ON message_receipts(user_id) WHERE seen_at IS NULL;
+
+-- 042_bigint_message_ids
+-- Message ids become BIGINT so they can come from a snowflake generator
+-- (MESSAGE_ID_GENERATOR=snowflake). Columns holding message ids follow. Serial ids keep
+-- working; the sequence continues where it was.
+ALTER TABLE messages ALTER COLUMN id TYPE BIGINT;
+ALTER SEQUENCE IF EXISTS messages_id_seq AS BIGINT;
+
+ALTER TABLE message_reactions ALTER COLUMN message_id TYPE BIGINT;
+ALTER TABLE pinned_messages ALTER COLUMN message_id TYPE BIGINT;
+ALTER TABLE message_reaction_counts ALTER COLUMN message_id TYPE BIGINT;
+ALTER TABLE room_announcements ALTER COLUMN message_id TYPE BIGINT;
+ALTER TABLE files ALTER COLUMN message_id TYPE BIGINT;
+ALTER TABLE message_receipts ALTER COLUMN message_id TYPE BIGINT;
+ALTER TABLE room_mirrors ALTER COLUMN last_message_id TYPE BIGINT;
+
+-- 043_add_room_post_mode
+-- Post mode restricts which messages a room accepts: 'any', 'voice' (voice messages only,
+-- e.g. audio diaries) or 'text' (text messages only)
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS post_mode VARCHAR(10) NOT NULL DEFAULT 'any'
+        CHECK (post_mode IN ('any', 'voice', 'text'));
+
+-- 044_create_message_mentions
+-- Users @mentioned in a message; only room participants at send time are recorded
+CREATE TABLE IF NOT EXISTS message_mentions (
+    message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_mentions_user ON message_mentions(user_id, created_at DESC);
+
+-- 045_add_room_mute
+-- Per-user mute: no new_message notifications for the room until muted_until
+-- ('infinity' while muted until unmuted). Unread counts and mentions are unaffected.
+ALTER TABLE room_participants ADD COLUMN IF NOT EXISTS muted_until TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+
+-- 046_create_upload_hashes
+-- SHA-256 of every published upload, keyed like the storage backend ("voices/<file>",
+-- "files/<file>", photos at the root), so moderation can find copies of known content
+CREATE TABLE IF NOT EXISTS upload_hashes (
+    key VARCHAR(600) PRIMARY KEY,
+    sha256 CHAR(64) NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_hashes_sha256 ON upload_hashes(sha256);
+
+-- 047_add_thread_id_to_messages
+-- Root message of the reply chain a message belongs to; NULL for messages that aren't replies.
+-- reply_to only embeds a copy of the parent, so threads couldn't be queried before.
+ALTER TABLE messages
+ADD COLUMN IF NOT EXISTS thread_id BIGINT DEFAULT NULL;
+
+-- Backfill existing replies by walking the embedded reply_to ids down from each root.
+-- Replies whose parent was deleted (tombstones drop reply_to) start a new thread.
+WITH RECURSIVE chain AS (
+    SELECT id, room, id AS root FROM messages WHERE reply_to IS NULL
+    UNION ALL
+    SELECT m.id, m.room, chain.root
+    FROM messages m JOIN chain ON m.room = chain.room AND (m.reply_to->>'id')::bigint = chain.id
+)
+UPDATE messages SET thread_id = chain.root
+FROM chain
+WHERE messages.id = chain.id AND chain.id <> chain.root;
+
+CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages(thread_id, created_at) WHERE thread_id IS NOT NULL;
+
+-- 048_add_notification_matrix
+-- Per event type and channel notification switches, e.g. {"message": {"push": false}}.
+-- Only changed cells are stored; the rest use the defaults in models.NotificationMatrix.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS notification_matrix JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+-- 049_add_room_welcome_message
+-- Message the bot posts when someone joins the room; {username} and {room} are substituted
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS welcome_message TEXT DEFAULT NULL;
+
+-- 050_create_password_reset_tokens
+-- Single-use password reset tokens; only a SHA-256 of the token is stored
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user ON password_reset_tokens(user_id);
+
+-- 051_add_user_role_and_ban
+-- Application roles replace matching ADMIN_USERNAME; banned users can't sign in or connect
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user',
+    ADD COLUMN IF NOT EXISTS banned_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS banned_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS ban_reason TEXT DEFAULT NULL;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS chk_users_role;
+ALTER TABLE users ADD CONSTRAINT chk_users_role CHECK (role IN ('user', 'admin'));
+
+-- The first admin is created with the promote-admin command, see BootstrapAdmin
+
+CREATE INDEX IF NOT EXISTS idx_users_banned ON users(banned_at) WHERE banned_at IS NOT NULL;
+
+-- 052_add_reply_to_id_index
+-- Direct replies of a message, for the "N replies" tap-through; reply_to embeds the parent's id.
+CREATE INDEX IF NOT EXISTS idx_messages_reply_to_id ON messages(((reply_to->>'id')::bigint), id)
+WHERE reply_to IS NOT NULL;
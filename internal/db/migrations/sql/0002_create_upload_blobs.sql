@@ -0,0 +1,20 @@
+-- Uploads with identical content share one stored blob. The first upload of some content is
+-- stored under its own key and becomes the blob; later copies only reference it through
+-- upload_hashes.blob_key. refs counts the keys using a blob, which is deleted with the last one.
+CREATE TABLE IF NOT EXISTS upload_blobs (
+    sha256 CHAR(64) PRIMARY KEY,
+    key VARCHAR(600) NOT NULL UNIQUE,
+    size BIGINT NOT NULL,
+    refs INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE upload_hashes
+ADD COLUMN IF NOT EXISTS blob_key VARCHAR(600) DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_upload_hashes_blob_key ON upload_hashes(blob_key) WHERE blob_key IS NOT NULL;
+
+-- Existing uploads: the oldest copy of each content becomes its blob, other copies stay standalone
+INSERT INTO upload_blobs (sha256, key, size)
+SELECT DISTINCT ON (sha256) sha256, key, size FROM upload_hashes ORDER BY sha256, created_at, key
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+-- Accounts erased on request keep their row, so their messages stay attributed to a
+-- placeholder, but lose every personal field
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE DEFAULT NULL;
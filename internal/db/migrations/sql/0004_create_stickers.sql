@@ -0,0 +1,24 @@
+-- Sticker and GIF packs. Images are hosted once (a CDN or /uploads) and messages refer to a
+-- sticker by id, keeping a snapshot in messages.sticker so they render after a pack is removed.
+CREATE TABLE IF NOT EXISTS sticker_packs (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    kind VARCHAR(10) NOT NULL DEFAULT 'sticker', -- 'sticker' or 'gif'
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS stickers (
+    id SERIAL PRIMARY KEY,
+    pack_id INTEGER NOT NULL REFERENCES sticker_packs(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    emoji VARCHAR(32) NOT NULL DEFAULT '',
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    position INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_stickers_pack_id ON stickers(pack_id, position);
+
+ALTER TABLE messages
+ADD COLUMN IF NOT EXISTS sticker JSONB DEFAULT NULL;
@@ -0,0 +1,4 @@
+-- Disappearing messages: with message_ttl set, every message posted to the room expires that
+-- many seconds after it was sent, or sooner when the sender asks for a shorter TTL
+ALTER TABLE rooms
+ADD COLUMN IF NOT EXISTS message_ttl INTEGER DEFAULT NULL CHECK (message_ttl > 0);
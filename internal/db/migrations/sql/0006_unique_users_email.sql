@@ -0,0 +1,3 @@
+-- An address belongs to one account, compared case-insensitively like the checks in the email
+-- change flow. Accounts without an email (NULL or '') are not constrained.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email)) WHERE email IS NOT NULL AND email <> '';
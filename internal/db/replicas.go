@@ -0,0 +1,239 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Reader is the subset of the pool API used by read-only queries
+type Reader interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// replica is a read-only pool whose replication lag is checked in the background
+type replica struct {
+	name    string
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+	lagMs   atomic.Int64
+}
+
+var (
+	replicas    []*replica
+	nextReplica atomic.Uint64
+)
+
+// replicaLagQuery returns the replay lag in seconds; 0 when the replica has replayed all WAL it received
+const replicaLagQuery = `
+	SELECT CASE
+		WHEN NOT pg_is_in_recovery() THEN -1
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0)
+	END
+`
+
+// InitReplicas connects to the read replicas and starts checking their lag every
+// checkInterval until ctx is done. Replicas lagging more than maxLag, or unreachable,
+// are skipped by Read until they catch up.
+func InitReplicas(ctx context.Context, connStrings []string, opts PoolOptions, maxLag, checkInterval time.Duration) error {
+	for i, connString := range connStrings {
+		pool, err := newPool(connString, opts)
+		if err != nil {
+			return fmt.Errorf("replica %d: %w", i, err)
+		}
+		r := &replica{name: fmt.Sprintf("replica-%d", i), pool: pool}
+		r.check(ctx, maxLag)
+		replicas = append(replicas, r)
+		go r.monitor(ctx, maxLag, checkInterval)
+	}
+	if len(replicas) > 0 {
+		log.Printf("Connected to %d PostgreSQL read replica(s) (max_lag=%s)", len(replicas), maxLag)
+	}
+	return nil
+}
+
+func (r *replica) monitor(ctx context.Context, maxLag, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check(ctx, maxLag)
+		}
+	}
+}
+
+func (r *replica) check(ctx context.Context, maxLag time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	var lagSeconds float64
+	err := r.pool.QueryRow(ctx, replicaLagQuery).Scan(&lagSeconds)
+	healthy := err == nil && lagSeconds >= 0 && time.Duration(lagSeconds*float64(time.Second)) <= maxLag
+	if lagSeconds < 0 {
+		// A promoted replica is a primary now; keep reads off it until it is reconfigured
+		err = errors.New("not in recovery")
+	}
+	if healthy != r.healthy.Load() {
+		if healthy {
+			log.Printf("DB %s is healthy again (lag %.1fs)", r.name, lagSeconds)
+		} else {
+			log.Printf("DB %s excluded from reads (lag %.1fs, err %v)", r.name, lagSeconds, err)
+		}
+	}
+	r.lagMs.Store(int64(lagSeconds * 1000))
+	r.healthy.Store(healthy)
+}
+
+type primaryOnlyKey struct{}
+
+// WithPrimary marks ctx so Read uses the primary, e.g. to read a write the caller just made
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryOnlyKey{}, true)
+}
+
+// Read returns a healthy replica (round robin) for read-only queries, or the primary when
+// there is none. Queries that fail on a replica with a connection error are retried on the primary.
+func Read(ctx context.Context) Reader {
+	if primary, _ := ctx.Value(primaryOnlyKey{}).(bool); primary || len(replicas) == 0 {
+		return Pool
+	}
+	start := nextReplica.Add(1)
+	for i := range replicas {
+		r := replicas[(start+uint64(i))%uint64(len(replicas))]
+		if r.healthy.Load() {
+			return replicaReader{r}
+		}
+	}
+	return Pool
+}
+
+// replicaReader falls back to the primary on connection errors
+type replicaReader struct {
+	r *replica
+}
+
+func (rr replicaReader) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	rows, err := rr.r.pool.Query(ctx, sql, args...)
+	if err != nil && IsConnectionError(err) {
+		rr.r.healthy.Store(false)
+		return Pool.Query(ctx, sql, args...)
+	}
+	return rows, err
+}
+
+func (rr replicaReader) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return &fallbackRow{ctx: ctx, r: rr.r, sql: sql, args: args}
+}
+
+// fallbackRow defers the query to Scan so a replica connection error can be retried on the primary
+type fallbackRow struct {
+	ctx  context.Context
+	r    *replica
+	sql  string
+	args []any
+}
+
+func (fr *fallbackRow) Scan(dest ...any) error {
+	err := fr.r.pool.QueryRow(fr.ctx, fr.sql, fr.args...).Scan(dest...)
+	if err != nil && IsConnectionError(err) {
+		fr.r.healthy.Store(false)
+		return Pool.QueryRow(fr.ctx, fr.sql, fr.args...).Scan(dest...)
+	}
+	return err
+}
+
+// IsConnectionError reports errors caused by a lost or unusable server rather than the
+// query itself: connection failures, server shutdown (failover) and writes sent to a
+// server that became read-only.
+func IsConnectionError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case len(pgErr.Code) == 5 && pgErr.Code[:2] == "08": // connection_exception
+			return true
+		case pgErr.Code == "57P01", pgErr.Code == "57P02", pgErr.Code == "57P03": // shutdown / cannot_connect_now
+			return true
+		case pgErr.Code == "25006": // read_only_sql_transaction
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, pgx.ErrNoRows) {
+		return false
+	}
+	var connectErr *pgconn.ConnectError
+	return errors.As(err, &connectErr) || pgconn.Timeout(err) || pgconn.SafeToRetry(err)
+}
+
+var (
+	failoverRetries = 2
+	failoverBackoff = 250 * time.Millisecond
+)
+
+// SetFailoverRetry configures how often WithFailoverRetry retries and how long it waits between attempts
+func SetFailoverRetry(retries int, backoff time.Duration) {
+	failoverRetries = retries
+	failoverBackoff = backoff
+}
+
+// WithFailoverRetry runs fn against the primary and retries it while the primary is failing
+// over. Only errors that are safe to retry are retried, so writes are never applied twice.
+func WithFailoverRetry(ctx context.Context, fn func() error) error {
+	err := fn()
+	for attempt := 1; attempt <= failoverRetries && err != nil; attempt++ {
+		var pgErr *pgconn.PgError
+		retryable := pgconn.SafeToRetry(err) || (errors.As(err, &pgErr) && IsConnectionError(err))
+		if !retryable {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * failoverBackoff):
+		}
+		failoverRetriesTotal.Add(1)
+		err = fn()
+	}
+	return err
+}
+
+// ReplicaStats is a JSON-friendly snapshot of a replica's health
+type ReplicaStats struct {
+	Name    string    `json:"name"`
+	Healthy bool      `json:"healthy"`
+	LagMs   int64     `json:"lag_ms"`
+	Pool    PoolStats `json:"pool"`
+}
+
+// ReplicasStats returns the health of every configured replica
+func ReplicasStats() []ReplicaStats {
+	stats := make([]ReplicaStats, 0, len(replicas))
+	for _, r := range replicas {
+		stats = append(stats, ReplicaStats{
+			Name:    r.name,
+			Healthy: r.healthy.Load(),
+			LagMs:   r.lagMs.Load(),
+			Pool:    poolStats(r.pool),
+		})
+	}
+	return stats
+}
+
+// closeReplicas closes every replica pool
+func closeReplicas() {
+	for _, r := range replicas {
+		r.pool.Close()
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// accountImports tracks users with an import in progress; one at a time per user
+var accountImports sync.Map
+
+// ExportAccountHandler downloads the authenticated user's data archive as JSON
+func ExportAccountHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		archive, err := userService.ExportAccount(c.UserContext(), c.Locals("user_id").(int))
+		if err != nil {
+			if errors.Is(err, services.ErrNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to export account"})
+		}
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="account-`+archive.Profile.Username+`.json"`)
+		return c.JSON(archive)
+	}
+}
+
+// ImportAccountHandler restores an exported archive into the authenticated account. The archive
+// is the multipart field "archive" or the raw JSON body; on_conflict=overwrite replaces values the
+// account already has (default keep). The import runs in the background and reports over WS:
+// account_import_progress, then account_import_completed with the report or account_import_failed.
+func ImportAccountHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		onConflict := c.Query("on_conflict", c.FormValue("on_conflict", "keep"))
+		if onConflict != "keep" && onConflict != "overwrite" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "on_conflict must be keep or overwrite"})
+		}
+
+		var archive models.AccountArchive
+		if fileHeader, err := c.FormFile("archive"); err == nil {
+			if err := UploadPolicy.Check(UploadAccountArchive, fileHeader); err != nil {
+				return uploadPolicyError(c, err)
+			}
+			f, err := fileHeader.Open()
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to read uploaded file"})
+			}
+			defer f.Close()
+			raw, err := io.ReadAll(f)
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to read uploaded file"})
+			}
+			if err := json.Unmarshal(raw, &archive); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid archive: " + err.Error()})
+			}
+		} else if err := json.Unmarshal(c.Body(), &archive); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "archive is required"})
+		}
+		if archive.Version != models.AccountArchiveVersion {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unsupported archive version"})
+		}
+
+		importID := uuid.New().String()
+		if _, busy := accountImports.LoadOrStore(userID, importID); busy {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "an import is already in progress"})
+		}
+		go runAccountImport(userService, userID, importID, &archive, onConflict == "overwrite")
+		return c.Status(http.StatusAccepted).JSON(fiber.Map{"import_id": importID, "messages": len(archive.Messages)})
+	}
+}
+
+// runAccountImport performs the import and reports progress to the user's connections
+func runAccountImport(userService *services.UserService, userID int, importID string, archive *models.AccountArchive, overwrite bool) {
+	defer accountImports.Delete(userID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), utils.GetEnvDuration("ACCOUNT_IMPORT_TIMEOUT", 10*time.Minute))
+	defer cancel()
+
+	report, err := userService.ImportAccount(ctx, userID, archive, overwrite, func(done, total int) {
+		Manager.SendToUser(userID, map[string]interface{}{
+			"event":     "account_import_progress",
+			"import_id": importID,
+			"done":      done,
+			"total":     total,
+		})
+	})
+	if err != nil {
+		utils.LogError(err, "ImportAccount")
+		Manager.SendToUser(userID, map[string]interface{}{
+			"event":     "account_import_failed",
+			"import_id": importID,
+			"error":     err.Error(),
+		})
+		return
+	}
+	report.ImportID = importID
+	Manager.SendToUser(userID, map[string]interface{}{
+		"event":  "account_import_completed",
+		"report": report,
+	})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"chat-backend/internal/services"
+)
+
+type accountStatus struct {
+	lockout   error
+	checkedAt time.Time
+}
+
+// accountStatuses caches whether users are banned or deleted, for AuthMiddleware and
+// RefreshHandler. Entries are trusted for WS_AUTH_RECHECK_INTERVAL, like the checks of the
+// WS pipeline; bans and deletions made on this instance take effect at once.
+var accountStatuses = struct {
+	sync.Mutex
+	byUser map[int]accountStatus
+}{byUser: map[int]accountStatus{}}
+
+// accountLockout returns services.ErrUserBanned or services.ErrUserDeleted when userID
+// is locked out, from the cache when fresh. Other errors mean the check failed.
+func accountLockout(ctx context.Context, userID int) error {
+	accountStatuses.Lock()
+	st, ok := accountStatuses.byUser[userID]
+	accountStatuses.Unlock()
+	if ok && since(st.checkedAt) < recheckInterval() {
+		return st.lockout
+	}
+
+	lockout := services.AccountLockout(ctx, userID)
+	if lockout != nil && !isLockout(lockout) {
+		return lockout
+	}
+	accountStatuses.Lock()
+	defer accountStatuses.Unlock()
+	// Expired entries are dropped as they're replaced; bound the map for users who went away
+	if len(accountStatuses.byUser) > 100000 {
+		accountStatuses.byUser = map[int]accountStatus{}
+	}
+	accountStatuses.byUser[userID] = accountStatus{lockout: lockout, checkedAt: clock.Now()}
+	return lockout
+}
+
+// isLockout reports whether err from accountLockout locks the user out, rather than the
+// check having failed
+func isLockout(err error) bool {
+	return errors.Is(err, services.ErrUserBanned) || errors.Is(err, services.ErrUserDeleted)
+}
+
+// forgetAccountStatus drops the cached status after a ban, unban or deletion
+func forgetAccountStatus(userID int) {
+	accountStatuses.Lock()
+	delete(accountStatuses.byUser, userID)
+	accountStatuses.Unlock()
+}
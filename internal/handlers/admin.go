@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminMiddleware only lets users with the admin role through.
+// Must run after AuthMiddleware so the user_id local is populated.
+func AdminMiddleware(c *fiber.Ctx) error {
+	if !isAppAdmin(c) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "admin access required"})
+	}
+	return c.Next()
+}
+
+// isAppAdmin reports whether the authenticated user has the admin role. The answer is kept
+// for the rest of the request.
+func isAppAdmin(c *fiber.Ctx) bool {
+	if admin, ok := c.Locals("app_admin").(bool); ok {
+		return admin
+	}
+	admin := false
+	if userID, ok := c.Locals("user_id").(int); ok {
+		var err error
+		admin, err = services.IsAdmin(c.UserContext(), userID)
+		utils.LogError(err, "IsAdmin")
+	}
+	c.Locals("app_admin", admin)
+	return admin
+}
+
+// AdminStatsHandler returns database pool and websocket statistics for debugging saturation
+func AdminStatsHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"db_pool":     db.Stats(),
+			"db_replicas": db.ReplicasStats(),
+			"websocket":   Manager.Stats(),
+			"providers":   services.ProvidersHealth(),
+		})
+	}
+}
+
+// processStarted is when this instance started
+var processStarted = time.Now()
+
+// AdminInfoHandler returns what an operator checks first: the build, feature flags, the
+// effective configuration with secrets redacted, the storage backend and the instances
+// serving websockets
+func AdminInfoHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"build":          utils.Build(),
+			"started_at":     processStarted,
+			"uptime_seconds": int64(time.Since(processStarted).Seconds()),
+			"features":       services.FeatureStates(),
+			"config":         utils.EffectiveConfig(),
+			"storage":        services.StorageBackend(),
+			"instances":      Cluster.instances(),
+		})
+	}
+}
+
+// adminError maps service errors onto HTTP responses for admin endpoints
+func adminError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// AdminRoomLegalHoldHandler applies or releases a legal hold on a room
+func AdminRoomLegalHoldHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.LegalHoldRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		adminID := c.Locals("user_id").(int)
+		if err := adminService.SetRoomLegalHold(c.UserContext(), adminID, c.Params("id"), req); err != nil {
+			return adminError(c, err)
+		}
+		return c.JSON(fiber.Map{"room_id": c.Params("id"), "legal_hold": req.Enabled})
+	}
+}
+
+// AdminUserLegalHoldHandler applies or releases a legal hold on a user
+func AdminUserLegalHoldHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := strconv.Atoi(c.Params("id"))
+		if err != nil || userID <= 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+		}
+		var req models.LegalHoldRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		adminID := c.Locals("user_id").(int)
+		if err := adminService.SetUserLegalHold(c.UserContext(), adminID, userID, req); err != nil {
+			return adminError(c, err)
+		}
+		return c.JSON(fiber.Map{"user_id": userID, "legal_hold": req.Enabled})
+	}
+}
+
+// AdminLegalHoldAuditHandler lists legal hold audit entries (?target_type=&target_id=&limit=)
+func AdminLegalHoldAuditHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 100)
+		if limit <= 0 || limit > 500 {
+			limit = 500
+		}
+		entries, err := adminService.ListLegalHoldAudit(c.UserContext(), c.Query("target_type"), c.Query("target_id"), limit)
+		if err != nil {
+			return adminError(c, err)
+		}
+		return c.JSON(entries)
+	}
+}
+
+// AdminRoomRetentionHandler sets or clears a room's retention override
+func AdminRoomRetentionHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.RetentionRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if req.RetentionDays != nil && *req.RetentionDays < 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "retention_days must not be negative"})
+		}
+		if err := adminService.SetRoomRetention(c.UserContext(), c.Params("id"), req.RetentionDays); err != nil {
+			return adminError(c, err)
+		}
+		return c.JSON(fiber.Map{"room_id": c.Params("id"), "retention_days": req.RetentionDays})
+	}
+}
+
+// AdminMergeUsersHandler merges a duplicate account into another. Send dry_run=true first to
+// get the report without changing anything.
+func AdminMergeUsersHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.UserMergeRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if req.SourceUserID <= 0 || req.TargetUserID <= 0 || req.SourceUserID == req.TargetUserID {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "source_user_id and target_user_id must be two different users"})
+		}
+		adminID := c.Locals("user_id").(int)
+		if req.SourceUserID == adminID {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "cannot merge away your own account"})
+		}
+
+		report, err := adminService.MergeUsers(c.UserContext(), adminID, req)
+		if err != nil {
+			if errors.Is(err, services.ErrLegalHold) {
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return adminError(c, err)
+		}
+		if !req.DryRun {
+			// The source account no longer exists; drop its live connections
+			for _, client := range Manager.GetConnectionsByUserID(req.SourceUserID) {
+				client.Close()
+			}
+		}
+		return c.JSON(report)
+	}
+}
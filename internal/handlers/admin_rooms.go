@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// adminRoomError maps room management errors onto HTTP responses
+func adminRoomError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrLegalHold) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return adminError(c, err)
+}
+
+// AdminDeleteRoomHandler deletes a room and everything in it. Participants get room_deleted.
+func AdminDeleteRoomHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.HardDeleteRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+			}
+		}
+		roomID := c.Params("id")
+		res, err := adminService.DeleteRoom(c.UserContext(), c.Locals("user_id").(int), roomID, strings.TrimSpace(req.Reason))
+		if err != nil {
+			return adminRoomError(c, err)
+		}
+		if res.Messages > 0 {
+			// Unseen messages went with the room; cached badge totals are recounted on next use
+			Badges.Reset()
+		}
+		event := map[string]interface{}{
+			"event":     "room_deleted",
+			"room":      roomID,
+			"timestamp": time.Now().UnixMilli(),
+		}
+		Manager.Broadcast(roomID, event, "")
+		for _, userID := range res.Participants {
+			if !Manager.IsUserInRoom(userID, roomID) {
+				Manager.SendToUser(userID, event)
+			}
+		}
+		if Mirror != nil {
+			if err := Mirror.Remove(roomID); err != nil {
+				utils.LogError(err, "MirrorRemove")
+			}
+		}
+		return c.JSON(res)
+	}
+}
+
+// AdminPurgeRoomMessagesHandler deletes a room's messages, optionally only those sent before
+// a time or by one user. Viewers and online participants get messages_purged with the ids.
+func AdminPurgeRoomMessagesHandler(adminService *services.AdminService, chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.PurgeMessagesRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+			}
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		roomID := c.Params("id")
+		deleted, err := adminService.PurgeRoomMessages(c.UserContext(), c.Locals("user_id").(int), roomID, req)
+		if err != nil {
+			return adminRoomError(c, err)
+		}
+		if len(deleted) == 0 {
+			return c.JSON(fiber.Map{"room_id": roomID, "deleted": 0})
+		}
+
+		Badges.Reset()
+		ids := make([]int, len(deleted))
+		for i, msg := range deleted {
+			ids[i] = msg.ID
+			if Push != nil {
+				Push.Retract(msg.ID)
+			}
+		}
+		event := map[string]interface{}{
+			"event":     "messages_purged",
+			"room":      roomID,
+			"ids":       ids,
+			"timestamp": time.Now().UnixMilli(),
+		}
+		Manager.Broadcast(roomID, event, "")
+		participants, err := chatService.GetRoomParticipants(c.UserContext(), roomID)
+		utils.LogError(err, "GetRoomParticipants for purge")
+		for _, userID := range participants {
+			if Manager.IsUserOnline(userID) && !Manager.IsUserInRoom(userID, roomID) {
+				Manager.SendToUser(userID, event)
+			}
+		}
+		if Mirror != nil {
+			exportMirror(roomID)
+		}
+		return c.JSON(fiber.Map{"room_id": roomID, "deleted": len(deleted)})
+	}
+}
+
+// AdminRoomStatsHandler returns message, file and participant counts for a room, and how
+// many participants are online or viewing it right now
+func AdminRoomStatsHandler(adminService *services.AdminService, chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roomID := c.Params("id")
+		stats, err := adminService.RoomStats(c.UserContext(), roomID)
+		if err != nil {
+			return adminError(c, err)
+		}
+		participants, err := chatService.GetRoomParticipants(c.UserContext(), roomID)
+		if err != nil {
+			return adminError(c, err)
+		}
+		for _, userID := range participants {
+			if Manager.IsUserOnline(userID) {
+				stats.OnlineUsers++
+			}
+			if Manager.IsUserInRoom(userID, roomID) {
+				stats.Viewers++
+			}
+		}
+		return c.JSON(stats)
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminTokenMiddleware authenticates a scoped admin API token (not a user JWT) and requires
+// scope. Handlers run as the admin who issued the token; the token is in the admin_token local.
+func AdminTokenMiddleware(adminService *services.AdminService, scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		secret := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if secret == "" {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "missing admin api token"})
+		}
+		token, err := adminService.AuthenticateAdminToken(c.UserContext(), secret)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidAdminToken) {
+				return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to authenticate token"})
+		}
+		if !slices.Contains(token.Scopes, scope) {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "token lacks scope " + scope})
+		}
+		c.Locals("user_id", token.CreatedBy)
+		c.Locals("admin_token", token)
+		return c.Next()
+	}
+}
+
+// adminTokenAudit returns audit details naming the API token behind a request, nil for sessions
+func adminTokenAudit(c *fiber.Ctx) interface{} {
+	if token, ok := c.Locals("admin_token").(*models.AdminToken); ok {
+		return map[string]interface{}{"token_id": token.ID, "token_name": token.Name}
+	}
+	return nil
+}
+
+// AdminCreateTokenHandler issues a scoped admin API token; the secret is only in this response
+func AdminCreateTokenHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.CreateAdminTokenRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > 100 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name is required (max 100 characters)"})
+		}
+		if len(req.Scopes) == 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "at least one scope is required"})
+		}
+		for _, scope := range req.Scopes {
+			if !slices.Contains(models.AdminTokenScopes, scope) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unknown scope " + scope, "scopes": models.AdminTokenScopes})
+			}
+		}
+		slices.Sort(req.Scopes)
+		req.Scopes = slices.Compact(req.Scopes)
+
+		maxTTL := utils.GetEnvDuration("ADMIN_TOKEN_MAX_TTL", 365*24*time.Hour)
+		ttl := time.Duration(req.TTL) * time.Second
+		if req.TTL == 0 {
+			ttl = maxTTL
+		}
+		if ttl <= 0 || ttl > maxTTL {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "ttl must be a positive number of seconds within the allowed maximum"})
+		}
+
+		adminID := c.Locals("user_id").(int)
+		token, err := adminService.CreateAdminToken(c.UserContext(), adminID, req.Name, req.Scopes, time.Now().Add(ttl))
+		if err != nil {
+			return adminError(c, err)
+		}
+		return c.Status(http.StatusCreated).JSON(token)
+	}
+}
+
+// AdminListTokensHandler lists admin API tokens without their secrets
+func AdminListTokensHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokens, err := adminService.ListAdminTokens(c.UserContext())
+		if err != nil {
+			return adminError(c, err)
+		}
+		return c.JSON(tokens)
+	}
+}
+
+// AdminRevokeTokenHandler revokes an admin API token
+func AdminRevokeTokenHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenID, err := strconv.Atoi(c.Params("id"))
+		if err != nil || tokenID <= 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid token id"})
+		}
+		if err := adminService.RevokeAdminToken(c.UserContext(), c.Locals("user_id").(int), tokenID); err != nil {
+			return adminError(c, err)
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// AdminDeleteMessageHandler tombstones any message (moderation) and broadcasts message_deleted
+func AdminDeleteMessageHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, ok := parseMessageID(c)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid message id"})
+		}
+		msg, err := adminService.ModerateDeleteMessage(c.UserContext(), c.Locals("user_id").(int), id, adminTokenAudit(c))
+		if err != nil {
+			return messageEditError(c, err)
+		}
+		broadcastMessageDeleted(msg)
+		return c.JSON(msg)
+	}
+}
+
+// AdminHardDeleteMessageHandler physically removes a message for a compliance request;
+// the optional {"reason"} is kept in the audit log tombstone
+func AdminHardDeleteMessageHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, ok := parseMessageID(c)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid message id"})
+		}
+		var req models.HardDeleteRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+			}
+		}
+		msg, err := adminService.HardDeleteMessage(c.UserContext(), c.Locals("user_id").(int), id, strings.TrimSpace(req.Reason), adminTokenAudit(c))
+		if err != nil {
+			return messageEditError(c, err)
+		}
+		if Push != nil {
+			Push.Retract(msg.ID)
+		}
+		broadcastMessageDeleted(msg)
+		if Mirror != nil {
+			exportMirror(msg.Room)
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// adminUserError maps user management errors onto HTTP responses
+func adminUserError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidRole):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrBanAdmin), errors.Is(err, services.ErrLastAdmin):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return adminError(c, err)
+}
+
+// parseUserID reads the :id route parameter as a user id
+func parseUserID(c *fiber.Ctx) (int, bool) {
+	userID, err := strconv.Atoi(c.Params("id"))
+	return userID, err == nil && userID > 0
+}
+
+// AdminListUsersHandler lists users (?q=&role=&banned=&limit=&offset=), with their online status
+func AdminListUsersHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		f := models.AdminUserFilter{
+			Query:  strings.TrimSpace(c.Query("q")),
+			Role:   c.Query("role"),
+			Limit:  c.QueryInt("limit", 100),
+			Offset: c.QueryInt("offset", 0),
+		}
+		if f.Limit <= 0 || f.Limit > 500 {
+			f.Limit = 500
+		}
+		if f.Offset < 0 {
+			f.Offset = 0
+		}
+		if b := c.Query("banned"); b != "" {
+			banned, err := strconv.ParseBool(b)
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "banned must be true or false"})
+			}
+			f.Banned = &banned
+		}
+		users, err := adminService.ListUsers(c.UserContext(), f)
+		if err != nil {
+			return adminError(c, err)
+		}
+		for i := range users {
+			users[i].Online = Manager.IsUserOnline(users[i].ID)
+		}
+		return c.JSON(users)
+	}
+}
+
+// AdminSetUserRoleHandler makes a user an admin or a regular user
+func AdminSetUserRoleHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := parseUserID(c)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+		}
+		var req models.SetUserRoleRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if err := adminService.SetUserRole(c.UserContext(), c.Locals("user_id").(int), userID, req.Role); err != nil {
+			return adminUserError(c, err)
+		}
+		return c.JSON(fiber.Map{"user_id": userID, "role": req.Role})
+	}
+}
+
+// AdminBanUserHandler bans a user and disconnects their websocket connections on this
+// instance; connections elsewhere end when their access token does
+func AdminBanUserHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := parseUserID(c)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+		}
+		adminID := c.Locals("user_id").(int)
+		if userID == adminID {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "cannot ban yourself"})
+		}
+		var req models.BanUserRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+			}
+		}
+		reason := strings.TrimSpace(req.Reason)
+		if err := adminService.BanUser(c.UserContext(), adminID, userID, reason); err != nil {
+			return adminUserError(c, err)
+		}
+		forgetAccountStatus(userID)
+
+		event := map[string]interface{}{
+			"event":     "account_banned",
+			"reason":    reason,
+			"timestamp": time.Now().UnixMilli(),
+		}
+		for _, client := range Manager.GetConnectionsByUserID(userID) {
+			_ = client.Send(event)
+			client.CloseAfterPending(closePolicyViolation, "account banned")
+		}
+		return c.JSON(fiber.Map{"user_id": userID, "banned": true})
+	}
+}
+
+// AdminUnbanUserHandler lifts a user's ban
+func AdminUnbanUserHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := parseUserID(c)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+		}
+		if err := adminService.UnbanUser(c.UserContext(), c.Locals("user_id").(int), userID); err != nil {
+			return adminUserError(c, err)
+		}
+		forgetAccountStatus(userID)
+		return c.JSON(fiber.Map{"user_id": userID, "banned": false})
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// announcementError maps announcement service errors onto HTTP responses
+func announcementError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "message or announcement not found in this room"})
+	case errors.Is(err, services.ErrNotMember):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrForbiddenRole):
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// announcementOverride lets the app admin and write:announcements API tokens skip the room role check
+func announcementOverride(c *fiber.Ctx) bool {
+	return isAppAdmin(c) || c.Locals("admin_token") != nil
+}
+
+// GetAnnouncementHandler returns the room's announcement unless the caller dismissed it
+func GetAnnouncementHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ann, err := chatService.GetRoomAnnouncement(c.UserContext(), c.Params("id"), c.Locals("user_id").(int))
+		if err != nil {
+			return announcementError(c, err)
+		}
+		return c.JSON(ann)
+	}
+}
+
+// SetAnnouncementHandler announces a message (room owners and admins, or the app admin) and
+// sends announcement_changed to every participant, so banners reappear for everyone
+func SetAnnouncementHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.SetAnnouncementRequest
+		if err := c.BodyParser(&req); err != nil || req.MessageID <= 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "message_id is required"})
+		}
+		roomID := c.Params("id")
+		actorID := c.Locals("user_id").(int)
+		ann, err := chatService.SetRoomAnnouncement(c.UserContext(), roomID, actorID, req.MessageID, announcementOverride(c))
+		if err != nil {
+			return announcementError(c, err)
+		}
+		notifyRoomParticipantsOf(c, chatService, roomID, map[string]interface{}{
+			"event":        "announcement_changed",
+			"room":         roomID,
+			"announcement": ann,
+			"actor_id":     actorID,
+			"timestamp":    time.Now().UnixMilli(),
+		})
+		return c.JSON(ann)
+	}
+}
+
+// ClearAnnouncementHandler removes the room's announcement and sends announcement_changed
+// without an announcement
+func ClearAnnouncementHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roomID := c.Params("id")
+		actorID := c.Locals("user_id").(int)
+		if err := chatService.ClearRoomAnnouncement(c.UserContext(), roomID, actorID, announcementOverride(c)); err != nil {
+			return announcementError(c, err)
+		}
+		notifyRoomParticipantsOf(c, chatService, roomID, map[string]interface{}{
+			"event":     "announcement_changed",
+			"room":      roomID,
+			"actor_id":  actorID,
+			"timestamp": time.Now().UnixMilli(),
+		})
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// DismissAnnouncementHandler hides the banner for the caller until a new announcement is set.
+// The caller's other connections get announcement_dismissed so every device hides it.
+func DismissAnnouncementHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roomID := c.Params("id")
+		userID := c.Locals("user_id").(int)
+		if err := chatService.DismissRoomAnnouncement(c.UserContext(), roomID, userID); err != nil {
+			return announcementError(c, err)
+		}
+		Manager.SendToUser(userID, map[string]interface{}{
+			"event":     "announcement_dismissed",
+			"room":      roomID,
+			"timestamp": time.Now().UnixMilli(),
+		})
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// Attachment kinds, each with its own size cap
+const (
+	attachmentImage    = "image"
+	attachmentVideo    = "video"
+	attachmentDocument = "document"
+)
+
+// attachmentKind classifies an upload by its media type
+func attachmentKind(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return attachmentImage
+	case strings.HasPrefix(mediaType, "video/"):
+		return attachmentVideo
+	default:
+		return attachmentDocument
+	}
+}
+
+// attachmentMaxBytes is the size cap of a kind, from ATTACHMENT_MAX_<KIND>_MB. Uploads are
+// also bounded by HTTP_BODY_LIMIT_MB and any max_bytes of the upload policy.
+func attachmentMaxBytes(kind string) int64 {
+	var mb int
+	switch kind {
+	case attachmentImage:
+		mb = utils.GetEnvInt("ATTACHMENT_MAX_IMAGE_MB", 10)
+	case attachmentVideo:
+		mb = utils.GetEnvInt("ATTACHMENT_MAX_VIDEO_MB", 100)
+	default:
+		mb = utils.GetEnvInt("ATTACHMENT_MAX_DOCUMENT_MB", 25)
+	}
+	return int64(mb) << 20
+}
+
+// BuildFileURL constructs an absolute URL for an attachment based on request host
+func BuildFileURL(c *fiber.Ctx, filename string) string {
+	if filename == "" {
+		return ""
+	}
+	if u := services.UploadURL("files/" + filename); u != "" {
+		return u
+	}
+	if baseURL := utils.GetEnv("BASE_URL", ""); baseURL != "" {
+		return baseURL + services.UploadPath("files/"+filename)
+	}
+	protocol := "http"
+	if c.Protocol() == "https" || c.Get("X-Forwarded-Proto") == "https" {
+		protocol = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", protocol, c.Hostname(), services.UploadPath("files/"+filename))
+}
+
+// buildFileURLFromWS constructs an absolute URL for an attachment from a WebSocket connection
+func buildFileURLFromWS(c *websocket.Conn, filename string) string {
+	if filename == "" {
+		return ""
+	}
+	if u := services.UploadURL("files/" + filename); u != "" {
+		return u
+	}
+	if baseURL := utils.GetEnv("BASE_URL", ""); baseURL != "" {
+		return baseURL + services.UploadPath("files/"+filename)
+	}
+	host := c.Locals("host")
+	if host == nil || host == "" {
+		return services.UploadPath("files/" + filename)
+	}
+	return fmt.Sprintf("http://%s%s", host, services.UploadPath("files/"+filename))
+}
+
+// fileURL returns the attachment URL of a message, empty when it has none
+func fileURL(f *models.MessageFile, buildURL func(string) string) string {
+	if f == nil || f.Filename == "" {
+		return ""
+	}
+	return buildURL(f.Filename)
+}
+
+// UploadAttachmentHandler sends an image, video or document to the room. Form fields:
+// - file: the attachment (multipart file), checked against the "attachment" upload policy
+// - caption: optional text shown with the attachment
+// - reply_to_id: optional, the message ID this is replying to
+// - ttl: optional, seconds until the message expires
+func UploadAttachmentHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		username := c.Locals("username").(string)
+		room := c.Params("id")
+
+		if err := chatService.CheckCanPost(c.UserContext(), room, userID, models.PostKindFile); err != nil {
+			return roomLockError(c, err)
+		}
+
+		var replyToID int
+		if s := c.FormValue("reply_to_id"); s != "" {
+			var err error
+			if replyToID, err = strconv.Atoi(s); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid reply_to_id"})
+			}
+		}
+
+		var expiresAt *time.Time
+		if ttlStr := c.FormValue("ttl"); ttlStr != "" {
+			ttl, err := strconv.Atoi(ttlStr)
+			if err == nil {
+				expiresAt, err = resolveExpiry(ttl)
+			}
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid ttl"})
+			}
+		}
+
+		caption := c.FormValue("caption")
+
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "file is required"})
+		}
+		if err := UploadPolicy.Check(UploadAttachment, fileHeader); err != nil {
+			return uploadPolicyError(c, err)
+		}
+		contentType := fileHeader.Header.Get("Content-Type")
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		kind := attachmentKind(contentType)
+		if maxBytes := attachmentMaxBytes(kind); maxBytes > 0 && fileHeader.Size > maxBytes {
+			rejectedUploads.Inc(UploadAttachment, "size")
+			return c.Status(http.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": "file too large", "kind": kind, "size": fileHeader.Size, "max_bytes": maxBytes,
+			})
+		}
+
+		ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
+		if ext == "" {
+			if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+				ext = exts[0]
+			}
+		}
+		filename := fmt.Sprintf("file_%d_%d%s", userID, time.Now().UnixNano(), ext)
+
+		upload, err := services.SaveTempUpload(fileHeader, "files/"+filename, nil)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save file"})
+		}
+		defer upload.Discard()
+		upload.ContentType = mediaType
+
+		var replyTo *models.Message
+		if replyToID != 0 {
+			replyTo, err = chatService.GetMessageByID(c.UserContext(), replyToID)
+			if err != nil {
+				utils.LogError(err, "GetMessageByID for attachment reply")
+				// Continue without reply_to
+			}
+		}
+
+		dbMsg := &models.Message{
+			Room:     room,
+			UserID:   userID,
+			Username: username,
+			Content:  optionalString(caption),
+			File: &models.MessageFile{
+				Filename:    filename,
+				Name:        filepath.Base(fileHeader.Filename),
+				ContentType: mediaType,
+				Kind:        kind,
+				Size:        fileHeader.Size,
+			},
+			ReplyTo:   replyTo,
+			ExpiresAt: expiresAt,
+		}
+		saveStarted := clock.Now()
+		if err := chatService.SaveAttachmentMessage(c.UserContext(), dbMsg); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save message"})
+		}
+		if err := upload.Publish(c.UserContext()); err != nil {
+			utils.LogError(err, "publish attachment")
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save file"})
+		}
+		recordUpload(userID, fileHeader.Size)
+		deliveries.start(dbMsg.ID, saveStarted)
+
+		dbMsg.FileURL = BuildFileURL(c, filename)
+		withReplyVoiceURL(dbMsg.ReplyTo, func(f string) string { return BuildVoiceURL(c, f) })
+
+		Manager.Broadcast(room, models.WSMessage{
+			ID:        dbMsg.ID,
+			Event:     "chat",
+			Room:      room,
+			Text:      caption,
+			File:      dbMsg.File,
+			FileURL:   dbMsg.FileURL,
+			Username:  username,
+			Timestamp: dbMsg.CreatedAt.UnixMilli(),
+			HasSeen:   dbMsg.HasSeen,
+			ReplyTo:   dbMsg.ReplyTo,
+			ThreadID:  dbMsg.ThreadID,
+			ExpiresAt: expiresAtMillis(dbMsg.ExpiresAt),
+		}, "")
+
+		// Notifications show the caption, or the file name without one
+		preview := caption
+		if preview == "" {
+			preview = dbMsg.File.Name
+		}
+		go notifyRoomParticipants(chatService, "file", room, dbMsg.ID, userID, username, preview, dbMsg.CreatedAt.UnixMilli())
+
+		return c.Status(http.StatusCreated).JSON(dbMsg)
+	}
+}
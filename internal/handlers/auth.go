@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// baseURLFromRequest returns BASE_URL or, if unset, the scheme and host of the request
+func baseURLFromRequest(c *fiber.Ctx) string {
+	if base := utils.GetEnv("BASE_URL", ""); base != "" {
+		return base
+	}
+	protocol := "http"
+	if c.Protocol() == "https" || c.Get("X-Forwarded-Proto") == "https" {
+		protocol = "https"
+	}
+	return protocol + "://" + c.Hostname()
+}
+
+// errNoBaseURL is returned when a link for an email is needed and BASE_URL is not set
+var errNoBaseURL = errors.New("BASE_URL is not configured")
+
+// emailBaseURL returns BASE_URL for links sent by email. Unlike baseURLFromRequest it never
+// falls back to the request: Host and X-Forwarded-Host are chosen by the client, and a link
+// built from them would hand the emailed token to whatever site they name.
+func emailBaseURL() (string, error) {
+	base := utils.GetEnv("BASE_URL", "")
+	if base == "" {
+		return "", errNoBaseURL
+	}
+	return base, nil
+}
+
+// LoginHandler authenticates a user and alerts them when the login comes from a new device
+func LoginHandler(userService *services.UserService, mailer services.Mailer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.LoginRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+		info := models.DeviceInfo{UserAgent: c.Get(fiber.HeaderUserAgent), IP: ClientIP(c)}
+		res, err := userService.Login(c.UserContext(), req, info)
+		if errors.Is(err, services.ErrUserBanned) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if res.NewDevice != nil {
+			// Without BASE_URL the alert goes out without the one-click link
+			revokeURL := ""
+			if base, err := emailBaseURL(); err == nil {
+				revokeURL = base + "/api/devices/revoke?token=" + url.QueryEscape(res.NewDevice.RevokeToken)
+			}
+			go notifyNewDevice(userService, mailer, res.UserID, res.NewDevice, revokeURL)
+		}
+		return c.JSON(res)
+	}
+}
+
+// notifyNewDevice tells the user's other sessions and their email about an unseen device
+func notifyNewDevice(userService *services.UserService, mailer services.Mailer, userID int, device *models.Device, revokeURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	Manager.SendToUser(userID, map[string]interface{}{
+		"event":      "new_device_login",
+		"device_id":  device.ID,
+		"user_agent": device.UserAgent,
+		"ip":         device.IP,
+		"revoke_url": revokeURL,
+		"timestamp":  time.Now().UnixMilli(),
+	})
+
+	profile, err := userService.GetProfile(ctx, userID)
+	if err != nil {
+		utils.LogError(err, "GetProfile for new device alert")
+		return
+	}
+	if profile.Email == nil || *profile.Email == "" {
+		return
+	}
+
+	ua, ip := "unknown", "unknown"
+	if device.UserAgent != nil && *device.UserAgent != "" {
+		ua = *device.UserAgent
+	}
+	if device.IP != nil && *device.IP != "" {
+		ip = *device.IP
+	}
+	revoke := "revoke the device with one click:\n" + revokeURL
+	if revokeURL == "" {
+		revoke = "revoke the device from your account's device list and change your password."
+	}
+	body := fmt.Sprintf("Hi %s,\n\nYour account was just used to sign in from a new device.\n\nDevice: %s\nIP address: %s\n\nIf this wasn't you, %s\n",
+		profile.Username, ua, ip, revoke)
+	utils.LogError(mailer.Send(*profile.Email, "New sign-in to your account", body), "Send new device email")
+}
+
+// RefreshHandler exchanges a refresh token for a new token pair.
+// Tokens bound to a revoked device are rejected.
+func RefreshHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+		if body.RefreshToken == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "refresh_token required"})
+		}
+
+		claims, err := services.ValidateRefreshToken(body.RefreshToken)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "invalid refresh token"})
+		}
+
+		// Extract user info
+		userIDf, ok := claims["user_id"].(float64)
+		if !ok {
+			return c.Status(401).JSON(fiber.Map{"error": "invalid token claims"})
+		}
+		username, ok := claims["username"].(string)
+		if !ok {
+			return c.Status(401).JSON(fiber.Map{"error": "invalid token claims"})
+		}
+
+		userID := int(userIDf)
+		if err := accountLockout(c.UserContext(), userID); errors.Is(err, services.ErrUserDeleted) {
+			return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+		} else if isLockout(err) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to check account"})
+		}
+
+		// Tokens issued before device tracking have no device id and remain valid until expiry
+		deviceID, _ := claims["did"].(string)
+		if deviceID != "" {
+			if err := userService.TouchDevice(c.UserContext(), userID, deviceID); err != nil {
+				if errors.Is(err, services.ErrDeviceRevoked) {
+					return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+				}
+				return c.Status(500).JSON(fiber.Map{"error": "failed to verify device"})
+			}
+		}
+
+		// Generate new tokens
+		access, err := services.GenerateJWT(userID, username)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to generate access token"})
+		}
+		refresh, err := services.GenerateRefreshToken(userID, username, deviceID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to generate refresh token"})
+		}
+
+		return c.JSON(fiber.Map{
+			"access_token":  access,
+			"refresh_token": refresh,
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+)
+
+// userActivity is what the tracker knows about one connected user
+type userActivity struct {
+	username string
+	last     time.Time
+	away     bool
+}
+
+// ActivityTracker turns connected users "away" after awayAfter without any event from their
+// connections on this instance (the activity event exists for clients with nothing else to
+// send) and back "online" on their next event. Changes go out as user_status like connects
+// and disconnects do, and to the other instances with the user's presence.
+type ActivityTracker struct {
+	mu        sync.Mutex
+	users     map[int]*userActivity
+	awayAfter time.Duration
+}
+
+// Activity is the global tracker; away detection is off until StartAwayTracker runs
+var Activity = &ActivityTracker{users: make(map[int]*userActivity)}
+
+// StartAwayTracker marks users away after awayAfter of inactivity (AWAY_AFTER, 0 disables)
+func StartAwayTracker(ctx context.Context, chatService *services.ChatService, awayAfter time.Duration) {
+	if awayAfter <= 0 {
+		return
+	}
+	Activity.mu.Lock()
+	Activity.awayAfter = awayAfter
+	Activity.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(max(awayAfter/4, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, u := range Activity.sweep() {
+					Cluster.presenceChanged(u.userID)
+					if !Cluster.userActive(u.userID) {
+						go notifyUserStatusChange(chatService, u.userID, u.username, "away", nil)
+					}
+				}
+			}
+		}
+	}()
+	log.Printf("Users go away after %s of inactivity", awayAfter)
+}
+
+type awayUser struct {
+	userID   int
+	username string
+}
+
+// sweep marks users idle for awayAfter as away and returns them
+func (t *ActivityTracker) sweep() []awayUser {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var away []awayUser
+	for userID, a := range t.users {
+		if !a.away && since(a.last) >= t.awayAfter {
+			a.away = true
+			away = append(away, awayUser{userID: userID, username: a.username})
+		}
+	}
+	return away
+}
+
+// touch records activity from userID and reports whether they were away until now
+func (t *ActivityTracker) touch(userID int, username string) (wasAway bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.users[userID]
+	if !ok {
+		a = &userActivity{username: username}
+		t.users[userID] = a
+	}
+	a.last = clock.Now()
+	wasAway, a.away = a.away, false
+	return wasAway
+}
+
+// forget drops userID once their last connection here is gone
+func (t *ActivityTracker) forget(userID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.users, userID)
+}
+
+// away reports whether userID is connected here but inactive
+func (t *ActivityTracker) away(userID int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.users[userID]
+	return ok && a.away
+}
+
+// awayUsers lists the users that are away on this instance
+func (t *ActivityTracker) awayUsers() []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var users []int
+	for userID, a := range t.users {
+		if a.away {
+			users = append(users, userID)
+		}
+	}
+	return users
+}
+
+// userActed runs on every event from a connection; a user coming back from away is
+// announced as online again
+func userActed(s *wsSession) {
+	if !Activity.touch(s.userID, s.username) {
+		return
+	}
+	Cluster.presenceChanged(s.userID)
+	go notifyUserStatusChange(s.chatService, s.userID, s.username, "online", nil)
+}
+
+// handleActivity only marks the user active; userActed already ran in HandleMessage
+func handleActivity(s *wsSession, req *models.ActivityRequest) error {
+	return nil
+}
+
+// UserStatus is "online", "away" or "offline" across every instance
+func UserStatus(userID int) string {
+	if !Manager.IsUserOnline(userID) {
+		return "offline"
+	}
+	if Manager.userActiveLocal(userID) || Polls.active(userID) || Cluster.userActive(userID) {
+		return "online"
+	}
+	return "away"
+}
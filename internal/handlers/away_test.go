@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestActivityTrackerAway(t *testing.T) {
+	fake := useFakeClock(t)
+	tracker := &ActivityTracker{users: make(map[int]*userActivity), awayAfter: 5 * time.Minute}
+
+	if tracker.touch(1, "alice") {
+		t.Error("first event reported the user as back from away")
+	}
+	fake.Advance(2 * time.Minute)
+	tracker.touch(2, "bob")
+
+	fake.Advance(3*time.Minute - time.Second)
+	if away := tracker.sweep(); len(away) != 0 {
+		t.Errorf("sweep() before awayAfter = %+v", away)
+	}
+	fake.Advance(time.Second)
+	if away, want := tracker.sweep(), []awayUser{{userID: 1, username: "alice"}}; !slices.Equal(away, want) {
+		t.Errorf("sweep() = %+v, want %+v", away, want)
+	}
+	if away := tracker.sweep(); len(away) != 0 {
+		t.Errorf("users already away were returned again: %+v", away)
+	}
+	if !tracker.away(1) || tracker.away(2) {
+		t.Errorf("away(1) = %t, away(2) = %t, want true, false", tracker.away(1), tracker.away(2))
+	}
+	if got := tracker.awayUsers(); !slices.Equal(got, []int{1}) {
+		t.Errorf("awayUsers() = %v, want [1]", got)
+	}
+
+	if !tracker.touch(1, "alice") {
+		t.Error("event from an away user did not report them back")
+	}
+	if tracker.away(1) {
+		t.Error("user still away after an event")
+	}
+
+	fake.Advance(2 * time.Minute)
+	if away, want := tracker.sweep(), []awayUser{{userID: 2, username: "bob"}}; !slices.Equal(away, want) {
+		t.Errorf("sweep() = %+v, want %+v", away, want)
+	}
+	tracker.forget(2)
+	if tracker.away(2) || len(tracker.awayUsers()) != 0 {
+		t.Error("forgotten user still tracked")
+	}
+}
+
+func TestMemoryRoomsUserActive(t *testing.T) {
+	fake := useFakeClock(t)
+	saved := Activity
+	Activity = &ActivityTracker{users: make(map[int]*userActivity), awayAfter: time.Minute}
+	t.Cleanup(func() { Activity = saved })
+
+	m := NewMemoryRooms()
+	m.RegisterConnection("a1", 1, "alice", nil)
+	Activity.touch(1, "alice")
+	if !m.userActiveLocal(1) {
+		t.Error("connected user with recent activity is not active")
+	}
+	fake.Advance(time.Minute)
+	Activity.sweep()
+	if m.userActiveLocal(1) || !m.IsUserOnline(1) {
+		t.Error("idle user should be online but not active")
+	}
+	if m.userActiveLocal(2) {
+		t.Error("user without connections is active")
+	}
+}
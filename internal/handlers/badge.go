@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+)
+
+// BadgeCounter caches each user's total unread count so it can be adjusted as messages
+// arrive and are read instead of recounted. Entries are loaded from the DB on first use
+// and dropped when the user goes offline or the count may have drifted.
+type BadgeCounter struct {
+	mu     sync.Mutex
+	counts map[int]int64
+}
+
+// Badges is the global unread badge cache
+var Badges = &BadgeCounter{counts: make(map[int]int64)}
+
+// Get returns the cached total for userID, loading it from the DB on a miss
+func (b *BadgeCounter) Get(ctx context.Context, chatService *services.ChatService, userID int) (int64, error) {
+	b.mu.Lock()
+	n, ok := b.counts[userID]
+	b.mu.Unlock()
+	if ok {
+		return n, nil
+	}
+
+	n, err := chatService.CountUnread(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	b.counts[userID] = n
+	b.mu.Unlock()
+	return n, nil
+}
+
+// add adjusts a cached total; reports false if userID isn't cached
+func (b *BadgeCounter) add(userID int, delta int64) (int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n, ok := b.counts[userID]
+	if !ok {
+		return 0, false
+	}
+	n += delta
+	if n < 0 {
+		n = 0
+	}
+	b.counts[userID] = n
+	return n, true
+}
+
+// Forget drops the cached total for userID
+func (b *BadgeCounter) Forget(userID int) {
+	b.mu.Lock()
+	delete(b.counts, userID)
+	b.mu.Unlock()
+}
+
+// Reset drops every cached total
+func (b *BadgeCounter) Reset() {
+	b.mu.Lock()
+	b.counts = make(map[int]int64)
+	b.mu.Unlock()
+}
+
+// adjustBadge applies delta to userID's unread total and pushes badge_count if they are online.
+// The DB has already been updated, so an uncached online user gets a fresh count.
+func adjustBadge(chatService *services.ChatService, userID int, delta int64) {
+	if !Manager.IsUserOnline(userID) {
+		Badges.Forget(userID)
+		return
+	}
+	n, ok := Badges.add(userID, delta)
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var err error
+		if n, err = Badges.Get(ctx, chatService, userID); err != nil {
+			utils.LogError(err, "CountUnread")
+			return
+		}
+	}
+	pushBadge(userID, n)
+}
+
+// pushBadge sends the current unread total to all of the user's connections
+func pushBadge(userID int, count int64) {
+	Manager.SendToUser(userID, map[string]interface{}{
+		"event":     "badge_count",
+		"count":     count,
+		"timestamp": time.Now().UnixMilli(),
+	})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+)
+
+// Bot posts system messages; set at startup
+var Bot *services.BotService
+
+// defaultRooms are the named rooms every new user joins at registration
+var defaultRooms []models.Room
+
+// defaultRoomWelcome is the welcome message template; {username} and {room} are substituted
+var defaultRoomWelcome string
+
+// InitDefaultRooms creates the configured default rooms (DEFAULT_ROOMS, comma separated)
+func InitDefaultRooms(ctx context.Context, chatService *services.ChatService) error {
+	defaultRoomWelcome = utils.GetEnv("DEFAULT_ROOM_WELCOME", "Welcome to {room}, {username}!")
+	names := utils.GetEnv("DEFAULT_ROOMS", "")
+	if names == "" {
+		return nil
+	}
+	rooms, err := chatService.EnsureTemplateRooms(ctx, strings.Split(names, ","))
+	if err != nil {
+		return err
+	}
+	defaultRooms = rooms
+	return nil
+}
+
+// postSystemMessage saves a bot message and broadcasts it to everyone viewing the room
+func postSystemMessage(chatService *services.ChatService, room, text string) error {
+	if Bot == nil {
+		return nil
+	}
+	return postSystemMessageAs(chatService, room, Bot.Username(), text)
+}
+
+// postSystemMessageAs posts a bot message under another sender name and delivers it like postSystemMessage
+func postSystemMessageAs(chatService *services.ChatService, room, username, text string) error {
+	if Bot == nil {
+		return nil
+	}
+	msg, err := Bot.PostSystemMessageAs(context.Background(), room, username, text)
+	if err != nil {
+		return err
+	}
+	Manager.Broadcast(room, models.WSMessage{
+		ID:        msg.ID,
+		Event:     "chat",
+		Room:      room,
+		Text:      text,
+		Username:  msg.Username,
+		Timestamp: msg.CreatedAt.UnixMilli(),
+		System:    true,
+	}, "")
+	go notifyRoomParticipants(chatService, "system", room, msg.ID, msg.UserID, msg.Username, text, msg.CreatedAt.UnixMilli())
+	return nil
+}
+
+// JoinDefaultRooms adds a newly registered user to every default room and posts a welcome message
+func JoinDefaultRooms(chatService *services.ChatService, userID int, username string) {
+	for _, room := range defaultRooms {
+		ev, err := chatService.AddRoomMember(context.Background(), room.ID, userID, nil)
+		if err != nil {
+			utils.LogError(err, "JoinDefaultRooms")
+			continue
+		}
+		if ev == nil {
+			continue
+		}
+		broadcastMembershipEvent(ev)
+		// The room's own welcome message replaces DEFAULT_ROOM_WELCOME
+		welcomeNewMember(chatService, ev, defaultRoomWelcome)
+	}
+}
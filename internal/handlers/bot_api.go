@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BotAuthMiddleware authenticates integration bots by the API key in "Authorization: Bearer <key>"
+func BotAuthMiddleware(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if key == "" {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "missing bot api key"})
+		}
+		userID, username, err := userService.AuthenticateBotKey(c.UserContext(), key)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidBotKey) {
+				return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to authenticate bot"})
+		}
+		c.Locals("user_id", userID)
+		c.Locals("username", username)
+		return c.Next()
+	}
+}
+
+// BulkMessagesHandler sends up to BOT_BULK_MAX_MESSAGES text messages across rooms in one call.
+// Messages that can't be sent are reported per index; the rest are delivered.
+func BulkMessagesHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		botID := c.Locals("user_id").(int)
+		username := c.Locals("username").(string)
+
+		var req models.BulkMessageRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		limit := utils.GetEnvInt("BOT_BULK_MAX_MESSAGES", 100)
+		if len(req.Messages) == 0 || len(req.Messages) > limit {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("messages must contain 1 to %d entries", limit)})
+		}
+
+		results, stored, err := chatService.SendBulkMessages(c.UserContext(), botID, username, req.Messages)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to send messages"})
+		}
+
+		for _, msg := range stored {
+			Manager.Broadcast(msg.Room, models.WSMessage{
+				ID:        msg.ID,
+				Event:     "chat",
+				Room:      msg.Room,
+				Text:      *msg.Content,
+				Username:  msg.Username,
+				Timestamp: msg.CreatedAt.UnixMilli(),
+				Silent:    msg.Silent,
+			}, "")
+			if msg.Silent {
+				continue
+			}
+			go notifyNewMessage(chatService, msg.Room, msg.ID, botID, username, *msg.Content, msg.CreatedAt.UnixMilli())
+		}
+
+		return c.JSON(fiber.Map{
+			"sent":    len(stored),
+			"failed":  len(results) - len(stored),
+			"results": results,
+		})
+	}
+}
+
+// AdminCreateBotHandler creates an integration bot and returns its API key once
+func AdminCreateBotHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.CreateBotRequest
+		if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Username) == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "username is required"})
+		}
+		bot, err := userService.CreateBot(c.UserContext(), strings.TrimSpace(req.Username))
+		if err != nil {
+			if errors.Is(err, services.ErrUserExists) {
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return adminError(c, err)
+		}
+		return c.Status(http.StatusCreated).JSON(bot)
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BulkCreateRoomsHandler creates up to BULK_ROOMS_MAX direct and group rooms in one
+// transaction (admins and integration bots, for onboarding imports). Participants who are
+// online get the usual member_added events once everything is committed.
+func BulkCreateRoomsHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.BulkRoomsRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		limit := utils.GetEnvInt("BULK_ROOMS_MAX", 500)
+		if len(req.Rooms) == 0 || len(req.Rooms) > limit {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("rooms must contain 1 to %d entries", limit)})
+		}
+		for i := range req.Rooms {
+			if req.Rooms[i].Type != "group" {
+				continue
+			}
+			name, ok := parseGroupName(req.Rooms[i].Name)
+			if !ok {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("room %d: name is required (max 100 characters)", i), "index": i})
+			}
+			req.Rooms[i].Name = name
+		}
+
+		results, events, err := chatService.CreateRoomsBulk(c.UserContext(), c.Locals("user_id").(int), req.Rooms, groupMaxMembers())
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrInvalidBulkRoom):
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, services.ErrNotFound):
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, services.ErrGroupFull):
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			utils.LogError(err, "CreateRoomsBulk")
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create rooms"})
+		}
+
+		for _, ev := range events {
+			notifyMembershipChange(ev)
+		}
+		created := 0
+		for _, r := range results {
+			if r.IsNew {
+				created++
+			}
+		}
+		return c.Status(http.StatusCreated).JSON(fiber.Map{
+			"created":  created,
+			"existing": len(results) - created,
+			"rooms":    results,
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errCallBusy     = errors.New("user is already in a call")
+	errCallNotFound = errors.New("call not found")
+	errNotCallee    = errors.New("only the callee can answer")
+	errCallAnswered = errors.New("call was already answered")
+	errCallOffline  = errors.New("user is offline")
+	errNotDirect    = errors.New("calls are only possible in direct rooms")
+)
+
+// callRingTimeout is how long an unanswered call keeps its parties busy; clients stop
+// ringing on their own, this only frees the users for the next call
+const callRingTimeout = time.Minute
+
+// callTracker holds the calls that are ringing or running, by id
+type callTracker struct {
+	mu    sync.Mutex
+	calls map[string]models.Call
+}
+
+// busy reports whether userID is in a call; t.mu must be held. Calls that rang out are dropped.
+func (t *callTracker) busy(userID int) bool {
+	for id, c := range t.calls {
+		if c.State == models.CallRinging && clock.Now().Sub(c.StartedAt) > callRingTimeout {
+			delete(t.calls, id)
+			continue
+		}
+		if c.CallerID == userID || c.CalleeID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *callTracker) start(call models.Call) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.busy(call.CallerID) || t.busy(call.CalleeID) {
+		return errCallBusy
+	}
+	if t.calls == nil {
+		t.calls = make(map[string]models.Call)
+	}
+	t.calls[call.ID] = call
+	return nil
+}
+
+func (t *callTracker) answer(callID string, userID int) (models.Call, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.calls[callID]
+	switch {
+	case !ok:
+		return c, errCallNotFound
+	case c.CalleeID != userID:
+		return c, errNotCallee
+	case c.State != models.CallRinging:
+		return c, errCallAnswered
+	}
+	now := clock.Now()
+	c.State = models.CallActive
+	c.AnsweredAt = &now
+	t.calls[callID] = c
+	return c, nil
+}
+
+func (t *callTracker) get(callID string) (models.Call, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.calls[callID]
+	return c, ok
+}
+
+func (t *callTracker) end(callID string) (models.Call, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.calls[callID]
+	delete(t.calls, callID)
+	return c, ok
+}
+
+func (t *callTracker) ofUser(userID int) []models.Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var calls []models.Call
+	for _, c := range t.calls {
+		if c.CallerID == userID || c.CalleeID == userID {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// apply mirrors a change made on another instance
+func (t *callTracker) apply(call models.Call, ended bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ended {
+		delete(t.calls, call.ID)
+		return
+	}
+	if t.calls == nil {
+		t.calls = make(map[string]models.Call)
+	}
+	t.calls[call.ID] = call
+}
+
+// StartCall tracks a new ringing call, unless one of its parties is already in a call
+func (m *RoomManager) StartCall(call models.Call) error {
+	if err := m.calls.start(call); err != nil {
+		return err
+	}
+	Cluster.publish(clusterEvent{Kind: clusterCall, Call: &call})
+	return nil
+}
+
+// AnswerCall makes a ringing call active; only its callee may answer
+func (m *RoomManager) AnswerCall(callID string, userID int) (models.Call, error) {
+	call, err := m.calls.answer(callID, userID)
+	if err != nil {
+		return call, err
+	}
+	Cluster.publish(clusterEvent{Kind: clusterCall, Call: &call})
+	return call, nil
+}
+
+func (m *RoomManager) GetCall(callID string) (models.Call, bool) {
+	return m.calls.get(callID)
+}
+
+// EndCall stops tracking a call and returns it
+func (m *RoomManager) EndCall(callID string) (models.Call, bool) {
+	call, ok := m.calls.end(callID)
+	if ok {
+		Cluster.publish(clusterEvent{Kind: clusterCall, Call: &call, Ended: true})
+	}
+	return call, ok
+}
+
+// UserCalls returns the calls userID is ringing, being rung for, or talking in
+func (m *RoomManager) UserCalls(userID int) []models.Call {
+	return m.calls.ofUser(userID)
+}
+
+func (m *RoomManager) applyCallLocal(call models.Call, ended bool) {
+	m.calls.apply(call, ended)
+}
+
+func init() {
+	registerEvent("call_offer", typed(handleCallOffer).roomScoped())
+	registerEvent("call_answer", typed(handleCallAnswer))
+	registerEvent("ice_candidate", typed(handleIceCandidate))
+	registerEvent("call_end", typed(handleCallEnd))
+}
+
+// handleCallOffer rings the other participant of a direct room with the caller's SDP offer
+func handleCallOffer(s *wsSession, msg *models.CallOfferRequest) error {
+	peerID, err := s.chatService.GetDirectPeer(s.ctx, msg.Room, s.userID)
+	if errors.Is(err, services.ErrNotFound) {
+		return errNotDirect
+	}
+	if err != nil {
+		utils.LogError(err, "GetDirectPeer")
+		return errors.New("failed to start call")
+	}
+	if !Manager.IsUserOnline(peerID) {
+		return errCallOffline
+	}
+
+	call := models.Call{
+		ID:        uuid.New().String(),
+		Room:      msg.Room,
+		CallerID:  s.userID,
+		CalleeID:  peerID,
+		Media:     msg.Media,
+		State:     models.CallRinging,
+		StartedAt: clock.Now(),
+	}
+	if err := Manager.StartCall(call); err != nil {
+		return err
+	}
+
+	Manager.SendToUser(peerID, map[string]interface{}{
+		"event":     "call_offer",
+		"call_id":   call.ID,
+		"room":      call.Room,
+		"media":     call.Media,
+		"sdp":       msg.SDP,
+		"from_id":   s.userID,
+		"from":      s.username,
+		"timestamp": call.StartedAt.UnixMilli(),
+	})
+	// Every device of the caller learns the call id, to send candidates and hang up with
+	Manager.SendToUser(s.userID, map[string]interface{}{
+		"event": "call_ringing",
+		"call":  call,
+	})
+	return nil
+}
+
+// handleCallAnswer accepts a call and relays the SDP answer to the caller. The callee's
+// other devices get call_answered so they stop ringing.
+func handleCallAnswer(s *wsSession, msg *models.CallAnswerRequest) error {
+	call, err := Manager.AnswerCall(msg.CallID, s.userID)
+	if err != nil {
+		return err
+	}
+	Manager.SendToUser(call.CallerID, map[string]interface{}{
+		"event":     "call_answer",
+		"call_id":   call.ID,
+		"room":      call.Room,
+		"sdp":       msg.SDP,
+		"from_id":   s.userID,
+		"from":      s.username,
+		"timestamp": call.AnsweredAt.UnixMilli(),
+	})
+	Manager.SendToUser(s.userID, map[string]interface{}{
+		"event": "call_answered",
+		"call":  call,
+	})
+	return nil
+}
+
+// handleIceCandidate relays an ICE candidate to the other party
+func handleIceCandidate(s *wsSession, msg *models.IceCandidateRequest) error {
+	call, ok := Manager.GetCall(msg.CallID)
+	peerID := call.Peer(s.userID)
+	if !ok || peerID == 0 {
+		return errCallNotFound
+	}
+	Manager.SendToUser(peerID, map[string]interface{}{
+		"event":     "ice_candidate",
+		"call_id":   call.ID,
+		"candidate": msg.Candidate,
+		"from_id":   s.userID,
+	})
+	return nil
+}
+
+// handleCallEnd hangs up, declines or cancels a call for both parties
+func handleCallEnd(s *wsSession, msg *models.CallEndRequest) error {
+	call, ok := Manager.GetCall(msg.CallID)
+	if !ok || call.Peer(s.userID) == 0 {
+		return errCallNotFound
+	}
+	if call, ok = Manager.EndCall(msg.CallID); ok {
+		notifyCallEnded(call, s.userID, msg.Reason)
+	}
+	return nil
+}
+
+// notifyCallEnded sends call_end to every device of both parties
+func notifyCallEnded(call models.Call, byUserID int, reason string) {
+	ev := map[string]interface{}{
+		"event":     "call_end",
+		"call_id":   call.ID,
+		"room":      call.Room,
+		"reason":    reason,
+		"by_id":     byUserID,
+		"timestamp": clock.Now().UnixMilli(),
+	}
+	if call.AnsweredAt != nil {
+		ev["duration_ms"] = since(*call.AnsweredAt).Milliseconds()
+	}
+	Manager.SendToUsers([]int{call.CallerID, call.CalleeID}, ev)
+}
+
+// endUserCalls ends the calls of a user who disconnected everywhere
+func endUserCalls(userID int) {
+	for _, call := range Manager.UserCalls(userID) {
+		if call, ok := Manager.EndCall(call.ID); ok {
+			notifyCallEnded(call, userID, "disconnected")
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// clientIPConfig says which peers may name the client address, set once by InitClientIP
+var clientIPConfig struct {
+	header  string
+	proxies []*net.IPNet
+}
+
+// InitClientIP configures ClientIP from PROXY_HEADER and TRUSTED_PROXIES (comma separated
+// IPs or CIDRs) and returns the proxy entries for fiber.Config.TrustedProxies. Without
+// trusted proxies the header is never read.
+func InitClientIP(header, trusted string) ([]string, error) {
+	var entries []string
+	for _, v := range strings.Split(trusted, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			entries = append(entries, v)
+		}
+	}
+	proxies, err := parseNets(entries)
+	if err != nil {
+		return nil, err
+	}
+	clientIPConfig.header = strings.TrimSpace(header)
+	clientIPConfig.proxies = proxies
+	return entries, nil
+}
+
+// fromTrustedProxy reports whether the request's peer is a trusted proxy, whose headers
+// (the client address, a CDN country) can be believed
+func fromTrustedProxy(c *fiber.Ctx) bool {
+	return containsIP(clientIPConfig.proxies, c.Context().RemoteIP())
+}
+
+// ClientIP returns the client address for rate limits, IP filters and records. The proxy
+// header is only read from trusted proxies and walked from the right, skipping trusted
+// hops, so a client can't pick its address by sending the header itself. The result is
+// always a valid IP.
+func ClientIP(c *fiber.Ctx) string {
+	remote := c.Context().RemoteIP()
+	if clientIPConfig.header == "" || !fromTrustedProxy(c) {
+		return remote.String()
+	}
+	var hops []string
+	for _, value := range c.Request().Header.PeekAll(clientIPConfig.header) {
+		hops = append(hops, strings.Split(string(value), ",")...)
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			// Whatever comes before a malformed hop can't be trusted
+			break
+		}
+		client = ip
+		if !containsIP(clientIPConfig.proxies, ip) {
+			break
+		}
+	}
+	return client.String()
+}
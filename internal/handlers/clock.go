@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells the time for connection bookkeeping and away detection, so their transitions
+// can be driven step by step with a FakeClock
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// clockBox wraps the Clock kept in a swappableClock, as atomic.Value needs one concrete type
+type clockBox struct{ Clock }
+
+// swappableClock is a Clock whose source SetClock can replace while other goroutines read it
+type swappableClock struct {
+	v atomic.Value // clockBox
+}
+
+func newSwappableClock(c Clock) *swappableClock {
+	s := &swappableClock{}
+	s.v.Store(clockBox{c})
+	return s
+}
+
+func (s *swappableClock) Now() time.Time {
+	return s.v.Load().(clockBox).Now()
+}
+
+// clock is the time source of the handlers package; replaced with SetClock
+var clock = newSwappableClock(systemClock{})
+
+// SetClock replaces the time source; nil restores the system clock. It is safe to call while
+// connections and background jobs are running.
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	clock.v.Store(clockBox{c})
+}
+
+// since is time.Since on the package clock
+func since(t time.Time) time.Duration {
+	return clock.Now().Sub(t)
+}
+
+// FakeClock is a Clock that only moves when told to
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to now
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
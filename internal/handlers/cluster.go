@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/google/uuid"
+)
+
+// ClusterTransport carries events between instances. Publish must reach the Subscribe
+// handler of every instance; an instance ignores the events it published itself.
+type ClusterTransport interface {
+	Publish(ctx context.Context, payload []byte) error
+	Subscribe(ctx context.Context, handle func(payload []byte))
+}
+
+// Cluster event kinds
+const (
+	clusterRoom     = "room"     // Broadcast to a room's viewers
+	clusterUser     = "user"     // SendToUser
+	clusterAll      = "all"      // BroadcastToAll
+	clusterPresence = "presence" // One user's state on the origin changed
+	clusterSnapshot = "snapshot" // Every online user of the origin, sent as a heartbeat
+	clusterBye      = "bye"      // The origin is shutting down
+	clusterCall     = "call"     // A call started, was answered or ended
+)
+
+// clusterEvent is the envelope published to other instances. Payload is the encoded event
+// exactly as local clients receive it.
+type clusterEvent struct {
+	Origin     string           `json:"origin"`
+	Kind       string           `json:"kind"`
+	Room       string           `json:"room,omitempty"`
+	Exclude    string           `json:"exclude,omitempty"` // Connection to skip, only meaningful on its instance
+	UserID     int              `json:"user_id,omitempty"`
+	DeliveryID string           `json:"delivery_id,omitempty"`
+	MessageID  int              `json:"message_id,omitempty"` // Chat message whose delivery is recorded
+	Online     bool             `json:"online,omitempty"`
+	Away       bool             `json:"away,omitempty"`       // The user is inactive on the origin
+	Rooms      []string         `json:"rooms,omitempty"`      // Rooms the user is viewing on the origin
+	Presence   map[int][]string `json:"presence,omitempty"`   // Snapshot: online user -> rooms viewed
+	AwayUsers  []int            `json:"away_users,omitempty"` // Snapshot: online users that are away
+	Call       *models.Call     `json:"call,omitempty"`
+	Ended      bool             `json:"ended,omitempty"` // The call is over
+	Payload    json.RawMessage  `json:"payload,omitempty"`
+}
+
+var (
+	clusterPublished = metrics.NewCounter("cluster_events_published_total", "Events published to other instances")
+	clusterReceived  = metrics.NewCounter("cluster_events_received_total", "Events received from other instances")
+	clusterDropped   = metrics.NewCounter("cluster_events_dropped_total", "Events not published because the outbox was full or publishing failed")
+)
+
+// remoteInstance is what this instance knows about another one's connections
+type remoteInstance struct {
+	users map[int][]string // Online user -> rooms they're viewing
+	away  map[int]bool     // Online users inactive there
+	seen  time.Time
+}
+
+// ClusterBus relays broadcasts and presence between instances so several replicas can serve
+// the same rooms. Publishing is asynchronous and never blocks the caller; when the outbox is
+// full events are dropped. Remote presence expires if an instance misses three heartbeats.
+type ClusterBus struct {
+	transport  ClusterTransport
+	instanceID string
+	heartbeat  time.Duration
+	outbox     chan clusterEvent
+
+	mu     sync.RWMutex
+	remote map[string]*remoteInstance
+}
+
+// Cluster is the cross-instance bus; nil when this instance runs alone
+var Cluster *ClusterBus
+
+func init() {
+	metrics.NewGaugeFunc("cluster_remote_instances", "Other instances that sent a heartbeat recently", func() float64 {
+		return float64(Cluster.remoteInstances())
+	})
+}
+
+// StartCluster connects this instance to the others through transport. It stops, telling the
+// others to forget this instance, when ctx is cancelled.
+func StartCluster(ctx context.Context, transport ClusterTransport, heartbeat time.Duration) {
+	if heartbeat <= 0 {
+		heartbeat = 10 * time.Second
+	}
+	Cluster = &ClusterBus{
+		transport:  transport,
+		instanceID: uuid.New().String(),
+		heartbeat:  heartbeat,
+		outbox:     make(chan clusterEvent, max(utils.GetEnvInt("CLUSTER_OUTBOX", 1024), 1)),
+		remote:     make(map[string]*remoteInstance),
+	}
+	go transport.Subscribe(ctx, Cluster.receive)
+	go Cluster.run(ctx)
+	log.Printf("Cluster eventing enabled (instance %s)", Cluster.instanceID)
+}
+
+// publish queues an event for the other instances
+func (b *ClusterBus) publish(ev clusterEvent) {
+	if b == nil {
+		return
+	}
+	ev.Origin = b.instanceID
+	select {
+	case b.outbox <- ev:
+	default:
+		clusterDropped.Inc()
+	}
+}
+
+func (b *ClusterBus) run(ctx context.Context) {
+	ticker := time.NewTicker(b.heartbeat)
+	defer ticker.Stop()
+	b.publish(b.snapshot())
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is gone; give the goodbye its own deadline
+			byeCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			b.send(byeCtx, clusterEvent{Origin: b.instanceID, Kind: clusterBye})
+			cancel()
+			return
+		case ev := <-b.outbox:
+			b.send(ctx, ev)
+		case <-ticker.C:
+			b.pruneStale()
+			b.publish(b.snapshot())
+		}
+	}
+}
+
+// snapshot is the heartbeat event: every user online here, with those that are away
+func (b *ClusterBus) snapshot() clusterEvent {
+	return clusterEvent{Kind: clusterSnapshot, Presence: Manager.presenceSnapshot(), AwayUsers: Activity.awayUsers()}
+}
+
+func (b *ClusterBus) send(ctx context.Context, ev clusterEvent) {
+	payload, err := json.Marshal(ev)
+	if err == nil {
+		err = b.transport.Publish(ctx, payload)
+	}
+	if err != nil {
+		clusterDropped.Inc()
+		utils.LogError(err, "cluster publish "+ev.Kind)
+		return
+	}
+	clusterPublished.Inc()
+}
+
+// receive delivers an event from another instance to local connections
+func (b *ClusterBus) receive(payload []byte) {
+	var ev clusterEvent
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		utils.LogError(err, "cluster event")
+		return
+	}
+	if ev.Origin == b.instanceID {
+		return
+	}
+	clusterReceived.Inc()
+
+	switch ev.Kind {
+	case clusterRoom:
+		Manager.broadcastLocal(ev.Room, ev.Payload, ev.Exclude, ev.MessageID)
+	case clusterUser:
+		Manager.sendToUserLocal(ev.UserID, ev.Payload, ev.DeliveryID, ev.MessageID)
+	case clusterAll:
+		Manager.broadcastAllLocal(ev.Payload)
+	case clusterPresence:
+		b.mu.Lock()
+		inst := b.instance(ev.Origin)
+		if ev.Online {
+			inst.users[ev.UserID] = ev.Rooms
+		} else {
+			delete(inst.users, ev.UserID)
+		}
+		if ev.Online && ev.Away {
+			inst.away[ev.UserID] = true
+		} else {
+			delete(inst.away, ev.UserID)
+		}
+		b.mu.Unlock()
+	case clusterSnapshot:
+		b.mu.Lock()
+		inst := b.instance(ev.Origin)
+		inst.users = ev.Presence
+		if inst.users == nil {
+			inst.users = make(map[int][]string)
+		}
+		inst.away = make(map[int]bool, len(ev.AwayUsers))
+		for _, userID := range ev.AwayUsers {
+			inst.away[userID] = true
+		}
+		b.mu.Unlock()
+	case clusterCall:
+		if ev.Call != nil {
+			Manager.applyCallLocal(*ev.Call, ev.Ended)
+		}
+	case clusterBye:
+		b.mu.Lock()
+		delete(b.remote, ev.Origin)
+		b.mu.Unlock()
+	}
+}
+
+// instance returns the state of an instance, marking it alive; b.mu must be held
+func (b *ClusterBus) instance(id string) *remoteInstance {
+	inst, ok := b.remote[id]
+	if !ok {
+		inst = &remoteInstance{users: make(map[int][]string), away: make(map[int]bool)}
+		b.remote[id] = inst
+	}
+	inst.seen = time.Now()
+	return inst
+}
+
+// pruneStale forgets instances that missed three heartbeats
+func (b *ClusterBus) pruneStale() {
+	cutoff := time.Now().Add(-3 * b.heartbeat)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, inst := range b.remote {
+		if inst.seen.Before(cutoff) {
+			delete(b.remote, id)
+		}
+	}
+}
+
+// presenceChanged tells the other instances which rooms userID is viewing here now
+func (b *ClusterBus) presenceChanged(userID int) {
+	if b == nil {
+		return
+	}
+	online, rooms := Manager.localPresence(userID)
+	b.publish(clusterEvent{Kind: clusterPresence, UserID: userID, Online: online, Away: Activity.away(userID), Rooms: rooms})
+}
+
+// clusterInstance is one instance as listed by AdminInfoHandler
+type clusterInstance struct {
+	ID          string     `json:"id"`
+	Self        bool       `json:"self,omitempty"`
+	OnlineUsers int        `json:"online_users"`
+	LastSeen    *time.Time `json:"last_seen,omitempty"` // Last event heard from a remote instance
+}
+
+// instances lists this instance and the ones heard from recently; empty without a bus
+func (b *ClusterBus) instances() []clusterInstance {
+	if b == nil {
+		return []clusterInstance{}
+	}
+	list := []clusterInstance{{ID: b.instanceID, Self: true, OnlineUsers: Manager.Stats().OnlineUsers}}
+	b.mu.RLock()
+	for id, inst := range b.remote {
+		seen := inst.seen
+		list = append(list, clusterInstance{ID: id, OnlineUsers: len(inst.users), LastSeen: &seen})
+	}
+	b.mu.RUnlock()
+	sort.Slice(list[1:], func(i, j int) bool { return list[1+i].ID < list[1+j].ID })
+	return list
+}
+
+// userOnline reports whether userID is connected to another instance
+func (b *ClusterBus) userOnline(userID int) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, inst := range b.remote {
+		if _, ok := inst.users[userID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// userActive reports whether userID is connected to another instance and active there
+func (b *ClusterBus) userActive(userID int) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, inst := range b.remote {
+		if _, ok := inst.users[userID]; ok && !inst.away[userID] {
+			return true
+		}
+	}
+	return false
+}
+
+// userInRoom reports whether userID is viewing roomID on another instance
+func (b *ClusterBus) userInRoom(userID int, roomID string) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, inst := range b.remote {
+		for _, room := range inst.users[userID] {
+			if room == roomID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (b *ClusterBus) remoteInstances() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.remote)
+}
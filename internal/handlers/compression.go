@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+)
+
+// compressionLevels maps COMPRESS_ROUTES level names onto the middleware levels
+var compressionLevels = map[string]compress.Level{
+	"off":     compress.LevelDisabled,
+	"speed":   compress.LevelBestSpeed,
+	"default": compress.LevelDefault,
+	"best":    compress.LevelBestCompression,
+}
+
+type compressionRoute struct {
+	prefix  string
+	handler fiber.Handler
+}
+
+// CompressionMiddleware compresses responses with brotli, gzip or deflate, whichever the client
+// accepts. COMPRESS_ROUTES lists path prefixes with a level (off, speed, default, best), e.g.
+// "/api/=default,/api/rooms/=best,/api/account/export=off"; the longest matching prefix wins and
+// other paths are not compressed. Only compressible types (JSON, text, ...) of at least 200 bytes
+// are compressed, so uploads and voice files pass through unchanged.
+func CompressionMiddleware() (fiber.Handler, error) {
+	var routes []compressionRoute
+	for _, entry := range strings.Split(utils.GetEnv("COMPRESS_ROUTES", "/api/=default"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, name, ok := strings.Cut(entry, "=")
+		level, known := compressionLevels[strings.TrimSpace(name)]
+		if !ok || !known || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("invalid compression route %q, expected /<prefix>=off|speed|default|best", entry)
+		}
+		routes = append(routes, compressionRoute{prefix: strings.TrimSpace(prefix), handler: compress.New(compress.Config{Level: level})})
+	}
+	// Longest prefix first
+	sort.Slice(routes, func(i, j int) bool { return len(routes[i].prefix) > len(routes[j].prefix) })
+
+	return func(c *fiber.Ctx) error {
+		path := c.Path()
+		for _, r := range routes {
+			if strings.HasPrefix(path, r.prefix) {
+				return r.handler(c)
+			}
+		}
+		return c.Next()
+	}, nil
+}
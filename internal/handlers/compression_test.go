@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"chat-backend/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// historyPayload is a history response of n text messages, like GET /api/rooms/:id/messages
+func historyPayload(n int) []byte {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	messages := make([]models.Message, n)
+	for i := range messages {
+		content := fmt.Sprintf("Message %d: are we still on for the review at %d o'clock? I'll bring the notes.", i, 9+i%8)
+		messages[i] = models.Message{
+			ID:        i + 1,
+			Room:      "general",
+			UserID:    1 + i%5,
+			Username:  fmt.Sprintf("user%d", 1+i%5),
+			Content:   &content,
+			HasSeen:   i%3 != 0,
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	body, err := json.Marshal(fiber.Map{"messages": messages, "has_more": true})
+	if err != nil {
+		panic(err)
+	}
+	return body
+}
+
+// compressionApp serves payload at /api/rooms/general/messages behind CompressionMiddleware
+// configured with routes
+func compressionApp(tb testing.TB, routes string, payload []byte) fasthttp.RequestHandler {
+	tb.Setenv("COMPRESS_ROUTES", routes)
+	compress, err := CompressionMiddleware()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	app := fiber.New()
+	app.Use(compress)
+	app.Get("/api/rooms/:id/messages", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(payload)
+	})
+	return app.Handler()
+}
+
+// fetchHistory runs one request and returns the response body size and encoding
+func fetchHistory(handler fasthttp.RequestHandler, encoding string) (int, string) {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("/api/rooms/general/messages")
+	ctx.Request.Header.SetMethod(fiber.MethodGet)
+	if encoding != "" {
+		ctx.Request.Header.Set(fiber.HeaderAcceptEncoding, encoding)
+	}
+	handler(&ctx)
+	return len(ctx.Response.Body()), string(ctx.Response.Header.Peek(fiber.HeaderContentEncoding))
+}
+
+func TestCompressionMiddlewareShrinksHistory(t *testing.T) {
+	payload := historyPayload(500)
+	handler := compressionApp(t, "/api/=default,/api/account/export=off", payload)
+
+	for _, encoding := range []string{"gzip", "br", "deflate"} {
+		size, got := fetchHistory(handler, encoding)
+		if got != encoding {
+			t.Fatalf("Content-Encoding = %q, want %q", got, encoding)
+		}
+		if size*4 > len(payload) {
+			t.Errorf("%s: %d of %d bytes, expected at least 4x smaller", encoding, size, len(payload))
+		}
+	}
+	if size, got := fetchHistory(handler, ""); got != "" || size != len(payload) {
+		t.Errorf("without Accept-Encoding got %d bytes encoded %q, want the %d byte payload as is", size, got, len(payload))
+	}
+}
+
+func TestCompressionMiddlewareRoutes(t *testing.T) {
+	payload := historyPayload(100)
+	handler := compressionApp(t, "/api/=default,/api/rooms/=off", payload)
+	if size, got := fetchHistory(handler, "gzip"); got != "" || size != len(payload) {
+		t.Errorf("longest prefix is off, got %d bytes encoded %q", size, got)
+	}
+
+	for _, routes := range []string{"/api/=fast", "api/=best", "/api/"} {
+		t.Setenv("COMPRESS_ROUTES", routes)
+		if _, err := CompressionMiddleware(); err == nil {
+			t.Errorf("COMPRESS_ROUTES %q accepted", routes)
+		}
+	}
+}
+
+// benchmarkHistory reports the response size of a 1000 message history per encoding and
+// level, as resp-bytes and as the share of the uncompressed payload
+func benchmarkHistory(b *testing.B, level, encoding string) {
+	payload := historyPayload(1000)
+	handler := compressionApp(b, "/api/="+level, payload)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	var size int
+	for i := 0; i < b.N; i++ {
+		size, _ = fetchHistory(handler, encoding)
+	}
+	b.ReportMetric(float64(size), "resp-bytes")
+	b.ReportMetric(100*float64(size)/float64(len(payload)), "%-of-raw")
+}
+
+func BenchmarkHistoryUncompressed(b *testing.B)  { benchmarkHistory(b, "off", "gzip") }
+func BenchmarkHistoryGzipSpeed(b *testing.B)     { benchmarkHistory(b, "speed", "gzip") }
+func BenchmarkHistoryGzipDefault(b *testing.B)   { benchmarkHistory(b, "default", "gzip") }
+func BenchmarkHistoryGzipBest(b *testing.B)      { benchmarkHistory(b, "best", "gzip") }
+func BenchmarkHistoryBrotliDefault(b *testing.B) { benchmarkHistory(b, "default", "br") }
+func BenchmarkHistoryBrotliBest(b *testing.B)    { benchmarkHistory(b, "best", "br") }
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// AdminContentScanHandler lists recent messages matching ?keyword=, ?sha256= and/or ?user_id=
+// within ?since= (default 7 days), newest first
+func AdminContentScanHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter := models.ContentScanFilter{
+			Keyword: strings.TrimSpace(c.Query("keyword")),
+			SHA256:  c.Query("sha256"),
+			UserID:  c.QueryInt("user_id"),
+			Since:   7 * 24 * time.Hour,
+			Limit:   c.QueryInt("limit", 100),
+		}
+		if filter.SHA256 != "" && !sha256Pattern.MatchString(filter.SHA256) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "sha256 must be 64 hex characters"})
+		}
+		if since := c.Query("since"); since != "" {
+			d, err := time.ParseDuration(since)
+			if err != nil || d <= 0 {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid since"})
+			}
+			filter.Since = d
+		}
+		if filter.Limit <= 0 || filter.Limit > 500 {
+			filter.Limit = 100
+		}
+
+		matches, err := adminService.ScanContent(c.UserContext(), filter)
+		if err != nil {
+			if errors.Is(err, services.ErrEmptyScan) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to scan content"})
+		}
+		return c.JSON(fiber.Map{"matches": matches})
+	}
+}
+
+// AdminTakedownHandler tombstones the listed messages, each with its own audit entry, and
+// broadcasts message_deleted for every one removed
+func AdminTakedownHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.TakedownRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if len(req.MessageIDs) == 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "message_ids is required"})
+		}
+		if max := utils.GetEnvInt("ADMIN_TAKEDOWN_MAX", 500); len(req.MessageIDs) > max {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "too many messages", "max": max})
+		}
+
+		details := map[string]interface{}{"takedown": true, "reason": strings.TrimSpace(req.Reason)}
+		if token, ok := adminTokenAudit(c).(map[string]interface{}); ok {
+			for k, v := range token {
+				details[k] = v
+			}
+		}
+		results, deleted := adminService.TakedownMessages(c.UserContext(), c.Locals("user_id").(int), req.MessageIDs, details)
+		for _, msg := range deleted {
+			broadcastMessageDeleted(msg)
+		}
+		return c.JSON(fiber.Map{"results": results, "deleted": len(deleted)})
+	}
+}
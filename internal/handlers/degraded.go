@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// errOutageQueueFull is returned for chat messages that don't fit the outage queue
+var errOutageQueueFull = errors.New("the server can't reach its database; try again shortly")
+
+// queuedChat is a chat message held while the database is unavailable
+type queuedChat struct {
+	id       string
+	session  *wsSession
+	room     string
+	req      models.ChatRequest
+	queuedAt time.Time
+}
+
+// tell sends ev to the connection that sent the message or, once it is gone, to every
+// connection of its sender, which may include the same client reconnected
+func (q queuedChat) tell(ev map[string]interface{}) {
+	ev["queue_id"] = q.id
+	ev["client_id"] = q.req.ClientID
+	ev["room"] = q.room
+	if q.session.ctx.Err() == nil {
+		q.session.send(ev)
+		return
+	}
+	Manager.SendToUser(q.session.userID, ev)
+}
+
+// outageState tracks a database outage on this instance. While it lasts chat messages are
+// queued in memory, bounded in total and per user, and replayed in order once the database
+// answers again. Messages queued for longer than ttl are rejected instead.
+type outageState struct {
+	mu      sync.Mutex
+	enabled bool // Set by StartDBHealthMonitor, which is what ends an outage
+	active  bool
+	since   time.Time
+	queue   []queuedChat
+	perUser map[int]int
+
+	maxQueue   int
+	maxPerUser int
+	ttl        time.Duration
+}
+
+var (
+	dbOutage = &outageState{perUser: map[int]int{}}
+
+	outageQueued   = metrics.NewCounter("db_outage_messages_queued_total", "Chat messages queued while the database was unavailable")
+	outageReplayed = metrics.NewCounter("db_outage_messages_replayed_total", "Queued chat messages saved once the database recovered")
+	outageRejected = metrics.NewCounterVec("db_outage_messages_rejected_total", "Chat messages refused or dropped because of a database outage", "reason")
+	_              = metrics.NewGaugeFunc("db_degraded", "1 while the database is unavailable and chat messages are queued", func() float64 {
+		if dbOutage.isActive() {
+			return 1
+		}
+		return 0
+	})
+	_ = metrics.NewGaugeFunc("db_outage_queue_length", "Chat messages waiting for the database", func() float64 {
+		dbOutage.mu.Lock()
+		defer dbOutage.mu.Unlock()
+		return float64(len(dbOutage.queue))
+	})
+)
+
+func (o *outageState) isActive() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.active
+}
+
+// status returns the degraded event for clients connecting during an outage
+func (o *outageState) status() (map[string]interface{}, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.active {
+		return nil, false
+	}
+	return o.degradedEvent(), true
+}
+
+// degradedEvent announces an ongoing outage; o.mu must be held
+func (o *outageState) degradedEvent() map[string]interface{} {
+	return map[string]interface{}{
+		"event":        "degraded",
+		"active":       true,
+		"reason":       "database",
+		"since":        o.since.UnixMilli(),
+		"queue_ttl_ms": o.ttl.Milliseconds(),
+	}
+}
+
+// begin starts an outage and sends degraded to every connection on this instance
+func (o *outageState) begin(cause error) {
+	o.mu.Lock()
+	if !o.enabled || o.active {
+		o.mu.Unlock()
+		return
+	}
+	o.active, o.since = true, clock.Now()
+	ev := o.degradedEvent()
+	o.mu.Unlock()
+
+	log.Printf("Database unavailable, queueing chat messages: %v", cause)
+	Manager.sendAllLocal(ev)
+}
+
+// check pings the database unless an outage is already known, and starts one when the
+// ping fails. It reports whether the database is down.
+func (o *outageState) check() bool {
+	if o.isActive() {
+		return true
+	}
+	if err := pingDB(); err != nil {
+		o.begin(err)
+		return o.isActive()
+	}
+	return false
+}
+
+// pingDB checks that the primary answers
+func pingDB() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return db.Pool.Ping(ctx)
+}
+
+// hold queues msg during an outage and sends message_queued back. It reports false when
+// there is no outage and the message should be posted right away.
+func (o *outageState) hold(s *wsSession, room string, msg *models.ChatRequest) (bool, error) {
+	o.mu.Lock()
+	if !o.active {
+		o.mu.Unlock()
+		return false, nil
+	}
+	expired := o.pruneLocked()
+	full := len(o.queue) >= o.maxQueue || o.perUser[s.userID] >= o.maxPerUser
+	q := queuedChat{id: uuid.New().String(), session: s, room: room, req: *msg, queuedAt: clock.Now()}
+	if !full {
+		o.queue = append(o.queue, q)
+		o.perUser[s.userID]++
+	}
+	expiresAt := q.queuedAt.Add(o.ttl)
+	o.mu.Unlock()
+
+	rejectQueued(expired, "expired")
+	if full {
+		outageRejected.Inc("queue_full")
+		return true, errOutageQueueFull
+	}
+	outageQueued.Inc()
+	q.tell(map[string]interface{}{
+		"event":      "message_queued",
+		"expires_at": expiresAt.UnixMilli(),
+	})
+	return true, nil
+}
+
+// pruneLocked removes and returns the messages queued for longer than ttl; o.mu must be held
+func (o *outageState) pruneLocked() []queuedChat {
+	n := 0
+	for n < len(o.queue) && since(o.queue[n].queuedAt) > o.ttl {
+		o.perUser[o.queue[n].session.userID]--
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	expired := append([]queuedChat(nil), o.queue[:n]...)
+	o.queue = o.queue[n:]
+	for userID, count := range o.perUser {
+		if count <= 0 {
+			delete(o.perUser, userID)
+		}
+	}
+	return expired
+}
+
+// expire rejects the messages that waited too long, without waiting for the database
+func (o *outageState) expire() {
+	o.mu.Lock()
+	expired := o.pruneLocked()
+	o.mu.Unlock()
+	rejectQueued(expired, "expired")
+}
+
+// rejectQueued sends message_rejected for each message
+func rejectQueued(queued []queuedChat, reason string) {
+	for _, q := range queued {
+		outageRejected.Inc(reason)
+		q.tell(map[string]interface{}{"event": "message_rejected", "reason": reason})
+	}
+}
+
+// recover replays the queue in order and ends the outage once it is empty. Messages sent
+// meanwhile still queue behind the replay, so a room gets them in the order they were sent.
+// If the database fails again, the rest of the queue waits for the next attempt.
+func (o *outageState) recover() {
+	for {
+		o.mu.Lock()
+		expired := o.pruneLocked()
+		if len(o.queue) == 0 {
+			started := o.since
+			o.active = false
+			o.mu.Unlock()
+			rejectQueued(expired, "expired")
+
+			log.Printf("Database available again after %s", since(started).Round(time.Second))
+			Manager.sendAllLocal(map[string]interface{}{
+				"event":       "degraded",
+				"active":      false,
+				"reason":      "database",
+				"since":       started.UnixMilli(),
+				"duration_ms": since(started).Milliseconds(),
+			})
+			return
+		}
+		q := o.queue[0]
+		o.queue = o.queue[1:]
+		if o.perUser[q.session.userID]--; o.perUser[q.session.userID] <= 0 {
+			delete(o.perUser, q.session.userID)
+		}
+		o.mu.Unlock()
+		rejectQueued(expired, "expired")
+
+		if q.session.ctx.Err() != nil {
+			// Posting needs the sender's connection; the client can send it again
+			rejectQueued([]queuedChat{q}, "disconnected")
+			continue
+		}
+		id, err := postChat(q.session, q.room, &q.req)
+		if err != nil {
+			if pingDB() != nil {
+				o.mu.Lock()
+				o.queue = append([]queuedChat{q}, o.queue...)
+				o.perUser[q.session.userID]++
+				o.mu.Unlock()
+				return
+			}
+			outageRejected.Inc("failed")
+			q.tell(map[string]interface{}{"event": "message_rejected", "reason": "failed", "error": err.Error()})
+			continue
+		}
+		outageReplayed.Inc()
+		q.tell(map[string]interface{}{"event": "message_replayed", "id": id})
+	}
+}
+
+// StartDBHealthMonitor pings the database every interval. A failed ping, or a chat message
+// failing while the ping does, starts an outage: connected clients get a degraded event and
+// chat messages are queued, at most queueSize in all and perUser per user, each for up to
+// ttl. When the database answers again the queue is replayed and clients get degraded with
+// active false. It stops when ctx is cancelled.
+func StartDBHealthMonitor(ctx context.Context, interval time.Duration, queueSize, perUser int, ttl time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	dbOutage.mu.Lock()
+	dbOutage.enabled = true
+	dbOutage.maxQueue, dbOutage.maxPerUser, dbOutage.ttl = queueSize, perUser, ttl
+	dbOutage.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := pingDB(); err != nil {
+					dbOutage.begin(err)
+					dbOutage.expire()
+				} else if dbOutage.isActive() {
+					dbOutage.recover()
+				}
+			}
+		}
+	}()
+}
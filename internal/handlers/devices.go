@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListDevicesHandler returns the authenticated user's login devices
+func ListDevicesHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		devices, err := userService.ListDevices(c.UserContext(), userID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(devices)
+	}
+}
+
+// RevokeDeviceHandler revokes one of the authenticated user's devices
+func RevokeDeviceHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		deviceID := c.Params("device_id")
+		if err := userService.RevokeDevice(c.UserContext(), userID, deviceID); err != nil {
+			if errors.Is(err, services.ErrNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "device not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		notifyDeviceRevoked(userID, deviceID)
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// RevokeDeviceLinkHandler serves the one-click revoke link from the new device email.
+// It is public: possession of the revoke token is the authorization.
+func RevokeDeviceLinkHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Query("token")
+		if token == "" {
+			return c.Status(http.StatusBadRequest).SendString("Missing token")
+		}
+		userID, err := userService.RevokeDeviceByToken(c.UserContext(), token)
+		if err != nil {
+			if errors.Is(err, services.ErrNotFound) {
+				return c.Status(http.StatusNotFound).SendString("This link is invalid or has already been used.")
+			}
+			return c.Status(http.StatusInternalServerError).SendString("Failed to revoke device")
+		}
+		notifyDeviceRevoked(userID, "")
+		return c.SendString("The device has been signed out. Consider changing your password.")
+	}
+}
+
+func notifyDeviceRevoked(userID int, deviceID string) {
+	Manager.SendToUser(userID, map[string]interface{}{
+		"event":     "device_revoked",
+		"device_id": deviceID,
+		"timestamp": time.Now().UnixMilli(),
+	})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// wsSession holds the per-connection state handed to every event handler
+type wsSession struct {
+	// ctx is cancelled when the connection closes
+	ctx         context.Context
+	conn        *websocket.Conn
+	client      *wsClient // All writes go through the client's queue
+	connID      string
+	userID      int
+	username    string
+	currentRoom string
+	chatService *services.ChatService
+
+	// Kept by the event pipeline: when the account was last checked, and the room last
+	// found accessible and when
+	authCheckedAt time.Time
+	roomAccess    string
+	roomAccessAt  time.Time
+}
+
+// send queues an event for this connection; failures mean the connection is closing
+func (s *wsSession) send(payload interface{}) {
+	if err := s.client.Send(payload); err != nil {
+		utils.LogDebug("send to %s: %v", s.connID, err)
+	}
+}
+
+// eventHandler decodes the payload of an event and handles the decoded request
+type eventHandler struct {
+	decode func(data json.RawMessage) (any, error)
+	handle func(s *wsSession, req any) error
+	// inRoom events act on a room the user must be able to access; see targetRoom
+	inRoom bool
+}
+
+// roomScoped marks the event as acting on a room, which the pipeline checks access to
+func (h *eventHandler) roomScoped() *eventHandler {
+	h.inRoom = true
+	return h
+}
+
+// eventRegistry maps event names to their handlers
+var eventRegistry = map[string]*eventHandler{}
+
+// registerEvent adds a handler for an event name. It is meant to be called from init.
+func registerEvent(name string, h *eventHandler) {
+	if _, exists := eventRegistry[name]; exists {
+		panic("duplicate websocket event handler: " + name)
+	}
+	eventRegistry[name] = h
+}
+
+// typed adapts a handler taking a typed request; the payload is decoded into T. Validation,
+// when T implements models.Validator, is left to the pipeline.
+func typed[T any](fn func(s *wsSession, req *T) error) *eventHandler {
+	return &eventHandler{
+		decode: func(data json.RawMessage) (any, error) {
+			req := new(T)
+			if len(data) > 0 {
+				if err := json.Unmarshal(data, req); err != nil {
+					return nil, err
+				}
+			}
+			return req, nil
+		},
+		handle: func(s *wsSession, req any) error {
+			return fn(s, req.(*T))
+		},
+	}
+}
+
+// HandleMessage decodes a frame and passes it through the event pipeline to the registered
+// handler. Both v2 envelopes ({event, data}) and legacy flat frames are accepted.
+func HandleMessage(s *wsSession, msgType int, msg []byte) {
+	if msgType != websocket.TextMessage {
+		return
+	}
+
+	var env models.WSEnvelope
+	if err := utils.SafeJSONParse(msg, &env); err != nil {
+		utils.LogError(err, "JSON Parse")
+		return
+	}
+
+	data := env.Data
+	if len(data) == 0 {
+		// Legacy flat frame: the event fields live next to "event"
+		data = msg
+	}
+
+	handler, ok := eventRegistry[env.Event]
+	if !ok {
+		log.Printf("Unknown event: %s", env.Event)
+		return
+	}
+
+	ev := &wsEvent{name: env.Event, data: data, handler: handler}
+	err := runEventPipeline(s, ev)
+	if err == nil {
+		err = handler.handle(s, ev.req)
+	}
+	if err != nil && !errors.Is(err, errEventDropped) {
+		out := map[string]interface{}{
+			"event":         "error",
+			"request_event": env.Event,
+			"error":         err.Error(),
+		}
+		if code := eventErrorCode(err); code != "" {
+			out["code"] = code
+		}
+		s.send(out)
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// emailLink builds an absolute link to a public email change endpoint
+func emailLink(baseURL, path, changeID, side string, expiresAt time.Time) (string, error) {
+	token, err := services.EmailChangeToken(changeID, side, expiresAt)
+	if err != nil {
+		return "", err
+	}
+	return baseURL + path + "?token=" + url.QueryEscape(token), nil
+}
+
+// RequestEmailChangeHandler starts an email change. Confirmation links are mailed to the new
+// address and, if the account has one, the current address; both must be followed.
+func RequestEmailChangeHandler(userService *services.UserService, mailer services.Mailer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		username, _ := c.Locals("username").(string)
+
+		var req models.EmailChangeRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		base, err := emailBaseURL()
+		if err != nil {
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "email change is not configured"})
+		}
+
+		ch, err := userService.RequestEmailChange(c.UserContext(), userID, req, ClientIP(c))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrInvalidPassword):
+				return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, services.ErrInvalidEmail):
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, services.ErrEmailInUse):
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to start email change"})
+		}
+
+		newLink, err := emailLink(base, "/api/profile/email/confirm", ch.ID, services.EmailTokenNew, ch.ExpiresAt)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create confirmation link"})
+		}
+		body := fmt.Sprintf("Hi %s,\n\nConfirm that you want to use this address for your account:\n%s\n\nThe link expires at %s.\n",
+			username, newLink, ch.ExpiresAt.UTC().Format(time.RFC1123))
+		utils.LogError(mailer.Send(ch.NewEmail, "Confirm your new email address", body), "Send email change confirmation")
+
+		if ch.OldConfirmedAt == nil && ch.OldEmail != nil {
+			oldLink, err := emailLink(base, "/api/profile/email/confirm", ch.ID, services.EmailTokenOld, ch.ExpiresAt)
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create confirmation link"})
+			}
+			body := fmt.Sprintf("Hi %s,\n\nA request was made to change your account email to %s.\nIf this was you, approve it here:\n%s\n\nIf it wasn't you, ignore this email and change your password.\n",
+				username, ch.NewEmail, oldLink)
+			utils.LogError(mailer.Send(*ch.OldEmail, "Approve your email change", body), "Send email change approval")
+		}
+
+		return c.Status(http.StatusAccepted).JSON(ch)
+	}
+}
+
+// ConfirmEmailChangeHandler is the target of the confirmation links. When the second side
+// confirms the change is applied and the old address gets a rollback link.
+func ConfirmEmailChangeHandler(userService *services.UserService, mailer services.Mailer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Query("token")
+		if token == "" {
+			return c.Status(http.StatusBadRequest).SendString("Missing token")
+		}
+		// Checked before applying the change, which must not happen without its rollback link
+		base, err := emailBaseURL()
+		if err != nil {
+			return c.Status(http.StatusServiceUnavailable).SendString("Email change is not configured.")
+		}
+
+		ch, err := userService.ConfirmEmailChange(c.UserContext(), token, ClientIP(c))
+		if err != nil {
+			if errors.Is(err, services.ErrEmailChangeExpired) {
+				return c.Status(http.StatusGone).SendString("This link has expired or the request was replaced by a newer one.")
+			}
+			if errors.Is(err, services.ErrEmailInUse) {
+				return c.Status(http.StatusConflict).SendString("This email address is now used by another account.")
+			}
+			return c.Status(http.StatusBadRequest).SendString("This link is invalid.")
+		}
+		if ch.AppliedAt == nil {
+			return c.SendString("Thanks, confirmed. The change is applied once the other address confirms too.")
+		}
+
+		if ch.OldEmail != nil && *ch.OldEmail != "" {
+			rollbackLink, err := emailLink(base, "/api/profile/email/rollback", ch.ID, services.EmailTokenRollback, ch.AppliedAt.Add(services.EmailChangeRollbackWindow()))
+			if err != nil {
+				utils.LogError(err, "EmailChangeToken for rollback")
+			} else {
+				body := fmt.Sprintf("Hi %s,\n\nYour account email was changed to %s.\nIf you didn't make this change, restore your previous address within %s:\n%s\n",
+					ch.Username, ch.NewEmail, services.EmailChangeRollbackWindow(), rollbackLink)
+				utils.LogError(mailer.Send(*ch.OldEmail, "Your account email was changed", body), "Send email change rollback link")
+			}
+		}
+
+		Manager.SendToUser(ch.UserID, map[string]interface{}{
+			"event":     "email_changed",
+			"email":     ch.NewEmail,
+			"timestamp": time.Now().UnixMilli(),
+		})
+		return c.SendString("Your email address has been updated.")
+	}
+}
+
+// RollbackEmailChangeHandler restores the previous email during the grace period
+func RollbackEmailChangeHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Query("token")
+		if token == "" {
+			return c.Status(http.StatusBadRequest).SendString("Missing token")
+		}
+
+		ch, err := userService.RollbackEmailChange(c.UserContext(), token, ClientIP(c))
+		if err != nil {
+			if errors.Is(err, services.ErrEmailChangeExpired) {
+				return c.Status(http.StatusGone).SendString("This link has expired or the change was already undone.")
+			}
+			if errors.Is(err, services.ErrEmailInUse) {
+				return c.Status(http.StatusConflict).SendString("Your previous email address is now used by another account.")
+			}
+			return c.Status(http.StatusBadRequest).SendString("This link is invalid.")
+		}
+
+		Manager.SendToUser(ch.UserID, map[string]interface{}{
+			"event":     "email_changed",
+			"email":     ch.OldEmail,
+			"timestamp": time.Now().UnixMilli(),
+		})
+		return c.SendString("Your previous email address has been restored. Consider changing your password.")
+	}
+}
+
+// EmailChangeAuditHandler lists the authenticated user's email change history
+func EmailChangeAuditHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+
+		entries, err := userService.ListEmailChangeAudit(c.UserContext(), userID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load email history"})
+		}
+		return c.JSON(entries)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Errors collects panics and 5xx responses; set in app.go
+var Errors = services.NewErrorReporter(0, time.Minute, nil)
+
+// errorEvent builds an event carrying the request and user context
+func errorEvent(c *fiber.Ctx, kind, message string, status int) models.ErrorEvent {
+	ev := models.ErrorEvent{
+		Kind:      kind,
+		Message:   message,
+		Method:    c.Method(),
+		Path:      c.Path(),
+		Status:    status,
+		IP:        ClientIP(c),
+		Timestamp: time.Now(),
+	}
+	if route := c.Route(); route != nil {
+		ev.Route = route.Path
+	}
+	if uid, ok := c.Locals("user_id").(int); ok {
+		ev.UserID = uid
+	}
+	return ev
+}
+
+// ErrorReportingMiddleware replaces the recover middleware: it turns panics into 500
+// responses and reports them, along with every other 5xx, to Errors
+func ErrorReportingMiddleware(c *fiber.Ctx) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ev := errorEvent(c, "panic", fmt.Sprint(r), http.StatusInternalServerError)
+			ev.Stack = string(debug.Stack())
+			Errors.Report(ev)
+			err = c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+	}()
+
+	err = c.Next()
+
+	status := c.Response().StatusCode()
+	message := ""
+	if err != nil {
+		status = http.StatusInternalServerError
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			status = fe.Code
+		}
+		message = err.Error()
+	} else if status >= 500 {
+		message = errorMessageFromBody(c.Response().Body())
+	}
+	if status >= 500 {
+		Errors.Report(errorEvent(c, "error", message, status))
+	}
+	return err
+}
+
+// errorMessageFromBody extracts the {"error": ...} message handlers respond with
+func errorMessageFromBody(body []byte) string {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Error != "" {
+		return payload.Error
+	}
+	if len(body) > 200 {
+		body = body[:200]
+	}
+	return string(body)
+}
+
+// AdminErrorGroupsHandler lists recent error groups, most recently seen first
+func AdminErrorGroupsHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(Errors.Groups())
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var errInvalidTTL = errors.New("ttl must be a positive number of seconds within the allowed maximum")
+
+// resolveExpiry converts a sender-supplied TTL (seconds) into an absolute expiry time.
+// A zero TTL means the message never expires.
+func resolveExpiry(ttlSeconds int) (*time.Time, error) {
+	if ttlSeconds == 0 {
+		return nil, nil
+	}
+	maxTTL := utils.GetEnvDuration("MESSAGE_MAX_TTL", 7*24*time.Hour)
+	ttl := time.Duration(ttlSeconds) * time.Second
+	if ttlSeconds < 0 || ttl > maxTTL {
+		return nil, errInvalidTTL
+	}
+	expiresAt := time.Now().Add(ttl)
+	return &expiresAt, nil
+}
+
+// GetRoomMessageTTLHandler returns how long messages posted to the room last
+func GetRoomMessageTTLHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ttl, err := chatService.GetRoomMessageTTL(c.UserContext(), c.Params("id"))
+		if err != nil {
+			if errors.Is(err, services.ErrNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "room not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(ttl)
+	}
+}
+
+// UpdateRoomMessageTTLHandler turns disappearing messages on or off (ttl 0) for the room and
+// sends room_message_ttl to everyone viewing it. Owners and admins only; MESSAGE_MAX_TTL
+// bounds the TTL as it does for single messages.
+func UpdateRoomMessageTTLHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.UpdateMessageTTLRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if _, err := resolveExpiry(req.TTL); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		ttl, err := chatService.SetRoomMessageTTL(c.UserContext(), c.Params("id"), c.Locals("user_id").(int), req.TTL, isAppAdmin(c))
+		if err != nil {
+			return roomLockError(c, err)
+		}
+		Manager.Broadcast(ttl.Room, map[string]interface{}{
+			"event": "room_message_ttl",
+			"room":  ttl.Room,
+			"ttl":   ttl.TTL,
+		}, "")
+		return c.JSON(ttl)
+	}
+}
+
+// expiresAtMillis returns the unix ms form of an optional expiry, 0 when unset
+func expiresAtMillis(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// StartExpirySweeper periodically deletes expired messages and tells connected clients to
+// remove them. It stops when ctx is cancelled.
+func StartExpirySweeper(ctx context.Context, chatService *services.ChatService, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sweepExpiredMessages(ctx, chatService)
+			}
+		}
+	}()
+	log.Printf("Message expiry sweeper running every %s", interval)
+}
+
+func sweepExpiredMessages(ctx context.Context, chatService *services.ChatService) {
+	expired, err := chatService.DeleteExpiredMessages(ctx)
+	if err != nil {
+		utils.LogError(err, "DeleteExpiredMessages")
+		return
+	}
+	if len(expired) > 0 {
+		// Unseen messages may have been removed; cached badge totals are recounted on next use
+		Badges.Reset()
+	}
+
+	for _, msg := range expired {
+		event := map[string]interface{}{
+			"event":     "message_expired",
+			"room":      msg.Room,
+			"id":        msg.ID,
+			"timestamp": time.Now().UnixMilli(),
+		}
+		// Viewers of the room remove it from the open conversation
+		Manager.Broadcast(msg.Room, event, "")
+
+		// Other online participants may show it as the room-list preview
+		participants, err := chatService.GetRoomParticipants(ctx, msg.Room)
+		if err != nil {
+			utils.LogError(err, "GetRoomParticipants for expiry")
+			continue
+		}
+		for _, uid := range participants {
+			if Manager.IsUserOnline(uid) && !Manager.IsUserInRoom(uid, msg.Room) {
+				Manager.SendToUser(uid, event)
+			}
+		}
+	}
+}
+
+// StartVoiceCleanup periodically deletes voice files older than maxAge and, when capBytes is
+// positive, the oldest ones until the voices directory fits the cap. Messages are kept and
+// reported with voice_expired instead of a voice_url. It stops when ctx is cancelled.
+func StartVoiceCleanup(ctx context.Context, chatService *services.ChatService, voicesDir string, interval, maxAge time.Duration, capBytes int64) {
+	if interval <= 0 || (maxAge <= 0 && capBytes <= 0) {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if maxAge > 0 {
+					n, err := chatService.ExpireOldVoiceFiles(ctx, int64(maxAge/time.Second))
+					utils.LogError(err, "ExpireOldVoiceFiles")
+					if n > 0 {
+						log.Printf("Voice cleanup removed %d files older than %s", n, maxAge)
+					}
+				}
+				if capBytes > 0 {
+					n, err := chatService.EnforceVoiceStorageCap(ctx, voicesDir, capBytes)
+					utils.LogError(err, "EnforceVoiceStorageCap")
+					if n > 0 {
+						log.Printf("Voice cleanup removed %d files to stay under the storage cap", n)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// StartRetentionPurger periodically deletes messages past their room's retention period.
+// defaultDays of 0 disables the deployment-wide default; per-room overrides still apply.
+func StartRetentionPurger(ctx context.Context, chatService *services.ChatService, interval time.Duration, defaultDays int) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := chatService.PurgeRetainedMessages(ctx, defaultDays)
+				if err != nil {
+					utils.LogError(err, "PurgeRetainedMessages")
+					continue
+				}
+				if len(purged) > 0 {
+					Badges.Reset()
+					log.Printf("Retention purge removed %d messages", len(purged))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxGroupNameLength = 100
+
+// groupError maps group service errors onto HTTP responses
+func groupError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "room or user not found"})
+	case errors.Is(err, services.ErrNotMember):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrNotGroup):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrForbiddenRole):
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrGroupFull), errors.Is(err, services.ErrOwnerMustTransfer):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// groupMaxMembers is the member limit for group rooms (GROUP_MAX_MEMBERS, 0 for none)
+func groupMaxMembers() int {
+	return utils.GetEnvInt("GROUP_MAX_MEMBERS", 256)
+}
+
+// parseGroupName trims a group name and checks its length
+func parseGroupName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	return name, name != "" && len(name) <= maxGroupNameLength
+}
+
+// notifyMembershipChange broadcasts a membership event to the room and also delivers it to the
+// affected user when they aren't viewing the room, so their room list can update
+func notifyMembershipChange(ev *models.MembershipEvent) {
+	if ev == nil {
+		return
+	}
+	broadcastMembershipEvent(ev)
+	if !Manager.IsUserInRoom(ev.UserID, ev.Room) {
+		Manager.SendToUser(ev.UserID, models.WSMessage{
+			Event:     ev.Event,
+			ID:        ev.ID,
+			Room:      ev.Room,
+			Username:  ev.Username,
+			MemberID:  ev.UserID,
+			ActorID:   ev.ActorID,
+			Timestamp: ev.CreatedAt.UnixMilli(),
+		})
+	}
+}
+
+// notifyRoomParticipantsOf sends an event to every participant of a room, viewing it or not
+func notifyRoomParticipantsOf(c *fiber.Ctx, chatService *services.ChatService, roomID string, event map[string]interface{}) {
+	notifyParticipants(c.UserContext(), chatService, roomID, event)
+}
+
+// notifyParticipants is notifyRoomParticipantsOf for background jobs
+func notifyParticipants(ctx context.Context, chatService *services.ChatService, roomID string, event map[string]interface{}) {
+	participants, err := chatService.GetRoomParticipants(ctx, roomID)
+	if err != nil {
+		utils.LogError(err, "GetRoomParticipants for "+event["event"].(string))
+		return
+	}
+	Manager.SendToUsers(participants, event)
+}
+
+// CreateGroupHandler creates a group room owned by the authenticated user
+func CreateGroupHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.CreateGroupRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		name, ok := parseGroupName(req.Name)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name is required (max 100 characters)"})
+		}
+
+		group, events, err := chatService.CreateGroupRoom(c.UserContext(), c.Locals("user_id").(int), name, req.MemberIDs, groupMaxMembers())
+		if err != nil {
+			return groupError(c, err)
+		}
+		for _, ev := range events {
+			notifyMembershipChange(ev)
+		}
+		return c.Status(http.StatusCreated).JSON(group)
+	}
+}
+
+// ListGroupMembersHandler lists the group's members with their roles
+func ListGroupMembersHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		members, err := chatService.ListRoomParticipants(c.UserContext(), c.Params("id"))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to list members"})
+		}
+		return c.JSON(members)
+	}
+}
+
+// AddGroupMemberHandler adds a user to the group (admins and the owner)
+func AddGroupMemberHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.AddParticipantRequest
+		if err := c.BodyParser(&req); err != nil || req.UserID == 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "user_id is required"})
+		}
+		ev, err := chatService.AddParticipant(c.UserContext(), c.Params("id"), c.Locals("user_id").(int), req.UserID, groupMaxMembers())
+		if err != nil {
+			return groupError(c, err)
+		}
+		if ev == nil {
+			return c.SendStatus(http.StatusNoContent) // Already a member
+		}
+		notifyMembershipChange(ev)
+		go welcomeNewMember(chatService, ev, "")
+		return c.Status(http.StatusCreated).JSON(ev)
+	}
+}
+
+// RemoveGroupMemberHandler removes a member; members may remove themselves
+func RemoveGroupMemberHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := strconv.Atoi(c.Params("userId"))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+		}
+		ev, err := chatService.RemoveParticipant(c.UserContext(), c.Params("id"), c.Locals("user_id").(int), userID)
+		if err != nil {
+			return groupError(c, err)
+		}
+		notifyMembershipChange(ev)
+		Badges.Forget(userID)
+		adjustBadge(chatService, userID, 0)
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// RenameGroupHandler renames the group and sends room_renamed to every participant
+func RenameGroupHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.RenameRoomRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		name, ok := parseGroupName(req.Name)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name is required (max 100 characters)"})
+		}
+		roomID := c.Params("id")
+		actorID := c.Locals("user_id").(int)
+		if err := chatService.RenameGroupRoom(c.UserContext(), roomID, actorID, name); err != nil {
+			return groupError(c, err)
+		}
+		notifyRoomParticipantsOf(c, chatService, roomID, map[string]interface{}{
+			"event":     "room_renamed",
+			"room":      roomID,
+			"name":      name,
+			"actor_id":  actorID,
+			"timestamp": time.Now().UnixMilli(),
+		})
+		return c.JSON(fiber.Map{"room_id": roomID, "name": name})
+	}
+}
+
+// SetGroupRoleHandler changes a member's role (owner only) and sends role_changed to participants
+func SetGroupRoleHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := strconv.Atoi(c.Params("userId"))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+		}
+		var req models.SetRoleRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		switch req.Role {
+		case models.RoleOwner, models.RoleAdmin, models.RoleMember:
+		default:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "role must be owner, admin or member"})
+		}
+
+		roomID := c.Params("id")
+		actorID := c.Locals("user_id").(int)
+		if err := chatService.SetParticipantRole(c.UserContext(), roomID, actorID, userID, req.Role); err != nil {
+			return groupError(c, err)
+		}
+		notifyRoomParticipantsOf(c, chatService, roomID, map[string]interface{}{
+			"event":     "role_changed",
+			"room":      roomID,
+			"member_id": userID,
+			"role":      req.Role,
+			"actor_id":  actorID,
+			"timestamp": time.Now().UnixMilli(),
+		})
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+var reapedConnections = metrics.NewCounter("ws_reaped_connections_total", "Connections dropped because the client stopped answering pings")
+
+// wsPingInterval is how often the server pings each client (WS_PING_INTERVAL, 0 disables)
+func wsPingInterval() time.Duration {
+	return utils.GetEnvDuration("WS_PING_INTERVAL", 25*time.Second)
+}
+
+// wsPongTimeout is how long a client may stay silent, pongs included, before its connection
+// is considered dead (WS_PONG_TIMEOUT, 0 disables). Keep it well above WS_PING_INTERVAL.
+func wsPongTimeout() time.Duration {
+	return utils.GetEnvDuration("WS_PONG_TIMEOUT", 60*time.Second)
+}
+
+// keepAlive arms the read deadline of a new connection and moves it on with every pong, so a
+// half-open connection fails its read instead of lingering
+func keepAlive(c *websocket.Conn, client *wsClient) {
+	timeout := wsPongTimeout()
+	if timeout <= 0 {
+		return
+	}
+	_ = c.SetReadDeadline(time.Now().Add(timeout))
+	c.SetPongHandler(func(string) error {
+		client.touch()
+		return c.SetReadDeadline(time.Now().Add(timeout))
+	})
+}
+
+// heardFrom records a frame read from the client and extends its read deadline
+func heardFrom(c *websocket.Conn, client *wsClient) {
+	client.touch()
+	if timeout := wsPongTimeout(); timeout > 0 {
+		_ = c.SetReadDeadline(time.Now().Add(timeout))
+	}
+}
+
+// StartConnectionReaper unregisters connections silent for longer than WS_PONG_TIMEOUT, every
+// interval. Read deadlines normally end such connections; the reaper also catches those
+// whose read loop is stuck, so they stop counting their user as online.
+func StartConnectionReaper(ctx context.Context, chatService *services.ChatService, interval time.Duration) {
+	if interval <= 0 || wsPongTimeout() <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reapStaleConnections(chatService, wsPongTimeout())
+			}
+		}
+	}()
+	log.Printf("Connection reaper running every %s", interval)
+}
+
+func reapStaleConnections(chatService *services.ChatService, timeout time.Duration) {
+	for _, r := range Manager.reapStale(timeout) {
+		reapedConnections.Inc()
+		utils.LogDebug("reaped websocket connection of user %d", r.meta.UserID)
+		r.meta.Client.Close()
+		if r.wentOffline {
+			userWentOffline(chatService, r.meta.UserID, r.meta.Username)
+		}
+	}
+}
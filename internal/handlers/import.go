@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminImportHandler ingests a JSON or CSV message export into an existing room.
+// Multipart form fields:
+// - file: the export
+// - room: target room ID
+// - format: "json" or "csv" (defaults to the file extension)
+// - user_map: optional JSON object mapping export usernames to local usernames
+// - create_missing_users, download_media: "true" to enable
+func AdminImportHandler(importService *services.ImportService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "file is required"})
+		}
+		if err := UploadPolicy.Check(UploadImport, fileHeader); err != nil {
+			return uploadPolicyError(c, err)
+		}
+
+		opts := models.ImportOptions{
+			Room:               c.FormValue("room"),
+			CreateMissingUsers: c.FormValue("create_missing_users") == "true",
+			DownloadMedia:      c.FormValue("download_media") == "true",
+		}
+		if opts.Room == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "room is required"})
+		}
+		if raw := c.FormValue("user_map"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &opts.UserMap); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user_map"})
+			}
+		}
+
+		format := c.FormValue("format")
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), ".")
+		}
+
+		f, err := fileHeader.Open()
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to read uploaded file"})
+		}
+		defer f.Close()
+
+		var records []models.ImportRecord
+		switch format {
+		case "json":
+			records, err = services.ParseImportJSON(f)
+		case "csv":
+			records, err = services.ParseImportCSV(f)
+		default:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "format must be json or csv"})
+		}
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		result, err := importService.Import(c.UserContext(), records, opts)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(result)
+	}
+}
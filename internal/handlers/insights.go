@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultInsightsLimit = 10
+	maxInsightsLimit     = 50
+)
+
+// RoomInsightsHandler returns the room's top reacted messages, most active days and streaks.
+// Query params:
+// - limit: entries per list (default 10, max 50)
+func RoomInsightsHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		limit := c.QueryInt("limit", defaultInsightsLimit)
+		if limit <= 0 || limit > maxInsightsLimit {
+			limit = defaultInsightsLimit
+		}
+
+		insights, err := chatService.GetRoomInsights(c.UserContext(), c.Params("id"), userID, limit)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load room insights"})
+		}
+		for i := range insights.TopReacted {
+			msg := &insights.TopReacted[i].Message
+			if msg.Voice != nil && *msg.Voice != "" && !msg.VoiceExpired {
+				msg.VoiceURL = BuildVoiceURL(c, *msg.Voice)
+			}
+		}
+		return c.JSON(insights)
+	}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// linkPreviewAgents are User-Agent fragments of crawlers that unfurl shared links
+var linkPreviewAgents = []string{
+	"facebookexternalhit", "facebot", "twitterbot", "slackbot", "discordbot", "whatsapp",
+	"telegrambot", "linkedinbot", "skypeuripreview", "applebot", "googlebot", "bingbot",
+	"redditbot", "embedly", "pinterest", "vkshare", "viber", "iframely", "mastodon",
+}
+
+// isLinkPreviewBot reports whether the request comes from a link preview crawler
+func isLinkPreviewBot(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	for _, bot := range linkPreviewAgents {
+		if strings.Contains(ua, bot) {
+			return true
+		}
+	}
+	return false
+}
+
+// invitePage is the minimal page served for invite links; crawlers only read the meta tags
+var invitePage = template.Must(template.New("invite").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<meta property="og:type" content="website">
+<meta property="og:title" content="{{.Title}}">
+<meta property="og:description" content="{{.Description}}">
+<meta property="og:url" content="{{.URL}}">
+{{with .Image}}<meta property="og:image" content="{{.}}">
+{{end}}<meta name="twitter:card" content="summary">
+<meta name="twitter:title" content="{{.Title}}">
+<meta name="twitter:description" content="{{.Description}}">
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Description}}</p>
+{{with .AppURL}}<p><a href="{{.}}">Open in the app</a></p>{{end}}
+</body>
+</html>
+`))
+
+type invitePageData struct {
+	Title, Description, URL, Image, AppURL string
+}
+
+// inviteURL is the public link of an invite, absolute when BASE_URL is set. It is never built
+// from the request's Host header, which the client chooses.
+func inviteURL(code string) string {
+	return utils.GetEnv("BASE_URL", "") + "/invite/" + code
+}
+
+// inviteError maps invite service errors onto HTTP responses
+func inviteError(c *fiber.Ctx, err error, action string) error {
+	switch {
+	case errors.Is(err, services.ErrInviteNotAllowed):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "room or invite not found"})
+	case errors.Is(err, services.ErrNotMember):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrForbiddenRole):
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	utils.LogError(err, action)
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to " + action})
+}
+
+// inviteTTL resolves a requested invite lifetime: nil takes INVITE_TTL, and 0 (never expires)
+// or anything longer is capped at INVITE_MAX_TTL unless that is 0
+func inviteTTL(requested *int) (time.Duration, error) {
+	ttl := utils.GetEnvDuration("INVITE_TTL", 7*24*time.Hour)
+	if requested != nil {
+		if *requested < 0 {
+			return 0, errors.New("ttl must not be negative")
+		}
+		ttl = time.Duration(*requested) * time.Second
+	}
+	if maxTTL := utils.GetEnvDuration("INVITE_MAX_TTL", 30*24*time.Hour); maxTTL > 0 && (ttl <= 0 || ttl > maxTTL) {
+		ttl = maxTTL
+	}
+	return ttl, nil
+}
+
+// inviteAppURL returns INVITE_APP_URL with "{code}" replaced, or "" when not configured
+func inviteAppURL(code string) string {
+	appURL := utils.GetEnv("INVITE_APP_URL", "")
+	if appURL == "" {
+		return ""
+	}
+	return strings.ReplaceAll(appURL, "{code}", code)
+}
+
+// CreateInviteHandler creates an invite link for the room; owners and admins only. Body
+// (optional): {"ttl": seconds}, 0 for the longest lifetime allowed (see inviteTTL); defaults
+// to INVITE_TTL.
+func CreateInviteHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req struct {
+			TTL *int `json:"ttl"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+			}
+		}
+		ttl, err := inviteTTL(req.TTL)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		invite, err := chatService.CreateRoomInvite(c.UserContext(), c.Params("id"), c.Locals("user_id").(int), ttl, isAppAdmin(c))
+		if err != nil {
+			return inviteError(c, err, "create invite")
+		}
+		invite.URL = inviteURL(invite.Code)
+		return c.Status(http.StatusCreated).JSON(invite)
+	}
+}
+
+// ListInvitesHandler lists the room's active invite links to owners and admins
+func ListInvitesHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		invites, err := chatService.ListRoomInvites(c.UserContext(), c.Params("id"), c.Locals("user_id").(int), isAppAdmin(c))
+		if err != nil {
+			return inviteError(c, err, "list invites")
+		}
+		for i := range invites {
+			invites[i].URL = inviteURL(invites[i].Code)
+		}
+		return c.JSON(invites)
+	}
+}
+
+// RevokeInviteHandler deletes an invite link; owners and admins only
+func RevokeInviteHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := chatService.RevokeRoomInvite(c.UserContext(), c.Params("id"), c.Locals("user_id").(int), c.Params("code"), isAppAdmin(c))
+		if err != nil {
+			return inviteError(c, err, "revoke invite")
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// AcceptInviteHandler joins the authenticated user to the invite's room
+func AcceptInviteHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		roomID, ev, err := chatService.AcceptRoomInvite(c.UserContext(), c.Params("code"), userID)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidInvite) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to join room"})
+		}
+		broadcastMembershipEvent(ev)
+		go welcomeNewMember(chatService, ev, "")
+		return c.JSON(models.RoomResponse{RoomID: roomID, IsNew: ev != nil})
+	}
+}
+
+// InvitePageHandler serves GET /invite/:code. Link preview crawlers get a page with OpenGraph
+// tags (room name, member count, inviter photo); people are redirected to INVITE_APP_URL when
+// it is set and see the same page otherwise. Links in the page come from BASE_URL only.
+func InvitePageHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		code := c.Params("code")
+		// The response depends on the User-Agent, so shared caches must keep them apart
+		c.Vary(fiber.HeaderUserAgent)
+		bot := isLinkPreviewBot(c.Get(fiber.HeaderUserAgent))
+		if appURL := inviteAppURL(code); appURL != "" && !bot {
+			return c.Redirect(appURL, http.StatusFound)
+		}
+
+		status := http.StatusOK
+		base := utils.GetEnv("BASE_URL", "")
+		data := invitePageData{
+			URL:    inviteURL(code),
+			Image:  utils.GetEnv("INVITE_OG_IMAGE", ""),
+			AppURL: inviteAppURL(code),
+		}
+		preview, err := chatService.GetInvitePreview(c.UserContext(), code)
+		switch {
+		case err == nil:
+			name := "a chat"
+			if preview.RoomName != nil && *preview.RoomName != "" {
+				name = *preview.RoomName
+			}
+			data.Title = "Join " + name
+			members := strconv.Itoa(preview.MemberCount) + " members"
+			if preview.MemberCount == 1 {
+				members = "1 member"
+			}
+			data.Description = members
+			if preview.Inviter != "" {
+				data.Description = preview.Inviter + " invited you · " + members
+			}
+			// og:image must be absolute; a relative photo URL needs BASE_URL
+			if preview.AvatarURL != "" && (base != "" || !strings.HasPrefix(preview.AvatarURL, "/")) {
+				data.Image = preview.AvatarURL
+				if strings.HasPrefix(data.Image, "/") {
+					data.Image = base + data.Image
+				}
+			}
+		case errors.Is(err, services.ErrInvalidInvite):
+			status = http.StatusNotFound
+			data.Title = "Invite not found"
+			data.Description = err.Error()
+			data.AppURL = ""
+		default:
+			utils.LogError(err, "GetInvitePreview")
+			return c.Status(http.StatusInternalServerError).SendString("failed to load invite")
+		}
+
+		var buf bytes.Buffer
+		if err := invitePage.Execute(&buf, data); err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		c.Type("html", "utf-8")
+		return c.Status(status).Send(buf.Bytes())
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInviteTTL(t *testing.T) {
+	t.Setenv("INVITE_TTL", "")
+	t.Setenv("INVITE_MAX_TTL", "")
+	seconds := func(n int) *int { return &n }
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name      string
+		maxTTL    string
+		requested *int
+		want      time.Duration
+		wantErr   bool
+	}{
+		{"default", "", nil, 7 * day, false},
+		{"requested", "", seconds(3600), time.Hour, false},
+		{"never expires is capped", "", seconds(0), 30 * day, false},
+		{"too long is capped", "", seconds(365 * 86400), 30 * day, false},
+		{"negative", "", seconds(-1), 0, true},
+		{"no cap", "0", seconds(0), 0, false},
+		{"lower cap", "24h", nil, day, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INVITE_MAX_TTL", tt.maxTTL)
+			got, err := inviteTTL(tt.requested)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("inviteTTL = %s, %v; want %s, error %t", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
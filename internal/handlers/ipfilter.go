@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var blockedRequests = metrics.NewCounterVec("http_blocked_requests_total", "Requests rejected by the IP/geo filter", "reason")
+
+// CountryResolver maps a request to an ISO 3166 alpha-2 country code ("" if unknown)
+type CountryResolver interface {
+	Country(c *fiber.Ctx) string
+}
+
+// HeaderCountryResolver reads the country set by an upstream proxy/CDN (e.g. CF-IPCountry).
+// The header is ignored unless the request comes from one of TRUSTED_PROXIES.
+type HeaderCountryResolver struct {
+	Header string
+}
+
+func (r HeaderCountryResolver) Country(c *fiber.Ctx) string {
+	if !fromTrustedProxy(c) {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSpace(c.Get(r.Header)))
+}
+
+// IPFilterConfig is the runtime-editable filter configuration
+type IPFilterConfig struct {
+	Allow            []string `json:"allow"`             // IPs or CIDRs; empty allows everyone not denied
+	Deny             []string `json:"deny"`              // IPs or CIDRs
+	BlockedCountries []string `json:"blocked_countries"` // ISO alpha-2 codes
+}
+
+// IPFilter rejects requests by client IP and country before any other processing
+type IPFilter struct {
+	mu        sync.RWMutex
+	config    IPFilterConfig
+	allow     []*net.IPNet
+	deny      []*net.IPNet
+	countries map[string]bool
+	resolver  CountryResolver
+}
+
+// IPFilterInstance is the process-wide filter, initialised from env by InitIPFilter
+var IPFilterInstance = &IPFilter{}
+
+// InitIPFilter loads IP_ALLOWLIST, IP_DENYLIST and GEO_BLOCKED_COUNTRIES (comma separated).
+// Country lookups use the header named by GEOIP_COUNTRY_HEADER, as sent by TRUSTED_PROXIES;
+// InitClientIP must have run.
+func InitIPFilter() error {
+	if header := utils.GetEnv("GEOIP_COUNTRY_HEADER", ""); header != "" {
+		if len(clientIPConfig.proxies) == 0 {
+			log.Printf("Warning: GEOIP_COUNTRY_HEADER is ignored without TRUSTED_PROXIES")
+		}
+		IPFilterInstance.resolver = HeaderCountryResolver{Header: header}
+	}
+	return IPFilterInstance.Update(ipFilterConfigFromEnv())
+}
+
+// ipFilterConfigFromEnv reads IP_ALLOWLIST, IP_DENYLIST and GEO_BLOCKED_COUNTRIES
+func ipFilterConfigFromEnv() IPFilterConfig {
+	split := func(key string) []string {
+		var out []string
+		for _, v := range strings.Split(utils.GetEnv(key, ""), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+		return out
+	}
+	return IPFilterConfig{
+		Allow:            split("IP_ALLOWLIST"),
+		Deny:             split("IP_DENYLIST"),
+		BlockedCountries: split("GEO_BLOCKED_COUNTRIES"),
+	}
+}
+
+func parseNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, e := range entries {
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", e)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", e)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Update atomically replaces the filter lists. Invalid entries reject the whole update.
+func (f *IPFilter) Update(cfg IPFilterConfig) error {
+	allow, err := parseNets(cfg.Allow)
+	if err != nil {
+		return err
+	}
+	deny, err := parseNets(cfg.Deny)
+	if err != nil {
+		return err
+	}
+	countries := make(map[string]bool, len(cfg.BlockedCountries))
+	for i, cc := range cfg.BlockedCountries {
+		cc = strings.ToUpper(strings.TrimSpace(cc))
+		cfg.BlockedCountries[i] = cc
+		countries[cc] = true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.config = cfg
+	f.allow = allow
+	f.deny = deny
+	f.countries = countries
+	return nil
+}
+
+// Config returns the current filter lists
+func (f *IPFilter) Config() IPFilterConfig {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.config
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the block reason, or "" if the request may proceed
+func (f *IPFilter) check(c *fiber.Ctx) string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	ip := net.ParseIP(ClientIP(c))
+	if ip == nil && (len(f.deny) > 0 || len(f.allow) > 0) {
+		// Fail closed: an address that can't be matched can't be allowed either
+		return "invalid_ip"
+	}
+	if containsIP(f.deny, ip) {
+		return "denylist"
+	}
+	if len(f.allow) > 0 && !containsIP(f.allow, ip) {
+		return "not_allowlisted"
+	}
+	if len(f.countries) > 0 && f.resolver != nil {
+		if cc := f.resolver.Country(c); cc != "" && f.countries[cc] {
+			return "country"
+		}
+	}
+	return ""
+}
+
+// IPFilterMiddleware must be registered before authentication
+func IPFilterMiddleware(c *fiber.Ctx) error {
+	if reason := IPFilterInstance.check(c); reason != "" {
+		blockedRequests.Inc(reason)
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
+	}
+	return c.Next()
+}
+
+// AdminGetIPFilterHandler returns the active allow/deny/country lists
+func AdminGetIPFilterHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(IPFilterInstance.Config())
+	}
+}
+
+// AdminUpdateIPFilterHandler replaces the lists at runtime (not persisted across restarts)
+func AdminUpdateIPFilterHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var cfg IPFilterConfig
+		if err := c.BodyParser(&cfg); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if err := IPFilterInstance.Update(cfg); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(IPFilterInstance.Config())
+	}
+}
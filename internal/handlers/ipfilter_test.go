@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// useTrustedProxies configures ClientIP for the duration of the test
+func useTrustedProxies(t *testing.T, header, trusted string) {
+	saved := clientIPConfig
+	t.Cleanup(func() { clientIPConfig = saved })
+	if _, err := InitClientIP(header, trusted); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// requestFrom runs handler for a request from the peer remote with the given headers
+func requestFrom(handler fasthttp.RequestHandler, remote string, headers map[string]string) *fasthttp.RequestCtx {
+	var req fasthttp.Request
+	req.SetRequestURI("/api/login")
+	req.Header.SetMethod(fiber.MethodPost)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, &net.TCPAddr{IP: net.ParseIP(remote), Port: 40000}, nil)
+	handler(&ctx)
+	return &ctx
+}
+
+func TestClientIP(t *testing.T) {
+	useTrustedProxies(t, "X-Forwarded-For", "10.0.0.0/8")
+	app := fiber.New()
+	app.Post("/api/login", func(c *fiber.Ctx) error { return c.SendString(ClientIP(c)) })
+	handler := app.Handler()
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"direct client", "203.0.113.5", "", "203.0.113.5"},
+		{"header from an untrusted peer", "203.0.113.5", "198.51.100.7", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.2", "198.51.100.7", "198.51.100.7"},
+		{"forged hop before the client", "10.0.0.2", "1.2.3.4, 198.51.100.7", "198.51.100.7"},
+		{"chain of trusted proxies", "10.0.0.2", "198.51.100.7, 10.0.0.9", "198.51.100.7"},
+		{"malformed hop", "10.0.0.2", "198.51.100.7, not-an-ip", "10.0.0.2"},
+		{"trusted proxy without the header", "10.0.0.2", "", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.xff != "" {
+				headers["X-Forwarded-For"] = tt.xff
+			}
+			ctx := requestFrom(handler, tt.remote, headers)
+			if got := string(ctx.Response.Body()); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPFilterCheck(t *testing.T) {
+	useTrustedProxies(t, "X-Forwarded-For", "10.0.0.1")
+	f := &IPFilter{resolver: HeaderCountryResolver{Header: "CF-IPCountry"}}
+	if err := f.Update(IPFilterConfig{Allow: []string{"198.51.100.0/24"}, Deny: []string{"198.51.100.66"}, BlockedCountries: []string{"xx"}}); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Post("/api/login", func(c *fiber.Ctx) error { return c.SendString(f.check(c)) })
+	handler := app.Handler()
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"allowlisted", "198.51.100.7", nil, ""},
+		{"denylisted", "198.51.100.66", nil, "denylist"},
+		{"not allowlisted", "203.0.113.5", nil, "not_allowlisted"},
+		{"forged header from an untrusted peer", "203.0.113.5", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "not_allowlisted"},
+		{"forwarded by the trusted proxy", "10.0.0.1", map[string]string{"X-Forwarded-For": "198.51.100.7"}, ""},
+		{"country from the trusted proxy", "10.0.0.1", map[string]string{"X-Forwarded-For": "198.51.100.7", "CF-IPCountry": "xx"}, "country"},
+		{"country from an untrusted peer", "198.51.100.7", map[string]string{"CF-IPCountry": "xx"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := requestFrom(handler, tt.remote, tt.headers)
+			if got := string(ctx.Response.Body()); got != tt.want {
+				t.Errorf("check = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// broadcastMembershipEvent sends a member_added / member_removed event to everyone viewing the room
+func broadcastMembershipEvent(ev *models.MembershipEvent) {
+	if ev == nil {
+		return
+	}
+	Manager.Broadcast(ev.Room, models.WSMessage{
+		Event:     ev.Event,
+		ID:        ev.ID,
+		Room:      ev.Room,
+		Username:  ev.Username,
+		MemberID:  ev.UserID,
+		ActorID:   ev.ActorID,
+		Timestamp: ev.CreatedAt.UnixMilli(),
+	}, "")
+}
+
+// membershipHistoryItem converts a membership event to a history entry
+func membershipHistoryItem(ev models.MembershipEvent, viewerID int) models.ChatHistoryItem {
+	return models.ChatHistoryItem{
+		ID:            ev.ID,
+		Event:         ev.Event,
+		Room:          ev.Room,
+		Username:      ev.Username,
+		Timestamp:     ev.CreatedAt.UnixMilli(),
+		IsYourMessage: ev.UserID == viewerID,
+		MemberID:      ev.UserID,
+		ActorID:       ev.ActorID,
+	}
+}
+
+// mergeMembershipHistory interleaves membership events into chat history by timestamp.
+// Only events at or after the first history item are included so the window stays consistent.
+func mergeMembershipHistory(history []models.ChatHistoryItem, events []models.MembershipEvent, viewerID int) []models.ChatHistoryItem {
+	if len(events) == 0 {
+		return history
+	}
+	merged := make([]models.ChatHistoryItem, 0, len(history)+len(events))
+	i := 0
+	for _, item := range history {
+		for i < len(events) && events[i].CreatedAt.UnixMilli() <= item.Timestamp {
+			merged = append(merged, membershipHistoryItem(events[i], viewerID))
+			i++
+		}
+		merged = append(merged, item)
+	}
+	for ; i < len(events); i++ {
+		merged = append(merged, membershipHistoryItem(events[i], viewerID))
+	}
+	return merged
+}
+
+// MembershipHistoryHandler returns who joined and left a room and when.
+// Query param since: unix timestamp (s or ms) or RFC3339, optional.
+func MembershipHistoryHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		roomID := c.Params("id")
+
+		ok, err := chatService.IsRoomParticipant(c.UserContext(), roomID, userID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check room membership"})
+		}
+		if !ok {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "not a participant of this room"})
+		}
+
+		since, err := parseTimeParam(c.Query("since"))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid since"})
+		}
+		var from time.Time
+		if since != nil {
+			from = *since
+		}
+
+		events, err := chatService.GetMembershipEvents(c.UserContext(), roomID, from)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load membership history"})
+		}
+		if events == nil {
+			events = []models.MembershipEvent{}
+		}
+		return c.JSON(events)
+	}
+}
+
+// LeaveRoomHandler removes the authenticated user from a room
+func LeaveRoomHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		roomID := c.Params("id")
+
+		ev, err := chatService.RemoveRoomMember(c.UserContext(), roomID, userID, nil)
+		if err != nil {
+			if errors.Is(err, services.ErrNotMember) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			}
+			if errors.Is(err, services.ErrOwnerMustTransfer) {
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to leave room"})
+		}
+
+		broadcastMembershipEvent(ev)
+		Badges.Forget(userID)
+		adjustBadge(chatService, userID, 0)
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"chat-backend/internal/models"
+)
+
+// Delivery is one fan-out recorded by MemoryRooms
+type Delivery struct {
+	Kind       string      `json:"kind"` // clusterRoom, clusterUser or clusterAll
+	Room       string      `json:"room,omitempty"`
+	UserID     int         `json:"user_id,omitempty"`
+	Exclude    string      `json:"exclude,omitempty"`
+	Payload    interface{} `json:"payload"`
+	Recipients []int       `json:"recipients"` // Connected users it reached, ascending
+}
+
+// PresenceTransition is a user coming online or going offline in MemoryRooms
+type PresenceTransition struct {
+	UserID int       `json:"user_id"`
+	Online bool      `json:"online"`
+	At     time.Time `json:"at"`
+}
+
+type memoryConn struct {
+	userID   int
+	username string
+	client   *wsClient
+}
+
+// MemoryRooms is a Rooms that keeps connections as plain records and logs every delivery
+// in call order instead of writing to sockets. It ignores the cluster bus and long-polling,
+// so what it reports depends only on the calls made to it and the package clock.
+type MemoryRooms struct {
+	mu          sync.Mutex
+	conns       map[string]memoryConn
+	rooms       map[string]map[string]bool
+	deliveries  []Delivery
+	transitions []PresenceTransition
+	calls       callTracker
+}
+
+func NewMemoryRooms() *MemoryRooms {
+	return &MemoryRooms{
+		conns: make(map[string]memoryConn),
+		rooms: make(map[string]map[string]bool),
+	}
+}
+
+// Deliveries returns the recorded deliveries, oldest first
+func (m *MemoryRooms) Deliveries() []Delivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.deliveries)
+}
+
+// Received returns the payloads that reached userID, oldest first
+func (m *MemoryRooms) Received(userID int) []interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var payloads []interface{}
+	for _, d := range m.deliveries {
+		if _, ok := slices.BinarySearch(d.Recipients, userID); ok {
+			payloads = append(payloads, d.Payload)
+		}
+	}
+	return payloads
+}
+
+// Transitions returns the recorded presence changes, oldest first
+func (m *MemoryRooms) Transitions() []PresenceTransition {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.transitions)
+}
+
+// Reset forgets recorded deliveries and transitions but keeps connections
+func (m *MemoryRooms) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries, m.transitions = nil, nil
+}
+
+// userConnected reports whether userID has a connection; m.mu must be held
+func (m *MemoryRooms) userConnected(userID int) bool {
+	for _, conn := range m.conns {
+		if conn.userID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// record appends a delivery to the users of conns other than exclude; m.mu must be held
+func (m *MemoryRooms) record(d Delivery, conns func(connID string) bool) {
+	for connID, conn := range m.conns {
+		if connID != d.Exclude && conns(connID) && !slices.Contains(d.Recipients, conn.userID) {
+			d.Recipients = append(d.Recipients, conn.userID)
+		}
+	}
+	slices.Sort(d.Recipients)
+	m.deliveries = append(m.deliveries, d)
+}
+
+func (m *MemoryRooms) Join(room string, connID string, c *wsClient, userID int, username string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.conns[connID]; !ok {
+		if !m.userConnected(userID) {
+			m.transitions = append(m.transitions, PresenceTransition{UserID: userID, Online: true, At: clock.Now()})
+		}
+		m.conns[connID] = memoryConn{userID: userID, username: username, client: c}
+	}
+	if m.rooms[room] == nil {
+		m.rooms[room] = make(map[string]bool)
+	}
+	m.rooms[room][connID] = true
+}
+
+func (m *MemoryRooms) Leave(room string, connID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.rooms[room], connID)
+	if len(m.rooms[room]) == 0 {
+		delete(m.rooms, room)
+	}
+}
+
+func (m *MemoryRooms) RegisterConnection(connID string, userID int, username string, client *wsClient) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wasOnline := m.userConnected(userID)
+	m.conns[connID] = memoryConn{userID: userID, username: username, client: client}
+	if !wasOnline {
+		m.transitions = append(m.transitions, PresenceTransition{UserID: userID, Online: true, At: clock.Now()})
+	}
+	return !wasOnline
+}
+
+func (m *MemoryRooms) UnregisterConnection(connID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conn, ok := m.conns[connID]
+	if !ok {
+		return false
+	}
+	delete(m.conns, connID)
+	for room, conns := range m.rooms {
+		delete(conns, connID)
+		if len(conns) == 0 {
+			delete(m.rooms, room)
+		}
+	}
+	if m.userConnected(conn.userID) {
+		return false
+	}
+	m.transitions = append(m.transitions, PresenceTransition{UserID: conn.userID, Online: false, At: clock.Now()})
+	return true
+}
+
+func (m *MemoryRooms) Broadcast(room string, message interface{}, excludeConnID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.record(Delivery{Kind: clusterRoom, Room: room, Exclude: excludeConnID, Payload: message}, func(connID string) bool {
+		return m.rooms[room][connID]
+	})
+}
+
+func (m *MemoryRooms) broadcastLocal(room string, b []byte, excludeConnID string, messageID int) {
+	m.Broadcast(room, json.RawMessage(b), excludeConnID)
+}
+
+func (m *MemoryRooms) BroadcastToAll(message interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.record(Delivery{Kind: clusterAll, Payload: message}, func(connID string) bool {
+		for _, conns := range m.rooms {
+			if conns[connID] {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (m *MemoryRooms) broadcastAllLocal(b []byte) {
+	m.BroadcastToAll(json.RawMessage(b))
+}
+
+func (m *MemoryRooms) sendAllLocal(message interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.record(Delivery{Kind: clusterAll, Payload: message}, func(string) bool { return true })
+}
+
+func (m *MemoryRooms) SendToUser(userID int, message interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.record(Delivery{Kind: clusterUser, UserID: userID, Payload: message}, func(connID string) bool {
+		return m.conns[connID].userID == userID
+	})
+}
+
+func (m *MemoryRooms) sendToUserLocal(userID int, message interface{}, deliveryID string, messageID int) {
+	m.SendToUser(userID, message)
+}
+
+func (m *MemoryRooms) SendToUsers(userIDs []int, message interface{}) {
+	for _, userID := range userIDs {
+		m.SendToUser(userID, message)
+	}
+}
+
+func (m *MemoryRooms) IsUserOnline(userID int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.userConnected(userID)
+}
+
+func (m *MemoryRooms) userActiveLocal(userID int) bool {
+	return m.IsUserOnline(userID) && !Activity.away(userID)
+}
+
+func (m *MemoryRooms) IsUserInRoom(userID int, roomID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for connID := range m.rooms[roomID] {
+		if m.conns[connID].userID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUserCurrentRoom returns the alphabetically first room userID views, so it is deterministic
+func (m *MemoryRooms) GetUserCurrentRoom(userID int) string {
+	_, rooms := m.localPresence(userID)
+	if len(rooms) == 0 {
+		return ""
+	}
+	return rooms[0]
+}
+
+func (m *MemoryRooms) GetConnectionsByUserID(userID int) []*wsClient {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var clients []*wsClient
+	for _, conn := range m.conns {
+		if conn.userID == userID && conn.client != nil {
+			clients = append(clients, conn.client)
+		}
+	}
+	return clients
+}
+
+func (m *MemoryRooms) CountUserConnections(userID int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, conn := range m.conns {
+		if conn.userID == userID {
+			n++
+		}
+	}
+	return n
+}
+
+// localPresence lists the rooms userID views in ascending order
+func (m *MemoryRooms) localPresence(userID int) (bool, []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rooms []string
+	for room, conns := range m.rooms {
+		for connID := range conns {
+			if m.conns[connID].userID == userID && !slices.Contains(rooms, room) {
+				rooms = append(rooms, room)
+			}
+		}
+	}
+	slices.Sort(rooms)
+	return m.userConnected(userID), rooms
+}
+
+func (m *MemoryRooms) presenceSnapshot() map[int][]string {
+	m.mu.Lock()
+	users := make(map[int][]string)
+	for _, conn := range m.conns {
+		users[conn.userID] = nil
+	}
+	m.mu.Unlock()
+	for userID := range users {
+		_, users[userID] = m.localPresence(userID)
+		if users[userID] == nil {
+			users[userID] = []string{}
+		}
+	}
+	return users
+}
+
+func (m *MemoryRooms) Stats() ManagerStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := make(map[int]bool)
+	for _, conn := range m.conns {
+		users[conn.userID] = true
+	}
+	return ManagerStats{Connections: len(m.conns), OnlineUsers: len(users), ActiveRooms: len(m.rooms)}
+}
+
+// Shutdown does nothing; there are no sockets to close
+func (m *MemoryRooms) Shutdown(hints ReconnectHints) {}
+
+// reapStale never reaps; connections without a socket can't go silent
+func (m *MemoryRooms) reapStale(timeout time.Duration) []reapedConn {
+	return nil
+}
+
+// Calls are tracked like RoomManager does, without the cluster bus
+func (m *MemoryRooms) StartCall(call models.Call) error { return m.calls.start(call) }
+
+func (m *MemoryRooms) AnswerCall(callID string, userID int) (models.Call, error) {
+	return m.calls.answer(callID, userID)
+}
+
+func (m *MemoryRooms) GetCall(callID string) (models.Call, bool) { return m.calls.get(callID) }
+
+func (m *MemoryRooms) EndCall(callID string) (models.Call, bool) { return m.calls.end(callID) }
+
+func (m *MemoryRooms) UserCalls(userID int) []models.Call { return m.calls.ofUser(userID) }
+
+func (m *MemoryRooms) applyCallLocal(call models.Call, ended bool) { m.calls.apply(call, ended) }
+
+var _ Rooms = (*MemoryRooms)(nil)
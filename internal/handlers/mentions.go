@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+)
+
+// saveMentions records the participants @mentioned in a message's text
+func saveMentions(s *wsSession, msg *models.Message, text string) []models.Mention {
+	mentions, err := s.chatService.SaveMentions(s.ctx, msg.ID, msg.Room, s.userID, services.ParseMentions(text))
+	if err != nil {
+		utils.LogError(err, "SaveMentions")
+		return nil
+	}
+	return mentions
+}
+
+// mentionedUserIDs lists the users of mentions
+func mentionedUserIDs(mentions []models.Mention) []int {
+	ids := make([]int, 0, len(mentions))
+	for _, m := range mentions {
+		ids = append(ids, m.UserID)
+	}
+	return ids
+}
+
+// notifyMentions sends a "mention" event to every mentioned user who is online, whichever
+// room they are viewing (including this one), and a push to those who are offline. Mentions
+// are notified even when the room is muted; the message's own new_message notification
+// skips them (see notifyRoomParticipantsExcept). The mention row of the user's notification
+// matrix decides which channels are used.
+func notifyMentions(chatService *services.ChatService, roomID string, messageID int, senderID int, senderUsername string, messageText string, timestamp int64, mentions []models.Mention) {
+	if len(mentions) == 0 || !services.IsContentEvent("mention") {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userIDs := mentionedUserIDs(mentions)
+	prefs, err := chatService.GetNotificationPrefs(ctx, userIDs)
+	if err != nil {
+		utils.LogError(err, "GetNotificationPrefs")
+		prefs = map[int]models.NotificationPrefs{}
+	}
+
+	data := services.NotificationData{Sender: senderUsername, Text: messageText, RoomID: roomID}
+	for _, userID := range userIDs {
+		p, ok := prefs[userID]
+		if !ok {
+			p = models.NotificationPrefs{Language: "en", MessagePreview: true}
+		}
+
+		if Manager.IsUserOnline(userID) {
+			if !p.Matrix.Allows("mention", models.ChannelWS) {
+				continue
+			}
+			notification := map[string]interface{}{
+				"event":           "mention",
+				"room":            roomID,
+				"message_id":      messageID,
+				"sender_id":       senderID,
+				"sender_username": senderUsername,
+				"timestamp":       timestamp,
+			}
+			if messageText != "" && p.MessagePreview {
+				notification["text"] = messageText
+			}
+			if Notifications != nil {
+				notification["notification"] = Notifications.Render("mention", p.Language, p.MessagePreview, data)
+			}
+			if token, err := services.GenerateNotificationActionToken(userID, roomID, messageID); err == nil {
+				notification["action_token"] = token
+			}
+			Manager.SendToUser(userID, notification)
+			continue
+		}
+
+		if Push == nil || !p.Matrix.Allows("mention", models.ChannelPush) {
+			continue
+		}
+		push := services.PushNotification{
+			Title: senderUsername,
+			Data: map[string]string{
+				"event":      "mention",
+				"room":       roomID,
+				"message_id": strconv.Itoa(messageID),
+				"sender_id":  strconv.Itoa(senderID),
+				"type":       "mention",
+			},
+		}
+		if Notifications != nil {
+			rendered := Notifications.Render("mention", p.Language, p.MessagePreview, data)
+			push.Title, push.Body, push.CollapseKey = rendered.Title, rendered.Body, rendered.CollapseKey
+		} else if p.MessagePreview {
+			push.Body = messageText
+		}
+		if token, err := services.GenerateNotificationActionToken(userID, roomID, messageID); err == nil {
+			push.Data["action_token"] = token
+		}
+		Push.Enqueue(userID, messageID, push, undoSendWindow())
+	}
+}
@@ -2,8 +2,8 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"time"
 
 	"chat-backend/internal/models"
@@ -18,11 +18,14 @@ func buildVoiceURLFromWS(c *websocket.Conn, filename string) string {
 	if filename == "" {
 		return ""
 	}
+	if u := services.UploadURL("voices/" + filename); u != "" {
+		return u
+	}
 
 	// Try to get base URL from env first
 	baseURL := utils.GetEnv("BASE_URL", "")
 	if baseURL != "" {
-		return fmt.Sprintf("%s/uploads/voices/%s", baseURL, filename)
+		return baseURL + services.UploadPath("voices/"+filename)
 	}
 
 	// Extract host from WebSocket connection's underlying request
@@ -30,60 +33,37 @@ func buildVoiceURLFromWS(c *websocket.Conn, filename string) string {
 	host := c.Locals("host")
 	if host == nil || host == "" {
 		// Fallback to a default if host not available
-		return fmt.Sprintf("/uploads/voices/%s", filename)
+		return services.UploadPath("voices/" + filename)
 	}
 
 	// Assume http by default for WebSocket-originated URLs
 	// In production, you should configure BASE_URL
-	return fmt.Sprintf("http://%s/uploads/voices/%s", host, filename)
+	return fmt.Sprintf("http://%s%s", host, services.UploadPath("voices/"+filename))
 }
 
-func HandleMessage(c *websocket.Conn, msgType int, msg []byte, chatService *services.ChatService, userID int, username string, currentRoom *string, connID string) {
-	if msgType != websocket.TextMessage {
-		return
-	}
-
-	var wsMsg models.WSMessage
-	if err := utils.SafeJSONParse(msg, &wsMsg); err != nil {
-		utils.LogError(err, "JSON Parse")
-		return
-	}
-
-	// Override username with authenticated user
-	wsMsg.Username = username
-	wsMsg.Timestamp = time.Now().UnixMilli()
-
-	switch wsMsg.Event {
-	case "join":
-		handleJoin(c, &wsMsg, userID, username, currentRoom, chatService, connID)
-	case "leave":
-		handleLeave(c, &wsMsg, currentRoom, connID)
-	case "chat":
-		handleChat(c, &wsMsg, userID, username, *currentRoom, chatService)
-	case "seen":
-		handleSeen(c, &wsMsg, userID, username, *currentRoom, chatService)
-	case "list":
-		handleList(c, &wsMsg, userID, chatService)
-	default:
-		log.Printf("Unknown event: %s", wsMsg.Event)
-	}
+func init() {
+	registerEvent("join", typed(handleJoin).roomScoped())
+	registerEvent("leave", typed(handleLeave))
+	registerEvent("chat", typed(handleChat).roomScoped())
+	registerEvent("edit", typed(handleEditMessage))
+	registerEvent("delete", typed(handleDeleteMessage))
+	registerEvent("retract", typed(handleRetractMessage))
+	registerEvent("seen", typed(handleSeen).roomScoped())
+	registerEvent("seen_all", typed(handleSeenAll))
+	registerEvent("ack_read", typed(handleAckRead))
+	registerEvent("list", typed(handleList))
+	registerEvent("thread", typed(handleThread))
+	registerEvent("activity", typed(handleActivity))
 }
 
-func handleSeen(c *websocket.Conn, msg *models.WSMessage, userID int, username string, currentRoom string, chatService *services.ChatService) {
+func handleSeen(s *wsSession, msg *models.SeenRequest) error {
 	// msg.Timestamp is expected from client. Accept seconds or milliseconds.
-	if currentRoom == "" && msg.Room == "" {
-		// Unknown room, ignore
-		return
-	}
-	roomID := currentRoom
-	if roomID == "" {
-		roomID = msg.Room
-	}
+	roomID := targetRoom(s, msg)
 
 	// Normalize timestamp
 	ts := msg.Timestamp
 	if ts == 0 {
-		return
+		return nil
 	}
 	// If timestamp looks like seconds (less than 1e12), convert to milliseconds
 	if ts < 1_000_000_000_000 {
@@ -92,134 +72,262 @@ func handleSeen(c *websocket.Conn, msg *models.WSMessage, userID int, username s
 
 	seenBefore := time.UnixMilli(ts)
 
-	ctx := context.Background()
-	updated, err := chatService.MarkMessagesSeen(ctx, roomID, userID, seenBefore)
+	// With batching the write, receipt and badge update happen when the batch is flushed
+	if SeenBatch != nil && SeenBatch.Add(roomID, s.userID, s.username, seenBefore, msg.Timestamp) {
+		s.send(models.WSMessage{
+			Event:     "seen_successful",
+			Room:      roomID,
+			Timestamp: msg.Timestamp,
+			Username:  s.username,
+		})
+		return nil
+	}
+
+	updated, err := s.chatService.MarkMessagesSeen(s.ctx, roomID, s.userID, seenBefore)
 	if err != nil {
 		utils.LogError(err, "MarkMessagesSeen")
 		// Inform client of failure
-		utils.SendJSON(c, map[string]interface{}{
+		s.send(map[string]interface{}{
 			"event":   "seen_failed",
 			"room":    roomID,
 			"error":   err.Error(),
 			"updated": 0,
 		})
-		return
+		return nil
 	}
 
 	// Respond success to sender
-	utils.SendJSON(c, models.WSMessage{
+	s.send(models.WSMessage{
 		Event:     "seen_successful",
 		Room:      roomID,
 		Timestamp: msg.Timestamp,
-		Username:  username,
+		Username:  s.username,
 	})
 
 	// Broadcast to other participants that messages were seen by this user
+	broadcastMessagesSeen(roomID, s.userID, s.username, msg.Timestamp, updated)
+	if updated > 0 {
+		adjustBadge(s.chatService, s.userID, -updated)
+	}
+	return nil
+}
+
+func handleSeenAll(s *wsSession, _ *models.SeenAllRequest) error {
+	counts, err := markAllRead(s.ctx, s.chatService, s.userID, s.username)
+	if err != nil {
+		utils.LogError(err, "MarkAllRoomsSeen")
+		return fmt.Errorf("failed to mark rooms as seen")
+	}
+
+	s.send(map[string]interface{}{
+		"event":     "seen_all_successful",
+		"rooms":     counts,
+		"timestamp": time.Now().UnixMilli(),
+	})
+	return nil
+}
+
+// handleAckRead marks several rooms as read up to a message id in one write, replies with a
+// single ack_read_successful and sends one messages_seen per updated room
+func handleAckRead(s *wsSession, msg *models.AckReadRequest) error {
+	// Keep the highest seq per room
+	upTo := make(map[string]int, len(msg.Acks))
+	order := make([]string, 0, len(msg.Acks))
+	for _, a := range msg.Acks {
+		if prev, ok := upTo[a.Room]; !ok {
+			order = append(order, a.Room)
+		} else if prev >= a.UpToSeq {
+			continue
+		}
+		upTo[a.Room] = a.UpToSeq
+	}
+	acks := make([]models.ReadAck, len(order))
+	for i, room := range order {
+		acks[i] = models.ReadAck{Room: room, UpToSeq: upTo[room]}
+	}
+
+	counts, err := s.chatService.MarkMessagesReadUpTo(s.ctx, s.userID, acks)
+	if err != nil {
+		utils.LogError(err, "MarkMessagesReadUpTo")
+		return fmt.Errorf("failed to mark rooms as read")
+	}
+
+	now := time.Now().UnixMilli()
+	results := make([]models.ReadAckResult, len(acks))
+	var total int64
+	for i, a := range acks {
+		results[i] = models.ReadAckResult{Room: a.Room, UpToSeq: a.UpToSeq}
+		updated, ok := counts[a.Room]
+		if !ok {
+			results[i].Error = "not a participant of this room"
+			continue
+		}
+		results[i].Updated = updated
+		total += updated
+		broadcastMessagesSeenUpTo(a.Room, s.userID, s.username, now, updated, a.UpToSeq)
+	}
+
+	s.send(map[string]interface{}{
+		"event":     "ack_read_successful",
+		"results":   results,
+		"timestamp": now,
+	})
+	if total > 0 {
+		adjustBadge(s.chatService, s.userID, -total)
+	}
+	return nil
+}
+
+// markAllRead marks every room of the user as seen and sends one messages_seen
+// update to each room that actually changed
+func markAllRead(ctx context.Context, chatService *services.ChatService, userID int, username string) (map[string]int64, error) {
+	counts, err := chatService.MarkAllRoomsSeen(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	var total int64
+	for roomID, updated := range counts {
+		broadcastMessagesSeen(roomID, userID, username, now, updated)
+		total += updated
+	}
+	adjustBadge(chatService, userID, -total)
+	return counts, nil
+}
+
+// broadcastMessagesSeen tells a room that userID has seen messages up to timestamp
+func broadcastMessagesSeen(roomID string, userID int, username string, timestamp int64, count int64) {
 	Manager.Broadcast(roomID, map[string]interface{}{
 		"event":     "messages_seen",
 		"room":      roomID,
 		"seen_by":   userID,
 		"username":  username,
-		"timestamp": msg.Timestamp,
-		"count":     updated,
+		"timestamp": timestamp,
+		"count":     count,
 	}, "")
 }
 
-func handleJoin(c *websocket.Conn, msg *models.WSMessage, userID int, username string, currentRoom *string, chatService *services.ChatService, connID string) {
-	if msg.Room == "" {
-		return
-	}
+// broadcastMessagesSeenUpTo is broadcastMessagesSeen for receipts acknowledged by message id
+func broadcastMessagesSeenUpTo(roomID string, userID int, username string, timestamp int64, count int64, upToSeq int) {
+	Manager.Broadcast(roomID, map[string]interface{}{
+		"event":     "messages_seen",
+		"room":      roomID,
+		"seen_by":   userID,
+		"username":  username,
+		"timestamp": timestamp,
+		"count":     count,
+		"up_to_seq": upToSeq,
+	}, "")
+}
 
+func handleJoin(s *wsSession, msg *models.JoinRequest) error {
 	// Leave previous room if any
-	if *currentRoom != "" {
-		Manager.Leave(*currentRoom, connID)
+	if s.currentRoom != "" {
+		Manager.Leave(s.currentRoom, s.connID)
 		// Notify previous room
-		Manager.Broadcast(*currentRoom, models.WSMessage{
+		Manager.Broadcast(s.currentRoom, models.WSMessage{
 			Event:     "leave",
-			Room:      *currentRoom,
-			Username:  username,
+			Room:      s.currentRoom,
+			Username:  s.username,
 			Timestamp: time.Now().UnixMilli(),
 		}, "")
 	}
 
-	*currentRoom = msg.Room
-	Manager.Join(*currentRoom, connID, c, userID, username)
+	s.currentRoom = msg.Room
+	Manager.Join(s.currentRoom, s.connID, s.client, s.userID, s.username)
 
 	// Send confirmation to the sender
-	utils.SendJSON(c, models.WSMessage{
+	s.send(models.WSMessage{
 		Event:     "joined",
-		Room:      *currentRoom,
-		Username:  username,
+		Room:      s.currentRoom,
+		Username:  s.username,
 		Timestamp: time.Now().UnixMilli(),
 	})
 
 	// Notify room
-	Manager.Broadcast(*currentRoom, models.WSMessage{
+	Manager.Broadcast(s.currentRoom, models.WSMessage{
 		Event:     "join",
-		Room:      *currentRoom,
-		Username:  username,
+		Room:      s.currentRoom,
+		Username:  s.username,
 		Timestamp: time.Now().UnixMilli(),
-	}, connID)
+	}, s.connID)
 
 	// Send recent history as a single packed message
-	messages, err := chatService.GetRecentMessages(context.Background(), *currentRoom, 50)
+	messages, err := s.chatService.GetRecentMessages(s.ctx, s.currentRoom, 50)
 	if err == nil {
-		var history []models.ChatHistoryItem
-		for _, m := range messages {
-			item := models.ChatHistoryItem{
-				ID:            m.ID,
-				Event:         "chat",
-				Room:          *currentRoom,
-				Text:          m.Content,
-				Voice:         m.Voice,
-				Username:      m.Username,
-				Timestamp:     m.CreatedAt.UnixMilli(),
-				IsYourMessage: m.UserID == userID,
-				HasSeen:       m.HasSeen,
-				ReplyTo:       m.ReplyTo,
-			}
-			// Build absolute voice URL if voice exists
-			if m.Voice != nil && *m.Voice != "" {
-				item.VoiceURL = buildVoiceURLFromWS(c, *m.Voice)
-			}
-			history = append(history, item)
+		// Edits and deletions are in the rows; quoted messages may have changed since
+		if err := s.chatService.RefreshReplySnapshots(s.ctx, messages); err != nil {
+			utils.LogError(err, "RefreshReplySnapshots")
+		}
+		history := threadHistory(messages, s.userID, func(f string) string { return buildVoiceURLFromWS(s.conn, f) }, func(f string) string { return buildFileURLFromWS(s.conn, f) })
+		applyMessageStates(s.ctx, s.chatService, s.userID, history)
+
+		// Replay membership changes within the history window (all of them for an empty room)
+		var since time.Time
+		if len(history) > 0 {
+			since = time.UnixMilli(history[0].Timestamp)
+		}
+		if events, err := s.chatService.GetMembershipEvents(s.ctx, s.currentRoom, since); err == nil {
+			history = mergeMembershipHistory(history, events, s.userID)
 		}
 
 		// Get other user info for this room
 		var otherUserInfo *models.UserInfo
-		if otherUserID, err := chatService.GetOtherUserInRoom(context.Background(), *currentRoom, userID); err == nil {
-			otherUserInfo, _ = chatService.GetUserInfo(context.Background(), otherUserID)
+		if otherUserID, err := s.chatService.GetOtherUserInRoom(s.ctx, s.currentRoom, s.userID); err == nil {
+			otherUserInfo, _ = s.chatService.GetUserInfo(s.ctx, otherUserID)
 		}
 
-		utils.SendJSON(c, models.WSMessage{
-			Event:     "history",
-			Room:      *currentRoom,
-			History:   history,
-			OtherUser: otherUserInfo,
-			Timestamp: time.Now().UnixMilli(),
+		// Not found covers both "no announcement" and "dismissed"
+		announcement, _ := s.chatService.GetRoomAnnouncement(s.ctx, s.currentRoom, s.userID)
+		lock, _ := s.chatService.GetRoomLock(s.ctx, s.currentRoom)
+
+		s.send(models.WSMessage{
+			Event:        "history",
+			Room:         s.currentRoom,
+			History:      history,
+			OtherUser:    otherUserInfo,
+			Announcement: announcement,
+			Lock:         lock,
+			Timestamp:    time.Now().UnixMilli(),
 		})
 	}
+	return nil
 }
 
-func handleLeave(c *websocket.Conn, msg *models.WSMessage, currentRoom *string, connID string) {
-	if *currentRoom != "" {
-		Manager.Leave(*currentRoom, connID)
+func handleLeave(s *wsSession, _ *models.LeaveRequest) error {
+	if s.currentRoom != "" {
+		Manager.Leave(s.currentRoom, s.connID)
 
-		Manager.Broadcast(*currentRoom, models.WSMessage{
+		Manager.Broadcast(s.currentRoom, models.WSMessage{
 			Event:     "leave",
-			Room:      *currentRoom,
-			Username:  msg.Username,
+			Room:      s.currentRoom,
+			Username:  s.username,
 			Timestamp: time.Now().UnixMilli(),
-		}, connID)
+		}, s.connID)
 
-		*currentRoom = ""
+		s.currentRoom = ""
 	}
+	return nil
 }
 
-func handleChat(c *websocket.Conn, msg *models.WSMessage, userID int, username string, currentRoom string, chatService *services.ChatService) {
-	if currentRoom == "" {
-		return
+// handleChat posts to the current room. While the database is down the message is queued
+// instead, see dbOutage.
+func handleChat(s *wsSession, msg *models.ChatRequest) error {
+	room := s.currentRoom
+	if queued, err := dbOutage.hold(s, room, msg); queued || err != nil {
+		return err
+	}
+	_, err := postChat(s, room, msg)
+	if err != nil && dbOutage.check() {
+		// The database went away under this message: queue it like the ones that follow
+		_, err = dbOutage.hold(s, room, msg)
 	}
+	return err
+}
+
+// postChat saves a chat message to currentRoom, broadcasts it and notifies participants who
+// aren't viewing the room. It returns the new message's id.
+func postChat(s *wsSession, currentRoom string, msg *models.ChatRequest) (int, error) {
 
 	// Prepare content - can be nil for voice messages sent via WS
 	var content *string
@@ -233,28 +341,46 @@ func handleChat(c *websocket.Conn, msg *models.WSMessage, userID int, username s
 		voice = &msg.Voice
 	}
 
-	// Validate: at least one of text or voice must be provided
-	if content == nil && voice == nil {
-		utils.SendJSON(c, map[string]interface{}{
-			"event": "error",
-			"error": "message must have either text or voice",
-		})
-		return
+	expiresAt, err := resolveExpiry(msg.TTL)
+	if err != nil {
+		return 0, err
+	}
+	kind := models.PostKindText // Stickers go wherever text does
+	if voice != nil || msg.MediaID != "" {
+		kind = models.PostKindVoice
+	}
+	if err := checkCanPost(s.ctx, s.chatService, currentRoom, s.userID, kind); err != nil {
+		return 0, err
+	}
+
+	var sticker *models.Sticker
+	if msg.StickerID != 0 {
+		sticker, err = s.chatService.GetSticker(s.ctx, msg.StickerID)
+		if errors.Is(err, services.ErrNotFound) {
+			return 0, fmt.Errorf("sticker not found")
+		}
+		if err != nil {
+			utils.LogError(err, "GetSticker")
+			return 0, fmt.Errorf("failed to send sticker")
+		}
 	}
 
 	// Persist
 	dbMsg := &models.Message{
-		Room:     currentRoom,
-		UserID:   userID,
-		Username: username,
-		Content:  content,
-		Voice:    voice,
-		ReplyTo:  msg.ReplyTo,
+		Room:      currentRoom,
+		UserID:    s.userID,
+		Username:  s.username,
+		Content:   content,
+		Voice:     voice,
+		Sticker:   sticker,
+		ReplyTo:   msg.ReplyTo,
+		ExpiresAt: expiresAt,
+		Silent:    msg.Silent,
 	}
 
 	// If client provided only a reply_to_id, fetch that message and set ReplyTo
 	if dbMsg.ReplyTo == nil && msg.ReplyToID != 0 {
-		if ref, err := chatService.GetMessageByID(context.Background(), msg.ReplyToID); err == nil {
+		if ref, err := s.chatService.GetMessageByID(s.ctx, msg.ReplyToID); err == nil {
 			dbMsg.ReplyTo = ref
 		} else {
 			// If lookup fails, log and continue without reply_to
@@ -262,108 +388,109 @@ func handleChat(c *websocket.Conn, msg *models.WSMessage, userID int, username s
 		}
 	}
 
-	// Run in background or wait? For reliability, wait.
-	if err := chatService.SaveMessage(context.Background(), dbMsg); err != nil {
+	saveStarted := clock.Now()
+	if msg.MediaID != "" {
+		// Publish a staged upload; the text is its caption
+		staged, err := s.chatService.GetStagedMedia(s.ctx, msg.MediaID, s.userID)
+		if err != nil {
+			return 0, fmt.Errorf("media not found")
+		}
+		if staged.Room != currentRoom {
+			return 0, fmt.Errorf("media was staged for another room")
+		}
+		if err := s.chatService.PublishStagedMedia(s.ctx, msg.MediaID, s.userID, dbMsg); err != nil {
+			utils.LogError(err, "PublishStagedMedia")
+			return 0, fmt.Errorf("failed to publish media")
+		}
+	} else if err := s.chatService.SaveMessage(s.ctx, dbMsg); err != nil {
+		// Run in background or wait? For reliability, wait.
 		utils.LogError(err, "SaveMessage")
-		return
+		return 0, fmt.Errorf("failed to save message")
 	}
+	deliveries.start(dbMsg.ID, saveStarted)
 
 	// Build voice URL if voice exists
 	voiceURL := ""
-	if voice != nil && *voice != "" {
-		voiceURL = buildVoiceURLFromWS(c, *voice)
+	voiceName := ""
+	if dbMsg.Voice != nil && *dbMsg.Voice != "" {
+		voiceName = *dbMsg.Voice
+		voiceURL = buildVoiceURLFromWS(s.conn, voiceName)
 	}
+	withReplyVoiceURL(dbMsg.ReplyTo, func(f string) string { return buildVoiceURLFromWS(s.conn, f) })
+	mentions := saveMentions(s, dbMsg, msg.Text)
 
 	// Broadcast to users currently in the room
 	Manager.Broadcast(currentRoom, models.WSMessage{
-		ID:        dbMsg.ID,
-		Event:     "chat",
-		Room:      currentRoom,
-		Text:      msg.Text,
-		Voice:     msg.Voice,
-		VoiceURL:  voiceURL,
-		Username:  username,
-		Timestamp: dbMsg.CreatedAt.UnixMilli(),
-		HasSeen:   dbMsg.HasSeen,
-		ReplyTo:   dbMsg.ReplyTo,
+		ID:           dbMsg.ID,
+		Event:        "chat",
+		Room:         currentRoom,
+		Text:         msg.Text,
+		Translations: translateForRoom(s.ctx, s.chatService, currentRoom, msg.Text),
+		Voice:        voiceName,
+		VoiceURL:     voiceURL,
+		VoiceMeta:    dbMsg.VoiceMeta,
+		Sticker:      dbMsg.Sticker,
+		Username:     s.username,
+		Timestamp:    dbMsg.CreatedAt.UnixMilli(),
+		HasSeen:      dbMsg.HasSeen,
+		ReplyTo:      dbMsg.ReplyTo,
+		ExpiresAt:    expiresAtMillis(dbMsg.ExpiresAt),
+		Silent:       dbMsg.Silent,
+		Mentions:     mentions,
+		ThreadID:     dbMsg.ThreadID,
 	}, "") // Send to everyone including sender so they know it's confirmed
 
-	// Notify room participants who are NOT currently in this room about the new message
-	go notifyNewMessage(chatService, currentRoom, userID, username, msg.Text, dbMsg.CreatedAt.UnixMilli())
+	if dbMsg.Silent {
+		return dbMsg.ID, nil
+	}
+
+	// Notify room participants who are NOT currently in this room about the new message;
+	// mentioned users get a mention notification instead
+	event, text := "message", msg.Text
+	if dbMsg.Voice != nil {
+		event = "voice"
+	} else if dbMsg.Sticker != nil {
+		event, text = "sticker", dbMsg.Sticker.Emoji
+	}
+	go func(roomID string, messageID, senderID int, sender, text string, timestamp int64) {
+		notifyMentions(s.chatService, roomID, messageID, senderID, sender, text, timestamp, mentions)
+		notifyRoomParticipantsExcept(s.chatService, event, roomID, messageID, senderID, sender, text, timestamp, mentionedUserIDs(mentions))
+	}(currentRoom, dbMsg.ID, s.userID, s.username, text, dbMsg.CreatedAt.UnixMilli())
+	return dbMsg.ID, nil
 }
 
 // notifyNewMessage sends a notification to room participants who are not currently viewing the room
-func notifyNewMessage(chatService *services.ChatService, roomID string, senderID int, senderUsername string, messageText string, timestamp int64) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Get all participants of this room
-	participants, err := chatService.GetRoomParticipants(ctx, roomID)
-	if err != nil {
-		utils.LogError(err, "GetRoomParticipants")
-		return
-	}
-
-	// Build the notification message
-	notification := map[string]interface{}{
-		"event":           "new_message",
-		"room":            roomID,
-		"sender_id":       senderID,
-		"sender_username": senderUsername,
-		"text":            messageText,
-		"timestamp":       timestamp,
-	}
-
-	// Send notification to each participant who is:
-	// 1. Not the sender
-	// 2. Online but NOT currently in this room
-	for _, participantID := range participants {
-		if participantID == senderID {
-			continue // Don't notify the sender
-		}
-
-		// Check if user is online
-		if !Manager.IsUserOnline(participantID) {
-			continue // User is offline, skip
-		}
-
-		// Check if user is currently in this room
-		if Manager.IsUserInRoom(participantID, roomID) {
-			continue // User is already in the room and will get the chat message
-		}
-
-		// Send notification
-		Manager.SendToUser(participantID, notification)
-	}
+func notifyNewMessage(chatService *services.ChatService, roomID string, messageID int, senderID int, senderUsername string, messageText string, timestamp int64) {
+	notifyRoomParticipants(chatService, "message", roomID, messageID, senderID, senderUsername, messageText, timestamp)
 }
 
-func handleList(c *websocket.Conn, msg *models.WSMessage, userID int, chatService *services.ChatService) {
-	rooms, err := chatService.GetUserRooms(context.Background(), userID)
+func handleList(s *wsSession, _ *models.ListRequest) error {
+	rooms, err := s.chatService.GetUserRooms(s.ctx, s.userID)
 	if err != nil {
 		utils.LogError(err, "GetUserRooms")
 		// send empty list with error
-		utils.SendJSON(c, models.WSMessage{
+		s.send(models.WSMessage{
 			Event: "list",
 			Rooms: []models.RoomListItem{},
 		})
-		return
+		return nil
 	}
 
 	// Set online status and voice URL for each item
 	for i := range rooms {
-		if Manager.IsUserOnline(rooms[i].OtherUserID) {
-			rooms[i].OtherUserStatus = "online"
-		} else {
-			rooms[i].OtherUserStatus = "offline"
+		// Named rooms have no single other participant
+		if rooms[i].OtherUserID != 0 {
+			rooms[i].OtherUserStatus = UserStatus(rooms[i].OtherUserID)
 		}
 		// Build absolute voice URL if last message was a voice
-		if rooms[i].LastVoice != nil && *rooms[i].LastVoice != "" {
-			rooms[i].LastVoiceURL = buildVoiceURLFromWS(c, *rooms[i].LastVoice)
+		if rooms[i].LastVoice != nil && *rooms[i].LastVoice != "" && !rooms[i].LastVoiceExpired {
+			rooms[i].LastVoiceURL = buildVoiceURLFromWS(s.conn, *rooms[i].LastVoice)
 		}
 	}
 
-	utils.SendJSON(c, models.WSMessage{
+	s.send(models.WSMessage{
 		Event: "list",
 		Rooms: rooms,
 	})
+	return nil
 }
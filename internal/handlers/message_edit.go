@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// messageEditWindow is how long after sending a message may be edited (MESSAGE_EDIT_WINDOW, 0 for no limit)
+func messageEditWindow() time.Duration {
+	return utils.GetEnvDuration("MESSAGE_EDIT_WINDOW", 0)
+}
+
+// undoSendWindow is how long after sending a message can be retracted (UNDO_SEND_WINDOW, 0 disables)
+func undoSendWindow() time.Duration {
+	return utils.GetEnvDuration("UNDO_SEND_WINDOW", 10*time.Second)
+}
+
+// optionalMillis returns the unix ms form of an optional timestamp, 0 when unset
+func optionalMillis(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// messageEditError maps edit/delete service errors onto HTTP responses
+func messageEditError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "message not found"})
+	case errors.Is(err, services.ErrNotMessageSender), errors.Is(err, services.ErrNotEditable):
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrMessageDeleted), errors.Is(err, services.ErrEditWindowClosed),
+		errors.Is(err, services.ErrLegalHold), errors.Is(err, services.ErrUndoWindowClosed):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// wsEditError keeps internal failures out of WS error events
+func wsEditError(err error, op string) error {
+	if errors.Is(err, services.ErrNotFound) {
+		return fmt.Errorf("message not found")
+	}
+	if errors.Is(err, services.ErrNotMessageSender) || errors.Is(err, services.ErrNotEditable) ||
+		errors.Is(err, services.ErrMessageDeleted) || errors.Is(err, services.ErrEditWindowClosed) ||
+		errors.Is(err, services.ErrLegalHold) || errors.Is(err, services.ErrEditConflict) ||
+		errors.Is(err, services.ErrUndoWindowClosed) {
+		return err
+	}
+	utils.LogError(err, op)
+	return fmt.Errorf("failed to update message")
+}
+
+// broadcastMessageEdited tells everyone viewing the room to replace the message text in place
+func broadcastMessageEdited(ctx context.Context, chatService *services.ChatService, msg *models.Message) models.WSMessage {
+	text := ""
+	if msg.Content != nil {
+		text = *msg.Content
+	}
+	event := models.WSMessage{
+		Event:        "message_edited",
+		ID:           msg.ID,
+		Room:         msg.Room,
+		Text:         text,
+		Translations: translateForRoom(ctx, chatService, msg.Room, text),
+		Username:     msg.Username,
+		Timestamp:    msg.CreatedAt.UnixMilli(),
+		EditedAt:     optionalMillis(msg.EditedAt),
+		Version:      msg.Version,
+	}
+	Manager.Broadcast(msg.Room, event, "")
+	return event
+}
+
+// notifyEditConflict sends the sender's devices the current message next to the rejected edit,
+// so the client can merge or ask the user which text to keep and retry with the current version
+func notifyEditConflict(current *models.Message, req *models.EditMessageRequest) {
+	Manager.SendToUser(current.UserID, map[string]interface{}{
+		"event":            "edit_conflict",
+		"id":               current.ID,
+		"room":             current.Room,
+		"text":             current.Content,
+		"version":          current.Version,
+		"edited_at":        optionalMillis(current.EditedAt),
+		"rejected_text":    req.Text,
+		"rejected_version": *req.Version,
+		"timestamp":        time.Now().UnixMilli(),
+	})
+}
+
+// broadcastMessageDeleted tells everyone viewing the room to render the message as deleted
+func broadcastMessageDeleted(msg *models.Message) models.WSMessage {
+	event := models.WSMessage{
+		Event:     "message_deleted",
+		ID:        msg.ID,
+		Room:      msg.Room,
+		Username:  msg.Username,
+		Timestamp: msg.CreatedAt.UnixMilli(),
+		Deleted:   true,
+	}
+	Manager.Broadcast(msg.Room, event, "")
+	return event
+}
+
+// retractMessage unsends the caller's message: held pushes are dropped and every participant,
+// in the room or only notified of the message, gets message_retracted to remove it
+func retractMessage(ctx context.Context, chatService *services.ChatService, messageID, userID int) (*models.Message, error) {
+	window := undoSendWindow()
+	if window <= 0 {
+		return nil, services.ErrUndoWindowClosed
+	}
+	msg, err := chatService.RetractMessage(ctx, messageID, userID, window)
+	if err != nil {
+		return nil, err
+	}
+	if Push != nil {
+		Push.Retract(msg.ID)
+	}
+	participants, err := chatService.GetRoomParticipants(ctx, msg.Room)
+	if err != nil {
+		utils.LogError(err, "GetRoomParticipants for message_retracted")
+	}
+	Manager.SendToUsers(participants, map[string]interface{}{
+		"event":      "message_retracted",
+		"id":         msg.ID,
+		"room":       msg.Room,
+		"message_ts": msg.CreatedAt.UnixMilli(),
+		"timestamp":  time.Now().UnixMilli(),
+	})
+	// The message was counted as unread; recount instead of guessing who had read it
+	for _, participantID := range participants {
+		if participantID != userID {
+			Badges.Forget(participantID)
+			adjustBadge(chatService, participantID, 0)
+		}
+	}
+	return msg, nil
+}
+
+func handleEditMessage(s *wsSession, req *models.EditMessageRequest) error {
+	msg, err := s.chatService.EditMessage(s.ctx, req.ID, s.userID, req.Text, req.Version, messageEditWindow())
+	if errors.Is(err, services.ErrEditConflict) {
+		notifyEditConflict(msg, req)
+	}
+	if err != nil {
+		return wsEditError(err, "EditMessage")
+	}
+	event := broadcastMessageEdited(s.ctx, s.chatService, msg)
+	if s.currentRoom != msg.Room {
+		// Edited from outside the room; the broadcast didn't reach this connection
+		s.send(event)
+	}
+	return nil
+}
+
+func handleDeleteMessage(s *wsSession, req *models.DeleteMessageRequest) error {
+	msg, err := s.chatService.DeleteMessage(s.ctx, req.ID, s.userID)
+	if err != nil {
+		return wsEditError(err, "DeleteMessage")
+	}
+	event := broadcastMessageDeleted(msg)
+	if s.currentRoom != msg.Room {
+		s.send(event)
+	}
+	return nil
+}
+
+func handleRetractMessage(s *wsSession, req *models.RetractMessageRequest) error {
+	if _, err := retractMessage(s.ctx, s.chatService, req.ID, s.userID); err != nil {
+		return wsEditError(err, "RetractMessage")
+	}
+	return nil
+}
+
+// parseMessageID reads the :id route parameter
+func parseMessageID(c *fiber.Ctx) (int, bool) {
+	id, err := strconv.Atoi(c.Params("id"))
+	return id, err == nil && id > 0
+}
+
+// EditMessageHandler replaces the text of the caller's message and broadcasts message_edited
+func EditMessageHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		id, ok := parseMessageID(c)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid message id"})
+		}
+		var req models.EditMessageRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		req.ID = id
+		if err := req.Validate(); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		msg, err := chatService.EditMessage(c.UserContext(), id, userID, req.Text, req.Version, messageEditWindow())
+		if errors.Is(err, services.ErrEditConflict) {
+			notifyEditConflict(msg, &req)
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error(), "current": msg})
+		}
+		if err != nil {
+			return messageEditError(c, err)
+		}
+		broadcastMessageEdited(c.UserContext(), chatService, msg)
+		if msg.Voice != nil && *msg.Voice != "" && !msg.VoiceExpired {
+			msg.VoiceURL = BuildVoiceURL(c, *msg.Voice)
+		}
+		return c.JSON(msg)
+	}
+}
+
+// DeleteMessageHandler tombstones the caller's message and broadcasts message_deleted
+func DeleteMessageHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		id, ok := parseMessageID(c)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid message id"})
+		}
+
+		msg, err := chatService.DeleteMessage(c.UserContext(), id, userID)
+		if err != nil {
+			return messageEditError(c, err)
+		}
+		broadcastMessageDeleted(msg)
+		return c.JSON(msg)
+	}
+}
+
+// RetractMessageHandler unsends the caller's message within the undo send window
+func RetractMessageHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, ok := parseMessageID(c)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid message id"})
+		}
+		if _, err := retractMessage(c.UserContext(), chatService, id, c.Locals("user_id").(int)); err != nil {
+			return messageEditError(c, err)
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
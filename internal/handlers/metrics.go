@@ -0,0 +1,16 @@
+package handlers
+
+import "chat-backend/internal/metrics"
+
+// RegisterMetrics exposes RoomManager state as gauges
+func RegisterMetrics() {
+	metrics.NewGaugeFunc("ws_connections", "Active websocket connections", func() float64 {
+		return float64(Manager.Stats().Connections)
+	})
+	metrics.NewGaugeFunc("ws_online_users", "Distinct users with at least one connection", func() float64 {
+		return float64(Manager.Stats().OnlineUsers)
+	})
+	metrics.NewGaugeFunc("ws_active_rooms", "Rooms with at least one connection joined", func() float64 {
+		return float64(Manager.Stats().ActiveRooms)
+	})
+}
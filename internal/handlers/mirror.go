@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Mirror renders mirrored rooms into static archives; nil when MIRROR_DIR is unset
+var Mirror *services.MirrorExporter
+
+// exportMirror refreshes one archive in the background after an admin change
+func exportMirror(roomID string) {
+	go func() {
+		if _, err := Mirror.Export(context.Background(), roomID); err != nil && !errors.Is(err, services.ErrNotFound) {
+			utils.LogError(err, "MirrorExport")
+		}
+	}()
+}
+
+// StartMirrorExporter appends new messages to every mirrored room's archive on each tick.
+// It stops when ctx is cancelled.
+func StartMirrorExporter(ctx context.Context, interval time.Duration) {
+	if Mirror == nil || interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !services.FeatureEnabled(services.FeatureMirrorExport) {
+					continue
+				}
+				if err := Mirror.ExportAll(ctx); err != nil {
+					utils.LogError(err, "MirrorExportAll")
+				}
+			}
+		}
+	}()
+	log.Printf("Room mirror export running every %s", interval)
+}
+
+// mirrorDisabled answers admin mirror requests when no MIRROR_DIR is configured
+func mirrorDisabled(c *fiber.Ctx) error {
+	return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "room mirroring is not configured"})
+}
+
+// AdminListMirrorsHandler lists mirrored rooms and their export progress
+func AdminListMirrorsHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		mirrors, err := adminService.ListRoomMirrors(c.UserContext())
+		if err != nil {
+			return adminError(c, err)
+		}
+		return c.JSON(mirrors)
+	}
+}
+
+// AdminEnableMirrorHandler publishes a public channel as a static archive
+func AdminEnableMirrorHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if Mirror == nil {
+			return mirrorDisabled(c)
+		}
+		adminID := c.Locals("user_id").(int)
+		mirror, err := adminService.EnableRoomMirror(c.UserContext(), adminID, c.Params("id"))
+		if err != nil {
+			if errors.Is(err, services.ErrNotPublicRoom) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return adminError(c, err)
+		}
+		exportMirror(mirror.RoomID)
+		return c.JSON(mirror)
+	}
+}
+
+// AdminRebuildMirrorHandler regenerates an archive from scratch, dropping messages that
+// have since been deleted or purged
+func AdminRebuildMirrorHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if Mirror == nil {
+			return mirrorDisabled(c)
+		}
+		roomID := c.Params("id")
+		if err := adminService.ResetRoomMirror(c.UserContext(), roomID); err != nil {
+			return adminError(c, err)
+		}
+		exportMirror(roomID)
+		return c.Status(http.StatusAccepted).JSON(fiber.Map{"room_id": roomID, "rebuilding": true})
+	}
+}
+
+// AdminDisableMirrorHandler stops publishing a room and deletes its archive
+func AdminDisableMirrorHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roomID := c.Params("id")
+		adminID := c.Locals("user_id").(int)
+		if err := adminService.DisableRoomMirror(c.UserContext(), adminID, roomID); err != nil {
+			return adminError(c, err)
+		}
+		if Mirror != nil {
+			if err := Mirror.Remove(roomID); err != nil {
+				utils.LogError(err, "MirrorRemove")
+			}
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
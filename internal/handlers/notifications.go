@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Notifications renders localized notification titles/bodies. Set at startup.
+var Notifications *services.NotificationTemplates
+
+// notifyRoomParticipants sends a new_message notification to participants who are online
+// but not actively viewing the room, and a push to the devices of participants who are
+// offline (see notificationTargets). Participants who muted the room, or switched off this
+// event type for the channel in their notification matrix, only get their unread badge
+// updated.
+// Each recipient gets a payload rendered in their language; recipients with previews
+// disabled do not receive the message text. Each payload carries an action_token for
+// POST /api/notifications/act.
+// Meta event types (see services.IsContentEvent) are never notified.
+func notifyRoomParticipants(chatService *services.ChatService, kind string, roomID string, messageID int, senderID int, senderUsername string, messageText string, timestamp int64) {
+	notifyRoomParticipantsExcept(chatService, kind, roomID, messageID, senderID, senderUsername, messageText, timestamp, nil)
+}
+
+// notifyRoomParticipantsExcept is notifyRoomParticipants for messages that also notified
+// some participants another way (see notifyMentions): those only get their badge updated.
+func notifyRoomParticipantsExcept(chatService *services.ChatService, kind string, roomID string, messageID int, senderID int, senderUsername string, messageText string, timestamp int64, except []int) {
+	if !services.IsContentEvent(kind) {
+		return
+	}
+	// Unread totals are counted from stored messages, so other event types don't touch the badge
+	countsUnread := kind != "reaction"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	participants, err := chatService.GetRoomParticipants(ctx, roomID)
+	if err != nil {
+		utils.LogError(err, "GetRoomParticipants for notification")
+		return
+	}
+
+	// Messages in an unclaimed support conversation fan out to every agent
+	agents, err := chatService.GetUnclaimedSupportAgents(ctx, roomID, supportAgents())
+	if err != nil {
+		utils.LogError(err, "GetUnclaimedSupportAgents")
+	}
+	for _, agentID := range agents {
+		if !slices.Contains(participants, agentID) {
+			participants = append(participants, agentID)
+		}
+	}
+
+	muted, err := chatService.GetMutedParticipants(ctx, roomID)
+	if err != nil {
+		utils.LogError(err, "GetMutedParticipants")
+	}
+
+	badged, recipients, offline := notificationTargets(roomID, senderID, participants, append(muted, except...))
+	if countsUnread {
+		for _, participantID := range badged {
+			adjustBadge(chatService, participantID, 1)
+		}
+	}
+	if Push == nil {
+		offline = nil
+	}
+	if len(recipients) == 0 && len(offline) == 0 {
+		return
+	}
+
+	prefs, err := chatService.GetNotificationPrefs(ctx, append(append([]int{}, recipients...), offline...))
+	if err != nil {
+		utils.LogError(err, "GetNotificationPrefs")
+		prefs = map[int]models.NotificationPrefs{}
+	}
+
+	data := services.NotificationData{Sender: senderUsername, Text: messageText, RoomID: roomID}
+	for _, participantID := range recipients {
+		p, ok := prefs[participantID]
+		if !ok {
+			p = models.NotificationPrefs{Language: "en", MessagePreview: true}
+		}
+		if !p.Matrix.Allows(kind, models.ChannelWS) {
+			continue
+		}
+
+		notification := map[string]interface{}{
+			"event":           "new_message",
+			"room":            roomID,
+			"message_id":      messageID,
+			"sender_id":       senderID,
+			"sender_username": senderUsername,
+			"type":            kind,
+			"timestamp":       timestamp,
+		}
+		if messageText != "" && p.MessagePreview {
+			notification["text"] = messageText // Message text or voice caption
+		}
+		if Notifications != nil {
+			notification["notification"] = Notifications.Render(kind, p.Language, p.MessagePreview, data)
+		}
+		if token, err := services.GenerateNotificationActionToken(participantID, roomID, messageID); err == nil {
+			notification["action_token"] = token
+		}
+		Manager.SendToUser(participantID, notification)
+	}
+
+	// Pushes wait out the undo send window so an unsent message never reaches a lock screen
+	hold := undoSendWindow()
+	if !countsUnread {
+		hold = 0
+	}
+	for _, participantID := range offline {
+		p, ok := prefs[participantID]
+		if !ok {
+			p = models.NotificationPrefs{Language: "en", MessagePreview: true}
+		}
+		if !p.Matrix.Allows(kind, models.ChannelPush) {
+			continue
+		}
+		push := services.PushNotification{
+			Title: senderUsername,
+			Data: map[string]string{
+				"event":      "new_message",
+				"room":       roomID,
+				"message_id": strconv.Itoa(messageID),
+				"sender_id":  strconv.Itoa(senderID),
+				"type":       kind,
+			},
+		}
+		if Notifications != nil {
+			rendered := Notifications.Render(kind, p.Language, p.MessagePreview, data)
+			push.Title, push.Body, push.CollapseKey = rendered.Title, rendered.Body, rendered.CollapseKey
+		} else if p.MessagePreview {
+			push.Body = messageText
+		}
+		if token, err := services.GenerateNotificationActionToken(participantID, roomID, messageID); err == nil {
+			push.Data["action_token"] = token
+		}
+		Push.Enqueue(participantID, messageID, push, hold)
+	}
+}
+
+// notificationTargets decides who hears about a message in roomID from senderID: every
+// participant but the sender gets their badge updated (badged); of those, the ones not in
+// except get a WS notification if they are online and not actively viewing the room
+// (recipients), or a push if they are offline. Participants viewing the room while away
+// are notified, since they are not looking at it.
+func notificationTargets(roomID string, senderID int, participants, except []int) (badged, recipients, offline []int) {
+	for _, participantID := range participants {
+		if participantID == senderID {
+			continue // Don't notify the sender
+		}
+		badged = append(badged, participantID)
+		if slices.Contains(except, participantID) {
+			continue
+		}
+		if !Manager.IsUserOnline(participantID) {
+			offline = append(offline, participantID)
+			continue
+		}
+		if Manager.IsUserInRoom(participantID, roomID) && UserStatus(participantID) == "online" {
+			continue // Already in the room and will get the chat message
+		}
+		recipients = append(recipients, participantID)
+	}
+	return badged, recipients, offline
+}
+
+// maxReactionEmojiBytes matches message_reactions.emoji
+const maxReactionEmojiBytes = 32
+
+// NotificationActionHandler handles notification action buttons ("read", "react") using the
+// action_token from the notification payload instead of an access token, so no WS connection
+// or login is needed.
+func NotificationActionHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.NotificationActionRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+
+		action, err := services.ValidateNotificationActionToken(req.Token)
+		if err != nil {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid or expired action token"})
+		}
+
+		// The user may have left the room since the notification was sent
+		ok, err := chatService.IsRoomParticipant(c.UserContext(), action.Room, action.UserID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check room membership"})
+		}
+		if !ok {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "not a participant of this room"})
+		}
+
+		msg, err := chatService.GetMessageByID(c.UserContext(), action.MessageID)
+		if err != nil || msg.Room != action.Room {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "message not found"})
+		}
+
+		switch req.Action {
+		case "read":
+			updated, err := chatService.MarkMessagesSeen(c.UserContext(), action.Room, action.UserID, msg.CreatedAt)
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+			username := ""
+			if info, err := chatService.GetUserInfo(c.UserContext(), action.UserID); err == nil {
+				username = info.Username
+			}
+			broadcastMessagesSeen(action.Room, action.UserID, username, msg.CreatedAt.UnixMilli(), updated)
+			adjustBadge(chatService, action.UserID, -updated)
+			return c.JSON(fiber.Map{"room": action.Room, "updated": updated})
+
+		case "react":
+			if req.Emoji == "" || len(req.Emoji) > maxReactionEmojiBytes {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid emoji"})
+			}
+			reaction, err := chatService.AddReaction(c.UserContext(), msg.ID, action.UserID, req.Emoji)
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+			Manager.Broadcast(action.Room, map[string]interface{}{
+				"event":      "reaction_added",
+				"room":       reaction.Room,
+				"message_id": reaction.MessageID,
+				"user_id":    reaction.UserID,
+				"username":   reaction.Username,
+				"emoji":      reaction.Emoji,
+				"timestamp":  reaction.CreatedAt.UnixMilli(),
+			}, "")
+			go notifyRoomParticipants(chatService, "reaction", reaction.Room, reaction.MessageID, reaction.UserID, reaction.Username, reaction.Emoji, reaction.CreatedAt.UnixMilli())
+			return c.JSON(reaction)
+
+		default:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "action must be read or react"})
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNotificationTargets(t *testing.T) {
+	const sender, user = 1, 2
+	tests := []struct {
+		name   string
+		online bool
+		inRoom bool
+		away   bool
+		except bool // Muted the room, or notified of a mention instead
+		want   string
+	}{
+		{"active in the room", true, true, false, false, "badge"},
+		{"away in the room", true, true, true, false, "ws"},
+		{"online in another room", true, false, false, false, "ws"},
+		{"away in another room", true, false, true, false, "ws"},
+		{"offline", false, false, false, false, "push"},
+		{"muted room, online", true, false, false, true, "badge"},
+		{"muted room, offline", false, false, false, true, "badge"},
+		{"mentioned while viewing the room away", true, true, true, true, "badge"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFakeClock(t)
+			savedManager, savedActivity := Manager, Activity
+			t.Cleanup(func() { Manager, Activity = savedManager, savedActivity })
+			m := NewMemoryRooms()
+			Manager = m
+			Activity = &ActivityTracker{users: make(map[int]*userActivity), awayAfter: time.Minute}
+
+			m.RegisterConnection("s1", sender, "alice", nil)
+			m.Join("general", "s1", nil, sender, "alice")
+			if tt.online {
+				m.RegisterConnection("u1", user, "bob", nil)
+				Activity.touch(user, "bob")
+				room := "random"
+				if tt.inRoom {
+					room = "general"
+				}
+				m.Join(room, "u1", nil, user, "bob")
+			}
+			if tt.away {
+				fake.Advance(time.Minute)
+				Activity.sweep()
+			}
+			var except []int
+			if tt.except {
+				except = []int{user}
+			}
+
+			badged, recipients, offline := notificationTargets("general", sender, []int{sender, user}, except)
+			if !slices.Equal(badged, []int{user}) {
+				t.Errorf("badged = %v, want only the recipient", badged)
+			}
+			got := "badge"
+			if slices.Contains(recipients, user) {
+				got = "ws"
+			} else if slices.Contains(offline, user) {
+				got = "push"
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s (recipients %v, offline %v)", got, tt.want, recipients, offline)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// OIDC is the first-party OpenID Connect provider; nil when OIDC_CLIENTS_FILE is not set
+var OIDC *services.OIDCProvider
+
+// oidcLoginPage is the sign-in form shown by the authorization endpoint
+var oidcLoginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in to {{.ClientName}}</title></head>
+<body>
+<h1>Sign in to {{.ClientName}}</h1>
+{{if .Error}}<p style="color:#b00">{{.Error}}</p>{{end}}
+<form method="post" action="/api/oidc/authorize">
+<input type="hidden" name="response_type" value="code">
+<input type="hidden" name="client_id" value="{{.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Scope}}">
+<input type="hidden" name="state" value="{{.State}}">
+<input type="hidden" name="nonce" value="{{.Nonce}}">
+<p><label>Username <input name="username" value="{{.Username}}" autocomplete="username" required></label></p>
+<p><label>Password <input type="password" name="password" autocomplete="current-password" required></label></p>
+<p><button type="submit">Sign in</button></p>
+</form>
+</body>
+</html>`))
+
+type oidcAuthorizeRequest struct {
+	ClientID    string
+	ClientName  string
+	RedirectURI string
+	Scope       string
+	State       string
+	Nonce       string
+	Username    string
+	Error       string
+}
+
+// parseOIDCAuthorize validates an authorization request from the query string or form.
+// Errors are returned as plain text because the redirect_uri can't be trusted yet.
+func parseOIDCAuthorize(value func(key string, defaultValue ...string) string) (*oidcAuthorizeRequest, error) {
+	if value("response_type") != "code" {
+		return nil, errors.New("unsupported response_type, only \"code\" is supported")
+	}
+	client, err := OIDC.Client(value("client_id"), value("redirect_uri"))
+	if err != nil {
+		return nil, errors.New("unknown client_id or redirect_uri")
+	}
+	scope := value("scope")
+	if !strings.Contains(" "+scope+" ", " openid ") {
+		return nil, errors.New("scope must include openid")
+	}
+	name := client.Name
+	if name == "" {
+		name = client.ClientID
+	}
+	return &oidcAuthorizeRequest{
+		ClientID:    client.ClientID,
+		ClientName:  name,
+		RedirectURI: value("redirect_uri"),
+		Scope:       scope,
+		State:       value("state"),
+		Nonce:       value("nonce"),
+	}, nil
+}
+
+func renderOIDCLogin(c *fiber.Ctx, status int, req *oidcAuthorizeRequest) error {
+	var buf bytes.Buffer
+	if err := oidcLoginPage.Execute(&buf, req); err != nil {
+		return c.Status(http.StatusInternalServerError).SendString("Failed to render sign-in page")
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set("X-Frame-Options", "DENY")
+	c.Type("html")
+	return c.Status(status).Send(buf.Bytes())
+}
+
+// OIDCDiscoveryHandler serves /.well-known/openid-configuration
+func OIDCDiscoveryHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(OIDC.Discovery())
+	}
+}
+
+// OIDCJWKSHandler serves the public key used to verify ID tokens
+func OIDCJWKSHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(OIDC.JWKS())
+	}
+}
+
+// OIDCAuthorizeHandler validates an authorization request and shows the sign-in form
+func OIDCAuthorizeHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req, err := parseOIDCAuthorize(c.Query)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).SendString(err.Error())
+		}
+		return renderOIDCLogin(c, http.StatusOK, req)
+	}
+}
+
+// OIDCAuthorizeSubmitHandler checks the submitted credentials and redirects back to the
+// client with an authorization code
+func OIDCAuthorizeSubmitHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req, err := parseOIDCAuthorize(c.FormValue)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).SendString(err.Error())
+		}
+
+		user, err := userService.Authenticate(c.UserContext(), c.FormValue("username"), c.FormValue("password"))
+		if err != nil {
+			req.Username = c.FormValue("username")
+			req.Error = "Invalid username or password"
+			return renderOIDCLogin(c, http.StatusUnauthorized, req)
+		}
+
+		code, err := OIDC.IssueCode(c.UserContext(), req.ClientID, user.ID, req.RedirectURI, req.Scope, req.Nonce)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).SendString("Failed to issue authorization code")
+		}
+
+		target, _ := url.Parse(req.RedirectURI)
+		q := target.Query()
+		q.Set("code", code)
+		if req.State != "" {
+			q.Set("state", req.State)
+		}
+		target.RawQuery = q.Encode()
+		return c.Redirect(target.String(), http.StatusFound)
+	}
+}
+
+// OIDCTokenHandler exchanges an authorization code for tokens. Clients authenticate with
+// HTTP Basic or client_id/client_secret form fields.
+func OIDCTokenHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "no-store")
+
+		if c.FormValue("grant_type") != "authorization_code" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unsupported_grant_type"})
+		}
+
+		clientID, secret := c.FormValue("client_id"), c.FormValue("client_secret")
+		if id, pw, ok := basicAuth(c); ok {
+			clientID, secret = id, pw
+		}
+		client, err := OIDC.AuthenticateClient(clientID, secret)
+		if err != nil {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_client"})
+		}
+
+		res, err := OIDC.ExchangeCode(c.UserContext(), client, c.FormValue("code"), c.FormValue("redirect_uri"))
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidGrant) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid_grant"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+		}
+		return c.JSON(res)
+	}
+}
+
+// basicAuth reads client credentials from an HTTP Basic Authorization header
+func basicAuth(c *fiber.Ctx) (string, string, bool) {
+	r := http.Request{Header: http.Header{"Authorization": []string{c.Get(fiber.HeaderAuthorization)}}}
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		return "", "", false
+	}
+	// RFC 6749 form-encodes the credentials before base64
+	if v, err := url.QueryUnescape(id); err == nil {
+		id = v
+	}
+	if v, err := url.QueryUnescape(secret); err == nil {
+		secret = v
+	}
+	return id, secret, true
+}
+
+// OIDCUserInfoHandler returns the claims of the user an OIDC access token was issued for
+func OIDCUserInfoHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authHeader := c.Get(fiber.HeaderAuthorization)
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
+		}
+		userID, scope, err := OIDC.ValidateAccessToken(authHeader[7:])
+		if err != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
+		}
+		info, err := OIDC.UserInfo(c.UserContext(), userID, scope)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+		}
+		return c.JSON(info)
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// passwordError maps password change and reset errors to responses
+func passwordError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidPassword):
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrWeakPassword), errors.Is(err, services.ErrSamePassword):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidResetToken):
+		return c.Status(http.StatusGone).JSON(fiber.Map{"error": err.Error()})
+	}
+	utils.LogError(err, "password")
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update password"})
+}
+
+// ChangePasswordHandler changes the signed-in user's password; the current one is required.
+// Every device but the one of the request's refresh_token is signed out.
+func ChangePasswordHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.ChangePasswordRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		userID := c.Locals("user_id").(int)
+
+		var deviceID string
+		if req.RefreshToken != "" {
+			claims, err := services.ValidateRefreshToken(req.RefreshToken)
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid refresh token"})
+			}
+			if tokenUser, _ := claims["user_id"].(float64); int(tokenUser) != userID {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid refresh token"})
+			}
+			deviceID, _ = claims["did"].(string)
+		}
+
+		if err := userService.ChangePassword(c.UserContext(), userID, deviceID, req.OldPassword, req.NewPassword); err != nil {
+			return passwordError(c, err)
+		}
+		Manager.SendToUser(userID, map[string]interface{}{
+			"event":     "password_changed",
+			"timestamp": time.Now().UnixMilli(),
+		})
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// passwordResetLink is where the emailed token is used: PASSWORD_RESET_URL with {token}
+// replaced, or this server's reset page under BASE_URL
+func passwordResetLink(token string) (string, error) {
+	if tmpl := utils.GetEnv("PASSWORD_RESET_URL", ""); tmpl != "" {
+		return strings.ReplaceAll(tmpl, "{token}", url.QueryEscape(token)), nil
+	}
+	base, err := emailBaseURL()
+	if err != nil {
+		return "", err
+	}
+	return base + "/reset-password?token=" + url.QueryEscape(token), nil
+}
+
+// ForgotPasswordHandler mails a reset link to the account with the given email or username.
+// The answer is the same whether or not such an account exists.
+func ForgotPasswordHandler(userService *services.UserService, mailer services.Mailer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.ForgotPasswordRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if strings.TrimSpace(req.Email) == "" && strings.TrimSpace(req.Username) == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "email or username is required"})
+		}
+		// Links are never built from the request's host, so without a configured one no token is issued
+		if _, err := passwordResetLink(""); err != nil {
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "password reset is not configured"})
+		}
+
+		reset, err := userService.RequestPasswordReset(c.UserContext(), req)
+		if err != nil {
+			utils.LogError(err, "RequestPasswordReset")
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to start password reset"})
+		}
+		if reset != nil {
+			link, err := passwordResetLink(reset.Token)
+			if err != nil {
+				utils.LogError(err, "passwordResetLink")
+				return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "password reset is not configured"})
+			}
+			body := fmt.Sprintf("Hi %s,\n\nReset your password here:\n%s\n\nThe link expires at %s. If you didn't ask for this, ignore this email.\n",
+				reset.Username, link, reset.ExpiresAt.UTC().Format(time.RFC1123))
+			utils.LogError(mailer.Send(reset.Email, "Reset your password", body), "Send password reset")
+		}
+		return c.Status(http.StatusAccepted).JSON(fiber.Map{"message": "if the account exists and has an email address, a reset link was sent"})
+	}
+}
+
+// ResetPasswordHandler sets a new password with a reset token and signs out every device
+func ResetPasswordHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.ResetPasswordRequest
+		if err := c.BodyParser(&req); err != nil || req.Token == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "token is required"})
+		}
+		userID, err := userService.ResetPassword(c.UserContext(), req.Token, req.NewPassword)
+		if err != nil {
+			return passwordError(c, err)
+		}
+		Manager.SendToUser(userID, map[string]interface{}{
+			"event":     "password_reset",
+			"timestamp": time.Now().UnixMilli(),
+		})
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
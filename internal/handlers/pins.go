@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RoomParticipantMiddleware rejects requests for /rooms/:id/... from users who are not active members
+func RoomParticipantMiddleware(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		ok, err := chatService.IsRoomParticipant(c.UserContext(), c.Params("id"), userID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check room membership"})
+		}
+		if !ok {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "not a participant of this room"})
+		}
+		return c.Next()
+	}
+}
+
+// pinError maps pin service errors onto HTTP responses
+func pinError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "message not found in this room"})
+	case errors.Is(err, services.ErrPinLimit):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadyPinned):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrPinOrderMismatch):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// listPins loads the room's pins with absolute voice URLs
+func listPins(c *fiber.Ctx, chatService *services.ChatService, roomID string) ([]models.PinnedMessage, error) {
+	pins, err := chatService.ListPins(c.UserContext(), roomID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pins {
+		if v := pins[i].Message.Voice; v != nil && *v != "" && !pins[i].Message.VoiceExpired {
+			pins[i].Message.VoiceURL = BuildVoiceURL(c, *v)
+		}
+	}
+	return pins, nil
+}
+
+// broadcastPinsChanged sends the full ordered pin set to everyone viewing the room and returns it
+func broadcastPinsChanged(c *fiber.Ctx, chatService *services.ChatService, roomID string) error {
+	pins, err := listPins(c, chatService, roomID)
+	if err != nil {
+		utils.LogError(err, "ListPins for pin_changed")
+		return c.SendStatus(http.StatusNoContent)
+	}
+	Manager.Broadcast(roomID, map[string]interface{}{
+		"event":     "pin_changed",
+		"room":      roomID,
+		"pins":      pins,
+		"actor_id":  c.Locals("user_id"),
+		"timestamp": time.Now().UnixMilli(),
+	}, "")
+	return c.JSON(pins)
+}
+
+// ListPinsHandler returns the room's pinned messages in order
+func ListPinsHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		pins, err := listPins(c, chatService, c.Params("id"))
+		if err != nil {
+			return pinError(c, err)
+		}
+		return c.JSON(pins)
+	}
+}
+
+// PinMessageHandler pins a message at the end of the list, up to ROOM_PIN_LIMIT pins per room
+func PinMessageHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		roomID := c.Params("id")
+
+		var req models.PinRequest
+		if err := c.BodyParser(&req); err != nil || req.MessageID <= 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "message_id is required"})
+		}
+		limit := utils.GetEnvInt("ROOM_PIN_LIMIT", 50)
+		if err := chatService.PinMessage(c.UserContext(), roomID, req.MessageID, userID, limit); err != nil {
+			return pinError(c, err)
+		}
+		return broadcastPinsChanged(c, chatService, roomID)
+	}
+}
+
+// UnpinMessageHandler removes a pin
+func UnpinMessageHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roomID := c.Params("id")
+		messageID, err := strconv.Atoi(c.Params("messageId"))
+		if err != nil || messageID <= 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid message id"})
+		}
+		if err := chatService.UnpinMessage(c.UserContext(), roomID, messageID); err != nil {
+			return pinError(c, err)
+		}
+		return broadcastPinsChanged(c, chatService, roomID)
+	}
+}
+
+// ReorderPinsHandler sets the pin order (drag-to-reorder); the body lists every pinned message id
+func ReorderPinsHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roomID := c.Params("id")
+
+		var req models.PinOrderRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if err := chatService.ReorderPins(c.UserContext(), roomID, req.MessageIDs); err != nil {
+			return pinError(c, err)
+		}
+		return broadcastPinsChanged(c, chatService, roomID)
+	}
+}
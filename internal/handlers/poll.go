@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PollEvent is one queued event; Seq orders events and is what cursors refer to
+type PollEvent struct {
+	Seq   uint64          `json:"seq,string"`
+	Event json.RawMessage `json:"event"`
+}
+
+// pollSession queues the events SendToUser delivers to a user polling GET /api/poll
+type pollSession struct {
+	events         []PollEvent
+	droppedThrough uint64 // Highest seq evicted from the queue
+	lastPoll       time.Time
+	waiters        int
+	wake           chan struct{} // Closed and replaced when an event arrives
+}
+
+// PollHub keeps the event queues of long-polling clients, for environments where WebSockets
+// and SSE are blocked. A user has a session while they keep polling; it expires after
+// sessionTTL without a poll. Polling users count as online, so they get the same
+// notifications as a WebSocket connection that hasn't joined a room. Sessions are kept on
+// the instance serving the poll.
+type PollHub struct {
+	mu         sync.Mutex
+	sessions   map[int]*pollSession
+	queueSize  int
+	sessionTTL time.Duration
+}
+
+// Polls is the global long-polling hub
+var Polls = &PollHub{sessions: make(map[int]*pollSession), queueSize: 200, sessionTTL: time.Minute}
+
+// pollSeq numbers queued events. It starts at the process start time so cursors from before
+// a restart are never mistaken for current ones.
+var pollSeq atomic.Uint64
+
+func init() {
+	pollSeq.Store(uint64(time.Now().UnixNano()))
+}
+
+// StartPollSessions applies POLL_QUEUE_SIZE / POLL_SESSION_TTL and expires idle sessions
+func StartPollSessions(ctx context.Context, queueSize int, sessionTTL time.Duration) {
+	Polls.mu.Lock()
+	Polls.queueSize = max(queueSize, 1)
+	if sessionTTL > 0 {
+		Polls.sessionTTL = sessionTTL
+	}
+	ttl := Polls.sessionTTL
+	Polls.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(ttl / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, userID := range Polls.expire() {
+					Cluster.presenceChanged(userID)
+				}
+			}
+		}
+	}()
+	log.Printf("Long-polling sessions expire after %s", ttl)
+}
+
+// liveLocked reports whether s still counts as connected; h.mu must be held
+func (h *PollHub) liveLocked(s *pollSession) bool {
+	return s.waiters > 0 || time.Since(s.lastPoll) < h.sessionTTL
+}
+
+// active reports whether userID has a live poll session on this instance
+func (h *PollHub) active(userID int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.sessions[userID]
+	return ok && h.liveLocked(s)
+}
+
+// activeUsers lists users with a live poll session
+func (h *PollHub) activeUsers() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	users := make([]int, 0, len(h.sessions))
+	for userID, s := range h.sessions {
+		if h.liveLocked(s) {
+			users = append(users, userID)
+		}
+	}
+	return users
+}
+
+// expire drops idle sessions and returns their users
+func (h *PollHub) expire() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var expired []int
+	for userID, s := range h.sessions {
+		if !h.liveLocked(s) {
+			delete(h.sessions, userID)
+			expired = append(expired, userID)
+		}
+	}
+	return expired
+}
+
+// push queues an encoded event for userID if they are polling
+func (h *PollHub) push(userID int, b []byte) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.sessions[userID]
+	if !ok || !h.liveLocked(s) {
+		return false
+	}
+	s.events = append(s.events, PollEvent{Seq: pollSeq.Add(1), Event: b})
+	if over := len(s.events) - h.queueSize; over > 0 {
+		s.droppedThrough = s.events[over-1].Seq
+		s.events = append([]PollEvent(nil), s.events[over:]...)
+	}
+	close(s.wake)
+	s.wake = make(chan struct{})
+	return true
+}
+
+// deliver queues a SendToUser event for a polling user, with delivery metadata like a
+// connection gets. The poll is primary when the user has no WebSocket connection here. A
+// queued chat message counts as delivered.
+func (h *PollHub) deliver(userID int, message interface{}, deliveryID string, devices, messageID int) {
+	if !h.active(userID) {
+		return
+	}
+	payload := withDelivery(message, DeliveryMeta{ID: deliveryID, Devices: devices + 1, Primary: devices == 0})
+	b, err := json.Marshal(payload)
+	if err != nil {
+		utils.LogError(err, "poll deliver")
+		return
+	}
+	if h.push(userID, b) && messageID > 0 {
+		if written := deliveredTo(messageID, userID); written != nil {
+			written()
+		}
+	}
+}
+
+// poll returns the events after cursor, waiting up to hold for one to arrive. Without a
+// cursor it only opens the session and returns the current cursor. reset is true when
+// events after cursor were lost (queue overflow or an expired session); the client should
+// resync over REST and continue from the returned cursor.
+func (h *PollHub) poll(ctx context.Context, userID int, cursor uint64, hasCursor bool, hold time.Duration) (events []PollEvent, next uint64, reset bool) {
+	h.mu.Lock()
+	s, ok := h.sessions[userID]
+	created := !ok
+	if created {
+		s = &pollSession{wake: make(chan struct{})}
+		h.sessions[userID] = s
+	}
+	s.waiters++
+	s.lastPoll = time.Now()
+	h.mu.Unlock()
+	if created {
+		Cluster.presenceChanged(userID)
+	}
+	defer func() {
+		h.mu.Lock()
+		s.waiters--
+		s.lastPoll = time.Now()
+		h.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(hold)
+	defer timer.Stop()
+	for {
+		h.mu.Lock()
+		tail := pollSeq.Load()
+		if n := len(s.events); n > 0 {
+			tail = s.events[n-1].Seq
+		}
+		if !hasCursor {
+			h.mu.Unlock()
+			return nil, tail, false
+		}
+		reset = created || cursor < s.droppedThrough
+		for _, ev := range s.events {
+			if ev.Seq > cursor {
+				events = append(events, ev)
+			}
+		}
+		wake := s.wake
+		h.mu.Unlock()
+
+		if len(events) > 0 {
+			return events, events[len(events)-1].Seq, reset
+		}
+		if reset {
+			return nil, tail, true
+		}
+		select {
+		case <-wake:
+		case <-timer.C:
+			return nil, cursor, false
+		case <-ctx.Done():
+			return nil, cursor, false
+		}
+	}
+}
+
+// PollHandler is the long-polling fallback: GET /api/poll?cursor=<cursor>[&timeout=<seconds>]
+// returns the events queued for the caller after cursor, holding the request up to POLL_HOLD
+// (or timeout, if shorter) until one arrives. Events are the ones a WebSocket connection
+// gets outside rooms (notifications, badges, receipts, ...). Start without a cursor to get
+// one, then always pass the cursor from the previous response.
+func PollHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var cursor uint64
+		hasCursor := c.Query("cursor") != ""
+		if hasCursor {
+			var err error
+			if cursor, err = strconv.ParseUint(c.Query("cursor"), 10, 64); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid cursor"})
+			}
+		}
+		hold := utils.GetEnvDuration("POLL_HOLD", 25*time.Second)
+		if t := c.QueryInt("timeout", -1); t >= 0 && time.Duration(t)*time.Second < hold {
+			hold = time.Duration(t) * time.Second
+		}
+
+		events, next, reset := Polls.poll(c.UserContext(), c.Locals("user_id").(int), cursor, hasCursor, hold)
+		if events == nil {
+			events = []PollEvent{}
+		}
+		return c.JSON(fiber.Map{
+			"events": events,
+			"cursor": strconv.FormatUint(next, 10),
+			"reset":  reset,
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PresenceHandler returns the status and last_seen of up to PRESENCE_MAX_IDS users (default 200).
+// Status comes from the connection index (every instance when clustered); last_seen from the
+// users table. Unknown user IDs are left out of the response.
+func PresenceHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.PresenceRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		maxIDs := utils.GetEnvInt("PRESENCE_MAX_IDS", 200)
+		if len(req.UserIDs) == 0 || len(req.UserIDs) > maxIDs {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "user_ids must list between 1 and " + strconv.Itoa(maxIDs) + " users"})
+		}
+
+		lastSeen, err := chatService.GetLastSeen(c.UserContext(), req.UserIDs)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load presence"})
+		}
+
+		presence := make([]models.UserPresence, 0, len(req.UserIDs))
+		seen := make(map[int]bool, len(req.UserIDs))
+		for _, userID := range req.UserIDs {
+			at, exists := lastSeen[userID]
+			if !exists || seen[userID] {
+				continue
+			}
+			seen[userID] = true
+			p := models.UserPresence{UserID: userID, Status: UserStatus(userID)}
+			if p.Status == "offline" && at != nil {
+				p.LastSeen = at.UnixMilli()
+			}
+			presence = append(presence, p)
+		}
+		return c.JSON(fiber.Map{"presence": presence})
+	}
+}
+
+// UserPresenceHandler returns one user's status and, when offline, last_seen
+func UserPresenceHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := parseUserID(c)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+		}
+		lastSeen, err := chatService.GetLastSeen(c.UserContext(), []int{userID})
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load presence"})
+		}
+		at, exists := lastSeen[userID]
+		if !exists {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+		}
+		p := models.UserPresence{UserID: userID, Status: UserStatus(userID)}
+		if p.Status == "offline" && at != nil {
+			p.LastSeen = at.UnixMilli()
+		}
+		return c.JSON(p)
+	}
+}
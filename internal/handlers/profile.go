@@ -1,13 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"time"
 
+	"chat-backend/internal/models"
 	"chat-backend/internal/services"
 	"chat-backend/internal/utils"
 
@@ -18,7 +19,7 @@ import (
 func GetProfileHandler(userService *services.UserService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID := c.Locals("user_id").(int)
-		u, err := userService.GetProfile(c.Context(), userID)
+		u, err := userService.GetProfile(c.UserContext(), userID)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -36,37 +37,30 @@ func UploadPhotoHandler(userService *services.UserService) fiber.Handler {
 		if err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "photo file is required"})
 		}
-
-		uploadDir := utils.GetEnv("UPLOAD_DIR", "uploads")
-		// Ensure upload directory exists
-		if err := os.MkdirAll(uploadDir, 0755); err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create upload dir"})
+		if err := UploadPolicy.Check(UploadPhoto, fileHeader); err != nil {
+			return uploadPolicyError(c, err)
 		}
 
 		// Generate unique filename preserving extension
 		ext := filepath.Ext(fileHeader.Filename)
 		filename := fmt.Sprintf("%d_%d%s", userID, time.Now().UnixNano(), ext)
-		destPath := filepath.Join(uploadDir, filename)
 
-		if err := c.SaveFile(fileHeader, destPath); err != nil {
+		upload, err := services.SaveTempUpload(fileHeader, filename, nil)
+		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save file"})
 		}
+		defer upload.Discard()
 
-		// Build accessible URL (served from /uploads)
-		base := utils.GetEnv("BASE_URL", "")
-		var url string
-		if base == "" {
-			url = "/uploads/" + filename
-		} else {
-			url = fmt.Sprintf("%s/uploads/%s", base, filename)
-		}
-
-		photo, err := userService.AddPhoto(c.Context(), userID, filename, url)
+		// Build accessible URL (served from /uploads or the storage backend)
+		photo, err := userService.AddPhoto(c.UserContext(), userID, filename, services.PhotoURL(filename))
 		if err != nil {
-			// Try to cleanup file if DB insert fails
-			_ = os.Remove(destPath)
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
+		if err := upload.Publish(c.UserContext()); err != nil {
+			utils.LogError(err, "publish photo")
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save file"})
+		}
+		recordUpload(userID, fileHeader.Size)
 
 		return c.Status(http.StatusCreated).JSON(photo)
 	}
@@ -82,7 +76,10 @@ func DeletePhotoHandler(userService *services.UserService) fiber.Handler {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid photo id"})
 		}
 
-		if err := userService.DeletePhoto(c.Context(), userID, id); err != nil {
+		if err := userService.DeletePhoto(c.UserContext(), userID, id); err != nil {
+			if errors.Is(err, services.ErrLegalHold) {
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
@@ -90,6 +87,40 @@ func DeletePhotoHandler(userService *services.UserService) fiber.Handler {
 	}
 }
 
+// DeleteAccountHandler erases the signed-in user's account after checking the password in
+// the body, then closes the user's connections with an account_deleted event
+func DeleteAccountHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		var req models.DeleteAccountRequest
+		if err := c.BodyParser(&req); err != nil || req.Password == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "password is required"})
+		}
+
+		err := userService.DeleteAccount(c.UserContext(), userID, req.Password)
+		switch {
+		case errors.Is(err, services.ErrLegalHold), errors.Is(err, services.ErrLastAdmin):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+		case err != nil:
+			return passwordError(c, err)
+		}
+		// Outstanding access and refresh tokens stop working on the next request
+		forgetAccountStatus(userID)
+
+		event := map[string]interface{}{
+			"event":     "account_deleted",
+			"timestamp": time.Now().UnixMilli(),
+		}
+		for _, client := range Manager.GetConnectionsByUserID(userID) {
+			_ = client.Send(event)
+			client.CloseAfterPending(closePolicyViolation, "account deleted")
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
 // UpdateProfileHandler updates first_name and last_name for the authenticated user
 func UpdateProfileHandler(userService *services.UserService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -104,7 +135,29 @@ func UpdateProfileHandler(userService *services.UserService) fiber.Handler {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
 		}
 
-		updated, err := userService.UpdateProfile(c.Context(), userID, body.FirstName, body.LastName)
+		updated, err := userService.UpdateProfile(c.UserContext(), userID, body.FirstName, body.LastName)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(updated)
+	}
+}
+
+// UpdatePreferencesHandler updates the notification language and message preview setting
+func UpdatePreferencesHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+
+		var req models.UpdatePreferencesRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if req.Language != nil && (len(*req.Language) < 2 || len(*req.Language) > 16) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid language"})
+		}
+
+		updated, err := userService.UpdatePreferences(c.UserContext(), userID, req)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -112,3 +165,34 @@ func UpdateProfileHandler(userService *services.UserService) fiber.Handler {
 		return c.JSON(updated)
 	}
 }
+
+// GetNotificationSettingsHandler returns which notifications are sent, per event type
+// (message, mention, reaction, call) and channel (ws, push, email, sms)
+func GetNotificationSettingsHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		matrix, err := userService.GetNotificationMatrix(c.UserContext(), c.Locals("user_id").(int))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"notifications": matrix})
+	}
+}
+
+// UpdateNotificationSettingsHandler switches individual cells of the notification matrix,
+// e.g. {"notifications": {"message": {"push": false}}}; omitted cells are left unchanged
+func UpdateNotificationSettingsHandler(userService *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.UpdateNotificationSettingsRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		matrix, err := userService.UpdateNotificationMatrix(c.UserContext(), c.Locals("user_id").(int), req.Notifications)
+		if errors.Is(err, services.ErrInvalidNotificationSetting) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"notifications": matrix})
+	}
+}
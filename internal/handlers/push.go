@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Push delivers notifications to users without a live connection; nil when no push platform
+// is configured
+var Push *services.NotificationService
+
+// maxPushTokenLength matches device_tokens.token
+const maxPushTokenLength = 512
+
+// RegisterPushTokenHandler registers a push token of the caller's app. Apps should call it
+// on every start since tokens change.
+func RegisterPushTokenHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if Push == nil {
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "push notifications are not enabled"})
+		}
+		var req models.RegisterPushTokenRequest
+		if err := c.BodyParser(&req); err != nil || req.Token == "" || len(req.Token) > maxPushTokenLength {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "platform and token are required"})
+		}
+		token, err := Push.RegisterPushToken(c.UserContext(), c.Locals("user_id").(int), req.Platform, req.Token)
+		if errors.Is(err, services.ErrUnknownPushPlatform) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error(), "platform": req.Platform})
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(http.StatusCreated).JSON(token)
+	}
+}
+
+// UnregisterPushTokenHandler removes one of the caller's push tokens, e.g. at logout
+func UnregisterPushTokenHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if Push == nil {
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "push notifications are not enabled"})
+		}
+		var req models.UnregisterPushTokenRequest
+		if err := c.BodyParser(&req); err != nil || req.Token == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "token is required"})
+		}
+		err := Push.UnregisterPushToken(c.UserContext(), c.Locals("user_id").(int), req.Token)
+		if errors.Is(err, services.ErrNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "token not found"})
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
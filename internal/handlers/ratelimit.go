@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+var (
+	wsRateLimited = metrics.NewCounterVec("ws_rate_limited_total", "WebSocket events rejected by rate limits", "event")
+	wsRateWarned  = metrics.NewCounterVec("ws_rate_warnings_total", "rate_warning events sent to clients approaching a limit", "event")
+)
+
+// rateLimit allows Max events per Window
+type rateLimit struct {
+	Max    int
+	Window time.Duration
+}
+
+type rateKey struct {
+	userID int
+	event  string
+}
+
+// rateWindow is a fixed window counter for one user and event
+type rateWindow struct {
+	start  time.Time
+	count  int
+	warned bool
+}
+
+// wsRateLimiter limits WebSocket events per user across all of the user's connections.
+// Once the count in a window reaches the warning ratio the client gets one rate_warning
+// with the remaining quota, so it can throttle before events are rejected.
+type wsRateLimiter struct {
+	mu        sync.Mutex
+	limits    map[string]rateLimit // Event name, "*" for every other event
+	warnRatio float64
+	windows   map[rateKey]*rateWindow
+	lastSweep time.Time
+}
+
+// WSRateLimits is the global limiter; events are unlimited when no limits are configured
+var WSRateLimits = &wsRateLimiter{windows: make(map[rateKey]*rateWindow)}
+
+// parseRateLimits parses a spec such as "chat=30/10s,seen=60/10s,*=200/10s"
+func parseRateLimits(spec string) (map[string]rateLimit, error) {
+	limits := make(map[string]rateLimit)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		event, rule, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(event) == "" {
+			return nil, fmt.Errorf("invalid rate limit %q, expected <event>=<count>/<window>", entry)
+		}
+		limit, err := parseRateLimit(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit %q: %w", entry, err)
+		}
+		limits[strings.TrimSpace(event)] = limit
+	}
+	return limits, nil
+}
+
+// parseRateLimit parses a single "<count>/<window>" rule such as "30/10s"
+func parseRateLimit(rule string) (rateLimit, error) {
+	maxStr, windowStr, ok := strings.Cut(rule, "/")
+	if !ok {
+		return rateLimit{}, fmt.Errorf("expected <count>/<window>")
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(maxStr))
+	if err != nil || max <= 0 {
+		return rateLimit{}, fmt.Errorf("invalid count")
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(windowStr))
+	if err != nil || window <= 0 {
+		return rateLimit{}, fmt.Errorf("invalid window")
+	}
+	return rateLimit{Max: max, Window: window}, nil
+}
+
+// LoadWSRateLimits applies WS_RATE_LIMITS and WS_RATE_WARN_RATIO (default 0.8), and the
+// chat token bucket from WS_CHAT_RATE, WS_CHAT_BURST and WS_CHAT_RATE_MODE. Counters of the
+// current windows and buckets are kept, so a reload doesn't reset anyone's quota.
+func LoadWSRateLimits() error {
+	limits, err := parseRateLimits(utils.GetEnv("WS_RATE_LIMITS", ""))
+	if err != nil {
+		return err
+	}
+	ratio, err := strconv.ParseFloat(utils.GetEnv("WS_RATE_WARN_RATIO", "0.8"), 64)
+	if err != nil || ratio <= 0 || ratio > 1 {
+		return fmt.Errorf("WS_RATE_WARN_RATIO must be in (0, 1]")
+	}
+	rate, err := strconv.ParseFloat(utils.GetEnv("WS_CHAT_RATE", "5"), 64)
+	if err != nil || rate < 0 {
+		return fmt.Errorf("WS_CHAT_RATE must be a non-negative number of messages per second")
+	}
+	burst := utils.GetEnvInt("WS_CHAT_BURST", int(math.Ceil(2*rate)))
+	if rate > 0 && burst < 1 {
+		return fmt.Errorf("WS_CHAT_BURST must be at least 1")
+	}
+	mode := utils.GetEnv("WS_CHAT_RATE_MODE", "reject")
+	if mode != "reject" && mode != "drop" {
+		return fmt.Errorf("WS_CHAT_RATE_MODE must be reject or drop")
+	}
+
+	WSRateLimits.mu.Lock()
+	WSRateLimits.limits = limits
+	WSRateLimits.warnRatio = ratio
+	WSRateLimits.mu.Unlock()
+
+	WSChatBucket.mu.Lock()
+	WSChatBucket.rate = rate
+	WSChatBucket.burst = float64(burst)
+	WSChatBucket.drop = mode == "drop"
+	WSChatBucket.mu.Unlock()
+	return nil
+}
+
+// rateDecision is the outcome of counting one event
+type rateDecision struct {
+	allowed   bool
+	warn      bool // First time this window the count reached the warning ratio
+	limit     int
+	remaining int
+	resetAt   time.Time
+}
+
+// check counts an event for userID against its limit
+func (l *wsRateLimiter) check(userID int, event string, now time.Time) rateDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit, ok := l.limits[event]
+	if !ok {
+		if limit, ok = l.limits["*"]; !ok {
+			return rateDecision{allowed: true}
+		}
+	}
+	l.sweep(now)
+
+	key := rateKey{userID: userID, event: event}
+	w := l.windows[key]
+	if w == nil || now.Sub(w.start) >= limit.Window {
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+	d := rateDecision{limit: limit.Max, resetAt: w.start.Add(limit.Window)}
+	if w.count >= limit.Max {
+		return d
+	}
+	w.count++
+	d.allowed = true
+	d.remaining = limit.Max - w.count
+	if !w.warned && float64(w.count) >= l.warnRatio*float64(limit.Max) {
+		w.warned = true
+		d.warn = true
+	}
+	return d
+}
+
+// sweep drops windows that ended; called with mu held, at most once a minute
+func (l *wsRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, w := range l.windows {
+		limit, ok := l.limits[key.event]
+		if !ok {
+			limit = l.limits["*"]
+		}
+		if now.Sub(w.start) >= limit.Window {
+			delete(l.windows, key)
+		}
+	}
+}
+
+// allowEvent applies the rate limit to an incoming event, sending rate_warning when the
+// user nears the limit and rate_limited when the event is dropped
+func allowEvent(s *wsSession, event string) bool {
+	d := WSRateLimits.check(s.userID, event, time.Now())
+	if d.warn {
+		wsRateWarned.Inc(event)
+		s.send(map[string]interface{}{
+			"event":         "rate_warning",
+			"request_event": event,
+			"limit":         d.limit,
+			"remaining":     d.remaining,
+			"reset_at":      d.resetAt.UnixMilli(),
+		})
+	}
+	if !d.allowed {
+		wsRateLimited.Inc(event)
+		s.send(map[string]interface{}{
+			"event":          "rate_limited",
+			"request_event":  event,
+			"limit":          d.limit,
+			"reset_at":       d.resetAt.UnixMilli(),
+			"retry_after_ms": time.Until(d.resetAt).Milliseconds(),
+		})
+	}
+	return d.allowed
+}
+
+// tokenBucket holds the tokens a user has left, as of last
+type tokenBucket struct {
+	tokens  float64
+	last    time.Time
+	limited bool // Ran dry; in drop mode the client was told once
+}
+
+// chatRateLimiter is a per-user token bucket for chat messages: it refills at rate messages
+// per second up to burst, so short bursts pass while sustained floods are cut to the rate.
+type chatRateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // 0 disables the bucket
+	burst     float64
+	drop      bool // Drop excess messages quietly after one rate_limited instead of one per message
+	buckets   map[int]*tokenBucket
+	lastSweep time.Time
+}
+
+// WSChatBucket limits chat events per user across all of the user's connections
+var WSChatBucket = &chatRateLimiter{buckets: make(map[int]*tokenBucket)}
+
+// take spends a token of userID's bucket. notify is set when the client should get
+// rate_limited; retryAfter is when the next token is available.
+func (l *chatRateLimiter) take(userID int, now time.Time) (allowed, notify bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return true, false, 0
+	}
+	l.sweep(now)
+
+	b := l.buckets[userID]
+	if b == nil {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[userID] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = false
+		return true, false, 0
+	}
+	notify = !l.drop || !b.limited
+	b.limited = true
+	return false, notify, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that refilled completely; called with mu held, at most once a minute
+func (l *chatRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for userID, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, userID)
+		}
+	}
+}
+
+// allowChat applies the chat token bucket, sending rate_limited for rejected messages
+// (only for the first of a run in drop mode)
+func allowChat(s *wsSession) bool {
+	allowed, notify, retryAfter := WSChatBucket.take(s.userID, time.Now())
+	if allowed {
+		return true
+	}
+	wsRateLimited.Inc("chat")
+	if notify {
+		s.send(map[string]interface{}{
+			"event":          "rate_limited",
+			"request_event":  "chat",
+			"limit":          WSChatBucket.limitPerSecond(),
+			"reset_at":       time.Now().Add(retryAfter).UnixMilli(),
+			"retry_after_ms": retryAfter.Milliseconds(),
+		})
+	}
+	return false
+}
+
+func (l *chatRateLimiter) limitPerSecond() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// authRateLimited counts requests to login and registration rejected by AuthRateLimiter
+var authRateLimited = metrics.NewCounterVec("auth_rate_limited_total", "Login and registration requests rejected by rate limits", "endpoint")
+
+// AuthRateLimiter limits an endpoint to a "<count>/<window>" spec such as "10/1m" per key
+// (see ClientIPKey and LoginUsernameKey); an empty spec disables it
+func AuthRateLimiter(endpoint, spec string, key func(c *fiber.Ctx) string) (fiber.Handler, error) {
+	if strings.TrimSpace(spec) == "" {
+		return func(c *fiber.Ctx) error { return c.Next() }, nil
+	}
+	limit, err := parseRateLimit(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s rate limit %q: %w", endpoint, spec, err)
+	}
+	return limiter.New(limiter.Config{
+		Max:          limit.Max,
+		Expiration:   limit.Window,
+		KeyGenerator: key,
+		LimitReached: func(c *fiber.Ctx) error {
+			authRateLimited.Inc(endpoint)
+			// limiter has set Retry-After
+			return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": "too many requests, try again later"})
+		},
+	}), nil
+}
+
+// ClientIPKey rate limits per client address, as ClientIP finds it; a proxy header sent by
+// the client itself doesn't change the key
+func ClientIPKey(c *fiber.Ctx) string {
+	return ClientIP(c)
+}
+
+// LoginUsernameKey rate limits login attempts per account, whichever address they come from
+func LoginUsernameKey(c *fiber.Ctx) string {
+	var req models.LoginRequest
+	if err := c.BodyParser(&req); err != nil || req.Username == "" {
+		return "ip:" + ClientIP(c)
+	}
+	return "user:" + strings.ToLower(strings.TrimSpace(req.Username))
+}
+
+// FormUsernameKey rate limits per account like LoginUsernameKey, for sign-in forms such
+// as the OIDC authorize page that post the username as a form field
+func FormUsernameKey(c *fiber.Ctx) string {
+	username := strings.ToLower(strings.TrimSpace(c.FormValue("username")))
+	if username == "" {
+		return "ip:" + ClientIP(c)
+	}
+	return "user:" + username
+}
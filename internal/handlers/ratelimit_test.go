@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+func TestAuthRateLimiterIgnoresForgedProxyHeader(t *testing.T) {
+	useTrustedProxies(t, "X-Forwarded-For", "10.0.0.1")
+	limit, err := AuthRateLimiter("login", "3/1m", ClientIPKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Post("/api/login", limit, func(c *fiber.Ctx) error { return c.SendStatus(http.StatusNoContent) })
+	handler := app.Handler()
+
+	// A fresh forged address per request still lands in the bucket of the socket address
+	for i := 0; i < 4; i++ {
+		ctx := requestFrom(handler, "203.0.113.5", map[string]string{"X-Forwarded-For": fmt.Sprintf("198.51.100.%d", i)})
+		want := http.StatusNoContent
+		if i == 3 {
+			want = http.StatusTooManyRequests
+		}
+		if got := ctx.Response.StatusCode(); got != want {
+			t.Fatalf("request %d: status %d, want %d", i+1, got, want)
+		}
+	}
+
+	// Behind the trusted proxy each forwarded client has its own bucket
+	for i := 0; i < 2; i++ {
+		ctx := requestFrom(handler, "10.0.0.1", map[string]string{"X-Forwarded-For": fmt.Sprintf("1.2.3.4, 198.51.100.%d", i)})
+		if got := ctx.Response.StatusCode(); got != http.StatusNoContent {
+			t.Errorf("forwarded client %d: status %d, want %d", i, got, http.StatusNoContent)
+		}
+	}
+	ctx := requestFrom(handler, "10.0.0.1", map[string]string{"X-Forwarded-For": "203.0.113.5"})
+	if got := ctx.Response.StatusCode(); got != http.StatusTooManyRequests {
+		t.Errorf("limited client behind the proxy: status %d, want %d", got, http.StatusTooManyRequests)
+	}
+}
+
+func TestFormUsernameKey(t *testing.T) {
+	useTrustedProxies(t, "", "")
+	app := fiber.New()
+	app.Post("/api/login", func(c *fiber.Ctx) error { return c.SendString(FormUsernameKey(c)) })
+	handler := app.Handler()
+
+	for body, want := range map[string]string{
+		"username=+Alice+&password=x": "user:alice",
+		"password=x":                  "ip:203.0.113.5",
+	} {
+		ctx := requestFromWithBody(handler, "203.0.113.5", body)
+		if got := string(ctx.Response.Body()); got != want {
+			t.Errorf("FormUsernameKey(%q) = %q, want %q", body, got, want)
+		}
+	}
+}
+
+// requestFromWithBody posts a form body from the peer remote
+func requestFromWithBody(handler fasthttp.RequestHandler, remote, body string) *fasthttp.RequestCtx {
+	var req fasthttp.Request
+	req.SetRequestURI("/api/login")
+	req.Header.SetMethod(fiber.MethodPost)
+	req.Header.SetContentType(fiber.MIMEApplicationForm)
+	req.SetBodyString(body)
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, &net.TCPAddr{IP: net.ParseIP(remote), Port: 40000}, nil)
+	handler(&ctx)
+	return &ctx
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UploadProbeStatus is the outcome of the latest upload storage self-test
+type UploadProbeStatus struct {
+	Status              string     `json:"status"` // "ok", "failing" or "unknown" before the first run
+	CheckedAt           *time.Time `json:"checked_at,omitempty"`
+	LatencyMs           int64      `json:"latency_ms"`
+	Error               string     `json:"error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+}
+
+// uploadProbe holds the latest result of the upload storage self-test
+type uploadProbe struct {
+	mu     sync.RWMutex
+	status UploadProbeStatus
+}
+
+var (
+	uploadHealth = &uploadProbe{status: UploadProbeStatus{Status: "unknown"}}
+
+	uploadProbeFailures = metrics.NewCounter("upload_probe_failures_total", "Upload storage self-tests that failed")
+	_                   = metrics.NewGaugeFunc("upload_storage_healthy", "1 when the last upload storage self-test passed", func() float64 {
+		if uploadHealth.get().Status == "ok" {
+			return 1
+		}
+		return 0
+	})
+	_ = metrics.NewGaugeFunc("upload_probe_latency_seconds", "Duration of the last upload storage self-test", func() float64 {
+		return float64(uploadHealth.get().LatencyMs) / 1000
+	})
+)
+
+func (p *uploadProbe) get() UploadProbeStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.status
+}
+
+func (p *uploadProbe) record(err error, took time.Duration) {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.CheckedAt = &now
+	p.status.LatencyMs = took.Milliseconds()
+	if err != nil {
+		p.status.Status = "failing"
+		p.status.Error = err.Error()
+		p.status.ConsecutiveFailures++
+		return
+	}
+	p.status.Status = "ok"
+	p.status.Error = ""
+	p.status.ConsecutiveFailures = 0
+	p.status.LastSuccessAt = &now
+}
+
+// StartUploadProbe round-trips a probe file through the upload directory right away and then
+// every interval, so /readyz and metrics report a broken upload pipeline
+func StartUploadProbe(ctx context.Context, uploadDir string, interval time.Duration, size int) {
+	if interval <= 0 {
+		return
+	}
+	run := func() {
+		start := time.Now()
+		err := services.ProbeUploadStorage(uploadDir, size)
+		uploadHealth.record(err, time.Since(start))
+		if err != nil {
+			uploadProbeFailures.Inc()
+			utils.LogError(err, "upload storage probe")
+		}
+	}
+	go func() {
+		run()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	}()
+	log.Printf("Upload storage probe running every %s", interval)
+}
+
+// ReadyHandler reports whether this instance can serve traffic: the database answers and the
+// upload storage self-test passes. Load balancers should stop routing here on 503.
+func ReadyHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ready := true
+		database := fiber.Map{"status": "ok"}
+		ctx, cancel := context.WithTimeout(c.UserContext(), 2*time.Second)
+		defer cancel()
+		if err := db.Pool.Ping(ctx); err != nil {
+			ready = false
+			database = fiber.Map{"status": "failing", "error": err.Error()}
+		}
+		upload := uploadHealth.get()
+		if upload.Status == "failing" {
+			ready = false
+		}
+
+		status, code := "ready", http.StatusOK
+		if !ready {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+		return c.Status(code).JSON(fiber.Map{
+			"status": status,
+			"checks": fiber.Map{"database": database, "upload_storage": upload},
+		})
+	}
+}
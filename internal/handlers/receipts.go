@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var receiptFlushFailures = metrics.NewCounter("receipt_flush_failures_total", "Delivery receipt flushes that failed (their receipts are dropped)")
+
+// receiptMessageID returns the message a chat event or new_message notification carries,
+// 0 for events that don't count as delivering a message
+func receiptMessageID(message interface{}) int {
+	switch m := message.(type) {
+	case models.WSMessage:
+		if m.Event == "chat" {
+			return m.ID
+		}
+	case *models.WSMessage:
+		if m != nil && m.Event == "chat" {
+			return m.ID
+		}
+	case map[string]interface{}:
+		// Reactions are notified with the reacted message's id
+		if m["event"] == "new_message" && m["type"] != "reaction" {
+			id, _ := m["message_id"].(int)
+			return id
+		}
+	}
+	return 0
+}
+
+// deliveryKey is one message delivered to one recipient
+type deliveryKey struct {
+	messageID int
+	userID    int
+}
+
+// ReceiptRecorder collects deliveries reported by connection writers and records them every
+// interval; senders get message_delivered once per recipient.
+type ReceiptRecorder struct {
+	chatService *services.ChatService
+
+	mu      sync.Mutex
+	pending map[deliveryKey]struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Receipts is the global receipt recorder; nil disables delivery receipts
+var Receipts *ReceiptRecorder
+
+// StartReceiptRecorder enables delivery receipts, flushing every interval. A non-positive interval disables them.
+func StartReceiptRecorder(chatService *services.ChatService, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	Receipts = &ReceiptRecorder{
+		chatService: chatService,
+		pending:     make(map[deliveryKey]struct{}),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go Receipts.run(interval)
+}
+
+func (r *ReceiptRecorder) run(interval time.Duration) {
+	defer close(r.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			r.Flush()
+			return
+		case <-ticker.C:
+			r.Flush()
+		}
+	}
+}
+
+// deliveredTo returns the callback a connection writer runs once it wrote messageID to
+// userID; nil when receipts are disabled
+func deliveredTo(messageID, userID int) func() {
+	if Receipts == nil {
+		return nil
+	}
+	return func() {
+		Receipts.mu.Lock()
+		Receipts.pending[deliveryKey{messageID: messageID, userID: userID}] = struct{}{}
+		Receipts.mu.Unlock()
+	}
+}
+
+// Flush records the pending deliveries and notifies their senders
+func (r *ReceiptRecorder) Flush() {
+	r.mu.Lock()
+	batch := r.pending
+	r.pending = make(map[deliveryKey]struct{})
+	r.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	deliveries := make([]services.Delivery, 0, len(batch))
+	for k := range batch {
+		deliveries = append(deliveries, services.Delivery{MessageID: k.messageID, UserID: k.userID})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	receipts, err := r.chatService.RecordDeliveries(ctx, deliveries)
+	if err != nil {
+		receiptFlushFailures.Inc()
+		utils.LogError(err, "RecordDeliveries")
+		return
+	}
+	for _, receipt := range receipts {
+		if receipt.SenderID == 0 {
+			continue
+		}
+		Manager.SendToUser(receipt.SenderID, map[string]interface{}{
+			"event":        "message_delivered",
+			"id":           receipt.MessageID,
+			"room":         receipt.Room,
+			"user_id":      receipt.UserID,
+			"username":     receipt.Username,
+			"delivered_at": receipt.DeliveredAt.UnixMilli(),
+			"timestamp":    time.Now().UnixMilli(),
+		})
+	}
+}
+
+// StopReceiptRecorder records the pending deliveries on shutdown
+func StopReceiptRecorder() {
+	if Receipts != nil {
+		close(Receipts.stop)
+		<-Receipts.done
+	}
+}
+
+// MessageReceiptsHandler lists per-recipient delivered and seen times of the caller's message
+func MessageReceiptsHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, ok := parseMessageID(c)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid message id"})
+		}
+		receipts, err := chatService.GetMessageReceipts(c.UserContext(), id, c.Locals("user_id").(int))
+		if errors.Is(err, services.ErrNotMessageSender) {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "only the sender can see receipts"})
+		}
+		if err != nil {
+			return messageEditError(c, err)
+		}
+		return c.JSON(fiber.Map{"message_id": id, "receipts": receipts})
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// Close codes defined by RFC 6455 / IANA for server-initiated disconnects
+const (
+	closeServiceRestart = 1012
+	closeTryAgainLater  = 1013
+)
+
+// ReconnectHints tells clients how to back off before reconnecting
+type ReconnectHints struct {
+	MinBackoffMs     int64    `json:"min_backoff_ms"`
+	MaxBackoffMs     int64    `json:"max_backoff_ms"`
+	JitterMs         int64    `json:"jitter_ms"`
+	AlternativeHosts []string `json:"alternative_hosts,omitempty"`
+}
+
+// wsEndpoints returns the configured websocket endpoints (WS_ENDPOINTS, comma separated)
+func wsEndpoints() []string {
+	var endpoints []string
+	for _, e := range strings.Split(utils.GetEnv("WS_ENDPOINTS", ""), ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints
+}
+
+// currentReconnectHints builds hints from env configuration
+func currentReconnectHints() ReconnectHints {
+	return ReconnectHints{
+		MinBackoffMs:     utils.GetEnvDuration("WS_RECONNECT_MIN_BACKOFF", time.Second).Milliseconds(),
+		MaxBackoffMs:     utils.GetEnvDuration("WS_RECONNECT_MAX_BACKOFF", 30*time.Second).Milliseconds(),
+		JitterMs:         utils.GetEnvDuration("WS_RECONNECT_JITTER", 2*time.Second).Milliseconds(),
+		AlternativeHosts: wsEndpoints(),
+	}
+}
+
+// closeReason encodes hints compactly for the close frame, which is limited to 123 bytes.
+// Alternative hosts are dropped if they don't fit; clients can still use /api/ws-endpoints.
+func (h ReconnectHints) closeReason() string {
+	compact := map[string]interface{}{"min": h.MinBackoffMs, "max": h.MaxBackoffMs, "jit": h.JitterMs}
+	if len(h.AlternativeHosts) > 0 {
+		compact["alt"] = h.AlternativeHosts[0]
+	}
+	b, _ := json.Marshal(compact)
+	if len(b) > 123 {
+		delete(compact, "alt")
+		b, _ = json.Marshal(compact)
+	}
+	return string(b)
+}
+
+// closeWithHints writes a close frame carrying reconnect hints and closes the connection
+func closeWithHints(c *websocket.Conn, code int, hints ReconnectHints) {
+	msg := websocket.FormatCloseMessage(code, hints.closeReason())
+	_ = c.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	_ = c.Close()
+}
+
+// Shutdown notifies every connected client with a server_shutdown event, then closes
+// each connection with a Service Restart close frame carrying the same hints.
+func (m *RoomManager) Shutdown(hints ReconnectHints) {
+	m.mu.RLock()
+	clients := make([]*wsClient, 0, len(m.connMeta))
+	for _, meta := range m.connMeta {
+		if meta.Client != nil {
+			clients = append(clients, meta.Client)
+		}
+	}
+	m.mu.RUnlock()
+
+	event := map[string]interface{}{
+		"event":     "server_shutdown",
+		"reconnect": hints,
+		"timestamp": time.Now().UnixMilli(),
+	}
+	for _, c := range clients {
+		// The close frame follows the event once the client's queue is written
+		_ = c.Send(event)
+		c.CloseAfterPending(closeServiceRestart, hints.closeReason())
+	}
+	// Give writers a moment to flush before the server stops
+	deadline := time.After(utils.GetEnvDuration("WS_SHUTDOWN_FLUSH_TIMEOUT", 2*time.Second))
+	for _, c := range clients {
+		select {
+		case <-c.done:
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// ShutdownConnections is called during graceful shutdown before the HTTP server stops
+func ShutdownConnections() {
+	Manager.Shutdown(currentReconnectHints())
+}
+
+// WSEndpointsHandler lists the websocket endpoints clients may connect to, along with the
+// reconnect policy. When WS_ENDPOINTS is not configured the current host is returned.
+func WSEndpointsHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		endpoints := wsEndpoints()
+		if len(endpoints) == 0 {
+			scheme := "ws"
+			if c.Protocol() == "https" || c.Get("X-Forwarded-Proto") == "https" {
+				scheme = "wss"
+			}
+			endpoints = []string{scheme + "://" + c.Hostname() + "/ws"}
+		}
+
+		hints := currentReconnectHints()
+		hints.AlternativeHosts = nil
+		return c.JSON(fiber.Map{
+			"endpoints": endpoints,
+			"reconnect": hints,
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// reloadMu serializes reloads triggered by SIGHUP and the admin endpoint
+var reloadMu sync.Mutex
+
+// ConfigReloadResult lists what a reload applied and what it rejected
+type ConfigReloadResult struct {
+	Reloaded []string          `json:"reloaded"`
+	Errors   map[string]string `json:"errors,omitempty"` // Section -> error; those keep their previous values
+}
+
+// ReloadConfig re-reads the .env file and re-applies the settings that are cached at startup:
+// log level, feature flags, event classes, IP filter, upload policy, WS rate limits, notification templates and provider
+// policies. Values read on every use (limits such as WS_MAX_CONNECTIONS, SUPPORT_AGENTS, ...)
+// take effect as soon as the environment is reloaded. WebSocket connections are untouched.
+func ReloadConfig() ConfigReloadResult {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	res := ConfigReloadResult{Reloaded: []string{}, Errors: map[string]string{}}
+	apply := func(section string, err error) {
+		if err != nil {
+			res.Errors[section] = err.Error()
+			return
+		}
+		res.Reloaded = append(res.Reloaded, section)
+	}
+
+	if err := utils.ReloadEnv(); err != nil {
+		apply("env", err)
+		return res
+	}
+	apply("env", nil)
+	apply("log_level", utils.SetLogLevel(utils.GetEnv("LOG_LEVEL", "info")))
+	services.LoadFeatureFlags()
+	apply("features", nil)
+	apply("event_classes", services.SetEventClasses(utils.GetEnv("EVENT_CLASSES", "")))
+	apply("ip_filter", IPFilterInstance.Update(ipFilterConfigFromEnv()))
+	apply("upload_policy", InitUploadPolicy())
+	apply("ws_rate_limits", LoadWSRateLimits())
+	apply("ws_event_policy", LoadWSEventPolicy())
+	if Notifications != nil {
+		templates, err := services.LoadNotificationTemplates(utils.GetEnv("NOTIFICATION_TEMPLATES_FILE", ""))
+		if err == nil {
+			Notifications.Replace(templates)
+		}
+		apply("notification_templates", err)
+	}
+	services.ReloadProviderPolicies()
+	apply("providers", nil)
+
+	log.Printf("Configuration reloaded: %v", res.Reloaded)
+	for section, err := range res.Errors {
+		log.Printf("Configuration reload kept previous %s: %s", section, err)
+	}
+	return res
+}
+
+// WatchReloadSignal reloads the configuration on every SIGHUP until ctx is cancelled
+func WatchReloadSignal(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				ReloadConfig()
+			}
+		}
+	}()
+}
+
+// AdminReloadConfigHandler reloads the configuration; responds 207 when a section was rejected
+func AdminReloadConfigHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		res := ReloadConfig()
+		if len(res.Errors) > 0 {
+			return c.Status(http.StatusMultiStatus).JSON(res)
+		}
+		return c.JSON(res)
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxLockReasonLength = 200
+
+// roomLockError maps lockdown and post mode service errors onto HTTP responses
+func roomLockError(c *fiber.Ctx, err error) error {
+	if code := postModeCode(err); code != "" {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error(), "code": code})
+	}
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "room not found or not locked"})
+	case errors.Is(err, services.ErrNotMember):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrForbiddenRole), errors.Is(err, services.ErrRoomLocked):
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// checkCanPost is the lockdown and post mode check for WS events; internal failures are
+// logged, not sent
+func checkCanPost(ctx context.Context, chatService *services.ChatService, roomID string, userID int, kind string) error {
+	err := chatService.CheckCanPost(ctx, roomID, userID, kind)
+	if err == nil || errors.Is(err, services.ErrRoomLocked) || postModeCode(err) != "" {
+		return err
+	}
+	utils.LogError(err, "CheckCanPost")
+	return errors.New("failed to check room lock")
+}
+
+// roomLockedEvent is broadcast to every participant when a lockdown starts
+func roomLockedEvent(lock *models.RoomLock) map[string]interface{} {
+	var until int64
+	if lock.LockedUntil != nil {
+		until = lock.LockedUntil.UnixMilli()
+	}
+	return map[string]interface{}{
+		"event":        "room_locked",
+		"room":         lock.Room,
+		"locked_until": until, // Unix ms, 0 until unlocked by hand
+		"reason":       lock.Reason,
+		"actor_id":     lock.LockedBy,
+		"timestamp":    lock.LockedAt.UnixMilli(),
+	}
+}
+
+// LockRoomHandler locks a room so only its owners and admins can post, and sends room_locked
+// to every participant. The app admin may lock any room.
+func LockRoomHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.LockRoomRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+			}
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Duration < 0 || len(req.Reason) > maxLockReasonLength {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "duration must not be negative and reason at most 200 characters"})
+		}
+		var until *time.Time
+		if req.Duration > 0 {
+			t := time.Now().Add(time.Duration(req.Duration) * time.Second)
+			until = &t
+		}
+
+		roomID := c.Params("id")
+		lock, err := chatService.LockRoom(c.UserContext(), roomID, c.Locals("user_id").(int), until, req.Reason, isAppAdmin(c))
+		if err != nil {
+			return roomLockError(c, err)
+		}
+		notifyRoomParticipantsOf(c, chatService, roomID, roomLockedEvent(lock))
+		return c.JSON(lock)
+	}
+}
+
+// UnlockRoomHandler lifts a lockdown and sends room_unlocked to every participant
+func UnlockRoomHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roomID := c.Params("id")
+		actorID := c.Locals("user_id").(int)
+		if err := chatService.UnlockRoom(c.UserContext(), roomID, actorID, isAppAdmin(c)); err != nil {
+			return roomLockError(c, err)
+		}
+		notifyRoomParticipantsOf(c, chatService, roomID, map[string]interface{}{
+			"event":     "room_unlocked",
+			"room":      roomID,
+			"actor_id":  actorID,
+			"timestamp": time.Now().UnixMilli(),
+		})
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// StartRoomUnlocker periodically lifts lockdowns whose locked_until has passed and sends
+// room_unlocked without an actor. It stops when ctx is cancelled.
+func StartRoomUnlocker(ctx context.Context, chatService *services.ChatService, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				rooms, err := chatService.UnlockExpiredRooms(ctx)
+				if err != nil {
+					utils.LogError(err, "UnlockExpiredRooms")
+					continue
+				}
+				for _, roomID := range rooms {
+					notifyParticipants(ctx, chatService, roomID, map[string]interface{}{
+						"event":     "room_unlocked",
+						"room":      roomID,
+						"timestamp": time.Now().UnixMilli(),
+					})
+				}
+				if len(rooms) > 0 {
+					log.Printf("Unlocked %d rooms whose lockdown expired", len(rooms))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// postModeCode is the error code sent when a post breaks the room's post mode, "" for other errors
+func postModeCode(err error) string {
+	switch {
+	case errors.Is(err, services.ErrVoiceOnlyRoom):
+		return "voice_only_room"
+	case errors.Is(err, services.ErrTextOnlyRoom):
+		return "text_only_room"
+	}
+	return ""
+}
+
+// GetRoomPostModeHandler returns which messages the room accepts
+func GetRoomPostModeHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		mode, err := chatService.GetRoomPostMode(c.UserContext(), c.Params("id"))
+		if err != nil {
+			if errors.Is(err, services.ErrNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "room not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(mode)
+	}
+}
+
+// UpdateRoomPostModeHandler restricts the room to voice or text messages ("any" lifts it) and
+// sends room_post_mode to everyone viewing the room. Owners and admins only.
+func UpdateRoomPostModeHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.UpdatePostModeRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		mode, err := chatService.SetRoomPostMode(c.UserContext(), c.Params("id"), c.Locals("user_id").(int), req.Mode, isAppAdmin(c))
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidPostMode) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return roomLockError(c, err)
+		}
+		Manager.Broadcast(mode.Room, map[string]interface{}{
+			"event": "room_post_mode",
+			"room":  mode.Room,
+			"mode":  mode.Mode,
+		}, "")
+		return c.JSON(mode)
+	}
+}
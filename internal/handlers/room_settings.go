@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UpdateRoomSettingsHandler updates the caller's settings for a room (currently muting)
+func UpdateRoomSettingsHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.UpdateRoomSettingsRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		var until *time.Time
+		mute := req.Muted != nil && *req.Muted
+		if req.MutedUntil != nil && *req.MutedUntil != 0 {
+			t := time.UnixMilli(*req.MutedUntil)
+			if !t.After(time.Now()) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "muted_until must be in the future"})
+			}
+			until, mute = &t, true
+		} else if req.Muted == nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "muted or muted_until is required"})
+		}
+
+		settings, err := chatService.SetRoomMute(c.UserContext(), c.Params("id"), c.Locals("user_id").(int), mute, until)
+		if err != nil {
+			if errors.Is(err, services.ErrNotMember) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update room settings"})
+		}
+		return c.JSON(settings)
+	}
+}
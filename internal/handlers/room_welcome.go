@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var welcomesSkipped = metrics.NewCounter("room_welcomes_skipped_total", "Welcome messages not posted because the room hit ROOM_WELCOME_RATE_LIMIT")
+
+// welcomeLimiter caps welcome messages per room, so adding many members at once doesn't
+// flood the room with them
+var welcomeLimiter = struct {
+	sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}{windows: make(map[string]*rateWindow)}
+
+// allowWelcome counts a welcome message for roomID against ROOM_WELCOME_RATE_LIMIT
+func allowWelcome(roomID string, now time.Time) bool {
+	limit, err := parseRateLimit(utils.GetEnv("ROOM_WELCOME_RATE_LIMIT", "5/1m"))
+	if err != nil {
+		return true
+	}
+	welcomeLimiter.Lock()
+	defer welcomeLimiter.Unlock()
+
+	if now.Sub(welcomeLimiter.lastSweep) >= time.Minute {
+		welcomeLimiter.lastSweep = now
+		for room, w := range welcomeLimiter.windows {
+			if now.Sub(w.start) >= limit.Window {
+				delete(welcomeLimiter.windows, room)
+			}
+		}
+	}
+	w := welcomeLimiter.windows[roomID]
+	if w == nil || now.Sub(w.start) >= limit.Window {
+		w = &rateWindow{start: now}
+		welcomeLimiter.windows[roomID] = w
+	}
+	if w.count >= limit.Max {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// welcomeNewMember posts the room's welcome message for a member_added event. fallback is
+// the template used when the room has none ("" posts nothing).
+func welcomeNewMember(chatService *services.ChatService, ev *models.MembershipEvent, fallback string) {
+	if ev == nil || ev.Event != "member_added" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	welcome, err := chatService.GetRoomWelcome(ctx, ev.Room)
+	if err != nil {
+		utils.LogError(err, "GetRoomWelcome")
+		return
+	}
+	template := fallback
+	if welcome.Message != nil {
+		template = *welcome.Message
+	}
+	if template == "" {
+		return
+	}
+	if !allowWelcome(ev.Room, time.Now()) {
+		welcomesSkipped.Inc()
+		return
+	}
+	text := strings.NewReplacer("{username}", ev.Username, "{room}", welcome.RoomName).Replace(template)
+	if err := postSystemMessage(chatService, ev.Room, text); err != nil {
+		utils.LogError(err, "post welcome message")
+	}
+}
+
+// GetRoomWelcomeHandler returns the room's welcome message
+func GetRoomWelcomeHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		welcome, err := chatService.GetRoomWelcome(c.UserContext(), c.Params("id"))
+		if err != nil {
+			return groupError(c, err)
+		}
+		return c.JSON(welcome)
+	}
+}
+
+// UpdateRoomWelcomeHandler sets the message the bot posts for every new member, with
+// {username} and {room} substituted. Owners and admins only.
+func UpdateRoomWelcomeHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.UpdateRoomWelcomeRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		welcome, err := chatService.SetRoomWelcome(c.UserContext(), c.Params("id"), c.Locals("user_id").(int), req.Message, isAppAdmin(c))
+		if errors.Is(err, services.ErrWelcomeTooLong) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return groupError(c, err)
+		}
+		return c.JSON(welcome)
+	}
+}
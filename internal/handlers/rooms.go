@@ -1,120 +1,232 @@
 package handlers
 
 import (
+	"encoding/json"
 	"sync"
+	"time"
 
+	"chat-backend/internal/models"
 	"chat-backend/internal/utils"
 
-	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
 )
 
+// Rooms tracks which connections view which rooms and fans events out to them. RoomManager
+// is the websocket implementation; MemoryRooms records deliveries in memory instead, for
+// exercising notification and presence logic without sockets.
+type Rooms interface {
+	Join(room string, connID string, c *wsClient, userID int, username string)
+	Leave(room string, connID string)
+	RegisterConnection(connID string, userID int, username string, client *wsClient) bool
+	UnregisterConnection(connID string) bool
+	Broadcast(room string, message interface{}, excludeConnID string)
+	BroadcastToAll(message interface{})
+	SendToUser(userID int, message interface{})
+	SendToUsers(userIDs []int, message interface{})
+	IsUserOnline(userID int) bool
+	IsUserInRoom(userID int, roomID string) bool
+	GetUserCurrentRoom(userID int) string
+	GetConnectionsByUserID(userID int) []*wsClient
+	CountUserConnections(userID int) int
+	Stats() ManagerStats
+	Shutdown(hints ReconnectHints)
+
+	// Calls ringing or running, kept in step across instances by the cluster bus
+	StartCall(call models.Call) error
+	AnswerCall(callID string, userID int) (models.Call, error)
+	GetCall(callID string) (models.Call, bool)
+	EndCall(callID string) (models.Call, bool)
+	UserCalls(userID int) []models.Call
+
+	// Instance-local parts used by the cluster bus, the reaper and presence
+	broadcastLocal(room string, b []byte, excludeConnID string, messageID int)
+	broadcastAllLocal(b []byte)
+	sendAllLocal(message interface{})
+	sendToUserLocal(userID int, message interface{}, deliveryID string, messageID int)
+	userActiveLocal(userID int) bool
+	localPresence(userID int) (online bool, rooms []string)
+	presenceSnapshot() map[int][]string
+	reapStale(timeout time.Duration) []reapedConn
+	applyCallLocal(call models.Call, ended bool)
+}
+
 type RoomManager struct {
-	// roomName -> connectionID -> *websocket.Conn
-	rooms map[string]map[string]*websocket.Conn
+	// roomName -> connectionID -> client
+	rooms map[string]map[string]*wsClient
 	mu    sync.RWMutex
 	// connID -> metadata (includes connection reference)
 	connMeta map[string]ConnMeta
+	// userID -> number of connections, so presence lookups don't scan connMeta
+	userConns map[int]int
+	calls     callTracker
 }
 
-var Manager = &RoomManager{
-	rooms:    make(map[string]map[string]*websocket.Conn),
-	connMeta: make(map[string]ConnMeta),
+// Manager is the global room manager; tests may swap in a MemoryRooms
+var Manager Rooms = NewRoomManager()
+
+func NewRoomManager() *RoomManager {
+	return &RoomManager{
+		rooms:     make(map[string]map[string]*wsClient),
+		connMeta:  make(map[string]ConnMeta),
+		userConns: make(map[int]int),
+	}
 }
 
 type ConnMeta struct {
-	UserID   int
-	Username string
-	Conn     *websocket.Conn
+	UserID      int
+	Username    string
+	Client      *wsClient
+	ConnectedAt time.Time
 }
 
-func (m *RoomManager) Join(room string, connID string, c *websocket.Conn, userID int, username string) {
+func (m *RoomManager) Join(room string, connID string, c *wsClient, userID int, username string) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	if _, ok := m.rooms[room]; !ok {
-		m.rooms[room] = make(map[string]*websocket.Conn)
+		m.rooms[room] = make(map[string]*wsClient)
 	}
 	m.rooms[room][connID] = c
 	// store/update metadata with connection
-	m.connMeta[connID] = ConnMeta{UserID: userID, Username: username, Conn: c}
+	meta, registered := m.connMeta[connID]
+	if !registered {
+		m.userConns[userID]++
+	}
+	meta.UserID, meta.Username, meta.Client = userID, username, c
+	if meta.ConnectedAt.IsZero() {
+		meta.ConnectedAt = clock.Now()
+	}
+	m.connMeta[connID] = meta
+	m.mu.Unlock()
+
+	Cluster.presenceChanged(userID)
 }
 
 func (m *RoomManager) Leave(room string, connID string) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	if _, ok := m.rooms[room]; ok {
 		delete(m.rooms[room], connID)
 		if len(m.rooms[room]) == 0 {
 			delete(m.rooms, room)
 		}
 	}
+	meta, ok := m.connMeta[connID]
+	m.mu.Unlock()
+
+	if ok {
+		Cluster.presenceChanged(meta.UserID)
+	}
 }
 
+// Broadcast sends message to the room's viewers on every instance. Chat events are
+// recorded as delivered to each viewer once written to their connection.
 func (m *RoomManager) Broadcast(room string, message interface{}, excludeConnID string) {
+	// Encode once; each client's writer goroutine sends the frame
+	b, err := json.Marshal(message)
+	if err != nil {
+		utils.LogError(err, "Broadcast")
+		return
+	}
+	messageID := receiptMessageID(message)
+	m.broadcastLocal(room, b, excludeConnID, messageID)
+	Cluster.publish(clusterEvent{Kind: clusterRoom, Room: room, Exclude: excludeConnID, MessageID: messageID, Payload: b})
+}
+
+// broadcastLocal sends an encoded event to the room's viewers on this instance; a non-zero
+// messageID records delivery receipts and, for a timed message, its delivery latency
+func (m *RoomManager) broadcastLocal(room string, b []byte, excludeConnID string, messageID int) {
+	timed := deliveries.timed(messageID)
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if connections, ok := m.rooms[room]; ok {
-		for id, conn := range connections {
-			if id == excludeConnID {
-				continue
-			}
-			// Note: In a real high-scale app, you might want to use a channel per connection
-			// to avoid blocking the broadcaster if one client is slow.
-			// For this example, we write directly but handle errors.
-			if err := utils.SendJSON(conn, message); err != nil {
-				utils.LogError(err, "Broadcast")
-				// If write fails, we might want to close and remove the connection,
-				// but we'll let the read loop handle the disconnection.
-			}
+	for id, client := range m.rooms[room] {
+		if id == excludeConnID {
+			continue
+		}
+		frame := wsFrame{b: b}
+		if messageID > 0 {
+			frame.written = deliveredTo(messageID, m.connMeta[id].UserID)
+		}
+		if timed {
+			frame.written = chainWritten(frame.written, deliveries.queued(messageID))
 		}
+		// A full queue evicts the client; its read loop then unregisters it
+		if err := client.enqueueFrame(frame); err != nil && timed {
+			deliveries.done(messageID, true)
+		}
+	}
+	if timed {
+		deliveries.seal(messageID)
 	}
 }
 
+// BroadcastToAll sends message to every viewer of any room on every instance
 func (m *RoomManager) BroadcastToAll(message interface{}) {
+	b, err := json.Marshal(message)
+	if err != nil {
+		utils.LogError(err, "BroadcastToAll")
+		return
+	}
+	m.broadcastAllLocal(b)
+	Cluster.publish(clusterEvent{Kind: clusterAll, Payload: b})
+}
+
+func (m *RoomManager) broadcastAllLocal(b []byte) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	for _, connections := range m.rooms {
-		for _, conn := range connections {
-			if err := utils.SendJSON(conn, message); err != nil {
-				utils.LogError(err, "BroadcastToAll")
-			}
+		for _, client := range connections {
+			_ = client.enqueue(b)
 		}
 	}
 }
 
-// IsUserOnline checks if any active connection belongs to the given user
-func (m *RoomManager) IsUserOnline(userID int) bool {
+// sendAllLocal sends message to every connection on this instance, viewing a room or not
+func (m *RoomManager) sendAllLocal(message interface{}) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
-
+	clients := make([]*wsClient, 0, len(m.connMeta))
 	for _, meta := range m.connMeta {
-		if meta.UserID == userID {
-			return true
+		if meta.Client != nil {
+			clients = append(clients, meta.Client)
 		}
 	}
-	return false
+	m.mu.RUnlock()
+
+	for _, c := range clients {
+		_ = c.Send(message)
+	}
+}
+
+// IsUserOnline checks if any active connection, on any instance, belongs to the given user
+func (m *RoomManager) IsUserOnline(userID int) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.userConns[userID] > 0 || Polls.active(userID) || Cluster.userOnline(userID)
+}
+
+// userActiveLocal reports whether userID is connected to this instance and not away
+func (m *RoomManager) userActiveLocal(userID int) bool {
+	m.mu.RLock()
+	connected := m.userConns[userID] > 0
+	m.mu.RUnlock()
+	return connected && !Activity.away(userID)
 }
 
 // RegisterConnection stores metadata for a new websocket connection
 // Returns true if this is the first connection for this user (user just came online)
-func (m *RoomManager) RegisterConnection(connID string, userID int, username string, conn *websocket.Conn) bool {
+func (m *RoomManager) RegisterConnection(connID string, userID int, username string, client *wsClient) bool {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	// Check if user was already online before adding this connection
-	wasOnline := false
-	for _, meta := range m.connMeta {
-		if meta.UserID == userID {
-			wasOnline = true
-			break
-		}
+	wasOnline := m.userConns[userID] > 0
+	if _, exists := m.connMeta[connID]; !exists {
+		m.userConns[userID]++
 	}
+	m.connMeta[connID] = ConnMeta{UserID: userID, Username: username, Client: client, ConnectedAt: clock.Now()}
+	m.mu.Unlock()
 
-	m.connMeta[connID] = ConnMeta{UserID: userID, Username: username, Conn: conn}
-
+	if !wasOnline {
+		Cluster.presenceChanged(userID)
+	}
 	// Return true if user just came online (wasn't online before)
 	return !wasOnline
 }
@@ -123,14 +235,48 @@ func (m *RoomManager) RegisterConnection(connID string, userID int, username str
 // Returns true if this was the last connection for the user (user is now offline)
 func (m *RoomManager) UnregisterConnection(connID string) bool {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	wentOffline, userID, exists := m.unregister(connID)
+	m.mu.Unlock()
+
+	if exists {
+		Cluster.presenceChanged(userID)
+	}
+	return wentOffline
+}
 
+// reapedConn is a connection removed by reapStale
+type reapedConn struct {
+	meta        ConnMeta
+	wentOffline bool
+}
+
+// reapStale unregisters the connections whose client has been silent for longer than timeout
+func (m *RoomManager) reapStale(timeout time.Duration) []reapedConn {
+	m.mu.Lock()
+	var reaped []reapedConn
+	for connID, meta := range m.connMeta {
+		if meta.Client == nil || meta.Client.idle() <= timeout {
+			continue
+		}
+		wentOffline, _, _ := m.unregister(connID)
+		reaped = append(reaped, reapedConn{meta: meta, wentOffline: wentOffline})
+	}
+	m.mu.Unlock()
+
+	for _, r := range reaped {
+		Cluster.presenceChanged(r.meta.UserID)
+	}
+	return reaped
+}
+
+// unregister does the work of UnregisterConnection; m.mu must be held
+func (m *RoomManager) unregister(connID string) (wentOffline bool, userID int, exists bool) {
 	// Get the user ID before removing
 	meta, exists := m.connMeta[connID]
 	if !exists {
-		return false
+		return false, 0, false
 	}
-	userID := meta.UserID
+	userID = meta.UserID
 
 	// Remove conn from all rooms
 	for room, conns := range m.rooms {
@@ -146,39 +292,101 @@ func (m *RoomManager) UnregisterConnection(connID string) bool {
 	delete(m.connMeta, connID)
 
 	// Check if user has any remaining connections
-	for _, m := range m.connMeta {
-		if m.UserID == userID {
-			return false // User still has other connections, still online
-		}
+	if m.userConns[userID]--; m.userConns[userID] > 0 {
+		return false, userID, true // User still has other connections, still online
 	}
-
-	return true // This was the last connection, user is now offline
+	delete(m.userConns, userID)
+	return true, userID, true // This was the last connection, user is now offline
 }
 
-// GetConnectionsByUserID returns all websocket connections for a given user ID
-func (m *RoomManager) GetConnectionsByUserID(userID int) []*websocket.Conn {
+// GetConnectionsByUserID returns all websocket clients for a given user ID
+func (m *RoomManager) GetConnectionsByUserID(userID int) []*wsClient {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	var conns []*websocket.Conn
+	var clients []*wsClient
 	for _, meta := range m.connMeta {
-		if meta.UserID == userID && meta.Conn != nil {
-			conns = append(conns, meta.Conn)
+		if meta.UserID == userID && meta.Client != nil {
+			clients = append(clients, meta.Client)
 		}
 	}
-	return conns
+	return clients
 }
 
-// SendToUser sends a message to all connections of a specific user
+// DeliveryMeta is attached to every event sent with SendToUser. All of a user's connections
+// receive the same ID, so clients can suppress duplicate banners, and exactly one connection
+// (the most recently connected) is marked primary.
+type DeliveryMeta struct {
+	ID      string `json:"id"`
+	Devices int    `json:"devices"` // Number of connections this delivery fanned out to
+	Primary bool   `json:"primary"` // Only the primary connection should alert the user
+}
+
+// withDelivery returns a copy of message with a "delivery" field.
+// Non-map messages are converted through JSON; they are sent unchanged if that fails.
+func withDelivery(message interface{}, delivery DeliveryMeta) interface{} {
+	fields, ok := message.(map[string]interface{})
+	if !ok {
+		b, err := json.Marshal(message)
+		if err != nil || json.Unmarshal(b, &fields) != nil {
+			return message
+		}
+	}
+	out := make(map[string]interface{}, len(fields)+1)
+	for k, v := range fields {
+		out[k] = v
+	}
+	out["delivery"] = delivery
+	return out
+}
+
+// SendToUser sends a message to all connections of a specific user as one logical delivery.
+// Other instances get it only while they report the user online. Each instance marks its own
+// newest connection primary, so a user connected to several instances may get several.
 func (m *RoomManager) SendToUser(userID int, message interface{}) {
+	deliveryID := uuid.New().String()
+	messageID := receiptMessageID(message)
+	m.sendToUserLocal(userID, message, deliveryID, messageID)
+	if Cluster.userOnline(userID) {
+		b, err := json.Marshal(message)
+		if err != nil {
+			utils.LogError(err, "SendToUser")
+			return
+		}
+		Cluster.publish(clusterEvent{Kind: clusterUser, UserID: userID, DeliveryID: deliveryID, MessageID: messageID, Payload: b})
+	}
+}
+
+// sendToUserLocal sends message to the user's connections on this instance; a non-zero
+// messageID records a delivery receipt
+func (m *RoomManager) sendToUserLocal(userID int, message interface{}, deliveryID string, messageID int) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	var targets []ConnMeta
+	primary := -1
 	for _, meta := range m.connMeta {
-		if meta.UserID == userID && meta.Conn != nil {
-			if err := utils.SendJSON(meta.Conn, message); err != nil {
-				utils.LogError(err, "SendToUser")
+		if meta.UserID == userID && meta.Client != nil {
+			if primary < 0 || meta.ConnectedAt.After(targets[primary].ConnectedAt) {
+				primary = len(targets)
 			}
+			targets = append(targets, meta)
+		}
+	}
+	// Long-polling clients get their copy queued
+	Polls.deliver(userID, message, deliveryID, len(targets), messageID)
+	if len(targets) == 0 {
+		return
+	}
+
+	var written func()
+	if messageID > 0 {
+		written = deliveredTo(messageID, userID)
+	}
+	for i, meta := range targets {
+		payload := withDelivery(message, DeliveryMeta{ID: deliveryID, Devices: len(targets), Primary: i == primary})
+		if err := meta.Client.sendThen(payload, written); err != nil {
+			utils.LogDebug("SendToUser %d: %v", userID, err)
 		}
 	}
 }
@@ -224,19 +432,19 @@ func (m *RoomManager) IsUserInRoom(userID int, roomID string) bool {
 			return true
 		}
 	}
-	return false
+	return Cluster.userInRoom(userID, roomID)
 }
 
-// GetAllOnlineUserConnections returns a map of userID -> list of connections
+// GetAllOnlineUserConnections returns a map of userID -> list of clients
 // This is used to send messages to users who are online but may not be in any room
-func (m *RoomManager) GetAllOnlineUserConnections() map[int][]*websocket.Conn {
+func (m *RoomManager) GetAllOnlineUserConnections() map[int][]*wsClient {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	result := make(map[int][]*websocket.Conn)
+	result := make(map[int][]*wsClient)
 	for _, meta := range m.connMeta {
-		if meta.Conn != nil {
-			result[meta.UserID] = append(result[meta.UserID], meta.Conn)
+		if meta.Client != nil {
+			result[meta.UserID] = append(result[meta.UserID], meta.Client)
 		}
 	}
 	return result
@@ -256,11 +464,69 @@ func (m *RoomManager) GetUserIDFromConnMeta(connID string) (int, bool) {
 func (m *RoomManager) CountUserConnections(userID int) int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	count := 0
+	return m.userConns[userID]
+}
+
+// localPresence reports whether userID is connected to this instance and which rooms they view
+func (m *RoomManager) localPresence(userID int) (online bool, rooms []string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for connID, meta := range m.connMeta {
+		if meta.UserID != userID {
+			continue
+		}
+		online = true
+		for room, conns := range m.rooms {
+			if _, ok := conns[connID]; ok {
+				rooms = append(rooms, room)
+			}
+		}
+	}
+	return online || Polls.active(userID), rooms
+}
+
+// presenceSnapshot maps every user connected to this instance to the rooms they view
+func (m *RoomManager) presenceSnapshot() map[int][]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make(map[int][]string)
 	for _, meta := range m.connMeta {
-		if meta.UserID == userID {
-			count++
+		if _, ok := users[meta.UserID]; !ok {
+			users[meta.UserID] = []string{}
 		}
 	}
-	return count
+	for _, userID := range Polls.activeUsers() {
+		if _, ok := users[userID]; !ok {
+			users[userID] = []string{}
+		}
+	}
+	for room, conns := range m.rooms {
+		for connID := range conns {
+			if meta, ok := m.connMeta[connID]; ok {
+				users[meta.UserID] = append(users[meta.UserID], room)
+			}
+		}
+	}
+	return users
+}
+
+// ManagerStats is a snapshot of in-memory connection state
+type ManagerStats struct {
+	Connections int `json:"connections"`
+	OnlineUsers int `json:"online_users"`
+	ActiveRooms int `json:"active_rooms"`
+}
+
+// Stats returns counts of active connections, distinct online users and rooms with viewers
+func (m *RoomManager) Stats() ManagerStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return ManagerStats{
+		Connections: len(m.connMeta),
+		OnlineUsers: len(m.userConns),
+		ActiveRooms: len(m.rooms),
+	}
 }
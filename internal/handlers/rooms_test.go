@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useFakeClock points the package clock at a FakeClock for the duration of the test
+func useFakeClock(t *testing.T) *FakeClock {
+	fake := NewFakeClock(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC))
+	SetClock(fake)
+	t.Cleanup(func() { SetClock(nil) })
+	return fake
+}
+
+func TestMemoryRoomsBroadcast(t *testing.T) {
+	m := NewMemoryRooms()
+	m.RegisterConnection("a1", 1, "alice", nil)
+	m.RegisterConnection("a2", 1, "alice", nil)
+	m.RegisterConnection("b1", 2, "bob", nil)
+	m.RegisterConnection("c1", 3, "carol", nil)
+	m.Join("general", "a1", nil, 1, "alice")
+	m.Join("general", "b1", nil, 2, "bob")
+	m.Join("random", "c1", nil, 3, "carol")
+
+	m.Broadcast("general", "hello", "")
+	m.Broadcast("general", "from alice", "a1")
+	m.SendToUser(3, "direct")
+	m.BroadcastToAll("everyone in a room")
+	m.sendAllLocal("every connection")
+
+	want := []Delivery{
+		{Kind: clusterRoom, Room: "general", Payload: "hello", Recipients: []int{1, 2}},
+		{Kind: clusterRoom, Room: "general", Exclude: "a1", Payload: "from alice", Recipients: []int{2}},
+		{Kind: clusterUser, UserID: 3, Payload: "direct", Recipients: []int{3}},
+		{Kind: clusterAll, Payload: "everyone in a room", Recipients: []int{1, 2, 3}},
+		{Kind: clusterAll, Payload: "every connection", Recipients: []int{1, 2, 3}},
+	}
+	if got := m.Deliveries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Deliveries() = %+v, want %+v", got, want)
+	}
+	if got, want := m.Received(3), []interface{}{"direct", "everyone in a room", "every connection"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Received(3) = %v, want %v", got, want)
+	}
+
+	m.Reset()
+	if got := m.Deliveries(); len(got) != 0 {
+		t.Errorf("Deliveries() after Reset = %+v", got)
+	}
+	if !m.IsUserInRoom(1, "general") || m.IsUserInRoom(3, "general") {
+		t.Error("Reset dropped connections or room membership")
+	}
+}
+
+func TestMemoryRoomsPresence(t *testing.T) {
+	fake := useFakeClock(t)
+	start := fake.Now()
+	m := NewMemoryRooms()
+
+	if !m.RegisterConnection("a1", 1, "alice", nil) {
+		t.Error("first connection did not bring the user online")
+	}
+	fake.Advance(time.Minute)
+	if m.RegisterConnection("a2", 1, "alice", nil) {
+		t.Error("second connection brought the user online again")
+	}
+	m.Join("random", "a2", nil, 1, "alice")
+	m.Join("general", "a1", nil, 1, "alice")
+	if got := m.GetUserCurrentRoom(1); got != "general" {
+		t.Errorf("GetUserCurrentRoom(1) = %q, want general", got)
+	}
+	if got := m.Stats(); got.Connections != 2 || got.OnlineUsers != 1 || got.ActiveRooms != 2 {
+		t.Errorf("Stats() = %+v", got)
+	}
+
+	fake.Advance(time.Minute)
+	if m.UnregisterConnection("a1") {
+		t.Error("user went offline with a connection left")
+	}
+	if m.IsUserInRoom(1, "general") || !m.IsUserInRoom(1, "random") {
+		t.Error("rooms of the closed connection were kept")
+	}
+	fake.Advance(time.Minute)
+	if !m.UnregisterConnection("a2") || m.IsUserOnline(1) {
+		t.Error("closing the last connection left the user online")
+	}
+	if m.UnregisterConnection("a2") {
+		t.Error("unknown connection reported as going offline")
+	}
+
+	want := []PresenceTransition{
+		{UserID: 1, Online: true, At: start},
+		{UserID: 1, Online: false, At: start.Add(3 * time.Minute)},
+	}
+	if got := m.Transitions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Transitions() = %+v, want %+v", got, want)
+	}
+	if got := m.Stats(); got != (ManagerStats{}) {
+		t.Errorf("Stats() after disconnecting = %+v", got)
+	}
+}
+
+func TestSetClockConcurrently(t *testing.T) {
+	fake := useFakeClock(t)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			_ = since(fake.Now())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			SetClock(fake)
+		}
+	}()
+	wg.Wait()
+
+	SetClock(nil)
+	if d := since(time.Now()); d < 0 || d > time.Minute {
+		t.Errorf("SetClock(nil) did not restore the system clock, since(now) = %s", d)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 100
+)
+
+// parseTimeParam parses an optional query value with utils.ParseTimestamp
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := utils.ParseTimestamp(value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SearchRoomHandler searches messages inside a single room.
+// Query params (all optional, combined with AND):
+// - q: text contained in the message content (case-insensitive)
+// - from_user: sender user id or username
+// - has: "voice", "image" or "link"
+// - before / after: unix timestamp (s or ms) or RFC3339
+// - limit: max results (default 50, max 100)
+func SearchRoomHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		roomID := c.Params("id")
+
+		ok, err := chatService.IsRoomParticipant(c.UserContext(), roomID, userID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check room membership"})
+		}
+		if !ok {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "not a participant of this room"})
+		}
+
+		filter := models.MessageSearchFilter{
+			Room:  roomID,
+			Query: c.Query("q"),
+			Limit: c.QueryInt("limit", defaultSearchLimit),
+		}
+		if filter.Limit <= 0 || filter.Limit > maxSearchLimit {
+			filter.Limit = maxSearchLimit
+		}
+
+		if fromUser := c.Query("from_user"); fromUser != "" {
+			if id, err := strconv.Atoi(fromUser); err == nil {
+				filter.FromUserID = id
+			} else {
+				filter.FromUser = fromUser
+			}
+		}
+
+		switch has := c.Query("has"); has {
+		case "", "voice", "image", "link":
+			filter.Has = has
+		default:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid has filter, expected voice, image or link"})
+		}
+
+		if filter.Before, err = parseTimeParam(c.Query("before")); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid before"})
+		}
+		if filter.After, err = parseTimeParam(c.Query("after")); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid after"})
+		}
+
+		messages, err := chatService.SearchMessages(c.UserContext(), filter)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to search messages"})
+		}
+
+		results := make([]models.ChatHistoryItem, 0, len(messages))
+		for _, m := range messages {
+			item := models.ChatHistoryItem{
+				ID:            m.ID,
+				Event:         "chat",
+				Room:          m.Room,
+				Text:          m.Content,
+				Voice:         m.Voice,
+				Username:      m.Username,
+				Timestamp:     m.CreatedAt.UnixMilli(),
+				IsYourMessage: m.UserID == userID,
+				HasSeen:       m.HasSeen,
+				VoiceMeta:     m.VoiceMeta,
+				Sticker:       m.Sticker,
+				VoiceExpired:  m.VoiceExpired,
+				File:          m.File,
+				FileURL:       fileURL(m.File, func(f string) string { return BuildFileURL(c, f) }),
+				ReplyTo:       withReplyVoiceURL(m.ReplyTo, func(f string) string { return BuildVoiceURL(c, f) }),
+				ExpiresAt:     expiresAtMillis(m.ExpiresAt),
+				System:        m.System,
+				Silent:        m.Silent,
+				EditedAt:      optionalMillis(m.EditedAt),
+				Version:       m.Version,
+				Deleted:       m.DeletedAt != nil,
+				ThreadID:      m.ThreadID,
+			}
+			if m.Voice != nil && *m.Voice != "" && !m.VoiceExpired {
+				item.VoiceURL = BuildVoiceURL(c, *m.Voice)
+			}
+			results = append(results, item)
+		}
+
+		return c.JSON(fiber.Map{
+			"room":    roomID,
+			"results": results,
+		})
+	}
+}
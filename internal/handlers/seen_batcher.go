@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+)
+
+var (
+	seenBatchFlushes   = metrics.NewCounter("seen_batch_flushes_total", "Batched seen-state writes flushed to the database")
+	seenBatchMarks     = metrics.NewCounter("seen_batch_marks_total", "Seen marks written by batched flushes (divide by flushes for the average batch size)")
+	seenBatchCoalesced = metrics.NewCounter("seen_batch_coalesced_total", "Seen events merged into a pending mark instead of issuing a write")
+	seenBatchFailures  = metrics.NewCounter("seen_batch_failures_total", "Batched seen-state flushes that failed")
+)
+
+// seenKey identifies one viewer's pending mark in a room
+type seenKey struct {
+	room   string
+	userID int
+}
+
+type pendingSeen struct {
+	username   string
+	seenBefore time.Time
+	timestamp  int64 // Client timestamp echoed in messages_seen
+}
+
+// SeenBatcher coalesces seen events per room and user over a short window and writes
+// them with one statement per flush. Receipts and badge updates go out after the write.
+type SeenBatcher struct {
+	chatService *services.ChatService
+	window      time.Duration
+	maxBatch    int
+
+	mu      sync.Mutex
+	pending map[seenKey]*pendingSeen
+	timer   *time.Timer
+	stopped bool
+	flushMu sync.Mutex // Serializes flushes so receipts go out in order
+}
+
+// SeenBatch is the global seen batcher; nil writes every seen event immediately
+var SeenBatch *SeenBatcher
+
+// StartSeenBatcher enables batching of seen events. A non-positive window disables it.
+func StartSeenBatcher(chatService *services.ChatService, window time.Duration, maxBatch int) {
+	if window <= 0 {
+		return
+	}
+	SeenBatch = &SeenBatcher{
+		chatService: chatService,
+		window:      window,
+		maxBatch:    maxBatch,
+		pending:     make(map[seenKey]*pendingSeen),
+	}
+}
+
+// Add queues a seen mark. Returns false if the batcher is stopped and the caller must write directly.
+func (b *SeenBatcher) Add(room string, userID int, username string, seenBefore time.Time, timestamp int64) bool {
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		return false
+	}
+	key := seenKey{room: room, userID: userID}
+	if p, ok := b.pending[key]; ok {
+		seenBatchCoalesced.Inc()
+		if seenBefore.After(p.seenBefore) {
+			p.seenBefore, p.timestamp = seenBefore, timestamp
+		}
+	} else {
+		b.pending[key] = &pendingSeen{username: username, seenBefore: seenBefore, timestamp: timestamp}
+	}
+	full := b.maxBatch > 0 && len(b.pending) >= b.maxBatch
+	if !full && b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.Flush)
+	}
+	b.mu.Unlock()
+
+	if full {
+		go b.Flush()
+	}
+	return true
+}
+
+// Flush writes every pending mark now
+func (b *SeenBatcher) Flush() {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = make(map[seenKey]*pendingSeen)
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	keys := make([]seenKey, 0, len(batch))
+	marks := make([]services.SeenMark, 0, len(batch))
+	for key, p := range batch {
+		keys = append(keys, key)
+		marks = append(marks, services.SeenMark{Room: key.room, ViewerID: key.userID, SeenBefore: p.seenBefore})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	counts, err := b.chatService.MarkMessagesSeenBatch(ctx, marks)
+	seenBatchFlushes.Inc()
+	if err != nil {
+		seenBatchFailures.Inc()
+		utils.LogError(err, "MarkMessagesSeenBatch")
+		for _, key := range keys {
+			Manager.SendToUser(key.userID, map[string]interface{}{
+				"event":   "seen_failed",
+				"room":    key.room,
+				"error":   err.Error(),
+				"updated": 0,
+			})
+		}
+		return
+	}
+	seenBatchMarks.Add(int64(len(marks)))
+
+	for i, key := range keys {
+		p := batch[key]
+		broadcastMessagesSeen(key.room, key.userID, p.username, p.timestamp, counts[i])
+		if counts[i] > 0 {
+			adjustBadge(b.chatService, key.userID, -counts[i])
+		}
+	}
+}
+
+// Stop flushes pending marks; later seen events are written directly
+func (b *SeenBatcher) Stop() {
+	b.mu.Lock()
+	b.stopped = true
+	b.mu.Unlock()
+	b.Flush()
+}
+
+// StopSeenBatcher flushes and stops the global batcher on shutdown
+func StopSeenBatcher() {
+	if SeenBatch != nil {
+		SeenBatch.Stop()
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"chat-backend/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Metrics to alert on chat health with, e.g. the share of connects or uploads that failed,
+// or the 99th percentile of message delivery latency
+var (
+	messageDeliverySeconds = metrics.NewHistogramVec("message_delivery_seconds",
+		"Time from saving a chat message until the last viewer of its room on this instance was written to, by outcome",
+		metrics.LatencyBuckets, "outcome")
+	wsConnects   = metrics.NewCounterVec("ws_connects_total", "Websocket connection attempts by outcome", "outcome")
+	uploadsTotal = metrics.NewCounterVec("uploads_total", "Uploads by kind and outcome (success, rejected or failed)", "kind", "outcome")
+)
+
+// Outcomes of a timed delivery
+const (
+	deliveryDelivered = "delivered" // Every viewer was written to
+	deliveryDropped   = "dropped"   // Some viewer's queue was full or closed
+	deliveryTimeout   = "timeout"   // Some write didn't happen within deliveryWait
+)
+
+// deliveryWait is how long a message waits for its writes before it is observed as timed out
+const deliveryWait = 30 * time.Second
+
+// pendingDelivery is a timed message whose broadcast hasn't been written to every viewer yet
+type pendingDelivery struct {
+	saved   time.Time
+	frames  int  // Frames queued for viewers
+	writes  int  // Of those, not yet written
+	sealed  bool // The broadcast finished queueing
+	dropped bool
+}
+
+// deliveryTimer feeds message_delivery_seconds. Messages are timed from before SaveMessage;
+// the room broadcast that follows counts the frames it queues, and the message is observed
+// when the writer of the last one reports it written. Only this instance's viewers count.
+type deliveryTimer struct {
+	mu      sync.Mutex
+	pending map[int]*pendingDelivery
+}
+
+var deliveries = &deliveryTimer{pending: make(map[int]*pendingDelivery)}
+
+// start times messageID from saved, when saving began
+func (t *deliveryTimer) start(messageID int, saved time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Writes lost with a closed connection never report; give up on those messages
+	for id, d := range t.pending {
+		if since(d.saved) > deliveryWait {
+			t.observe(id, d, deliveryTimeout)
+		}
+	}
+	t.pending[messageID] = &pendingDelivery{saved: saved}
+}
+
+// timed reports whether messageID's broadcast is being timed
+func (t *deliveryTimer) timed(messageID int) bool {
+	if messageID <= 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.pending[messageID]
+	return ok && !d.sealed
+}
+
+// queued counts a frame of messageID and returns the callback its writer runs
+func (t *deliveryTimer) queued(messageID int) func() {
+	t.mu.Lock()
+	if d, ok := t.pending[messageID]; ok {
+		d.frames++
+		d.writes++
+	}
+	t.mu.Unlock()
+	return func() { t.done(messageID, false) }
+}
+
+// done records one frame of messageID as written, or as dropped
+func (t *deliveryTimer) done(messageID int, dropped bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.pending[messageID]
+	if !ok {
+		return
+	}
+	d.writes--
+	d.dropped = d.dropped || dropped
+	t.finish(messageID, d)
+}
+
+// seal marks messageID's broadcast as fully queued
+func (t *deliveryTimer) seal(messageID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if d, ok := t.pending[messageID]; ok {
+		d.sealed = true
+		t.finish(messageID, d)
+	}
+}
+
+// finish observes d once it is sealed and written everywhere; t.mu must be held
+func (t *deliveryTimer) finish(messageID int, d *pendingDelivery) {
+	if !d.sealed || d.writes > 0 {
+		return
+	}
+	if d.frames == 0 {
+		delete(t.pending, messageID) // Nobody was viewing the room
+		return
+	}
+	outcome := deliveryDelivered
+	if d.dropped {
+		outcome = deliveryDropped
+	}
+	t.observe(messageID, d, outcome)
+}
+
+// observe records d and stops timing it; t.mu must be held
+func (t *deliveryTimer) observe(messageID int, d *pendingDelivery, outcome string) {
+	messageDeliverySeconds.Observe(since(d.saved).Seconds(), outcome)
+	delete(t.pending, messageID)
+}
+
+// chainWritten runs both callbacks; either may be nil
+func chainWritten(a, b func()) func() {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+	return func() {
+		a()
+		b()
+	}
+}
+
+// UploadMetrics counts the outcome of an upload endpoint in uploads_total: success for 2xx,
+// rejected for other 4xx (validation, policy, quota) and failed otherwise. Handlers that
+// always answer 200, like the SSE voice upload, report through setUploadOutcome.
+func UploadMetrics(kind string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		outcome, ok := c.Locals("upload_outcome").(string)
+		if !ok {
+			status := c.Response().StatusCode()
+			if e, isFiber := err.(*fiber.Error); isFiber {
+				status = e.Code
+			} else if err != nil {
+				status = http.StatusInternalServerError
+			}
+			switch {
+			case status < 300:
+				outcome = "success"
+			case status < 500:
+				outcome = "rejected"
+			default:
+				outcome = "failed"
+			}
+		}
+		uploadsTotal.Inc(kind, outcome)
+		return err
+	}
+}
+
+// setUploadOutcome overrides the outcome UploadMetrics derives from the status code
+func setUploadOutcome(c *fiber.Ctx, outcome string) {
+	c.Locals("upload_outcome", outcome)
+}
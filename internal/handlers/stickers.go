@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StickersHandler lists the sticker and GIF packs users can send from
+func StickersHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		packs, err := chatService.ListStickerPacks(c.UserContext())
+		if err != nil {
+			utils.LogError(err, "ListStickerPacks")
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to list stickers"})
+		}
+		return c.JSON(fiber.Map{"packs": packs})
+	}
+}
+
+// AdminCreateStickerPackHandler adds a sticker or GIF pack
+func AdminCreateStickerPackHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.CreateStickerPackRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if err := req.Validate(); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		pack, err := adminService.CreateStickerPack(c.UserContext(), c.Locals("user_id").(int), req)
+		if err != nil {
+			return adminError(c, err)
+		}
+		return c.Status(http.StatusCreated).JSON(pack)
+	}
+}
+
+// AdminDeleteStickerPackHandler removes a pack; stickers already sent stay in their messages
+func AdminDeleteStickerPackHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		packID, err := strconv.Atoi(c.Params("id"))
+		if err != nil || packID <= 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid pack id"})
+		}
+		if err := adminService.DeleteStickerPack(c.UserContext(), c.Locals("user_id").(int), packID); err != nil {
+			return adminError(c, err)
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
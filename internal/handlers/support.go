@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// supportAgents returns the usernames configured in SUPPORT_AGENTS (comma separated)
+func supportAgents() []string {
+	var agents []string
+	for _, name := range strings.Split(utils.GetEnv("SUPPORT_AGENTS", ""), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			agents = append(agents, name)
+		}
+	}
+	return agents
+}
+
+func isSupportAgent(username string) bool {
+	for _, agent := range supportAgents() {
+		if agent == username {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportAgentMiddleware rejects requests from users not listed in SUPPORT_AGENTS
+func SupportAgentMiddleware(c *fiber.Ctx) error {
+	username, _ := c.Locals("username").(string)
+	if username == "" || !isSupportAgent(username) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "support agent access required"})
+	}
+	return c.Next()
+}
+
+// notifySupportAgents pushes a support queue change to every online agent
+func notifySupportAgents(chatService *services.ChatService, event string, ticket *models.SupportTicket) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	agentIDs, err := chatService.GetUserIDsByUsername(ctx, supportAgents())
+	if err != nil {
+		utils.LogError(err, "GetUserIDsByUsername for support agents")
+		return
+	}
+	Manager.SendToUsers(agentIDs, fiber.Map{
+		"event":     event,
+		"ticket":    ticket,
+		"timestamp": time.Now().UnixMilli(),
+	})
+}
+
+// supportError maps support service errors onto HTTP responses
+func supportError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "support conversation not found"})
+	case errors.Is(err, services.ErrAlreadyClaimed):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// OpenSupportHandler returns the caller's open support conversation, creating one if needed.
+// New conversations are announced to every online agent.
+func OpenSupportHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+
+		res, err := chatService.OpenSupportRoom(c.UserContext(), userID, utils.GetEnv("SUPPORT_ROOM_NAME", "Support"))
+		if err != nil {
+			return supportError(c, err)
+		}
+		if res.IsNew {
+			if ticket, err := chatService.GetSupportTicket(c.UserContext(), res.RoomID); err == nil {
+				go notifySupportAgents(chatService, "support_opened", ticket)
+			}
+		}
+		return c.JSON(res)
+	}
+}
+
+// SupportQueueHandler lists support conversations for agents (?status=open|claimed|resolved)
+func SupportQueueHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		status := c.Query("status")
+		switch status {
+		case "", "open", "claimed", "resolved":
+		default:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "status must be open, claimed or resolved"})
+		}
+		tickets, err := chatService.ListSupportTickets(c.UserContext(), status)
+		if err != nil {
+			return supportError(c, err)
+		}
+		return c.JSON(tickets)
+	}
+}
+
+// ClaimSupportHandler assigns an open conversation to the calling agent.
+// The agent joins the room and the claim is posted as a system message.
+func ClaimSupportHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		agentID := c.Locals("user_id").(int)
+		username := c.Locals("username").(string)
+		roomID := c.Params("id")
+
+		ticket, ev, err := chatService.ClaimSupportRoom(c.UserContext(), roomID, agentID)
+		if err != nil {
+			return supportError(c, err)
+		}
+
+		broadcastMembershipEvent(ev)
+		if err := postSystemMessage(chatService, roomID, username+" claimed this conversation"); err != nil {
+			utils.LogError(err, "support claim message")
+		}
+		go notifySupportAgents(chatService, "support_claimed", ticket)
+		return c.JSON(ticket)
+	}
+}
+
+// ResolveSupportHandler closes a conversation. Allowed for the user who opened it and for agents.
+func ResolveSupportHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		username := c.Locals("username").(string)
+		roomID := c.Params("id")
+
+		ticket, err := chatService.GetSupportTicket(c.UserContext(), roomID)
+		if err != nil {
+			return supportError(c, err)
+		}
+		if ticket.UserID != userID && !isSupportAgent(username) {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "not allowed to resolve this conversation"})
+		}
+
+		ticket, err = chatService.ResolveSupportRoom(c.UserContext(), roomID)
+		if err != nil {
+			return supportError(c, err)
+		}
+		if err := postSystemMessage(chatService, roomID, "Conversation resolved by "+username); err != nil {
+			utils.LogError(err, "support resolve message")
+		}
+		go notifySupportAgents(chatService, "support_resolved", ticket)
+		return c.JSON(ticket)
+	}
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errNotThreadParticipant hides threads of rooms the viewer isn't in
+var errNotThreadParticipant = errors.New("not a participant of this room")
+
+// loadThread fetches the thread containing messageID for a participant of its room
+func loadThread(ctx context.Context, chatService *services.ChatService, messageID, userID int) ([]models.Message, error) {
+	thread, err := chatService.GetThread(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := chatService.IsRoomParticipant(ctx, thread[0].Room, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errNotThreadParticipant
+	}
+	return thread, nil
+}
+
+// threadHistory renders a thread like join history, building media URLs with the given functions
+func threadHistory(thread []models.Message, userID int, voiceURL, fileURLFor func(string) string) []models.ChatHistoryItem {
+	items := make([]models.ChatHistoryItem, 0, len(thread))
+	for _, m := range thread {
+		item := models.ChatHistoryItem{
+			ID:            m.ID,
+			Event:         "chat",
+			Room:          m.Room,
+			Text:          m.Content,
+			Voice:         m.Voice,
+			Username:      m.Username,
+			Timestamp:     m.CreatedAt.UnixMilli(),
+			IsYourMessage: m.UserID == userID,
+			HasSeen:       m.HasSeen,
+			VoiceMeta:     m.VoiceMeta,
+			Sticker:       m.Sticker,
+			VoiceExpired:  m.VoiceExpired,
+			File:          m.File,
+			FileURL:       fileURL(m.File, fileURLFor),
+			ReplyTo:       withReplyVoiceURL(m.ReplyTo, voiceURL),
+			ExpiresAt:     expiresAtMillis(m.ExpiresAt),
+			System:        m.System,
+			Silent:        m.Silent,
+			EditedAt:      optionalMillis(m.EditedAt),
+			Version:       m.Version,
+			Deleted:       m.DeletedAt != nil,
+			ThreadID:      m.ThreadID,
+		}
+		if m.Voice != nil && *m.Voice != "" && !m.VoiceExpired {
+			item.VoiceURL = voiceURL(*m.Voice)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// applyMessageStates adds the reactions and read receipts of history items; without them
+// the items still carry their own state, so a failure is only logged
+func applyMessageStates(ctx context.Context, chatService *services.ChatService, userID int, items []models.ChatHistoryItem) {
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		if item.ID != 0 && !item.Deleted {
+			ids = append(ids, item.ID)
+		}
+	}
+	states, err := chatService.GetMessageStates(ctx, userID, ids)
+	if err != nil {
+		utils.LogError(err, "GetMessageStates")
+		return
+	}
+	for i := range items {
+		if st, ok := states[items[i].ID]; ok && !items[i].Deleted {
+			items[i].Reactions = st.Reactions
+			items[i].MyReactions = st.MyReactions
+			items[i].SeenCount = st.SeenCount
+		}
+	}
+}
+
+// ThreadHandler returns the reply thread containing :id, root message first
+func ThreadHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, ok := parseMessageID(c)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid message id"})
+		}
+		userID := c.Locals("user_id").(int)
+		thread, err := loadThread(c.UserContext(), chatService, id, userID)
+		if errors.Is(err, errNotThreadParticipant) {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return messageEditError(c, err)
+		}
+		return c.JSON(fiber.Map{
+			"root_id":  thread[0].ID,
+			"room":     thread[0].Room,
+			"messages": threadHistory(thread, userID, func(f string) string { return BuildVoiceURL(c, f) }, func(f string) string { return BuildFileURL(c, f) }),
+		})
+	}
+}
+
+const (
+	defaultRepliesLimit = 50
+	maxRepliesLimit     = 200
+)
+
+// RepliesHandler returns the direct replies to :id across its room, oldest first.
+// Query params:
+// - before: reply id to page back from; without it the newest replies are returned
+// - limit: max replies (default 50, max 200)
+func RepliesHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, ok := parseMessageID(c)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid message id"})
+		}
+		before := c.QueryInt("before", 0)
+		limit := c.QueryInt("limit", defaultRepliesLimit)
+		if limit <= 0 || limit > maxRepliesLimit {
+			limit = defaultRepliesLimit
+		}
+		userID := c.Locals("user_id").(int)
+
+		parent, replies, total, more, err := chatService.GetReplies(c.UserContext(), id, before, limit)
+		if err != nil {
+			return messageEditError(c, err)
+		}
+		ok, err = chatService.IsRoomParticipant(c.UserContext(), parent.Room, userID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check room membership"})
+		}
+		if !ok {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": errNotThreadParticipant.Error()})
+		}
+
+		resp := fiber.Map{
+			"message_id": parent.ID,
+			"room":       parent.Room,
+			"total":      total,
+			"replies":    threadHistory(replies, userID, func(f string) string { return BuildVoiceURL(c, f) }, func(f string) string { return BuildFileURL(c, f) }),
+			"more":       more,
+		}
+		if more {
+			resp["next_before"] = replies[0].ID
+		}
+		return c.JSON(resp)
+	}
+}
+
+// handleThread answers a "thread" event with the thread's messages in history
+func handleThread(s *wsSession, req *models.ThreadRequest) error {
+	thread, err := loadThread(s.ctx, s.chatService, req.ID, s.userID)
+	if errors.Is(err, errNotThreadParticipant) {
+		return err
+	}
+	if errors.Is(err, services.ErrNotFound) {
+		return fmt.Errorf("message not found")
+	}
+	if err != nil {
+		utils.LogError(err, "GetThread")
+		return fmt.Errorf("failed to load thread")
+	}
+	s.send(models.WSMessage{
+		Event:     "thread",
+		ID:        thread[0].ID,
+		Room:      thread[0].Room,
+		History:   threadHistory(thread, s.userID, func(f string) string { return buildVoiceURLFromWS(s.conn, f) }, func(f string) string { return buildFileURLFromWS(s.conn, f) }),
+		Timestamp: time.Now().UnixMilli(),
+	})
+	return nil
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Translator is the translation provider; nil disables auto-translation
+var Translator services.Translator
+
+// translateForRoom translates text into every participant language of a room with
+// auto-translation on. Returns nil when there is nothing to translate; provider errors
+// are logged and that language is left out.
+func translateForRoom(ctx context.Context, chatService *services.ChatService, roomID, text string) map[string]string {
+	if Translator == nil || !services.FeatureEnabled(services.FeatureTranslation) || strings.TrimSpace(text) == "" {
+		return nil
+	}
+	source, targets, ok, err := chatService.GetTranslationTargets(ctx, roomID)
+	if err != nil {
+		utils.LogError(err, "GetTranslationTargets")
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	translations := make(map[string]string)
+	for _, target := range targets {
+		if target == source {
+			continue
+		}
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			translated, err := Translator.Translate(ctx, text, source, target)
+			if err != nil {
+				utils.LogError(err, "Translate to "+target)
+				return
+			}
+			if translated == "" || translated == text {
+				return
+			}
+			mu.Lock()
+			translations[target] = translated
+			mu.Unlock()
+		}(target)
+	}
+	wg.Wait()
+
+	if len(translations) == 0 {
+		return nil
+	}
+	return translations
+}
+
+// GetRoomTranslationHandler returns the room's translation settings
+func GetRoomTranslationHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		settings, err := chatService.GetRoomTranslation(c.UserContext(), c.Params("id"))
+		if err != nil {
+			if errors.Is(err, services.ErrNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "room not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(settings)
+	}
+}
+
+// UpdateRoomTranslationHandler sets the room's source language and turns auto-translation on or off
+func UpdateRoomTranslationHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.RoomTranslationSettings
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if req.Language != nil && len(*req.Language) > 10 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid language"})
+		}
+		if req.AutoTranslate && Translator == nil {
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "translation is not configured"})
+		}
+		if err := chatService.SetRoomTranslation(c.UserContext(), c.Params("id"), req); err != nil {
+			if errors.Is(err, services.ErrNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "room not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(req)
+	}
+}
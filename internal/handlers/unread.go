@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MarkAllReadHandler marks every room of the authenticated user as seen.
+// Responds with the number of messages updated per room.
+func MarkAllReadHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		username, _ := c.Locals("username").(string)
+
+		counts, err := markAllRead(c.UserContext(), chatService, userID, username)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to mark rooms as read"})
+		}
+
+		var total int64
+		for _, n := range counts {
+			total += n
+		}
+		return c.JSON(fiber.Map{"rooms": counts, "updated": total})
+	}
+}
+
+// UnreadCountHandler returns the total unread message count for the app icon badge
+func UnreadCountHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+
+		n, err := Badges.Get(c.UserContext(), chatService, userID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to count unread messages"})
+		}
+		return c.JSON(fiber.Map{"unread": n})
+	}
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Upload endpoints with their own policy
+const (
+	UploadVoice          = "voice"           // Voice messages, with or without progress, and staged media
+	UploadPhoto          = "photo"           // Profile photos
+	UploadImport         = "import"          // Admin message imports
+	UploadAccountArchive = "account_archive" // Account archive imports
+	UploadAttachment     = "attachment"      // Room file and image attachments
+)
+
+var rejectedUploads = metrics.NewCounterVec("upload_rejected_total", "Uploads rejected by the upload policy", "endpoint", "reason")
+
+// UploadRule is the policy of one upload endpoint
+type UploadRule struct {
+	ContentTypes []string `json:"content_types"` // Accepted media types, "audio/*" style wildcards allowed; empty accepts any
+	Extensions   []string `json:"extensions"`    // Accepted filename extensions such as ".ogg"; empty accepts any
+	MaxBytes     int64    `json:"max_bytes"`     // 0 for no limit beyond the server body limit
+}
+
+// UploadPolicyConfig maps upload endpoints to their rules
+type UploadPolicyConfig map[string]UploadRule
+
+// defaultUploadPolicy is used for endpoints UPLOAD_POLICY doesn't configure. Sizes are
+// bounded by the server body limit (HTTP_BODY_LIMIT_MB) unless a rule sets a lower max.
+func defaultUploadPolicy() UploadPolicyConfig {
+	return UploadPolicyConfig{
+		UploadVoice: {
+			ContentTypes: []string{"audio/wav", "audio/wave", "audio/x-wav", "audio/mpeg", "audio/mp3", "audio/ogg", "audio/webm",
+				"audio/mp4", "audio/aac", "audio/x-m4a", "audio/m4a", "application/octet-stream"},
+		},
+		UploadPhoto: {
+			ContentTypes: []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+			Extensions:   []string{".jpg", ".jpeg", ".png", ".gif", ".webp"},
+		},
+		UploadImport:         {},
+		UploadAccountArchive: {},
+		// Per-kind size caps come from ATTACHMENT_MAX_*_MB. SVG and HTML are left out since
+		// uploads are served from our origin.
+		UploadAttachment: {
+			ContentTypes: []string{"image/jpeg", "image/png", "image/gif", "image/webp",
+				"video/mp4", "video/webm", "video/quicktime",
+				"application/pdf", "text/plain", "text/csv", "application/zip",
+				"application/msword", "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+				"application/vnd.ms-excel", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+				"application/vnd.ms-powerpoint", "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+			Extensions: []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".mp4", ".webm", ".mov",
+				".pdf", ".txt", ".csv", ".zip", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx"},
+		},
+	}
+}
+
+// uploadPolicyFromEnv overlays the JSON object in UPLOAD_POLICY on the defaults
+func uploadPolicyFromEnv() (UploadPolicyConfig, error) {
+	cfg := defaultUploadPolicy()
+	raw := utils.GetEnv("UPLOAD_POLICY", "")
+	if raw == "" {
+		return cfg, nil
+	}
+	var overrides UploadPolicyConfig
+	if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+		return nil, fmt.Errorf("invalid UPLOAD_POLICY: %w", err)
+	}
+	for endpoint, rule := range overrides {
+		cfg[endpoint] = rule
+	}
+	return cfg, nil
+}
+
+// UploadPolicyEngine checks uploads against per-endpoint rules that can be replaced at runtime
+type UploadPolicyEngine struct {
+	mu     sync.RWMutex
+	config UploadPolicyConfig
+}
+
+// UploadPolicy is the process-wide upload policy, initialised from env by InitUploadPolicy
+var UploadPolicy = &UploadPolicyEngine{config: defaultUploadPolicy()}
+
+// InitUploadPolicy loads UPLOAD_POLICY
+func InitUploadPolicy() error {
+	cfg, err := uploadPolicyFromEnv()
+	if err != nil {
+		return err
+	}
+	return UploadPolicy.Replace(cfg)
+}
+
+// Replace validates cfg and makes it the whole policy. Invalid rules reject the whole update.
+func (p *UploadPolicyEngine) Replace(cfg UploadPolicyConfig) error {
+	normalized := make(UploadPolicyConfig, len(cfg))
+	for endpoint, rule := range cfg {
+		if _, ok := defaultUploadPolicy()[endpoint]; !ok {
+			return fmt.Errorf("unknown upload endpoint %q", endpoint)
+		}
+		if rule.MaxBytes < 0 {
+			return fmt.Errorf("%s: max_bytes must not be negative", endpoint)
+		}
+		types := make([]string, 0, len(rule.ContentTypes))
+		for _, t := range rule.ContentTypes {
+			mediaType, _, err := mime.ParseMediaType(t)
+			if err != nil || !strings.Contains(mediaType, "/") {
+				return fmt.Errorf("%s: invalid content type %q", endpoint, t)
+			}
+			types = append(types, mediaType)
+		}
+		exts := make([]string, 0, len(rule.Extensions))
+		for _, ext := range rule.Extensions {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+				return fmt.Errorf("%s: invalid extension %q", endpoint, ext)
+			}
+			exts = append(exts, ext)
+		}
+		normalized[endpoint] = UploadRule{ContentTypes: types, Extensions: exts, MaxBytes: rule.MaxBytes}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.config = normalized
+	return nil
+}
+
+// Config returns the current rules
+func (p *UploadPolicyEngine) Config() UploadPolicyConfig {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	cfg := make(UploadPolicyConfig, len(p.config))
+	for endpoint, rule := range p.config {
+		cfg[endpoint] = rule
+	}
+	return cfg
+}
+
+// uploadRejection explains why an upload was refused
+type uploadRejection struct {
+	status int
+	reason string // content_type, extension or size
+	fields fiber.Map
+}
+
+func (r *uploadRejection) Error() string { return r.fields["error"].(string) }
+
+// Check returns an *uploadRejection when the file breaks the endpoint's rule. Endpoints
+// without a rule accept everything.
+func (p *UploadPolicyEngine) Check(endpoint string, fh *multipart.FileHeader) error {
+	p.mu.RLock()
+	rule, ok := p.config[endpoint]
+	p.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	var rejection *uploadRejection
+	contentType := fh.Header.Get("Content-Type")
+	ext := strings.ToLower(filepath.Ext(fh.Filename))
+	switch {
+	case len(rule.ContentTypes) > 0 && !contentTypeAllowed(rule.ContentTypes, contentType):
+		rejection = &uploadRejection{status: http.StatusUnsupportedMediaType, reason: "content_type", fields: fiber.Map{
+			"error": "unsupported media type", "content_type": contentType, "allowed": rule.ContentTypes,
+		}}
+	case len(rule.Extensions) > 0 && ext != "" && !slices.Contains(rule.Extensions, ext):
+		// Files without an extension get one from their content type
+		rejection = &uploadRejection{status: http.StatusUnsupportedMediaType, reason: "extension", fields: fiber.Map{
+			"error": "unsupported file extension", "extension": ext, "allowed": rule.Extensions,
+		}}
+	case rule.MaxBytes > 0 && fh.Size > rule.MaxBytes:
+		rejection = &uploadRejection{status: http.StatusRequestEntityTooLarge, reason: "size", fields: fiber.Map{
+			"error": "file too large", "size": fh.Size, "max_bytes": rule.MaxBytes,
+		}}
+	default:
+		return nil
+	}
+	rejectedUploads.Inc(endpoint, rejection.reason)
+	return rejection
+}
+
+// contentTypeAllowed matches the media type (parameters ignored) against the allowlist
+func contentTypeAllowed(allowed []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if a == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadPolicyError responds with the rejection from UploadPolicy.Check
+func uploadPolicyError(c *fiber.Ctx, err error) error {
+	if r, ok := err.(*uploadRejection); ok {
+		return c.Status(r.status).JSON(r.fields)
+	}
+	return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+}
+
+// AdminGetUploadPolicyHandler returns the rules of every upload endpoint
+func AdminGetUploadPolicyHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(UploadPolicy.Config())
+	}
+}
+
+// AdminUpdateUploadPolicyHandler replaces the rules of the endpoints in the body at runtime;
+// other endpoints keep theirs. Changes are not persisted across restarts or reloads.
+func AdminUpdateUploadPolicyHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var update UploadPolicyConfig
+		if err := c.BodyParser(&update); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		cfg := UploadPolicy.Config()
+		for endpoint, rule := range update {
+			cfg[endpoint] = rule
+		}
+		if err := UploadPolicy.Replace(cfg); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(UploadPolicy.Config())
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// cleanUploadPath normalizes a path relative to UPLOAD_DIR; "" if it escapes the directory
+func cleanUploadPath(rel string) string {
+	cleaned := strings.TrimPrefix(path.Clean("/"+rel), "/")
+	if cleaned == "" || cleaned == "." {
+		return ""
+	}
+	return cleaned
+}
+
+// UploadsHandler serves /uploads/[namespace/]<path>. Only the current namespace is public;
+// links under a retired namespace return 410 Gone unless they carry a valid signature,
+// in which case they are redirected to the current namespace. With remote storage, files
+// are redirected to their presigned URL.
+func UploadsHandler(uploadDir string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		rest := c.Params("*")
+		ns, rel := "", rest
+		if first, remainder, ok := strings.Cut(rest, "/"); ok && services.IsUploadNamespace(first) {
+			ns, rel = first, remainder
+		}
+		rel = cleanUploadPath(rel)
+		// Dot directories (.tmp, .probe) hold files that aren't published
+		if rel == "" || strings.HasPrefix(rel, ".") {
+			return c.SendStatus(http.StatusNotFound)
+		}
+
+		if ns != services.CurrentUploadNamespace() {
+			if services.VerifyUploadSignature(rel, c.Query("exp"), c.Query("sig")) {
+				return c.Redirect(services.UploadPath(rel), http.StatusFound)
+			}
+			return c.Status(http.StatusGone).SendString("This link is no longer available")
+		}
+		// Remote storage serves its own presigned URLs
+		if u := services.UploadURL(rel); u != "" {
+			return c.Redirect(u, http.StatusFound)
+		}
+		return c.SendFile(filepath.Join(uploadDir, filepath.FromSlash(services.ResolveUpload(c.UserContext(), rel))))
+	}
+}
+
+// SignUploadHandler returns an expiring signed URL for an uploaded file (?path=voices/<file>)
+// that keeps working across namespace rotations. Only files the caller can see are signed
+// (see ChatService.CanAccessUpload); others get 404 whether they exist or not.
+func SignUploadHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		rel := cleanUploadPath(c.Query("path"))
+		if rel == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "path is required"})
+		}
+		ok, err := chatService.CanAccessUpload(c.UserContext(), c.Locals("user_id").(int), rel)
+		if err != nil {
+			utils.LogError(err, "CanAccessUpload")
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check file access"})
+		}
+		if !ok {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+		}
+		url, expiresAt := services.SignedUploadURL(rel, utils.GetEnvDuration("UPLOAD_SIGNED_URL_TTL", time.Hour))
+		return c.JSON(fiber.Map{
+			"url":        utils.GetEnv("BASE_URL", "") + url,
+			"expires_at": expiresAt.UnixMilli(),
+		})
+	}
+}
+
+// AdminRotateUploadsHandler retires the current upload namespace, invalidating every
+// public link shared so far
+func AdminRotateUploadsHandler(adminService *services.AdminService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		adminID := c.Locals("user_id").(int)
+		previous := services.CurrentUploadNamespace()
+		current, err := adminService.RotateUploadNamespace(c.UserContext(), adminID)
+		if err != nil {
+			return adminError(c, err)
+		}
+		return c.JSON(fiber.Map{"previous": previous, "current": current})
+	}
+}
+
+// StartUploadNamespaceRefresh reloads the current namespace periodically so a rotation on
+// one instance reaches the others
+func StartUploadNamespaceRefresh(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := services.LoadUploadNamespace(ctx); err != nil {
+					utils.LogError(err, "LoadUploadNamespace")
+				}
+			}
+		}
+	}()
+	log.Printf("Upload namespace refresh running every %s", interval)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultUsageDays = 30
+	maxUsageDays     = 365
+)
+
+var usageFlushFailures = metrics.NewCounter("usage_flush_failures_total", "Usage rollup flushes that failed (their counts are dropped)")
+
+// UsageRecorder counts uploads, WS events and API requests per user in memory and adds them
+// to the daily usage rollups every interval, so counting never costs a write per request.
+type UsageRecorder struct {
+	chatService *services.ChatService
+
+	mu      sync.Mutex
+	pending map[int]models.UsageCounts
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Usage is the global usage recorder; nil disables usage tracking
+var Usage *UsageRecorder
+
+// StartUsageRecorder enables usage tracking, flushing every interval. A non-positive interval disables it.
+func StartUsageRecorder(chatService *services.ChatService, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	Usage = &UsageRecorder{
+		chatService: chatService,
+		pending:     make(map[int]models.UsageCounts),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go Usage.run(interval)
+}
+
+func (u *UsageRecorder) run(interval time.Duration) {
+	defer close(u.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-u.stop:
+			u.Flush()
+			return
+		case <-ticker.C:
+			u.Flush()
+		}
+	}
+}
+
+// add merges delta into userID's pending counts
+func (u *UsageRecorder) add(userID int, delta models.UsageCounts) {
+	u.mu.Lock()
+	p := u.pending[userID]
+	p.Uploads += delta.Uploads
+	p.UploadBytes += delta.UploadBytes
+	p.WSEvents += delta.WSEvents
+	p.APIRequests += delta.APIRequests
+	u.pending[userID] = p
+	u.mu.Unlock()
+}
+
+// Flush writes the pending counts now
+func (u *UsageRecorder) Flush() {
+	u.mu.Lock()
+	batch := u.pending
+	u.pending = make(map[int]models.UsageCounts)
+	u.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := u.chatService.AddUsage(ctx, batch); err != nil {
+		usageFlushFailures.Inc()
+		utils.LogError(err, "AddUsage")
+	}
+}
+
+// StopUsageRecorder writes the pending counts on shutdown
+func StopUsageRecorder() {
+	if Usage != nil {
+		close(Usage.stop)
+		<-Usage.done
+	}
+}
+
+// recordUsage counts activity for userID when usage tracking is enabled
+func recordUsage(userID int, delta models.UsageCounts) {
+	if Usage != nil && userID > 0 {
+		Usage.add(userID, delta)
+	}
+}
+
+// recordUpload counts one stored upload of size bytes
+func recordUpload(userID int, size int64) {
+	recordUsage(userID, models.UsageCounts{Uploads: 1, UploadBytes: size})
+}
+
+// UsageMiddleware counts authenticated API requests; it runs after AuthMiddleware
+func UsageMiddleware(c *fiber.Ctx) error {
+	if userID, ok := c.Locals("user_id").(int); ok {
+		recordUsage(userID, models.UsageCounts{APIRequests: 1})
+	}
+	return c.Next()
+}
+
+// UsageHandler returns the caller's daily usage and current storage for quota and fair-use UIs.
+// Query params:
+// - days: how many UTC days to report, today included (default 30, max 365)
+func UsageHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		days := c.QueryInt("days", defaultUsageDays)
+		if days <= 0 || days > maxUsageDays {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "days must be between 1 and 365"})
+		}
+		usage, err := chatService.GetUserUsage(c.UserContext(), c.Locals("user_id").(int), days, utils.GetEnv("UPLOAD_DIR", "uploads"))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load usage"})
+		}
+		return c.JSON(usage)
+	}
+}
@@ -1,10 +1,10 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -46,16 +46,99 @@ func (pw *ProgressWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// voiceExtForContentType picks a file extension when the uploaded filename has none
+func voiceExtForContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "audio/wav", "audio/wave", "audio/x-wav":
+		return ".wav"
+	case "audio/mpeg", "audio/mp3":
+		return ".mp3"
+	case "audio/ogg":
+		return ".ogg"
+	case "audio/webm":
+		return ".webm"
+	case "audio/mp4", "audio/aac", "audio/x-m4a", "audio/m4a":
+		return ".m4a"
+	default:
+		return ".audio"
+	}
+}
+
+// voiceWaveformPeaks is the number of waveform bars computed for server-analyzed voice files
+const voiceWaveformPeaks = 48
+
+// maxClientWaveform bounds the waveform bars a client may send with a recording
+const maxClientWaveform = 256
+
+// minVoiceBytesPerSecond is the lowest bitrate assumed for a recording (4 kbit/s, below any
+// speech codec); it bounds the duration a client may claim for a file of a given size
+const minVoiceBytesPerSecond = 500
+
+// voiceMetaFromUpload measures PCM WAV files itself. For formats it can't read it uses the
+// client-supplied duration_ms, capped by what the file size allows, and waveform, a JSON
+// array of at most maxClientWaveform peaks of 0-100. Returns nil when nothing is known
+// about the recording.
+func voiceMetaFromUpload(c *fiber.Ctx, path string) *models.VoiceMeta {
+	if duration, peaks, err := utils.AnalyzeWAV(path, voiceWaveformPeaks); err == nil {
+		return &models.VoiceMeta{DurationMs: duration, Waveform: peaks}
+	}
+
+	duration, err := strconv.ParseInt(c.FormValue("duration_ms"), 10, 64)
+	if err != nil || duration <= 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	duration = min(duration, info.Size()*1000/minVoiceBytesPerSecond)
+	if duration <= 0 {
+		return nil
+	}
+	return &models.VoiceMeta{DurationMs: duration, Waveform: clientWaveform(c.FormValue("waveform"))}
+}
+
+// clientWaveform parses a client-supplied waveform, dropping it when it is malformed, too
+// long or has peaks outside 0-100
+func clientWaveform(raw string) []int {
+	if raw == "" {
+		return nil
+	}
+	var peaks []int
+	if err := json.Unmarshal([]byte(raw), &peaks); err != nil || len(peaks) > maxClientWaveform {
+		return nil
+	}
+	for _, p := range peaks {
+		if p < 0 || p > 100 {
+			return nil
+		}
+	}
+	return peaks
+}
+
+// withReplyVoiceURL fills the voice URL of a quoted voice message so clients can play the
+// reply preview without fetching the original message
+func withReplyVoiceURL(reply *models.Message, buildURL func(string) string) *models.Message {
+	if reply != nil && reply.Voice != nil && *reply.Voice != "" && !reply.VoiceExpired {
+		reply.VoiceURL = buildURL(*reply.Voice)
+	}
+	return reply
+}
+
 // BuildVoiceURL constructs an absolute URL for a voice file based on request host
 func BuildVoiceURL(c *fiber.Ctx, filename string) string {
 	if filename == "" {
 		return ""
 	}
+	if u := services.UploadURL("voices/" + filename); u != "" {
+		return u
+	}
 
 	// Try to get base URL from env first
 	baseURL := utils.GetEnv("BASE_URL", "")
 	if baseURL != "" {
-		return fmt.Sprintf("%s/uploads/voices/%s", baseURL, filename)
+		return baseURL + services.UploadPath("voices/"+filename)
 	}
 
 	// Extract from request
@@ -65,7 +148,7 @@ func BuildVoiceURL(c *fiber.Ctx, filename string) string {
 	}
 	host := c.Hostname()
 
-	return fmt.Sprintf("%s://%s/uploads/voices/%s", protocol, host, filename)
+	return fmt.Sprintf("%s://%s%s", protocol, host, services.UploadPath("voices/"+filename))
 }
 
 // BuildVoiceURLFromRequest constructs an absolute URL for a voice file from fasthttp request
@@ -73,11 +156,14 @@ func BuildVoiceURLFromRequest(ctx *fasthttp.RequestCtx, filename string) string
 	if filename == "" {
 		return ""
 	}
+	if u := services.UploadURL("voices/" + filename); u != "" {
+		return u
+	}
 
 	// Try to get base URL from env first
 	baseURL := utils.GetEnv("BASE_URL", "")
 	if baseURL != "" {
-		return fmt.Sprintf("%s/uploads/voices/%s", baseURL, filename)
+		return baseURL + services.UploadPath("voices/"+filename)
 	}
 
 	// Extract from request
@@ -87,7 +173,7 @@ func BuildVoiceURLFromRequest(ctx *fasthttp.RequestCtx, filename string) string
 	}
 	host := string(ctx.Host())
 
-	return fmt.Sprintf("%s://%s/uploads/voices/%s", protocol, host, filename)
+	return fmt.Sprintf("%s://%s%s", protocol, host, services.UploadPath("voices/"+filename))
 }
 
 // UploadVoiceHandler handles voice file upload with progress streaming via SSE
@@ -107,6 +193,9 @@ func UploadVoiceHandler(chatService *services.ChatService) fiber.Handler {
 		if room == "" {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "room is required"})
 		}
+		if err := chatService.CheckCanPost(c.UserContext(), room, userID, models.PostKindVoice); err != nil {
+			return roomLockError(c, err)
+		}
 
 		// Get optional reply_to_id
 		replyToIDStr := c.FormValue("reply_to_id")
@@ -119,89 +208,52 @@ func UploadVoiceHandler(chatService *services.ChatService) fiber.Handler {
 			}
 		}
 
+		// Get optional ttl (seconds until the message expires)
+		var expiresAt *time.Time
+		if ttlStr := c.FormValue("ttl"); ttlStr != "" {
+			ttl, err := strconv.Atoi(ttlStr)
+			if err == nil {
+				expiresAt, err = resolveExpiry(ttl)
+			}
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid ttl"})
+			}
+		}
+
+		// Optional text caption shown with the recording
+		caption := c.FormValue("caption")
+
 		// Get the voice file
 		fileHeader, err := c.FormFile("voice")
 		if err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "voice file is required"})
 		}
 
-		// Validate file type (optional but recommended)
-		contentType := fileHeader.Header.Get("Content-Type")
-		validTypes := map[string]bool{
-			"audio/wav":                true,
-			"audio/wave":               true,
-			"audio/x-wav":              true,
-			"audio/mpeg":               true,
-			"audio/mp3":                true,
-			"audio/ogg":                true,
-			"audio/webm":               true,
-			"audio/mp4":                true,
-			"audio/aac":                true,
-			"audio/x-m4a":              true,
-			"audio/m4a":                true,
-			"application/octet-stream": true, // Allow generic binary for flexibility
-		}
-		if !validTypes[contentType] {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-				"error":        "invalid audio file type",
-				"content_type": contentType,
-				"allowed":      "audio/wav, audio/mpeg, audio/ogg, audio/webm, audio/mp4, audio/aac, audio/m4a",
-			})
-		}
-
-		// Set up upload directory for voices
-		uploadDir := filepath.Join(utils.GetEnv("UPLOAD_DIR", "uploads"), "voices")
-		if err := os.MkdirAll(uploadDir, 0755); err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create upload dir"})
+		if err := UploadPolicy.Check(UploadVoice, fileHeader); err != nil {
+			return uploadPolicyError(c, err)
 		}
+		contentType := fileHeader.Header.Get("Content-Type")
 
 		// Generate unique filename
 		ext := filepath.Ext(fileHeader.Filename)
 		if ext == "" {
-			// Try to determine extension from content type
-			switch contentType {
-			case "audio/wav", "audio/wave", "audio/x-wav":
-				ext = ".wav"
-			case "audio/mpeg", "audio/mp3":
-				ext = ".mp3"
-			case "audio/ogg":
-				ext = ".ogg"
-			case "audio/webm":
-				ext = ".webm"
-			case "audio/mp4", "audio/aac", "audio/x-m4a", "audio/m4a":
-				ext = ".m4a"
-			default:
-				ext = ".audio"
-			}
+			ext = voiceExtForContentType(contentType)
 		}
 		filename := fmt.Sprintf("voice_%d_%d%s", userID, time.Now().UnixNano(), ext)
-		destPath := filepath.Join(uploadDir, filename)
-
-		// Open source file
-		srcFile, err := fileHeader.Open()
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to read uploaded file"})
-		}
-		defer srcFile.Close()
-
-		// Create destination file
-		destFile, err := os.Create(destPath)
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create destination file"})
-		}
-		defer destFile.Close()
 
-		// Copy file (Fiber already has the full file in memory, so progress is mainly for consistency)
-		_, err = io.Copy(destFile, srcFile)
+		// Written to a temp file and only stored once the message is saved
+		upload, err := services.SaveTempUpload(fileHeader, "voices/"+filename, nil)
 		if err != nil {
-			_ = os.Remove(destPath)
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save file"})
 		}
+		defer upload.Discard()
+
+		voiceMeta := voiceMetaFromUpload(c, upload.Path())
 
 		// Now save the message to DB
 		var replyTo *models.Message
 		if replyToID != 0 {
-			replyTo, err = chatService.GetMessageByID(context.Background(), replyToID)
+			replyTo, err = chatService.GetMessageByID(c.UserContext(), replyToID)
 			if err != nil {
 				utils.LogError(err, "GetMessageByID for voice reply")
 				// Continue without reply_to
@@ -209,21 +261,30 @@ func UploadVoiceHandler(chatService *services.ChatService) fiber.Handler {
 		}
 
 		dbMsg := &models.Message{
-			Room:     room,
-			UserID:   userID,
-			Username: username,
-			Content:  nil, // Voice message, no text
-			Voice:    &filename,
-			ReplyTo:  replyTo,
+			Room:      room,
+			UserID:    userID,
+			Username:  username,
+			Content:   optionalString(caption),
+			Voice:     &filename,
+			VoiceMeta: voiceMeta,
+			ReplyTo:   replyTo,
+			ExpiresAt: expiresAt,
 		}
 
-		if err := chatService.SaveMessage(context.Background(), dbMsg); err != nil {
-			_ = os.Remove(destPath)
+		saveStarted := clock.Now()
+		if err := chatService.SaveMessage(c.UserContext(), dbMsg); err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save message"})
 		}
+		if err := upload.Publish(c.UserContext()); err != nil {
+			utils.LogError(err, "publish voice upload")
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save file"})
+		}
+		recordUpload(userID, fileHeader.Size)
+		deliveries.start(dbMsg.ID, saveStarted)
 
 		// Build absolute voice URL
 		voiceURL := BuildVoiceURL(c, filename)
+		withReplyVoiceURL(dbMsg.ReplyTo, func(f string) string { return BuildVoiceURL(c, f) })
 		dbMsg.VoiceURL = voiceURL
 
 		// Broadcast to room
@@ -231,62 +292,46 @@ func UploadVoiceHandler(chatService *services.ChatService) fiber.Handler {
 			ID:        dbMsg.ID,
 			Event:     "chat",
 			Room:      room,
-			Text:      "",
+			Text:      caption,
 			Voice:     filename,
 			VoiceURL:  voiceURL,
+			VoiceMeta: dbMsg.VoiceMeta,
 			Username:  username,
 			Timestamp: dbMsg.CreatedAt.UnixMilli(),
 			HasSeen:   dbMsg.HasSeen,
 			ReplyTo:   dbMsg.ReplyTo,
+			ThreadID:  dbMsg.ThreadID,
+			ExpiresAt: expiresAtMillis(dbMsg.ExpiresAt),
 		}, "")
 
 		// Notify room participants who are NOT currently in this room
-		go notifyNewVoiceMessage(chatService, room, userID, username, dbMsg.CreatedAt.UnixMilli())
+		go notifyNewVoiceMessage(chatService, room, dbMsg.ID, userID, username, caption, dbMsg.CreatedAt.UnixMilli())
 
 		// Return success response
 		return c.Status(http.StatusCreated).JSON(fiber.Map{
-			"id":        dbMsg.ID,
-			"room":      room,
-			"voice":     filename,
-			"voice_url": voiceURL,
-			"timestamp": dbMsg.CreatedAt.UnixMilli(),
-			"reply_to":  dbMsg.ReplyTo,
+			"id":         dbMsg.ID,
+			"room":       room,
+			"text":       caption,
+			"voice":      filename,
+			"voice_url":  voiceURL,
+			"timestamp":  dbMsg.CreatedAt.UnixMilli(),
+			"reply_to":   dbMsg.ReplyTo,
+			"expires_at": expiresAtMillis(dbMsg.ExpiresAt),
 		})
 	}
 }
 
 // notifyNewVoiceMessage sends notification to room participants not currently in the room
-func notifyNewVoiceMessage(chatService *services.ChatService, roomID string, senderID int, senderUsername string, timestamp int64) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	participants, err := chatService.GetRoomParticipants(ctx, roomID)
-	if err != nil {
-		utils.LogError(err, "GetRoomParticipants for voice notification")
-		return
-	}
-
-	notification := map[string]interface{}{
-		"event":           "new_message",
-		"room":            roomID,
-		"sender_id":       senderID,
-		"sender_username": senderUsername,
-		"type":            "voice",
-		"timestamp":       timestamp,
-	}
+func notifyNewVoiceMessage(chatService *services.ChatService, roomID string, messageID int, senderID int, senderUsername string, caption string, timestamp int64) {
+	notifyRoomParticipants(chatService, "voice", roomID, messageID, senderID, senderUsername, caption, timestamp)
+}
 
-	for _, participantID := range participants {
-		if participantID == senderID {
-			continue
-		}
-		if !Manager.IsUserOnline(participantID) {
-			continue
-		}
-		if Manager.IsUserInRoom(participantID, roomID) {
-			continue
-		}
-		Manager.SendToUser(participantID, notification)
+// optionalString returns nil for an empty string, for nullable columns
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
 	}
+	return &s
 }
 
 // UploadVoiceWithProgressHandler handles voice upload with SSE progress events
@@ -302,8 +347,13 @@ func UploadVoiceWithProgressHandler(chatService *services.ChatService) fiber.Han
 		c.Set("Connection", "keep-alive")
 		c.Set("Transfer-Encoding", "chunked")
 
-		// Helper to send SSE event
+		// Helper to send SSE event. Errors are rejected uploads unless marked as failures.
 		sendEvent := func(eventType string, data interface{}) error {
+			if eventType == "error" {
+				if _, marked := c.Locals("upload_outcome").(string); !marked {
+					setUploadOutcome(c, "rejected")
+				}
+			}
 			jsonData, err := json.Marshal(data)
 			if err != nil {
 				return err
@@ -318,6 +368,14 @@ func UploadVoiceWithProgressHandler(chatService *services.ChatService) fiber.Han
 			_ = sendEvent("error", fiber.Map{"error": "room is required"})
 			return nil
 		}
+		if err := checkCanPost(c.UserContext(), chatService, room, userID, models.PostKindVoice); err != nil {
+			ev := fiber.Map{"error": err.Error()}
+			if code := postModeCode(err); code != "" {
+				ev["code"] = code
+			}
+			_ = sendEvent("error", ev)
+			return nil
+		}
 
 		// Get optional reply_to_id
 		replyToIDStr := c.FormValue("reply_to_id")
@@ -331,12 +389,32 @@ func UploadVoiceWithProgressHandler(chatService *services.ChatService) fiber.Han
 			}
 		}
 
+		// Get optional ttl (seconds until the message expires)
+		var expiresAt *time.Time
+		if ttlStr := c.FormValue("ttl"); ttlStr != "" {
+			ttl, err := strconv.Atoi(ttlStr)
+			if err == nil {
+				expiresAt, err = resolveExpiry(ttl)
+			}
+			if err != nil {
+				_ = sendEvent("error", fiber.Map{"error": "invalid ttl"})
+				return nil
+			}
+		}
+
+		// Optional text caption shown with the recording
+		caption := c.FormValue("caption")
+
 		// Get the voice file
 		fileHeader, err := c.FormFile("voice")
 		if err != nil {
 			_ = sendEvent("error", fiber.Map{"error": "voice file is required"})
 			return nil
 		}
+		if err := UploadPolicy.Check(UploadVoice, fileHeader); err != nil {
+			_ = sendEvent("error", err.(*uploadRejection).fields)
+			return nil
+		}
 
 		fileSize := fileHeader.Size
 
@@ -347,58 +425,34 @@ func UploadVoiceWithProgressHandler(chatService *services.ChatService) fiber.Han
 			"percent":  0,
 		})
 
-		// Set up upload directory
-		uploadDir := filepath.Join(utils.GetEnv("UPLOAD_DIR", "uploads"), "voices")
-		if err := os.MkdirAll(uploadDir, 0755); err != nil {
-			_ = sendEvent("error", fiber.Map{"error": "failed to create upload dir"})
-			return nil
-		}
-
 		// Generate unique filename
 		ext := filepath.Ext(fileHeader.Filename)
 		if ext == "" {
 			ext = ".audio"
 		}
 		filename := fmt.Sprintf("voice_%d_%d%s", userID, time.Now().UnixNano(), ext)
-		destPath := filepath.Join(uploadDir, filename)
-
-		// Open source file
-		srcFile, err := fileHeader.Open()
-		if err != nil {
-			_ = sendEvent("error", fiber.Map{"error": "failed to read uploaded file"})
-			return nil
-		}
-		defer srcFile.Close()
-
-		// Create destination file
-		destFile, err := os.Create(destPath)
-		if err != nil {
-			_ = sendEvent("error", fiber.Map{"error": "failed to create destination file"})
-			return nil
-		}
-		defer destFile.Close()
-
-		// Create progress writer
-		pw := &ProgressWriter{
-			Writer: destFile,
-			Total:  fileSize,
-			OnProgress: func(written, total int64) {
-				percent := float64(written) / float64(total) * 100
-				_ = sendEvent("progress", fiber.Map{
-					"uploaded": written,
-					"total":    total,
-					"percent":  int(percent),
-				})
-			},
-		}
 
-		// Copy with progress
-		_, err = io.Copy(pw, srcFile)
+		// Copy with progress into a temp file, stored once the message is saved
+		upload, err := services.SaveTempUpload(fileHeader, "voices/"+filename, func(w io.Writer) io.Writer {
+			return &ProgressWriter{
+				Writer: w,
+				Total:  fileSize,
+				OnProgress: func(written, total int64) {
+					percent := float64(written) / float64(total) * 100
+					_ = sendEvent("progress", fiber.Map{
+						"uploaded": written,
+						"total":    total,
+						"percent":  int(percent),
+					})
+				},
+			}
+		})
 		if err != nil {
-			_ = os.Remove(destPath)
+			setUploadOutcome(c, "failed")
 			_ = sendEvent("error", fiber.Map{"error": "failed to save file"})
 			return nil
 		}
+		defer upload.Discard()
 
 		// Send 100% progress
 		_ = sendEvent("progress", fiber.Map{
@@ -407,55 +461,74 @@ func UploadVoiceWithProgressHandler(chatService *services.ChatService) fiber.Han
 			"percent":  100,
 		})
 
+		voiceMeta := voiceMetaFromUpload(c, upload.Path())
+
 		// Save message to DB
 		var replyTo *models.Message
 		if replyToID != 0 {
-			replyTo, _ = chatService.GetMessageByID(context.Background(), replyToID)
+			replyTo, _ = chatService.GetMessageByID(c.UserContext(), replyToID)
 		}
 
 		dbMsg := &models.Message{
-			Room:     room,
-			UserID:   userID,
-			Username: username,
-			Content:  nil,
-			Voice:    &filename,
-			ReplyTo:  replyTo,
+			Room:      room,
+			UserID:    userID,
+			Username:  username,
+			Content:   optionalString(caption),
+			Voice:     &filename,
+			VoiceMeta: voiceMeta,
+			ReplyTo:   replyTo,
+			ExpiresAt: expiresAt,
 		}
 
-		if err := chatService.SaveMessage(context.Background(), dbMsg); err != nil {
-			_ = os.Remove(destPath)
+		saveStarted := clock.Now()
+		if err := chatService.SaveMessage(c.UserContext(), dbMsg); err != nil {
+			setUploadOutcome(c, "failed")
 			_ = sendEvent("error", fiber.Map{"error": "failed to save message"})
 			return nil
 		}
+		if err := upload.Publish(c.UserContext()); err != nil {
+			utils.LogError(err, "publish voice upload")
+			setUploadOutcome(c, "failed")
+			_ = sendEvent("error", fiber.Map{"error": "failed to save file"})
+			return nil
+		}
+		recordUpload(userID, fileSize)
+		deliveries.start(dbMsg.ID, saveStarted)
 
 		// Build absolute voice URL
 		voiceURL := BuildVoiceURL(c, filename)
+		withReplyVoiceURL(dbMsg.ReplyTo, func(f string) string { return BuildVoiceURL(c, f) })
 
 		// Broadcast to room
 		Manager.Broadcast(room, models.WSMessage{
 			ID:        dbMsg.ID,
 			Event:     "chat",
 			Room:      room,
-			Text:      "",
+			Text:      caption,
 			Voice:     filename,
 			VoiceURL:  voiceURL,
+			VoiceMeta: dbMsg.VoiceMeta,
 			Username:  username,
 			Timestamp: dbMsg.CreatedAt.UnixMilli(),
 			HasSeen:   dbMsg.HasSeen,
 			ReplyTo:   dbMsg.ReplyTo,
+			ThreadID:  dbMsg.ThreadID,
+			ExpiresAt: expiresAtMillis(dbMsg.ExpiresAt),
 		}, "")
 
 		// Notify others
-		go notifyNewVoiceMessage(chatService, room, userID, username, dbMsg.CreatedAt.UnixMilli())
+		go notifyNewVoiceMessage(chatService, room, dbMsg.ID, userID, username, caption, dbMsg.CreatedAt.UnixMilli())
 
 		// Send completion event
 		_ = sendEvent("complete", fiber.Map{
-			"id":        dbMsg.ID,
-			"room":      room,
-			"voice":     filename,
-			"voice_url": voiceURL,
-			"timestamp": dbMsg.CreatedAt.UnixMilli(),
-			"reply_to":  dbMsg.ReplyTo,
+			"id":         dbMsg.ID,
+			"room":       room,
+			"text":       caption,
+			"voice":      filename,
+			"voice_url":  voiceURL,
+			"timestamp":  dbMsg.CreatedAt.UnixMilli(),
+			"reply_to":   dbMsg.ReplyTo,
+			"expires_at": expiresAtMillis(dbMsg.ExpiresAt),
 		})
 
 		return nil
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"chat-backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPlaylistLimit = 50
+	maxPlaylistLimit     = 200
+)
+
+// PlaylistItem is one voice message of a playlist
+type PlaylistItem struct {
+	ID         int    `json:"id"`
+	UserID     int    `json:"user_id"`
+	Username   string `json:"username"`
+	VoiceURL   string `json:"voice_url"`
+	DurationMs int64  `json:"duration_ms,omitempty"` // 0 when the recording wasn't analyzed
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// VoicePlaylistHandler returns consecutive voice messages of a room for continuous playback.
+// Query params:
+// - from: message id to start at; without it the run ending at the newest message is returned
+// - limit: max items (default 50, max 200)
+// - format: "json" (default) or "m3u" for an extended M3U playlist players can open directly
+func VoicePlaylistHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roomID := c.Params("id")
+		from := c.QueryInt("from", 0)
+		limit := c.QueryInt("limit", defaultPlaylistLimit)
+		if limit <= 0 || limit > maxPlaylistLimit {
+			limit = defaultPlaylistLimit
+		}
+		format := c.Query("format", "json")
+		if format != "json" && format != "m3u" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "format must be json or m3u"})
+		}
+
+		run, more, err := chatService.GetVoiceRun(c.UserContext(), roomID, from, limit)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load voice messages"})
+		}
+
+		items := make([]PlaylistItem, 0, len(run))
+		var total int64
+		for _, m := range run {
+			item := PlaylistItem{
+				ID:        m.ID,
+				UserID:    m.UserID,
+				Username:  m.Username,
+				VoiceURL:  BuildVoiceURL(c, *m.Voice),
+				Timestamp: m.CreatedAt.UnixMilli(),
+			}
+			if m.VoiceMeta != nil {
+				item.DurationMs = m.VoiceMeta.DurationMs
+			}
+			total += item.DurationMs
+			items = append(items, item)
+		}
+
+		if format == "m3u" {
+			var b strings.Builder
+			b.WriteString("#EXTM3U\n")
+			for _, item := range items {
+				seconds := -1 // Unknown length
+				if item.DurationMs > 0 {
+					seconds = int((item.DurationMs + 999) / 1000)
+				}
+				fmt.Fprintf(&b, "#EXTINF:%d,%s\n%s\n", seconds, strings.ReplaceAll(item.Username, "\n", " "), item.VoiceURL)
+			}
+			c.Set(fiber.HeaderContentType, "audio/x-mpegurl")
+			return c.SendString(b.String())
+		}
+
+		resp := fiber.Map{
+			"room":              roomID,
+			"items":             items,
+			"total_duration_ms": total,
+			"more":              more,
+		}
+		// Forward runs continue from the message after the last one returned
+		if more && from > 0 && len(items) > 0 {
+			resp["next_from"] = items[len(items)-1].ID + 1
+		}
+		return c.JSON(resp)
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// stagedMediaError maps staging service errors to responses
+func stagedMediaError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "staged upload not found"})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// StageMediaHandler stores an upload without creating a message and returns its media id.
+// Form fields: file (or voice), room, and for recordings duration_ms / waveform.
+// The media is sent with /api/media/:id/publish or a WS chat event carrying media_id,
+// and can be cancelled with DELETE /api/media/:id. Only voice recordings are accepted for now.
+func StageMediaHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+
+		room := c.FormValue("room")
+		if room == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "room is required"})
+		}
+		ok, err := chatService.IsRoomParticipant(c.UserContext(), room, userID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check room membership"})
+		}
+		if !ok {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "not a participant of this room"})
+		}
+		if err := chatService.CheckCanPost(c.UserContext(), room, userID, models.PostKindVoice); err != nil {
+			return roomLockError(c, err)
+		}
+
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			fileHeader, err = c.FormFile("voice")
+		}
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "file is required"})
+		}
+		if err := UploadPolicy.Check(UploadVoice, fileHeader); err != nil {
+			return uploadPolicyError(c, err)
+		}
+		contentType := fileHeader.Header.Get("Content-Type")
+
+		ext := filepath.Ext(fileHeader.Filename)
+		if ext == "" {
+			ext = voiceExtForContentType(contentType)
+		}
+		filename := fmt.Sprintf("voice_%d_%d%s", userID, time.Now().UnixNano(), ext)
+		upload, err := services.SaveTempUpload(fileHeader, "voices/"+filename, nil)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save file"})
+		}
+		defer upload.Discard()
+
+		staged := &models.StagedMedia{
+			UserID:    userID,
+			Room:      room,
+			Kind:      "voice",
+			Filename:  filename,
+			VoiceMeta: voiceMetaFromUpload(c, upload.Path()),
+		}
+		if err := chatService.StageMedia(c.UserContext(), staged); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to stage upload"})
+		}
+		if err := upload.Publish(c.UserContext()); err != nil {
+			utils.LogError(err, "publish staged voice")
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save file"})
+		}
+		recordUpload(userID, fileHeader.Size)
+
+		staged.URL = BuildVoiceURL(c, filename)
+		return c.Status(http.StatusCreated).JSON(staged)
+	}
+}
+
+// TrimVoiceHandler cuts a staged voice recording to [start_ms, end_ms).
+// Trimming is done server-side and only supports PCM WAV; other formats must be trimmed by the client.
+func TrimVoiceHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+
+		var req models.TrimVoiceRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		if req.StartMs < 0 || (req.EndMs != 0 && req.EndMs <= req.StartMs) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid trim range"})
+		}
+
+		staged, err := chatService.GetStagedMedia(c.UserContext(), c.Params("id"), userID)
+		if err != nil {
+			return stagedMediaError(c, err)
+		}
+		if staged.Kind != "voice" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "staged upload is not a voice message"})
+		}
+
+		srcPath, release, err := services.FetchUpload(c.UserContext(), "voices/"+staged.Filename)
+		if err != nil {
+			utils.LogError(err, "fetch staged voice")
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to trim voice"})
+		}
+		defer release()
+		filename := fmt.Sprintf("voice_%d_%d%s", userID, time.Now().UnixNano(), filepath.Ext(staged.Filename))
+		upload, err := services.NewTempUpload("voices/" + filename)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to trim voice"})
+		}
+		defer upload.Discard()
+		if err := upload.Close(); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to trim voice"})
+		}
+		if err := utils.TrimWAV(srcPath, upload.Path(), req.StartMs, req.EndMs); err != nil {
+			if errors.Is(err, utils.ErrUnsupportedAudio) {
+				return c.Status(http.StatusUnsupportedMediaType).JSON(fiber.Map{"error": "server-side trimming only supports PCM WAV"})
+			}
+			if errors.Is(err, utils.ErrTrimRange) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to trim voice"})
+		}
+
+		var meta *models.VoiceMeta
+		if duration, peaks, err := utils.AnalyzeWAV(upload.Path(), voiceWaveformPeaks); err == nil {
+			meta = &models.VoiceMeta{DurationMs: duration, Waveform: peaks}
+		}
+		if err := chatService.ReplaceStagedMediaFile(c.UserContext(), staged.ID, filename, meta); err != nil {
+			return stagedMediaError(c, err)
+		}
+		if err := upload.Publish(c.UserContext()); err != nil {
+			utils.LogError(err, "publish trimmed voice")
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to trim voice"})
+		}
+		services.DeleteUpload(c.UserContext(), "voices/"+staged.Filename)
+
+		staged.Filename = filename
+		staged.VoiceMeta = meta
+		staged.URL = BuildVoiceURL(c, filename)
+		return c.JSON(staged)
+	}
+}
+
+// CancelStagedMediaHandler discards a staged upload that was never published
+func CancelStagedMediaHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+
+		staged, err := chatService.DeleteStagedMedia(c.UserContext(), c.Params("id"), userID)
+		if err != nil {
+			return stagedMediaError(c, err)
+		}
+		services.DeleteUpload(c.UserContext(), "voices/"+staged.Filename)
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// PublishMediaHandler sends a staged upload to its room
+func PublishMediaHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		username := c.Locals("username").(string)
+
+		var req models.PublishMediaRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+			}
+		}
+		expiresAt, err := resolveExpiry(req.TTL)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid ttl"})
+		}
+		staged, err := chatService.GetStagedMedia(c.UserContext(), c.Params("id"), userID)
+		if err != nil {
+			return stagedMediaError(c, err)
+		}
+		if err := chatService.CheckCanPost(c.UserContext(), staged.Room, userID, models.PostKindVoice); err != nil {
+			return roomLockError(c, err)
+		}
+
+		dbMsg := &models.Message{
+			UserID:    userID,
+			Username:  username,
+			ExpiresAt: expiresAt,
+		}
+		dbMsg.Content = optionalString(req.Text)
+		if req.ReplyToID != 0 {
+			if replyTo, err := chatService.GetMessageByID(c.UserContext(), req.ReplyToID); err == nil {
+				dbMsg.ReplyTo = replyTo
+			}
+		}
+
+		if err := chatService.PublishStagedMedia(c.UserContext(), c.Params("id"), userID, dbMsg); err != nil {
+			return stagedMediaError(c, err)
+		}
+
+		voiceURL := BuildVoiceURL(c, *dbMsg.Voice)
+		withReplyVoiceURL(dbMsg.ReplyTo, func(f string) string { return BuildVoiceURL(c, f) })
+
+		Manager.Broadcast(dbMsg.Room, models.WSMessage{
+			ID:        dbMsg.ID,
+			Event:     "chat",
+			Room:      dbMsg.Room,
+			Text:      req.Text,
+			Voice:     *dbMsg.Voice,
+			VoiceURL:  voiceURL,
+			VoiceMeta: dbMsg.VoiceMeta,
+			Username:  username,
+			Timestamp: dbMsg.CreatedAt.UnixMilli(),
+			HasSeen:   dbMsg.HasSeen,
+			ReplyTo:   dbMsg.ReplyTo,
+			ThreadID:  dbMsg.ThreadID,
+			ExpiresAt: expiresAtMillis(dbMsg.ExpiresAt),
+		}, "")
+
+		go notifyNewVoiceMessage(chatService, dbMsg.Room, dbMsg.ID, userID, username, req.Text, dbMsg.CreatedAt.UnixMilli())
+
+		return c.Status(http.StatusCreated).JSON(fiber.Map{
+			"id":         dbMsg.ID,
+			"room":       dbMsg.Room,
+			"text":       req.Text,
+			"voice":      *dbMsg.Voice,
+			"voice_url":  voiceURL,
+			"voice_meta": dbMsg.VoiceMeta,
+			"timestamp":  dbMsg.CreatedAt.UnixMilli(),
+			"reply_to":   dbMsg.ReplyTo,
+			"expires_at": expiresAtMillis(dbMsg.ExpiresAt),
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestClientWaveform(t *testing.T) {
+	tooLong := "[" + strings.Repeat("1,", maxClientWaveform) + "1]"
+	tests := []struct {
+		raw  string
+		want []int
+	}{
+		{"", nil},
+		{"[0, 50, 100]", []int{0, 50, 100}},
+		{"[0, 101]", nil},
+		{"[-1]", nil},
+		{"not json", nil},
+		{tooLong, nil},
+	}
+	for _, tt := range tests {
+		if got := clientWaveform(tt.raw); !slices.Equal(got, tt.want) {
+			t.Errorf("clientWaveform(%.20q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errWebhooksUnavailable is returned for webhook posts while there is no bot account to post as
+var errWebhooksUnavailable = errors.New("webhooks are unavailable: the bot account is not set up")
+
+// webhookError maps webhook service errors onto HTTP responses
+func webhookError(c *fiber.Ctx, err error, action string) error {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "webhook not found"})
+	case errors.Is(err, services.ErrNotMember):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrForbiddenRole):
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	utils.LogError(err, action)
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to " + action})
+}
+
+// CreateWebhookHandler creates an incoming webhook for the room. The returned URL contains
+// the secret and is only shown once. Room owners and admins only.
+func CreateWebhookHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.CreateWebhookRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > 100 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name is required (max 100 characters)"})
+		}
+		if req.Template != nil {
+			if _, err := services.ParseWebhookTemplate(*req.Template); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid template: " + err.Error()})
+			}
+		}
+
+		userID := c.Locals("user_id").(int)
+		webhook, token, err := chatService.CreateWebhook(c.UserContext(), c.Params("id"), userID, req, isAppAdmin(c))
+		if err != nil {
+			return webhookError(c, err, "create webhook")
+		}
+		webhook.URL = baseURLFromRequest(c) + "/hooks/" + token
+		return c.Status(http.StatusCreated).JSON(webhook)
+	}
+}
+
+// ListWebhooksHandler lists the room's webhooks to owners and admins; URLs aren't included
+func ListWebhooksHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		webhooks, err := chatService.ListWebhooks(c.UserContext(), c.Params("id"), c.Locals("user_id").(int), isAppAdmin(c))
+		if err != nil {
+			return webhookError(c, err, "list webhooks")
+		}
+		return c.JSON(webhooks)
+	}
+}
+
+// DeleteWebhookHandler revokes a webhook; owners and admins only
+func DeleteWebhookHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		webhookID, err := strconv.Atoi(c.Params("webhookId"))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid webhook id"})
+		}
+		if err := chatService.DeleteWebhook(c.UserContext(), c.Params("id"), c.Locals("user_id").(int), webhookID, isAppAdmin(c)); err != nil {
+			return webhookError(c, err, "delete webhook")
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// IncomingWebhookHandler accepts a JSON POST on a webhook URL and posts it to the room under
+// the webhook's name, see services.WebhookSenderName. The token in the URL is the only
+// credential.
+func IncomingWebhookHandler(chatService *services.ChatService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !services.FeatureEnabled(services.FeatureWebhooks) {
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "webhooks are disabled"})
+		}
+		webhook, err := chatService.AuthenticateWebhook(c.UserContext(), c.Params("token"))
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidWebhook) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "unknown webhook"})
+			}
+			utils.LogError(err, "AuthenticateWebhook")
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "webhook unavailable"})
+		}
+
+		var payload interface{}
+		if err := json.Unmarshal(c.Body(), &payload); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "body must be JSON"})
+		}
+		tmpl := ""
+		if webhook.Template != nil {
+			tmpl = *webhook.Template
+		}
+		text, err := services.RenderWebhookMessage(tmpl, payload)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "template failed: " + err.Error()})
+		}
+		if text == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "payload produced an empty message"})
+		}
+
+		if err := postWebhookMessage(chatService, webhook, text); err != nil {
+			if errors.Is(err, errWebhooksUnavailable) {
+				return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+			}
+			utils.LogError(err, "Webhook post")
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to post message"})
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// postWebhookMessage saves a webhook message and delivers it like a chat message from the bot
+func postWebhookMessage(chatService *services.ChatService, webhook *models.RoomWebhook, text string) error {
+	if Bot == nil {
+		return errWebhooksUnavailable
+	}
+	msg, err := Bot.PostWebhookMessage(context.Background(), webhook.RoomID, webhook.Name, text)
+	if err != nil {
+		return err
+	}
+	Manager.Broadcast(webhook.RoomID, models.WSMessage{
+		ID:        msg.ID,
+		Event:     "chat",
+		Room:      webhook.RoomID,
+		Text:      text,
+		Username:  msg.Username,
+		Timestamp: msg.CreatedAt.UnixMilli(),
+	}, "")
+	go notifyRoomParticipants(chatService, "webhook", webhook.RoomID, msg.ID, msg.UserID, msg.Username, text, msg.CreatedAt.UnixMilli())
+	return nil
+}
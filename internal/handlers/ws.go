@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
@@ -20,21 +21,68 @@ func WebSocketHandler(chatService *services.ChatService) fiber.Handler {
 		userID := c.Locals("user_id").(int)
 		username := c.Locals("username").(string)
 
+		// Shed load when the node is at capacity; the close frame tells the client how to back off
+		if maxConns := utils.GetEnvInt("WS_MAX_CONNECTIONS", 0); maxConns > 0 && Manager.Stats().Connections >= maxConns {
+			wsConnects.Inc("capacity")
+			closeWithHints(c, closeTryAgainLater, currentReconnectHints())
+			return
+		}
+
+		// Checked again, uncached, so a ban is never missed when connecting
+		if banned, err := services.IsUserBanned(context.Background(), userID); err != nil || banned {
+			utils.LogError(err, "IsUserBanned")
+			wsConnects.Inc("banned")
+			_ = c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closePolicyViolation, "account banned"), time.Now().Add(time.Second))
+			_ = c.Close()
+			return
+		}
+
+		wsConnects.Inc("accepted")
+
 		// Generate a unique ID for this connection
 		connID := uuid.New().String()
 
-		// Register connection atomically and check if user just came online
-		justCameOnline := Manager.RegisterConnection(connID, userID, username, c)
+		// Context bound to the connection lifetime; in-flight queries are cancelled on disconnect
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// Every write to c goes through client's writer goroutine from here on
+		client := newWSClient(c)
+		keepAlive(c, client)
+
+		// Register connection atomically and check if user just came online. A new
+		// connection also brings a user back from away.
+		wasAway := Activity.touch(userID, username)
+		justCameOnline := Manager.RegisterConnection(connID, userID, username, client)
+		if wasAway {
+			Cluster.presenceChanged(userID)
+		}
 
-		// If user just came online, notify users who share rooms with them
-		if justCameOnline {
-			go notifyUserStatusChange(chatService, userID, username, "online")
+		// If user just came online, notify users who share rooms with them. Users already
+		// connected to another instance were announced by that instance.
+		if (justCameOnline && !Cluster.userOnline(userID)) || wasAway {
+			go notifyUserStatusChange(chatService, userID, username, "online", nil)
 		}
 
-		var currentRoom string
+		go touchLastSeen(chatService, userID)
+
+		// Give the new connection the current unread badge total
+		go adjustBadge(chatService, userID, 0)
+
+		session := &wsSession{
+			ctx:         ctx,
+			conn:        c,
+			client:      client,
+			connID:      connID,
+			userID:      userID,
+			username:    username,
+			chatService: chatService,
+			// Checked just above
+			authCheckedAt: clock.Now(),
+		}
 
 		defer func() {
-			if currentRoom != "" {
+			if currentRoom := session.currentRoom; currentRoom != "" {
 				Manager.Leave(currentRoom, connID)
 				// Notify others
 				Manager.Broadcast(currentRoom, map[string]interface{}{
@@ -49,17 +97,20 @@ func WebSocketHandler(chatService *services.ChatService) fiber.Handler {
 
 			// If this was the last connection, user is now offline
 			if wentOffline {
-				go notifyUserStatusChange(chatService, userID, username, "offline")
+				userWentOffline(chatService, userID, username)
 			}
 
-			c.Close()
+			client.Close()
 		}()
 
 		// Send welcome message
-		utils.SendJSON(c, map[string]string{
+		session.send(map[string]string{
 			"event":   "connected",
 			"message": "Welcome to the chat server",
 		})
+		if ev, ok := dbOutage.status(); ok {
+			session.send(ev)
+		}
 
 		for {
 			msgType, msg, err := c.ReadMessage()
@@ -69,14 +120,45 @@ func WebSocketHandler(chatService *services.ChatService) fiber.Handler {
 				}
 				break
 			}
+			heardFrom(c, client)
 
-			HandleMessage(c, msgType, msg, chatService, userID, username, &currentRoom, connID)
+			HandleMessage(session, msgType, msg)
 		}
 	})
 }
 
-// notifyUserStatusChange notifies all users who share rooms with the given user about their status change
-func notifyUserStatusChange(chatService *services.ChatService, userID int, username string, status string) {
+// userWentOffline runs when the last connection of userID on this instance is gone. Users
+// still connected to another instance or polling stay online.
+func userWentOffline(chatService *services.ChatService, userID int, username string) {
+	Badges.Forget(userID)
+	Activity.forget(userID)
+	// Users still connected to another instance or long-polling stay online
+	announce := !Cluster.userOnline(userID) && !Polls.active(userID)
+	if !Cluster.userOnline(userID) {
+		endUserCalls(userID)
+	}
+	go func() {
+		lastSeen := touchLastSeen(chatService, userID)
+		if announce {
+			notifyUserStatusChange(chatService, userID, username, "offline", lastSeen)
+		}
+	}()
+}
+
+// touchLastSeen records the connect or disconnect time reported as last_seen by the presence
+// API and returns it; nil when it couldn't be stored
+func touchLastSeen(chatService *services.ChatService, userID int) *time.Time {
+	at, err := chatService.TouchLastSeen(context.Background(), userID)
+	if err != nil {
+		utils.LogError(err, "TouchLastSeen")
+		return nil
+	}
+	return &at
+}
+
+// notifyUserStatusChange notifies all users who share rooms with the given user about their
+// status change. lastSeen, set when the user went offline, is sent as last_seen.
+func notifyUserStatusChange(chatService *services.ChatService, userID int, username string, status string, lastSeen *time.Time) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -95,6 +177,9 @@ func notifyUserStatusChange(chatService *services.ChatService, userID int, usern
 		"status":    status,
 		"timestamp": time.Now().UnixMilli(),
 	}
+	if lastSeen != nil {
+		statusMsg["last_seen"] = lastSeen.UnixMilli()
+	}
 
 	for _, uid := range sharedUsers {
 		Manager.SendToUser(uid, statusMsg)
@@ -104,12 +189,28 @@ func notifyUserStatusChange(chatService *services.ChatService, userID int, usern
 // WSUpgradeMiddleware upgrades the connection to WebSocket
 func WSUpgradeMiddleware(c *fiber.Ctx) error {
 	if websocket.IsWebSocketUpgrade(c) {
+		// Stop other websites from opening a socket with a token they obtained
+		if reason := checkUpgradeOrigin(c); reason != "" {
+			rejectedUpgrades.Inc(reason)
+			wsConnects.Inc("origin")
+			return fiber.NewError(fiber.StatusForbidden, "Origin not allowed")
+		}
 		c.Locals("allowed", true)
 		return c.Next()
 	}
 	return fiber.ErrUpgradeRequired
 }
 
+// WSAuthMiddleware is AuthMiddleware for websocket upgrades; rejected tokens count in ws_connects_total
+func WSAuthMiddleware(c *fiber.Ctx) error {
+	err := AuthMiddleware(c)
+	var fe *fiber.Error
+	if errors.As(err, &fe) && fe.Code == fiber.StatusUnauthorized {
+		wsConnects.Inc("unauthorized")
+	}
+	return err
+}
+
 // AuthMiddleware verifies the JWT token before upgrading
 func AuthMiddleware(c *fiber.Ctx) error {
 	// Get token from query param `access_token` or Authorization header
@@ -142,5 +243,16 @@ func AuthMiddleware(c *fiber.Ctx) error {
 		c.Locals("username", u)
 	}
 
+	// Access tokens outlive a ban or deletion by up to an hour; the account is checked on
+	// every request
+	if err := accountLockout(c.UserContext(), c.Locals("user_id").(int)); errors.Is(err, services.ErrUserDeleted) {
+		return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+	} else if isLockout(err) {
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	} else if err != nil {
+		utils.LogError(err, "accountLockout")
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Failed to check account")
+	}
+
 	return c.Next()
 }
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/services"
+	"chat-backend/internal/utils"
+)
+
+// wsEvent is an incoming event on its way through the pipeline
+type wsEvent struct {
+	name    string
+	data    json.RawMessage
+	handler *eventHandler
+	req     any // Set by the validation stage
+}
+
+// eventStage checks an event before it reaches its handler. An error stops the event: it
+// is sent back to the client, except errEventDropped, which means the stage already told
+// the client what it needed to know.
+type eventStage func(s *wsSession, ev *wsEvent) error
+
+// eventPipeline runs in order for every event
+var eventPipeline = []eventStage{
+	checkAuthFresh,
+	limitEventRate,
+	validateEvent,
+	checkRoomAccess,
+	moderateEvent,
+}
+
+// errEventDropped stops an event without an error event
+var errEventDropped = errors.New("event dropped")
+
+// errRoomAccess is returned for room scoped events on rooms the user can't access
+var errRoomAccess = errors.New("not a participant of this room")
+
+// errBlockedContent is returned for text containing a word from WS_BLOCKED_WORDS
+var errBlockedContent = errors.New("message contains blocked words")
+
+func runEventPipeline(s *wsSession, ev *wsEvent) error {
+	for _, stage := range eventPipeline {
+		if err := stage(s, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventErrorCode is the code sent with an error event, "" for errors without one
+func eventErrorCode(err error) string {
+	switch {
+	case errors.Is(err, errRoomAccess):
+		return "room_access_denied"
+	case errors.Is(err, errBlockedContent):
+		return "blocked_content"
+	case errors.Is(err, errCallBusy):
+		return "busy"
+	case errors.Is(err, errCallOffline):
+		return "callee_offline"
+	case errors.Is(err, errOutageQueueFull):
+		return "degraded"
+	}
+	return postModeCode(err)
+}
+
+// wsEventPolicy holds the reloadable settings of the pipeline
+var wsEventPolicy struct {
+	sync.RWMutex
+	recheck time.Duration   // How long an account or room check is trusted
+	blocked map[string]bool // Lower-cased blocked words
+}
+
+// LoadWSEventPolicy applies WS_AUTH_RECHECK_INTERVAL (default 1m), how often a connection's
+// account and room access are checked again, and WS_BLOCKED_WORDS, the comma-separated words
+// chat messages and edits may not contain
+func LoadWSEventPolicy() error {
+	recheck := utils.GetEnvDuration("WS_AUTH_RECHECK_INTERVAL", time.Minute)
+	if recheck <= 0 {
+		return fmt.Errorf("WS_AUTH_RECHECK_INTERVAL must be positive")
+	}
+	blocked := map[string]bool{}
+	for _, w := range strings.Split(utils.GetEnv("WS_BLOCKED_WORDS", ""), ",") {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			blocked[w] = true
+		}
+	}
+
+	wsEventPolicy.Lock()
+	wsEventPolicy.recheck = recheck
+	wsEventPolicy.blocked = blocked
+	wsEventPolicy.Unlock()
+	return nil
+}
+
+func recheckInterval() time.Duration {
+	wsEventPolicy.RLock()
+	defer wsEventPolicy.RUnlock()
+	if wsEventPolicy.recheck <= 0 {
+		return time.Minute
+	}
+	return wsEventPolicy.recheck
+}
+
+// checkAuthFresh closes the connection once the account is banned or deleted. Access tokens
+// are only checked when connecting, so a long-lived connection is checked again every
+// WS_AUTH_RECHECK_INTERVAL.
+func checkAuthFresh(s *wsSession, _ *wsEvent) error {
+	if since(s.authCheckedAt) < recheckInterval() {
+		return nil
+	}
+	banned, err := services.IsUserBanned(s.ctx, s.userID)
+	if err != nil {
+		// Let the event through and check again on the next one
+		utils.LogError(err, "IsUserBanned")
+		return nil
+	}
+	if banned {
+		s.client.CloseAfterPending(closePolicyViolation, "account banned")
+		return errEventDropped
+	}
+	s.authCheckedAt = clock.Now()
+	return nil
+}
+
+// limitEventRate applies WS_RATE_LIMITS and, to chat, the chat token bucket. Events past the
+// limits count as usage and activity.
+func limitEventRate(s *wsSession, ev *wsEvent) error {
+	if !allowEvent(s, ev.name) {
+		return errEventDropped
+	}
+	if ev.name == "chat" && !allowChat(s) {
+		return errEventDropped
+	}
+	recordUsage(s.userID, models.UsageCounts{WSEvents: 1})
+	userActed(s)
+	return nil
+}
+
+// validateEvent decodes the payload and, if the request implements models.Validator,
+// validates it
+func validateEvent(_ *wsSession, ev *wsEvent) error {
+	req, err := ev.handler.decode(ev.data)
+	if err != nil {
+		return err
+	}
+	if v, ok := req.(models.Validator); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+	ev.req = req
+	return nil
+}
+
+// targetRoom is the room a room scoped event acts on: the one it names, or the current room
+func targetRoom(s *wsSession, req any) string {
+	if t, ok := req.(models.RoomTarget); ok && t.TargetRoom() != "" {
+		return t.TargetRoom()
+	}
+	return s.currentRoom
+}
+
+// checkRoomAccess drops room scoped events without a room and rejects those on rooms the
+// user can't access. A room found accessible is trusted for WS_AUTH_RECHECK_INTERVAL.
+func checkRoomAccess(s *wsSession, ev *wsEvent) error {
+	if !ev.handler.inRoom {
+		return nil
+	}
+	room := targetRoom(s, ev.req)
+	if room == "" {
+		return errEventDropped
+	}
+	if room == s.roomAccess && since(s.roomAccessAt) < recheckInterval() {
+		return nil
+	}
+	ok, err := s.chatService.CanAccessRoom(s.ctx, room, s.userID)
+	if err != nil {
+		if room == s.roomAccess && dbOutage.isActive() {
+			// Trust the last check until the database is back
+			return nil
+		}
+		utils.LogError(err, "CanAccessRoom")
+		return errors.New("failed to check room access")
+	}
+	if !ok {
+		return errRoomAccess
+	}
+	s.roomAccess = room
+	s.roomAccessAt = clock.Now()
+	return nil
+}
+
+// moderateEvent rejects user text containing a blocked word, matched whole and ignoring case
+func moderateEvent(_ *wsSession, ev *wsEvent) error {
+	m, ok := ev.req.(models.Moderated)
+	if !ok {
+		return nil
+	}
+	wsEventPolicy.RLock()
+	blocked := wsEventPolicy.blocked
+	wsEventPolicy.RUnlock()
+	if len(blocked) == 0 {
+		return nil
+	}
+	words := strings.FieldsFunc(strings.ToLower(m.UserText()), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if blocked[w] {
+			return errBlockedContent
+		}
+	}
+	return nil
+}
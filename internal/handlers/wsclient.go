@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/utils"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// closePolicyViolation is sent to clients evicted for not reading their events
+const closePolicyViolation = 1008
+
+var (
+	errClientClosed = errors.New("websocket connection closed")
+	errSlowClient   = errors.New("websocket send buffer full")
+
+	slowClientEvictions = metrics.NewCounter("ws_slow_client_evictions_total", "Connections closed because their send buffer filled up")
+)
+
+// closeRequest asks the writer to send a close frame once queued events are written
+type closeRequest struct {
+	code   int
+	reason string
+}
+
+// slowConsumerClose evicts a client whose queue filled up; its queued events are dropped
+var slowConsumerClose = closeRequest{code: closePolicyViolation, reason: "slow consumer"}
+
+// wsFrame is an encoded event waiting for the writer; written, when set, runs on the
+// writer goroutine once the frame was written to the socket
+type wsFrame struct {
+	b       []byte
+	written func()
+}
+
+// wsClient owns the write side of one websocket connection. The websocket library supports
+// a single concurrent writer, so events are only queued here (Send never blocks) and one
+// writer goroutine writes them in order. A client whose queue fills up (WS_SEND_BUFFER
+// events) is evicted rather than stalling broadcasts to everyone else. The writer also pings
+// the client every WS_PING_INTERVAL; see heartbeat.go.
+type wsClient struct {
+	conn      *websocket.Conn
+	send      chan wsFrame
+	closing   chan closeRequest
+	done      chan struct{}
+	closeOnce sync.Once
+	evicted   atomic.Bool  // The queue filled up; the writer closes without flushing it
+	lastRead  atomic.Int64 // Unix nanos of the last frame or pong from the client
+}
+
+func newWSClient(conn *websocket.Conn) *wsClient {
+	c := &wsClient{
+		conn:    conn,
+		send:    make(chan wsFrame, max(utils.GetEnvInt("WS_SEND_BUFFER", 256), 1)),
+		closing: make(chan closeRequest, 1),
+		done:    make(chan struct{}),
+	}
+	c.touch()
+	go c.writePump(utils.GetEnvDuration("WS_WRITE_TIMEOUT", 10*time.Second), wsPingInterval())
+	return c
+}
+
+// touch records that the client was heard from
+func (c *wsClient) touch() {
+	c.lastRead.Store(clock.Now().UnixNano())
+}
+
+// idle is how long the client has been silent
+func (c *wsClient) idle() time.Duration {
+	return since(time.Unix(0, c.lastRead.Load()))
+}
+
+// Send encodes payload and queues it for the writer
+func (c *wsClient) Send(payload interface{}) error {
+	return c.sendThen(payload, nil)
+}
+
+// sendThen is Send calling written once the event was written
+func (c *wsClient) sendThen(payload interface{}, written func()) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.enqueueFrame(wsFrame{b: b, written: written})
+}
+
+// enqueue queues an encoded frame, evicting the client when its queue is full
+func (c *wsClient) enqueue(b []byte) error {
+	return c.enqueueFrame(wsFrame{b: b})
+}
+
+// enqueueFrame never blocks: it runs under the room manager's lock during broadcasts, so an
+// eviction only marks the client and leaves the close frame to the writer
+func (c *wsClient) enqueueFrame(f wsFrame) error {
+	select {
+	case <-c.done:
+		return errClientClosed
+	default:
+	}
+	if c.evicted.Load() {
+		return errSlowClient
+	}
+	select {
+	case c.send <- f:
+		return nil
+	default:
+		if c.evicted.CompareAndSwap(false, true) {
+			slowClientEvictions.Inc()
+			c.requestClose(slowConsumerClose)
+		}
+		return errSlowClient
+	}
+}
+
+// CloseAfterPending writes the events already queued, then a close frame, and closes the connection
+func (c *wsClient) CloseAfterPending(code int, reason string) {
+	c.requestClose(closeRequest{code: code, reason: reason})
+}
+
+// requestClose hands req to the writer. If a close is already pending the writer still
+// sees an eviction through evicted.
+func (c *wsClient) requestClose(req closeRequest) {
+	select {
+	case c.closing <- req:
+	default:
+		// A close is already pending
+	}
+}
+
+// Close closes the connection immediately, dropping queued events
+func (c *wsClient) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		_ = c.conn.Close()
+	})
+}
+
+// closeNow sends a close frame and closes the connection; only the writer goroutine calls it
+func (c *wsClient) closeNow(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+		_ = c.conn.Close()
+	})
+}
+
+func (c *wsClient) writePump(timeout, pingInterval time.Duration) {
+	var ping <-chan time.Time
+	if pingInterval > 0 {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+	for {
+		// A pending close goes first, so a full queue doesn't delay an eviction
+		select {
+		case req := <-c.closing:
+			c.finish(req, timeout)
+			return
+		default:
+		}
+		select {
+		case <-c.done:
+			return
+		case f := <-c.send:
+			if !c.write(f, timeout) {
+				return
+			}
+		case <-ping:
+			if !c.ping(timeout) {
+				return
+			}
+		case req := <-c.closing:
+			c.finish(req, timeout)
+			return
+		}
+	}
+}
+
+// finish flushes what was queued before the close was requested, unless the client is
+// being evicted, then sends the close frame
+func (c *wsClient) finish(req closeRequest, timeout time.Duration) {
+	for len(c.send) > 0 && !c.evicted.Load() {
+		if !c.write(<-c.send, timeout) {
+			return
+		}
+	}
+	if c.evicted.Load() {
+		req = slowConsumerClose
+	}
+	c.closeNow(req.code, req.reason)
+}
+
+// write sends one frame; on failure the connection is closed so the read loop ends too
+func (c *wsClient) write(f wsFrame, timeout time.Duration) bool {
+	if timeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	if err := c.conn.WriteMessage(websocket.TextMessage, f.b); err != nil {
+		utils.LogDebug("websocket write failed: %v", err)
+		c.Close()
+		return false
+	}
+	if f.written != nil {
+		f.written()
+	}
+	return true
+}
+
+// ping sends a ping frame; the pong moves the read deadline on
+func (c *wsClient) ping(timeout time.Duration) bool {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(timeout)); err != nil {
+		utils.LogDebug("websocket ping failed: %v", err)
+		c.Close()
+		return false
+	}
+	return true
+}
@@ -0,0 +1,250 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// collector is anything that can write itself in the Prometheus text exposition format
+type collector interface {
+	name() string
+	write(sb *strings.Builder)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]collector)
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[c.name()]; exists {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	registry[c.name()] = c
+}
+
+func writeHeader(sb *strings.Builder, name, help, typ string) {
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	parts := make([]string, len(names))
+	for i, n := range names {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		parts[i] = fmt.Sprintf(`%s="%s"`, n, v)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	metricName string
+	help       string
+	value      atomic.Int64
+}
+
+// NewCounter creates and registers a counter
+func NewCounter(name, help string) *Counter {
+	c := &Counter{metricName: name, help: help}
+	register(c)
+	return c
+}
+
+func (c *Counter) Inc()         { c.value.Add(1) }
+func (c *Counter) Add(n int64)  { c.value.Add(n) }
+func (c *Counter) Value() int64 { return c.value.Load() }
+func (c *Counter) name() string { return c.metricName }
+func (c *Counter) write(sb *strings.Builder) {
+	writeHeader(sb, c.metricName, c.help, "counter")
+	fmt.Fprintf(sb, "%s %d\n", c.metricName, c.value.Load())
+}
+
+// CounterVec is a set of counters partitioned by label values
+type CounterVec struct {
+	metricName string
+	help       string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]*atomic.Int64
+	labelVals  map[string][]string
+}
+
+// NewCounterVec creates and registers a labeled counter
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		values:     make(map[string]*atomic.Int64),
+		labelVals:  make(map[string][]string),
+	}
+	register(c)
+	return c
+}
+
+// Inc increments the counter for the given label values (in label order)
+func (c *CounterVec) Inc(values ...string) { c.Add(1, values...) }
+
+// Add adds n to the counter for the given label values (in label order)
+func (c *CounterVec) Add(n int64, values ...string) {
+	key := strings.Join(values, "\xff")
+	c.mu.Lock()
+	v, ok := c.values[key]
+	if !ok {
+		v = &atomic.Int64{}
+		c.values[key] = v
+		c.labelVals[key] = append([]string(nil), values...)
+	}
+	c.mu.Unlock()
+	v.Add(n)
+}
+
+func (c *CounterVec) name() string { return c.metricName }
+func (c *CounterVec) write(sb *strings.Builder) {
+	writeHeader(sb, c.metricName, c.help, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(sb, "%s%s %d\n", c.metricName, formatLabels(c.labels, c.labelVals[k]), c.values[k].Load())
+	}
+}
+
+// LatencyBuckets are histogram bounds in seconds for request-scale latencies
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// HistogramVec counts observations into cumulative buckets, partitioned by label values
+type HistogramVec struct {
+	metricName string
+	help       string
+	labels     []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelVals []string
+	counts    []uint64 // Per bucket, not cumulative
+	sum       float64
+	count     uint64
+}
+
+// NewHistogramVec creates and registers a labeled histogram with the given ascending bucket bounds
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		buckets:    append([]float64(nil), buckets...),
+		series:     make(map[string]*histogramSeries),
+	}
+	register(h)
+	return h
+}
+
+// Observe records v for the given label values (in label order)
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := strings.Join(values, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labelVals: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *HistogramVec) name() string { return h.metricName }
+func (h *HistogramVec) write(sb *strings.Builder) {
+	writeHeader(sb, h.metricName, h.help, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, k := range keys {
+		s := h.series[k]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(sb, "%s_bucket%s %d\n", h.metricName, formatLabels(bucketLabels, append(append([]string(nil), s.labelVals...), le)), cumulative)
+		}
+		fmt.Fprintf(sb, "%s_bucket%s %d\n", h.metricName, formatLabels(bucketLabels, append(append([]string(nil), s.labelVals...), "+Inf")), s.count)
+		fmt.Fprintf(sb, "%s_sum%s %g\n", h.metricName, formatLabels(h.labels, s.labelVals), s.sum)
+		fmt.Fprintf(sb, "%s_count%s %d\n", h.metricName, formatLabels(h.labels, s.labelVals), s.count)
+	}
+}
+
+// GaugeFunc reports a value computed at scrape time
+type GaugeFunc struct {
+	metricName string
+	help       string
+	fn         func() float64
+}
+
+// NewGaugeFunc creates and registers a gauge whose value is read from fn on every scrape
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{metricName: name, help: help, fn: fn}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string { return g.metricName }
+func (g *GaugeFunc) write(sb *strings.Builder) {
+	writeHeader(sb, g.metricName, g.help, "gauge")
+	fmt.Fprintf(sb, "%s %g\n", g.metricName, g.fn())
+}
+
+// Render returns all registered metrics in the Prometheus text format
+func Render() string {
+	registryMu.RLock()
+	names := make([]string, 0, len(registry))
+	for n := range registry {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	cs := make([]collector, 0, len(names))
+	for _, n := range names {
+		cs = append(cs, registry[n])
+	}
+	registryMu.RUnlock()
+
+	var sb strings.Builder
+	for _, c := range cs {
+		c.write(&sb)
+	}
+	return sb.String()
+}
+
+// Handler serves the registered metrics for Prometheus scraping
+func Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+		return c.SendString(Render())
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// AccountArchiveVersion is the format version written by account exports
+const AccountArchiveVersion = 1
+
+// AccountArchive is a user's personal data export; it can be imported into another account
+type AccountArchive struct {
+	Version     int               `json:"version"`
+	ExportedAt  time.Time         `json:"exported_at"`
+	Profile     ArchiveProfile    `json:"profile"`
+	Preferences NotificationPrefs `json:"preferences"`
+	Messages    []ArchiveMessage  `json:"messages"` // Messages the user sent, oldest first
+}
+
+// ArchiveProfile holds the exported profile fields
+type ArchiveProfile struct {
+	Username  string    `json:"username"`
+	FirstName *string   `json:"first_name,omitempty"`
+	LastName  *string   `json:"last_name,omitempty"`
+	Email     *string   `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ArchiveMessage is one exported message
+type ArchiveMessage struct {
+	Room      string    `json:"room"`
+	Text      *string   `json:"text,omitempty"`
+	Voice     *string   `json:"voice,omitempty"` // Filename only; voice files are not part of the archive
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AccountImportConflict describes an archive value that was not restored
+type AccountImportConflict struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// AccountImportReport summarizes an account import
+type AccountImportReport struct {
+	ImportID          string                  `json:"import_id"`
+	Restored          []string                `json:"restored"` // Profile and preference fields written
+	Conflicts         []AccountImportConflict `json:"conflicts"`
+	SavedRoomID       string                  `json:"saved_room_id,omitempty"`
+	Messages          int                     `json:"messages"`           // Restored into the saved messages room
+	DuplicateMessages int                     `json:"duplicate_messages"` // Already present from an earlier import
+	SkippedMessages   int                     `json:"skipped_messages"`   // Voice-only messages without text
+}
@@ -0,0 +1,159 @@
+package models
+
+import "time"
+
+// LegalHoldRequest toggles a legal hold on a room or user
+type LegalHoldRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// LegalHoldAuditEntry records a hold being applied or released
+type LegalHoldAuditEntry struct {
+	ID          int       `json:"id"`
+	TargetType  string    `json:"target_type"` // "room" or "user"
+	TargetID    string    `json:"target_id"`
+	Action      string    `json:"action"` // "applied" or "released"
+	AdminUserID *int      `json:"admin_user_id,omitempty"`
+	Reason      *string   `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RetentionRequest sets a room's retention override; nil restores the default
+type RetentionRequest struct {
+	RetentionDays *int `json:"retention_days"`
+}
+
+// UserMergeRequest folds SourceUserID into TargetUserID; with DryRun nothing is changed
+type UserMergeRequest struct {
+	SourceUserID int  `json:"source_user_id"`
+	TargetUserID int  `json:"target_user_id"`
+	DryRun       bool `json:"dry_run"`
+}
+
+// UserMergeReport lists how many rows a merge moved (or would move, for a dry run)
+type UserMergeReport struct {
+	SourceUserID        int   `json:"source_user_id"`
+	TargetUserID        int   `json:"target_user_id"`
+	DryRun              bool  `json:"dry_run"`
+	Messages            int64 `json:"messages"`
+	RoomMemberships     int64 `json:"room_memberships"`
+	DuplicateMembership int64 `json:"duplicate_memberships"` // Rooms both accounts were in; the source row is dropped
+	Photos              int64 `json:"photos"`
+	Devices             int64 `json:"devices"`
+	Reactions           int64 `json:"reactions"`
+	StagedMedia         int64 `json:"staged_media"`
+}
+
+// ContentScanFilter selects recent messages for moderation; every set criterion must match
+type ContentScanFilter struct {
+	Keyword string        // Case-insensitive substring of the text or caption
+	SHA256  string        // Content hash of the voice recording or attachment
+	UserID  int           // Sender or uploader
+	Since   time.Duration // How far back to look
+	Limit   int
+}
+
+// ContentScanMatch is a message found by a content scan
+type ContentScanMatch struct {
+	MessageID int          `json:"message_id"`
+	Room      string       `json:"room"`
+	UserID    int          `json:"user_id"`
+	Username  string       `json:"username"`
+	Text      *string      `json:"text,omitempty"`
+	Voice     *string      `json:"voice,omitempty"`
+	File      *MessageFile `json:"file,omitempty"`
+	SHA256    *string      `json:"sha256,omitempty"` // Unknown for media published before hashes were recorded
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// HardDeleteRequest gives the reason for physically removing a message or room
+type HardDeleteRequest struct {
+	Reason string `json:"reason"`
+}
+
+// TakedownRequest deletes messages in bulk, e.g. the results of a content scan
+type TakedownRequest struct {
+	MessageIDs []int  `json:"message_ids"`
+	Reason     string `json:"reason"`
+}
+
+// TakedownResult reports one message of a takedown; Error is set when it was not deleted
+type TakedownResult struct {
+	MessageID int    `json:"message_id"`
+	Room      string `json:"room,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Application roles (users.role), distinct from the participant roles of group rooms
+const (
+	AppRoleUser  = "user"
+	AppRoleAdmin = "admin"
+)
+
+// AdminUser is a user as the admin API lists them
+type AdminUser struct {
+	ID         int        `json:"id"`
+	Username   string     `json:"username"`
+	Email      *string    `json:"email,omitempty"`
+	Role       string     `json:"role"`
+	IsBot      bool       `json:"is_bot"`
+	LegalHold  bool       `json:"legal_hold"`
+	BannedAt   *time.Time `json:"banned_at,omitempty"`
+	BanReason  *string    `json:"ban_reason,omitempty"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Online     bool       `json:"online"`
+}
+
+// AdminUserFilter narrows GET /api/admin/users; Query matches username or email
+type AdminUserFilter struct {
+	Query  string
+	Role   string
+	Banned *bool
+	Limit  int
+	Offset int
+}
+
+// SetUserRoleRequest changes a user's application role
+type SetUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// BanUserRequest gives the reason for banning a user
+type BanUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+// PurgeMessagesRequest deletes a room's messages; Before and UserID narrow what is purged
+type PurgeMessagesRequest struct {
+	Before *time.Time `json:"before,omitempty"`
+	UserID *int       `json:"user_id,omitempty"`
+	Reason string     `json:"reason"`
+}
+
+// RoomDeletion reports what deleting a room removed
+type RoomDeletion struct {
+	RoomID       string `json:"room_id"`
+	Participants []int  `json:"-"` // Notified that the room is gone
+	Messages     int    `json:"messages"`
+	Files        int    `json:"files"`
+}
+
+// RoomStats is the admin view of a room
+type RoomStats struct {
+	RoomID          string     `json:"room_id"`
+	Name            *string    `json:"name,omitempty"`
+	Type            string     `json:"type"`
+	LegalHold       bool       `json:"legal_hold"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Participants    int        `json:"participants"`
+	Messages        int        `json:"messages"`
+	DeletedMessages int        `json:"deleted_messages"`
+	Files           int        `json:"files"`
+	FileBytes       int64      `json:"file_bytes"`
+	FirstMessageAt  *time.Time `json:"first_message_at,omitempty"`
+	LastMessageAt   *time.Time `json:"last_message_at,omitempty"`
+	OnlineUsers     int        `json:"online_users"` // Participants connected anywhere
+	Viewers         int        `json:"viewers"`      // Participants with the room open
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Scopes an admin API token can carry
+const (
+	ScopeReadStats          = "read:stats"
+	ScopeWriteAnnouncements = "write:announcements"
+	ScopeModerateMessages   = "moderate:messages"
+)
+
+// AdminTokenScopes lists every valid scope
+var AdminTokenScopes = []string{ScopeReadStats, ScopeWriteAnnouncements, ScopeModerateMessages}
+
+// AdminToken is a scoped, expiring credential for admin automation scripts.
+// Token holds the secret and is only set in the create response.
+type AdminToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  int        `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Token      string     `json:"token,omitempty"`
+}
+
+// CreateAdminTokenRequest issues a token; TTL is in seconds, 0 for the maximum lifetime
+type CreateAdminTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	TTL    int      `json:"ttl,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// RoomAnnouncement is a message surfaced as a banner in the room list and the join payload
+// until the viewer dismisses it. It disappears when its message is deleted.
+type RoomAnnouncement struct {
+	MessageID int       `json:"message_id"`
+	Text      *string   `json:"text,omitempty"`
+	HasVoice  bool      `json:"has_voice,omitempty"`
+	Username  string    `json:"username"` // Sender of the announced message
+	SetBy     *int      `json:"set_by,omitempty"`
+	SetAt     time.Time `json:"set_at"`
+}
+
+// SetAnnouncementRequest announces a message of the room, replacing any current announcement
+type SetAnnouncementRequest struct {
+	MessageID int `json:"message_id"`
+}
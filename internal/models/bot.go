@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// CreateBotRequest creates an integration bot account
+type CreateBotRequest struct {
+	Username string `json:"username"`
+}
+
+// BotAccount is returned once when a bot is created; APIKey is not stored in plain text
+type BotAccount struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	APIKey    string    `json:"api_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BulkMessage is one message of a bulk send
+type BulkMessage struct {
+	Room   string `json:"room"`
+	Text   string `json:"text"`
+	Silent bool   `json:"silent,omitempty"` // Don't notify participants who aren't viewing the room
+}
+
+// BulkMessageRequest is the body of POST /api/bot/messages/bulk
+type BulkMessageRequest struct {
+	Messages []BulkMessage `json:"messages"`
+}
+
+// BulkMessageResult reports the outcome of one message; Error is set when it was not sent
+type BulkMessageResult struct {
+	Index     int    `json:"index"`
+	Room      string `json:"room"`
+	ID        int    `json:"id,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Call media
+const (
+	CallAudio = "audio"
+	CallVideo = "video"
+)
+
+// Call states
+const (
+	CallRinging = "ringing"
+	CallActive  = "active"
+)
+
+// MaxCallSDP caps the size of an SDP offer or answer, in bytes
+const MaxCallSDP = 64 << 10
+
+// Call is a 1:1 voice or video call in a direct room, tracked while it rings or runs. The
+// server only relays signaling; media flows between the peers.
+type Call struct {
+	ID         string     `json:"call_id"`
+	Room       string     `json:"room"`
+	CallerID   int        `json:"caller_id"`
+	CalleeID   int        `json:"callee_id"`
+	Media      string     `json:"media"` // "audio" or "video"
+	State      string     `json:"state"` // "ringing" or "active"
+	StartedAt  time.Time  `json:"started_at"`
+	AnsweredAt *time.Time `json:"answered_at,omitempty"`
+}
+
+// Peer returns the other party of the call, 0 if userID isn't in it
+func (c *Call) Peer(userID int) int {
+	switch userID {
+	case c.CallerID:
+		return c.CalleeID
+	case c.CalleeID:
+		return c.CallerID
+	}
+	return 0
+}
+
+// CallOfferRequest starts a call in a direct room with an SDP offer for the other participant
+type CallOfferRequest struct {
+	Room  string `json:"room"`
+	Media string `json:"media,omitempty"` // Defaults to audio
+	SDP   string `json:"sdp"`
+}
+
+func (r *CallOfferRequest) TargetRoom() string { return r.Room }
+
+func (r *CallOfferRequest) Validate() error {
+	if r.Room == "" {
+		return errors.New("room is required")
+	}
+	if r.Media == "" {
+		r.Media = CallAudio
+	}
+	if r.Media != CallAudio && r.Media != CallVideo {
+		return errors.New("media must be audio or video")
+	}
+	return validateSDP(r.SDP)
+}
+
+// CallAnswerRequest accepts a ringing call with an SDP answer for the caller
+type CallAnswerRequest struct {
+	CallID string `json:"call_id"`
+	SDP    string `json:"sdp"`
+}
+
+func (r *CallAnswerRequest) Validate() error {
+	if r.CallID == "" {
+		return errors.New("call_id is required")
+	}
+	return validateSDP(r.SDP)
+}
+
+// IceCandidateRequest relays an ICE candidate to the other party of a call. The candidate
+// is passed through as the client's RTCIceCandidateInit.
+type IceCandidateRequest struct {
+	CallID    string          `json:"call_id"`
+	Candidate json.RawMessage `json:"candidate"`
+}
+
+func (r *IceCandidateRequest) Validate() error {
+	if r.CallID == "" {
+		return errors.New("call_id is required")
+	}
+	if len(r.Candidate) == 0 || len(r.Candidate) > 4096 {
+		return errors.New("candidate is required and at most 4096 bytes")
+	}
+	return nil
+}
+
+// CallEndRequest hangs up, declines or cancels a call
+type CallEndRequest struct {
+	CallID string `json:"call_id"`
+	Reason string `json:"reason,omitempty"` // e.g. "hangup", "declined", "busy"; defaults to hangup
+}
+
+func (r *CallEndRequest) Validate() error {
+	if r.CallID == "" {
+		return errors.New("call_id is required")
+	}
+	if r.Reason == "" {
+		r.Reason = "hangup"
+	}
+	if len(r.Reason) > 32 {
+		return errors.New("reason must be at most 32 characters")
+	}
+	return nil
+}
+
+func validateSDP(sdp string) error {
+	if sdp == "" {
+		return errors.New("sdp is required")
+	}
+	if len(sdp) > MaxCallSDP {
+		return errors.New("sdp is too large")
+	}
+	return nil
+}
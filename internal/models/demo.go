@@ -0,0 +1,19 @@
+package models
+
+// DemoSeedOptions sizes the demo dataset created by `server seed-demo`
+type DemoSeedOptions struct {
+	Users           int    `json:"users"`
+	MessagesPerRoom int    `json:"messages_per_room"`
+	Password        string `json:"-"` // Shared by every demo account
+	// Seed makes the dataset reproducible; the same seed picks the same texts and recordings
+	Seed int64 `json:"seed"`
+}
+
+// DemoSeedResult summarises a seed-demo run
+type DemoSeedResult struct {
+	Users    []string `json:"users"`
+	Rooms    []string `json:"rooms"`
+	Messages int      `json:"messages"`
+	Voices   int      `json:"voices"`
+	Photos   int      `json:"photos"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// DeviceInfo is what the server learns about a client at login
+type DeviceInfo struct {
+	DeviceID  string // Client-generated stable id, optional
+	UserAgent string
+	IP        string
+}
+
+// Device is a login device associated with a user's refresh tokens
+type Device struct {
+	ID          string     `json:"id"`
+	UserAgent   *string    `json:"user_agent,omitempty"`
+	IP          *string    `json:"ip,omitempty"`
+	FirstSeenAt time.Time  `json:"first_seen_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	RevokeToken string     `json:"-"`
+}
+
+// Push platforms
+const (
+	PushFCM  = "fcm"  // Firebase Cloud Messaging (Android, web)
+	PushAPNs = "apns" // Apple Push Notification service
+)
+
+// RegisterPushTokenRequest registers a push token of one of the caller's apps
+type RegisterPushTokenRequest struct {
+	Platform string `json:"platform"` // "fcm" or "apns"
+	Token    string `json:"token"`
+}
+
+// UnregisterPushTokenRequest removes a push token, e.g. at logout
+type UnregisterPushTokenRequest struct {
+	Token string `json:"token"`
+}
+
+// PushToken is a registered push token
+type PushToken struct {
+	ID         int       `json:"id"`
+	Platform   string    `json:"platform"`
+	Token      string    `json:"token"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// ErrorEvent is one captured panic or 5xx response
+type ErrorEvent struct {
+	Kind      string    `json:"kind"` // "panic" or "error"
+	Message   string    `json:"message"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route"` // Route pattern, e.g. /api/rooms/:id/pins
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	UserID    int       `json:"user_id,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	Stack     string    `json:"stack,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ErrorGroup aggregates events sharing a fingerprint
+type ErrorGroup struct {
+	Fingerprint string     `json:"fingerprint"`
+	Count       int64      `json:"count"`
+	FirstSeen   time.Time  `json:"first_seen"`
+	LastSeen    time.Time  `json:"last_seen"`
+	Last        ErrorEvent `json:"last"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// Participant roles in group rooms
+const (
+	RoleOwner  = "owner"  // Exactly one per group; manages admins and can transfer ownership
+	RoleAdmin  = "admin"  // Adds and removes members, renames the room
+	RoleMember = "member" // Default
+)
+
+// CreateGroupRequest creates a group room; the creator becomes its owner
+type CreateGroupRequest struct {
+	Name      string `json:"name"`
+	MemberIDs []int  `json:"member_ids"`
+}
+
+// RenameRoomRequest renames a group room
+type RenameRoomRequest struct {
+	Name string `json:"name"`
+}
+
+// AddParticipantRequest adds a user to a group room
+type AddParticipantRequest struct {
+	UserID int `json:"user_id"`
+}
+
+// SetRoleRequest changes a participant's role; setting "owner" transfers ownership
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// RoomParticipant is an active member of a room
+type RoomParticipant struct {
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// GroupRoom is a group room with its members, returned on creation
+type GroupRoom struct {
+	Room
+	Members []RoomParticipant `json:"members"`
+}
+
+// BulkRoom is one room of a bulk creation. Direct rooms take exactly two member_ids (the
+// first opens the room); groups take a name and are owned by owner_id, or the caller.
+type BulkRoom struct {
+	Type      string `json:"type"` // "direct" or "group"
+	Name      string `json:"name,omitempty"`
+	OwnerID   int    `json:"owner_id,omitempty"`
+	MemberIDs []int  `json:"member_ids"`
+}
+
+// BulkRoomsRequest is the body of POST /api/admin/rooms/bulk and /api/bot/rooms/bulk
+type BulkRoomsRequest struct {
+	Rooms []BulkRoom `json:"rooms"`
+}
+
+// BulkRoomResult is the room created for one entry; IsNew is false for a direct room that
+// already existed
+type BulkRoomResult struct {
+	Index  int    `json:"index"`
+	RoomID string `json:"room_id"`
+	Type   string `json:"type"`
+	IsNew  bool   `json:"is_new"`
+}
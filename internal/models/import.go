@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// ImportRecord is a single message from an external chat export
+type ImportRecord struct {
+	Username  string    `json:"username"`
+	Text      string    `json:"text,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	MediaURL  string    `json:"media_url,omitempty"` // Remote file to download into uploads
+}
+
+// ImportOptions controls how an export is mapped onto local data
+type ImportOptions struct {
+	Room string `json:"room"`
+	// UserMap maps usernames in the export to local usernames; unmapped names are used as-is
+	UserMap map[string]string `json:"user_map,omitempty"`
+	// CreateMissingUsers creates placeholder accounts (unusable password) for unknown users
+	CreateMissingUsers bool `json:"create_missing_users"`
+	// DownloadMedia fetches media_url into the uploads directory; otherwise the URL is kept as text
+	DownloadMedia bool `json:"download_media"`
+}
+
+// ImportResult summarises an import run
+type ImportResult struct {
+	Imported     int      `json:"imported"`
+	Skipped      int      `json:"skipped"`
+	CreatedUsers []string `json:"created_users,omitempty"`
+	Errors       []string `json:"errors,omitempty"`
+}
@@ -0,0 +1,30 @@
+package models
+
+// RoomInsights summarizes a room's activity from the rollup tables
+type RoomInsights struct {
+	Room           string           `json:"room"`
+	TopReacted     []ReactedMessage `json:"top_reacted"`
+	MostActiveDays []DayActivity    `json:"most_active_days"`
+	Streak         ActivityStreak   `json:"streak"`      // Days with at least one message in the room
+	YourStreak     ActivityStreak   `json:"your_streak"` // Days the requesting user posted in the room
+}
+
+// ReactedMessage is a message with its total number of reactions
+type ReactedMessage struct {
+	Reactions int     `json:"reactions"`
+	Message   Message `json:"message"`
+}
+
+// DayActivity is the number of messages posted on a UTC day
+type DayActivity struct {
+	Day      string `json:"day"` // YYYY-MM-DD
+	Messages int    `json:"messages"`
+}
+
+// ActivityStreak counts consecutive UTC days with activity. Current is 0 unless the streak
+// includes today or yesterday.
+type ActivityStreak struct {
+	Current    int    `json:"current"`
+	Longest    int    `json:"longest"`
+	LastActive string `json:"last_active,omitempty"` // YYYY-MM-DD
+}
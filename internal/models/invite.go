@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// RoomInvite is a shareable link that lets anyone with an account join a room
+type RoomInvite struct {
+	Code      string     `json:"code"`
+	RoomID    string     `json:"room_id"`
+	CreatedBy *int       `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	URL       string     `json:"url,omitempty"`
+}
+
+// InvitePreview is the public summary of an invite, rendered into OpenGraph tags
+type InvitePreview struct {
+	Code        string  `json:"code"`
+	RoomID      string  `json:"room_id"`
+	RoomName    *string `json:"room_name,omitempty"`
+	MemberCount int     `json:"member_count"`
+	Inviter     string  `json:"inviter,omitempty"`
+	AvatarURL   string  `json:"avatar_url,omitempty"` // The inviter's latest photo
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// StagedMedia is an uploaded file that hasn't been published to its room yet
+type StagedMedia struct {
+	ID        string     `json:"id"`
+	UserID    int        `json:"user_id"`
+	Room      string     `json:"room"`
+	Kind      string     `json:"kind"` // "voice"
+	Filename  string     `json:"filename"`
+	URL       string     `json:"url,omitempty"` // Absolute URL (not stored in DB)
+	VoiceMeta *VoiceMeta `json:"voice_meta,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TrimVoiceRequest selects the part of a staged voice recording to keep
+type TrimVoiceRequest struct {
+	StartMs int64 `json:"start_ms"`
+	EndMs   int64 `json:"end_ms"` // 0 keeps everything after start_ms
+}
+
+// PublishMediaRequest sends a staged upload to its room
+type PublishMediaRequest struct {
+	Text      string `json:"text,omitempty"` // Caption
+	ReplyToID int    `json:"reply_to_id,omitempty"`
+	TTL       int    `json:"ttl,omitempty"` // Seconds until the message expires
+}
@@ -2,50 +2,131 @@ package models
 
 import "time"
 
+// VoiceMeta describes a voice recording so clients can render it without downloading the file
+type VoiceMeta struct {
+	DurationMs int64 `json:"duration_ms"`
+	Waveform   []int `json:"waveform,omitempty"` // Peaks normalized to 0-100
+}
+
+// MessageFile describes an attachment; a copy is stored with its message
+type MessageFile struct {
+	ID          int    `json:"id"`
+	Filename    string `json:"filename"` // Stored name under UPLOAD_DIR/files
+	Name        string `json:"name"`     // Name the file was uploaded with
+	ContentType string `json:"content_type"`
+	Kind        string `json:"kind"` // image, video or document
+	Size        int64  `json:"size"`
+}
+
 type Message struct {
-	ID        int       `json:"id"`
-	Room      string    `json:"room"`
-	UserID    int       `json:"user_id"`
-	Username  string    `json:"username"`
-	Content   *string   `json:"content,omitempty"`
-	Voice     *string   `json:"voice,omitempty"`     // Voice file path (stored filename)
-	VoiceURL  string    `json:"voice_url,omitempty"` // Absolute URL for voice file (not stored in DB)
-	HasSeen   bool      `json:"has_seen"`
-	ReplyTo   *Message  `json:"reply_to,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-// WebSocket Message Structure
+	ID           int          `json:"id"`
+	Room         string       `json:"room"`
+	UserID       int          `json:"user_id"`
+	Username     string       `json:"username"`
+	Content      *string      `json:"content,omitempty"`
+	Voice        *string      `json:"voice,omitempty"`     // Voice file path (stored filename)
+	VoiceURL     string       `json:"voice_url,omitempty"` // Absolute URL for voice file (not stored in DB)
+	VoiceMeta    *VoiceMeta   `json:"voice_meta,omitempty"`
+	VoiceExpired bool         `json:"voice_expired,omitempty"` // Voice file deleted by the cleanup policy; VoiceURL stays empty
+	File         *MessageFile `json:"file,omitempty"`
+	FileURL      string       `json:"file_url,omitempty"` // Absolute URL for the attachment (not stored in DB)
+	Sticker      *Sticker     `json:"sticker,omitempty"`
+	HasSeen      bool         `json:"has_seen"`
+	ReplyTo      *Message     `json:"reply_to,omitempty"`
+	ExpiresAt    *time.Time   `json:"expires_at,omitempty"` // Set by the sender's TTL or the room's message TTL
+	System       bool         `json:"system,omitempty"`     // Posted by the bot account
+	Silent       bool         `json:"silent,omitempty"`     // Never triggers new_message or push notifications
+	EditedAt     *time.Time   `json:"edited_at,omitempty"`
+	DeletedAt    *time.Time   `json:"deleted_at,omitempty"` // Tombstone: content and voice were cleared
+	Version      int          `json:"version"`              // Number of edits; sent back with the next edit
+	ThreadID     *int         `json:"thread_id,omitempty"`  // Root message of the reply chain; nil unless a reply
+	CreatedAt    time.Time    `json:"created_at"`
+}
+
+// WSMessage is the outgoing server event payload (chat broadcasts, history, list, ...).
+// Incoming client events are decoded into the typed requests in ws_events.go.
 type WSMessage struct {
-	Event     string            `json:"event"` // "join", "leave", "chat"
+	Event     string            `json:"event"` // "joined", "join", "leave", "chat", "history", "list"
 	ID        int               `json:"id,omitempty"`
 	Room      string            `json:"room,omitempty"`
 	Text      string            `json:"text,omitempty"`
 	Voice     string            `json:"voice,omitempty"`     // Voice filename from upload
 	VoiceURL  string            `json:"voice_url,omitempty"` // Absolute URL for voice file
-	Token     string            `json:"token,omitempty"`     // For initial auth if needed
+	VoiceMeta *VoiceMeta        `json:"voice_meta,omitempty"`
+	File      *MessageFile      `json:"file,omitempty"`
+	FileURL   string            `json:"file_url,omitempty"` // Absolute URL for the attachment
+	Sticker   *Sticker          `json:"sticker,omitempty"`
 	Timestamp int64             `json:"timestamp,omitempty"`
 	Username  string            `json:"username,omitempty"` // Sent to client
 	HasSeen   bool              `json:"has_seen,omitempty"`
 	ReplyTo   *Message          `json:"reply_to,omitempty"`
-	ReplyToID int               `json:"reply_to_id,omitempty"`
 	Rooms     []RoomListItem    `json:"rooms,omitempty"`
 	History   []ChatHistoryItem `json:"history,omitempty"`
 	OtherUser *UserInfo         `json:"other_user,omitempty"`
+	ExpiresAt int64             `json:"expires_at,omitempty"` // Unix ms when the message expires
+	MemberID  int               `json:"member_id,omitempty"`  // member_added / member_removed subject
+	ActorID   *int              `json:"actor_id,omitempty"`
+	System    bool              `json:"system,omitempty"`
+	Silent    bool              `json:"silent,omitempty"`
+	EditedAt  int64             `json:"edited_at,omitempty"` // Unix ms of the last edit
+	Version   int               `json:"version,omitempty"`   // Message version after an edit
+	Deleted   bool              `json:"deleted,omitempty"`
+	// Announcement is the room's banner, sent with the join history until dismissed
+	Announcement *RoomAnnouncement `json:"announcement,omitempty"`
+	// Lock is the room's active lockdown, sent with the join history
+	Lock *RoomLock `json:"lock,omitempty"`
+	// Translations maps a language to the translated Text when the room auto-translates
+	Translations map[string]string `json:"translations,omitempty"`
+	// Mentions lists the participants @mentioned in Text
+	Mentions []Mention `json:"mentions,omitempty"`
+	// ThreadID is the root message of the reply chain a chat message joined
+	ThreadID *int `json:"thread_id,omitempty"`
+}
+
+// Mention is a participant @mentioned in a message
+type Mention struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
 }
 
 type ChatHistoryItem struct {
-	ID            int      `json:"id"`
-	Event         string   `json:"event,omitempty"`
-	Room          string   `json:"room,omitempty"`
-	Text          *string  `json:"text,omitempty"`
-	Voice         *string  `json:"voice,omitempty"`     // Voice filename
-	VoiceURL      string   `json:"voice_url,omitempty"` // Absolute URL for voice file
-	Username      string   `json:"username"`
-	Timestamp     int64    `json:"timestamp"`
-	IsYourMessage bool     `json:"is_your_message"`
-	HasSeen       bool     `json:"has_seen"`
-	ReplyTo       *Message `json:"reply_to,omitempty"`
+	ID            int          `json:"id"`
+	Event         string       `json:"event,omitempty"`
+	Room          string       `json:"room,omitempty"`
+	Text          *string      `json:"text,omitempty"`
+	Voice         *string      `json:"voice,omitempty"`     // Voice filename
+	VoiceURL      string       `json:"voice_url,omitempty"` // Absolute URL for voice file
+	VoiceMeta     *VoiceMeta   `json:"voice_meta,omitempty"`
+	VoiceExpired  bool         `json:"voice_expired,omitempty"` // The voice file was cleaned up; voice_url is omitted
+	File          *MessageFile `json:"file,omitempty"`
+	FileURL       string       `json:"file_url,omitempty"`
+	Sticker       *Sticker     `json:"sticker,omitempty"`
+	Username      string       `json:"username"`
+	Timestamp     int64        `json:"timestamp"`
+	IsYourMessage bool         `json:"is_your_message"`
+	HasSeen       bool         `json:"has_seen"`
+	ReplyTo       *Message     `json:"reply_to,omitempty"`
+	ExpiresAt     int64        `json:"expires_at,omitempty"` // Unix ms, 0 if the message never expires
+	MemberID      int          `json:"member_id,omitempty"`  // Set on member_added / member_removed items
+	ActorID       *int         `json:"actor_id,omitempty"`
+	System        bool         `json:"system,omitempty"`
+	Silent        bool         `json:"silent,omitempty"`
+	EditedAt      int64        `json:"edited_at,omitempty"` // Unix ms of the last edit, 0 if never edited
+	Version       int          `json:"version,omitempty"`   // Number of edits; the base for the next edit
+	Deleted       bool         `json:"deleted,omitempty"`   // Tombstone of a deleted message; text, voice and file are empty
+	ThreadID      *int         `json:"thread_id,omitempty"` // Root message of the reply chain
+	// Current state kept outside the message row, so a client catching up needs no replay of
+	// the reaction and messages_seen events it missed
+	Reactions   map[string]int `json:"reactions,omitempty"`    // Count per emoji
+	MyReactions []string       `json:"my_reactions,omitempty"` // Emojis the viewer reacted with
+	SeenCount   int            `json:"seen_count,omitempty"`   // Recipients who have seen the viewer's message
+}
+
+// MessageState is the state of a message kept outside its row
+type MessageState struct {
+	Reactions   map[string]int
+	MyReactions []string
+	SeenCount   int // Only for the viewer's own messages
 }
 
 // UserInfo holds basic user profile info to send with history/room events
@@ -56,3 +137,26 @@ type UserInfo struct {
 	LastName  *string `json:"last_name"`
 	Photos    []Photo `json:"photos,omitempty"`
 }
+
+// MessageSearchFilter holds the optional filters for an in-room message search
+type MessageSearchFilter struct {
+	Room       string
+	Query      string
+	FromUserID int
+	FromUser   string // username, used when the client only knows the sender's name
+	Has        string // "voice", "image" or "link"
+	Before     *time.Time
+	After      *time.Time
+	Limit      int
+}
+
+// MessageReceipt is one recipient's delivery and seen state of a message
+type MessageReceipt struct {
+	MessageID   int        `json:"message_id"`
+	UserID      int        `json:"user_id"`
+	Username    string     `json:"username,omitempty"`
+	Room        string     `json:"room,omitempty"`
+	SenderID    int        `json:"-"`
+	DeliveredAt time.Time  `json:"delivered_at"`
+	SeenAt      *time.Time `json:"seen_at,omitempty"`
+}
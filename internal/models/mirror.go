@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// RoomMirror is a public room published as a static HTML archive
+type RoomMirror struct {
+	RoomID        string     `json:"room_id"`
+	Name          *string    `json:"name,omitempty"`
+	LastMessageID int        `json:"last_message_id"` // Newest message already exported
+	MessageCount  int        `json:"message_count"`
+	EnabledBy     *int       `json:"enabled_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExportedAt    *time.Time `json:"exported_at,omitempty"`
+}
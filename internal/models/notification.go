@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// NotificationActionRequest is sent by a notification action button.
+// Token is the action_token from the notification payload.
+type NotificationActionRequest struct {
+	Token  string `json:"token"`
+	Action string `json:"action"` // "read" or "react"
+	Emoji  string `json:"emoji,omitempty"`
+}
+
+// Reaction is an emoji reaction on a message
+type Reaction struct {
+	MessageID int       `json:"message_id"`
+	Room      string    `json:"room"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// PinnedMessage is a message pinned in a room, in display order
+type PinnedMessage struct {
+	Position int       `json:"position"`
+	PinnedBy *int      `json:"pinned_by,omitempty"`
+	PinnedAt time.Time `json:"pinned_at"`
+	Message  Message   `json:"message"`
+}
+
+// PinRequest pins a message
+type PinRequest struct {
+	MessageID int `json:"message_id"`
+}
+
+// PinOrderRequest sets the order of a room's pins; it must list every pinned message exactly once
+type PinOrderRequest struct {
+	MessageIDs []int `json:"message_ids"`
+}
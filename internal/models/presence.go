@@ -0,0 +1,13 @@
+package models
+
+// PresenceRequest asks for the presence of several users at once
+type PresenceRequest struct {
+	UserIDs []int `json:"user_ids"`
+}
+
+// UserPresence is one user's status in POST /api/presence and GET /api/users/:id/presence
+type UserPresence struct {
+	UserID   int    `json:"user_id"`
+	Status   string `json:"status"`              // online, away or offline
+	LastSeen int64  `json:"last_seen,omitempty"` // Unix ms of the last connection; omitted when online or never connected
+}
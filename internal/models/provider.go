@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ProviderHealth reports the circuit breaker state of an external provider
+type ProviderHealth struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"` // "closed", "open" or "half_open"
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"` // When an open circuit lets a trial call through
+}
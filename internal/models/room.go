@@ -4,7 +4,8 @@ import "time"
 
 type Room struct {
 	ID        string    `json:"id"`
-	Type      string    `json:"type"`
+	Type      string    `json:"type"` // "direct", "channel", "support" or "saved" (personal, one member)
+	Name      *string   `json:"name,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -18,12 +19,114 @@ type RoomResponse struct {
 }
 
 type RoomListItem struct {
-	RoomID            string    `json:"room_id"`
-	OtherUserID       int       `json:"other_user_id"`
-	OtherUser         *UserInfo `json:"other_user,omitempty"`
-	LastMessage       *string   `json:"last_message,omitempty"`
-	LastVoice         *string   `json:"last_voice,omitempty"`     // Voice filename of last message
-	LastVoiceURL      string    `json:"last_voice_url,omitempty"` // Absolute URL for voice file
-	LastMessageUnixMs int64     `json:"last_message_unix_ms,omitempty"`
-	OtherUserStatus   string    `json:"other_user_status"` // "online" or "offline"
+	RoomID            string     `json:"room_id"`
+	Type              string     `json:"type,omitempty"` // "direct", "channel", "support" or "saved"
+	Name              *string    `json:"name,omitempty"` // Set for named (non-direct) rooms
+	OtherUserID       int        `json:"other_user_id"`
+	OtherUser         *UserInfo  `json:"other_user,omitempty"`
+	LastMessage       *string    `json:"last_message,omitempty"`       // Text, or the caption of a voice message
+	LastMessageType   string     `json:"last_message_type,omitempty"`  // "text", "voice" or "sticker"
+	LastVoice         *string    `json:"last_voice,omitempty"`         // Voice filename of last message
+	LastVoiceURL      string     `json:"last_voice_url,omitempty"`     // Absolute URL for voice file
+	LastVoiceMeta     *VoiceMeta `json:"last_voice_meta,omitempty"`    // Duration and the first waveform peaks, for a mini preview
+	LastVoiceExpired  bool       `json:"last_voice_expired,omitempty"` // The voice file was cleaned up; last_voice_url is omitted
+	LastMessageUnixMs int64      `json:"last_message_unix_ms,omitempty"`
+	OtherUserStatus   string     `json:"other_user_status,omitempty"` // "online", "away" or "offline"; empty for channels
+	// Announcement is the room's banner message, omitted once the viewer dismissed it
+	Announcement *RoomAnnouncement `json:"announcement,omitempty"`
+}
+
+// MembershipEvent records a participant being added to or removed from a room
+type MembershipEvent struct {
+	ID        int       `json:"id"`
+	Room      string    `json:"room"`
+	Event     string    `json:"event"` // "member_added" or "member_removed"
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	ActorID   *int      `json:"actor_id,omitempty"` // Who invited/removed the member, nil for self or system
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RoomTranslationSettings controls auto-translation of a room's messages
+type RoomTranslationSettings struct {
+	Language      *string `json:"language"` // Source language of the room, nil to detect per message
+	AutoTranslate bool    `json:"auto_translate"`
+}
+
+// Room post modes
+const (
+	PostModeAny   = "any"   // Every kind of message
+	PostModeVoice = "voice" // Voice messages only
+	PostModeText  = "text"  // Text messages only
+)
+
+// Kinds of message checked against a room's post mode
+const (
+	PostKindText  = "text"
+	PostKindVoice = "voice"
+	PostKindFile  = "file"
+)
+
+// RoomPostMode is a room's post mode
+type RoomPostMode struct {
+	Room string `json:"room"`
+	Mode string `json:"mode"`
+}
+
+// UpdatePostModeRequest sets a room's post mode
+type UpdatePostModeRequest struct {
+	Mode string `json:"mode"`
+}
+
+// RoomMessageTTL is how long messages posted to a room last
+type RoomMessageTTL struct {
+	Room string `json:"room"`
+	TTL  int    `json:"ttl"` // Seconds; 0 keeps messages
+}
+
+// UpdateMessageTTLRequest turns disappearing messages on (ttl in seconds) or off (0)
+type UpdateMessageTTLRequest struct {
+	TTL int `json:"ttl"`
+}
+
+// RoomWelcome is the message posted for every new member of a room; {username} and {room}
+// in Message are substituted. A nil Message posts nothing.
+type RoomWelcome struct {
+	Room     string  `json:"room"`
+	RoomName string  `json:"-"` // Substituted for {room}
+	Message  *string `json:"message"`
+}
+
+// UpdateRoomWelcomeRequest sets the welcome message; null or "" turns it off
+type UpdateRoomWelcomeRequest struct {
+	Message *string `json:"message"`
+}
+
+// RoomSettings are a participant's own settings for a room
+type RoomSettings struct {
+	Room       string `json:"room"`
+	Muted      bool   `json:"muted"`
+	MutedUntil int64  `json:"muted_until,omitempty"` // Unix ms; absent when muted until unmuted
+}
+
+// UpdateRoomSettingsRequest mutes or unmutes a room for the caller. muted_until (Unix ms)
+// mutes until then; muted true without it mutes until unmuted, muted false unmutes.
+type UpdateRoomSettingsRequest struct {
+	Muted      *bool  `json:"muted"`
+	MutedUntil *int64 `json:"muted_until"`
+}
+
+// RoomLock describes a room in lockdown: only owners and admins may post until it is unlocked
+type RoomLock struct {
+	Room        string     `json:"room"`
+	LockedBy    *int       `json:"locked_by,omitempty"`
+	LockedAt    time.Time  `json:"locked_at"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"` // Automatic unlock; nil until unlocked by hand
+	Reason      *string    `json:"reason,omitempty"`
+}
+
+// LockRoomRequest locks a room; Duration is in seconds, 0 to stay locked until unlocked
+type LockRoomRequest struct {
+	Duration int    `json:"duration,omitempty"`
+	Reason   string `json:"reason,omitempty"`
 }
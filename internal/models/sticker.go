@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Sticker pack kinds
+const (
+	StickerKindSticker = "sticker"
+	StickerKindGIF     = "gif"
+)
+
+// MaxStickersPerPack caps the stickers accepted in one pack
+const MaxStickersPerPack = 200
+
+// Sticker is one image of a pack; a copy is stored with every message that sends it
+type Sticker struct {
+	ID     int    `json:"id"`
+	PackID int    `json:"pack_id"`
+	Kind   string `json:"kind"` // "sticker" or "gif", from the pack
+	URL    string `json:"url"`
+	Emoji  string `json:"emoji,omitempty"` // What it expresses; used as notification text
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// StickerPack groups stickers offered together
+type StickerPack struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Stickers  []Sticker `json:"stickers"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateStickerPackRequest is the body of POST /api/admin/sticker-packs
+type CreateStickerPackRequest struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind,omitempty"` // Defaults to sticker
+	Stickers []struct {
+		URL    string `json:"url"`
+		Emoji  string `json:"emoji,omitempty"`
+		Width  int    `json:"width,omitempty"`
+		Height int    `json:"height,omitempty"`
+	} `json:"stickers"`
+}
+
+func (r *CreateStickerPackRequest) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > 100 {
+		return errors.New("name is required and at most 100 characters")
+	}
+	if r.Kind == "" {
+		r.Kind = StickerKindSticker
+	}
+	if r.Kind != StickerKindSticker && r.Kind != StickerKindGIF {
+		return errors.New("kind must be sticker or gif")
+	}
+	if len(r.Stickers) == 0 || len(r.Stickers) > MaxStickersPerPack {
+		return errors.New("a pack needs between 1 and 200 stickers")
+	}
+	for _, s := range r.Stickers {
+		// Hosted elsewhere over HTTPS, or under this server's /uploads
+		if !strings.HasPrefix(s.URL, "https://") && !strings.HasPrefix(s.URL, "/uploads/") {
+			return errors.New("sticker urls must be https:// or /uploads/ paths")
+		}
+		if len(s.Emoji) > 32 || s.Width < 0 || s.Height < 0 {
+			return errors.New("invalid sticker")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// SupportTicket is the support state of a room of type "support"
+type SupportTicket struct {
+	RoomID            string    `json:"room_id"`
+	UserID            int       `json:"user_id"` // The user who opened the conversation
+	Username          string    `json:"username"`
+	Status            string    `json:"status"` // "open", "claimed" or "resolved"
+	ClaimedBy         *int      `json:"claimed_by,omitempty"`
+	ClaimedByUsername *string   `json:"claimed_by_username,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+// UsageCounts are a user's activity counters for a period
+type UsageCounts struct {
+	Messages    int64 `json:"messages"`
+	Uploads     int64 `json:"uploads"`
+	UploadBytes int64 `json:"upload_bytes"`
+	WSEvents    int64 `json:"ws_events"`
+	APIRequests int64 `json:"api_requests"`
+}
+
+// DayUsage is a user's activity on a UTC day
+type DayUsage struct {
+	Day string `json:"day"` // YYYY-MM-DD
+	UsageCounts
+}
+
+// UserUsage is the response of GET /api/profile/usage. Daily only lists days with activity.
+type UserUsage struct {
+	From         string      `json:"from"` // YYYY-MM-DD, inclusive
+	To           string      `json:"to"`
+	Totals       UsageCounts `json:"totals"`
+	Daily        []DayUsage  `json:"daily"`
+	StorageBytes int64       `json:"storage_bytes"` // Voice recordings, staged uploads, attachments and photos currently stored
+}
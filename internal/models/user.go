@@ -3,23 +3,27 @@ package models
 import "time"
 
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"`
-	FirstName    *string   `json:"first_name"`
-	LastName     *string   `json:"last_name"`
-	Photos       []Photo   `json:"photos,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           int                `json:"id"`
+	Username     string             `json:"username"`
+	PasswordHash string             `json:"-"`
+	FirstName    *string            `json:"first_name"`
+	LastName     *string            `json:"last_name"`
+	Email        *string            `json:"email,omitempty"`
+	Preferences  *NotificationPrefs `json:"preferences,omitempty"`
+	Photos       []Photo            `json:"photos,omitempty"`
+	CreatedAt    time.Time          `json:"created_at"`
 }
 
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	DeviceID string `json:"device_id,omitempty"` // Stable client-generated id used for device fingerprinting
 }
 
 type RegisterRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Email    string `json:"email,omitempty"` // Optional, used for account notifications
 }
 
 type AuthResponse struct {
@@ -27,4 +31,152 @@ type AuthResponse struct {
 	RefreshToken string `json:"refresh_token,omitempty"`
 	Username     string `json:"username"`
 	UserID       int    `json:"user_id"`
+	DeviceID     string `json:"device_id,omitempty"`
+	// NewDevice is set when the login came from a device the user hasn't used before
+	NewDevice *Device `json:"-"`
+}
+
+// NotificationPrefs controls how notifications are rendered for a recipient
+type NotificationPrefs struct {
+	Language       string `json:"language"`
+	MessagePreview bool   `json:"message_preview"`
+	// Matrix holds the recipient's per event type and channel switches (see
+	// GET /api/profile/notifications)
+	Matrix NotificationMatrix `json:"-"`
+}
+
+// Notification event types and channels of the preferences matrix
+const (
+	NotifyMessage  = "message"
+	NotifyMention  = "mention"
+	NotifyReaction = "reaction"
+	NotifyCall     = "call"
+
+	ChannelWS    = "ws" // In-app banner sent over the websocket
+	ChannelPush  = "push"
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+var (
+	NotificationEvents   = []string{NotifyMessage, NotifyMention, NotifyReaction, NotifyCall}
+	NotificationChannels = []string{ChannelWS, ChannelPush, ChannelEmail, ChannelSMS}
+)
+
+// NotificationMatrix maps event type -> channel -> enabled. Missing cells take their
+// default: banners and pushes are on, email and SMS are off.
+type NotificationMatrix map[string]map[string]bool
+
+// notificationEventTypes maps notifier kinds onto the event types of the matrix
+var notificationEventTypes = map[string]string{
+	"message":  NotifyMessage,
+	"voice":    NotifyMessage,
+	"file":     NotifyMessage,
+	"sticker":  NotifyMessage,
+	"system":   NotifyMessage,
+	"mention":  NotifyMention,
+	"reaction": NotifyReaction,
+	"call":     NotifyCall,
+}
+
+// Allows reports whether a notification of kind ("message", "voice", "mention", ...) may be
+// sent on channel. Kinds outside the matrix are always allowed.
+func (m NotificationMatrix) Allows(kind, channel string) bool {
+	event, ok := notificationEventTypes[kind]
+	if !ok {
+		return true
+	}
+	if enabled, ok := m[event][channel]; ok {
+		return enabled
+	}
+	return channel == ChannelWS || channel == ChannelPush
+}
+
+// UpdateNotificationSettingsRequest switches cells of the notification matrix
+type UpdateNotificationSettingsRequest struct {
+	Notifications NotificationMatrix `json:"notifications"`
+}
+
+// Resolved returns the full matrix with defaults filled in
+func (m NotificationMatrix) Resolved() NotificationMatrix {
+	full := make(NotificationMatrix, len(NotificationEvents))
+	for _, event := range NotificationEvents {
+		full[event] = make(map[string]bool, len(NotificationChannels))
+		for _, channel := range NotificationChannels {
+			full[event][channel] = m.Allows(event, channel)
+		}
+	}
+	return full
+}
+
+// UpdatePreferencesRequest changes notification preferences; omitted fields are left unchanged
+type UpdatePreferencesRequest struct {
+	Language       *string `json:"language"`
+	MessagePreview *bool   `json:"message_preview"`
+}
+
+// ChangePasswordRequest changes the password of the signed-in user. The device of
+// RefreshToken stays signed in; every other device is signed out.
+type ChangePasswordRequest struct {
+	OldPassword  string `json:"old_password"`
+	NewPassword  string `json:"new_password"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// DeleteAccountRequest confirms erasing the signed-in user's account
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// ForgotPasswordRequest asks for a reset link, sent to the account's email address
+type ForgotPasswordRequest struct {
+	Email    string `json:"email,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// ResetPasswordRequest sets a new password with the token from a reset link
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// PasswordReset is an issued reset token and where to send it
+type PasswordReset struct {
+	UserID    int
+	Username  string
+	Email     string
+	Token     string
+	ExpiresAt time.Time
+}
+
+// EmailChangeRequest starts an email change; the current password is required
+type EmailChangeRequest struct {
+	NewEmail string `json:"new_email"`
+	Password string `json:"password"`
+}
+
+// EmailChange tracks an email change through confirmation, application and rollback
+type EmailChange struct {
+	ID             string     `json:"id"`
+	UserID         int        `json:"user_id"`
+	Username       string     `json:"-"`
+	OldEmail       *string    `json:"old_email,omitempty"`
+	NewEmail       string     `json:"new_email"`
+	OldConfirmedAt *time.Time `json:"old_confirmed_at,omitempty"`
+	NewConfirmedAt *time.Time `json:"new_confirmed_at,omitempty"`
+	AppliedAt      *time.Time `json:"applied_at,omitempty"`
+	RolledBackAt   *time.Time `json:"rolled_back_at,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// EmailChangeAuditEntry records one step of an email change
+type EmailChangeAuditEntry struct {
+	ID        int       `json:"id"`
+	ChangeID  *string   `json:"change_id,omitempty"`
+	Action    string    `json:"action"`
+	OldEmail  *string   `json:"old_email,omitempty"`
+	NewEmail  *string   `json:"new_email,omitempty"`
+	IP        *string   `json:"ip,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
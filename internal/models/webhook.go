@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// RoomWebhook is an incoming webhook that posts bot messages into a room
+type RoomWebhook struct {
+	ID         int        `json:"id"`
+	RoomID     string     `json:"room_id"`
+	Name       string     `json:"name"` // Shown as the sender of posted messages
+	Template   *string    `json:"template,omitempty"`
+	CreatedBy  *int       `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	URL        string     `json:"url,omitempty"` // Only returned when the webhook is created
+}
+
+// CreateWebhookRequest creates an incoming webhook. Template is a Go text/template executed
+// against the posted JSON; when empty, "text" is used as is, or "title", "body" and
+// "fields" ([{"name", "value"}]) are formatted.
+type CreateWebhookRequest struct {
+	Name     string  `json:"name"`
+	Template *string `json:"template"`
+}
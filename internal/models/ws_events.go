@@ -0,0 +1,202 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// WSEnvelope is the v2 frame format: {"event": "...", "data": {...}}.
+// Legacy v1 clients send flat frames without "data"; the dispatcher then decodes the
+// whole frame as the event payload, so both shapes map onto the same typed requests.
+type WSEnvelope struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// Validator is implemented by event requests that can check their own fields
+type Validator interface {
+	Validate() error
+}
+
+// RoomTarget is implemented by event requests that may name the room they act on; an empty
+// room means the connection's current room
+type RoomTarget interface {
+	TargetRoom() string
+}
+
+// Moderated is implemented by event requests carrying text written by the user, which is
+// checked by moderation before the event is handled
+type Moderated interface {
+	UserText() string
+}
+
+// JoinRequest asks to enter a room and receive its history
+type JoinRequest struct {
+	Room string `json:"room"`
+}
+
+func (r *JoinRequest) TargetRoom() string { return r.Room }
+
+func (r *JoinRequest) Validate() error {
+	if r.Room == "" {
+		return errors.New("room is required")
+	}
+	return nil
+}
+
+// LeaveRequest leaves the current room
+type LeaveRequest struct{}
+
+// ChatRequest sends a text, voice or sticker message to the current room
+type ChatRequest struct {
+	Text      string   `json:"text,omitempty"`
+	Voice     string   `json:"voice,omitempty"` // Voice filename from upload
+	ReplyTo   *Message `json:"reply_to,omitempty"`
+	ReplyToID int      `json:"reply_to_id,omitempty"`
+	TTL       int      `json:"ttl,omitempty"`      // Seconds until the message expires
+	MediaID   string   `json:"media_id,omitempty"` // Staged upload to publish; Text becomes its caption
+	Silent    bool     `json:"silent,omitempty"`   // Non-urgent: stored and broadcast, but no new_message or push
+	StickerID int      `json:"sticker_id,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"` // Echoed in message_queued, message_replayed and message_rejected
+}
+
+func (r *ChatRequest) UserText() string { return r.Text }
+
+func (r *ChatRequest) Validate() error {
+	if r.Text == "" && r.Voice == "" && r.MediaID == "" && r.StickerID == 0 {
+		return errors.New("message must have text, voice, media_id or sticker_id")
+	}
+	if r.StickerID < 0 {
+		return errors.New("invalid sticker_id")
+	}
+	if r.StickerID != 0 && (r.Text != "" || r.Voice != "" || r.MediaID != "") {
+		return errors.New("a sticker is sent on its own")
+	}
+	if r.MediaID != "" && r.Voice != "" {
+		return errors.New("voice and media_id are mutually exclusive")
+	}
+	if r.TTL < 0 {
+		return errors.New("ttl must not be negative")
+	}
+	if len(r.ClientID) > 64 {
+		return errors.New("client_id is at most 64 characters")
+	}
+	return nil
+}
+
+// EditMessageRequest replaces the text of one of the user's messages; also the PATCH body.
+// Version is the message version the edit was made on; when it is stale (another device edited
+// first) the edit is rejected with edit_conflict. Without a version the last writer wins.
+type EditMessageRequest struct {
+	ID      int    `json:"id,omitempty"`
+	Text    string `json:"text"`
+	Version *int   `json:"version,omitempty"`
+}
+
+func (r *EditMessageRequest) UserText() string { return r.Text }
+
+func (r *EditMessageRequest) Validate() error {
+	if r.ID <= 0 {
+		return errors.New("id is required")
+	}
+	if strings.TrimSpace(r.Text) == "" {
+		return errors.New("text is required")
+	}
+	if r.Version != nil && *r.Version < 0 {
+		return errors.New("version must not be negative")
+	}
+	return nil
+}
+
+// DeleteMessageRequest tombstones one of the user's messages
+type DeleteMessageRequest struct {
+	ID int `json:"id"`
+}
+
+func (r *DeleteMessageRequest) Validate() error {
+	if r.ID <= 0 {
+		return errors.New("id is required")
+	}
+	return nil
+}
+
+// RetractMessageRequest unsends one of the user's messages within the undo send window
+type RetractMessageRequest struct {
+	ID int `json:"id"`
+}
+
+func (r *RetractMessageRequest) Validate() error {
+	if r.ID <= 0 {
+		return errors.New("id is required")
+	}
+	return nil
+}
+
+// SeenRequest marks messages up to Timestamp as seen. Room defaults to the current room.
+type SeenRequest struct {
+	Room      string `json:"room,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"` // Unix seconds or milliseconds
+}
+
+func (r *SeenRequest) TargetRoom() string { return r.Room }
+
+// MaxReadAcks caps the pairs accepted in one ack_read event
+const MaxReadAcks = 200
+
+// ReadAck marks messages in Room with an id up to UpToSeq as seen
+type ReadAck struct {
+	Room    string `json:"room"`
+	UpToSeq int    `json:"up_to_seq"` // Message id of the newest message read
+}
+
+// AckReadRequest marks several rooms as read at once, e.g. when the app returns to the foreground
+type AckReadRequest struct {
+	Acks []ReadAck `json:"acks"`
+}
+
+func (r *AckReadRequest) Validate() error {
+	if len(r.Acks) == 0 {
+		return errors.New("acks is required")
+	}
+	if len(r.Acks) > MaxReadAcks {
+		return fmt.Errorf("at most %d acks per event", MaxReadAcks)
+	}
+	for _, a := range r.Acks {
+		if a.Room == "" || a.UpToSeq <= 0 {
+			return errors.New("every ack needs a room and a positive up_to_seq")
+		}
+	}
+	return nil
+}
+
+// ReadAckResult reports one room of an ack_read; Error is set when the room was not updated
+type ReadAckResult struct {
+	Room    string `json:"room"`
+	UpToSeq int    `json:"up_to_seq"`
+	Updated int64  `json:"updated"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SeenAllRequest marks every message in all of the user's rooms as seen
+type SeenAllRequest struct{}
+
+// ThreadRequest asks for a reply thread: its root message and every reply, oldest first.
+// ID may be the root or any message in the thread.
+type ThreadRequest struct {
+	ID int `json:"id"`
+}
+
+func (r *ThreadRequest) Validate() error {
+	if r.ID <= 0 {
+		return errors.New("id is required")
+	}
+	return nil
+}
+
+// ListRequest asks for the user's room list
+type ListRequest struct{}
+
+// ActivityRequest tells the server the user is active (typing, focus, ...) so they don't go away
+type ActivityRequest struct{}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// accountImportBatch is the number of messages restored per transaction
+const accountImportBatch = 500
+
+// savedRoomName names the personal room imported messages are restored into
+const savedRoomName = "Saved messages"
+
+// ExportAccount builds the user's personal data archive: profile, preferences and every
+// message the user sent
+func (s *UserService) ExportAccount(ctx context.Context, userID int) (*models.AccountArchive, error) {
+	user, err := s.GetProfile(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &models.AccountArchive{
+		Version:    models.AccountArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+		Profile: models.ArchiveProfile{
+			Username:  user.Username,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt,
+		},
+		Messages: []models.ArchiveMessage{},
+	}
+	if user.Preferences != nil {
+		archive.Preferences = *user.Preferences
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	rows, err := db.Read(ctx).Query(ctx, `SELECT room, content, voice, created_at FROM messages
+		WHERE user_id = $1 AND NOT system ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m models.ArchiveMessage
+		if err := rows.Scan(&m.Room, &m.Text, &m.Voice, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		archive.Messages = append(archive.Messages, m)
+	}
+	return archive, rows.Err()
+}
+
+// ImportAccount restores an archive into userID's account. Profile fields and preferences are
+// written when the account doesn't have its own value yet, or always with overwrite; the rest are
+// reported as conflicts. The email is never imported since changes must be confirmed. Messages
+// are restored into the user's personal "Saved messages" room, never into the original rooms,
+// and messages already restored by an earlier import are skipped. progress is called after
+// every batch with the messages processed so far.
+func (s *UserService) ImportAccount(ctx context.Context, userID int, archive *models.AccountArchive, overwrite bool, progress func(done, total int)) (*models.AccountImportReport, error) {
+	if archive.Version != models.AccountArchiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", archive.Version)
+	}
+	report := &models.AccountImportReport{Restored: []string{}, Conflicts: []models.AccountImportConflict{}}
+
+	if err := s.importProfile(ctx, userID, archive, overwrite, report); err != nil {
+		return nil, err
+	}
+
+	var texts []string
+	var times []time.Time
+	for _, m := range archive.Messages {
+		if m.Text == nil || *m.Text == "" {
+			report.SkippedMessages++
+			continue
+		}
+		texts = append(texts, *m.Text)
+		times = append(times, m.CreatedAt)
+	}
+	if len(texts) == 0 {
+		return report, nil
+	}
+
+	roomID, err := getOrCreateSavedRoom(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	report.SavedRoomID = roomID
+
+	var username string
+	if err := db.Pool.QueryRow(ctx, `SELECT username FROM users WHERE id = $1`, userID).Scan(&username); err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(texts); start += accountImportBatch {
+		end := min(start+accountImportBatch, len(texts))
+		inserted, err := insertSavedMessages(ctx, roomID, userID, username, texts[start:end], times[start:end])
+		if err != nil {
+			return nil, err
+		}
+		report.Messages += inserted
+		report.DuplicateMessages += end - start - inserted
+		if progress != nil {
+			progress(end, len(texts))
+		}
+	}
+	return report, nil
+}
+
+// importProfile restores names and preferences according to the conflict policy
+func (s *UserService) importProfile(ctx context.Context, userID int, archive *models.AccountArchive, overwrite bool, report *models.AccountImportReport) error {
+	current, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+	conflict := func(field, reason string) {
+		report.Conflicts = append(report.Conflicts, models.AccountImportConflict{Field: field, Reason: reason})
+	}
+	first, last := current.FirstName, current.LastName
+	pick := func(field string, cur **string, value *string) {
+		switch {
+		case value == nil || *value == "":
+		case *cur == nil || **cur == "" || overwrite:
+			*cur = value
+			report.Restored = append(report.Restored, field)
+		case **cur != *value:
+			conflict(field, "account already has a different value")
+		}
+	}
+	pick("first_name", &first, archive.Profile.FirstName)
+	pick("last_name", &last, archive.Profile.LastName)
+
+	// Preferences still at their defaults count as unset
+	var prefs models.UpdatePreferencesRequest
+	cur := models.NotificationPrefs{Language: "en", MessagePreview: true}
+	if current.Preferences != nil {
+		cur = *current.Preferences
+	}
+	if lang := archive.Preferences.Language; lang != "" && lang != cur.Language {
+		if cur.Language == "en" || overwrite {
+			prefs.Language = &lang
+			report.Restored = append(report.Restored, "language")
+		} else {
+			conflict("language", "account already has a different value")
+		}
+	}
+	if preview := archive.Preferences.MessagePreview; preview != cur.MessagePreview {
+		if cur.MessagePreview || overwrite {
+			prefs.MessagePreview = &preview
+			report.Restored = append(report.Restored, "message_preview")
+		} else {
+			conflict("message_preview", "account already has a different value")
+		}
+	}
+	if archive.Profile.Email != nil && *archive.Profile.Email != "" && (current.Email == nil || *current.Email != *archive.Profile.Email) {
+		conflict("email", "email changes must be confirmed; use POST /api/profile/email")
+	}
+
+	qctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err = db.Pool.Exec(qctx, `UPDATE users SET first_name = $1, last_name = $2,
+		language = COALESCE($3, language), message_preview = COALESCE($4, message_preview) WHERE id = $5`,
+		first, last, prefs.Language, prefs.MessagePreview, userID)
+	return err
+}
+
+// getOrCreateSavedRoom returns the user's personal saved messages room, creating it on first use
+func getOrCreateSavedRoom(ctx context.Context, userID int) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize concurrent imports of the same user
+	if _, err := tx.Exec(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return "", err
+	}
+	var roomID string
+	err = tx.QueryRow(ctx, `SELECT r.id FROM rooms r JOIN room_participants p ON p.room_id = r.id
+		WHERE r.type = 'saved' AND p.user_id = $1 LIMIT 1`, userID).Scan(&roomID)
+	if err == nil {
+		_, err = tx.Exec(ctx, `UPDATE room_participants SET left_at = NULL WHERE room_id = $1 AND user_id = $2`, roomID, userID)
+		if err != nil {
+			return "", err
+		}
+		return roomID, tx.Commit(ctx)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+
+	if err := tx.QueryRow(ctx, `INSERT INTO rooms (id, type, name) VALUES ($1, 'saved', $2) RETURNING id`, uuid.New().String(), savedRoomName).Scan(&roomID); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO room_participants (room_id, user_id) VALUES ($1, $2)`, roomID, userID); err != nil {
+		return "", err
+	}
+	return roomID, tx.Commit(ctx)
+}
+
+// insertSavedMessages restores one batch as seen, silent messages and returns how many were
+// new. Like any new message they expire under the room's message TTL.
+func insertSavedMessages(ctx context.Context, roomID string, userID int, username string, texts []string, times []time.Time) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		INSERT INTO messages (room, user_id, username, content, has_seen, silent, created_at, expires_at)
+		SELECT $1, $2, $3, m.content, TRUE, TRUE, m.created_at, `+roomMessageExpiry+`
+		FROM unnest($4::text[], $5::timestamptz[]) AS m(content, created_at)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM messages e WHERE e.room = $1 AND e.created_at = m.created_at AND e.content = m.content
+		)
+		ORDER BY m.created_at`, roomID, userID, username, texts, times)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DeletedUsername replaces the author name of a deleted account's messages
+const DeletedUsername = "deleted user"
+
+// DeleteAccount erases userID after checking its password: the account is renamed and loses
+// its email, names, password and sessions, its messages are attributed to DeletedUsername and
+// its photos and voice recordings are removed from storage. Message texts stay so
+// conversations keep making sense; voices in rooms under legal hold stay as well.
+func (s *UserService) DeleteAccount(ctx context.Context, userID int, password string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := s.checkPassword(ctx, userID, password); err != nil {
+		return err
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Admins are locked first, as in SetUserRole, so the last admins can't leave concurrently
+	if _, err := tx.Exec(ctx, `SELECT id FROM users WHERE role = 'admin' ORDER BY id FOR UPDATE`); err != nil {
+		return err
+	}
+	var role string
+	var held bool
+	err = tx.QueryRow(ctx, `SELECT role, legal_hold FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, userID).Scan(&role, &held)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if held {
+		return ErrLegalHold
+	}
+	if role == models.AppRoleAdmin {
+		var others int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE role = 'admin' AND banned_at IS NULL AND id <> $1`, userID).Scan(&others); err != nil {
+			return err
+		}
+		if others == 0 {
+			return ErrLastAdmin
+		}
+	}
+
+	var files []string
+	rows, err := tx.Query(ctx, `DELETE FROM photos WHERE user_id = $1 RETURNING filename`, userID)
+	if err != nil {
+		return err
+	}
+	photos, err := collectStrings(rows)
+	if err != nil {
+		return err
+	}
+	files = append(files, photos...)
+
+	rows, err = tx.Query(ctx, `DELETE FROM staged_media WHERE user_id = $1 RETURNING 'voices/' || filename`, userID)
+	if err != nil {
+		return err
+	}
+	staged, err := collectStrings(rows)
+	if err != nil {
+		return err
+	}
+	files = append(files, staged...)
+
+	// Voices go like expired ones, so clients show the recording as unavailable
+	rows, err = tx.Query(ctx, `UPDATE messages SET voice_expired = TRUE, voice_meta = NULL
+		WHERE user_id = $1 AND voice IS NOT NULL AND voice <> '' AND NOT voice_expired AND `+notHeld+`
+		RETURNING voice`, userID)
+	if err != nil {
+		return err
+	}
+	voices, err := collectStrings(rows)
+	if err != nil {
+		return err
+	}
+	for _, voice := range voices {
+		files = append(files, "voices/"+filepath.Base(voice))
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE messages SET username = $2 WHERE user_id = $1`, userID, DeletedUsername); err != nil {
+		return err
+	}
+	// Quotes embed a copy of the replied-to message
+	if _, err := tx.Exec(ctx, `UPDATE messages SET reply_to = jsonb_set(reply_to, '{username}', to_jsonb($2::text))
+		WHERE reply_to IS NOT NULL AND (reply_to->>'user_id')::int = $1`, userID, DeletedUsername); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE user_devices SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE admin_api_tokens SET revoked_at = NOW() WHERE created_by = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return err
+	}
+	for _, q := range []string{
+		`DELETE FROM device_tokens WHERE user_id = $1`,
+		`DELETE FROM oidc_auth_codes WHERE user_id = $1`,
+		`DELETE FROM password_reset_tokens WHERE user_id = $1`,
+		`DELETE FROM email_changes WHERE user_id = $1`,
+		`DELETE FROM email_change_audit WHERE user_id = $1`,
+	} {
+		if _, err := tx.Exec(ctx, q, userID); err != nil {
+			return err
+		}
+	}
+	// An unusable password hash: no algorithm recognizes it
+	if _, err := tx.Exec(ctx, `UPDATE users SET username = 'deleted_' || id, email = NULL, first_name = NULL, last_name = NULL,
+		password_hash = '!', last_seen_at = NULL, role = 'user', deleted_at = NOW() WHERE id = $1`, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	for _, key := range files {
+		DeleteUpload(ctx, key)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DeleteRoom removes a room with its messages, attachments, staged uploads and activity
+// rollups, and records an audit entry. Rooms holding anything under legal hold are refused.
+func (s *AdminService) DeleteRoom(ctx context.Context, adminID int, roomID, reason string) (*models.RoomDeletion, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var held bool
+	err = tx.QueryRow(ctx, `SELECT legal_hold OR EXISTS (
+			SELECT 1 FROM messages m JOIN users u ON u.id = m.user_id WHERE m.room = rooms.id AND u.legal_hold
+		) FROM rooms WHERE id = $1 FOR UPDATE`, roomID).Scan(&held)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		return nil, ErrLegalHold
+	}
+
+	res := &models.RoomDeletion{RoomID: roomID}
+	rows, err := tx.Query(ctx, `SELECT user_id FROM room_participants WHERE room_id = $1`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		res.Participants = append(res.Participants, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(ctx, `DELETE FROM messages WHERE room = $1 RETURNING id, room, voice, file`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := scanDeletedMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	res.Messages = len(deleted)
+
+	// Attachments uploaded but never sent are only in files
+	rows, err = tx.Query(ctx, `DELETE FROM files WHERE room = $1 RETURNING filename`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := collectStrings(rows)
+	if err != nil {
+		return nil, err
+	}
+	res.Files = len(files)
+	rows, err = tx.Query(ctx, `DELETE FROM staged_media WHERE room = $1 RETURNING filename`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	staged, err := collectStrings(rows)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM room_daily_activity WHERE room = $1`, roomID); err != nil {
+		return nil, err
+	}
+	// Participants, invites, pins, webhooks, announcements and the mirror row cascade
+	if _, err := tx.Exec(ctx, `DELETE FROM rooms WHERE id = $1`, roomID); err != nil {
+		return nil, err
+	}
+
+	details := map[string]interface{}{"reason": reason, "messages": res.Messages, "files": res.Files, "participants": len(res.Participants)}
+	if err := recordAdminAudit(ctx, tx, adminID, "delete_room", "room", roomID, details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	removeMessageMedia(ctx, deleted)
+	for _, filename := range files {
+		DeleteUpload(ctx, "files/"+filename)
+	}
+	for _, filename := range staged {
+		DeleteUpload(ctx, "voices/"+filename)
+	}
+	return res, nil
+}
+
+// PurgeRoomMessages deletes a room's messages, optionally only those sent before req.Before
+// or by req.UserID, and records an audit entry. Messages under legal hold are kept. The
+// room's static mirror is reset so the next export leaves the purged messages out.
+func (s *AdminService) PurgeRoomMessages(ctx context.Context, adminID int, roomID string, req models.PurgeMessagesRequest) ([]models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM rooms WHERE id = $1)`, roomID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	rows, err := tx.Query(ctx, `DELETE FROM messages WHERE room = $1
+		AND ($2::timestamptz IS NULL OR created_at < $2)
+		AND ($3::integer IS NULL OR user_id = $3)
+		AND `+notHeld+`
+		RETURNING id, room, voice, file`, roomID, req.Before, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := scanDeletedMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(deleted) > 0 {
+		if _, err := tx.Exec(ctx, `UPDATE room_mirrors SET last_message_id = 0, message_count = 0, exported_at = NULL WHERE room_id = $1`, roomID); err != nil {
+			return nil, err
+		}
+	}
+
+	details := map[string]interface{}{"reason": req.Reason, "messages": len(deleted), "before": req.Before, "user_id": req.UserID}
+	if err := recordAdminAudit(ctx, tx, adminID, "purge_messages", "room", roomID, details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	removeMessageMedia(ctx, deleted)
+	return deleted, nil
+}
+
+// RoomStats returns counts for a room; the handler fills in the live OnlineUsers and Viewers
+func (s *AdminService) RoomStats(ctx context.Context, roomID string) (*models.RoomStats, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	st := models.RoomStats{RoomID: roomID}
+	err := db.Read(ctx).QueryRow(ctx, `SELECT r.name, r.type, r.legal_hold, r.created_at,
+			(SELECT COUNT(*) FROM room_participants WHERE room_id = r.id),
+			m.total, m.deleted, m.first_at, m.last_at,
+			f.total, f.bytes
+		FROM rooms r,
+		LATERAL (SELECT COUNT(*) AS total, COUNT(*) FILTER (WHERE deleted_at IS NOT NULL) AS deleted,
+			MIN(created_at) AS first_at, MAX(created_at) AS last_at FROM messages WHERE room = r.id) m,
+		LATERAL (SELECT COUNT(*) AS total, COALESCE(SUM(size), 0) AS bytes FROM files WHERE room = r.id) f
+		WHERE r.id = $1`, roomID).Scan(&st.Name, &st.Type, &st.LegalHold, &st.CreatedAt, &st.Participants,
+		&st.Messages, &st.DeletedMessages, &st.FirstMessageAt, &st.LastMessageAt, &st.Files, &st.FileBytes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+)
+
+// ErrNotFound is returned when an admin operation targets a missing row
+var ErrNotFound = errors.New("not found")
+
+type AdminService struct{}
+
+func NewAdminService() *AdminService {
+	return &AdminService{}
+}
+
+// SetRoomLegalHold applies or releases a legal hold on a room and records an audit entry
+func (s *AdminService) SetRoomLegalHold(ctx context.Context, adminID int, roomID string, req models.LegalHoldRequest) error {
+	return s.setLegalHold(ctx, adminID, "room", roomID, `UPDATE rooms SET legal_hold = $1 WHERE id = $2`, roomID, req)
+}
+
+// SetUserLegalHold applies or releases a legal hold on a user and records an audit entry
+func (s *AdminService) SetUserLegalHold(ctx context.Context, adminID int, userID int, req models.LegalHoldRequest) error {
+	return s.setLegalHold(ctx, adminID, "user", strconv.Itoa(userID), `UPDATE users SET legal_hold = $1 WHERE id = $2`, userID, req)
+}
+
+func (s *AdminService) setLegalHold(ctx context.Context, adminID int, targetType, targetID, update string, key interface{}, req models.LegalHoldRequest) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, update, req.Enabled, key)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	action := "released"
+	if req.Enabled {
+		action = "applied"
+	}
+	var reason *string
+	if req.Reason != "" {
+		reason = &req.Reason
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO legal_hold_audit (target_type, target_id, action, admin_user_id, reason) VALUES ($1, $2, $3, $4, $5)`,
+		targetType, targetID, action, adminID, reason)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ListLegalHoldAudit returns audit entries, newest first, optionally filtered by target
+func (s *AdminService) ListLegalHoldAudit(ctx context.Context, targetType, targetID string, limit int) ([]models.LegalHoldAuditEntry, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, target_type, target_id, action, admin_user_id, reason, created_at FROM legal_hold_audit
+		WHERE ($1 = '' OR target_type = $1) AND ($2 = '' OR target_id = $2)
+		ORDER BY created_at DESC LIMIT $3`
+	rows, err := db.Pool.Query(ctx, query, targetType, targetID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.LegalHoldAuditEntry{}
+	for rows.Next() {
+		var e models.LegalHoldAuditEntry
+		if err := rows.Scan(&e.ID, &e.TargetType, &e.TargetID, &e.Action, &e.AdminUserID, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// SetRoomRetention overrides how many days messages in a room are kept. nil clears the override,
+// 0 keeps messages forever regardless of the deployment default.
+func (s *AdminService) SetRoomRetention(ctx context.Context, roomID string, days *int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE rooms SET retention_days = $1 WHERE id = $2`, days, roomID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidAdminToken is returned for unknown, expired or revoked admin API tokens
+var ErrInvalidAdminToken = errors.New("invalid admin api token")
+
+// adminTokenPrefix makes admin tokens recognizable in logs and secret scanners
+const adminTokenPrefix = "adm_"
+
+const adminTokenColumns = `id, name, scopes, created_by, created_at, expires_at, last_used_at, revoked_at`
+
+func scanAdminToken(row rowScanner) (*models.AdminToken, error) {
+	var t models.AdminToken
+	if err := row.Scan(&t.ID, &t.Name, &t.Scopes, &t.CreatedBy, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateAdminToken issues a scoped token for adminID. The secret is only returned here.
+func (s *AdminService) CreateAdminToken(ctx context.Context, adminID int, name string, scopes []string, expiresAt time.Time) (*models.AdminToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	secret := adminTokenPrefix + hex.EncodeToString(buf)
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	token, err := scanAdminToken(tx.QueryRow(ctx, `INSERT INTO admin_api_tokens (name, token_hash, scopes, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING `+adminTokenColumns, name, hashAPIKey(secret), scopes, adminID, expiresAt))
+	if err != nil {
+		return nil, err
+	}
+	if err := recordAdminAudit(ctx, tx, adminID, "create_admin_token", "admin_token", strconv.Itoa(token.ID),
+		map[string]interface{}{"name": name, "scopes": scopes, "expires_at": expiresAt}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	token.Token = secret
+	return token, nil
+}
+
+// ListAdminTokens returns every token, newest first, without secrets
+func (s *AdminService) ListAdminTokens(ctx context.Context) ([]models.AdminToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT `+adminTokenColumns+` FROM admin_api_tokens ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.AdminToken{}
+	for rows.Next() {
+		t, err := scanAdminToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAdminToken revokes a token immediately; revoking twice reports ErrNotFound
+func (s *AdminService) RevokeAdminToken(ctx context.Context, adminID, tokenID int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE admin_api_tokens SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, tokenID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	if err := recordAdminAudit(ctx, tx, adminID, "revoke_admin_token", "admin_token", strconv.Itoa(tokenID), nil); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// AuthenticateAdminToken returns the live token a secret belongs to and records its use. A
+// token stops working once its creator is no longer an active admin.
+func (s *AdminService) AuthenticateAdminToken(ctx context.Context, secret string) (*models.AdminToken, error) {
+	if !strings.HasPrefix(secret, adminTokenPrefix) {
+		return nil, ErrInvalidAdminToken
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	token, err := scanAdminToken(db.Pool.QueryRow(ctx, `UPDATE admin_api_tokens SET last_used_at = NOW()
+		WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		AND EXISTS (SELECT 1 FROM users u WHERE u.id = admin_api_tokens.created_by
+			AND u.role = 'admin' AND u.banned_at IS NULL AND u.deleted_at IS NULL)
+		RETURNING `+adminTokenColumns, hashAPIKey(secret)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidAdminToken
+	}
+	return token, err
+}
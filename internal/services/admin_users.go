@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrUserBanned is returned when a banned user signs in
+	ErrUserBanned = errors.New("account is banned")
+	// ErrUserDeleted is returned for tokens of an account that has since been deleted
+	ErrUserDeleted = errors.New("account is deleted")
+	// ErrInvalidRole is returned for roles other than models.AppRoleUser and models.AppRoleAdmin
+	ErrInvalidRole = errors.New("role must be user or admin")
+	// ErrBanAdmin is returned when banning an admin; demote them first
+	ErrBanAdmin = errors.New("admins cannot be banned")
+	// ErrLastAdmin is returned when the only admin would lose the role
+	ErrLastAdmin = errors.New("cannot demote the last admin")
+	// ErrAdminExists is returned by BootstrapAdmin once there is an admin to grant the role
+	ErrAdminExists = errors.New("an admin already exists; use the admin API to change roles")
+)
+
+// IsAdmin reports whether userID has the admin role and isn't banned. It reads the primary
+// so a demotion takes effect immediately.
+func IsAdmin(ctx context.Context, userID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var admin bool
+	err := db.Pool.QueryRow(ctx, `SELECT role = 'admin' AND banned_at IS NULL FROM users WHERE id = $1`, userID).Scan(&admin)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return admin, err
+}
+
+// IsUserBanned reports whether userID is banned, or deleted, which locks it out the same way
+func IsUserBanned(ctx context.Context, userID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var banned bool
+	err := db.Pool.QueryRow(ctx, `SELECT banned_at IS NOT NULL OR deleted_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&banned)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return banned, err
+}
+
+// AccountLockout returns ErrUserDeleted or ErrUserBanned when userID may no longer use
+// the tokens it was issued, and nil otherwise. Deletion takes precedence, as deleted
+// accounts keep their ban.
+func AccountLockout(ctx context.Context, userID int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var banned, deleted bool
+	err := db.Pool.QueryRow(ctx, `SELECT banned_at IS NOT NULL, deleted_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&banned, &deleted)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return ErrUserDeleted
+	case err != nil:
+		return err
+	case deleted:
+		return ErrUserDeleted
+	case banned:
+		return ErrUserBanned
+	}
+	return nil
+}
+
+// BootstrapAdmin gives the admin role to username while there is no active admin at all,
+// and records it in the audit log without an acting admin. It backs the promote-admin
+// command; once an admin exists, roles change through SetUserRole only.
+func BootstrapAdmin(ctx context.Context, username string) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locked like SetUserRole, so two bootstraps can't both find no admin
+	if _, err := tx.Exec(ctx, `SELECT id FROM users WHERE role = 'admin' ORDER BY id FOR UPDATE`); err != nil {
+		return 0, err
+	}
+	var admins int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE role = 'admin' AND banned_at IS NULL AND deleted_at IS NULL`).Scan(&admins); err != nil {
+		return 0, err
+	}
+	if admins > 0 {
+		return 0, ErrAdminExists
+	}
+	var userID int
+	err = tx.QueryRow(ctx, `SELECT id FROM users WHERE username = $1 AND banned_at IS NULL AND deleted_at IS NULL AND NOT is_bot FOR UPDATE`, username).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET role = 'admin' WHERE id = $1`, userID); err != nil {
+		return 0, err
+	}
+	details := map[string]string{"previous": models.AppRoleUser, "role": models.AppRoleAdmin}
+	if err := recordAdminAudit(ctx, tx, 0, "bootstrap_admin", "user", strconv.Itoa(userID), details); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit(ctx)
+}
+
+// ListUsers returns users matching filter ordered by id, bots included
+func (s *AdminService) ListUsers(ctx context.Context, f models.AdminUserFilter) ([]models.AdminUser, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	pattern := ""
+	if f.Query != "" {
+		pattern = "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(f.Query) + "%"
+	}
+	query := `SELECT id, username, email, role, is_bot, legal_hold, banned_at, ban_reason, last_seen_at, created_at FROM users
+		WHERE ($1 = '' OR username ILIKE $1 OR email ILIKE $1)
+		AND ($2 = '' OR role = $2)
+		AND ($3::boolean IS NULL OR (banned_at IS NOT NULL) = $3)
+		ORDER BY id LIMIT $4 OFFSET $5`
+	rows, err := db.Read(ctx).Query(ctx, query, pattern, f.Role, f.Banned, f.Limit, f.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.AdminUser{}
+	for rows.Next() {
+		var u models.AdminUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.Role, &u.IsBot, &u.LegalHold, &u.BannedAt, &u.BanReason, &u.LastSeenAt, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// SetUserRole changes a user's application role and records an audit entry. The last
+// remaining admin can't be demoted.
+func (s *AdminService) SetUserRole(ctx context.Context, adminID, userID int, role string) error {
+	if role != models.AppRoleUser && role != models.AppRoleAdmin {
+		return ErrInvalidRole
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking every admin serializes concurrent demotions, so two admins can't demote each
+	// other to none
+	if _, err := tx.Exec(ctx, `SELECT id FROM users WHERE role = 'admin' ORDER BY id FOR UPDATE`); err != nil {
+		return err
+	}
+	var previous string
+	var banned bool
+	err = tx.QueryRow(ctx, `SELECT role, banned_at IS NOT NULL FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&previous, &banned)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if previous == role {
+		return nil
+	}
+	if role == models.AppRoleAdmin && banned {
+		return ErrBanAdmin
+	}
+	if previous == models.AppRoleAdmin {
+		var others int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE role = 'admin' AND banned_at IS NULL AND id <> $1`, userID).Scan(&others); err != nil {
+			return err
+		}
+		if others == 0 {
+			return ErrLastAdmin
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, userID); err != nil {
+		return err
+	}
+	details := map[string]string{"previous": previous, "role": role}
+	if err := recordAdminAudit(ctx, tx, adminID, "set_user_role", "user", strconv.Itoa(userID), details); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// BanUser stops a user from signing in: their devices are revoked, so refresh tokens stop
+// working, and their push tokens are dropped. Access tokens already issued stay valid until
+// they expire, except for opening websocket connections. Banning a banned user updates the
+// reason. Admins can't be banned.
+func (s *AdminService) BanUser(ctx context.Context, adminID, userID int, reason string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var role string
+	err = tx.QueryRow(ctx, `SELECT role FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if role == models.AppRoleAdmin {
+		return ErrBanAdmin
+	}
+
+	var reasonArg *string
+	if reason != "" {
+		reasonArg = &reason
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET banned_at = COALESCE(banned_at, NOW()), banned_by = $1, ban_reason = $2 WHERE id = $3`,
+		adminID, reasonArg, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE user_devices SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM device_tokens WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if err := recordAdminAudit(ctx, tx, adminID, "ban_user", "user", strconv.Itoa(userID), map[string]string{"reason": reason}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// UnbanUser lifts a ban; the user signs in again to get new tokens. Unbanning a user who
+// isn't banned does nothing.
+func (s *AdminService) UnbanUser(ctx context.Context, adminID, userID int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var banned bool
+	err = tx.QueryRow(ctx, `SELECT banned_at IS NOT NULL FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&banned)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil || !banned {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET banned_at = NULL, banned_by = NULL, ban_reason = NULL WHERE id = $1`, userID); err != nil {
+		return err
+	}
+	if err := recordAdminAudit(ctx, tx, adminID, "unban_user", "user", strconv.Itoa(userID), nil); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// announcementJoin selects the room's announcement unless user $1 dismissed it; r is the room alias
+const announcementJoin = `LEFT JOIN LATERAL (
+		SELECT ra.message_id, am.content, am.voice IS NOT NULL AS has_voice, am.username, ra.set_by, ra.set_at
+		FROM room_announcements ra JOIN messages am ON am.id = ra.message_id
+		WHERE ra.room_id = r.id AND am.deleted_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM room_announcement_dismissals d WHERE d.room_id = ra.room_id AND d.user_id = $1)
+	) ann ON true`
+
+// announcementColumns are the columns of announcementJoin, read with announcementScan
+const announcementColumns = `ann.message_id, ann.content, ann.has_voice, ann.username, ann.set_by, ann.set_at`
+
+// announcementScan collects the nullable announcementColumns of one row
+type announcementScan struct {
+	messageID *int
+	text      *string
+	hasVoice  *bool
+	username  *string
+	setBy     *int
+	setAt     *time.Time
+}
+
+func (a *announcementScan) dest() []interface{} {
+	return []interface{}{&a.messageID, &a.text, &a.hasVoice, &a.username, &a.setBy, &a.setAt}
+}
+
+// announcement returns the scanned announcement, nil when the room has none for the viewer
+func (a *announcementScan) announcement() *models.RoomAnnouncement {
+	if a.messageID == nil {
+		return nil
+	}
+	ann := &models.RoomAnnouncement{MessageID: *a.messageID, Text: a.text, SetBy: a.setBy}
+	if a.hasVoice != nil {
+		ann.HasVoice = *a.hasVoice
+	}
+	if a.username != nil {
+		ann.Username = *a.username
+	}
+	if a.setAt != nil {
+		ann.SetAt = *a.setAt
+	}
+	return ann
+}
+
+// GetRoomAnnouncement returns the room's announcement as seen by viewerID, or ErrNotFound when
+// there is none or the viewer dismissed it
+func (s *ChatService) GetRoomAnnouncement(ctx context.Context, roomID string, viewerID int) (*models.RoomAnnouncement, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var scan announcementScan
+	err := db.Read(ctx).QueryRow(ctx, `SELECT `+announcementColumns+` FROM rooms r `+announcementJoin+` WHERE r.id = $2`,
+		viewerID, roomID).Scan(scan.dest()...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ann := scan.announcement(); ann != nil {
+		return ann, nil
+	}
+	return nil, ErrNotFound
+}
+
+// SetRoomAnnouncement announces a message of the room, replacing the current announcement and
+// resetting every dismissal. Only room owners and admins may announce unless override is set.
+func (s *ChatService) SetRoomAnnouncement(ctx context.Context, roomID string, actorID, messageID int, override bool) (*models.RoomAnnouncement, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := requireRoomAdmin(ctx, tx, roomID, actorID, override); err != nil {
+		return nil, err
+	}
+	ann := &models.RoomAnnouncement{MessageID: messageID, SetBy: &actorID}
+	err = tx.QueryRow(ctx, `SELECT content, voice IS NOT NULL, username FROM messages
+		WHERE id = $1 AND room = $2 AND deleted_at IS NULL AND `+notExpired, messageID, roomID).Scan(&ann.Text, &ann.HasVoice, &ann.Username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRow(ctx, `INSERT INTO room_announcements (room_id, message_id, set_by) VALUES ($1, $2, $3)
+		ON CONFLICT (room_id) DO UPDATE SET message_id = EXCLUDED.message_id, set_by = EXCLUDED.set_by, set_at = NOW()
+		RETURNING set_at`, roomID, messageID, actorID).Scan(&ann.SetAt); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM room_announcement_dismissals WHERE room_id = $1`, roomID); err != nil {
+		return nil, err
+	}
+	return ann, tx.Commit(ctx)
+}
+
+// ClearRoomAnnouncement removes the room's announcement; ErrNotFound when there is none
+func (s *ChatService) ClearRoomAnnouncement(ctx context.Context, roomID string, actorID int, override bool) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := requireRoomAdmin(ctx, db.Pool, roomID, actorID, override); err != nil {
+		return err
+	}
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM room_announcements WHERE room_id = $1`, roomID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DismissRoomAnnouncement hides the room's current announcement for userID until a new one is set
+func (s *ChatService) DismissRoomAnnouncement(ctx context.Context, roomID string, userID int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `INSERT INTO room_announcement_dismissals (room_id, user_id)
+		SELECT room_id, $2 FROM room_announcements WHERE room_id = $1
+		ON CONFLICT (room_id, user_id) DO UPDATE SET dismissed_at = NOW()`, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// botPasswordHash is not a hash of any registered algorithm, so the bot account can never log in
+const botPasswordHash = "!"
+
+// BotService posts system messages on behalf of a dedicated bot account
+type BotService struct {
+	userID   int
+	username string
+}
+
+func NewBotService() *BotService {
+	return &BotService{}
+}
+
+// Ensure creates the bot account if needed and remembers its id. Must be called at startup.
+func (s *BotService) Ensure(ctx context.Context, username string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO users (username, password_hash, is_bot) VALUES ($1, $2, TRUE)
+		ON CONFLICT (username) DO UPDATE SET is_bot = TRUE
+		RETURNING id, username
+	`
+	return db.Pool.QueryRow(ctx, query, username, botPasswordHash).Scan(&s.userID, &s.username)
+}
+
+func (s *BotService) UserID() int {
+	return s.userID
+}
+
+func (s *BotService) Username() string {
+	return s.username
+}
+
+// PostSystemMessage stores a system message from the bot in the given room
+func (s *BotService) PostSystemMessage(ctx context.Context, room, text string) (*models.Message, error) {
+	return s.PostSystemMessageAs(ctx, room, s.username, text)
+}
+
+// PostSystemMessageAs stores a bot message shown under another sender name, e.g. a webhook's
+func (s *BotService) PostSystemMessageAs(ctx context.Context, room, username, text string) (*models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	msg := &models.Message{
+		Room:     room,
+		UserID:   s.userID,
+		Username: username,
+		Content:  &text,
+		System:   true,
+	}
+	if err := insertMessage(ctx, db.Pool, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// PostWebhookMessage saves a message from a room webhook. It is posted by the bot account
+// under WebhookSenderName, but is not a system message.
+func (s *BotService) PostWebhookMessage(ctx context.Context, room, webhookName, text string) (*models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	msg := &models.Message{
+		Room:     room,
+		UserID:   s.userID,
+		Username: WebhookSenderName(webhookName),
+		Content:  &text,
+	}
+	if err := insertMessage(ctx, db.Pool, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// EnsureTemplateRooms creates the configured named rooms if they don't exist yet.
+// Rooms are keyed by their lower-cased name.
+func (s *ChatService) EnsureTemplateRooms(ctx context.Context, names []string) ([]models.Room, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var rooms []models.Room
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var room models.Room
+		query := `
+			INSERT INTO rooms (id, type, name, template_key) VALUES ($1, 'channel', $2, $3)
+			ON CONFLICT (template_key) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id, type, name, created_at
+		`
+		if err := db.Pool.QueryRow(ctx, query, uuid.New().String(), name, strings.ToLower(name)).Scan(&room.ID, &room.Type, &room.Name, &room.CreatedAt); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrInvalidBotKey is returned for unknown or revoked bot API keys
+var ErrInvalidBotKey = errors.New("invalid bot api key")
+
+// botKeyPrefix makes bot keys recognizable in logs and secret scanners
+const botKeyPrefix = "bot_"
+
+// hashAPIKey is the stored form of bot API keys and admin API tokens
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateBot creates an integration bot account and its API key. The key is only returned here.
+func (s *UserService) CreateBot(ctx context.Context, username string) (*models.BotAccount, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	key := botKeyPrefix + hex.EncodeToString(buf)
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	bot := &models.BotAccount{APIKey: key}
+	err = tx.QueryRow(ctx, `INSERT INTO users (username, password_hash, is_bot) VALUES ($1, $2, TRUE) RETURNING id, username, created_at`,
+		username, botPasswordHash).Scan(&bot.ID, &bot.Username, &bot.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrUserExists
+		}
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO bot_api_keys (user_id, key_hash) VALUES ($1, $2)`, bot.ID, hashAPIKey(key)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return bot, nil
+}
+
+// AuthenticateBotKey returns the bot account a key belongs to
+func (s *UserService) AuthenticateBotKey(ctx context.Context, key string) (int, string, error) {
+	if !strings.HasPrefix(key, botKeyPrefix) {
+		return 0, "", ErrInvalidBotKey
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var userID int
+	var username string
+	err := db.Pool.QueryRow(ctx, `
+		UPDATE bot_api_keys k SET last_used_at = NOW()
+		FROM users u
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND u.id = k.user_id AND u.is_bot
+		RETURNING u.id, u.username
+	`, hashAPIKey(key)).Scan(&userID, &username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, "", ErrInvalidBotKey
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, username, nil
+}
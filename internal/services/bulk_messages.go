@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+)
+
+var (
+	errBulkEmptyText  = errors.New("text is required")
+	errBulkRoomDenied = errors.New("room not found or bot is not a member")
+)
+
+// SendBulkMessages stores messages from a bot in one transaction. Each message runs in
+// its own savepoint, so an invalid message is reported in its result without failing the
+// others. Bots may post to channels and to rooms they are a member of.
+// Returns the per-message results and the stored messages, in request order.
+func (s *ChatService) SendBulkMessages(ctx context.Context, botID int, botUsername string, msgs []models.BulkMessage) ([]models.BulkMessageResult, []*models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	results := make([]models.BulkMessageResult, len(msgs))
+	var stored []*models.Message
+	for i, m := range msgs {
+		results[i] = models.BulkMessageResult{Index: i, Room: m.Room}
+		if m.Text == "" {
+			results[i].Error = errBulkEmptyText.Error()
+			continue
+		}
+
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		var allowed bool
+		err = sp.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM rooms r WHERE r.id = $1 AND (r.type = 'channel' OR EXISTS (
+					SELECT 1 FROM room_participants p WHERE p.room_id = r.id AND p.user_id = $2 AND p.left_at IS NULL
+				))
+			)
+		`, m.Room, botID).Scan(&allowed)
+		if err == nil && !allowed {
+			err = errBulkRoomDenied
+		}
+
+		msg := &models.Message{Room: m.Room, UserID: botID, Username: botUsername, Silent: m.Silent}
+		text := m.Text
+		msg.Content = &text
+		if err == nil {
+			err = insertMessage(ctx, sp, msg)
+		}
+		if err != nil {
+			_ = sp.Rollback(ctx)
+			if errors.Is(err, errBulkRoomDenied) {
+				results[i].Error = err.Error()
+			} else {
+				results[i].Error = "failed to store message"
+			}
+			continue
+		}
+		if err := sp.Commit(ctx); err != nil {
+			return nil, nil, err
+		}
+		results[i].ID = msg.ID
+		results[i].Timestamp = msg.CreatedAt.UnixMilli()
+		stored = append(stored, msg)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return results, stored, nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidBulkRoom is returned when an entry of a bulk room creation is malformed
+var ErrInvalidBulkRoom = errors.New("invalid room")
+
+// CreateRoomsBulk creates direct and group rooms with their participants in one transaction,
+// for importing an organization's existing team structure. Every user must exist; nothing
+// is created when any entry fails. Direct rooms that already exist are reported with
+// IsNew false. Group names are expected to be validated by the caller. Returns the results
+// in request order and the membership events to deliver.
+func (s *ChatService) CreateRoomsBulk(ctx context.Context, callerID int, rooms []models.BulkRoom, maxMembers int) ([]models.BulkRoomResult, []*models.MembershipEvent, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := requireUsersExist(ctx, tx, rooms, callerID); err != nil {
+		return nil, nil, err
+	}
+
+	results := make([]models.BulkRoomResult, 0, len(rooms))
+	var events []*models.MembershipEvent
+	for i, room := range rooms {
+		result := models.BulkRoomResult{Index: i, Type: room.Type}
+		switch room.Type {
+		case "direct":
+			if len(room.MemberIDs) != 2 || room.MemberIDs[0] == room.MemberIDs[1] {
+				return nil, nil, fmt.Errorf("room %d: %w: direct rooms need two different member_ids", i, ErrInvalidBulkRoom)
+			}
+			existing, err := findDirectRoom(ctx, tx, room.MemberIDs[0], room.MemberIDs[1])
+			if err != nil {
+				return nil, nil, err
+			}
+			if existing != "" {
+				result.RoomID = existing
+				break
+			}
+			roomID, evs, err := insertDirectRoom(ctx, tx, room.MemberIDs[0], room.MemberIDs[1])
+			if err != nil {
+				return nil, nil, fmt.Errorf("room %d: %w", i, err)
+			}
+			result.RoomID, result.IsNew = roomID, true
+			events = append(events, evs...)
+		case "group":
+			ownerID := room.OwnerID
+			if ownerID == 0 {
+				ownerID = callerID
+			}
+			ids := []int{ownerID}
+			seen := map[int]bool{ownerID: true}
+			for _, id := range room.MemberIDs {
+				if !seen[id] {
+					seen[id] = true
+					ids = append(ids, id)
+				}
+			}
+			if maxMembers > 0 && len(ids) > maxMembers {
+				return nil, nil, fmt.Errorf("room %d: %w", i, ErrGroupFull)
+			}
+			group, evs, err := insertGroupRoom(ctx, tx, ownerID, room.Name, ids)
+			if err != nil {
+				return nil, nil, fmt.Errorf("room %d: %w", i, err)
+			}
+			result.RoomID, result.IsNew = group.ID, true
+			events = append(events, evs...)
+		default:
+			return nil, nil, fmt.Errorf("room %d: %w: type must be direct or group", i, ErrInvalidBulkRoom)
+		}
+		results = append(results, result)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return results, events, nil
+}
+
+// requireUsersExist fails with ErrNotFound naming the first unknown user of a bulk creation
+func requireUsersExist(ctx context.Context, tx pgx.Tx, rooms []models.BulkRoom, callerID int) error {
+	ids := []int{callerID}
+	for _, room := range rooms {
+		ids = append(ids, room.MemberIDs...)
+		if room.OwnerID != 0 {
+			ids = append(ids, room.OwnerID)
+		}
+	}
+	var missing int
+	err := tx.QueryRow(ctx, `SELECT t.id FROM unnest($1::int[]) AS t(id)
+		WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = t.id) LIMIT 1`, ids).Scan(&missing)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("user %d: %w", missing, ErrNotFound)
+}
+
+// findDirectRoom returns the direct room between two users, "" when there is none
+func findDirectRoom(ctx context.Context, tx pgx.Tx, userID1, userID2 int) (string, error) {
+	var roomID string
+	err := tx.QueryRow(ctx, `SELECT r.id FROM rooms r
+		JOIN room_participants p1 ON r.id = p1.room_id
+		JOIN room_participants p2 ON r.id = p2.room_id
+		WHERE r.type = 'direct' AND p1.user_id = $1 AND p2.user_id = $2
+		LIMIT 1`, userID1, userID2).Scan(&roomID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return roomID, err
+}
@@ -4,12 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"chat-backend/internal/db"
 	"chat-backend/internal/models"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 type ChatService struct{}
@@ -19,6 +24,9 @@ func NewChatService() *ChatService {
 }
 
 func (s *ChatService) GetOrCreateDirectRoom(ctx context.Context, userID1, userID2 int) (*models.RoomResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	// Check if room exists
 	query := `
 		SELECT r.id 
@@ -33,6 +41,10 @@ func (s *ChatService) GetOrCreateDirectRoom(ctx context.Context, userID1, userID
 	var roomID string
 	err := db.Pool.QueryRow(ctx, query, userID1, userID2).Scan(&roomID)
 	if err == nil {
+		// Reopening a direct chat brings back a requester who left it
+		if _, err := s.AddRoomMember(ctx, roomID, userID1, nil); err != nil {
+			return nil, err
+		}
 		return &models.RoomResponse{RoomID: roomID, IsNew: false}, nil
 	}
 
@@ -43,13 +55,7 @@ func (s *ChatService) GetOrCreateDirectRoom(ctx context.Context, userID1, userID
 	}
 	defer tx.Rollback(ctx)
 
-	newRoomID := uuid.New().String()
-	_, err = tx.Exec(ctx, "INSERT INTO rooms (id, type) VALUES ($1, 'direct')", newRoomID)
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = tx.Exec(ctx, "INSERT INTO room_participants (room_id, user_id) VALUES ($1, $2), ($1, $3)", newRoomID, userID1, userID2)
+	newRoomID, _, err := insertDirectRoom(ctx, tx, userID1, userID2)
 	if err != nil {
 		return nil, err
 	}
@@ -61,12 +67,111 @@ func (s *ChatService) GetOrCreateDirectRoom(ctx context.Context, userID1, userID
 	return &models.RoomResponse{RoomID: newRoomID, IsNew: true}, nil
 }
 
+// insertDirectRoom creates a direct room opened by userID1 with userID2
+func insertDirectRoom(ctx context.Context, tx pgx.Tx, userID1, userID2 int) (string, []*models.MembershipEvent, error) {
+	roomID := uuid.New().String()
+	if _, err := tx.Exec(ctx, "INSERT INTO rooms (id, type) VALUES ($1, 'direct')", roomID); err != nil {
+		return "", nil, err
+	}
+	_, err := tx.Exec(ctx, "INSERT INTO room_participants (room_id, user_id, invited_by) VALUES ($1, $2, NULL), ($1, $3, $2)", roomID, userID1, userID2)
+	if err != nil {
+		return "", nil, err
+	}
+	opened, err := recordMembershipEvent(ctx, tx, roomID, userID1, nil, "member_added")
+	if err != nil {
+		return "", nil, err
+	}
+	added, err := recordMembershipEvent(ctx, tx, roomID, userID2, &userID1, "member_added")
+	if err != nil {
+		return "", nil, err
+	}
+	return roomID, []*models.MembershipEvent{opened, added}, nil
+}
+
+// messageColumns is the column list shared by every query that returns full message rows.
+// Rows selected with it must be read with scanMessage.
+const messageColumns = `id, room, user_id, username, content, voice, voice_meta, voice_expired, file, has_seen, reply_to, expires_at, system, silent, edited_at, deleted_at, version, thread_id, sticker, created_at`
+
+// notExpired filters out messages whose sender-set TTL has elapsed but haven't been swept yet
+const notExpired = `(expires_at IS NULL OR expires_at > NOW())`
+
+// notHeld excludes messages in rooms or from users under legal hold; used by every purge
+const notHeld = `NOT EXISTS (SELECT 1 FROM rooms hr WHERE hr.id = messages.room AND hr.legal_hold)
+	AND NOT EXISTS (SELECT 1 FROM users hu WHERE hu.id = messages.user_id AND hu.legal_hold)`
+
+// rowScanner is satisfied by both pgx.Row and pgx.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage reads a row selected with messageColumns, decoding the reply_to payload
+func scanMessage(row rowScanner) (*models.Message, error) {
+	var msg models.Message
+	var replyBytes, voiceMetaBytes, fileBytes, stickerBytes sql.NullString
+	if err := row.Scan(&msg.ID, &msg.Room, &msg.UserID, &msg.Username, &msg.Content, &msg.Voice, &voiceMetaBytes, &msg.VoiceExpired, &fileBytes, &msg.HasSeen, &replyBytes, &msg.ExpiresAt, &msg.System, &msg.Silent, &msg.EditedAt, &msg.DeletedAt, &msg.Version, &msg.ThreadID, &stickerBytes, &msg.CreatedAt); err != nil {
+		return nil, err
+	}
+	if voiceMetaBytes.Valid && len(voiceMetaBytes.String) > 0 {
+		var meta models.VoiceMeta
+		if err := json.Unmarshal([]byte(voiceMetaBytes.String), &meta); err == nil {
+			msg.VoiceMeta = &meta
+		}
+	}
+	if fileBytes.Valid && len(fileBytes.String) > 0 {
+		var f models.MessageFile
+		if err := json.Unmarshal([]byte(fileBytes.String), &f); err == nil {
+			msg.File = &f
+		}
+	}
+	if stickerBytes.Valid && len(stickerBytes.String) > 0 {
+		var st models.Sticker
+		if err := json.Unmarshal([]byte(stickerBytes.String), &st); err == nil {
+			msg.Sticker = &st
+		}
+	}
+	if replyBytes.Valid && len(replyBytes.String) > 0 {
+		var r models.Message
+		if err := json.Unmarshal([]byte(replyBytes.String), &r); err == nil {
+			msg.ReplyTo = &r
+		}
+	}
+	return &msg, nil
+}
+
 func (s *ChatService) SaveMessage(ctx context.Context, msg *models.Message) error {
-	// By default we store has_seen as FALSE in DB. Clients may interpret has_seen locally
-	query := `INSERT INTO messages (room, user_id, username, content, voice, has_seen, reply_to) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, has_seen, reply_to`
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return db.WithFailoverRetry(ctx, func() error {
+		return insertMessage(ctx, db.Pool, msg)
+	})
+}
+
+// queryRower is satisfied by both the pool and a pgx.Tx
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// roomMessageExpiry is when a message stored now in the room $1 expires under the room's
+// message TTL, NULL without one. Every insert into messages applies it.
+const roomMessageExpiry = `NOW() + make_interval(secs => (SELECT message_ttl FROM rooms WHERE id = $1))`
+
+// insertMessage stores msg and fills its id, created_at, has_seen and expires_at
+func insertMessage(ctx context.Context, q queryRower, msg *models.Message) error {
+	// By default we store has_seen as FALSE in DB. Clients may interpret has_seen locally.
+	// Without an id generator the id comes from the column's sequence. A reply joins the
+	// thread of its parent, which must be in the same room. In a room with a message TTL the
+	// message expires after it, unless its own expiry comes first.
+	query := `INSERT INTO messages (id, room, user_id, username, content, voice, voice_meta, has_seen, reply_to, expires_at, system, silent, file, thread_id, sticker)
+		VALUES (COALESCE($13::bigint, nextval(pg_get_serial_sequence('messages', 'id'))), $1, $2, $3, $4, $5, $6, $7, $8,
+			LEAST($9::timestamptz, ` + roomMessageExpiry + `), $10, $11, $12,
+			(SELECT COALESCE(thread_id, id) FROM messages WHERE id = $14::bigint AND room = $1), $15)
+		RETURNING id, created_at, has_seen, reply_to, thread_id, expires_at`
 
 	var replyJSON interface{}
+	var replyID interface{}
 	if msg.ReplyTo != nil {
+		replyID = msg.ReplyTo.ID
 		b, err := json.Marshal(msg.ReplyTo)
 		if err != nil {
 			return err
@@ -76,8 +181,35 @@ func (s *ChatService) SaveMessage(ctx context.Context, msg *models.Message) erro
 		replyJSON = nil
 	}
 
+	var voiceMetaJSON interface{}
+	if msg.VoiceMeta != nil {
+		b, err := json.Marshal(msg.VoiceMeta)
+		if err != nil {
+			return err
+		}
+		voiceMetaJSON = b
+	}
+
+	var fileJSON interface{}
+	if msg.File != nil {
+		b, err := json.Marshal(msg.File)
+		if err != nil {
+			return err
+		}
+		fileJSON = b
+	}
+
+	var stickerJSON interface{}
+	if msg.Sticker != nil {
+		b, err := json.Marshal(msg.Sticker)
+		if err != nil {
+			return err
+		}
+		stickerJSON = b
+	}
+
 	var replyBytes []byte
-	err := db.Pool.QueryRow(ctx, query, msg.Room, msg.UserID, msg.Username, msg.Content, msg.Voice, false, replyJSON).Scan(&msg.ID, &msg.CreatedAt, &msg.HasSeen, &replyBytes)
+	err := q.QueryRow(ctx, query, msg.Room, msg.UserID, msg.Username, msg.Content, msg.Voice, voiceMetaJSON, false, replyJSON, msg.ExpiresAt, msg.System, msg.Silent, fileJSON, nextMessageID(), replyID, stickerJSON).Scan(&msg.ID, &msg.CreatedAt, &msg.HasSeen, &replyBytes, &msg.ThreadID, &msg.ExpiresAt)
 	if err != nil {
 		return err
 	}
@@ -91,8 +223,11 @@ func (s *ChatService) SaveMessage(ctx context.Context, msg *models.Message) erro
 }
 
 func (s *ChatService) GetRecentMessages(ctx context.Context, room string, limit int) ([]models.Message, error) {
-	query := `SELECT id, room, user_id, username, content, voice, has_seen, reply_to, created_at FROM messages WHERE room = $1 ORDER BY created_at DESC LIMIT $2`
-	rows, err := db.Pool.Query(ctx, query, room, limit)
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE room = $1 AND ` + notExpired + ` ORDER BY created_at DESC LIMIT $2`
+	rows, err := db.Read(ctx).Query(ctx, query, room, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -100,18 +235,11 @@ func (s *ChatService) GetRecentMessages(ctx context.Context, room string, limit
 
 	var messages []models.Message
 	for rows.Next() {
-		var msg models.Message
-		var replyBytes sql.NullString
-		if err := rows.Scan(&msg.ID, &msg.Room, &msg.UserID, &msg.Username, &msg.Content, &msg.Voice, &msg.HasSeen, &replyBytes, &msg.CreatedAt); err != nil {
+		msg, err := scanMessage(rows)
+		if err != nil {
 			return nil, err
 		}
-		if replyBytes.Valid && len(replyBytes.String) > 0 {
-			var r models.Message
-			if err := json.Unmarshal([]byte(replyBytes.String), &r); err == nil {
-				msg.ReplyTo = &r
-			}
-		}
-		messages = append(messages, msg)
+		messages = append(messages, *msg)
 	}
 
 	// Reverse to show oldest first
@@ -124,7 +252,10 @@ func (s *ChatService) GetRecentMessages(ctx context.Context, room string, limit
 
 // GetRoomParticipants returns all user IDs that are participants of a given room
 func (s *ChatService) GetRoomParticipants(ctx context.Context, roomID string) ([]int, error) {
-	query := `SELECT user_id FROM room_participants WHERE room_id = $1`
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT user_id FROM room_participants WHERE room_id = $1 AND left_at IS NULL`
 	rows, err := db.Pool.Query(ctx, query, roomID)
 	if err != nil {
 		return nil, err
@@ -144,6 +275,9 @@ func (s *ChatService) GetRoomParticipants(ctx context.Context, roomID string) ([
 
 // GetOtherUserInRoom returns the other participant's user ID in a direct room
 func (s *ChatService) GetOtherUserInRoom(ctx context.Context, roomID string, currentUserID int) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `SELECT user_id FROM room_participants WHERE room_id = $1 AND user_id != $2 LIMIT 1`
 	var otherUserID int
 	err := db.Pool.QueryRow(ctx, query, roomID, currentUserID).Scan(&otherUserID)
@@ -153,8 +287,36 @@ func (s *ChatService) GetOtherUserInRoom(ctx context.Context, roomID string, cur
 	return otherUserID, nil
 }
 
+// GetDirectPeer returns the other participant of a direct room userID is in, or ErrNotFound
+// for other rooms
+func (s *ChatService) GetDirectPeer(ctx context.Context, roomID string, userID int) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT p.user_id FROM rooms r
+		JOIN room_participants p ON p.room_id = r.id AND p.user_id != $2 AND p.left_at IS NULL
+		WHERE r.id = $1 AND r.type = 'direct' AND EXISTS (
+			SELECT 1 FROM room_participants me WHERE me.room_id = r.id AND me.user_id = $2 AND me.left_at IS NULL
+		)
+		LIMIT 1
+	`
+	var peerID int
+	err := db.Pool.QueryRow(ctx, query, roomID, userID).Scan(&peerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return peerID, nil
+}
+
 // GetUserInfo returns lightweight profile info for a user (id, username, first/last name, photos)
 func (s *ChatService) GetUserInfo(ctx context.Context, userID int) (*models.UserInfo, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	var info models.UserInfo
 	var firstName, lastName *string
 	query := `SELECT id, username, first_name, last_name FROM users WHERE id = $1`
@@ -178,6 +340,7 @@ func (s *ChatService) GetUserInfo(ctx context.Context, userID int) (*models.User
 		if err := rows.Scan(&p.ID, &p.UserID, &p.Filename, &p.URL, &p.CreatedAt); err != nil {
 			continue
 		}
+		p.URL = PhotoURL(p.Filename) // Stored URLs may point at a retired upload namespace
 		photos = append(photos, p)
 	}
 	info.Photos = photos
@@ -186,39 +349,215 @@ func (s *ChatService) GetUserInfo(ctx context.Context, userID int) (*models.User
 
 // GetMessageByID fetches a single message by id including reply_to if present
 func (s *ChatService) GetMessageByID(ctx context.Context, id int) (*models.Message, error) {
-	query := `SELECT id, room, user_id, username, content, voice, has_seen, reply_to, created_at FROM messages WHERE id = $1`
-	var msg models.Message
-	var replyBytes sql.NullString
-	if err := db.Pool.QueryRow(ctx, query, id).Scan(&msg.ID, &msg.Room, &msg.UserID, &msg.Username, &msg.Content, &msg.Voice, &msg.HasSeen, &replyBytes, &msg.CreatedAt); err != nil {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE id = $1 AND ` + notExpired
+	return scanMessage(db.Pool.QueryRow(ctx, query, id))
+}
+
+// countsUnread is a SQL condition on messages matching rows that count toward unread totals.
+// System messages only count when the "system" event type is classified as content.
+func countsUnread() string {
+	if IsContentEvent("system") {
+		return `TRUE`
+	}
+	return `NOT system`
+}
+
+// MarkMessagesSeen sets has_seen = true for messages in a room that belong to other users
+// and were created at or before the provided time, and stamps the viewer's receipts of them
+// as seen. Returns the number of updated messages that counted toward the viewer's unread total.
+func (s *ChatService) MarkMessagesSeen(ctx context.Context, room string, viewerID int, seenBefore time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		WITH updated AS (
+			UPDATE messages SET has_seen = TRUE
+			WHERE room = $1 AND user_id != $2 AND created_at <= $3 AND has_seen = FALSE
+			RETURNING system
+		), receipts AS (
+			UPDATE message_receipts r SET seen_at = NOW()
+			FROM messages m
+			WHERE r.message_id = m.id AND r.user_id = $2 AND r.seen_at IS NULL AND m.room = $1 AND m.created_at <= $3
+		)
+		SELECT COUNT(*) FILTER (WHERE ` + countsUnread() + `) FROM updated
+	`
+	var n int64
+	if err := db.Pool.QueryRow(ctx, query, room, viewerID, seenBefore).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// SeenMark is one viewer's "seen up to" position in a room
+type SeenMark struct {
+	Room       string
+	ViewerID   int
+	SeenBefore time.Time
+}
+
+// MarkMessagesSeenBatch applies many seen marks in a single statement. Marks must be unique
+// per room and viewer. Returns the unread-counting updates per mark, in the order given.
+func (s *ChatService) MarkMessagesSeenBatch(ctx context.Context, marks []SeenMark) ([]int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rooms := make([]string, len(marks))
+	viewers := make([]int32, len(marks))
+	befores := make([]time.Time, len(marks))
+	for i, m := range marks {
+		rooms[i], viewers[i], befores[i] = m.Room, int32(m.ViewerID), m.SeenBefore
+	}
+
+	query := `
+		WITH marks AS (
+			SELECT * FROM unnest($1::text[], $2::int[], $3::timestamp[]) AS m(room, viewer_id, seen_before)
+		), updated AS (
+			UPDATE messages SET has_seen = TRUE
+			FROM marks
+			WHERE messages.room = marks.room AND messages.user_id != marks.viewer_id
+			AND messages.created_at <= marks.seen_before AND messages.has_seen = FALSE
+			RETURNING marks.room, marks.viewer_id, messages.system
+		), receipts AS (
+			UPDATE message_receipts r SET seen_at = NOW()
+			FROM marks, messages m
+			WHERE r.message_id = m.id AND r.user_id = marks.viewer_id AND r.seen_at IS NULL
+			AND m.room = marks.room AND m.created_at <= marks.seen_before
+		)
+		SELECT room, viewer_id, COUNT(*) FILTER (WHERE ` + countsUnread() + `) FROM updated GROUP BY room, viewer_id
+	`
+	rows, err := db.Pool.Query(ctx, query, rooms, viewers, befores)
+	if err != nil {
 		return nil, err
 	}
-	if replyBytes.Valid && len(replyBytes.String) > 0 {
-		var r models.Message
-		if err := json.Unmarshal([]byte(replyBytes.String), &r); err == nil {
-			msg.ReplyTo = &r
+	defer rows.Close()
+
+	index := make(map[SeenMark]int, len(marks))
+	for i, m := range marks {
+		index[SeenMark{Room: m.Room, ViewerID: m.ViewerID}] = i
+	}
+	counts := make([]int64, len(marks))
+	for rows.Next() {
+		var room string
+		var viewerID int
+		var n int64
+		if err := rows.Scan(&room, &viewerID, &n); err != nil {
+			return nil, err
+		}
+		if i, ok := index[SeenMark{Room: room, ViewerID: viewerID}]; ok {
+			counts[i] = n
 		}
 	}
-	return &msg, nil
+	return counts, rows.Err()
 }
 
-// MarkMessagesSeen sets has_seen = true for messages in a room that belong to other users
-// and were created at or before the provided time. Returns number of rows updated.
-func (s *ChatService) MarkMessagesSeen(ctx context.Context, room string, viewerID int, seenBefore time.Time) (int64, error) {
-	query := `UPDATE messages SET has_seen = TRUE WHERE room = $1 AND user_id != $2 AND created_at <= $3 AND has_seen = FALSE`
-	tag, err := db.Pool.Exec(ctx, query, room, viewerID, seenBefore)
+// MarkMessagesReadUpTo marks messages from others with an id up to each ack's UpToSeq as seen,
+// for every room in one statement. Acks must be unique per room. Returns the unread-counting
+// updates per room; rooms the viewer is not an active participant of are left out.
+func (s *ChatService) MarkMessagesReadUpTo(ctx context.Context, viewerID int, acks []models.ReadAck) (map[string]int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rooms := make([]string, len(acks))
+	upTo := make([]int64, len(acks))
+	for i, a := range acks {
+		rooms[i], upTo[i] = a.Room, int64(a.UpToSeq)
+	}
+
+	query := `
+		WITH acks AS (
+			SELECT a.room, a.up_to FROM unnest($2::text[], $3::bigint[]) AS a(room, up_to)
+			JOIN room_participants p ON p.room_id = a.room AND p.user_id = $1 AND p.left_at IS NULL
+		), updated AS (
+			UPDATE messages SET has_seen = TRUE
+			FROM acks
+			WHERE messages.room = acks.room AND messages.id <= acks.up_to
+			AND messages.user_id != $1 AND messages.has_seen = FALSE
+			RETURNING acks.room, messages.system
+		)
+		SELECT acks.room, (SELECT COUNT(*) FILTER (WHERE ` + countsUnread() + `) FROM updated WHERE updated.room = acks.room)
+		FROM acks
+	`
+	rows, err := db.Pool.Query(ctx, query, viewerID, rooms, upTo)
 	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64, len(acks))
+	for rows.Next() {
+		var room string
+		var n int64
+		if err := rows.Scan(&room, &n); err != nil {
+			return nil, err
+		}
+		counts[room] = n
+	}
+	return counts, rows.Err()
+}
+
+// MarkAllRoomsSeen marks every unseen message from others in the viewer's rooms as seen
+// in one statement and returns the number of updated messages per room.
+func (s *ChatService) MarkAllRoomsSeen(ctx context.Context, viewerID int) (map[string]int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		WITH updated AS (
+			UPDATE messages SET has_seen = TRUE
+			WHERE user_id != $1 AND has_seen = FALSE
+			AND room IN (SELECT room_id FROM room_participants WHERE user_id = $1 AND left_at IS NULL)
+			RETURNING room, system
+		)
+		SELECT room, COUNT(*) FILTER (WHERE ` + countsUnread() + `) FROM updated GROUP BY room
+	`
+	rows, err := db.Pool.Query(ctx, query, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var room string
+		var n int64
+		if err := rows.Scan(&room, &n); err != nil {
+			return nil, err
+		}
+		counts[room] = n
+	}
+	return counts, rows.Err()
+}
+
+// CountUnread returns the number of unseen messages from others across the viewer's rooms
+func (s *ChatService) CountUnread(ctx context.Context, viewerID int) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT COUNT(*) FROM messages
+		WHERE user_id != $1 AND has_seen = FALSE AND ` + notExpired + ` AND ` + countsUnread() + `
+		AND room IN (SELECT room_id FROM room_participants WHERE user_id = $1 AND left_at IS NULL)
+	`
+	var n int64
+	if err := db.Pool.QueryRow(ctx, query, viewerID).Scan(&n); err != nil {
 		return 0, err
 	}
-	return tag.RowsAffected(), nil
+	return n, nil
 }
 
 // GetUsersWithSharedRooms returns all user IDs that share at least one room with the given user
 func (s *ChatService) GetUsersWithSharedRooms(ctx context.Context, userID int) ([]int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT DISTINCT p2.user_id
 		FROM room_participants p1
-		JOIN room_participants p2 ON p1.room_id = p2.room_id AND p2.user_id != $1
-		WHERE p1.user_id = $1
+		JOIN room_participants p2 ON p1.room_id = p2.room_id AND p2.user_id != $1 AND p2.left_at IS NULL
+		WHERE p1.user_id = $1 AND p1.left_at IS NULL
 	`
 	rows, err := db.Pool.Query(ctx, query, userID)
 	if err != nil {
@@ -237,19 +576,24 @@ func (s *ChatService) GetUsersWithSharedRooms(ctx context.Context, userID int) (
 	return userIDs, nil
 }
 
-// GetUserRooms returns rooms for a user including the other participant and last message
+// GetUserRooms returns rooms for a user including the other participant and last message.
+// Named rooms (channels) are listed with their name instead of another participant.
 func (s *ChatService) GetUserRooms(ctx context.Context, userID int) ([]models.RoomListItem, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
-	SELECT r.id, u.id as other_user_id, m.content as last_message, m.voice as last_voice, m.created_at as last_created
+	SELECT r.id, r.type, r.name, p_other.user_id as other_user_id, m.content as last_message, m.voice as last_voice, m.voice_meta as last_voice_meta, m.voice_expired as last_voice_expired, m.sticker IS NOT NULL as last_sticker, m.created_at as last_created, ` + announcementColumns + `
 	FROM rooms r
-	JOIN room_participants p_me ON r.id = p_me.room_id AND p_me.user_id = $1
-	JOIN room_participants p_other ON r.id = p_other.room_id AND p_other.user_id != $1
-	JOIN users u ON u.id = p_other.user_id
-	LEFT JOIN LATERAL (SELECT content, voice, created_at FROM messages WHERE room = r.id ORDER BY created_at DESC LIMIT 1) m ON true
-	WHERE r.type = 'direct'
+	JOIN room_participants p_me ON r.id = p_me.room_id AND p_me.user_id = $1 AND p_me.left_at IS NULL
+	LEFT JOIN LATERAL (SELECT user_id FROM room_participants WHERE room_id = r.id AND user_id != $1 AND r.type = 'direct' LIMIT 1) p_other ON true
+	LEFT JOIN LATERAL (SELECT content, voice, voice_meta, voice_expired, sticker, created_at FROM messages WHERE room = r.id AND ` + notExpired + ` ORDER BY created_at DESC LIMIT 1) m ON true
+	` + announcementJoin + `
+	WHERE r.type <> 'direct' OR p_other.user_id IS NOT NULL
 	`
 
-	rows, err := db.Pool.Query(ctx, query, userID)
+	reader := db.Read(ctx)
+	rows, err := reader.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -257,24 +601,35 @@ func (s *ChatService) GetUserRooms(ctx context.Context, userID int) ([]models.Ro
 
 	var items []models.RoomListItem
 	for rows.Next() {
-		var roomID string
-		var otherUserID int
+		var roomID, roomType string
+		var roomName sql.NullString
+		var otherUserID sql.NullInt64
 		var lastMessage sql.NullString
 		var lastVoice sql.NullString
+		var lastVoiceMeta []byte
+		var lastVoiceExpired, lastSticker sql.NullBool
 		var lastCreated sql.NullTime
+		var ann announcementScan
 
-		if err := rows.Scan(&roomID, &otherUserID, &lastMessage, &lastVoice, &lastCreated); err != nil {
+		if err := rows.Scan(append([]interface{}{&roomID, &roomType, &roomName, &otherUserID, &lastMessage, &lastVoice, &lastVoiceMeta, &lastVoiceExpired, &lastSticker, &lastCreated}, ann.dest()...)...); err != nil {
 			return nil, err
 		}
 
 		item := models.RoomListItem{
-			RoomID:      roomID,
-			OtherUserID: otherUserID,
+			RoomID:       roomID,
+			Type:         roomType,
+			Announcement: ann.announcement(),
+		}
+		if roomName.Valid {
+			item.Name = &roomName.String
 		}
 
 		// Populate full other user profile (may be nil on error)
-		if info, err := s.GetUserInfo(ctx, otherUserID); err == nil {
-			item.OtherUser = info
+		if otherUserID.Valid {
+			item.OtherUserID = int(otherUserID.Int64)
+			if info, err := s.GetUserInfo(ctx, item.OtherUserID); err == nil {
+				item.OtherUser = info
+			}
 		}
 
 		// If lateral join didn't return a last message (possible race or edge case),
@@ -292,8 +647,8 @@ func (s *ChatService) GetUserRooms(ctx context.Context, userID int) ([]models.Ro
 			var content sql.NullString
 			var voice sql.NullString
 			var createdAt sql.NullTime
-			q := `SELECT content, voice, created_at FROM messages WHERE room = $1 ORDER BY created_at DESC LIMIT 1`
-			if err := db.Pool.QueryRow(ctx, q, roomID).Scan(&content, &voice, &createdAt); err == nil {
+			q := `SELECT content, voice, voice_meta, voice_expired, created_at FROM messages WHERE room = $1 AND ` + notExpired + ` ORDER BY created_at DESC LIMIT 1`
+			if err := reader.QueryRow(ctx, q, roomID).Scan(&content, &voice, &lastVoiceMeta, &lastVoiceExpired, &createdAt); err == nil {
 				if content.Valid {
 					item.LastMessage = &content.String
 				}
@@ -306,8 +661,221 @@ func (s *ChatService) GetUserRooms(ctx context.Context, userID int) ([]models.Ro
 			}
 		}
 
+		// A voice message may carry a caption in LastMessage, so the type is explicit
+		if item.LastVoice != nil {
+			item.LastMessageType = "voice"
+			item.LastVoiceMeta = compactVoiceMeta(lastVoiceMeta)
+			item.LastVoiceExpired = lastVoiceExpired.Bool
+		} else if lastSticker.Bool {
+			item.LastMessageType = "sticker"
+		} else if item.LastMessage != nil {
+			item.LastMessageType = "text"
+		}
+
 		items = append(items, item)
 	}
 
 	return items, nil
 }
+
+// roomListWaveformPeaks is how many leading waveform peaks the room list preview carries
+const roomListWaveformPeaks = 20
+
+// compactVoiceMeta decodes stored voice metadata keeping only the first waveform peaks
+func compactVoiceMeta(raw []byte) *models.VoiceMeta {
+	if len(raw) == 0 {
+		return nil
+	}
+	var meta models.VoiceMeta
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil
+	}
+	if len(meta.Waveform) > roomListWaveformPeaks {
+		meta.Waveform = meta.Waveform[:roomListWaveformPeaks]
+	}
+	return &meta
+}
+
+// IsRoomParticipant reports whether the user is a participant of the given room
+func (s *ChatService) IsRoomParticipant(ctx context.Context, roomID string, userID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM room_participants WHERE room_id = $1 AND user_id = $2 AND left_at IS NULL)`
+	if err := db.Pool.QueryRow(ctx, query, roomID, userID).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// CanAccessRoom reports whether the user may read and post in a room: channels are open to
+// everyone, other rooms to their participants
+func (s *ChatService) CanAccessRoom(ctx context.Context, roomID string, userID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var ok bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM rooms r WHERE r.id = $1 AND (r.type = 'channel' OR EXISTS (
+				SELECT 1 FROM room_participants p WHERE p.room_id = r.id AND p.user_id = $2 AND p.left_at IS NULL
+			))
+		)
+	`
+	if err := db.Pool.QueryRow(ctx, query, roomID, userID).Scan(&ok); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// SearchMessages returns messages in a room matching all of the provided filters, newest first
+func (s *ChatService) SearchMessages(ctx context.Context, f models.MessageSearchFilter) ([]models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	conds := []string{"room = $1", notExpired}
+	args := []interface{}{f.Room}
+
+	addArg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if f.Query != "" {
+		// Escape LIKE wildcards so the query is matched literally
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(f.Query)
+		conds = append(conds, "content ILIKE '%' || "+addArg(escaped)+" || '%'")
+	}
+	if f.FromUserID != 0 {
+		conds = append(conds, "user_id = "+addArg(f.FromUserID))
+	} else if f.FromUser != "" {
+		conds = append(conds, "username = "+addArg(f.FromUser))
+	}
+	switch f.Has {
+	case "voice":
+		conds = append(conds, "voice IS NOT NULL AND voice != ''")
+	case "image":
+		// messages.file copies the attachment's metadata, see the files table
+		conds = append(conds, `file->>'content_type' LIKE 'image/%'`)
+	case "link":
+		conds = append(conds, `content ~* 'https?://[^\s]+'`)
+	}
+	if f.Before != nil {
+		conds = append(conds, "created_at < "+addArg(*f.Before))
+	}
+	if f.After != nil {
+		conds = append(conds, "created_at > "+addArg(*f.After))
+	}
+
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE ` +
+		strings.Join(conds, " AND ") + ` ORDER BY created_at DESC LIMIT ` + addArg(f.Limit)
+
+	rows, err := db.Read(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+	return messages, rows.Err()
+}
+
+// DeleteExpiredMessages removes messages whose TTL has elapsed and deletes their voice files
+// and attachments. Messages under legal hold are kept. The deleted rows (id, room, voice) are returned so
+// callers can notify connected clients.
+func (s *ChatService) DeleteExpiredMessages(ctx context.Context) ([]models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `DELETE FROM messages WHERE expires_at IS NOT NULL AND expires_at <= NOW() AND ` + notHeld + ` RETURNING id, room, voice, file`
+	return s.deleteMessages(ctx, query)
+}
+
+// PurgeRetainedMessages deletes messages older than their room's retention period.
+// rooms.retention_days overrides defaultDays; a value of 0 (either way) keeps messages forever.
+// Rooms and users under legal hold are exempt.
+func (s *ChatService) PurgeRetainedMessages(ctx context.Context, defaultDays int) ([]models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `DELETE FROM messages USING rooms r
+		WHERE r.id = messages.room
+		AND COALESCE(r.retention_days, $1) > 0
+		AND messages.created_at < NOW() - make_interval(days => COALESCE(r.retention_days, $1))
+		AND ` + notHeld + `
+		RETURNING messages.id, messages.room, messages.voice, messages.file`
+	return s.deleteMessages(ctx, query, defaultDays)
+}
+
+// deleteMessages runs a DELETE ... RETURNING id, room, voice, file and removes the media files
+func (s *ChatService) deleteMessages(ctx context.Context, query string, args ...interface{}) ([]models.Message, error) {
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := scanDeletedMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	removeMessageMedia(ctx, deleted)
+	return deleted, nil
+}
+
+// scanDeletedMessages collects the rows of a DELETE ... RETURNING id, room, voice, file
+func scanDeletedMessages(rows pgx.Rows) ([]models.Message, error) {
+	defer rows.Close()
+	var deleted []models.Message
+	for rows.Next() {
+		var msg models.Message
+		if err := rows.Scan(&msg.ID, &msg.Room, &msg.Voice, &msg.File); err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, msg)
+	}
+	return deleted, rows.Err()
+}
+
+// removeMessageMedia deletes the voice files and attachments of deleted messages; it is
+// best-effort since the rows are already gone
+func removeMessageMedia(ctx context.Context, deleted []models.Message) {
+	for _, msg := range deleted {
+		if msg.Voice != nil && *msg.Voice != "" {
+			DeleteUpload(ctx, "voices/"+filepath.Base(*msg.Voice))
+		}
+		removeAttachment(ctx, msg.File)
+	}
+}
+
+// GetNotificationPrefs returns notification preferences for the given users
+func (s *ChatService) GetNotificationPrefs(ctx context.Context, userIDs []int) (map[int]models.NotificationPrefs, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	prefs := make(map[int]models.NotificationPrefs, len(userIDs))
+	if len(userIDs) == 0 {
+		return prefs, nil
+	}
+	rows, err := db.Pool.Query(ctx, `SELECT id, language, message_preview, notification_matrix FROM users WHERE id = ANY($1)`, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var p models.NotificationPrefs
+		if err := rows.Scan(&id, &p.Language, &p.MessagePreview, &p.Matrix); err != nil {
+			return nil, err
+		}
+		prefs[id] = p
+	}
+	return prefs, rows.Err()
+}
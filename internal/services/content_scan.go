@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+)
+
+// ErrEmptyScan is returned for a content scan without any criterion
+var ErrEmptyScan = errors.New("keyword, sha256 or user_id is required")
+
+// ScanContent finds live messages from the last f.Since matching every criterion of f,
+// newest first. Hash matches cover voice recordings and attachments published since upload
+// hashes were recorded.
+func (s *AdminService) ScanContent(ctx context.Context, f models.ContentScanFilter) ([]models.ContentScanMatch, error) {
+	if f.Keyword == "" && f.SHA256 == "" && f.UserID == 0 {
+		return nil, ErrEmptyScan
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	conds := []string{"m.deleted_at IS NULL", "NOT m.system", "m.created_at > NOW() - make_interval(secs => $1)"}
+	args := []interface{}{f.Since.Seconds()}
+	addArg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if f.Keyword != "" {
+		// Escape LIKE wildcards so the keyword is matched literally
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(f.Keyword)
+		conds = append(conds, "m.content ILIKE '%' || "+addArg(escaped)+" || '%'")
+	}
+	if f.SHA256 != "" {
+		conds = append(conds, "h.sha256 = "+addArg(strings.ToLower(f.SHA256)))
+	}
+	if f.UserID != 0 {
+		conds = append(conds, "m.user_id = "+addArg(f.UserID))
+	}
+
+	query := `SELECT m.id, m.room, m.user_id, m.username, m.content, m.voice, m.file, h.sha256, m.created_at
+		FROM messages m
+		LEFT JOIN upload_hashes h ON h.key = CASE
+			WHEN m.voice IS NOT NULL AND m.voice <> '' THEN 'voices/' || m.voice
+			WHEN m.file IS NOT NULL THEN 'files/' || (m.file->>'filename') END
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY m.created_at DESC LIMIT ` + addArg(f.Limit)
+
+	rows, err := db.Read(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []models.ContentScanMatch{}
+	for rows.Next() {
+		var m models.ContentScanMatch
+		var file []byte
+		if err := rows.Scan(&m.MessageID, &m.Room, &m.UserID, &m.Username, &m.Text, &m.Voice, &file, &m.SHA256, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(file) > 0 {
+			var mf models.MessageFile
+			if err := json.Unmarshal(file, &mf); err == nil {
+				m.File = &mf
+			}
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// TakedownMessages deletes each message like ModerateDeleteMessage, with its own audit entry
+// carrying details. Messages that can't be deleted (missing, already deleted, under legal
+// hold) are reported per item and don't stop the rest.
+func (s *AdminService) TakedownMessages(ctx context.Context, adminID int, messageIDs []int, details interface{}) ([]models.TakedownResult, []*models.Message) {
+	results := make([]models.TakedownResult, 0, len(messageIDs))
+	var deleted []*models.Message
+	for _, id := range messageIDs {
+		result := models.TakedownResult{MessageID: id}
+		msg, err := s.ModerateDeleteMessage(ctx, adminID, id, details)
+		switch {
+		case err == nil:
+			result.Room = msg.Room
+			deleted = append(deleted, msg)
+		case errors.Is(err, ErrNotFound), errors.Is(err, ErrMessageDeleted), errors.Is(err, ErrLegalHold):
+			result.Error = err.Error()
+		default:
+			result.Error = "failed to delete message"
+		}
+		results = append(results, result)
+	}
+	return results, deleted
+}
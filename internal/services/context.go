@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// queryTimeout bounds every service call that touches the database.
+// It is applied on top of the caller's context, so request cancellation still wins.
+var queryTimeout = 5 * time.Second
+
+// SetQueryTimeout overrides the default per-query timeout. Non-positive values disable it.
+func SetQueryTimeout(d time.Duration) {
+	queryTimeout = d
+}
+
+// withTimeout derives a context bounded by the configured query timeout
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, queryTimeout)
+}
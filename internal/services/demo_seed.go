@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+)
+
+// DemoUserPrefix starts the username of every demo account
+const DemoUserPrefix = "demo_"
+
+// ErrDemoSeeded is returned when the demo accounts already exist
+var ErrDemoSeeded = errors.New("demo data is already seeded")
+
+var demoPeople = []struct{ first, last string }{
+	{"Alice", "Archer"}, {"Bob", "Baker"}, {"Carol", "Chen"}, {"Dave", "Diaz"},
+	{"Erin", "Evans"}, {"Frank", "Fischer"}, {"Grace", "Garcia"}, {"Heidi", "Hansen"},
+	{"Ivan", "Ivanov"}, {"Judy", "Jones"}, {"Karim", "Khan"}, {"Lena", "Larsen"},
+}
+
+var demoTexts = []string{
+	"Hey! How's it going?",
+	"Did you see the new designs?",
+	"Running a bit late, be there in 10",
+	"Sounds good to me 👍",
+	"Can you review my PR when you get a chance?",
+	"Lunch at noon?",
+	"The build is green again 🎉",
+	"I'll send the notes after the call",
+	"Which room are we meeting in?",
+	"Thanks, that fixed it!",
+	"Let's move this to tomorrow",
+	"Has anyone tried the new coffee place?",
+	"Deploying to staging now",
+	"Works on my machine 🤷",
+	"Good morning everyone ☀️",
+	"Can we keep this thread for the release checklist?",
+}
+
+// MaxDemoUsers is how many distinct demo accounts SeedDemo can create
+var MaxDemoUsers = len(demoPeople)
+
+// SeedDemo creates demo users with generated profile photos, a direct room between the first
+// user and each other one, a group room with everyone and a conversation in every room, with
+// voice messages and replies mixed in
+func SeedDemo(ctx context.Context, opts models.DemoSeedOptions) (*models.DemoSeedResult, error) {
+	if opts.Users < 2 || opts.Users > MaxDemoUsers {
+		return nil, fmt.Errorf("users must be between 2 and %d", MaxDemoUsers)
+	}
+	if opts.MessagesPerRoom < 0 {
+		return nil, errors.New("messages per room can't be negative")
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	users := NewUserService()
+	chat := NewChatService()
+	result := &models.DemoSeedResult{}
+
+	ids := make([]int, 0, opts.Users)
+	names := make(map[int]string, opts.Users)
+	for i, p := range demoPeople[:opts.Users] {
+		username := DemoUserPrefix + strings.ToLower(p.first)
+		u, err := users.Register(ctx, models.RegisterRequest{Username: username, Password: opts.Password})
+		if errors.Is(err, ErrUserExists) && i == 0 {
+			return nil, ErrDemoSeeded
+		}
+		if err != nil {
+			return result, fmt.Errorf("create %s: %w", username, err)
+		}
+		first, last := p.first, p.last
+		if _, err := users.UpdateProfile(ctx, u.ID, &first, &last); err != nil {
+			return result, err
+		}
+		if err := seedDemoPhoto(ctx, users, u.ID, i); err != nil {
+			return result, fmt.Errorf("photo of %s: %w", username, err)
+		}
+		ids = append(ids, u.ID)
+		names[u.ID] = username
+		result.Users = append(result.Users, username)
+		result.Photos++
+	}
+
+	type demoRoom struct {
+		id      string
+		members []int
+	}
+	var rooms []demoRoom
+	for _, other := range ids[1:] {
+		room, err := chat.GetOrCreateDirectRoom(ctx, ids[0], other)
+		if err != nil {
+			return result, err
+		}
+		rooms = append(rooms, demoRoom{room.RoomID, []int{ids[0], other}})
+	}
+	group, _, err := chat.CreateGroupRoom(ctx, ids[0], "Demo team", ids[1:], 0)
+	if err != nil {
+		return result, err
+	}
+	rooms = append(rooms, demoRoom{group.ID, ids})
+
+	for _, room := range rooms {
+		result.Rooms = append(result.Rooms, room.id)
+		var previous *models.Message
+		for n := 0; n < opts.MessagesPerRoom; n++ {
+			sender := room.members[rng.Intn(len(room.members))]
+			msg := &models.Message{Room: room.id, UserID: sender, Username: names[sender]}
+			// Every so often answer the previous message
+			if previous != nil && rng.Intn(5) == 0 {
+				quoted := *previous
+				msg.ReplyTo = &quoted
+			}
+			if rng.Intn(6) == 0 {
+				if err := seedDemoVoice(ctx, chat, msg, rng); err != nil {
+					return result, err
+				}
+				result.Voices++
+			} else {
+				text := demoTexts[rng.Intn(len(demoTexts))]
+				msg.Content = &text
+				if err := chat.SaveMessage(ctx, msg); err != nil {
+					return result, err
+				}
+			}
+			result.Messages++
+			previous = msg
+		}
+	}
+	return result, nil
+}
+
+// seedDemoVoice saves msg as a voice message with a generated recording of a few tones
+func seedDemoVoice(ctx context.Context, chat *ChatService, msg *models.Message, rng *rand.Rand) error {
+	const sampleRate = 16000
+	var samples []int16
+	for notes := 2 + rng.Intn(5); notes > 0; notes-- {
+		freq := 220 * math.Pow(2, float64(rng.Intn(24))/12)
+		length := sampleRate * (200 + rng.Intn(400)) / 1000
+		for i := 0; i < length; i++ {
+			// Fade each note in and out so it doesn't click
+			envelope := math.Sin(math.Pi * float64(i) / float64(length))
+			samples = append(samples, int16(12000*envelope*math.Sin(2*math.Pi*freq*float64(i)/sampleRate)))
+		}
+	}
+
+	filename := fmt.Sprintf("voice_%d_%d.wav", msg.UserID, time.Now().UnixNano())
+	upload, err := NewTempUpload("voices/" + filename)
+	if err != nil {
+		return err
+	}
+	defer upload.Discard()
+	upload.ContentType = "audio/wav"
+	if err := utils.WriteWAV(upload.f, sampleRate, samples); err != nil {
+		return err
+	}
+	if err := upload.Close(); err != nil {
+		return err
+	}
+	if duration, peaks, err := utils.AnalyzeWAV(upload.Path(), 48); err == nil {
+		msg.VoiceMeta = &models.VoiceMeta{DurationMs: duration, Waveform: peaks}
+	}
+	msg.Voice = &filename
+	if err := chat.SaveMessage(ctx, msg); err != nil {
+		return err
+	}
+	return upload.Publish(ctx)
+}
+
+// seedDemoPhoto adds a generated avatar: a diagonal gradient in a hue picked by index
+func seedDemoPhoto(ctx context.Context, users *UserService, userID, index int) error {
+	const size = 256
+	hue := float64(index) * 360 / float64(MaxDemoUsers)
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			light := 0.35 + 0.4*float64(x+y)/(2*size)
+			img.Set(x, y, hslColor(hue, 0.6, light))
+		}
+	}
+
+	filename := fmt.Sprintf("%d_%d.png", userID, time.Now().UnixNano())
+	upload, err := NewTempUpload(filename)
+	if err != nil {
+		return err
+	}
+	defer upload.Discard()
+	upload.ContentType = "image/png"
+	if err := png.Encode(upload.f, img); err != nil {
+		return err
+	}
+	if err := upload.Close(); err != nil {
+		return err
+	}
+	if _, err := users.AddPhoto(ctx, userID, filename, PhotoURL(filename)); err != nil {
+		return err
+	}
+	return upload.Publish(ctx)
+}
+
+// hslColor converts hue (degrees), saturation and lightness (0-1) to RGB
+func hslColor(h, s, l float64) color.RGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g = c, x
+	case h < 120:
+		r, g = x, c
+	case h < 180:
+		g, b = c, x
+	case h < 240:
+		g, b = x, c
+	case h < 300:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	return color.RGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), 255}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrDeviceRevoked is returned when a refresh token belongs to a revoked or unknown device
+var ErrDeviceRevoked = errors.New("device has been revoked")
+
+// deviceFingerprint hashes the client-provided device id with the user agent.
+// IP is deliberately left out since it changes between networks.
+func deviceFingerprint(info models.DeviceInfo) string {
+	sum := sha256.Sum256([]byte(info.DeviceID + "|" + info.UserAgent))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// recordDevice upserts the login device and reports whether to alert the user about it: a
+// device that is new for a user who already had other devices (the very first login is not
+// treated as suspicious), or one they revoked. Logging in again from a revoked device
+// reactivates it with a new revoke token, so the alert's link works again.
+func (s *UserService) recordDevice(ctx context.Context, userID int, info models.DeviceInfo) (*models.Device, bool, error) {
+	revokeToken, err := randomToken()
+	if err != nil {
+		return nil, false, err
+	}
+
+	fingerprint := deviceFingerprint(info)
+	var hadDevices, wasRevoked bool
+	err = db.Pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM user_devices WHERE user_id = $1),
+		EXISTS (SELECT 1 FROM user_devices WHERE user_id = $1 AND fingerprint = $2 AND revoked_at IS NOT NULL)`,
+		userID, fingerprint).Scan(&hadDevices, &wasRevoked)
+	if err != nil {
+		return nil, false, err
+	}
+
+	query := `INSERT INTO user_devices (id, user_id, fingerprint, user_agent, ip, revoke_token)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, fingerprint) DO UPDATE
+		SET last_seen_at = NOW(), ip = EXCLUDED.ip, revoked_at = NULL,
+			revoke_token = CASE WHEN user_devices.revoked_at IS NULL THEN user_devices.revoke_token ELSE EXCLUDED.revoke_token END
+		RETURNING id, user_agent, ip, revoke_token, first_seen_at, last_seen_at, (xmax = 0) AS inserted`
+	var d models.Device
+	var inserted bool
+	err = db.Pool.QueryRow(ctx, query, uuid.New().String(), userID, fingerprint, info.UserAgent, info.IP, revokeToken).
+		Scan(&d.ID, &d.UserAgent, &d.IP, &d.RevokeToken, &d.FirstSeenAt, &d.LastSeenAt, &inserted)
+	if err != nil {
+		return nil, false, err
+	}
+	return &d, (inserted && hadDevices) || wasRevoked, nil
+}
+
+// TouchDevice verifies a refresh token's device is still active and bumps last_seen_at
+func (s *UserService) TouchDevice(ctx context.Context, userID int, deviceID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE user_devices SET last_seen_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, deviceID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeviceRevoked
+	}
+	return nil
+}
+
+// ListDevices returns the user's devices, most recently used first
+func (s *UserService) ListDevices(ctx context.Context, userID int) ([]models.Device, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT id, user_agent, ip, first_seen_at, last_seen_at, revoked_at FROM user_devices WHERE user_id = $1 ORDER BY last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []models.Device{}
+	for rows.Next() {
+		var d models.Device
+		if err := rows.Scan(&d.ID, &d.UserAgent, &d.IP, &d.FirstSeenAt, &d.LastSeenAt, &d.RevokedAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// RevokeDevice revokes one of the user's devices
+func (s *UserService) RevokeDevice(ctx context.Context, userID int, deviceID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE user_devices SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, deviceID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeDeviceByToken handles the one-click revoke link and returns the owning user id
+func (s *UserService) RevokeDeviceByToken(ctx context.Context, token string) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var userID int
+	err := db.Pool.QueryRow(ctx, `UPDATE user_devices SET revoked_at = COALESCE(revoked_at, NOW()) WHERE revoke_token = $1 RETURNING user_id`, token).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return userID, err
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"chat-backend/internal/utils"
+)
+
+// ErrEgressDenied is returned for outbound requests to destinations the egress policy forbids
+var ErrEgressDenied = errors.New("outbound destination not allowed")
+
+// EgressPolicy controls where outbound HTTP calls may go:
+//
+//	EGRESS_PROXY_URL      route every call through this proxy
+//	EGRESS_ALLOWED_HOSTS  comma-separated hosts, "*.example.com" matches subdomains; empty allows any host
+//	EGRESS_ALLOW_PRIVATE  allow private, loopback and link-local addresses (default false)
+//
+// Without a proxy, hosts are resolved once and the checked address is dialed directly, so a
+// DNS answer can't change between the check and the connection (DNS rebinding).
+type EgressPolicy struct {
+	Proxy        *url.URL
+	AllowedHosts []string
+	AllowPrivate bool
+}
+
+var (
+	egressOnce   sync.Once
+	egressPolicy EgressPolicy
+	egressErr    error
+)
+
+// LoadEgressPolicy reads the policy from the environment; later calls return the first result
+func LoadEgressPolicy() (EgressPolicy, error) {
+	egressOnce.Do(func() {
+		if raw := utils.GetEnv("EGRESS_PROXY_URL", ""); raw != "" {
+			egressPolicy.Proxy, egressErr = url.Parse(raw)
+			if egressErr == nil && egressPolicy.Proxy.Host == "" {
+				egressErr = fmt.Errorf("EGRESS_PROXY_URL %q has no host", raw)
+			}
+		}
+		for _, h := range strings.Split(utils.GetEnv("EGRESS_ALLOWED_HOSTS", ""), ",") {
+			if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+				egressPolicy.AllowedHosts = append(egressPolicy.AllowedHosts, h)
+			}
+		}
+		egressPolicy.AllowPrivate = utils.GetEnv("EGRESS_ALLOW_PRIVATE", "false") == "true"
+	})
+	return egressPolicy, egressErr
+}
+
+// HostAllowed reports whether the allowlist permits host
+func (p EgressPolicy) HostAllowed(host string) bool {
+	if len(p.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range p.AllowedHosts {
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAllowed rejects internal addresses unless AllowPrivate is set
+func (p EgressPolicy) ipAllowed(ip net.IP) bool {
+	if p.AllowPrivate {
+		return true
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast())
+}
+
+// dialContext resolves addr, checks every candidate address and dials the first allowed one
+func (p EgressPolicy) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error = fmt.Errorf("%w: %s resolves only to internal addresses", ErrEgressDenied, host)
+		for _, ip := range ips {
+			if !p.ipAllowed(ip) {
+				continue
+			}
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// egressTransport enforces the host allowlist before handing requests to the transport
+type egressTransport struct {
+	policy EgressPolicy
+	next   http.RoundTripper
+}
+
+func (t egressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.policy.HostAllowed(req.URL.Hostname()) {
+		return nil, fmt.Errorf("%w: %s", ErrEgressDenied, req.URL.Hostname())
+	}
+	return t.next.RoundTrip(req)
+}
+
+// NewEgressClient returns an HTTP client for outbound calls (translation, error export,
+// media import, push, webhooks, link previews, ...) that applies the egress policy.
+// Every integration must build its client here rather than use http.DefaultClient.
+func NewEgressClient(timeout time.Duration) *http.Client {
+	policy, err := LoadEgressPolicy()
+	if err != nil {
+		// Validated at startup; fail closed if it was somehow skipped
+		policy = EgressPolicy{AllowedHosts: []string{"invalid."}}
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if policy.Proxy != nil {
+		// Only the proxy is dialed; it is trusted to enforce network-level policy
+		transport.Proxy = http.ProxyURL(policy.Proxy)
+		transport.DialContext = dialer.DialContext
+	} else {
+		transport.Proxy = nil
+		transport.DialContext = policy.dialContext(dialer)
+	}
+	// Redirects go through the transport again, so they are checked like any other request
+	return &http.Client{Timeout: timeout, Transport: egressTransport{policy: policy, next: transport}}
+}
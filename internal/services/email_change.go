@@ -0,0 +1,338 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrInvalidPassword    = errors.New("invalid password")
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrEmailInUse         = errors.New("email address is already in use")
+	ErrEmailChangeExpired = errors.New("email change link has expired or was superseded")
+)
+
+// Email change token sides. Confirmation needs both "old" and "new"; "rollback" undoes an
+// applied change during the grace period.
+const (
+	EmailTokenOld      = "old"
+	EmailTokenNew      = "new"
+	EmailTokenRollback = "rollback"
+)
+
+const emailChangeColumns = `id, user_id, old_email, new_email, old_confirmed_at, new_confirmed_at, applied_at, rolled_back_at, expires_at, created_at`
+
+func scanEmailChange(row rowScanner) (*models.EmailChange, error) {
+	var ch models.EmailChange
+	err := row.Scan(&ch.ID, &ch.UserID, &ch.OldEmail, &ch.NewEmail, &ch.OldConfirmedAt, &ch.NewConfirmedAt, &ch.AppliedAt, &ch.RolledBackAt, &ch.ExpiresAt, &ch.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// emailChangeSecret is derived from JWT_SECRET so these tokens can't be used elsewhere
+func emailChangeSecret() []byte {
+	return []byte(utils.GetEnv("JWT_SECRET", "secret") + ":email_change")
+}
+
+// EmailChangeToken signs a link token for one side of an email change
+func EmailChangeToken(changeID, side string, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"cid":  changeID,
+		"side": side,
+		"exp":  expiresAt.Unix(),
+		"typ":  "email_change",
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(emailChangeSecret())
+}
+
+// parseEmailChangeToken returns the change id and side of a valid token
+func parseEmailChangeToken(tokenString string) (string, string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return emailChangeSecret(), nil
+	})
+	if err != nil {
+		return "", "", ErrEmailChangeExpired
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", "", ErrEmailChangeExpired
+	}
+	if typ, _ := claims["typ"].(string); typ != "email_change" {
+		return "", "", errors.New("invalid token type")
+	}
+	cid, _ := claims["cid"].(string)
+	side, _ := claims["side"].(string)
+	if cid == "" || side == "" {
+		return "", "", errors.New("invalid token claims")
+	}
+	return cid, side, nil
+}
+
+// EmailChangeRollbackWindow is how long the old address can undo an applied change
+func EmailChangeRollbackWindow() time.Duration {
+	return utils.GetEnvDuration("EMAIL_CHANGE_ROLLBACK_WINDOW", 72*time.Hour)
+}
+
+// checkPassword verifies the user's current password
+func (s *UserService) checkPassword(ctx context.Context, userID int, password string) error {
+	var hash string
+	if err := db.Pool.QueryRow(ctx, `SELECT password_hash FROM users WHERE id = $1`, userID).Scan(&hash); err != nil {
+		return err
+	}
+	if ok, _ := VerifyPassword(hash, password); !ok {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// setUserEmail gives the user email unless another account took it since the change was
+// requested, which is ErrEmailInUse
+func setUserEmail(ctx context.Context, tx pgx.Tx, userID int, email string) error {
+	tag, err := tx.Exec(ctx, `UPDATE users SET email = $1
+		WHERE id = $2 AND NOT EXISTS (SELECT 1 FROM users o WHERE LOWER(o.email) = LOWER($1) AND o.id <> $2)`, email, userID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrEmailInUse
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEmailInUse
+	}
+	return nil
+}
+
+// recordEmailAudit appends an entry to the email change audit log
+func recordEmailAudit(ctx context.Context, tx pgx.Tx, ch *models.EmailChange, action, ip string) error {
+	_, err := tx.Exec(ctx, `INSERT INTO email_change_audit (user_id, change_id, action, old_email, new_email, ip) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))`,
+		ch.UserID, ch.ID, action, ch.OldEmail, ch.NewEmail, ip)
+	return err
+}
+
+// RequestEmailChange starts a change to newEmail after checking the password. Earlier
+// pending changes are cancelled. When the user has no email yet only the new address confirms.
+func (s *UserService) RequestEmailChange(ctx context.Context, userID int, req models.EmailChangeRequest, ip string) (*models.EmailChange, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	addr, err := mail.ParseAddress(strings.TrimSpace(req.NewEmail))
+	if err != nil || addr.Address != strings.TrimSpace(req.NewEmail) {
+		return nil, ErrInvalidEmail
+	}
+	newEmail := addr.Address
+
+	if err := s.checkPassword(ctx, userID, req.Password); err != nil {
+		return nil, err
+	}
+
+	var inUse bool
+	if err := db.Pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))`, newEmail).Scan(&inUse); err != nil {
+		return nil, err
+	}
+	if inUse {
+		return nil, ErrEmailInUse
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		UPDATE email_changes SET cancelled_at = NOW()
+		WHERE user_id = $1 AND applied_at IS NULL AND cancelled_at IS NULL
+		RETURNING `+emailChangeColumns, userID)
+	if err != nil {
+		return nil, err
+	}
+	var superseded []*models.EmailChange
+	for rows.Next() {
+		ch, err := scanEmailChange(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		superseded = append(superseded, ch)
+	}
+	rows.Close()
+	for _, ch := range superseded {
+		if err := recordEmailAudit(ctx, tx, ch, "cancelled", ip); err != nil {
+			return nil, err
+		}
+	}
+
+	ttl := utils.GetEnvDuration("EMAIL_CHANGE_TOKEN_TTL", 24*time.Hour)
+	ch, err := scanEmailChange(tx.QueryRow(ctx, `
+		INSERT INTO email_changes (id, user_id, old_email, new_email, old_confirmed_at, expires_at)
+		SELECT $1, id, email, $2, CASE WHEN email IS NULL OR email = '' THEN NOW() END, $3
+		FROM users WHERE id = $4
+		RETURNING `+emailChangeColumns, uuid.New().String(), newEmail, time.Now().Add(ttl), userID))
+	if err != nil {
+		return nil, err
+	}
+	if err := recordEmailAudit(ctx, tx, ch, "requested", ip); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// ConfirmEmailChange records the confirmation of one address. Once both sides have confirmed
+// the new email is applied; the returned change then has AppliedAt set. If another account
+// took the new address in the meantime nothing is recorded and ErrEmailInUse is returned.
+func (s *UserService) ConfirmEmailChange(ctx context.Context, token, ip string) (*models.EmailChange, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	changeID, side, err := parseEmailChangeToken(token)
+	if err != nil {
+		return nil, err
+	}
+	column := ""
+	switch side {
+	case EmailTokenOld:
+		column = "old_confirmed_at"
+	case EmailTokenNew:
+		column = "new_confirmed_at"
+	default:
+		return nil, errors.New("invalid token")
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	ch, err := scanEmailChange(tx.QueryRow(ctx, `
+		UPDATE email_changes SET `+column+` = COALESCE(`+column+`, NOW())
+		WHERE id = $1 AND applied_at IS NULL AND cancelled_at IS NULL AND expires_at > NOW()
+		RETURNING `+emailChangeColumns, changeID))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrEmailChangeExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := recordEmailAudit(ctx, tx, ch, "confirmed_"+side, ip); err != nil {
+		return nil, err
+	}
+
+	if ch.OldConfirmedAt != nil && ch.NewConfirmedAt != nil {
+		if err := setUserEmail(ctx, tx, ch.UserID, ch.NewEmail); err != nil {
+			return nil, err
+		}
+		if err := tx.QueryRow(ctx, `UPDATE email_changes SET applied_at = NOW() WHERE id = $1 RETURNING applied_at`, ch.ID).Scan(&ch.AppliedAt); err != nil {
+			return nil, err
+		}
+		if err := recordEmailAudit(ctx, tx, ch, "applied", ip); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.QueryRow(ctx, `SELECT username FROM users WHERE id = $1`, ch.UserID).Scan(&ch.Username); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// RollbackEmailChange restores the old address of an applied change within the grace period.
+// It only applies if the account still uses the address that change set.
+func (s *UserService) RollbackEmailChange(ctx context.Context, token, ip string) (*models.EmailChange, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	changeID, side, err := parseEmailChangeToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if side != EmailTokenRollback {
+		return nil, errors.New("invalid token")
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	ch, err := scanEmailChange(tx.QueryRow(ctx, `
+		UPDATE email_changes SET rolled_back_at = NOW()
+		WHERE id = $1 AND applied_at IS NOT NULL AND rolled_back_at IS NULL AND applied_at > $2
+		RETURNING `+emailChangeColumns, changeID, time.Now().Add(-EmailChangeRollbackWindow())))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrEmailChangeExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := tx.Exec(ctx, `UPDATE users SET email = $1 WHERE id = $2 AND email = $3`, ch.OldEmail, ch.UserID, ch.NewEmail)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrEmailInUse
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrEmailChangeExpired
+	}
+	if err := recordEmailAudit(ctx, tx, ch, "rolled_back", ip); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// ListEmailChangeAudit returns the user's email change history, newest first
+func (s *UserService) ListEmailChangeAudit(ctx context.Context, userID int) ([]models.EmailChangeAuditEntry, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT id, change_id, action, old_email, new_email, ip, created_at FROM email_change_audit WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT 100`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.EmailChangeAuditEntry{}
+	for rows.Next() {
+		var e models.EmailChangeAuditEntry
+		if err := rows.Scan(&e.ID, &e.ChangeID, &e.Action, &e.OldEmail, &e.NewEmail, &e.IP, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"chat-backend/internal/models"
+)
+
+// ErrorExporter forwards error events to an external tracker
+type ErrorExporter interface {
+	Export(ev models.ErrorEvent, fingerprint string)
+}
+
+// volatileTokens matches the parts of error messages that differ between occurrences of the
+// same error (ids, numbers, uuids) so they don't split groups
+var volatileTokens = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F-]{27}|\d+`)
+
+// ErrorReporter groups captured errors by fingerprint, keeps the most recent groups in memory
+// and exports the first event of a group, then at most once per exportEvery
+type ErrorReporter struct {
+	mu          sync.Mutex
+	groups      map[string]*models.ErrorGroup
+	exported    map[string]time.Time
+	maxGroups   int
+	exportEvery time.Duration
+	exporter    ErrorExporter
+}
+
+// NewErrorReporter creates a reporter; exporter may be nil
+func NewErrorReporter(maxGroups int, exportEvery time.Duration, exporter ErrorExporter) *ErrorReporter {
+	if maxGroups <= 0 {
+		maxGroups = 200
+	}
+	return &ErrorReporter{
+		groups:      make(map[string]*models.ErrorGroup),
+		exported:    make(map[string]time.Time),
+		maxGroups:   maxGroups,
+		exportEvery: exportEvery,
+		exporter:    exporter,
+	}
+}
+
+// Fingerprint identifies an error independently of volatile details: kind, route, the
+// normalized message and, for panics, the frame that panicked
+func Fingerprint(ev models.ErrorEvent) string {
+	parts := []string{ev.Kind, ev.Method, ev.Route, volatileTokens.ReplaceAllString(ev.Message, "N")}
+	if ev.Kind == "panic" {
+		parts = append(parts, panicFrame(ev.Stack))
+	}
+	sum := sha1.Sum([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// panicFrame returns the first function in a debug.Stack trace below the runtime's panic machinery
+func panicFrame(stack string) string {
+	lines := strings.Split(stack, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "panic(") && i+2 < len(lines) {
+			return strings.TrimSpace(lines[i+2])
+		}
+	}
+	return ""
+}
+
+// Report records an event and exports it unless its group was exported recently
+func (r *ErrorReporter) Report(ev models.ErrorEvent) {
+	fp := Fingerprint(ev)
+
+	r.mu.Lock()
+	g, ok := r.groups[fp]
+	if !ok {
+		if len(r.groups) >= r.maxGroups {
+			r.evictOldestLocked()
+		}
+		g = &models.ErrorGroup{Fingerprint: fp, FirstSeen: ev.Timestamp}
+		r.groups[fp] = g
+	}
+	g.Count++
+	g.LastSeen = ev.Timestamp
+	g.Last = ev
+	export := r.exporter != nil && ev.Timestamp.Sub(r.exported[fp]) >= r.exportEvery
+	if export {
+		r.exported[fp] = ev.Timestamp
+	}
+	r.mu.Unlock()
+
+	if export {
+		go r.exporter.Export(ev, fp)
+	}
+}
+
+func (r *ErrorReporter) evictOldestLocked() {
+	var oldest string
+	for fp, g := range r.groups {
+		if oldest == "" || g.LastSeen.Before(r.groups[oldest].LastSeen) {
+			oldest = fp
+		}
+	}
+	delete(r.groups, oldest)
+	delete(r.exported, oldest)
+}
+
+// Groups returns the error groups, most recently seen first
+func (r *ErrorReporter) Groups() []models.ErrorGroup {
+	r.mu.Lock()
+	groups := make([]models.ErrorGroup, 0, len(r.groups))
+	for _, g := range r.groups {
+		groups = append(groups, *g)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].LastSeen.After(groups[j].LastSeen) })
+	return groups
+}
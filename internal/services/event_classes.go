@@ -0,0 +1,68 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Event classes used by the unread/notification pipeline. Content events increment unread
+// counts and trigger notifications; meta events (reactions, receipts, typing, membership
+// changes) never do.
+const (
+	EventContent = "content"
+	EventMeta    = "meta"
+)
+
+// defaultEventClasses classifies every event type that can reach the unread pipeline.
+// Unknown types are treated as meta.
+var defaultEventClasses = map[string]string{
+	"message":    EventContent,
+	"voice":      EventContent,
+	"file":       EventContent,
+	"sticker":    EventContent,
+	"mention":    EventContent,
+	"system":     EventMeta,
+	"webhook":    EventMeta,
+	"reaction":   EventMeta,
+	"receipt":    EventMeta,
+	"typing":     EventMeta,
+	"membership": EventMeta,
+}
+
+var (
+	eventClassesMu sync.RWMutex
+	eventClasses   = defaultEventClasses
+)
+
+// SetEventClasses overrides the class of individual event types from a spec such as
+// "system=content,reaction=meta". Types not mentioned keep their default class.
+func SetEventClasses(spec string) error {
+	classes := make(map[string]string, len(defaultEventClasses))
+	for event, class := range defaultEventClasses {
+		classes[event] = class
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		event, class, ok := strings.Cut(entry, "=")
+		event, class = strings.TrimSpace(event), strings.TrimSpace(class)
+		if !ok || event == "" || (class != EventContent && class != EventMeta) {
+			return fmt.Errorf("invalid event class %q, expected <event>=content|meta", entry)
+		}
+		classes[event] = class
+	}
+	eventClassesMu.Lock()
+	eventClasses = classes
+	eventClassesMu.Unlock()
+	return nil
+}
+
+// IsContentEvent reports whether events of this type count as unread and are notified
+func IsContentEvent(event string) bool {
+	eventClassesMu.RLock()
+	defer eventClassesMu.RUnlock()
+	return eventClasses[event] == EventContent
+}
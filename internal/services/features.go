@@ -0,0 +1,55 @@
+package services
+
+import (
+	"strings"
+	"sync"
+
+	"chat-backend/internal/utils"
+)
+
+// Features that can be switched off at runtime through FEATURES_DISABLED
+const (
+	FeatureTranslation  = "translation"
+	FeatureWebhooks     = "webhooks"
+	FeatureMirrorExport = "mirror_export"
+	FeatureUploadDedup  = "upload_dedup"
+)
+
+// allFeatures lists the features FeatureStates reports
+var allFeatures = []string{FeatureTranslation, FeatureWebhooks, FeatureMirrorExport, FeatureUploadDedup}
+
+var (
+	featuresMu       sync.RWMutex
+	disabledFeatures = map[string]bool{}
+)
+
+// LoadFeatureFlags reads FEATURES_DISABLED, a comma-separated list of features to turn off
+func LoadFeatureFlags() {
+	disabled := map[string]bool{}
+	for _, f := range strings.Split(utils.GetEnv("FEATURES_DISABLED", ""), ",") {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+			disabled[f] = true
+		}
+	}
+	featuresMu.Lock()
+	disabledFeatures = disabled
+	featuresMu.Unlock()
+}
+
+// FeatureEnabled reports whether a feature is switched on; every feature is on by default
+func FeatureEnabled(name string) bool {
+	featuresMu.RLock()
+	defer featuresMu.RUnlock()
+	return !disabledFeatures[name]
+}
+
+// FeatureStates reports whether each known feature is enabled
+func FeatureStates() map[string]bool {
+	featuresMu.RLock()
+	defer featuresMu.RUnlock()
+	states := make(map[string]bool, len(allFeatures))
+	for _, f := range allFeatures {
+		states[f] = !disabledFeatures[f]
+	}
+	return states
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+)
+
+// FilesDir is where attachments are stored
+func FilesDir() string {
+	return filepath.Join(utils.GetEnv("UPLOAD_DIR", "uploads"), "files")
+}
+
+// SaveAttachmentMessage stores msg with its attachment (msg.File) and records the file in
+// the files table; msg.File.ID is filled in
+func (s *ChatService) SaveAttachmentMessage(ctx context.Context, msg *models.Message) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	f := msg.File
+	if err := tx.QueryRow(ctx, `INSERT INTO files (user_id, room, filename, name, content_type, kind, size)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		msg.UserID, msg.Room, f.Filename, f.Name, f.ContentType, f.Kind, f.Size).Scan(&f.ID); err != nil {
+		return err
+	}
+	if err := insertMessage(ctx, tx, msg); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE files SET message_id = $1 WHERE id = $2`, msg.ID, f.ID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// removeAttachment deletes an attachment's file; failures are ignored since the rows are gone
+func removeAttachment(ctx context.Context, f *models.MessageFile) {
+	if f != nil && f.Filename != "" {
+		DeleteUpload(ctx, "files/"+filepath.Base(f.Filename))
+	}
+}
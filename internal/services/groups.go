@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrNotGroup is returned for group operations on rooms of another type
+	ErrNotGroup = errors.New("room is not a group")
+	// ErrForbiddenRole is returned when the actor's role doesn't allow the operation
+	ErrForbiddenRole = errors.New("your role in this room doesn't allow this")
+	// ErrGroupFull is returned when a group already has the maximum number of members
+	ErrGroupFull = errors.New("group has reached its member limit")
+	// ErrOwnerMustTransfer is returned when the owner leaves a group that still has members
+	ErrOwnerMustTransfer = errors.New("transfer ownership before leaving the group")
+)
+
+// roleRank orders roles so permission checks can compare them
+var roleRank = map[string]int{models.RoleMember: 0, models.RoleAdmin: 1, models.RoleOwner: 2}
+
+// groupRole returns the active participant's role in a group room
+func groupRole(ctx context.Context, q queryRower, roomID string, userID int) (string, error) {
+	var roomType string
+	var role *string
+	err := q.QueryRow(ctx, `SELECT r.type, p.role FROM rooms r
+		LEFT JOIN room_participants p ON p.room_id = r.id AND p.user_id = $2 AND p.left_at IS NULL
+		WHERE r.id = $1`, roomID, userID).Scan(&roomType, &role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if roomType != "group" {
+		return "", ErrNotGroup
+	}
+	if role == nil {
+		return "", ErrNotMember
+	}
+	return *role, nil
+}
+
+// requireGroupRole checks that actorID has at least role min in the group
+func requireGroupRole(ctx context.Context, q queryRower, roomID string, actorID int, min string) (string, error) {
+	role, err := groupRole(ctx, q, roomID, actorID)
+	if err != nil {
+		return "", err
+	}
+	if roleRank[role] < roleRank[min] {
+		return "", ErrForbiddenRole
+	}
+	return role, nil
+}
+
+// requireRoomAdmin checks that userID is an owner or admin of a room of any type; override
+// (the app admin or a scoped API token) skips the check
+func requireRoomAdmin(ctx context.Context, q queryRower, roomID string, userID int, override bool) error {
+	if override {
+		return nil
+	}
+	var role string
+	err := q.QueryRow(ctx, `SELECT role FROM room_participants WHERE room_id = $1 AND user_id = $2 AND left_at IS NULL`,
+		roomID, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotMember
+	}
+	if err != nil {
+		return err
+	}
+	if roleRank[role] < roleRank[models.RoleAdmin] {
+		return ErrForbiddenRole
+	}
+	return nil
+}
+
+// CreateGroupRoom creates a group owned by ownerID with the given members. Unknown user ids
+// and duplicates are ignored. Returns the room and a member_added event per participant.
+func (s *ChatService) CreateGroupRoom(ctx context.Context, ownerID int, name string, memberIDs []int, maxMembers int) (*models.GroupRoom, []*models.MembershipEvent, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	ids := []int{ownerID}
+	seen := map[int]bool{ownerID: true}
+	for _, id := range memberIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if maxMembers > 0 && len(ids) > maxMembers {
+		return nil, nil, ErrGroupFull
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	group, events, err := insertGroupRoom(ctx, tx, ownerID, name, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return group, events, nil
+}
+
+// insertGroupRoom creates a group owned by ownerID with the members in ids (which include
+// the owner), skipping unknown users
+func insertGroupRoom(ctx context.Context, tx pgx.Tx, ownerID int, name string, ids []int) (*models.GroupRoom, []*models.MembershipEvent, error) {
+	group := &models.GroupRoom{Members: []models.RoomParticipant{}}
+	err := tx.QueryRow(ctx, `INSERT INTO rooms (id, type, name) VALUES ($1, 'group', $2) RETURNING id, type, name, created_at`,
+		uuid.New().String(), name).Scan(&group.ID, &group.Type, &group.Name, &group.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var events []*models.MembershipEvent
+	for _, id := range ids {
+		role, invitedBy := models.RoleMember, &ownerID
+		if id == ownerID {
+			role, invitedBy = models.RoleOwner, nil
+		}
+		var p models.RoomParticipant
+		err := tx.QueryRow(ctx, `INSERT INTO room_participants (room_id, user_id, invited_by, role)
+			SELECT $1, u.id, $3, $4 FROM users u WHERE u.id = $2
+			RETURNING user_id, (SELECT username FROM users WHERE id = $2), role, joined_at`, group.ID, id, invitedBy, role).
+			Scan(&p.UserID, &p.Username, &p.Role, &p.JoinedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue // Unknown user
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		ev, err := recordMembershipEvent(ctx, tx, group.ID, id, invitedBy, "member_added")
+		if err != nil {
+			return nil, nil, err
+		}
+		group.Members = append(group.Members, p)
+		events = append(events, ev)
+	}
+	return group, events, nil
+}
+
+// ListRoomParticipants returns the active members of a room with their roles
+func (s *ChatService) ListRoomParticipants(ctx context.Context, roomID string) ([]models.RoomParticipant, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT p.user_id, u.username, p.role, p.joined_at
+		FROM room_participants p JOIN users u ON u.id = p.user_id
+		WHERE p.room_id = $1 AND p.left_at IS NULL
+		ORDER BY CASE p.role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, p.joined_at`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.RoomParticipant{}
+	for rows.Next() {
+		var p models.RoomParticipant
+		if err := rows.Scan(&p.UserID, &p.Username, &p.Role, &p.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, p)
+	}
+	return members, rows.Err()
+}
+
+// AddParticipant adds userID to a group on behalf of an admin or the owner. The event is nil
+// when the user already is a member.
+func (s *ChatService) AddParticipant(ctx context.Context, roomID string, actorID, userID, maxMembers int) (*models.MembershipEvent, error) {
+	if _, err := requireGroupRole(ctx, db.Pool, roomID, actorID, models.RoleAdmin); err != nil {
+		return nil, err
+	}
+	if maxMembers > 0 {
+		var count int
+		if err := db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM room_participants WHERE room_id = $1 AND left_at IS NULL`, roomID).Scan(&count); err != nil {
+			return nil, err
+		}
+		if count >= maxMembers {
+			return nil, ErrGroupFull
+		}
+	}
+	var exists bool
+	if err := db.Pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return s.AddRoomMember(ctx, roomID, userID, &actorID)
+}
+
+// RemoveParticipant removes userID from a group. Members may remove themselves; admins may
+// remove members and the owner may remove anyone but themselves.
+func (s *ChatService) RemoveParticipant(ctx context.Context, roomID string, actorID, userID int) (*models.MembershipEvent, error) {
+	if actorID == userID {
+		if _, err := groupRole(ctx, db.Pool, roomID, actorID); err != nil {
+			return nil, err
+		}
+		return s.RemoveRoomMember(ctx, roomID, userID, nil)
+	}
+	actorRole, err := requireGroupRole(ctx, db.Pool, roomID, actorID, models.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	targetRole, err := groupRole(ctx, db.Pool, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if roleRank[targetRole] >= roleRank[actorRole] {
+		return nil, ErrForbiddenRole
+	}
+	return s.RemoveRoomMember(ctx, roomID, userID, &actorID)
+}
+
+// RenameGroupRoom renames a group; admins and the owner may rename
+func (s *ChatService) RenameGroupRoom(ctx context.Context, roomID string, actorID int, name string) error {
+	if _, err := requireGroupRole(ctx, db.Pool, roomID, actorID, models.RoleAdmin); err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := db.Pool.Exec(ctx, `UPDATE rooms SET name = $1 WHERE id = $2`, name, roomID)
+	return err
+}
+
+// SetParticipantRole changes a member's role; only the owner may. Making someone the owner
+// transfers ownership and demotes the previous owner to admin.
+func (s *ChatService) SetParticipantRole(ctx context.Context, roomID string, actorID, userID int, role string) error {
+	if _, ok := roleRank[role]; !ok {
+		return errors.New("role must be owner, admin or member")
+	}
+	if actorID == userID {
+		return ErrForbiddenRole
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the room so concurrent role changes see each other
+	if _, err := tx.Exec(ctx, `SELECT id FROM rooms WHERE id = $1 FOR UPDATE`, roomID); err != nil {
+		return err
+	}
+	if _, err := requireGroupRole(ctx, tx, roomID, actorID, models.RoleOwner); err != nil {
+		return err
+	}
+	if _, err := groupRole(ctx, tx, roomID, userID); err != nil {
+		return err
+	}
+	if role == models.RoleOwner {
+		if _, err := tx.Exec(ctx, `UPDATE room_participants SET role = 'admin' WHERE room_id = $1 AND user_id = $2`, roomID, actorID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE room_participants SET role = $3 WHERE room_id = $1 AND user_id = $2`, roomID, userID, role); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
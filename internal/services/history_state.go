@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+)
+
+// GetMessageStates returns the reactions on each message and, for messages viewerID sent,
+// how many recipients have seen them. Messages without any state are left out.
+func (s *ChatService) GetMessageStates(ctx context.Context, viewerID int, messageIDs []int) (map[int]*models.MessageState, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	states := map[int]*models.MessageState{}
+	if len(messageIDs) == 0 {
+		return states, nil
+	}
+	state := func(id int) *models.MessageState {
+		st, ok := states[id]
+		if !ok {
+			st = &models.MessageState{}
+			states[id] = st
+		}
+		return st
+	}
+
+	rows, err := db.Read(ctx).Query(ctx, `
+		SELECT message_id, emoji, COUNT(*), BOOL_OR(user_id = $2)
+		FROM message_reactions WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji ORDER BY message_id, MIN(created_at)`, messageIDs, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, count int
+		var emoji string
+		var mine bool
+		if err := rows.Scan(&id, &emoji, &count, &mine); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		st := state(id)
+		if st.Reactions == nil {
+			st.Reactions = map[string]int{}
+		}
+		st.Reactions[emoji] = count
+		if mine {
+			st.MyReactions = append(st.MyReactions, emoji)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Receipts are only shown to the sender, as in GetMessageReceipts
+	rows, err = db.Read(ctx).Query(ctx, `
+		SELECT r.message_id, COUNT(*) FROM message_receipts r JOIN messages m ON m.id = r.message_id
+		WHERE r.message_id = ANY($1) AND m.user_id = $2 AND r.seen_at IS NOT NULL
+		GROUP BY r.message_id`, messageIDs, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, seen int
+		if err := rows.Scan(&id, &seen); err != nil {
+			return nil, err
+		}
+		state(id).SeenCount = seen
+	}
+	return states, rows.Err()
+}
+
+// RefreshReplySnapshots brings the reply_to copies stored with messages up to date with the
+// messages they quote, which may have been edited or deleted since
+func (s *ChatService) RefreshReplySnapshots(ctx context.Context, messages []models.Message) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var ids []int
+	for _, m := range messages {
+		if m.ReplyTo != nil && m.ReplyTo.ID != 0 {
+			ids = append(ids, m.ReplyTo.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	type quoted struct {
+		content   *string
+		editedAt  *time.Time
+		deletedAt *time.Time
+	}
+	current := make(map[int]quoted, len(ids))
+	rows, err := db.Read(ctx).Query(ctx, `SELECT id, content, edited_at, deleted_at FROM messages WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var q quoted
+		if err := rows.Scan(&id, &q.content, &q.editedAt, &q.deletedAt); err != nil {
+			return err
+		}
+		current[id] = q
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range messages {
+		reply := messages[i].ReplyTo
+		if reply == nil {
+			continue
+		}
+		q, ok := current[reply.ID]
+		if !ok {
+			// Hard deleted or expired: the snapshot is all that's left
+			continue
+		}
+		reply.Content = q.content
+		reply.EditedAt = q.editedAt
+		reply.DeletedAt = q.deletedAt
+		if q.deletedAt != nil {
+			reply.Voice, reply.VoiceMeta, reply.File, reply.Sticker = nil, nil, nil, nil
+		}
+	}
+	return nil
+}
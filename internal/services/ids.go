@@ -0,0 +1,104 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IDGenerator hands out message ids. Ids must be unique across every writer and should
+// increase over time, since messages are paged and acknowledged by id.
+type IDGenerator interface {
+	NextID() int64
+}
+
+// messageIDs generates the ids of new messages; nil leaves them to the messages_id_seq
+// sequence (serial ids)
+var messageIDs IDGenerator
+
+// SetMessageIDGenerator selects how new message ids are generated; nil uses the sequence
+func SetMessageIDGenerator(g IDGenerator) {
+	messageIDs = g
+}
+
+// NewIDGenerator returns the generator named by MESSAGE_ID_GENERATOR: "serial" (nil, the
+// database sequence) or "snowflake" with node as its writer number.
+//
+// Switching from serial to snowflake is safe at any time: snowflake ids are far above any
+// serial id, so ordering by id still follows time. Imports and archive restores keep using
+// the sequence, which places their (older) messages before the live ones. Switching back to
+// serial is not supported, as new ids would sort before the snowflake ones.
+func NewIDGenerator(kind string, node int) (IDGenerator, error) {
+	switch kind {
+	case "", "serial":
+		return nil, nil
+	case "snowflake":
+		return NewSnowflake(node)
+	default:
+		return nil, fmt.Errorf("unknown id generator %q", kind)
+	}
+}
+
+// Snowflake layout. Ids are kept to 53 bits so they stay exact as JSON numbers in
+// JavaScript clients: 41 bits of milliseconds since snowflakeEpoch (about 69 years),
+// 5 bits of node and 7 bits of sequence (128 ids per millisecond per node).
+const (
+	snowflakeNodeBits = 5
+	snowflakeSeqBits  = 7
+	snowflakeMaxNode  = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSeq   = 1<<snowflakeSeqBits - 1
+)
+
+// snowflakeEpoch is 2024-01-01 UTC
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Snowflake generates time-ordered ids without a database round trip. Every instance
+// writing messages needs its own node number (MESSAGE_ID_NODE).
+type Snowflake struct {
+	node int64
+
+	mu     sync.Mutex
+	lastMs int64
+	seq    int64
+}
+
+// NewSnowflake returns a generator for node, 0 to 31
+func NewSnowflake(node int) (*Snowflake, error) {
+	if node < 0 || node > snowflakeMaxNode {
+		return nil, fmt.Errorf("snowflake node must be between 0 and %d", snowflakeMaxNode)
+	}
+	return &Snowflake{node: int64(node)}, nil
+}
+
+// NextID returns the next id. When the clock goes backwards the last timestamp is reused,
+// and when a millisecond's sequence runs out it waits for the next one.
+func (s *Snowflake) NextID() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := time.Since(snowflakeEpoch).Milliseconds()
+	if ms < s.lastMs {
+		ms = s.lastMs
+	}
+	if ms == s.lastMs {
+		s.seq = (s.seq + 1) & snowflakeMaxSeq
+		if s.seq == 0 {
+			for ms <= s.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				ms = time.Since(snowflakeEpoch).Milliseconds()
+			}
+		}
+	} else {
+		s.seq = 0
+	}
+	s.lastMs = ms
+	return ms<<(snowflakeNodeBits+snowflakeSeqBits) | s.node<<snowflakeSeqBits | s.seq
+}
+
+// nextMessageID is the id to insert for a new message, or nil to use the sequence
+func nextMessageID() interface{} {
+	if messageIDs == nil {
+		return nil
+	}
+	return messageIDs.NextID()
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxImportMediaBytes caps a single downloaded media file
+const maxImportMediaBytes = 25 << 20
+
+type ImportService struct {
+	httpClient *http.Client
+}
+
+func NewImportService() *ImportService {
+	// Media URLs come from the uploaded file, so fetches are subject to the egress policy
+	return &ImportService{httpClient: NewEgressClient(30 * time.Second)}
+}
+
+// ParseImportJSON reads a JSON array of records: [{"username", "text", "timestamp", "media_url"}].
+// timestamp may be RFC3339 or unix seconds/milliseconds.
+func ParseImportJSON(r io.Reader) ([]models.ImportRecord, error) {
+	var raw []struct {
+		Username  string          `json:"username"`
+		Text      string          `json:"text"`
+		Timestamp json.RawMessage `json:"timestamp"`
+		MediaURL  string          `json:"media_url"`
+	}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON export: %w", err)
+	}
+
+	records := make([]models.ImportRecord, 0, len(raw))
+	for i, item := range raw {
+		ts, err := utils.ParseTimestamp(strings.Trim(string(item.Timestamp), `"`))
+		if err != nil {
+			return nil, fmt.Errorf("record %d: invalid timestamp", i)
+		}
+		records = append(records, models.ImportRecord{
+			Username:  item.Username,
+			Text:      item.Text,
+			Timestamp: ts,
+			MediaURL:  item.MediaURL,
+		})
+	}
+	return records, nil
+}
+
+// ParseImportCSV reads a CSV export with a header row containing at least
+// username and timestamp columns, plus optional text and media_url columns.
+func ParseImportCSV(r io.Reader) ([]models.ImportRecord, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV export: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := cols["username"]; !ok {
+		return nil, errors.New("CSV export is missing the username column")
+	}
+	if _, ok := cols["timestamp"]; !ok {
+		return nil, errors.New("CSV export is missing the timestamp column")
+	}
+	field := func(row []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	var records []models.ImportRecord
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ts, err := utils.ParseTimestamp(field(row, "timestamp"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid timestamp", line)
+		}
+		records = append(records, models.ImportRecord{
+			Username:  field(row, "username"),
+			Text:      field(row, "text"),
+			Timestamp: ts,
+			MediaURL:  field(row, "media_url"),
+		})
+	}
+	return records, nil
+}
+
+// Import writes the records into the target room inside a single transaction.
+// Users are resolved by username (after applying UserMap) and added as room participants.
+// Downloaded media files are only stored once the transaction commits.
+func (s *ImportService) Import(ctx context.Context, records []models.ImportRecord, opts models.ImportOptions) (*models.ImportResult, error) {
+	if opts.Room == "" {
+		return nil, errors.New("room is required")
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var roomExists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM rooms WHERE id = $1)`, opts.Room).Scan(&roomExists); err != nil {
+		return nil, err
+	}
+	if !roomExists {
+		return nil, fmt.Errorf("room %s does not exist", opts.Room)
+	}
+
+	result := &models.ImportResult{}
+	userIDs := make(map[string]int)
+	var downloaded []*TempUpload
+	defer func() {
+		for _, upload := range downloaded {
+			upload.Discard()
+		}
+	}()
+
+	for i, rec := range records {
+		username := rec.Username
+		if mapped, ok := opts.UserMap[username]; ok {
+			username = mapped
+		}
+		if username == "" {
+			result.Skipped++
+			result.Errors = append(result.Errors, fmt.Sprintf("record %d: missing username", i))
+			continue
+		}
+
+		userID, ok := userIDs[username]
+		if !ok {
+			userID, err = s.resolveUser(ctx, tx, username, opts.CreateMissingUsers, result)
+			if err != nil {
+				result.Skipped++
+				result.Errors = append(result.Errors, fmt.Sprintf("record %d: %v", i, err))
+				continue
+			}
+			userIDs[username] = userID
+			if _, err := tx.Exec(ctx, `INSERT INTO room_participants (room_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, opts.Room, userID); err != nil {
+				return nil, err
+			}
+		}
+
+		var content, voice *string
+		text := rec.Text
+		if rec.MediaURL != "" {
+			if opts.DownloadMedia {
+				filename, upload, err := s.downloadMedia(ctx, rec.MediaURL, userID)
+				if err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("record %d: media download failed: %v", i, err))
+				} else {
+					downloaded = append(downloaded, upload)
+					voice = &filename
+				}
+			}
+			if voice == nil {
+				// Keep a reference to media we couldn't (or weren't asked to) import
+				text = strings.TrimSpace(text + " " + rec.MediaURL)
+			}
+		}
+		if text != "" {
+			content = &text
+		}
+		if content == nil && voice == nil {
+			result.Skipped++
+			continue
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO messages (room, user_id, username, content, voice, has_seen, silent, created_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, TRUE, TRUE, $6, `+roomMessageExpiry+`)`,
+			opts.Room, userID, username, content, voice, rec.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		result.Imported++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	for _, upload := range downloaded {
+		if err := upload.Publish(ctx); err != nil {
+			utils.LogError(err, "publish imported media")
+		}
+	}
+	return result, nil
+}
+
+// resolveUser finds a user by username, optionally creating a placeholder account
+func (s *ImportService) resolveUser(ctx context.Context, tx pgx.Tx, username string, create bool, result *models.ImportResult) (int, error) {
+	var id int
+	err := tx.QueryRow(ctx, `SELECT id FROM users WHERE username = $1`, username).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+	if !create {
+		return 0, fmt.Errorf("unknown user %q", username)
+	}
+
+	// Placeholder accounts get a random password nobody knows; an admin can reset it later
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return 0, err
+	}
+	hash, err := HashPassword(hex.EncodeToString(secret))
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.QueryRow(ctx, `INSERT INTO users (username, password_hash) VALUES ($1, $2) RETURNING id`, username, hash).Scan(&id); err != nil {
+		return 0, err
+	}
+	result.CreatedUsers = append(result.CreatedUsers, username)
+	return id, nil
+}
+
+// downloadMedia fetches an audio file into a temp upload for the voices directory.
+// Only audio is accepted since voice is the only media type messages can carry.
+func (s *ImportService) downloadMedia(ctx context.Context, url string, userID int) (string, *TempUpload, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	ext := path.Ext(req.URL.Path)
+	if !strings.HasPrefix(mediaType, "audio/") {
+		return "", nil, fmt.Errorf("unsupported media type %q", mediaType)
+	}
+	if ext == "" {
+		ext = ".audio"
+	}
+
+	filename := fmt.Sprintf("voice_%d_%d%s", userID, time.Now().UnixNano(), ext)
+	upload, err := NewTempUpload("voices/" + filename)
+	if err != nil {
+		return "", nil, err
+	}
+	upload.ContentType = mediaType
+	n, err := io.Copy(upload.f, io.LimitReader(resp.Body, maxImportMediaBytes+1))
+	if err == nil && n > maxImportMediaBytes {
+		err = errors.New("file too large")
+	}
+	if err == nil {
+		err = upload.Close()
+	}
+	if err != nil {
+		upload.Discard()
+		return "", nil, err
+	}
+	return filename, upload, nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+)
+
+// GetRoomInsights reads a room's top reacted messages, most active days and posting streaks from
+// the rollup tables maintained by triggers; messages are only joined for the top list.
+func (s *ChatService) GetRoomInsights(ctx context.Context, roomID string, userID, limit int) (*models.RoomInsights, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	insights := &models.RoomInsights{Room: roomID, TopReacted: []models.ReactedMessage{}, MostActiveDays: []models.DayActivity{}}
+
+	rows, err := db.Read(ctx).Query(ctx, `SELECT `+messageColumns+`, rc.reactions
+		FROM message_reaction_counts rc JOIN messages ON messages.id = rc.message_id
+		WHERE rc.room = $1 AND rc.reactions > 0 AND messages.deleted_at IS NULL AND `+notExpired+`
+		ORDER BY rc.reactions DESC, rc.message_id DESC
+		LIMIT $2`, roomID, limit)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var item models.ReactedMessage
+		msg, err := scanMessage(appendScanner{row: rows, extra: []interface{}{&item.Reactions}})
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		item.Message = *msg
+		insights.TopReacted = append(insights.TopReacted, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Read(ctx).Query(ctx, `SELECT day, SUM(messages) FROM room_daily_activity
+		WHERE room = $1 GROUP BY day ORDER BY SUM(messages) DESC, day DESC LIMIT $2`, roomID, limit)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var day time.Time
+		var d models.DayActivity
+		if err := rows.Scan(&day, &d.Messages); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.Day = day.Format(time.DateOnly)
+		insights.MostActiveDays = append(insights.MostActiveDays, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if insights.Streak, err = activityStreak(ctx, `SELECT DISTINCT day FROM room_daily_activity WHERE room = $1 ORDER BY day`, roomID); err != nil {
+		return nil, err
+	}
+	if insights.YourStreak, err = activityStreak(ctx, `SELECT day FROM room_daily_activity WHERE user_id = $2 AND room = $1 ORDER BY day`, roomID, userID); err != nil {
+		return nil, err
+	}
+	return insights, nil
+}
+
+// activityStreak computes streaks from a query returning distinct days in ascending order
+func activityStreak(ctx context.Context, query string, args ...interface{}) (models.ActivityStreak, error) {
+	var streak models.ActivityStreak
+	rows, err := db.Read(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return streak, err
+	}
+	defer rows.Close()
+
+	var last time.Time
+	run := 0
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			return streak, err
+		}
+		if run > 0 && day.Equal(last.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > streak.Longest {
+			streak.Longest = run
+		}
+		last = day
+	}
+	if err := rows.Err(); err != nil {
+		return streak, err
+	}
+	if run == 0 {
+		return streak, nil
+	}
+	streak.LastActive = last.Format(time.DateOnly)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if !last.Before(today.AddDate(0, 0, -1)) {
+		streak.Current = run
+	}
+	return streak, nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrInvalidInvite is returned for unknown or expired invite codes
+	ErrInvalidInvite = errors.New("invite link is invalid or has expired")
+	// ErrInviteNotAllowed is returned when creating an invite for a direct, support or saved room
+	ErrInviteNotAllowed = errors.New("invite links are not available for this room")
+)
+
+const inviteColumns = `code, room_id, created_by, created_at, expires_at`
+
+// activeInvite matches invites that have not expired
+const activeInvite = `(i.expires_at IS NULL OR i.expires_at > NOW())`
+
+func scanInvite(row rowScanner) (*models.RoomInvite, error) {
+	var inv models.RoomInvite
+	if err := row.Scan(&inv.Code, &inv.RoomID, &inv.CreatedBy, &inv.CreatedAt, &inv.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// CreateRoomInvite creates an invite link for a room. A non-positive ttl never expires.
+// Room owners and admins may create invites; override is for the app admin.
+func (s *ChatService) CreateRoomInvite(ctx context.Context, roomID string, createdBy int, ttl time.Duration, override bool) (*models.RoomInvite, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := requireRoomAdmin(ctx, db.Pool, roomID, createdBy, override); err != nil {
+		return nil, err
+	}
+	var roomType string
+	err := db.Pool.QueryRow(ctx, `SELECT type FROM rooms WHERE id = $1`, roomID).Scan(&roomType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if roomType == "direct" || roomType == "support" || roomType == "saved" {
+		return nil, ErrInviteNotAllowed
+	}
+
+	buf := make([]byte, 9)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	var expiresAt *time.Time
+	if ttl > 0 {
+		t := time.Now().Add(ttl)
+		expiresAt = &t
+	}
+	return scanInvite(db.Pool.QueryRow(ctx, `INSERT INTO room_invites (code, room_id, created_by, expires_at)
+		VALUES ($1, $2, $3, $4) RETURNING `+inviteColumns, base64.RawURLEncoding.EncodeToString(buf), roomID, createdBy, expiresAt))
+}
+
+// ListRoomInvites returns a room's invites that have not expired, newest first, to room
+// owners and admins
+func (s *ChatService) ListRoomInvites(ctx context.Context, roomID string, actorID int, override bool) ([]models.RoomInvite, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := requireRoomAdmin(ctx, db.Pool, roomID, actorID, override); err != nil {
+		return nil, err
+	}
+	rows, err := db.Pool.Query(ctx, `SELECT `+inviteColumns+` FROM room_invites i WHERE room_id = $1 AND `+activeInvite+`
+		ORDER BY created_at DESC`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []models.RoomInvite{}
+	for rows.Next() {
+		inv, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, *inv)
+	}
+	return invites, rows.Err()
+}
+
+// RevokeRoomInvite deletes an invite; its link stops working immediately. Room owners and
+// admins only.
+func (s *ChatService) RevokeRoomInvite(ctx context.Context, roomID string, actorID int, code string, override bool) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := requireRoomAdmin(ctx, db.Pool, roomID, actorID, override); err != nil {
+		return err
+	}
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM room_invites WHERE code = $1 AND room_id = $2`, code, roomID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetInvitePreview returns the room name, member count and inviter of an active invite
+func (s *ChatService) GetInvitePreview(ctx context.Context, code string) (*models.InvitePreview, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var p models.InvitePreview
+	var inviter, photo *string
+	err := db.Read(ctx).QueryRow(ctx, `
+		SELECT i.code, r.id, r.name,
+			(SELECT COUNT(*) FROM room_participants rp WHERE rp.room_id = r.id AND rp.left_at IS NULL),
+			u.username,
+			(SELECT filename FROM photos ph WHERE ph.user_id = i.created_by ORDER BY ph.created_at DESC, ph.id DESC LIMIT 1)
+		FROM room_invites i
+		JOIN rooms r ON r.id = i.room_id
+		LEFT JOIN users u ON u.id = i.created_by
+		WHERE i.code = $1 AND `+activeInvite, code).Scan(&p.Code, &p.RoomID, &p.RoomName, &p.MemberCount, &inviter, &photo)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidInvite
+	}
+	if err != nil {
+		return nil, err
+	}
+	if inviter != nil {
+		p.Inviter = *inviter
+	}
+	if photo != nil {
+		p.AvatarURL = PhotoURL(*photo)
+	}
+	return &p, nil
+}
+
+// AcceptRoomInvite adds userID to the invite's room, recording the invite's creator as the inviter.
+// The membership event is nil when the user already is a member.
+func (s *ChatService) AcceptRoomInvite(ctx context.Context, code string, userID int) (string, *models.MembershipEvent, error) {
+	qctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	inv, err := scanInvite(db.Pool.QueryRow(qctx, `SELECT `+inviteColumns+` FROM room_invites i WHERE code = $1 AND `+activeInvite, code))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, ErrInvalidInvite
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	ev, err := s.AddRoomMember(ctx, inv.RoomID, userID, inv.CreatedBy)
+	return inv.RoomID, ev, err
+}
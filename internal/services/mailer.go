@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+
+	"chat-backend/internal/utils"
+)
+
+// Mailer delivers plain-text emails
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// LogMailer writes emails to the log; used when no SMTP server is configured
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	log.Printf("Email to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// SMTPMailer sends through an SMTP relay with PLAIN auth
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m SMTPMailer) Send(to, subject, body string) error {
+	host := m.Addr
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s", m.From, to, subject, body)
+	return smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg))
+}
+
+// ResilientMailer guards a mailer with a Provider and switches to Fallback (when set) if the
+// primary fails or its circuit is open
+type ResilientMailer struct {
+	Primary  Mailer
+	Provider *Provider
+	Fallback *ResilientMailer
+}
+
+func (m *ResilientMailer) Send(to, subject, body string) error {
+	err := m.Provider.Call(context.Background(), func(context.Context) error {
+		return m.Primary.Send(to, subject, body)
+	})
+	if err != nil && m.Fallback != nil {
+		return m.Fallback.Send(to, subject, body)
+	}
+	return err
+}
+
+// NewMailerFromEnv returns a guarded SMTPMailer when SMTP_ADDR is set, otherwise a LogMailer.
+// SMTP_FALLBACK_ADDR configures a secondary relay with the same sender and credentials.
+func NewMailerFromEnv() Mailer {
+	addr := utils.GetEnv("SMTP_ADDR", "")
+	if addr == "" {
+		return LogMailer{}
+	}
+	relay := func(addr string) SMTPMailer {
+		return SMTPMailer{
+			Addr:     addr,
+			From:     utils.GetEnv("SMTP_FROM", "no-reply@localhost"),
+			Username: utils.GetEnv("SMTP_USERNAME", ""),
+			Password: utils.GetEnv("SMTP_PASSWORD", ""),
+		}
+	}
+	mailer := &ResilientMailer{Primary: relay(addr), Provider: NewProvider("email")}
+	if fallback := utils.GetEnv("SMTP_FALLBACK_ADDR", ""); fallback != "" {
+		mailer.Fallback = &ResilientMailer{Primary: relay(fallback), Provider: NewProvider("email_fallback")}
+	}
+	return mailer
+}
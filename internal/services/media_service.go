@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const stagedMediaColumns = `id, user_id, room, kind, filename, voice_meta, created_at`
+
+func scanStagedMedia(row rowScanner) (*models.StagedMedia, error) {
+	var m models.StagedMedia
+	var voiceMetaBytes sql.NullString
+	if err := row.Scan(&m.ID, &m.UserID, &m.Room, &m.Kind, &m.Filename, &voiceMetaBytes, &m.CreatedAt); err != nil {
+		return nil, err
+	}
+	if voiceMetaBytes.Valid && len(voiceMetaBytes.String) > 0 {
+		var meta models.VoiceMeta
+		if err := json.Unmarshal([]byte(voiceMetaBytes.String), &meta); err == nil {
+			m.VoiceMeta = &meta
+		}
+	}
+	return &m, nil
+}
+
+// StageMedia records an uploaded file that will be sent later; m.ID and m.CreatedAt are filled
+func (s *ChatService) StageMedia(ctx context.Context, m *models.StagedMedia) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var voiceMetaJSON interface{}
+	if m.VoiceMeta != nil {
+		b, err := json.Marshal(m.VoiceMeta)
+		if err != nil {
+			return err
+		}
+		voiceMetaJSON = b
+	}
+
+	m.ID = uuid.New().String()
+	query := `INSERT INTO staged_media (id, user_id, room, kind, filename, voice_meta) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`
+	return db.Pool.QueryRow(ctx, query, m.ID, m.UserID, m.Room, m.Kind, m.Filename, voiceMetaJSON).Scan(&m.CreatedAt)
+}
+
+// GetStagedMedia returns a staged upload owned by userID, or ErrNotFound
+func (s *ChatService) GetStagedMedia(ctx context.Context, id string, userID int) (*models.StagedMedia, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + stagedMediaColumns + ` FROM staged_media WHERE id = $1 AND user_id = $2`
+	m, err := scanStagedMedia(db.Pool.QueryRow(ctx, query, id, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return m, err
+}
+
+// ReplaceStagedMediaFile points a staged upload at a new file (e.g. after trimming)
+func (s *ChatService) ReplaceStagedMediaFile(ctx context.Context, id string, filename string, meta *models.VoiceMeta) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var voiceMetaJSON interface{}
+	if meta != nil {
+		b, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		voiceMetaJSON = b
+	}
+	_, err := db.Pool.Exec(ctx, `UPDATE staged_media SET filename = $1, voice_meta = $2 WHERE id = $3`, filename, voiceMetaJSON, id)
+	return err
+}
+
+// DeleteStagedMedia cancels a staged upload and returns it so the caller can remove the file
+func (s *ChatService) DeleteStagedMedia(ctx context.Context, id string, userID int) (*models.StagedMedia, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `DELETE FROM staged_media WHERE id = $1 AND user_id = $2 RETURNING ` + stagedMediaColumns
+	m, err := scanStagedMedia(db.Pool.QueryRow(ctx, query, id, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return m, err
+}
+
+// PublishStagedMedia turns a staged upload into a message in one transaction, so a staged
+// upload can only be published once. msg carries the message fields not taken from the upload.
+func (s *ChatService) PublishStagedMedia(ctx context.Context, id string, userID int, msg *models.Message) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM staged_media WHERE id = $1 AND user_id = $2 RETURNING ` + stagedMediaColumns
+	m, err := scanStagedMedia(tx.QueryRow(ctx, query, id, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	msg.Room = m.Room
+	msg.Voice = &m.Filename
+	msg.VoiceMeta = m.VoiceMeta
+	if err := insertMessage(ctx, tx, msg); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNotMember is returned when removing a user who is not an active participant
+var ErrNotMember = errors.New("user is not a member of this room")
+
+// recordMembershipEvent inserts a member_added / member_removed event inside tx
+func recordMembershipEvent(ctx context.Context, tx pgx.Tx, roomID string, userID int, actorID *int, event string) (*models.MembershipEvent, error) {
+	ev := &models.MembershipEvent{Room: roomID, Event: event, UserID: userID, ActorID: actorID}
+	query := `
+		INSERT INTO room_membership_events (room_id, user_id, actor_id, event)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, (SELECT username FROM users WHERE id = $2)
+	`
+	if err := tx.QueryRow(ctx, query, roomID, userID, actorID, event).Scan(&ev.ID, &ev.CreatedAt, &ev.Username); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// AddRoomMember adds (or re-adds) a participant and records a member_added event.
+// Returns nil without an event if the user is already an active member.
+func (s *ChatService) AddRoomMember(ctx context.Context, roomID string, userID int, invitedBy *int) (*models.MembershipEvent, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO room_participants (room_id, user_id, invited_by) VALUES ($1, $2, $3)
+		ON CONFLICT (room_id, user_id) DO UPDATE
+		SET left_at = NULL, joined_at = NOW(), invited_by = EXCLUDED.invited_by, role = 'member'
+		WHERE room_participants.left_at IS NOT NULL
+	`, roomID, userID, invitedBy)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, nil
+	}
+
+	ev, err := recordMembershipEvent(ctx, tx, roomID, userID, invitedBy, "member_added")
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// RemoveRoomMember marks a participant as left and records a member_removed event.
+// actorID is nil when the user left on their own; a group owner can only leave once they
+// are the last member.
+func (s *ChatService) RemoveRoomMember(ctx context.Context, roomID string, userID int, actorID *int) (*models.MembershipEvent, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if actorID == nil {
+		var ownerWithMembers bool
+		err := tx.QueryRow(ctx, `SELECT role = 'owner' AND EXISTS (
+				SELECT 1 FROM room_participants o WHERE o.room_id = $1 AND o.user_id <> $2 AND o.left_at IS NULL
+			) FROM room_participants WHERE room_id = $1 AND user_id = $2 AND left_at IS NULL FOR UPDATE`, roomID, userID).Scan(&ownerWithMembers)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		if ownerWithMembers {
+			return nil, ErrOwnerMustTransfer
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `UPDATE room_participants SET left_at = NOW() WHERE room_id = $1 AND user_id = $2 AND left_at IS NULL`, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrNotMember
+	}
+
+	ev, err := recordMembershipEvent(ctx, tx, roomID, userID, actorID, "member_removed")
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// GetMembershipEvents returns the room's membership events oldest first.
+// A zero since returns the full history.
+func (s *ChatService) GetMembershipEvents(ctx context.Context, roomID string, since time.Time) ([]models.MembershipEvent, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT e.id, e.room_id, e.event, e.user_id, COALESCE(u.username, ''), e.actor_id, e.created_at
+		FROM room_membership_events e
+		LEFT JOIN users u ON u.id = e.user_id
+		WHERE e.room_id = $1 AND e.created_at >= $2
+		ORDER BY e.created_at, e.id
+	`
+	rows, err := db.Pool.Query(ctx, query, roomID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.MembershipEvent
+	for rows.Next() {
+		var ev models.MembershipEvent
+		if err := rows.Scan(&ev.ID, &ev.Room, &ev.Event, &ev.UserID, &ev.Username, &ev.ActorID, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
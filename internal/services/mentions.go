@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+)
+
+// mentionPattern matches @username at the start of the text or after a character that
+// can't be part of a word, so e-mail addresses aren't taken for mentions
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])@([\p{L}\p{N}_.\-]{1,50})`)
+
+// maxMentions caps the mentions recorded per message
+const maxMentions = 50
+
+// ParseMentions returns the distinct usernames @mentioned in text, in order of appearance.
+// Trailing dots and hyphens are punctuation, not part of the name ("thanks @ana.").
+func ParseMentions(text string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(m[1], ".-")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+		if len(names) == maxMentions {
+			break
+		}
+	}
+	return names
+}
+
+// SaveMentions records the users @mentioned in a message and returns them. Usernames that
+// aren't active participants of the room are ignored, as is the sender.
+func (s *ChatService) SaveMentions(ctx context.Context, messageID int, roomID string, senderID int, usernames []string) ([]models.Mention, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `INSERT INTO message_mentions (message_id, user_id)
+		SELECT $1, u.id FROM users u
+		JOIN room_participants p ON p.user_id = u.id AND p.room_id = $2 AND p.left_at IS NULL
+		WHERE u.username = ANY($3) AND u.id <> $4
+		ON CONFLICT DO NOTHING
+		RETURNING user_id, (SELECT username FROM users WHERE id = user_id)`, messageID, roomID, usernames, senderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mentions []models.Mention
+	for rows.Next() {
+		var m models.Mention
+		if err := rows.Scan(&m.UserID, &m.Username); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrNotMessageSender = errors.New("only the sender can edit or delete this message")
+	ErrMessageDeleted   = errors.New("message was deleted")
+	ErrEditWindowClosed = errors.New("message is too old to edit")
+	ErrNotEditable      = errors.New("system messages can't be edited or deleted")
+	// ErrEditConflict is returned when an edit was based on an outdated message version
+	ErrEditConflict = errors.New("message was edited on another device")
+	// ErrUndoWindowClosed is returned when retracting a message after the undo send window
+	ErrUndoWindowClosed = errors.New("message can no longer be unsent")
+)
+
+// lockOwnMessage loads a live message sent by userID and locks it for the rest of tx.
+// Messages in rooms userID has left are reported as not found.
+func lockOwnMessage(ctx context.Context, tx pgx.Tx, messageID, userID int) (*models.Message, error) {
+	var held bool
+	query := `SELECT ` + messageColumns + `, NOT (` + notHeld + `) FROM messages
+		WHERE id = $1 AND ` + notExpired + `
+		AND EXISTS (SELECT 1 FROM room_participants rp WHERE rp.room_id = messages.room AND rp.user_id = $2 AND rp.left_at IS NULL)
+		FOR UPDATE`
+	msg, err := scanMessage(appendScanner{row: tx.QueryRow(ctx, query, messageID, userID), extra: []interface{}{&held}})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case msg.UserID != userID:
+		return nil, ErrNotMessageSender
+	case msg.System:
+		return nil, ErrNotEditable
+	case msg.DeletedAt != nil:
+		return nil, ErrMessageDeleted
+	case held:
+		return nil, ErrLegalHold
+	}
+	return msg, nil
+}
+
+// EditMessage replaces the text of a message sent by userID, stamps edited_at and bumps the version.
+// window limits edits to messages younger than it; 0 allows editing at any age. When baseVersion
+// is set and older than the stored version, the current message is returned with ErrEditConflict;
+// resending the text the message already has is not a conflict.
+func (s *ChatService) EditMessage(ctx context.Context, messageID, userID int, text string, baseVersion *int, window time.Duration) (*models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	msg, err := lockOwnMessage(ctx, tx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if window > 0 && time.Since(msg.CreatedAt) > window {
+		return nil, ErrEditWindowClosed
+	}
+	if baseVersion != nil && *baseVersion != msg.Version {
+		if msg.Content != nil && *msg.Content == text {
+			return msg, nil
+		}
+		return msg, ErrEditConflict
+	}
+	if err := tx.QueryRow(ctx, `UPDATE messages SET content = $2, edited_at = NOW(), version = version + 1 WHERE id = $1 RETURNING edited_at, version`,
+		messageID, text).Scan(&msg.EditedAt, &msg.Version); err != nil {
+		return nil, err
+	}
+	msg.Content = &text
+	return msg, tx.Commit(ctx)
+}
+
+// DeleteMessage turns a message sent by userID into a tombstone: content, voice and reply are
+// cleared, the message is unpinned, stops being the room announcement and its voice file is
+// removed. The row keeps its id and position so clients can render "message deleted" in place.
+func (s *ChatService) DeleteMessage(ctx context.Context, messageID, userID int) (*models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	msg, err := lockOwnMessage(ctx, tx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tombstoneMessage(ctx, tx, msg); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	clearTombstone(ctx, msg)
+	return msg, nil
+}
+
+// RetractMessage undoes sending a message of userID younger than window. Unlike DeleteMessage
+// no tombstone is left: the row is removed along with its pins, reactions and media, as if it
+// had never been sent.
+func (s *ChatService) RetractMessage(ctx context.Context, messageID, userID int, window time.Duration) (*models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	msg, err := lockOwnMessage(ctx, tx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(msg.CreatedAt) > window {
+		return nil, ErrUndoWindowClosed
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM messages WHERE id = $1`, messageID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	clearTombstone(ctx, msg)
+	return msg, nil
+}
+
+// ModerateDeleteMessage tombstones any message like DeleteMessage, for moderators. The
+// deletion is recorded in the admin audit log; details say which API token was used, if any.
+func (s *AdminService) ModerateDeleteMessage(ctx context.Context, adminID, messageID int, details interface{}) (*models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var held bool
+	query := `SELECT ` + messageColumns + `, NOT (` + notHeld + `) FROM messages WHERE id = $1 AND ` + notExpired + ` FOR UPDATE`
+	msg, err := scanMessage(appendScanner{row: tx.QueryRow(ctx, query, messageID), extra: []interface{}{&held}})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+	if held {
+		return nil, ErrLegalHold
+	}
+	if err := tombstoneMessage(ctx, tx, msg); err != nil {
+		return nil, err
+	}
+	if err := recordAdminAudit(ctx, tx, adminID, "moderate_delete_message", "message", strconv.Itoa(messageID), details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	clearTombstone(ctx, msg)
+	return msg, nil
+}
+
+// tombstoneMessage clears a locked message and drops its pin and announcement
+func tombstoneMessage(ctx context.Context, tx pgx.Tx, msg *models.Message) error {
+	if err := tx.QueryRow(ctx, `UPDATE messages
+		SET content = NULL, voice = NULL, voice_meta = NULL, file = NULL, sticker = NULL, reply_to = NULL, deleted_at = NOW()
+		WHERE id = $1 RETURNING deleted_at`, msg.ID).Scan(&msg.DeletedAt); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM files WHERE message_id = $1`, msg.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM pinned_messages WHERE message_id = $1`, msg.ID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `DELETE FROM room_announcements WHERE message_id = $1`, msg.ID)
+	return err
+}
+
+// clearTombstone removes the voice file and attachment of a committed tombstone and blanks the in-memory copy
+func clearTombstone(ctx context.Context, msg *models.Message) {
+	if msg.Voice != nil && *msg.Voice != "" && !msg.VoiceExpired {
+		DeleteUpload(ctx, "voices/"+filepath.Base(*msg.Voice))
+	}
+	removeAttachment(ctx, msg.File)
+	msg.Content, msg.Voice, msg.VoiceMeta, msg.File, msg.ReplyTo = nil, nil, nil, nil, nil
+}
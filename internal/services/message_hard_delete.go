@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// HardDeleteMessage physically removes a message (live or already a tombstone) for a
+// compliance request: the row and everything hanging off it (reactions, receipts, mentions,
+// pins, attachment rows), its media, the copies embedded in replies and the room's static
+// mirror, which is reset so the next export leaves it out. The audit log keeps a tombstone
+// with the message's metadata but none of its content; extra is added to it (e.g. the API
+// token used). Messages under legal hold are refused.
+func (s *AdminService) HardDeleteMessage(ctx context.Context, adminID, messageID int, reason string, extra interface{}) (*models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var held bool
+	query := `SELECT ` + messageColumns + `, NOT (` + notHeld + `) FROM messages WHERE id = $1 FOR UPDATE`
+	msg, err := scanMessage(appendScanner{row: tx.QueryRow(ctx, query, messageID), extra: []interface{}{&held}})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		return nil, ErrLegalHold
+	}
+
+	// Replies keep a reference to the removed message but not its content
+	if _, err := tx.Exec(ctx, `UPDATE messages SET reply_to = jsonb_build_object('id', $1::bigint, 'room', room, 'deleted_at', NOW())
+		WHERE room = $2 AND (reply_to->>'id')::bigint = $1::bigint`, msg.ID, msg.Room); err != nil {
+		return nil, err
+	}
+	// A removed thread root hands the thread to its oldest remaining reply
+	if _, err := tx.Exec(ctx, `WITH new_root AS (
+			SELECT id FROM messages WHERE thread_id = $1 ORDER BY created_at, id LIMIT 1
+		)
+		UPDATE messages SET thread_id = NULLIF((SELECT id FROM new_root), messages.id) WHERE thread_id = $1`, msg.ID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM messages WHERE id = $1`, msg.ID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE room_mirrors SET last_message_id = 0, message_count = 0, exported_at = NULL WHERE room_id = $1`, msg.Room); err != nil {
+		return nil, err
+	}
+
+	tombstone := map[string]interface{}{
+		"room":       msg.Room,
+		"user_id":    msg.UserID,
+		"username":   msg.Username,
+		"created_at": msg.CreatedAt,
+		"voice":      msg.Voice != nil && *msg.Voice != "",
+		"file":       msg.File != nil,
+		"reason":     reason,
+	}
+	if extra != nil {
+		tombstone["request"] = extra
+	}
+	if err := recordAdminAudit(ctx, tx, adminID, "hard_delete_message", "message", strconv.Itoa(msg.ID), tombstone); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	clearTombstone(ctx, msg)
+	return msg, nil
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNotPublicRoom is returned when mirroring a room that isn't a public channel
+var ErrNotPublicRoom = errors.New("only public channels can be mirrored")
+
+const roomMirrorColumns = `rm.room_id, r.name, rm.last_message_id, rm.message_count, rm.enabled_by, rm.created_at, rm.exported_at`
+
+func scanRoomMirror(row rowScanner) (*models.RoomMirror, error) {
+	var m models.RoomMirror
+	if err := row.Scan(&m.RoomID, &m.Name, &m.LastMessageID, &m.MessageCount, &m.EnabledBy, &m.CreatedAt, &m.ExportedAt); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// EnableRoomMirror starts publishing a public channel as a static archive. Enabling an
+// already mirrored room is a no-op.
+func (s *AdminService) EnableRoomMirror(ctx context.Context, adminID int, roomID string) (*models.RoomMirror, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var roomType string
+	if err := tx.QueryRow(ctx, `SELECT type FROM rooms WHERE id = $1`, roomID).Scan(&roomType); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if roomType != "channel" {
+		return nil, ErrNotPublicRoom
+	}
+	tag, err := tx.Exec(ctx, `INSERT INTO room_mirrors (room_id, enabled_by) VALUES ($1, $2) ON CONFLICT (room_id) DO NOTHING`, roomID, adminID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() > 0 {
+		if err := recordAdminAudit(ctx, tx, adminID, "enable_room_mirror", "room", roomID, nil); err != nil {
+			return nil, err
+		}
+	}
+	m, err := scanRoomMirror(tx.QueryRow(ctx, `SELECT `+roomMirrorColumns+` FROM room_mirrors rm JOIN rooms r ON r.id = rm.room_id WHERE rm.room_id = $1`, roomID))
+	if err != nil {
+		return nil, err
+	}
+	return m, tx.Commit(ctx)
+}
+
+// DisableRoomMirror stops publishing a room. The exported files are removed by the caller.
+func (s *AdminService) DisableRoomMirror(ctx context.Context, adminID int, roomID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM room_mirrors WHERE room_id = $1`, roomID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	if err := recordAdminAudit(ctx, tx, adminID, "disable_room_mirror", "room", roomID, nil); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ResetRoomMirror makes the next export rebuild the archive from scratch, e.g. after
+// messages were deleted or purged
+func (s *AdminService) ResetRoomMirror(ctx context.Context, roomID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE room_mirrors SET last_message_id = 0, message_count = 0, exported_at = NULL WHERE room_id = $1`, roomID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListRoomMirrors returns every mirrored room
+func (s *AdminService) ListRoomMirrors(ctx context.Context) ([]models.RoomMirror, error) {
+	return listRoomMirrors(ctx, ``)
+}
+
+// GetRoomMirror returns the export state of one mirrored room
+func (s *AdminService) GetRoomMirror(ctx context.Context, roomID string) (*models.RoomMirror, error) {
+	mirrors, err := listRoomMirrors(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if len(mirrors) == 0 {
+		return nil, ErrNotFound
+	}
+	return &mirrors[0], nil
+}
+
+// listRoomMirrors lists all mirrors, or only roomID's when it is set
+func listRoomMirrors(ctx context.Context, roomID string) ([]models.RoomMirror, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT `+roomMirrorColumns+` FROM room_mirrors rm JOIN rooms r ON r.id = rm.room_id
+		WHERE $1 = '' OR rm.room_id = $1 ORDER BY rm.created_at`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mirrors := []models.RoomMirror{}
+	for rows.Next() {
+		m, err := scanRoomMirror(rows)
+		if err != nil {
+			return nil, err
+		}
+		mirrors = append(mirrors, *m)
+	}
+	return mirrors, rows.Err()
+}
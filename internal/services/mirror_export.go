@@ -0,0 +1,409 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+)
+
+// mirrorSettle keeps the export behind the newest messages so rows committed out of id
+// order aren't skipped by the incremental cursor
+const mirrorSettle = `INTERVAL '10 seconds'`
+
+// mirrorBatch is how many new messages are read per query while exporting
+const mirrorBatch = 500
+
+var mirrorRoomIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// MirrorExporter renders mirrored rooms into static HTML archives under dir:
+//
+//	<room>/index.html         overview, page list and client-side search
+//	<room>/page-N.html        messages in id order, a fixed number per page
+//	<room>/data/page-N.json   the same messages as JSON; doubles as the search index
+//	<room>/media/<file>       copies of voice messages, independent of upload namespaces
+//	<room>/manifest.json      room name, page count and export time
+//
+// Pages are append-only, so each export only rewrites the last page, any new pages and the index.
+type MirrorExporter struct {
+	dir       string
+	uploadDir string
+	pageSize  int
+	mu        sync.Mutex // Serializes exports; the job and admin-triggered rebuilds may overlap
+}
+
+// NewMirrorExporter creates an exporter writing to dir and copying media from uploadDir
+func NewMirrorExporter(dir, uploadDir string, pageSize int) *MirrorExporter {
+	if pageSize <= 0 {
+		pageSize = 200
+	}
+	return &MirrorExporter{dir: dir, uploadDir: uploadDir, pageSize: pageSize}
+}
+
+// mirrorEntry is one exported message
+type mirrorEntry struct {
+	ID         int          `json:"id"`
+	User       string       `json:"user"`
+	Text       string       `json:"text,omitempty"`
+	Media      string       `json:"media,omitempty"` // Path relative to the room directory
+	DurationMs int64        `json:"duration_ms,omitempty"`
+	System     bool         `json:"system,omitempty"`
+	Timestamp  int64        `json:"ts"`
+	ReplyTo    *mirrorReply `json:"reply_to,omitempty"`
+}
+
+type mirrorReply struct {
+	User string `json:"user"`
+	Text string `json:"text,omitempty"`
+}
+
+type mirrorManifest struct {
+	RoomID       string `json:"room_id"`
+	Name         string `json:"name"`
+	Pages        int    `json:"pages"`
+	MessageCount int    `json:"message_count"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+// roomDir returns the archive directory of a room, refusing ids that aren't safe path segments
+func (e *MirrorExporter) roomDir(roomID string) (string, error) {
+	if !mirrorRoomIDPattern.MatchString(roomID) {
+		return "", fmt.Errorf("room id %q can't be used as a directory name", roomID)
+	}
+	return filepath.Join(e.dir, roomID), nil
+}
+
+// Remove deletes a room's archive
+func (e *MirrorExporter) Remove(roomID string) error {
+	dir, err := e.roomDir(roomID)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return os.RemoveAll(dir)
+}
+
+// ExportAll brings every mirrored room up to date
+func (e *MirrorExporter) ExportAll(ctx context.Context) error {
+	mirrors, err := listRoomMirrors(ctx, "")
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, m := range mirrors {
+		if _, err := e.Export(ctx, m.RoomID); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("mirror %s: %w", m.RoomID, err)
+		}
+	}
+	return firstErr
+}
+
+// Export appends the room's messages newer than the last export to its archive and returns
+// how many were added. A mirror with no export state is rebuilt from scratch.
+func (e *MirrorExporter) Export(ctx context.Context, roomID string) (int, error) {
+	dir, err := e.roomDir(roomID)
+	if err != nil {
+		return 0, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Read the state under the lock so overlapping exports never append the same messages twice
+	mirrors, err := listRoomMirrors(ctx, roomID)
+	if err != nil {
+		return 0, err
+	}
+	if len(mirrors) == 0 {
+		return 0, ErrNotFound
+	}
+	m := mirrors[0]
+
+	messages, err := fetchMirrorMessages(ctx, m.RoomID, m.LastMessageID)
+	if err != nil {
+		return 0, err
+	}
+	if len(messages) == 0 && m.ExportedAt != nil {
+		return 0, nil
+	}
+
+	if m.ExportedAt == nil {
+		if err := os.RemoveAll(dir); err != nil {
+			return 0, err
+		}
+	}
+	for _, sub := range []string{"data", "media"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return 0, err
+		}
+	}
+
+	count := m.MessageCount
+	page := count/e.pageSize + 1
+	touched := map[int][]mirrorEntry{}
+	var entries []mirrorEntry
+	if count%e.pageSize != 0 {
+		if entries, err = e.readPage(dir, page); err != nil {
+			return 0, err
+		}
+	} else if page > 1 && len(messages) > 0 {
+		// The previous page is full and gains a link to the new one
+		prev, err := e.readPage(dir, page-1)
+		if err != nil {
+			return 0, err
+		}
+		touched[page-1] = prev
+	}
+
+	lastID := m.LastMessageID
+	for _, msg := range messages {
+		if len(entries) == e.pageSize {
+			touched[page] = entries
+			page++
+			entries = nil
+		}
+		entries = append(entries, e.entry(ctx, dir, msg))
+		lastID = msg.ID
+		count++
+	}
+	if len(entries) > 0 {
+		touched[page] = entries
+	}
+
+	pages := (count + e.pageSize - 1) / e.pageSize
+	name := m.RoomID
+	if m.Name != nil {
+		name = *m.Name
+	}
+	for p, pageEntries := range touched {
+		if err := writeJSONFile(filepath.Join(dir, "data", fmt.Sprintf("page-%d.json", p)), pageEntries); err != nil {
+			return 0, err
+		}
+		if err := renderMirrorFile(filepath.Join(dir, fmt.Sprintf("page-%d.html", p)), mirrorPageTemplate, map[string]interface{}{
+			"Name": name, "Page": p, "Pages": pages, "Entries": pageEntries,
+		}); err != nil {
+			return 0, err
+		}
+	}
+	now := time.Now()
+	manifest := mirrorManifest{RoomID: m.RoomID, Name: name, Pages: pages, MessageCount: count, UpdatedAt: now.UnixMilli()}
+	if err := writeJSONFile(filepath.Join(dir, "manifest.json"), manifest); err != nil {
+		return 0, err
+	}
+	pageList := make([]int, 0, pages)
+	for p := pages; p >= 1; p-- {
+		pageList = append(pageList, p)
+	}
+	if err := renderMirrorFile(filepath.Join(dir, "index.html"), mirrorIndexTemplate, map[string]interface{}{
+		"Name": name, "Count": count, "PageList": pageList, "UpdatedAt": now.UTC().Format(time.RFC1123),
+	}); err != nil {
+		return 0, err
+	}
+
+	if err := saveMirrorState(ctx, m.RoomID, lastID, count); err != nil {
+		return 0, err
+	}
+	return len(messages), nil
+}
+
+// fetchMirrorMessages returns the room's settled, non-expiring messages after afterID in id order.
+// Messages sent with a TTL are never published.
+func fetchMirrorMessages(ctx context.Context, roomID string, afterID int) ([]models.Message, error) {
+	var messages []models.Message
+	for {
+		batch, err := fetchMirrorBatch(ctx, roomID, afterID)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, batch...)
+		if len(batch) < mirrorBatch {
+			return messages, nil
+		}
+		afterID = batch[len(batch)-1].ID
+	}
+}
+
+func fetchMirrorBatch(ctx context.Context, roomID string, afterID int) ([]models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + messageColumns + ` FROM messages
+		WHERE room = $1 AND id > $2 AND expires_at IS NULL AND created_at < NOW() - ` + mirrorSettle + `
+		ORDER BY id LIMIT $3`
+	rows, err := db.Pool.Query(ctx, query, roomID, afterID, mirrorBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+	return messages, rows.Err()
+}
+
+func saveMirrorState(ctx context.Context, roomID string, lastID, count int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `UPDATE room_mirrors SET last_message_id = $1, message_count = $2, exported_at = NOW() WHERE room_id = $3`,
+		lastID, count, roomID)
+	return err
+}
+
+// entry converts a message, copying its voice file into the archive
+func (e *MirrorExporter) entry(ctx context.Context, dir string, msg models.Message) mirrorEntry {
+	entry := mirrorEntry{ID: msg.ID, User: msg.Username, System: msg.System, Timestamp: msg.CreatedAt.UnixMilli()}
+	if msg.Content != nil {
+		entry.Text = *msg.Content
+	}
+	if msg.ReplyTo != nil {
+		entry.ReplyTo = &mirrorReply{User: msg.ReplyTo.Username}
+		if msg.ReplyTo.Content != nil {
+			entry.ReplyTo.Text = *msg.ReplyTo.Content
+		}
+	}
+	if msg.Voice != nil && *msg.Voice != "" {
+		file := filepath.Base(*msg.Voice)
+		if err := copyFile(filepath.Join(e.uploadDir, filepath.FromSlash(ResolveUpload(ctx, "voices/"+file))), filepath.Join(dir, "media", file)); err == nil {
+			entry.Media = "media/" + file
+		}
+		if msg.VoiceMeta != nil {
+			entry.DurationMs = msg.VoiceMeta.DurationMs
+		}
+	}
+	return entry
+}
+
+func (e *MirrorExporter) readPage(dir string, page int) ([]mirrorEntry, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "data", fmt.Sprintf("page-%d.json", page)))
+	if err != nil {
+		return nil, err
+	}
+	var entries []mirrorEntry
+	return entries, json.Unmarshal(b, &entries)
+}
+
+// writeFileAtomic replaces path so readers never see a half-written file
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(v)
+	})
+}
+
+func renderMirrorFile(path string, tmpl *template.Template, data interface{}) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return tmpl.Execute(w, data)
+	})
+}
+
+// copyFile copies src to dst unless dst already exists
+func copyFile(src, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFileAtomic(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+var mirrorFuncs = template.FuncMap{
+	"time": func(ms int64) string { return time.UnixMilli(ms).UTC().Format("2006-01-02 15:04") },
+	"add":  func(a, b int) int { return a + b },
+	"duration": func(ms int64) string {
+		s := ms / 1000
+		return fmt.Sprintf("%d:%02d", s/60, s%60)
+	},
+}
+
+const mirrorStyle = `<style>
+body{font-family:system-ui,sans-serif;max-width:760px;margin:2em auto;padding:0 1em;color:#222}
+.msg{border-bottom:1px solid #eee;padding:.6em 0}.msg .meta{color:#777;font-size:.85em}
+.msg .text{white-space:pre-wrap;margin-top:.2em}.system{color:#555;font-style:italic}
+.reply{border-left:3px solid #ccc;padding-left:.5em;color:#666;font-size:.9em}
+nav{margin:1em 0}nav a{margin-right:1em}#results li{margin:.4em 0}
+</style>`
+
+var mirrorPageTemplate = template.Must(template.New("page").Funcs(mirrorFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Name}} — page {{.Page}}</title>` + mirrorStyle + `</head><body>
+<h1><a href="index.html">{{.Name}}</a></h1>
+<nav>{{if gt .Page 1}}<a href="page-{{add .Page -1}}.html">&larr; Older</a>{{end}}{{if lt .Page .Pages}}<a href="page-{{add .Page 1}}.html">Newer &rarr;</a>{{end}}</nav>
+{{range .Entries}}<div class="msg{{if .System}} system{{end}}" id="m-{{.ID}}">
+<div class="meta"><strong>{{.User}}</strong> · <a href="#m-{{.ID}}">{{time .Timestamp}}</a></div>
+{{with .ReplyTo}}<div class="reply"><strong>{{.User}}</strong>: {{.Text}}</div>{{end}}
+{{if .Media}}<audio controls preload="none" src="{{.Media}}"></audio>{{if .DurationMs}} {{duration .DurationMs}}{{end}}{{end}}
+{{if .Text}}<div class="text">{{.Text}}</div>{{end}}
+</div>
+{{end}}<nav>{{if gt .Page 1}}<a href="page-{{add .Page -1}}.html">&larr; Older</a>{{end}}{{if lt .Page .Pages}}<a href="page-{{add .Page 1}}.html">Newer &rarr;</a>{{end}}</nav>
+</body></html>
+`))
+
+var mirrorIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Name}}</title>` + mirrorStyle + `</head><body>
+<h1>{{.Name}}</h1>
+<p>{{.Count}} messages · updated {{.UpdatedAt}}</p>
+<input id="q" type="search" placeholder="Search messages" size="40"> <button id="go">Search</button>
+<ul id="results"></ul>
+<h2>Pages</h2>
+<ul>{{range .PageList}}<li><a href="page-{{.}}.html">Page {{.}}</a></li>{{end}}</ul>
+<script>
+document.getElementById('go').onclick = async function () {
+  var q = document.getElementById('q').value.trim().toLowerCase();
+  var out = document.getElementById('results');
+  out.textContent = '';
+  if (!q) return;
+  var manifest = await (await fetch('manifest.json')).json();
+  for (var p = manifest.pages; p >= 1; p--) {
+    var entries = await (await fetch('data/page-' + p + '.json')).json();
+    entries.forEach(function (m) {
+      if (!m.text || m.text.toLowerCase().indexOf(q) < 0) return;
+      var li = document.createElement('li'), a = document.createElement('a');
+      a.href = 'page-' + p + '.html#m-' + m.id;
+      a.textContent = m.user + ': ' + m.text;
+      li.appendChild(a);
+      out.appendChild(li);
+    });
+  }
+};
+</script>
+</body></html>
+`))
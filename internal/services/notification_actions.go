@@ -0,0 +1,68 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"chat-backend/internal/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// NotificationAction identifies the message a notification action applies to
+type NotificationAction struct {
+	UserID    int
+	Room      string
+	MessageID int
+}
+
+// notificationActionSecret is derived from JWT_SECRET but differs from it, so action
+// tokens can never be used as access tokens
+func notificationActionSecret() []byte {
+	return []byte(utils.GetEnv("JWT_SECRET", "secret") + ":notification_action")
+}
+
+// GenerateNotificationActionToken creates a short-lived token that lets the recipient
+// mark a message read or react to it from a notification without logging in.
+func GenerateNotificationActionToken(userID int, room string, messageID int) (string, error) {
+	ttl := utils.GetEnvDuration("NOTIFICATION_ACTION_TOKEN_TTL", 6*time.Hour)
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"room":    room,
+		"mid":     messageID,
+		"exp":     time.Now().Add(ttl).Unix(),
+		"typ":     "notification_action",
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(notificationActionSecret())
+}
+
+// ValidateNotificationActionToken parses an action token and returns what it grants
+func ValidateNotificationActionToken(tokenString string) (*NotificationAction, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return notificationActionSecret(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if typ, _ := claims["typ"].(string); typ != "notification_action" {
+		return nil, errors.New("invalid token type")
+	}
+
+	uid, _ := claims["user_id"].(float64)
+	mid, _ := claims["mid"].(float64)
+	room, _ := claims["room"].(string)
+	if uid == 0 || mid == 0 || room == "" {
+		return nil, errors.New("invalid token claims")
+	}
+	return &NotificationAction{UserID: int(uid), Room: room, MessageID: int(mid)}, nil
+}
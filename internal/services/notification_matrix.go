@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidNotificationSetting is returned for unknown event types or channels
+var ErrInvalidNotificationSetting = errors.New("invalid notification setting")
+
+// GetNotificationMatrix returns the user's notification switches with defaults filled in
+func (s *UserService) GetNotificationMatrix(ctx context.Context, userID int) (models.NotificationMatrix, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var matrix models.NotificationMatrix
+	err := db.Pool.QueryRow(ctx, `SELECT notification_matrix FROM users WHERE id = $1`, userID).Scan(&matrix)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return matrix.Resolved(), nil
+}
+
+// UpdateNotificationMatrix changes the cells present in changes and keeps the others
+func (s *UserService) UpdateNotificationMatrix(ctx context.Context, userID int, changes models.NotificationMatrix) (models.NotificationMatrix, error) {
+	for event, channels := range changes {
+		if !slices.Contains(models.NotificationEvents, event) {
+			return nil, fmt.Errorf("%w: unknown event type %q", ErrInvalidNotificationSetting, event)
+		}
+		for channel := range channels {
+			if !slices.Contains(models.NotificationChannels, channel) {
+				return nil, fmt.Errorf("%w: unknown channel %q", ErrInvalidNotificationSetting, channel)
+			}
+		}
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var matrix models.NotificationMatrix
+	err = tx.QueryRow(ctx, `SELECT notification_matrix FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&matrix)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if matrix == nil {
+		matrix = models.NotificationMatrix{}
+	}
+	for event, channels := range changes {
+		if matrix[event] == nil {
+			matrix[event] = map[string]bool{}
+		}
+		for channel, enabled := range channels {
+			matrix[event][channel] = enabled
+		}
+	}
+	stored, err := json.Marshal(matrix)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET notification_matrix = $1 WHERE id = $2`, stored, userID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return matrix.Resolved(), nil
+}
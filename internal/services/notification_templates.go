@@ -0,0 +1,173 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode/utf8"
+)
+
+// NotificationData is the input available to notification templates
+type NotificationData struct {
+	Sender string // Display name of the sender
+	Text   string // Message text or voice caption, already truncated
+	RoomID string
+}
+
+// NotificationPayload is the rendered title/body shown by clients (WS banner or push)
+type NotificationPayload struct {
+	Title       string `json:"title"`
+	Body        string `json:"body"`
+	CollapseKey string `json:"collapse_key"`
+}
+
+// notificationTemplateText is an uncompiled title/body template pair
+type notificationTemplateText struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// notificationTemplateSource is the JSON shape of NOTIFICATION_TEMPLATES_FILE:
+// {"en": {"message": {"title": "...", "body": "..."}, ...}, "es": {...}}
+type notificationTemplateSource map[string]map[string]notificationTemplateText
+
+// defaultNotificationTemplates covers the built-in event types. "hidden" is used when the
+// recipient turned message previews off and must not contain message content.
+var defaultNotificationTemplates = notificationTemplateSource{
+	"en": {
+		"message":  {Title: "{{.Sender}}", Body: "{{.Text}}"},
+		"voice":    {Title: "{{.Sender}}", Body: "{{if .Text}}🎤 {{.Text}}{{else}}Voice message{{end}}"},
+		"file":     {Title: "{{.Sender}}", Body: "📎 {{.Text}}"},
+		"sticker":  {Title: "{{.Sender}}", Body: "{{if .Text}}{{.Text}} {{end}}Sticker"},
+		"system":   {Title: "{{.Sender}}", Body: "{{.Text}}"},
+		"reaction": {Title: "{{.Sender}}", Body: "Reacted {{.Text}} to your message"},
+		"mention":  {Title: "{{.Sender}} mentioned you", Body: "{{.Text}}"},
+		"hidden":   {Title: "New message", Body: "New message"},
+	},
+	"es": {
+		"message":  {Title: "{{.Sender}}", Body: "{{.Text}}"},
+		"voice":    {Title: "{{.Sender}}", Body: "{{if .Text}}🎤 {{.Text}}{{else}}Mensaje de voz{{end}}"},
+		"file":     {Title: "{{.Sender}}", Body: "📎 {{.Text}}"},
+		"sticker":  {Title: "{{.Sender}}", Body: "{{if .Text}}{{.Text}} {{end}}Sticker"},
+		"system":   {Title: "{{.Sender}}", Body: "{{.Text}}"},
+		"reaction": {Title: "{{.Sender}}", Body: "Reaccionó {{.Text}} a tu mensaje"},
+		"mention":  {Title: "{{.Sender}} te mencionó", Body: "{{.Text}}"},
+		"hidden":   {Title: "Nuevo mensaje", Body: "Nuevo mensaje"},
+	},
+}
+
+// notificationPreviewRunes caps the message text included in a notification body
+const notificationPreviewRunes = 100
+
+type notificationTemplate struct {
+	title *template.Template
+	body  *template.Template
+}
+
+// NotificationTemplates renders localized notification payloads
+type NotificationTemplates struct {
+	mu           sync.RWMutex // Guards templates while Replace swaps them on config reload
+	templates    map[string]map[string]notificationTemplate
+	fallbackLang string
+}
+
+// Replace swaps in the templates of other, e.g. after NOTIFICATION_TEMPLATES_FILE changed
+func (nt *NotificationTemplates) Replace(other *NotificationTemplates) {
+	nt.mu.Lock()
+	nt.templates, nt.fallbackLang = other.templates, other.fallbackLang
+	nt.mu.Unlock()
+}
+
+// LoadNotificationTemplates compiles the built-in templates and, if path is set, overlays
+// the templates from that JSON file (per language and event type).
+func LoadNotificationTemplates(path string) (*NotificationTemplates, error) {
+	src := notificationTemplateSource{}
+	for lang, events := range defaultNotificationTemplates {
+		src[lang] = events
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var custom notificationTemplateSource
+		if err := json.Unmarshal(b, &custom); err != nil {
+			return nil, fmt.Errorf("invalid notification templates: %w", err)
+		}
+		for lang, events := range custom {
+			merged := make(map[string]notificationTemplateText)
+			for event, t := range src[lang] {
+				merged[event] = t
+			}
+			for event, t := range events {
+				merged[event] = t
+			}
+			src[lang] = merged
+		}
+	}
+
+	nt := &NotificationTemplates{templates: make(map[string]map[string]notificationTemplate), fallbackLang: "en"}
+	for lang, events := range src {
+		nt.templates[lang] = make(map[string]notificationTemplate)
+		for event, t := range events {
+			title, err := template.New(lang + "." + event + ".title").Parse(t.Title)
+			if err != nil {
+				return nil, err
+			}
+			body, err := template.New(lang + "." + event + ".body").Parse(t.Body)
+			if err != nil {
+				return nil, err
+			}
+			nt.templates[lang][event] = notificationTemplate{title: title, body: body}
+		}
+	}
+	return nt, nil
+}
+
+func (nt *NotificationTemplates) lookup(lang, event string) (notificationTemplate, bool) {
+	// Try the exact language, then the base language ("pt-BR" -> "pt"), then the fallback
+	candidates := []string{lang}
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		candidates = append(candidates, lang[:i])
+	}
+	nt.mu.RLock()
+	defer nt.mu.RUnlock()
+	candidates = append(candidates, nt.fallbackLang)
+	for _, l := range candidates {
+		if t, ok := nt.templates[l][event]; ok {
+			return t, true
+		}
+	}
+	return notificationTemplate{}, false
+}
+
+// Render builds the payload for an event type in the recipient's language.
+// With preview disabled the "hidden" template is used so no content leaks.
+func (nt *NotificationTemplates) Render(event, lang string, preview bool, data NotificationData) NotificationPayload {
+	if !preview {
+		event = "hidden"
+	}
+	if utf8.RuneCountInString(data.Text) > notificationPreviewRunes {
+		data.Text = string([]rune(data.Text)[:notificationPreviewRunes]) + "…"
+	}
+
+	payload := NotificationPayload{CollapseKey: "room:" + data.RoomID}
+	t, ok := nt.lookup(lang, event)
+	if !ok {
+		payload.Title, payload.Body = "New message", "New message"
+		return payload
+	}
+	var buf bytes.Buffer
+	if err := t.title.Execute(&buf, data); err == nil {
+		payload.Title = buf.String()
+	}
+	buf.Reset()
+	if err := t.body.Execute(&buf, data); err == nil {
+		payload.Body = buf.String()
+	}
+	return payload
+}
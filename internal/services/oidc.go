@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidClient = errors.New("invalid_client")
+	ErrInvalidGrant  = errors.New("invalid_grant")
+)
+
+// OIDCProvider issues authorization codes, ID tokens and access tokens for first-party
+// companion apps. Tokens are signed with RS256 so they can never pass ValidateToken.
+type OIDCProvider struct {
+	issuer   string
+	clients  map[string]models.OIDCClient
+	key      *rsa.PrivateKey
+	keyID    string
+	codeTTL  time.Duration
+	tokenTTL time.Duration
+}
+
+// LoadOIDCProvider reads the clients from clientsFile (a JSON array of models.OIDCClient)
+// and the RSA signing key from keyFile (PEM, PKCS#1 or PKCS#8). Without a key file an
+// ephemeral key is generated, which invalidates issued tokens on restart.
+func LoadOIDCProvider(issuer, clientsFile, keyFile string, codeTTL, tokenTTL time.Duration) (*OIDCProvider, error) {
+	b, err := os.ReadFile(clientsFile)
+	if err != nil {
+		return nil, err
+	}
+	var list []models.OIDCClient
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("invalid OIDC clients: %w", err)
+	}
+	clients := make(map[string]models.OIDCClient, len(list))
+	for _, c := range list {
+		if c.ClientID == "" || c.ClientSecret == "" || len(c.RedirectURIs) == 0 {
+			return nil, fmt.Errorf("invalid OIDC client %q: client_id, client_secret and redirect_uris are required", c.ClientID)
+		}
+		clients[c.ClientID] = c
+	}
+
+	var key *rsa.PrivateKey
+	if keyFile != "" {
+		if key, err = readRSAKey(keyFile); err != nil {
+			return nil, err
+		}
+	} else if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		return nil, err
+	}
+
+	// The key id is derived from the public key so it changes whenever the key does
+	pub := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+	sum := sha256.Sum256(pub)
+
+	return &OIDCProvider{
+		issuer:   strings.TrimRight(issuer, "/"),
+		clients:  clients,
+		key:      key,
+		keyID:    hex.EncodeToString(sum[:8]),
+		codeTTL:  codeTTL,
+		tokenTTL: tokenTTL,
+	}, nil
+}
+
+func readRSAKey(path string) (*rsa.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("invalid OIDC signing key: no PEM block")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC signing key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid OIDC signing key: not an RSA key")
+	}
+	return key, nil
+}
+
+// Client returns a registered client and checks that redirectURI is one of its redirect URIs
+func (p *OIDCProvider) Client(clientID, redirectURI string) (*models.OIDCClient, error) {
+	c, ok := p.clients[clientID]
+	if !ok || !slices.Contains(c.RedirectURIs, redirectURI) {
+		return nil, ErrInvalidClient
+	}
+	return &c, nil
+}
+
+// AuthenticateClient checks a client's credentials for the token endpoint
+func (p *OIDCProvider) AuthenticateClient(clientID, secret string) (*models.OIDCClient, error) {
+	c, ok := p.clients[clientID]
+	if !ok || subtle.ConstantTimeCompare([]byte(c.ClientSecret), []byte(secret)) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return &c, nil
+}
+
+func hashOIDCCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueCode stores a single-use authorization code for userID
+func (p *OIDCProvider) IssueCode(ctx context.Context, clientID string, userID int, redirectURI, scope, nonce string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := base64.RawURLEncoding.EncodeToString(buf)
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO oidc_auth_codes (code_hash, client_id, user_id, redirect_uri, scope, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+	`, hashOIDCCode(code), clientID, userID, redirectURI, scope, nonce, time.Now().Add(p.codeTTL))
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeCode redeems an authorization code for an ID token and access token.
+// Codes can be redeemed once, only by the client they were issued to.
+func (p *OIDCProvider) ExchangeCode(ctx context.Context, client *models.OIDCClient, code, redirectURI string) (*models.OIDCTokenResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var clientID, storedRedirect, scope, username string
+	var nonce, email *string
+	var userID int
+	err := db.Pool.QueryRow(ctx, `
+		UPDATE oidc_auth_codes c SET used_at = NOW()
+		FROM users u
+		WHERE c.code_hash = $1 AND c.used_at IS NULL AND c.expires_at > NOW() AND u.id = c.user_id
+		RETURNING c.client_id, c.user_id, c.redirect_uri, c.scope, c.nonce, u.username, u.email
+	`, hashOIDCCode(code)).Scan(&clientID, &userID, &storedRedirect, &scope, &nonce, &username, &email)
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+	if clientID != client.ClientID || storedRedirect != redirectURI {
+		return nil, ErrInvalidGrant
+	}
+
+	now := time.Now()
+	idClaims := jwt.MapClaims{
+		"iss":                p.issuer,
+		"sub":                fmt.Sprint(userID),
+		"aud":                client.ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(p.tokenTTL).Unix(),
+		"auth_time":          now.Unix(),
+		"preferred_username": username,
+	}
+	if nonce != nil {
+		idClaims["nonce"] = *nonce
+	}
+	if hasScope(scope, "email") && email != nil {
+		idClaims["email"] = *email
+	}
+	idToken, err := p.sign(idClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := p.sign(jwt.MapClaims{
+		"iss":   p.issuer,
+		"sub":   fmt.Sprint(userID),
+		"aud":   client.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(p.tokenTTL).Unix(),
+		"scope": scope,
+		"typ":   "oidc_access",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OIDCTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(p.tokenTTL.Seconds()),
+		IDToken:     idToken,
+		Scope:       scope,
+	}, nil
+}
+
+func (p *OIDCProvider) sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.keyID
+	return token.SignedString(p.key)
+}
+
+// ValidateAccessToken returns the user id and scope granted by an OIDC access token
+func (p *OIDCProvider) ValidateAccessToken(tokenString string) (int, string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return &p.key.PublicKey, nil
+	}, jwt.WithIssuer(p.issuer))
+	if err != nil {
+		return 0, "", err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return 0, "", errors.New("invalid token")
+	}
+	if typ, _ := claims["typ"].(string); typ != "oidc_access" {
+		return 0, "", errors.New("invalid token type")
+	}
+	sub, _ := claims["sub"].(string)
+	var userID int
+	if _, err := fmt.Sscan(sub, &userID); err != nil || userID == 0 {
+		return 0, "", errors.New("invalid token claims")
+	}
+	scope, _ := claims["scope"].(string)
+	return userID, scope, nil
+}
+
+// UserInfo returns the standard claims for userID allowed by scope
+func (p *OIDCProvider) UserInfo(ctx context.Context, userID int, scope string) (map[string]interface{}, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var username string
+	var email, first, last *string
+	err := db.Pool.QueryRow(ctx, `SELECT username, email, first_name, last_name FROM users WHERE id = $1`, userID).
+		Scan(&username, &email, &first, &last)
+	if err != nil {
+		return nil, err
+	}
+
+	info := map[string]interface{}{
+		"sub":                fmt.Sprint(userID),
+		"preferred_username": username,
+	}
+	if hasScope(scope, "email") && email != nil {
+		info["email"] = *email
+	}
+	if hasScope(scope, "profile") {
+		info["name"] = username
+		if first != nil {
+			info["given_name"] = *first
+		}
+		if last != nil {
+			info["family_name"] = *last
+		}
+	}
+	return info, nil
+}
+
+// Discovery returns the OpenID Provider metadata document
+func (p *OIDCProvider) Discovery() map[string]interface{} {
+	return map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/api/oidc/authorize",
+		"token_endpoint":                        p.issuer + "/api/oidc/token",
+		"userinfo_endpoint":                     p.issuer + "/api/oidc/userinfo",
+		"jwks_uri":                              p.issuer + "/api/oidc/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"claims_supported":                      []string{"sub", "preferred_username", "name", "given_name", "family_name", "email"},
+	}
+}
+
+// JWKS returns the public signing key as a JSON Web Key Set
+func (p *OIDCProvider) JWKS() map[string]interface{} {
+	pub := p.key.PublicKey
+	return map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": p.keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	}
+}
+
+// hasScope reports whether the space-separated scope list contains want
+func hasScope(scope, want string) bool {
+	return slices.Contains(strings.Fields(scope), want)
+}
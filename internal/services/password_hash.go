@@ -0,0 +1,228 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"chat-backend/internal/utils"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher is one password hashing algorithm. Stored hashes identify their algorithm
+// (and parameters) by their encoding, so several algorithms can be verified side by side
+// and users move to the current one as they log in.
+type PasswordHasher interface {
+	// Name is the value PASSWORD_HASH selects the hasher with
+	Name() string
+	Hash(password string) (string, error)
+	// Recognizes reports whether encoded was produced by this algorithm
+	Recognizes(encoded string) bool
+	Verify(encoded, password string) bool
+	// Outdated reports whether encoded uses weaker parameters than new hashes would
+	Outdated(encoded string) bool
+}
+
+var (
+	passwordHashersMu sync.RWMutex
+	passwordHashers   = map[string]PasswordHasher{}
+	// passwordHasher hashes new passwords; set by ConfigurePasswordHashing
+	passwordHasher PasswordHasher = NewArgon2idHasher(DefaultArgon2idParams)
+)
+
+// RegisterPasswordHasher makes an algorithm available for verifying stored hashes and for
+// selection with PASSWORD_HASH. Registering a name again replaces its parameters.
+func RegisterPasswordHasher(h PasswordHasher) {
+	passwordHashersMu.Lock()
+	defer passwordHashersMu.Unlock()
+	passwordHashers[h.Name()] = h
+}
+
+func init() {
+	RegisterPasswordHasher(NewBcryptHasher(bcrypt.DefaultCost))
+	RegisterPasswordHasher(NewArgon2idHasher(DefaultArgon2idParams))
+}
+
+// ConfigurePasswordHashing selects the algorithm for new hashes from PASSWORD_HASH
+// ("argon2id", the default, or "bcrypt") and its parameters from ARGON2_MEMORY_KB,
+// ARGON2_TIME, ARGON2_THREADS and BCRYPT_COST
+func ConfigurePasswordHashing() error {
+	params := Argon2idParams{
+		MemoryKB: uint32(utils.GetEnvInt("ARGON2_MEMORY_KB", int(DefaultArgon2idParams.MemoryKB))),
+		Time:     uint32(utils.GetEnvInt("ARGON2_TIME", int(DefaultArgon2idParams.Time))),
+		Threads:  uint8(utils.GetEnvInt("ARGON2_THREADS", int(DefaultArgon2idParams.Threads))),
+		KeyLen:   DefaultArgon2idParams.KeyLen,
+		SaltLen:  DefaultArgon2idParams.SaltLen,
+	}
+	if params.MemoryKB < 8*uint32(params.Threads) || params.Time < 1 || params.Threads < 1 {
+		return fmt.Errorf("invalid argon2id parameters")
+	}
+	cost := utils.GetEnvInt("BCRYPT_COST", bcrypt.DefaultCost)
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	RegisterPasswordHasher(NewArgon2idHasher(params))
+	RegisterPasswordHasher(NewBcryptHasher(cost))
+
+	name := utils.GetEnv("PASSWORD_HASH", "argon2id")
+	passwordHashersMu.Lock()
+	defer passwordHashersMu.Unlock()
+	h, ok := passwordHashers[name]
+	if !ok {
+		return fmt.Errorf("unknown password hash %q", name)
+	}
+	passwordHasher = h
+	return nil
+}
+
+// HashPassword hashes a new password with the configured algorithm
+func HashPassword(password string) (string, error) {
+	passwordHashersMu.RLock()
+	h := passwordHasher
+	passwordHashersMu.RUnlock()
+	return h.Hash(password)
+}
+
+// VerifyPassword checks password against a stored hash of any registered algorithm.
+// rehash is set when it matched but should be replaced by HashPassword, because it uses
+// another algorithm or weaker parameters than the configured ones.
+func VerifyPassword(encoded, password string) (ok, rehash bool) {
+	passwordHashersMu.RLock()
+	current := passwordHasher
+	var h PasswordHasher
+	for _, candidate := range passwordHashers {
+		if candidate.Recognizes(encoded) {
+			h = candidate
+			break
+		}
+	}
+	passwordHashersMu.RUnlock()
+	if h == nil || !h.Verify(encoded, password) {
+		return false, false
+	}
+	return true, h.Name() != current.Name() || h.Outdated(encoded)
+}
+
+// BcryptHasher is the original algorithm; its hashes start with $2a$, $2b$ or $2y$
+type BcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{cost: cost}
+}
+
+func (h *BcryptHasher) Name() string {
+	return "bcrypt"
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	return string(hash), err
+}
+
+func (h *BcryptHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *BcryptHasher) Verify(encoded, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+func (h *BcryptHasher) Outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < h.cost
+}
+
+// Argon2idParams are the cost parameters of argon2id hashes
+type Argon2idParams struct {
+	MemoryKB uint32
+	Time     uint32
+	Threads  uint8
+	KeyLen   uint32
+	SaltLen  int
+}
+
+// DefaultArgon2idParams follow the OWASP recommendation of 64 MiB, 3 passes
+var DefaultArgon2idParams = Argon2idParams{MemoryKB: 64 * 1024, Time: 3, Threads: 2, KeyLen: 32, SaltLen: 16}
+
+// Argon2idHasher stores hashes in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+func (h *Argon2idHasher) Name() string {
+	return "argon2id"
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := h.params
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.MemoryKB, p.Threads, p.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.MemoryKB, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) bool {
+	p, salt, key, err := parseArgon2id(encoded)
+	if err != nil {
+		return false
+	}
+	got := argon2.IDKey([]byte(password), salt, p.Time, p.MemoryKB, p.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(got, key) == 1
+}
+
+func (h *Argon2idHasher) Outdated(encoded string) bool {
+	p, salt, key, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.MemoryKB < h.params.MemoryKB || p.Time < h.params.Time || p.Threads < h.params.Threads ||
+		uint32(len(key)) < h.params.KeyLen || len(salt) < h.params.SaltLen
+}
+
+// errInvalidArgon2id is returned for stored hashes that can't be parsed
+var errInvalidArgon2id = errors.New("invalid argon2id hash")
+
+func parseArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var p Argon2idParams
+	parts := strings.Split(encoded, "$")
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, errInvalidArgon2id
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, errInvalidArgon2id
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.MemoryKB, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, errInvalidArgon2id
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, errInvalidArgon2id
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 || p.Time == 0 || p.Threads == 0 {
+		return p, nil, nil, errInvalidArgon2id
+	}
+	return p, salt, key, nil
+}
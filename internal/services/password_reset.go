@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MinPasswordLength applies to passwords set by a change or reset
+const MinPasswordLength = 8
+
+var (
+	ErrWeakPassword      = errors.New("password must be at least 8 characters")
+	ErrInvalidResetToken = errors.New("reset link is invalid or has expired")
+	ErrSamePassword      = errors.New("new password must differ from the current one")
+)
+
+// PasswordResetTTL is how long a reset link works
+func PasswordResetTTL() time.Duration {
+	return utils.GetEnvDuration("PASSWORD_RESET_TTL", time.Hour)
+}
+
+func validateNewPassword(password string) error {
+	if len([]rune(password)) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+// ChangePassword replaces the user's password after checking the current one. Like a reset
+// it signs out the user's devices, except currentDeviceID, the one making the change.
+func (s *UserService) ChangePassword(ctx context.Context, userID int, currentDeviceID, oldPassword, newPassword string) error {
+	if err := validateNewPassword(newPassword); err != nil {
+		return err
+	}
+	if oldPassword == newPassword {
+		return ErrSamePassword
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := s.checkPassword(ctx, userID, oldPassword); err != nil {
+		return err
+	}
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, hash, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE user_devices SET revoked_at = NOW() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`, userID, currentDeviceID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RequestPasswordReset issues a reset token for the account with this email or username.
+// It returns nil without an error when there is no such account or it has no email, so
+// callers answer the same either way. Earlier unused tokens of the account stop working.
+func (s *UserService) RequestPasswordReset(ctx context.Context, req models.ForgotPasswordRequest) (*models.PasswordReset, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var r models.PasswordReset
+	var email *string
+	var err error
+	if e := strings.TrimSpace(req.Email); e != "" {
+		err = db.Pool.QueryRow(ctx, `SELECT id, username, email FROM users WHERE lower(email) = lower($1)`, e).Scan(&r.UserID, &r.Username, &email)
+	} else if u := strings.TrimSpace(req.Username); u != "" {
+		err = db.Pool.QueryRow(ctx, `SELECT id, username, email FROM users WHERE username = $1`, u).Scan(&r.UserID, &r.Username, &email)
+	} else {
+		return nil, nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && (email == nil || *email == "")) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Email = *email
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	r.Token = token
+	r.ExpiresAt = time.Now().Add(PasswordResetTTL())
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL`, r.UserID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO password_reset_tokens (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`,
+		hashAPIKey(token), r.UserID, r.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ResetPassword sets a new password with a reset token, which is used up. Every device of
+// the account is signed out, since the reset may follow a compromise.
+func (s *UserService) ResetPassword(ctx context.Context, token, newPassword string) (int, error) {
+	if err := validateNewPassword(newPassword); err != nil {
+		return 0, err
+	}
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	err = tx.QueryRow(ctx, `UPDATE password_reset_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`, hashAPIKey(token)).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrInvalidResetToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, hash, userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE user_devices SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit(ctx)
+}
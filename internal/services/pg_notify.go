@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/utils"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// pgNotifyMaxPayload stays under Postgres' 8000 byte NOTIFY limit
+	pgNotifyMaxPayload = 7900
+	// pgSpillPrefix marks notifications whose payload is in cluster_event_payloads
+	pgSpillPrefix = "@spill:"
+)
+
+// PGNotifyTransport carries cross-instance events over Postgres LISTEN/NOTIFY, so replicas
+// can share broadcasts without extra infrastructure. Delivery is at most once: events sent
+// while a listener reconnects are lost.
+type PGNotifyTransport struct {
+	channel string
+}
+
+// NewPGNotifyTransport returns a transport using the given NOTIFY channel
+func NewPGNotifyTransport(channel string) *PGNotifyTransport {
+	return &PGNotifyTransport{channel: channel}
+}
+
+// Publish notifies every listener, this instance included. Payloads over the NOTIFY limit
+// are stored in cluster_event_payloads and referenced by id.
+func (t *PGNotifyTransport) Publish(ctx context.Context, payload []byte) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	message := string(payload)
+	if len(payload) > pgNotifyMaxPayload {
+		var id int64
+		if err := db.Pool.QueryRow(ctx, `INSERT INTO cluster_event_payloads (payload) VALUES ($1) RETURNING id`, message).Scan(&id); err != nil {
+			return err
+		}
+		if _, err := db.Pool.Exec(ctx, `DELETE FROM cluster_event_payloads WHERE created_at < NOW() - INTERVAL '5 minutes'`); err != nil {
+			utils.LogError(err, "cluster payload cleanup")
+		}
+		message = pgSpillPrefix + strconv.FormatInt(id, 10)
+	}
+	_, err := db.Pool.Exec(ctx, `SELECT pg_notify($1, $2)`, t.channel, message)
+	return err
+}
+
+// Subscribe listens on a dedicated connection (outside the pool) and calls handle for every
+// event until ctx is cancelled, reconnecting with backoff when the connection drops.
+func (t *PGNotifyTransport) Subscribe(ctx context.Context, handle func(payload []byte)) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		connected, err := t.listen(ctx, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		utils.LogError(err, "cluster LISTEN")
+		if connected {
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// listen runs one LISTEN session; connected reports whether it got as far as listening
+func (t *PGNotifyTransport) listen(ctx context.Context, handle func(payload []byte)) (connected bool, err error) {
+	conn, err := pgx.ConnectConfig(ctx, db.Pool.Config().ConnConfig.Copy())
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, `LISTEN `+pgx.Identifier{t.channel}.Sanitize()); err != nil {
+		return false, err
+	}
+	log.Printf("Listening for cluster events on channel %q", t.channel)
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		payload := n.Payload
+		if id, ok := strings.CutPrefix(payload, pgSpillPrefix); ok {
+			if err := conn.QueryRow(ctx, `SELECT payload FROM cluster_event_payloads WHERE id = $1`, id).Scan(&payload); err != nil {
+				utils.LogError(err, "cluster payload "+id)
+				continue
+			}
+		}
+		handle([]byte(payload))
+	}
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrPinLimit         = errors.New("room pin limit reached")
+	ErrAlreadyPinned    = errors.New("message is already pinned")
+	ErrPinOrderMismatch = errors.New("message_ids must list every pinned message exactly once")
+)
+
+// appendScanner scans extra columns selected after messageColumns
+type appendScanner struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (a appendScanner) Scan(dest ...interface{}) error {
+	return a.row.Scan(append(dest, a.extra...)...)
+}
+
+// lockRoomPins serializes pin changes in a room for the rest of tx
+func lockRoomPins(ctx context.Context, tx pgx.Tx, roomID string) error {
+	var id string
+	err := tx.QueryRow(ctx, `SELECT id FROM rooms WHERE id = $1 FOR UPDATE`, roomID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// ListPins returns the room's pinned messages in display order
+func (s *ChatService) ListPins(ctx context.Context, roomID string) ([]models.PinnedMessage, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + messageColumns + `, p.position, p.pinned_by, p.pinned_at
+		FROM pinned_messages p JOIN messages ON messages.id = p.message_id
+		WHERE p.room_id = $1 AND ` + notExpired + `
+		ORDER BY p.position`
+	rows, err := db.Pool.Query(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pins := []models.PinnedMessage{}
+	for rows.Next() {
+		var pin models.PinnedMessage
+		msg, err := scanMessage(appendScanner{row: rows, extra: []interface{}{&pin.Position, &pin.PinnedBy, &pin.PinnedAt}})
+		if err != nil {
+			return nil, err
+		}
+		pin.Message = *msg
+		pins = append(pins, pin)
+	}
+	return pins, rows.Err()
+}
+
+// PinMessage pins a message of the room at the end of the pin list.
+// limit caps the number of pins per room; 0 means unlimited.
+func (s *ChatService) PinMessage(ctx context.Context, roomID string, messageID, userID, limit int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockRoomPins(ctx, tx, roomID); err != nil {
+		return err
+	}
+
+	var count, next int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*), COALESCE(MAX(position) + 1, 0) FROM pinned_messages WHERE room_id = $1`, roomID).Scan(&count, &next); err != nil {
+		return err
+	}
+	if limit > 0 && count >= limit {
+		return fmt.Errorf("%w (%d)", ErrPinLimit, limit)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO pinned_messages (room_id, message_id, pinned_by, position)
+		SELECT $1, id, $3, $4 FROM messages WHERE id = $2 AND room = $1
+		ON CONFLICT (room_id, message_id) DO NOTHING
+	`, roomID, messageID, userID, next)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		var exists bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pinned_messages WHERE room_id = $1 AND message_id = $2)`, roomID, messageID).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return ErrAlreadyPinned
+		}
+		return ErrNotFound
+	}
+	return tx.Commit(ctx)
+}
+
+// UnpinMessage removes a pin and closes the gap in the ordering
+func (s *ChatService) UnpinMessage(ctx context.Context, roomID string, messageID int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockRoomPins(ctx, tx, roomID); err != nil {
+		return err
+	}
+	var position int
+	err = tx.QueryRow(ctx, `DELETE FROM pinned_messages WHERE room_id = $1 AND message_id = $2 RETURNING position`, roomID, messageID).Scan(&position)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE pinned_messages SET position = position - 1 WHERE room_id = $1 AND position > $2`, roomID, position); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ReorderPins sets the pin order to messageIDs, which must be a permutation of the current pins
+func (s *ChatService) ReorderPins(ctx context.Context, roomID string, messageIDs []int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockRoomPins(ctx, tx, roomID); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `SELECT message_id FROM pinned_messages WHERE room_id = $1`, roomID)
+	if err != nil {
+		return err
+	}
+	current := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		current[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(messageIDs) != len(current) {
+		return ErrPinOrderMismatch
+	}
+	seen := make(map[int]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		if !current[id] || seen[id] {
+			return ErrPinOrderMismatch
+		}
+		seen[id] = true
+	}
+
+	ids := make([]int64, len(messageIDs))
+	for i, id := range messageIDs {
+		ids[i] = int64(id)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE pinned_messages p SET position = o.position - 1
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS o(message_id, position)
+		WHERE p.room_id = $1 AND p.message_id = o.message_id
+	`, roomID, ids)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"chat-backend/internal/db"
+)
+
+// TouchLastSeen records that userID is or just was connected and returns the stored time
+func (s *ChatService) TouchLastSeen(ctx context.Context, userID int) (time.Time, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var at time.Time
+	err := db.Pool.QueryRow(ctx, `UPDATE users SET last_seen_at = NOW() WHERE id = $1 RETURNING last_seen_at`, userID).Scan(&at)
+	return at, err
+}
+
+// GetLastSeen returns last_seen_at for each existing user in userIDs; users that never
+// connected map to nil and unknown IDs are absent
+func (s *ChatService) GetLastSeen(ctx context.Context, userIDs []int) (map[int]*time.Time, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Read(ctx).Query(ctx, `SELECT id, last_seen_at FROM users WHERE id = ANY($1)`, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lastSeen := make(map[int]*time.Time, len(userIDs))
+	for rows.Next() {
+		var id int
+		var at *time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		lastSeen[id] = at
+	}
+	return lastSeen, rows.Err()
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+)
+
+// ErrUnknownPushPlatform is returned when registering a token for a platform that isn't configured
+var ErrUnknownPushPlatform = errors.New("push platform is not enabled")
+
+// pushSendTimeout bounds one delivery (all of a user's devices)
+const pushSendTimeout = 30 * time.Second
+
+// pushHoldTick is how often held pushes are checked for release
+const pushHoldTick = 200 * time.Millisecond
+
+var (
+	pushSent      = metrics.NewCounterVec("push_sent_total", "Push notifications by platform and outcome", "platform", "result")
+	pushDropped   = metrics.NewCounter("push_dropped_total", "Push notifications not queued because the outbox was full")
+	pushRetracted = metrics.NewCounter("push_retracted_total", "Held push notifications dropped because their message was unsent")
+)
+
+// pushJob is one notification waiting in the outbox
+type pushJob struct {
+	userID       int
+	messageID    int
+	notification PushNotification
+	due          time.Time // Held until then so the message can still be unsent
+}
+
+// NotificationService delivers push notifications to the registered devices of users who
+// have no live connection. Pushes are queued in an in-memory outbox and sent by workers so
+// slow push services never hold up message handling; a full outbox drops pushes. Pushes
+// can be held back for the undo send window, and are dropped if their message is retracted
+// meanwhile.
+type NotificationService struct {
+	senders map[string]PushSender // Platform -> sender
+	outbox  chan pushJob
+
+	mu   sync.Mutex
+	held []pushJob
+}
+
+// NewNotificationServiceFromEnv enables FCM when FCM_CREDENTIALS_FILE is set and APNs when
+// APNS_KEY_FILE is set (with APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC). Returns nil when
+// neither is configured.
+func NewNotificationServiceFromEnv() (*NotificationService, error) {
+	senders := make(map[string]PushSender)
+	if file := utils.GetEnv("FCM_CREDENTIALS_FILE", ""); file != "" {
+		fcm, err := NewFCMSender(file)
+		if err != nil {
+			return nil, err
+		}
+		senders[models.PushFCM] = fcm
+	}
+	if file := utils.GetEnv("APNS_KEY_FILE", ""); file != "" {
+		apns, err := NewAPNsSender(file, utils.GetEnv("APNS_KEY_ID", ""), utils.GetEnv("APNS_TEAM_ID", ""),
+			utils.GetEnv("APNS_TOPIC", ""), utils.GetEnv("APNS_ENVIRONMENT", "production") == "sandbox")
+		if err != nil {
+			return nil, err
+		}
+		senders[models.PushAPNs] = apns
+	}
+	if len(senders) == 0 {
+		return nil, nil
+	}
+	return NewNotificationService(senders, utils.GetEnvInt("PUSH_OUTBOX", 1000)), nil
+}
+
+// NewNotificationService returns a service sending through senders; call Start to deliver
+func NewNotificationService(senders map[string]PushSender, outboxSize int) *NotificationService {
+	return &NotificationService{senders: senders, outbox: make(chan pushJob, max(outboxSize, 1))}
+}
+
+// Start runs workers until ctx is cancelled; pushes still queued or held then are dropped
+func (s *NotificationService) Start(ctx context.Context, workers int) {
+	go func() {
+		ticker := time.NewTicker(pushHoldTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.release(now)
+			}
+		}
+	}()
+	for i := 0; i < max(workers, 1); i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-s.outbox:
+					jobCtx, cancel := context.WithTimeout(ctx, pushSendTimeout)
+					s.deliver(jobCtx, job)
+					cancel()
+				}
+			}
+		}()
+	}
+	log.Printf("Push notifications enabled (%d platforms)", len(s.senders))
+}
+
+// Enqueue queues a push about messageID to every device of userID without blocking. With a
+// positive hold the push waits that long first and Retract can still cancel it. False when
+// the outbox is full.
+func (s *NotificationService) Enqueue(userID, messageID int, n PushNotification, hold time.Duration) bool {
+	job := pushJob{userID: userID, messageID: messageID, notification: n}
+	if hold <= 0 {
+		return s.queue(job)
+	}
+	job.due = time.Now().Add(hold)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.held) >= cap(s.outbox) {
+		pushDropped.Inc()
+		return false
+	}
+	s.held = append(s.held, job)
+	return true
+}
+
+func (s *NotificationService) queue(job pushJob) bool {
+	select {
+	case s.outbox <- job:
+		return true
+	default:
+		pushDropped.Inc()
+		return false
+	}
+}
+
+// release moves held pushes that are due into the outbox
+func (s *NotificationService) release(now time.Time) {
+	s.mu.Lock()
+	var due []pushJob
+	kept := s.held[:0]
+	for _, job := range s.held {
+		if now.Before(job.due) {
+			kept = append(kept, job)
+		} else {
+			due = append(due, job)
+		}
+	}
+	s.held = kept
+	s.mu.Unlock()
+	for _, job := range due {
+		s.queue(job)
+	}
+}
+
+// Retract drops the held pushes about messageID and reports how many there were. Pushes
+// already released are sent regardless.
+func (s *NotificationService) Retract(messageID int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.held[:0]
+	for _, job := range s.held {
+		if job.messageID != messageID {
+			kept = append(kept, job)
+		}
+	}
+	n := len(s.held) - len(kept)
+	s.held = kept
+	pushRetracted.Add(int64(n))
+	return n
+}
+
+// deliver sends a push to each of the user's devices, forgetting tokens the push service rejects
+func (s *NotificationService) deliver(ctx context.Context, job pushJob) {
+	tokens, err := s.ListPushTokens(ctx, job.userID)
+	if err != nil {
+		utils.LogError(err, "ListPushTokens")
+		return
+	}
+	for _, t := range tokens {
+		sender, ok := s.senders[t.Platform]
+		if !ok {
+			continue
+		}
+		err := sender.Send(ctx, t.Token, job.notification)
+		switch {
+		case err == nil:
+			pushSent.Inc(t.Platform, "sent")
+		case errors.Is(err, ErrPushTokenInvalid):
+			pushSent.Inc(t.Platform, "invalid_token")
+			if err := s.deleteToken(ctx, t.ID); err != nil {
+				utils.LogError(err, "delete invalid push token")
+			}
+		default:
+			pushSent.Inc(t.Platform, "failed")
+			utils.LogError(err, fmt.Sprintf("push to user %d via %s", job.userID, t.Platform))
+		}
+	}
+}
+
+// RegisterPushToken stores a token for userID; a token registered before (by anyone) is
+// moved to userID
+func (s *NotificationService) RegisterPushToken(ctx context.Context, userID int, platform, token string) (*models.PushToken, error) {
+	if _, ok := s.senders[platform]; !ok {
+		return nil, ErrUnknownPushPlatform
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	t := models.PushToken{Platform: platform, Token: token}
+	err := db.Pool.QueryRow(ctx, `INSERT INTO device_tokens (user_id, platform, token) VALUES ($1, $2, $3)
+		ON CONFLICT (token) DO UPDATE SET user_id = EXCLUDED.user_id, platform = EXCLUDED.platform, last_seen_at = NOW()
+		RETURNING id, created_at, last_seen_at`, userID, platform, token).Scan(&t.ID, &t.CreatedAt, &t.LastSeenAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// UnregisterPushToken removes one of userID's tokens; ErrNotFound if it isn't theirs
+func (s *NotificationService) UnregisterPushToken(ctx context.Context, userID int, token string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM device_tokens WHERE user_id = $1 AND token = $2`, userID, token)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListPushTokens returns userID's tokens
+func (s *NotificationService) ListPushTokens(ctx context.Context, userID int) ([]models.PushToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Read(ctx).Query(ctx, `SELECT id, platform, token, created_at, last_seen_at
+		FROM device_tokens WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.PushToken{}
+	for rows.Next() {
+		var t models.PushToken
+		if err := rows.Scan(&t.ID, &t.Platform, &t.Token, &t.CreatedAt, &t.LastSeenAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *NotificationService) deleteToken(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := db.Pool.Exec(ctx, `DELETE FROM device_tokens WHERE id = $1`, id)
+	return err
+}
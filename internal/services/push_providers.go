@@ -0,0 +1,296 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrPushTokenInvalid is returned when the push service no longer knows a token, e.g. after
+// the app was uninstalled; the token should be forgotten
+var ErrPushTokenInvalid = errors.New("push token is no longer valid")
+
+// PushNotification is what a push shows on the device. Data is delivered to the app with it.
+type PushNotification struct {
+	Title       string
+	Body        string
+	CollapseKey string // Newer pushes with the same key replace older ones on the device
+	Data        map[string]string
+}
+
+// PushSender delivers a notification to one device token of its platform
+type PushSender interface {
+	Send(ctx context.Context, token string, n PushNotification) error
+}
+
+// pushResponseError turns a failed push response into an error; 4xx other than 429 won't
+// succeed on retry
+func pushResponseError(platform string, res *http.Response, detail []byte, invalidToken bool) error {
+	if invalidToken {
+		return Permanent(ErrPushTokenInvalid)
+	}
+	err := fmt.Errorf("%s returned %s: %s", platform, res.Status, strings.TrimSpace(string(detail)))
+	if res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+// fcmServiceAccount is the part of a Google service account key file FCM needs
+type fcmServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// FCMSender sends through the FCM HTTP v1 API, authenticating with a service account
+type FCMSender struct {
+	account  fcmServiceAccount
+	key      *rsa.PrivateKey
+	client   *http.Client
+	provider *Provider
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCMSender loads the service account key file downloaded from the Firebase console
+func NewFCMSender(credentialsFile string) (*FCMSender, error) {
+	b, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	var account fcmServiceAccount
+	if err := json.Unmarshal(b, &account); err != nil {
+		return nil, fmt.Errorf("invalid FCM credentials: %w", err)
+	}
+	if account.ProjectID == "" || account.ClientEmail == "" {
+		return nil, fmt.Errorf("FCM credentials need project_id and client_email")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid FCM private key: %w", err)
+	}
+	return &FCMSender{account: account, key: key, client: NewEgressClient(10 * time.Second), provider: NewProvider("push_fcm")}, nil
+}
+
+// token returns an OAuth access token, exchanging a signed assertion when the cached one expires
+func (s *FCMSender) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accessToken != "" && time.Now().Before(s.expiresAt) {
+		return s.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.account.ClientEmail,
+		"scope": "https://www.googleapis.com/auth/firebase.messaging",
+		"aud":   s.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return "", pushResponseError("FCM token endpoint", res, detail, false)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	// Renew a minute early so a token never expires mid-request
+	s.accessToken = out.AccessToken
+	s.expiresAt = now.Add(time.Duration(out.ExpiresIn)*time.Second - time.Minute)
+	return s.accessToken, nil
+}
+
+func (s *FCMSender) Send(ctx context.Context, token string, n PushNotification) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token":        token,
+			"notification": map[string]string{"title": n.Title, "body": n.Body},
+			"data":         n.Data,
+			"android":      map[string]string{"priority": "high", "collapse_key": n.CollapseKey},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return s.provider.Call(ctx, func(ctx context.Context) error {
+		accessToken, err := s.token(ctx)
+		if err != nil {
+			return err
+		}
+		endpoint := fmt.Sprintf("https://fcm.googleapis.com/v1/projects/%s/messages:send", url.PathEscape(s.account.ProjectID))
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		res, err := s.client.Do(req)
+		if err != nil {
+			if errors.Is(err, ErrEgressDenied) {
+				return Permanent(err)
+			}
+			return err
+		}
+		defer res.Body.Close()
+		switch res.StatusCode {
+		case http.StatusOK:
+			return nil
+		case http.StatusUnauthorized:
+			// Make the next attempt fetch a new access token
+			s.mu.Lock()
+			s.accessToken = ""
+			s.mu.Unlock()
+		}
+		// UNREGISTERED comes back as 404
+		detail, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return pushResponseError("FCM", res, detail, res.StatusCode == http.StatusNotFound)
+	})
+}
+
+// APNsSender sends through Apple's HTTP/2 API with token-based (.p8 key) authentication
+type APNsSender struct {
+	host     string
+	topic    string // The app's bundle id
+	keyID    string
+	teamID   string
+	key      *ecdsa.PrivateKey
+	client   *http.Client
+	provider *Provider
+
+	mu       sync.Mutex
+	jwt      string
+	issuedAt time.Time
+}
+
+// NewAPNsSender loads the .p8 signing key; sandbox selects the development environment
+func NewAPNsSender(keyFile, keyID, teamID, topic string, sandbox bool) (*APNsSender, error) {
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APNs key: %w", err)
+	}
+	if keyID == "" || teamID == "" || topic == "" {
+		return nil, fmt.Errorf("APNs needs a key id, team id and topic")
+	}
+	host := "https://api.push.apple.com"
+	if sandbox {
+		host = "https://api.sandbox.push.apple.com"
+	}
+	return &APNsSender{host: host, topic: topic, keyID: keyID, teamID: teamID, key: key,
+		client: NewEgressClient(10 * time.Second), provider: NewProvider("push_apns")}, nil
+}
+
+// authToken returns the provider token; Apple accepts one for up to an hour and rejects
+// refreshing it more than once every 20 minutes
+func (s *APNsSender) authToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jwt != "" && time.Since(s.issuedAt) < 50*time.Minute {
+		return s.jwt, nil
+	}
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": s.teamID, "iat": now.Unix()})
+	t.Header["kid"] = s.keyID
+	signed, err := t.SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+	s.jwt, s.issuedAt = signed, now
+	return signed, nil
+}
+
+func (s *APNsSender) Send(ctx context.Context, token string, n PushNotification) error {
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{"title": n.Title, "body": n.Body},
+			"sound": "default",
+		},
+	}
+	for k, v := range n.Data {
+		if k != "aps" {
+			payload[k] = v
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.provider.Call(ctx, func(ctx context.Context) error {
+		authToken, err := s.authToken()
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.host+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "bearer "+authToken)
+		req.Header.Set("apns-topic", s.topic)
+		req.Header.Set("apns-push-type", "alert")
+		req.Header.Set("apns-priority", "10")
+		if n.CollapseKey != "" && len(n.CollapseKey) <= 64 {
+			req.Header.Set("apns-collapse-id", n.CollapseKey)
+		}
+		res, err := s.client.Do(req)
+		if err != nil {
+			if errors.Is(err, ErrEgressDenied) {
+				return Permanent(err)
+			}
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			return nil
+		}
+		detail, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		var reason struct {
+			Reason string `json:"reason"`
+		}
+		_ = json.Unmarshal(detail, &reason)
+		invalid := res.StatusCode == http.StatusGone || reason.Reason == "BadDeviceToken" || reason.Reason == "DeviceTokenNotForTopic"
+		return pushResponseError("APNs", res, detail, invalid)
+	})
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+)
+
+// AddReaction records an emoji reaction by userID on a message. Reacting twice with
+// the same emoji is a no-op that returns the existing reaction.
+func (s *ChatService) AddReaction(ctx context.Context, messageID, userID int, emoji string) (*models.Reaction, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		WITH ins AS (
+			INSERT INTO message_reactions (message_id, user_id, emoji) VALUES ($1, $2, $3)
+			ON CONFLICT (message_id, user_id, emoji) DO UPDATE SET emoji = EXCLUDED.emoji
+			RETURNING message_id, user_id, emoji, created_at
+		)
+		SELECT ins.message_id, m.room, ins.user_id, u.username, ins.emoji, ins.created_at
+		FROM ins
+		JOIN messages m ON m.id = ins.message_id
+		JOIN users u ON u.id = ins.user_id
+	`
+	var r models.Reaction
+	err := db.Pool.QueryRow(ctx, query, messageID, userID, emoji).Scan(&r.MessageID, &r.Room, &r.UserID, &r.Username, &r.Emoji, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Delivery is a chat event written to one of a recipient's connections
+type Delivery struct {
+	MessageID int
+	UserID    int
+}
+
+// RecordDeliveries stores delivered receipts and returns the ones that are new, with the
+// sender and room filled in. Deliveries to the sender's own connections and of messages
+// that are gone are skipped.
+func (s *ChatService) RecordDeliveries(ctx context.Context, deliveries []Delivery) ([]models.MessageReceipt, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	messageIDs := make([]int64, len(deliveries))
+	userIDs := make([]int32, len(deliveries))
+	for i, d := range deliveries {
+		messageIDs[i], userIDs[i] = int64(d.MessageID), int32(d.UserID)
+	}
+	rows, err := db.Pool.Query(ctx, `
+		WITH inserted AS (
+			INSERT INTO message_receipts (message_id, user_id)
+			SELECT DISTINCT d.message_id, d.user_id FROM unnest($1::bigint[], $2::int[]) AS d(message_id, user_id)
+			JOIN messages m ON m.id = d.message_id AND m.user_id IS DISTINCT FROM d.user_id
+			ON CONFLICT (message_id, user_id) DO NOTHING
+			RETURNING message_id, user_id, delivered_at
+		)
+		SELECT i.message_id, i.user_id, u.username, m.room, m.user_id, i.delivered_at
+		FROM inserted i JOIN messages m ON m.id = i.message_id JOIN users u ON u.id = i.user_id`, messageIDs, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var receipts []models.MessageReceipt
+	for rows.Next() {
+		var r models.MessageReceipt
+		var senderID *int
+		if err := rows.Scan(&r.MessageID, &r.UserID, &r.Username, &r.Room, &senderID, &r.DeliveredAt); err != nil {
+			return nil, err
+		}
+		if senderID != nil {
+			r.SenderID = *senderID
+		}
+		receipts = append(receipts, r)
+	}
+	return receipts, rows.Err()
+}
+
+// GetMessageReceipts returns the per-recipient receipts of a message; only its sender may see them
+func (s *ChatService) GetMessageReceipts(ctx context.Context, messageID, userID int) ([]models.MessageReceipt, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var senderID *int
+	err := db.Read(ctx).QueryRow(ctx, `SELECT user_id FROM messages WHERE id = $1 AND deleted_at IS NULL`, messageID).Scan(&senderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if senderID == nil || *senderID != userID {
+		return nil, ErrNotMessageSender
+	}
+
+	rows, err := db.Read(ctx).Query(ctx, `SELECT r.message_id, r.user_id, u.username, r.delivered_at, r.seen_at
+		FROM message_receipts r JOIN users u ON u.id = r.user_id
+		WHERE r.message_id = $1 ORDER BY r.delivered_at`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipts := []models.MessageReceipt{}
+	for rows.Next() {
+		var r models.MessageReceipt
+		if err := rows.Scan(&r.MessageID, &r.UserID, &r.Username, &r.DeliveredAt, &r.SeenAt); err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, r)
+	}
+	return receipts, rows.Err()
+}
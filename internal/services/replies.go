@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetReplies returns the messages that replied directly to messageID, oldest first, along
+// with the message itself and the total number of replies. Pages go backwards from the
+// newest reply: beforeID, when set, returns the replies older than that one, and more tells
+// whether older replies remain.
+func (s *ChatService) GetReplies(ctx context.Context, messageID, beforeID, limit int) (parent *models.Message, replies []models.Message, total int, more bool, err error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	parent, err = scanMessage(db.Read(ctx).QueryRow(ctx, `SELECT `+messageColumns+` FROM messages
+		WHERE id = $1 AND `+notExpired, messageID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, 0, false, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, 0, false, err
+	}
+
+	const isReply = `(reply_to->>'id')::bigint = $1 AND reply_to IS NOT NULL AND room = $2 AND ` + notExpired
+	if err := db.Read(ctx).QueryRow(ctx, `SELECT COUNT(*) FROM messages WHERE `+isReply, parent.ID, parent.Room).Scan(&total); err != nil {
+		return nil, nil, 0, false, err
+	}
+
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE ` + isReply + ` ORDER BY id DESC LIMIT $3`
+	args := []interface{}{parent.ID, parent.Room, limit + 1} // One extra row tells whether older replies remain
+	if beforeID > 0 {
+		query = `SELECT ` + messageColumns + ` FROM messages WHERE ` + isReply + ` AND id < $4 ORDER BY id DESC LIMIT $3`
+		args = append(args, beforeID)
+	}
+	rows, err := db.Read(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, nil, 0, false, err
+	}
+	defer rows.Close()
+
+	replies = []models.Message{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, nil, 0, false, err
+		}
+		if len(replies) == limit {
+			more = true
+			break
+		}
+		replies = append(replies, *msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, 0, false, err
+	}
+
+	for i, j := 0, len(replies)-1; i < j; i, j = i+1, j-1 {
+		replies[i], replies[j] = replies[j], replies[i]
+	}
+	return parent, replies, total, more, nil
+}
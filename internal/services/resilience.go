@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"chat-backend/internal/metrics"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+)
+
+// ErrCircuitOpen is returned without calling a provider whose circuit breaker is open
+var ErrCircuitOpen = errors.New("provider circuit is open")
+
+var (
+	providerCallsTotal   = metrics.NewCounterVec("external_provider_calls_total", "Calls to external providers by outcome", "provider", "result")
+	providerRetriesTotal = metrics.NewCounterVec("external_provider_retries_total", "Calls to external providers that were retried", "provider")
+	_                    = metrics.NewGaugeFunc("external_providers_open", "External providers whose circuit breaker is open", func() float64 {
+		n := 0
+		for _, h := range ProvidersHealth() {
+			if h.State == "open" {
+				n++
+			}
+		}
+		return float64(n)
+	})
+)
+
+// permanentError marks a failure that retrying won't fix, such as a rejected request
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so Provider.Call neither retries it nor counts it against the breaker
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// ProviderPolicy configures the resilience of calls to one external provider
+type ProviderPolicy struct {
+	Timeout          time.Duration // Per attempt
+	Retries          int           // Extra attempts after a failure
+	Backoff          time.Duration // Doubled after every retry
+	FailureThreshold int           // Consecutive failures that open the circuit
+	OpenFor          time.Duration // How long an open circuit rejects calls before a trial call
+}
+
+// providerPolicyFromEnv reads PROVIDER_<NAME>_* overrides, falling back to the PROVIDER_*
+// defaults and then to def
+func providerPolicyFromEnv(name string, def ProviderPolicy) ProviderPolicy {
+	prefix := "PROVIDER_" + strings.ToUpper(name) + "_"
+	duration := func(key string, d time.Duration) time.Duration {
+		return utils.GetEnvDuration(prefix+key, utils.GetEnvDuration("PROVIDER_"+key, d))
+	}
+	integer := func(key string, n int) int {
+		return utils.GetEnvInt(prefix+key, utils.GetEnvInt("PROVIDER_"+key, n))
+	}
+	return ProviderPolicy{
+		Timeout:          duration("TIMEOUT", def.Timeout),
+		Retries:          integer("RETRIES", def.Retries),
+		Backoff:          duration("BACKOFF", def.Backoff),
+		FailureThreshold: integer("FAILURE_THRESHOLD", def.FailureThreshold),
+		OpenFor:          duration("OPEN_FOR", def.OpenFor),
+	}
+}
+
+// defaultProviderPolicy applies to every provider unless overridden
+var defaultProviderPolicy = ProviderPolicy{
+	Timeout:          5 * time.Second,
+	Retries:          1,
+	Backoff:          200 * time.Millisecond,
+	FailureThreshold: 5,
+	OpenFor:          30 * time.Second,
+}
+
+// Provider guards calls to one external integration (translation, email, push, SMS,
+// moderation, link previews, ...) with a timeout, retries and a circuit breaker.
+// Every outbound integration should go through one.
+type Provider struct {
+	name   string
+	policy ProviderPolicy
+
+	mu          sync.Mutex
+	failures    int
+	openUntil   time.Time
+	trial       bool // A half-open trial call is in flight
+	lastErr     string
+	lastSuccess time.Time
+	lastFailure time.Time
+}
+
+var (
+	providersMu sync.Mutex
+	providers   = make(map[string]*Provider)
+)
+
+// NewProvider returns the provider registered under name, creating it with the policy from
+// the environment (see providerPolicyFromEnv) on first use
+func NewProvider(name string) *Provider {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if p, ok := providers[name]; ok {
+		return p
+	}
+	p := &Provider{name: name, policy: providerPolicyFromEnv(name, defaultProviderPolicy)}
+	providers[name] = p
+	return p
+}
+
+// ReloadProviderPolicies re-reads the PROVIDER_* settings of every registered provider
+func ReloadProviderPolicies() {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	for name, p := range providers {
+		policy := providerPolicyFromEnv(name, defaultProviderPolicy)
+		p.mu.Lock()
+		p.policy = policy
+		p.mu.Unlock()
+	}
+}
+
+// ProvidersHealth reports every registered provider, sorted by name
+func ProvidersHealth() []models.ProviderHealth {
+	providersMu.Lock()
+	list := make([]*Provider, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, p)
+	}
+	providersMu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	health := make([]models.ProviderHealth, 0, len(list))
+	for _, p := range list {
+		health = append(health, p.Health())
+	}
+	return health
+}
+
+// Health reports the provider's breaker state
+func (p *Provider) Health() models.ProviderHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h := models.ProviderHealth{Name: p.name, State: p.stateLocked(time.Now()), ConsecutiveFailures: p.failures, LastError: p.lastErr}
+	if !p.lastSuccess.IsZero() {
+		t := p.lastSuccess
+		h.LastSuccessAt = &t
+	}
+	if !p.lastFailure.IsZero() {
+		t := p.lastFailure
+		h.LastFailureAt = &t
+	}
+	if h.State != "closed" {
+		t := p.openUntil
+		h.OpenUntil = &t
+	}
+	return h
+}
+
+func (p *Provider) stateLocked(now time.Time) string {
+	switch {
+	case p.openUntil.IsZero():
+		return "closed"
+	case now.Before(p.openUntil):
+		return "open"
+	default:
+		return "half_open"
+	}
+}
+
+// allow reports whether a call may go out; in the half-open state only one trial call does
+func (p *Provider) allow() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch p.stateLocked(time.Now()) {
+	case "open":
+		return false
+	case "half_open":
+		if p.trial {
+			return false
+		}
+		p.trial = true
+	}
+	return true
+}
+
+// release ends a call without recording an outcome
+func (p *Provider) release() {
+	p.mu.Lock()
+	p.trial = false
+	p.mu.Unlock()
+}
+
+func (p *Provider) record(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.trial = false
+	now := time.Now()
+	if err == nil {
+		p.failures = 0
+		p.openUntil = time.Time{}
+		p.lastSuccess = now
+		return
+	}
+	p.failures++
+	p.lastErr = err.Error()
+	p.lastFailure = now
+	if p.policy.FailureThreshold > 0 && p.failures >= p.policy.FailureThreshold {
+		p.openUntil = now.Add(p.policy.OpenFor)
+	}
+}
+
+// Call runs fn with the provider's timeout, retrying transient failures with backoff.
+// fn runs in its own goroutine, so providers without context support still time out.
+func (p *Provider) Call(ctx context.Context, fn func(ctx context.Context) error) error {
+	p.mu.Lock()
+	policy := p.policy
+	p.mu.Unlock()
+
+	backoff := policy.Backoff
+	var err error
+	for attempt := 0; attempt <= policy.Retries; attempt++ {
+		if attempt > 0 {
+			providerRetriesTotal.Inc(p.name)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if !p.allow() {
+			if err != nil {
+				// The previous attempt opened the circuit; report what actually failed
+				break
+			}
+			providerCallsTotal.Inc(p.name, "rejected")
+			return fmt.Errorf("%s: %w", p.name, ErrCircuitOpen)
+		}
+
+		err = callWithTimeout(ctx, policy.Timeout, fn)
+		var permanent permanentError
+		switch {
+		case err == nil:
+			p.record(nil)
+			providerCallsTotal.Inc(p.name, "success")
+			return nil
+		case errors.As(err, &permanent):
+			// The provider answered; it is healthy even though the request failed
+			p.record(nil)
+			providerCallsTotal.Inc(p.name, "rejected_request")
+			return permanent.err
+		case ctx.Err() != nil:
+			// The caller gave up; not the provider's fault
+			p.release()
+			providerCallsTotal.Inc(p.name, "canceled")
+			return err
+		}
+		p.record(err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			providerCallsTotal.Inc(p.name, "timeout")
+		} else {
+			providerCallsTotal.Inc(p.name, "failure")
+		}
+	}
+	return fmt.Errorf("%s: %w", p.name, err)
+}
+
+func callWithTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
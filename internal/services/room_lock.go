@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrRoomLocked is returned when a regular member posts to a locked room
+var ErrRoomLocked = errors.New("room is locked; only admins can post")
+
+// roomLocked is true for rooms in lockdown whose automatic unlock hasn't passed; r is the room alias
+const roomLocked = `(r.locked_at IS NOT NULL AND (r.locked_until IS NULL OR r.locked_until > NOW()))`
+
+const roomLockColumns = `id, locked_by, locked_at, locked_until, lock_reason`
+
+func scanRoomLock(row rowScanner) (*models.RoomLock, error) {
+	var l models.RoomLock
+	if err := row.Scan(&l.Room, &l.LockedBy, &l.LockedAt, &l.LockedUntil, &l.Reason); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// LockRoom puts a room in lockdown until it is unlocked or until passes (nil for no automatic
+// unlock). Room owners and admins may lock; override is for the app admin and is audited.
+func (s *ChatService) LockRoom(ctx context.Context, roomID string, actorID int, until *time.Time, reason string, override bool) (*models.RoomLock, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := requireRoomAdmin(ctx, tx, roomID, actorID, override); err != nil {
+		return nil, err
+	}
+	var reasonArg *string
+	if reason != "" {
+		reasonArg = &reason
+	}
+	lock, err := scanRoomLock(tx.QueryRow(ctx, `UPDATE rooms SET locked_at = NOW(), locked_until = $2, locked_by = $3, lock_reason = $4
+		WHERE id = $1 RETURNING `+roomLockColumns, roomID, until, actorID, reasonArg))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if override {
+		if err := recordAdminAudit(ctx, tx, actorID, "lock_room", "room", roomID,
+			map[string]interface{}{"until": until, "reason": reasonArg}); err != nil {
+			return nil, err
+		}
+	}
+	return lock, tx.Commit(ctx)
+}
+
+// UnlockRoom lifts a lockdown; ErrNotFound when the room isn't locked
+func (s *ChatService) UnlockRoom(ctx context.Context, roomID string, actorID int, override bool) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := requireRoomAdmin(ctx, tx, roomID, actorID, override); err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx, `UPDATE rooms r SET locked_at = NULL, locked_until = NULL, locked_by = NULL, lock_reason = NULL
+		WHERE r.id = $1 AND `+roomLocked, roomID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	if override {
+		if err := recordAdminAudit(ctx, tx, actorID, "unlock_room", "room", roomID, nil); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// GetRoomLock returns the room's active lockdown, or ErrNotFound when it isn't locked
+func (s *ChatService) GetRoomLock(ctx context.Context, roomID string) (*models.RoomLock, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	lock, err := scanRoomLock(db.Read(ctx).QueryRow(ctx, `SELECT `+roomLockColumns+` FROM rooms r WHERE r.id = $1 AND `+roomLocked, roomID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return lock, err
+}
+
+// CheckCanPost returns ErrRoomLocked when the room is locked and userID is not one of its
+// owners or admins, and ErrVoiceOnlyRoom / ErrTextOnlyRoom when the room's post mode doesn't
+// accept a message of kind (models.PostKind*)
+func (s *ChatService) CheckCanPost(ctx context.Context, roomID string, userID int, kind string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var blocked bool
+	var mode string
+	err := db.Pool.QueryRow(ctx, `SELECT `+roomLocked+` AND COALESCE(p.role, 'member') NOT IN ('owner', 'admin'), r.post_mode
+		FROM rooms r LEFT JOIN room_participants p ON p.room_id = r.id AND p.user_id = $2 AND p.left_at IS NULL
+		WHERE r.id = $1`, roomID, userID).Scan(&blocked, &mode)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Unknown rooms are rejected by the participant checks
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrRoomLocked
+	}
+	return checkPostMode(mode, kind)
+}
+
+// UnlockExpiredRooms clears lockdowns whose locked_until has passed and returns those rooms
+func (s *ChatService) UnlockExpiredRooms(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `UPDATE rooms SET locked_at = NULL, locked_until = NULL, locked_by = NULL, lock_reason = NULL
+		WHERE locked_at IS NOT NULL AND locked_until <= NOW() RETURNING id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, id)
+	}
+	return rooms, rows.Err()
+}
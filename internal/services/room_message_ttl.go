@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetRoomMessageTTL returns how long messages posted to the room last
+func (s *ChatService) GetRoomMessageTTL(ctx context.Context, roomID string) (*models.RoomMessageTTL, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	t := models.RoomMessageTTL{Room: roomID}
+	err := db.Read(ctx).QueryRow(ctx, `SELECT COALESCE(message_ttl, 0) FROM rooms WHERE id = $1`, roomID).Scan(&t.TTL)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SetRoomMessageTTL makes messages posted to the room from now on expire after ttlSeconds;
+// 0 turns it off. Messages already sent keep their expiry. Room owners and admins may change
+// it; override is for the app admin.
+func (s *ChatService) SetRoomMessageTTL(ctx context.Context, roomID string, actorID, ttlSeconds int, override bool) (*models.RoomMessageTTL, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := requireRoomAdmin(ctx, db.Pool, roomID, actorID, override); err != nil {
+		return nil, err
+	}
+	var ttl *int
+	if ttlSeconds > 0 {
+		ttl = &ttlSeconds
+	}
+	tag, err := db.Pool.Exec(ctx, `UPDATE rooms SET message_ttl = $2 WHERE id = $1`, roomID, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrNotFound
+	}
+	return &models.RoomMessageTTL{Room: roomID, TTL: ttlSeconds}, nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrVoiceOnlyRoom is returned when anything but a voice message is posted to a voice-only room
+	ErrVoiceOnlyRoom = errors.New("this room only accepts voice messages")
+	// ErrTextOnlyRoom is returned when anything but a text message is posted to a text-only room
+	ErrTextOnlyRoom = errors.New("this room only accepts text messages")
+	// ErrInvalidPostMode is returned for an unknown post mode
+	ErrInvalidPostMode = errors.New("mode must be any, voice or text")
+)
+
+// checkPostMode returns the error for posting a message of kind to a room in mode
+func checkPostMode(mode, kind string) error {
+	switch {
+	case mode == models.PostModeVoice && kind != models.PostKindVoice:
+		return ErrVoiceOnlyRoom
+	case mode == models.PostModeText && kind != models.PostKindText:
+		return ErrTextOnlyRoom
+	}
+	return nil
+}
+
+// GetRoomPostMode returns the room's post mode
+func (s *ChatService) GetRoomPostMode(ctx context.Context, roomID string) (*models.RoomPostMode, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	m := models.RoomPostMode{Room: roomID}
+	err := db.Read(ctx).QueryRow(ctx, `SELECT post_mode FROM rooms WHERE id = $1`, roomID).Scan(&m.Mode)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// SetRoomPostMode changes the room's post mode. Room owners and admins may change it;
+// override is for the app admin.
+func (s *ChatService) SetRoomPostMode(ctx context.Context, roomID string, actorID int, mode string, override bool) (*models.RoomPostMode, error) {
+	switch mode {
+	case models.PostModeAny, models.PostModeVoice, models.PostModeText:
+	default:
+		return nil, ErrInvalidPostMode
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := requireRoomAdmin(ctx, db.Pool, roomID, actorID, override); err != nil {
+		return nil, err
+	}
+	tag, err := db.Pool.Exec(ctx, `UPDATE rooms SET post_mode = $2 WHERE id = $1`, roomID, mode)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrNotFound
+	}
+	return &models.RoomPostMode{Room: roomID, Mode: mode}, nil
+}
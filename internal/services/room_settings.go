@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SetRoomMute mutes roomID for userID until until, or until unmuted when until is nil;
+// mute false unmutes. Muted rooms don't send the user new_message notifications.
+func (s *ChatService) SetRoomMute(ctx context.Context, roomID string, userID int, mute bool, until *time.Time) (*models.RoomSettings, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	settings := models.RoomSettings{Room: roomID}
+	var mutedUntil *time.Time
+	err := db.Pool.QueryRow(ctx, `UPDATE room_participants
+		SET muted_until = CASE WHEN $3 THEN COALESCE($4, 'infinity'::timestamptz) END
+		WHERE room_id = $1 AND user_id = $2 AND left_at IS NULL
+		RETURNING COALESCE(muted_until > NOW(), FALSE), CASE WHEN isfinite(muted_until) THEN muted_until END`,
+		roomID, userID, mute, until).Scan(&settings.Muted, &mutedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	if settings.Muted && mutedUntil != nil {
+		settings.MutedUntil = mutedUntil.UnixMilli()
+	}
+	return &settings, nil
+}
+
+// GetMutedParticipants returns the participants who currently have the room muted
+func (s *ChatService) GetMutedParticipants(ctx context.Context, roomID string) ([]int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Read(ctx).Query(ctx, `SELECT user_id FROM room_participants
+		WHERE room_id = $1 AND left_at IS NULL AND muted_until > NOW()`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		users = append(users, id)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetRoomTranslation returns the room's translation settings
+func (s *ChatService) GetRoomTranslation(ctx context.Context, roomID string) (*models.RoomTranslationSettings, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var settings models.RoomTranslationSettings
+	err := db.Pool.QueryRow(ctx, `SELECT language, auto_translate FROM rooms WHERE id = $1`, roomID).Scan(&settings.Language, &settings.AutoTranslate)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// SetRoomTranslation updates the room's translation settings
+func (s *ChatService) SetRoomTranslation(ctx context.Context, roomID string, settings models.RoomTranslationSettings) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE rooms SET language = NULLIF($2, ''), auto_translate = $3 WHERE id = $1`, roomID, settings.Language, settings.AutoTranslate)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetTranslationTargets returns the room's source language ("auto" if unset) and the distinct
+// preferred languages of its active participants. ok is false when auto-translation is off.
+func (s *ChatService) GetTranslationTargets(ctx context.Context, roomID string) (source string, targets []string, ok bool, err error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT r.auto_translate, COALESCE(r.language, 'auto'), ARRAY(
+			SELECT DISTINCT u.language FROM room_participants p JOIN users u ON u.id = p.user_id
+			WHERE p.room_id = r.id AND p.left_at IS NULL AND u.language IS NOT NULL
+		)
+		FROM rooms r WHERE r.id = $1
+	`
+	err = db.Pool.QueryRow(ctx, query, roomID).Scan(&ok, &source, &targets)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, false, nil
+	}
+	return source, targets, ok, err
+}
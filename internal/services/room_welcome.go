@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MaxWelcomeMessageLength bounds a room's welcome message template
+const MaxWelcomeMessageLength = 1000
+
+// ErrWelcomeTooLong is returned for welcome messages over MaxWelcomeMessageLength
+var ErrWelcomeTooLong = errors.New("welcome message is too long")
+
+// GetRoomWelcome returns the room's welcome message
+func (s *ChatService) GetRoomWelcome(ctx context.Context, roomID string) (*models.RoomWelcome, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	w := models.RoomWelcome{Room: roomID}
+	err := db.Read(ctx).QueryRow(ctx, `SELECT welcome_message, COALESCE(name, '') FROM rooms WHERE id = $1`, roomID).Scan(&w.Message, &w.RoomName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// SetRoomWelcome changes the room's welcome message; nil or blank turns it off. Room owners
+// and admins may change it; override is for the app admin.
+func (s *ChatService) SetRoomWelcome(ctx context.Context, roomID string, actorID int, message *string, override bool) (*models.RoomWelcome, error) {
+	if message != nil {
+		if trimmed := strings.TrimSpace(*message); trimmed == "" {
+			message = nil
+		} else {
+			message = &trimmed
+		}
+	}
+	if message != nil && len([]rune(*message)) > MaxWelcomeMessageLength {
+		return nil, ErrWelcomeTooLong
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := requireRoomAdmin(ctx, db.Pool, roomID, actorID, override); err != nil {
+		return nil, err
+	}
+	tag, err := db.Pool.Exec(ctx, `UPDATE rooms SET welcome_message = $2 WHERE id = $1`, roomID, message)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrNotFound
+	}
+	return &models.RoomWelcome{Room: roomID, Message: message}, nil
+}
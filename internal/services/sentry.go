@@ -0,0 +1,116 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+)
+
+// SentryExporter sends error events to Sentry's store endpoint
+type SentryExporter struct {
+	storeURL    string
+	auth        string
+	environment string
+	client      *http.Client
+	provider    *Provider
+}
+
+// NewSentryExporter parses a DSN of the form https://<key>@<host>/<project id>
+func NewSentryExporter(dsn, environment string) (*SentryExporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	key := u.User.Username()
+	project := strings.Trim(u.Path, "/")
+	if key == "" || project == "" {
+		return nil, fmt.Errorf("sentry DSN must look like https://<key>@<host>/<project>")
+	}
+	return &SentryExporter{
+		storeURL:    fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, project),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=chat-backend/1.0, sentry_key=%s", key),
+		environment: environment,
+		client:      NewEgressClient(10 * time.Second),
+		provider:    NewProvider("sentry"),
+	}, nil
+}
+
+// NewErrorExporterFromEnv returns a SentryExporter when SENTRY_DSN is set, otherwise nil
+func NewErrorExporterFromEnv() (ErrorExporter, error) {
+	dsn := utils.GetEnv("SENTRY_DSN", "")
+	if dsn == "" {
+		return nil, nil
+	}
+	return NewSentryExporter(dsn, utils.GetEnv("SENTRY_ENVIRONMENT", "production"))
+}
+
+func (s *SentryExporter) Export(ev models.ErrorEvent, fingerprint string) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return
+	}
+	level := "error"
+	if ev.Kind == "panic" {
+		level = "fatal"
+	}
+	payload := map[string]interface{}{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   ev.Timestamp.UTC().Format(time.RFC3339),
+		"level":       level,
+		"platform":    "go",
+		"environment": s.environment,
+		"message":     map[string]string{"formatted": ev.Message},
+		"fingerprint": []string{fingerprint},
+		"tags": map[string]string{
+			"kind":   ev.Kind,
+			"route":  ev.Route,
+			"status": strconv.Itoa(ev.Status),
+		},
+		"request": map[string]string{"method": ev.Method, "url": ev.Path},
+		"extra":   map[string]string{"stack": ev.Stack},
+	}
+	if ev.UserID != 0 {
+		payload["user"] = map[string]string{"id": strconv.Itoa(ev.UserID), "ip_address": ev.IP}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	err = s.provider.Call(context.Background(), func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.storeURL, bytes.NewReader(body))
+		if err != nil {
+			return Permanent(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", s.auth)
+		res, err := s.client.Do(req)
+		if err != nil {
+			if errors.Is(err, ErrEgressDenied) {
+				return Permanent(err)
+			}
+			return err
+		}
+		res.Body.Close()
+		switch {
+		case res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests:
+			return fmt.Errorf("sentry returned %s", res.Status)
+		case res.StatusCode >= 400:
+			return Permanent(fmt.Errorf("sentry returned %s", res.Status))
+		}
+		return nil
+	})
+	utils.LogError(err, "Sentry export")
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ListStickerPacks returns every pack with its stickers, oldest pack first
+func (s *ChatService) ListStickerPacks(ctx context.Context) ([]models.StickerPack, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Read(ctx).Query(ctx, `
+		SELECT p.id, p.name, p.kind, p.created_at, st.id, st.url, st.emoji, st.width, st.height
+		FROM sticker_packs p JOIN stickers st ON st.pack_id = p.id
+		ORDER BY p.id, st.position, st.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	packs := []models.StickerPack{}
+	for rows.Next() {
+		var p models.StickerPack
+		var st models.Sticker
+		if err := rows.Scan(&p.ID, &p.Name, &p.Kind, &p.CreatedAt, &st.ID, &st.URL, &st.Emoji, &st.Width, &st.Height); err != nil {
+			return nil, err
+		}
+		if n := len(packs); n == 0 || packs[n-1].ID != p.ID {
+			packs = append(packs, p)
+		}
+		st.PackID, st.Kind = p.ID, p.Kind
+		last := &packs[len(packs)-1]
+		last.Stickers = append(last.Stickers, st)
+	}
+	return packs, rows.Err()
+}
+
+// GetSticker returns a sticker by id, or ErrNotFound
+func (s *ChatService) GetSticker(ctx context.Context, id int) (*models.Sticker, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var st models.Sticker
+	err := db.Read(ctx).QueryRow(ctx, `
+		SELECT st.id, st.pack_id, p.kind, st.url, st.emoji, st.width, st.height
+		FROM stickers st JOIN sticker_packs p ON p.id = st.pack_id WHERE st.id = $1`, id).
+		Scan(&st.ID, &st.PackID, &st.Kind, &st.URL, &st.Emoji, &st.Width, &st.Height)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// CreateStickerPack adds a pack with its stickers in the order given
+func (s *AdminService) CreateStickerPack(ctx context.Context, adminID int, req models.CreateStickerPackRequest) (*models.StickerPack, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	pack := models.StickerPack{Name: req.Name, Kind: req.Kind}
+	err = tx.QueryRow(ctx, `INSERT INTO sticker_packs (name, kind, created_by) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		req.Name, req.Kind, adminID).Scan(&pack.ID, &pack.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for i, in := range req.Stickers {
+		st := models.Sticker{PackID: pack.ID, Kind: pack.Kind, URL: in.URL, Emoji: in.Emoji, Width: in.Width, Height: in.Height}
+		err := tx.QueryRow(ctx, `INSERT INTO stickers (pack_id, url, emoji, width, height, position) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+			pack.ID, in.URL, in.Emoji, in.Width, in.Height, i).Scan(&st.ID)
+		if err != nil {
+			return nil, err
+		}
+		pack.Stickers = append(pack.Stickers, st)
+	}
+	details := map[string]interface{}{"name": pack.Name, "kind": pack.Kind, "stickers": len(pack.Stickers)}
+	if err := recordAdminAudit(ctx, tx, adminID, "create_sticker_pack", "sticker_pack", strconv.Itoa(pack.ID), details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &pack, nil
+}
+
+// DeleteStickerPack removes a pack; messages that sent its stickers keep their copy
+func (s *AdminService) DeleteStickerPack(ctx context.Context, adminID, packID int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM sticker_packs WHERE id = $1`, packID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	if err := recordAdminAudit(ctx, tx, adminID, "delete_sticker_pack", "sticker_pack", strconv.Itoa(packID), nil); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
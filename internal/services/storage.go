@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/utils"
+)
+
+// Storage keeps uploaded files (voices, photos, attachments) under keys relative to the
+// upload root, such as "voices/voice_1_2.ogg". Uploads are first written to a local temp
+// file (see TempUpload) and handed to Store once recorded.
+type Storage interface {
+	// Store moves the finished file at path to key; path is gone afterwards
+	Store(ctx context.Context, path, key, contentType string) error
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// Fetch makes key readable as a local file until release is called
+	Fetch(ctx context.Context, key string) (path string, release func(), err error)
+	// URL returns where clients download key from, or "" when it is served from /uploads
+	URL(key string) string
+}
+
+// uploadStorage is the configured backend; nil means local storage under UPLOAD_DIR
+var uploadStorage Storage
+
+// SetUploadStorage selects the storage backend for uploads
+func SetUploadStorage(s Storage) {
+	uploadStorage = s
+}
+
+// UploadStorage returns the storage backend for uploads
+func UploadStorage() Storage {
+	if uploadStorage == nil {
+		return LocalStorage{Dir: utils.GetEnv("UPLOAD_DIR", "uploads")}
+	}
+	return uploadStorage
+}
+
+// StorageBackend names the upload backend in use, as STORAGE_BACKEND does
+func StorageBackend() string {
+	if _, ok := UploadStorage().(*S3Storage); ok {
+		return "s3"
+	}
+	return "local"
+}
+
+// NewStorageFromEnv returns the backend named by STORAGE_BACKEND: "local" (default) or "s3"
+// for S3 and S3-compatible stores such as MinIO
+func NewStorageFromEnv() (Storage, error) {
+	switch backend := utils.GetEnv("STORAGE_BACKEND", "local"); backend {
+	case "local":
+		return LocalStorage{Dir: utils.GetEnv("UPLOAD_DIR", "uploads")}, nil
+	case "s3":
+		return NewS3StorageFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// UploadURL is the download URL of key from the storage backend, "" for local uploads
+func UploadURL(key string) string {
+	s := UploadStorage()
+	// Local uploads are resolved when served
+	if _, local := s.(LocalStorage); local {
+		return ""
+	}
+	return s.URL(ResolveUpload(context.Background(), key))
+}
+
+// DeleteUpload removes an uploaded file, keeping its content while identical uploads still
+// share it (see upload_blobs); failures are only logged since its rows are gone
+func DeleteUpload(ctx context.Context, key string) {
+	stored, err := releaseUploadBlob(ctx, key)
+	if err != nil {
+		// Better to leak the file than to delete a blob that is still referenced
+		utils.LogError(err, "release upload")
+		return
+	}
+	if stored == "" {
+		return
+	}
+	if err := UploadStorage().Delete(ctx, stored); err != nil {
+		utils.LogDebug("delete upload %s: %v", stored, err)
+	}
+}
+
+// recordUploadHash remembers the content hash of a stored upload (see ScanContent) and offers
+// it as the blob later identical uploads share; a failure only hides the upload from hash
+// scans and deduplication
+func recordUploadHash(ctx context.Context, key, sha256 string, size int64) {
+	_, err := db.Pool.Exec(ctx, `INSERT INTO upload_hashes (key, sha256, size) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET sha256 = EXCLUDED.sha256, size = EXCLUDED.size, blob_key = NULL, created_at = NOW()`, key, sha256, size)
+	if err != nil {
+		utils.LogError(err, "record upload hash")
+		return
+	}
+	_, err = db.Pool.Exec(ctx, `INSERT INTO upload_blobs (sha256, key, size) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, sha256, key, size)
+	utils.LogError(err, "record upload blob")
+}
+
+// LocalStorage keeps uploads on the local disk, served by /uploads
+type LocalStorage struct {
+	Dir string
+}
+
+func (s LocalStorage) path(key string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(key))
+}
+
+// Store renames the temp file into place, so readers never see a partial file
+func (s LocalStorage) Store(ctx context.Context, path, key, contentType string) error {
+	dest := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.Rename(path, dest)
+}
+
+func (s LocalStorage) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s LocalStorage) Fetch(ctx context.Context, key string) (string, func(), error) {
+	path := s.path(key)
+	if _, err := os.Stat(path); err != nil {
+		return "", nil, err
+	}
+	return path, func() {}, nil
+}
+
+func (s LocalStorage) URL(key string) string {
+	return ""
+}
+
+// fileSHA256 returns the hex SHA-256 and size of a file
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// fetchToTemp downloads r into a temp file under UploadTempDir
+func fetchToTemp(r io.Reader, key string) (string, func(), error) {
+	if err := os.MkdirAll(UploadTempDir(), 0755); err != nil {
+		return "", nil, err
+	}
+	f, err := os.CreateTemp(UploadTempDir(), "fetch-*"+filepath.Ext(key))
+	if err != nil {
+		return "", nil, err
+	}
+	release := func() { _ = os.Remove(f.Name()) }
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		release()
+		return "", nil, err
+	}
+	if err := f.Close(); err != nil {
+		release()
+		return "", nil, err
+	}
+	return f.Name(), release, nil
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ProbeUploadStorage writes size random bytes under dir/.probe, reads them back, compares
+// and deletes the file, the round trip every upload makes. A full disk, read-only mount or
+// lost permissions fail here before users hit them.
+func ProbeUploadStorage(dir string, size int) error {
+	probeDir := filepath.Join(dir, ".probe")
+	if err := os.MkdirAll(probeDir, 0755); err != nil {
+		return fmt.Errorf("create probe dir: %w", err)
+	}
+	data := make([]byte, max(size, 1))
+	if _, err := rand.Read(data); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(probeDir, "probe-*")
+	if err != nil {
+		return fmt.Errorf("create probe file: %w", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("write probe file: %w", err)
+	}
+	// Sync so a full disk is reported now instead of when the page cache is flushed
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync probe file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close probe file: %w", err)
+	}
+
+	read, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read probe file: %w", err)
+	}
+	if !bytes.Equal(read, data) {
+		return fmt.Errorf("probe file read back %d bytes that differ from the %d written", len(read), len(data))
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("delete probe file: %w", err)
+	}
+	return nil
+}
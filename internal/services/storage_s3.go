@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/internal/utils"
+)
+
+// s3UnsignedPayload marks presigned requests, whose body isn't known when signing
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Storage keeps uploads in an S3 bucket (or MinIO and other S3-compatible stores) and hands
+// clients presigned download URLs, so every instance sees the same files. Requests are signed
+// with AWS Signature Version 4.
+type S3Storage struct {
+	endpoint   *url.URL // Scheme and host of the service
+	region     string
+	bucket     string
+	accessKey  string
+	secretKey  string
+	pathStyle  bool          // endpoint/bucket/key instead of bucket.endpoint/key; MinIO needs it
+	presignTTL time.Duration // Lifetime of download URLs
+	client     *http.Client
+	provider   *Provider
+}
+
+// NewS3StorageFromEnv configures S3 from S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY,
+// S3_SECRET_KEY, S3_PATH_STYLE and S3_PRESIGN_TTL
+func NewS3StorageFromEnv() (*S3Storage, error) {
+	endpoint, err := url.Parse(utils.GetEnv("S3_ENDPOINT", "https://s3.amazonaws.com"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT")
+	}
+	s := &S3Storage{
+		endpoint:   endpoint,
+		region:     utils.GetEnv("S3_REGION", "us-east-1"),
+		bucket:     utils.GetEnv("S3_BUCKET", ""),
+		accessKey:  utils.GetEnv("S3_ACCESS_KEY", ""),
+		secretKey:  utils.GetEnv("S3_SECRET_KEY", ""),
+		pathStyle:  utils.GetEnv("S3_PATH_STYLE", "false") == "true",
+		presignTTL: utils.GetEnvDuration("S3_PRESIGN_TTL", time.Hour),
+		client:     NewEgressClient(5 * time.Minute),
+		provider:   NewProvider("storage_s3"),
+	}
+	if s.bucket == "" || s.accessKey == "" || s.secretKey == "" {
+		return nil, fmt.Errorf("S3 storage needs S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY")
+	}
+	// SigV4 presigned URLs are valid for at most a week
+	if s.presignTTL <= 0 || s.presignTTL > 7*24*time.Hour {
+		return nil, fmt.Errorf("S3_PRESIGN_TTL must be between 1s and 168h")
+	}
+	return s, nil
+}
+
+// objectURL is the URL of key, without query
+func (s *S3Storage) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = awsEscape(u.Path, false)
+	return &u
+}
+
+// Store uploads the file at path and removes it
+func (s *S3Storage) Store(ctx context.Context, path, key, contentType string) error {
+	hash, size, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	err = s.provider.Call(ctx, func(ctx context.Context) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return Permanent(err)
+		}
+		defer f.Close()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), f)
+		if err != nil {
+			return Permanent(err)
+		}
+		req.ContentLength = size
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		return s.do(req, hash, http.StatusOK)
+	})
+	if err != nil {
+		return err
+	}
+	_ = os.Remove(path)
+	return nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	return s.provider.Call(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+		if err != nil {
+			return Permanent(err)
+		}
+		return s.do(req, emptySHA256, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+	})
+}
+
+// Fetch downloads key to a temp file
+func (s *S3Storage) Fetch(ctx context.Context, key string) (string, func(), error) {
+	var path string
+	var release func()
+	err := s.provider.Call(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key).String(), nil)
+		if err != nil {
+			return Permanent(err)
+		}
+		s.sign(req, emptySHA256, time.Now())
+		res, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return s3ResponseError(res)
+		}
+		path, release, err = fetchToTemp(res.Body, key)
+		return err
+	})
+	return path, release, err
+}
+
+// URL returns a presigned GET URL valid for S3_PRESIGN_TTL
+func (s *S3Storage) URL(key string) string {
+	now := time.Now().UTC()
+	u := s.objectURL(key)
+	q := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.accessKey + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {strconv.Itoa(int(s.presignTTL.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	canonical := strings.Join([]string{http.MethodGet, u.RawPath, awsCanonicalQuery(q),
+		"host:" + u.Host + "\n", "host", s3UnsignedPayload}, "\n")
+	q.Set("X-Amz-Signature", s.signature(now, canonical))
+	u.RawQuery = awsCanonicalQuery(q)
+	return u.String()
+}
+
+// do signs and sends req, accepting the listed statuses
+func (s *S3Storage) do(req *http.Request, payloadHash string, ok ...int) error {
+	s.sign(req, payloadHash, time.Now())
+	res, err := s.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrEgressDenied) {
+			return Permanent(err)
+		}
+		return err
+	}
+	defer res.Body.Close()
+	for _, status := range ok {
+		if res.StatusCode == status {
+			return nil
+		}
+	}
+	return s3ResponseError(res)
+}
+
+// sign adds the SigV4 Authorization header, signing host and the x-amz-* headers
+func (s *S3Storage) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{req.Method, req.URL.EscapedPath(), awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(), signed, payloadHash}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, s.scope(now), signed, s.signature(now, canonical)))
+}
+
+// scope is the credential scope of requests signed at now
+func (s *S3Storage) scope(now time.Time) string {
+	return now.UTC().Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request
+func (s *S3Storage) signature(now time.Time, canonicalRequest string) string {
+	now = now.UTC()
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + s.scope(now) + "\n" + hex.EncodeToString(sum[:])
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// emptySHA256 is the payload hash of requests without a body
+var emptySHA256 = hex.EncodeToString(sha256.New().Sum(nil))
+
+// awsEscape percent-encodes everything but unreserved characters (and "/" in paths) as
+// SigV4 requires
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// awsCanonicalQuery encodes q sorted by name, as both the canonical request and the URL use it
+func awsCanonicalQuery(q url.Values) string {
+	names := make([]string, 0, len(q))
+	for name := range q {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), q[name]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsEscape(name, true)+"="+awsEscape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3ResponseError turns an error response into an error; 4xx other than 429 won't succeed on retry
+func s3ResponseError(res *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	err := fmt.Errorf("S3 returned %s: %s", res.Status, strings.TrimSpace(string(detail)))
+	if res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrAlreadyClaimed is returned when claiming a support conversation that is not open
+var ErrAlreadyClaimed = errors.New("conversation is already claimed or resolved")
+
+const supportTicketColumns = `r.id, r.support_user_id, u.username, r.support_status, r.claimed_by, a.username, r.created_at, COALESCE(r.support_updated_at, r.created_at)`
+
+const supportTicketFrom = `
+	FROM rooms r
+	JOIN users u ON u.id = r.support_user_id
+	LEFT JOIN users a ON a.id = r.claimed_by
+`
+
+func scanSupportTicket(row rowScanner) (*models.SupportTicket, error) {
+	var t models.SupportTicket
+	if err := row.Scan(&t.RoomID, &t.UserID, &t.Username, &t.Status, &t.ClaimedBy, &t.ClaimedByUsername, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// OpenSupportRoom returns the user's unresolved support conversation, creating one if needed
+func (s *ChatService) OpenSupportRoom(ctx context.Context, userID int, name string) (*models.RoomResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var roomID string
+	query := `SELECT id FROM rooms WHERE type = 'support' AND support_user_id = $1 AND support_status <> 'resolved' ORDER BY created_at DESC LIMIT 1`
+	err := db.Pool.QueryRow(ctx, query, userID).Scan(&roomID)
+	if err == nil {
+		return &models.RoomResponse{RoomID: roomID, IsNew: false}, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	roomID = uuid.New().String()
+	_, err = tx.Exec(ctx, `
+		INSERT INTO rooms (id, type, name, support_user_id, support_status, support_updated_at)
+		VALUES ($1, 'support', $2, $3, 'open', NOW())
+	`, roomID, name, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO room_participants (room_id, user_id) VALUES ($1, $2)", roomID, userID); err != nil {
+		return nil, err
+	}
+	if _, err := recordMembershipEvent(ctx, tx, roomID, userID, nil, "member_added"); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &models.RoomResponse{RoomID: roomID, IsNew: true}, nil
+}
+
+// GetSupportTicket returns the support state of a room, or ErrNotFound if it is not a support room
+func (s *ChatService) GetSupportTicket(ctx context.Context, roomID string) (*models.SupportTicket, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + supportTicketColumns + supportTicketFrom + `WHERE r.id = $1 AND r.type = 'support'`
+	t, err := scanSupportTicket(db.Pool.QueryRow(ctx, query, roomID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return t, err
+}
+
+// ListSupportTickets returns support conversations with the given status, oldest first.
+// An empty status lists every unresolved conversation.
+func (s *ChatService) ListSupportTickets(ctx context.Context, status string) ([]models.SupportTicket, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + supportTicketColumns + supportTicketFrom + `
+		WHERE r.type = 'support' AND (($1 = '' AND r.support_status <> 'resolved') OR r.support_status = $1)
+		ORDER BY r.created_at ASC
+		LIMIT 200
+	`
+	rows, err := db.Pool.Query(ctx, query, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []models.SupportTicket{}
+	for rows.Next() {
+		t, err := scanSupportTicket(rows)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, *t)
+	}
+	return tickets, rows.Err()
+}
+
+// ClaimSupportRoom assigns an open support conversation to agentID and adds them to the room
+func (s *ChatService) ClaimSupportRoom(ctx context.Context, roomID string, agentID int) (*models.SupportTicket, *models.MembershipEvent, error) {
+	if _, err := s.GetSupportTicket(ctx, roomID); err != nil {
+		return nil, nil, err
+	}
+
+	uctx, cancel := withTimeout(ctx)
+	tag, err := db.Pool.Exec(uctx, `
+		UPDATE rooms SET support_status = 'claimed', claimed_by = $2, support_updated_at = NOW()
+		WHERE id = $1 AND type = 'support' AND support_status = 'open'
+	`, roomID, agentID)
+	cancel()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, nil, ErrAlreadyClaimed
+	}
+
+	ev, err := s.AddRoomMember(ctx, roomID, agentID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := s.GetSupportTicket(ctx, roomID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, ev, nil
+}
+
+// ResolveSupportRoom marks a support conversation as resolved
+func (s *ChatService) ResolveSupportRoom(ctx context.Context, roomID string) (*models.SupportTicket, error) {
+	uctx, cancel := withTimeout(ctx)
+	tag, err := db.Pool.Exec(uctx, `
+		UPDATE rooms SET support_status = 'resolved', support_updated_at = NOW()
+		WHERE id = $1 AND type = 'support' AND support_status <> 'resolved'
+	`, roomID)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrNotFound
+	}
+	return s.GetSupportTicket(ctx, roomID)
+}
+
+// GetUnclaimedSupportAgents returns the ids of agents that should receive messages from
+// roomID: every agent while the conversation is open, nobody once it has been claimed.
+func (s *ChatService) GetUnclaimedSupportAgents(ctx context.Context, roomID string, agentUsernames []string) ([]int, error) {
+	if len(agentUsernames) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT u.id FROM users u
+		JOIN rooms r ON r.id = $1 AND r.type = 'support' AND r.support_status = 'open'
+		WHERE u.username = ANY($2)
+	`
+	return queryUserIDs(ctx, query, roomID, agentUsernames)
+}
+
+// GetUserIDsByUsername resolves usernames to ids, skipping unknown names
+func (s *ChatService) GetUserIDsByUsername(ctx context.Context, usernames []string) ([]int, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return queryUserIDs(ctx, `SELECT id FROM users WHERE username = ANY($1)`, usernames)
+}
+
+func queryUserIDs(ctx context.Context, query string, args ...interface{}) ([]int, error) {
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
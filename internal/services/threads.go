@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetThread returns the reply thread of rootMessageID: the root message followed by all of
+// its descendants, oldest first. Given a reply, it returns the whole thread the reply is in.
+// Deleted replies stay in place as tombstones.
+func (s *ChatService) GetThread(ctx context.Context, rootMessageID int) ([]models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	root, err := scanMessage(db.Read(ctx).QueryRow(ctx, `SELECT `+messageColumns+` FROM messages
+		WHERE id = (SELECT COALESCE(thread_id, id) FROM messages WHERE id = $1) AND `+notExpired, rootMessageID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Read(ctx).Query(ctx, `SELECT `+messageColumns+` FROM messages
+		WHERE thread_id = $1 AND room = $2 AND `+notExpired+` ORDER BY created_at, id`, root.ID, root.Room)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	thread := []models.Message{*root}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		thread = append(thread, *msg)
+	}
+	return thread, rows.Err()
+}
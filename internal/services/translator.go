@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/utils"
+)
+
+// Translator translates message text between languages. source may be "auto".
+type Translator interface {
+	Translate(ctx context.Context, text, source, target string) (string, error)
+}
+
+// HTTPTranslator calls a LibreTranslate-compatible API (POST /translate)
+type HTTPTranslator struct {
+	URL    string
+	APIKey string
+	Client *http.Client
+}
+
+func (t HTTPTranslator) Translate(ctx context.Context, text, source, target string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  source,
+		"target":  target,
+		"format":  "text",
+		"api_key": t.APIKey,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := t.Client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrEgressDenied) {
+			return "", Permanent(err)
+		}
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		err := fmt.Errorf("translation provider returned %s", res.Status)
+		if res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+			return "", Permanent(err)
+		}
+		return "", err
+	}
+
+	var out struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	return out.TranslatedText, nil
+}
+
+// ResilientTranslator guards a translator with a Provider and switches to Fallback (when set)
+// if the primary fails or its circuit is open
+type ResilientTranslator struct {
+	Primary  Translator
+	Provider *Provider
+	Fallback *ResilientTranslator
+}
+
+func (t *ResilientTranslator) Translate(ctx context.Context, text, source, target string) (string, error) {
+	var translated string
+	err := t.Provider.Call(ctx, func(ctx context.Context) error {
+		var err error
+		translated, err = t.Primary.Translate(ctx, text, source, target)
+		return err
+	})
+	if err != nil && t.Fallback != nil && ctx.Err() == nil {
+		return t.Fallback.Translate(ctx, text, source, target)
+	}
+	return translated, err
+}
+
+// NewTranslatorFromEnv returns a guarded HTTPTranslator when TRANSLATION_API_URL is set, otherwise nil.
+// TRANSLATION_FALLBACK_API_URL configures a secondary provider.
+func NewTranslatorFromEnv() Translator {
+	url := utils.GetEnv("TRANSLATION_API_URL", "")
+	if url == "" {
+		return nil
+	}
+	timeout := utils.GetEnvDuration("TRANSLATION_TIMEOUT", 3*time.Second)
+	translator := &ResilientTranslator{
+		Primary: HTTPTranslator{
+			URL:    url,
+			APIKey: utils.GetEnv("TRANSLATION_API_KEY", ""),
+			Client: NewEgressClient(timeout),
+		},
+		Provider: NewProvider("translation"),
+	}
+	if fallback := utils.GetEnv("TRANSLATION_FALLBACK_API_URL", ""); fallback != "" {
+		translator.Fallback = &ResilientTranslator{
+			Primary: HTTPTranslator{
+				URL:    fallback,
+				APIKey: utils.GetEnv("TRANSLATION_FALLBACK_API_KEY", ""),
+				Client: NewEgressClient(timeout),
+			},
+			Provider: NewProvider("translation_fallback"),
+		}
+	}
+	return translator
+}
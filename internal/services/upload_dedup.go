@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/utils"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// uploadBlobTTL bounds how long a resolved key is trusted, so keys deleted on another
+// instance stop resolving soon after
+const uploadBlobTTL = time.Minute
+
+// maxUploadBlobCache caps the resolved keys kept in memory
+const maxUploadBlobCache = 10000
+
+type resolvedUpload struct {
+	key string
+	at  time.Time
+}
+
+// uploadBlobCache maps published keys to the key their content is stored under
+var uploadBlobCache struct {
+	sync.Mutex
+	m map[string]resolvedUpload
+}
+
+// ResolveUpload returns the storage key holding the content of key: the blob it shares with
+// an identical earlier upload, or key itself
+func ResolveUpload(ctx context.Context, key string) string {
+	uploadBlobCache.Lock()
+	r, ok := uploadBlobCache.m[key]
+	uploadBlobCache.Unlock()
+	if ok && time.Since(r.at) < uploadBlobTTL {
+		return r.key
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	// The primary, since a reply may have published the key a moment ago
+	var blob string
+	err := db.Pool.QueryRow(ctx, `SELECT COALESCE(blob_key, key) FROM upload_hashes WHERE key = $1`, key).Scan(&blob)
+	if err != nil {
+		// Not published yet or unknown: nothing to cache
+		if !errors.Is(err, pgx.ErrNoRows) {
+			utils.LogError(err, "resolve upload")
+		}
+		return key
+	}
+	cacheResolvedUpload(key, blob)
+	return blob
+}
+
+func cacheResolvedUpload(key, blob string) {
+	uploadBlobCache.Lock()
+	defer uploadBlobCache.Unlock()
+	if uploadBlobCache.m == nil || len(uploadBlobCache.m) >= maxUploadBlobCache {
+		uploadBlobCache.m = make(map[string]resolvedUpload)
+	}
+	uploadBlobCache.m[key] = resolvedUpload{key: blob, at: time.Now()}
+}
+
+func forgetResolvedUpload(key string) {
+	uploadBlobCache.Lock()
+	delete(uploadBlobCache.m, key)
+	uploadBlobCache.Unlock()
+}
+
+// FetchUpload makes an upload readable as a local file until release is called
+func FetchUpload(ctx context.Context, key string) (string, func(), error) {
+	return UploadStorage().Fetch(ctx, ResolveUpload(ctx, key))
+}
+
+// linkUploadBlob publishes key as another reference to the stored blob with the same content,
+// reporting false when there is none and the upload has to be stored
+func linkUploadBlob(ctx context.Context, key, sha256 string, size int64) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the blob keeps a concurrent delete of its last reference from removing it
+	var blob string
+	err = tx.QueryRow(ctx, `SELECT key FROM upload_blobs WHERE sha256 = $1 AND size = $2 FOR UPDATE`, sha256, size).Scan(&blob)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE upload_blobs SET refs = refs + 1 WHERE sha256 = $1`, sha256); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO upload_hashes (key, sha256, size, blob_key) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE SET sha256 = EXCLUDED.sha256, size = EXCLUDED.size, blob_key = EXCLUDED.blob_key, created_at = NOW()`,
+		key, sha256, size, blob); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	cacheResolvedUpload(key, blob)
+	return true, nil
+}
+
+// releaseUploadBlob drops key's reference to its content and returns the storage key to
+// delete, "" while other uploads still use the blob
+func releaseUploadBlob(ctx context.Context, key string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	defer forgetResolvedUpload(key)
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var blobKey *string
+	err = tx.QueryRow(ctx, `DELETE FROM upload_hashes WHERE key = $1 RETURNING blob_key`, key).Scan(&blobKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Published before hashes were recorded: a standalone file
+		return key, tx.Commit(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+	target := key
+	if blobKey != nil {
+		target = *blobKey
+	}
+
+	var refs int
+	err = tx.QueryRow(ctx, `UPDATE upload_blobs SET refs = refs - 1 WHERE key = $1 RETURNING refs`, target).Scan(&refs)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// A standalone copy goes with its key; a reference to a vanished blob has nothing left
+		if blobKey != nil {
+			return "", tx.Commit(ctx)
+		}
+		return key, tx.Commit(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+	if refs > 0 {
+		return "", tx.Commit(ctx)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM upload_blobs WHERE key = $1`, target); err != nil {
+		return "", err
+	}
+	return target, tx.Commit(ctx)
+}
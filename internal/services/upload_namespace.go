@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/utils"
+)
+
+// uploadNamespacePattern matches rotated prefixes such as "v3-9f2a1c7e". Upload paths
+// without one use the original, unversioned namespace.
+var uploadNamespacePattern = regexp.MustCompile(`^v[0-9]+-[0-9a-f]{8}$`)
+
+// uploadNamespace holds the current /uploads prefix; "" until the first rotation
+var uploadNamespace struct {
+	sync.RWMutex
+	current string
+}
+
+// LoadUploadNamespace reads the current upload prefix from the database
+func LoadUploadNamespace(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var prefix string
+	err := db.Pool.QueryRow(ctx, `SELECT COALESCE((SELECT prefix FROM upload_namespaces ORDER BY version DESC LIMIT 1), '')`).Scan(&prefix)
+	if err != nil {
+		return err
+	}
+	uploadNamespace.Lock()
+	uploadNamespace.current = prefix
+	uploadNamespace.Unlock()
+	return nil
+}
+
+// CurrentUploadNamespace returns the prefix new upload URLs are built with
+func CurrentUploadNamespace() string {
+	uploadNamespace.RLock()
+	defer uploadNamespace.RUnlock()
+	return uploadNamespace.current
+}
+
+// IsUploadNamespace reports whether a path segment is a rotated namespace prefix
+func IsUploadNamespace(segment string) bool {
+	return uploadNamespacePattern.MatchString(segment)
+}
+
+// UploadPath returns the public path of a file relative to UPLOAD_DIR, e.g. "voices/a.webm"
+func UploadPath(rel string) string {
+	if ns := CurrentUploadNamespace(); ns != "" {
+		return "/uploads/" + ns + "/" + rel
+	}
+	return "/uploads/" + rel
+}
+
+// PhotoURL returns the URL a profile photo is served from, absolute when BASE_URL is set
+func PhotoURL(filename string) string {
+	if u := UploadURL(filename); u != "" {
+		return u
+	}
+	return utils.GetEnv("BASE_URL", "") + UploadPath(filename)
+}
+
+// RotateUploadNamespace retires every previous upload prefix and returns the new one
+func (s *AdminService) RotateUploadNamespace(ctx context.Context, adminID int) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	previous := CurrentUploadNamespace()
+	var version int
+	if err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) + 1 FROM upload_namespaces`).Scan(&version); err != nil {
+		return "", err
+	}
+	prefix := "v" + strconv.Itoa(version) + "-" + hex.EncodeToString(buf)
+	if _, err := tx.Exec(ctx, `INSERT INTO upload_namespaces (version, prefix, created_by) VALUES ($1, $2, $3)`, version, prefix, adminID); err != nil {
+		return "", err
+	}
+	details := map[string]string{"previous": previous, "current": prefix}
+	if err := recordAdminAudit(ctx, tx, adminID, "rotate_upload_namespace", "uploads", prefix, details); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+
+	uploadNamespace.Lock()
+	uploadNamespace.current = prefix
+	uploadNamespace.Unlock()
+	return prefix, nil
+}
+
+// uploadSigningSecret is derived from JWT_SECRET so upload signatures can't be used elsewhere
+func uploadSigningSecret() []byte {
+	return []byte(utils.GetEnv("JWT_SECRET", "secret") + ":uploads")
+}
+
+func uploadSignature(rel string, expires int64) string {
+	mac := hmac.New(sha256.New, uploadSigningSecret())
+	fmt.Fprintf(mac, "%s\n%d", rel, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedUploadURL returns the current path of rel with an expiring signature. The signature
+// covers rel but not the namespace, so the URL keeps working (via redirect) after a rotation.
+func SignedUploadURL(rel string, ttl time.Duration) (string, time.Time) {
+	expiresAt := time.Now().Add(ttl)
+	exp := expiresAt.Unix()
+	return fmt.Sprintf("%s?exp=%d&sig=%s", UploadPath(rel), exp, uploadSignature(rel, exp)), expiresAt
+}
+
+// VerifyUploadSignature checks a signature produced by SignedUploadURL
+func VerifyUploadSignature(rel, exp, sig string) bool {
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(uploadSignature(rel, expires)))
+}
+
+// uploadRoomVisible is the CanAccessRoom check for the room in column, for the user in $2
+const uploadRoomVisible = `EXISTS (SELECT 1 FROM rooms r WHERE r.id = %s AND (r.type = 'channel' OR EXISTS (
+	SELECT 1 FROM room_participants p WHERE p.room_id = r.id AND p.user_id = $2 AND p.left_at IS NULL)))`
+
+// CanAccessUpload reports whether userID may get a signed link to the upload at rel (as
+// cleaned for UPLOAD_DIR): a voice recording or attachment of a message in a room they can
+// read, one they staged or uploaded themselves, or a profile photo, which every signed-in
+// user sees. Other paths are refused.
+func (s *ChatService) CanAccessUpload(ctx context.Context, userID int, rel string) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	dir, name := path.Split(rel)
+	args := []interface{}{name, userID}
+	var query string
+	switch dir {
+	case "voices/":
+		query = `SELECT EXISTS (SELECT 1 FROM staged_media WHERE filename = $1 AND user_id = $2)
+			OR EXISTS (SELECT 1 FROM messages m WHERE m.voice = $1 AND NOT m.voice_expired AND m.deleted_at IS NULL
+				AND ` + fmt.Sprintf(uploadRoomVisible, "m.room") + `)`
+	case "files/":
+		query = `SELECT EXISTS (SELECT 1 FROM files f WHERE f.filename = $1
+			AND (f.user_id = $2 OR ` + fmt.Sprintf(uploadRoomVisible, "f.room") + `))`
+	case "":
+		query, args = `SELECT EXISTS (SELECT 1 FROM photos WHERE filename = $1)`, args[:1]
+	default:
+		return false, nil
+	}
+	var ok bool
+	if err := db.Pool.QueryRow(ctx, query, args...).Scan(&ok); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
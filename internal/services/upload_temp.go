@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"time"
+
+	"chat-backend/internal/utils"
+)
+
+// UploadTempDir holds uploads still being written. It is inside UPLOAD_DIR so publishing is
+// a rename on the same filesystem, and it is never served (see handlers.UploadsHandler).
+func UploadTempDir() string {
+	return filepath.Join(utils.GetEnv("UPLOAD_DIR", "uploads"), ".tmp")
+}
+
+// TempUpload is an upload written to a temp file and handed to the storage backend by
+// Publish, so a crash or failed request never leaves a partial file where it would be served.
+// Call Discard when giving up; it is a no-op after Publish.
+type TempUpload struct {
+	f           *os.File
+	key         string
+	ContentType string // Sent to the storage backend when set
+	published   bool
+}
+
+// NewTempUpload starts an upload that Publish will store under key (see Storage)
+func NewTempUpload(key string) (*TempUpload, error) {
+	dir := UploadTempDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "upload-*"+filepath.Ext(key))
+	if err != nil {
+		return nil, err
+	}
+	return &TempUpload{f: f, key: key}, nil
+}
+
+// SaveTempUpload copies a multipart file into a new TempUpload for key, through wrap when
+// set (e.g. to report progress)
+func SaveTempUpload(fh *multipart.FileHeader, key string, wrap func(io.Writer) io.Writer) (*TempUpload, error) {
+	src, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	t, err := NewTempUpload(key)
+	if err != nil {
+		return nil, err
+	}
+	t.ContentType = fh.Header.Get("Content-Type")
+	var w io.Writer = t.f
+	if wrap != nil {
+		w = wrap(w)
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		t.Discard()
+		return nil, err
+	}
+	if err := t.Close(); err != nil {
+		t.Discard()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Path is the temp file, for reading the upload before it is published
+func (t *TempUpload) Path() string {
+	return t.f.Name()
+}
+
+// Close flushes the temp file to disk
+func (t *TempUpload) Close() error {
+	if err := t.f.Sync(); err != nil {
+		t.f.Close()
+		return err
+	}
+	return t.f.Close()
+}
+
+// Publish stores the upload under its key, atomically for local storage, and records its
+// hash for moderation; call it once the upload is recorded. Content identical to an earlier
+// upload isn't stored again: the key references the existing blob instead.
+func (t *TempUpload) Publish(ctx context.Context) error {
+	hash, size, err := fileSHA256(t.f.Name())
+	if err != nil {
+		return fmt.Errorf("publish upload: %w", err)
+	}
+	if FeatureEnabled(FeatureUploadDedup) {
+		linked, err := linkUploadBlob(ctx, t.key, hash, size)
+		if err != nil {
+			return fmt.Errorf("publish upload: %w", err)
+		}
+		if linked {
+			_ = os.Remove(t.f.Name())
+			t.published = true
+			return nil
+		}
+	}
+	if err := UploadStorage().Store(ctx, t.f.Name(), t.key, t.ContentType); err != nil {
+		return fmt.Errorf("publish upload: %w", err)
+	}
+	recordUploadHash(ctx, t.key, hash, size)
+	t.published = true
+	return nil
+}
+
+// Discard removes the temp file unless the upload was published
+func (t *TempUpload) Discard() {
+	if t.published {
+		return
+	}
+	_ = t.f.Close()
+	_ = os.Remove(t.f.Name())
+}
+
+// CleanTempUploads removes temp files older than maxAge, left behind by crashes, and returns
+// how many were removed. The age check spares uploads in progress on other instances
+// sharing the directory.
+func CleanTempUploads(maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(UploadTempDir())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(UploadTempDir(), e.Name())); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
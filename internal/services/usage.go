@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+)
+
+// AddUsage adds batched counters to today's usage rollups. Messages are counted by the
+// messages trigger and ignored here; users deleted meanwhile are skipped.
+func (s *ChatService) AddUsage(ctx context.Context, deltas map[int]models.UsageCounts) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	users := make([]int32, 0, len(deltas))
+	uploads := make([]int64, 0, len(deltas))
+	uploadBytes := make([]int64, 0, len(deltas))
+	wsEvents := make([]int64, 0, len(deltas))
+	apiRequests := make([]int64, 0, len(deltas))
+	for userID, d := range deltas {
+		users = append(users, int32(userID))
+		uploads = append(uploads, d.Uploads)
+		uploadBytes = append(uploadBytes, d.UploadBytes)
+		wsEvents = append(wsEvents, d.WSEvents)
+		apiRequests = append(apiRequests, d.APIRequests)
+	}
+
+	_, err := db.Pool.Exec(ctx, `INSERT INTO user_daily_usage (user_id, day, uploads, upload_bytes, ws_events, api_requests)
+		SELECT d.user_id, (NOW() AT TIME ZONE 'UTC')::date, d.uploads, d.upload_bytes, d.ws_events, d.api_requests
+		FROM unnest($1::int[], $2::bigint[], $3::bigint[], $4::bigint[], $5::bigint[]) AS d(user_id, uploads, upload_bytes, ws_events, api_requests)
+		WHERE EXISTS (SELECT 1 FROM users WHERE users.id = d.user_id)
+		ON CONFLICT (user_id, day) DO UPDATE SET
+			uploads = user_daily_usage.uploads + EXCLUDED.uploads,
+			upload_bytes = user_daily_usage.upload_bytes + EXCLUDED.upload_bytes,
+			ws_events = user_daily_usage.ws_events + EXCLUDED.ws_events,
+			api_requests = user_daily_usage.api_requests + EXCLUDED.api_requests`,
+		users, uploads, uploadBytes, wsEvents, apiRequests)
+	return err
+}
+
+// GetUserUsage returns userID's daily usage for the last days UTC days (today included) and
+// the bytes their files currently take in uploadDir
+func (s *ChatService) GetUserUsage(ctx context.Context, userID, days int, uploadDir string) (*models.UserUsage, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from := today.AddDate(0, 0, -(days - 1))
+	usage := &models.UserUsage{From: from.Format(time.DateOnly), To: today.Format(time.DateOnly), Daily: []models.DayUsage{}}
+
+	rows, err := db.Read(ctx).Query(ctx, `SELECT day, messages, uploads, upload_bytes, ws_events, api_requests
+		FROM user_daily_usage WHERE user_id = $1 AND day >= $2 ORDER BY day`, userID, from)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var day time.Time
+		var d models.DayUsage
+		if err := rows.Scan(&day, &d.Messages, &d.Uploads, &d.UploadBytes, &d.WSEvents, &d.APIRequests); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.Day = day.Format(time.DateOnly)
+		usage.Daily = append(usage.Daily, d)
+
+		t := &usage.Totals
+		t.Messages += d.Messages
+		t.Uploads += d.Uploads
+		t.UploadBytes += d.UploadBytes
+		t.WSEvents += d.WSEvents
+		t.APIRequests += d.APIRequests
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if usage.StorageBytes, err = s.userStorageBytes(ctx, userID, uploadDir); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// userStorageBytes sums the sizes of the user's live voice recordings, staged uploads, attachments and photos.
+// Sizes aren't stored, so the files are stat'ed; missing files, such as uploads sharing an
+// identical earlier upload's blob, count as zero.
+func (s *ChatService) userStorageBytes(ctx context.Context, userID int, uploadDir string) (int64, error) {
+	rows, err := db.Read(ctx).Query(ctx, `
+		SELECT 'voices', voice FROM messages
+		WHERE user_id = $1 AND voice IS NOT NULL AND voice <> '' AND NOT voice_expired AND deleted_at IS NULL
+		UNION ALL SELECT 'voices', filename FROM staged_media WHERE user_id = $1
+		UNION ALL SELECT 'files', filename FROM files WHERE user_id = $1
+		UNION ALL SELECT '', filename FROM photos WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var total int64
+	for rows.Next() {
+		var dir, filename string
+		if err := rows.Scan(&dir, &filename); err != nil {
+			return 0, err
+		}
+		if info, err := os.Stat(filepath.Join(uploadDir, dir, filepath.Base(filename))); err == nil {
+			total += info.Size()
+		}
+	}
+	return total, rows.Err()
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MergeUsers moves messages, room memberships, photos, devices and reactions from the source
+// account to the target and deletes the source, all in one transaction. A dry run performs the
+// same statements to produce exact counts, then rolls back. Accounts under legal hold are refused.
+func (s *AdminService) MergeUsers(ctx context.Context, adminID int, req models.UserMergeRequest) (*models.UserMergeReport, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if req.SourceUserID == req.TargetUserID {
+		return nil, errors.New("source and target must be different users")
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock both accounts so nothing is written to the source mid-merge
+	var targetUsername string
+	var held bool
+	rows, err := tx.Query(ctx, `SELECT id, username, legal_hold FROM users WHERE id IN ($1, $2) FOR UPDATE`, req.SourceUserID, req.TargetUserID)
+	if err != nil {
+		return nil, err
+	}
+	found := 0
+	for rows.Next() {
+		var id int
+		var username string
+		var legalHold bool
+		if err := rows.Scan(&id, &username, &legalHold); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if id == req.TargetUserID {
+			targetUsername = username
+		}
+		held = held || legalHold
+		found++
+	}
+	rows.Close()
+	if found != 2 {
+		return nil, ErrNotFound
+	}
+	if held {
+		return nil, ErrLegalHold
+	}
+
+	report := &models.UserMergeReport{SourceUserID: req.SourceUserID, TargetUserID: req.TargetUserID, DryRun: req.DryRun}
+	src, dst := req.SourceUserID, req.TargetUserID
+	steps := []struct {
+		count *int64
+		query string
+		args  []interface{}
+	}{
+		{&report.Messages, `UPDATE messages SET user_id = $2, username = $3 WHERE user_id = $1`, []interface{}{src, dst, targetUsername}},
+		{&report.DuplicateMembership, `DELETE FROM room_participants s WHERE s.user_id = $1
+			AND EXISTS (SELECT 1 FROM room_participants t WHERE t.room_id = s.room_id AND t.user_id = $2)`, []interface{}{src, dst}},
+		{&report.RoomMemberships, `UPDATE room_participants SET user_id = $2 WHERE user_id = $1`, []interface{}{src, dst}},
+		{nil, `UPDATE room_participants SET invited_by = $2 WHERE invited_by = $1`, []interface{}{src, dst}},
+		{nil, `UPDATE room_membership_events SET user_id = $2 WHERE user_id = $1`, []interface{}{src, dst}},
+		{nil, `UPDATE room_membership_events SET actor_id = $2 WHERE actor_id = $1`, []interface{}{src, dst}},
+		{&report.Photos, `UPDATE photos SET user_id = $2 WHERE user_id = $1`, []interface{}{src, dst}},
+		{nil, `UPDATE files SET user_id = $2 WHERE user_id = $1`, []interface{}{src, dst}},
+		{nil, `DELETE FROM user_devices s WHERE s.user_id = $1
+			AND EXISTS (SELECT 1 FROM user_devices t WHERE t.user_id = $2 AND t.fingerprint = s.fingerprint)`, []interface{}{src, dst}},
+		{&report.Devices, `UPDATE user_devices SET user_id = $2 WHERE user_id = $1`, []interface{}{src, dst}},
+		{nil, `UPDATE device_tokens SET user_id = $2 WHERE user_id = $1`, []interface{}{src, dst}},
+		{nil, `DELETE FROM message_reactions s WHERE s.user_id = $1
+			AND EXISTS (SELECT 1 FROM message_reactions t WHERE t.user_id = $2 AND t.message_id = s.message_id AND t.emoji = s.emoji)`, []interface{}{src, dst}},
+		{&report.Reactions, `UPDATE message_reactions SET user_id = $2 WHERE user_id = $1`, []interface{}{src, dst}},
+		{nil, `DELETE FROM message_receipts s WHERE s.user_id = $1
+			AND EXISTS (SELECT 1 FROM message_receipts t WHERE t.user_id = $2 AND t.message_id = s.message_id)`, []interface{}{src, dst}},
+		{nil, `UPDATE message_receipts SET user_id = $2 WHERE user_id = $1`, []interface{}{src, dst}},
+		{nil, `INSERT INTO room_daily_activity (room, user_id, day, messages)
+			SELECT room, $2, day, messages FROM room_daily_activity WHERE user_id = $1
+			ON CONFLICT (room, day, user_id) DO UPDATE SET messages = room_daily_activity.messages + EXCLUDED.messages`, []interface{}{src, dst}},
+		{nil, `INSERT INTO user_daily_usage (user_id, day, messages, uploads, upload_bytes, ws_events, api_requests)
+			SELECT $2, day, messages, uploads, upload_bytes, ws_events, api_requests FROM user_daily_usage WHERE user_id = $1
+			ON CONFLICT (user_id, day) DO UPDATE SET messages = user_daily_usage.messages + EXCLUDED.messages,
+				uploads = user_daily_usage.uploads + EXCLUDED.uploads, upload_bytes = user_daily_usage.upload_bytes + EXCLUDED.upload_bytes,
+				ws_events = user_daily_usage.ws_events + EXCLUDED.ws_events, api_requests = user_daily_usage.api_requests + EXCLUDED.api_requests`, []interface{}{src, dst}},
+		{nil, `UPDATE room_announcements SET set_by = $2 WHERE set_by = $1`, []interface{}{src, dst}},
+		{nil, `DELETE FROM room_announcement_dismissals s WHERE s.user_id = $1
+			AND EXISTS (SELECT 1 FROM room_announcement_dismissals t WHERE t.room_id = s.room_id AND t.user_id = $2)`, []interface{}{src, dst}},
+		{nil, `UPDATE room_announcement_dismissals SET user_id = $2 WHERE user_id = $1`, []interface{}{src, dst}},
+		{&report.StagedMedia, `UPDATE staged_media SET user_id = $2 WHERE user_id = $1`, []interface{}{src, dst}},
+		{nil, `DELETE FROM users WHERE id = $1`, []interface{}{src}},
+	}
+	for _, step := range steps {
+		tag, err := tx.Exec(ctx, step.query, step.args...)
+		if err != nil {
+			return nil, err
+		}
+		if step.count != nil {
+			*step.count = tag.RowsAffected()
+		}
+	}
+
+	if req.DryRun {
+		return report, nil
+	}
+
+	if err := recordAdminAudit(ctx, tx, adminID, "merge_users", "user", strconv.Itoa(dst), report); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// recordAdminAudit appends an entry to admin_audit_log inside tx. adminID 0 records an
+// action taken from the command line, without an acting admin.
+func recordAdminAudit(ctx context.Context, tx pgx.Tx, adminID int, action, targetType, targetID string, details interface{}) error {
+	b, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO admin_audit_log (admin_user_id, action, target_type, target_id, details) VALUES (NULLIF($1, 0), $2, $3, $4, $5)`,
+		adminID, action, targetType, targetID, b)
+	return err
+}
@@ -3,8 +3,6 @@ package services
 import (
 	"context"
 	"errors"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -14,7 +12,6 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgconn"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type UserService struct{}
@@ -26,19 +23,28 @@ func NewUserService() *UserService {
 // ErrUserExists is returned when attempting to register with an existing username
 var ErrUserExists = errors.New("username already exists")
 
+// ErrLegalHold is returned when a user tries to delete data that is under legal hold
+var ErrLegalHold = errors.New("data is under legal hold and cannot be deleted")
+
 func (s *UserService) Register(ctx context.Context, req models.RegisterRequest) (*models.User, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	hash, err := HashPassword(req.Password)
 	if err != nil {
 		return nil, err
 	}
 
 	var user models.User
-	query := `INSERT INTO users (username, password_hash) VALUES ($1, $2) RETURNING id, username, created_at`
-	err = db.Pool.QueryRow(ctx, query, req.Username, string(hash)).Scan(&user.ID, &user.Username, &user.CreatedAt)
+	query := `INSERT INTO users (username, password_hash, email) VALUES ($1, $2, NULLIF($3, '')) RETURNING id, username, email, created_at`
+	err = db.Pool.QueryRow(ctx, query, req.Username, hash, req.Email).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt)
 	if err != nil {
 		// Detect Postgres unique-violation errors and return a friendly error
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" && pgErr.ConstraintName == "idx_users_email_lower" {
+				return nil, ErrEmailInUse
+			}
 			if pgErr.Code == "23505" {
 				return nil, ErrUserExists
 			}
@@ -56,34 +62,83 @@ func (s *UserService) Register(ctx context.Context, req models.RegisterRequest)
 	return &user, nil
 }
 
-func (s *UserService) Login(ctx context.Context, req models.LoginRequest) (*models.AuthResponse, error) {
+// Authenticate checks a username and password and returns the matching user. Hashes made
+// with another algorithm or weaker parameters than the configured ones are replaced.
+func (s *UserService) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	var user models.User
-	query := `SELECT id, username, password_hash FROM users WHERE username = $1`
-	err := db.Pool.QueryRow(ctx, query, req.Username).Scan(&user.ID, &user.Username, &user.PasswordHash)
+	var banned bool
+	query := `SELECT id, username, password_hash, banned_at IS NOT NULL FROM users WHERE username = $1`
+	err := db.Pool.QueryRow(ctx, query, username).Scan(&user.ID, &user.Username, &user.PasswordHash, &banned)
 	if err != nil {
 		return nil, errors.New("invalid credentials")
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+	ok, rehash := VerifyPassword(user.PasswordHash, password)
+	if !ok {
 		return nil, errors.New("invalid credentials")
 	}
+	// Only revealed to someone who knows the password
+	if banned {
+		return nil, ErrUserBanned
+	}
+	if rehash {
+		s.rehashPassword(ctx, user.ID, user.PasswordHash, password)
+	}
+	return &user, nil
+}
+
+// rehashPassword upgrades a stored hash after a successful login; failures only mean the
+// upgrade is retried on the next one
+func (s *UserService) rehashPassword(ctx context.Context, userID int, old, password string) {
+	hash, err := HashPassword(password)
+	if err != nil {
+		utils.LogError(err, "rehash password")
+		return
+	}
+	// Skipped if the password changed meanwhile
+	_, err = db.Pool.Exec(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3`, hash, userID, old)
+	utils.LogError(err, "rehash password")
+}
+
+func (s *UserService) Login(ctx context.Context, req models.LoginRequest, info models.DeviceInfo) (*models.AuthResponse, error) {
+	user, err := s.Authenticate(ctx, req.Username, req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	info.DeviceID = req.DeviceID
+	device, isNew, err := s.recordDevice(ctx, user.ID, info)
+	if err != nil {
+		return nil, err
+	}
 
 	token, err := GenerateJWT(user.ID, user.Username)
 	if err != nil {
 		return nil, err
 	}
 
-	refresh, err := GenerateRefreshToken(user.ID, user.Username)
+	refresh, err := GenerateRefreshToken(user.ID, user.Username, device.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.AuthResponse{
+	res := &models.AuthResponse{
 		AccessToken:  token,
 		RefreshToken: refresh,
 		Username:     user.Username,
 		UserID:       user.ID,
-	}, nil
+		DeviceID:     device.ID,
+	}
+	if isNew {
+		res.NewDevice = device
+	}
+	return res, nil
 }
 
 func GenerateJWT(userID int, username string) (string, error) {
@@ -98,14 +153,18 @@ func GenerateJWT(userID int, username string) (string, error) {
 	return token.SignedString([]byte(utils.GetEnv("JWT_SECRET", "secret")))
 }
 
-// GenerateRefreshToken creates a refresh JWT with longer expiry and typ claim
-func GenerateRefreshToken(userID int, username string) (string, error) {
+// GenerateRefreshToken creates a refresh JWT with longer expiry and typ claim.
+// deviceID ties the token to a user_devices row so it stops working once the device is revoked.
+func GenerateRefreshToken(userID int, username string, deviceID string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id":  userID,
 		"username": username,
 		"exp":      time.Now().Add(time.Hour * 24 * 30).Unix(), // 30 days
 		"typ":      "refresh",
 	}
+	if deviceID != "" {
+		claims["did"] = deviceID
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(utils.GetEnv("JWT_SECRET", "secret")))
@@ -135,6 +194,9 @@ func ValidateRefreshToken(tokenString string) (jwt.MapClaims, error) {
 	return nil, errors.New("invalid token")
 }
 
+// ValidateToken parses and validates an access token and returns its claims. Refresh tokens
+// and the other tokens signed with JWT_SECRET are rejected, so a refresh token of a revoked
+// device can't be used as a bearer token.
 func ValidateToken(tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -148,6 +210,9 @@ func ValidateToken(tokenString string) (jwt.MapClaims, error) {
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		if typ, _ := claims["typ"].(string); typ != "access" {
+			return nil, errors.New("invalid token type")
+		}
 		return claims, nil
 	}
 
@@ -157,8 +222,11 @@ func ValidateToken(tokenString string) (jwt.MapClaims, error) {
 // ListUsers returns all registered users excluding admin user.
 // It selects only the fields needed (id, username, created_at) to keep the query lightweight.
 func (s *UserService) ListUsers(ctx context.Context) ([]models.User, error) {
-	query := `SELECT id, username, created_at FROM users WHERE username <> $1 ORDER BY username`
-	rows, err := db.Pool.Query(ctx, query, "admin")
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, username, created_at FROM users WHERE role <> 'admin' AND banned_at IS NULL AND deleted_at IS NULL AND NOT is_bot ORDER BY username`
+	rows, err := db.Pool.Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -177,13 +245,18 @@ func (s *UserService) ListUsers(ctx context.Context) ([]models.User, error) {
 
 // GetProfile returns user profile including first/last name and photos
 func (s *UserService) GetProfile(ctx context.Context, userID int) (*models.User, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	var u models.User
 	var firstName, lastName *string
-	query := `SELECT id, username, first_name, last_name, created_at FROM users WHERE id = $1`
-	err := db.Pool.QueryRow(ctx, query, userID).Scan(&u.ID, &u.Username, &firstName, &lastName, &u.CreatedAt)
+	var prefs models.NotificationPrefs
+	query := `SELECT id, username, first_name, last_name, email, language, message_preview, created_at FROM users WHERE id = $1`
+	err := db.Pool.QueryRow(ctx, query, userID).Scan(&u.ID, &u.Username, &firstName, &lastName, &u.Email, &prefs.Language, &prefs.MessagePreview, &u.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
+	u.Preferences = &prefs
 	u.FirstName = firstName
 	u.LastName = lastName
 
@@ -200,6 +273,7 @@ func (s *UserService) GetProfile(ctx context.Context, userID int) (*models.User,
 		if err := rows.Scan(&p.ID, &p.UserID, &p.Filename, &p.URL, &p.CreatedAt); err != nil {
 			continue
 		}
+		p.URL = PhotoURL(p.Filename) // Stored URLs may point at a retired upload namespace
 		photos = append(photos, p)
 	}
 	u.Photos = photos
@@ -208,6 +282,9 @@ func (s *UserService) GetProfile(ctx context.Context, userID int) (*models.User,
 
 // AddPhoto records a new photo row and returns the created photo
 func (s *UserService) AddPhoto(ctx context.Context, userID int, filename string, url string) (*models.Photo, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	var p models.Photo
 	query := `INSERT INTO photos (user_id, filename, url) VALUES ($1, $2, $3) RETURNING id, created_at`
 	err := db.Pool.QueryRow(ctx, query, userID, filename, url).Scan(&p.ID, &p.CreatedAt)
@@ -222,28 +299,35 @@ func (s *UserService) AddPhoto(ctx context.Context, userID int, filename string,
 
 // DeletePhoto deletes a photo row owned by the user and removes the file from disk
 func (s *UserService) DeletePhoto(ctx context.Context, userID int, photoID int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	var filename string
-	query := `SELECT filename FROM photos WHERE id = $1 AND user_id = $2`
-	err := db.Pool.QueryRow(ctx, query, photoID, userID).Scan(&filename)
+	var held bool
+	query := `SELECT p.filename, u.legal_hold FROM photos p JOIN users u ON u.id = p.user_id WHERE p.id = $1 AND p.user_id = $2`
+	err := db.Pool.QueryRow(ctx, query, photoID, userID).Scan(&filename, &held)
 	if err != nil {
 		return err
 	}
+	if held {
+		return ErrLegalHold
+	}
 
 	// Delete DB row
 	if _, err := db.Pool.Exec(ctx, `DELETE FROM photos WHERE id = $1 AND user_id = $2`, photoID, userID); err != nil {
 		return err
 	}
 
-	// Remove file from upload directory if present
-	uploadDir := utils.GetEnv("UPLOAD_DIR", "uploads")
-	path := filepath.Join(uploadDir, filename)
-	// Best-effort remove; ignore error if file not present
-	_ = os.Remove(path)
+	// Best-effort removal of the file from upload storage
+	DeleteUpload(ctx, filename)
 	return nil
 }
 
 // UpdateProfile updates a user's first and last name. Pass nil to set NULL.
 func (s *UserService) UpdateProfile(ctx context.Context, userID int, first, last *string) (*models.User, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	// Update values (nil will set column to NULL)
 	_, err := db.Pool.Exec(ctx, `UPDATE users SET first_name = $1, last_name = $2 WHERE id = $3`, first, last, userID)
 	if err != nil {
@@ -256,6 +340,9 @@ func (s *UserService) UpdateProfile(ctx context.Context, userID int, first, last
 
 // GetUserInfo returns lightweight profile info (id, username, first/last name, photos) for display
 func (s *UserService) GetUserInfo(ctx context.Context, userID int) (*models.UserInfo, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	var info models.UserInfo
 	var firstName, lastName *string
 	query := `SELECT id, username, first_name, last_name FROM users WHERE id = $1`
@@ -279,8 +366,22 @@ func (s *UserService) GetUserInfo(ctx context.Context, userID int) (*models.User
 		if err := rows.Scan(&p.ID, &p.UserID, &p.Filename, &p.URL, &p.CreatedAt); err != nil {
 			continue
 		}
+		p.URL = PhotoURL(p.Filename) // Stored URLs may point at a retired upload namespace
 		photos = append(photos, p)
 	}
 	info.Photos = photos
 	return &info, nil
 }
+
+// UpdatePreferences changes the user's notification language and preview setting
+func (s *UserService) UpdatePreferences(ctx context.Context, userID int, req models.UpdatePreferencesRequest) (*models.User, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `UPDATE users SET language = COALESCE($1, language), message_preview = COALESCE($2, message_preview) WHERE id = $3`,
+		req.Language, req.MessagePreview, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetProfile(ctx, userID)
+}
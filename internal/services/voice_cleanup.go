@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"chat-backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// voiceCleanupBatch is how many of the oldest voice messages are considered per round
+// while enforcing the storage cap
+const voiceCleanupBatch = 100
+
+// ExpireOldVoiceFiles deletes the files of voice messages older than maxAgeSeconds and marks
+// them voice_expired. Message rows are kept; rooms and users under legal hold are exempt.
+func (s *ChatService) ExpireOldVoiceFiles(ctx context.Context, maxAgeSeconds int64) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `UPDATE messages SET voice_expired = TRUE
+		WHERE voice IS NOT NULL AND voice <> '' AND NOT voice_expired
+		AND created_at < NOW() - make_interval(secs => $1)
+		AND `+notHeld+`
+		RETURNING voice`, maxAgeSeconds)
+	if err != nil {
+		return 0, err
+	}
+	files, err := collectStrings(rows)
+	if err != nil {
+		return 0, err
+	}
+	removeVoiceFiles(ctx, files)
+	return len(files), nil
+}
+
+// EnforceVoiceStorageCap deletes the oldest voice files until the voices directory is at most
+// capBytes, marking their messages voice_expired. Files under legal hold are never deleted,
+// so the cap may stay exceeded. The cap measures the local directory, so it only applies to
+// local storage; buckets are better capped with lifecycle rules.
+func (s *ChatService) EnforceVoiceStorageCap(ctx context.Context, voicesDir string, capBytes int64) (int, error) {
+	if _, local := UploadStorage().(LocalStorage); !local {
+		return 0, nil
+	}
+	total, err := dirSize(voicesDir)
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for total > capBytes {
+		candidates, err := s.oldestLiveVoices(ctx)
+		if err != nil {
+			return expired, err
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		var victims []string
+		for _, voice := range candidates {
+			if total <= capBytes {
+				break
+			}
+			if info, err := os.Stat(filepath.Join(voicesDir, filepath.Base(voice))); err == nil {
+				total -= info.Size()
+			}
+			victims = append(victims, voice)
+		}
+		files, err := s.markVoicesExpired(ctx, victims)
+		if err != nil {
+			return expired, err
+		}
+		removeVoiceFiles(ctx, files)
+		expired += len(files)
+	}
+	return expired, nil
+}
+
+// oldestLiveVoices returns the voice filenames of the oldest messages whose file is still kept
+func (s *ChatService) oldestLiveVoices(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT voice FROM messages
+		WHERE voice IS NOT NULL AND voice <> '' AND NOT voice_expired AND `+notHeld+`
+		ORDER BY created_at LIMIT $1`, voiceCleanupBatch)
+	if err != nil {
+		return nil, err
+	}
+	return collectStrings(rows)
+}
+
+func (s *ChatService) markVoicesExpired(ctx context.Context, voices []string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `UPDATE messages SET voice_expired = TRUE
+		WHERE voice = ANY($1) AND NOT voice_expired AND `+notHeld+`
+		RETURNING voice`, voices)
+	if err != nil {
+		return nil, err
+	}
+	return collectStrings(rows)
+}
+
+// collectStrings scans rows of a single text column
+func collectStrings(rows pgx.Rows) ([]string, error) {
+	defer rows.Close()
+	var voices []string
+	for rows.Next() {
+		var voice string
+		if err := rows.Scan(&voice); err != nil {
+			return nil, err
+		}
+		voices = append(voices, voice)
+	}
+	return voices, rows.Err()
+}
+
+// removeVoiceFiles deletes voice files; failures are ignored since the rows are already marked
+func removeVoiceFiles(ctx context.Context, voices []string) {
+	for _, voice := range voices {
+		DeleteUpload(ctx, "voices/"+filepath.Base(voice))
+	}
+}
+
+// dirSize sums the sizes of the regular files directly inside dir
+func dirSize(dir string) (int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			total += info.Size()
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+)
+
+// GetVoiceRun returns a run of consecutive voice messages in a room, oldest first. With fromID
+// the run starts at that message and continues forward; otherwise it is the run ending at the
+// newest message. The run stops at the first message without a voice; voices removed by the
+// cleanup policy are skipped but count toward limit. more is true when limit cut the run short:
+// later voices follow with fromID, earlier ones precede the newest run.
+func (s *ChatService) GetVoiceRun(ctx context.Context, roomID string, fromID, limit int) (run []models.Message, more bool, err error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE room = $1 AND id >= $2 AND ` + notExpired + ` ORDER BY id LIMIT $3`
+	args := []interface{}{roomID, fromID, limit + 1} // One extra row tells whether the run continues
+	if fromID <= 0 {
+		query = `SELECT ` + messageColumns + ` FROM messages WHERE room = $1 AND ` + notExpired + ` ORDER BY id DESC LIMIT $2`
+		args = []interface{}{roomID, limit + 1}
+	}
+	rows, err := db.Read(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	run = []models.Message{}
+	voices := 0
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, false, err
+		}
+		if msg.Voice == nil || *msg.Voice == "" {
+			break
+		}
+		if voices == limit {
+			more = true
+			break
+		}
+		voices++
+		if !msg.VoiceExpired {
+			run = append(run, *msg)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	if fromID <= 0 {
+		for i, j := 0, len(run)-1; i < j; i, j = i+1, j-1 {
+			run[i], run[j] = run[j], run[i]
+		}
+	}
+	return run, more, nil
+}
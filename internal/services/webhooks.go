@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"chat-backend/internal/db"
+	"chat-backend/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidWebhook is returned for unknown webhook tokens
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// maxWebhookMessage caps the rendered text of a webhook message
+const maxWebhookMessage = 4000
+
+// defaultWebhookTemplate posts "text" verbatim, otherwise formats title, body and fields
+const defaultWebhookTemplate = `{{if .text}}{{.text}}{{else}}{{with .title}}{{.}}
+{{end}}{{with .body}}{{.}}
+{{end}}{{range .fields}}{{.name}}: {{.value}}
+{{end}}{{end}}`
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// ParseWebhookTemplate validates a webhook template; an empty one selects the default
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		text = defaultWebhookTemplate
+	}
+	return template.New("webhook").Funcs(webhookFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// RenderWebhookMessage executes the template against a decoded JSON payload
+func RenderWebhookMessage(tmplText string, payload interface{}) (string, error) {
+	tmpl, err := ParseWebhookTemplate(tmplText)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, payload); err != nil {
+		return "", err
+	}
+	// Missing payload keys render as "<no value>" even with missingkey=zero
+	text := strings.TrimSpace(strings.ReplaceAll(buf.String(), "<no value>", ""))
+	if len(text) > maxWebhookMessage {
+		text = text[:maxWebhookMessage]
+	}
+	return text, nil
+}
+
+func hashWebhookToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+const webhookColumns = `id, room_id, name, template, created_by, created_at, last_used_at`
+
+func scanWebhook(row rowScanner) (*models.RoomWebhook, error) {
+	var w models.RoomWebhook
+	if err := row.Scan(&w.ID, &w.RoomID, &w.Name, &w.Template, &w.CreatedBy, &w.CreatedAt, &w.LastUsedAt); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// WebhookSenderName is the sender name of a webhook's messages. The prefix keeps them apart
+// from system messages and members; the result fits messages.username.
+func WebhookSenderName(name string) string {
+	sender := []rune("webhook: " + name)
+	if len(sender) > 50 {
+		sender = sender[:50]
+	}
+	return string(sender)
+}
+
+// CreateWebhook creates an incoming webhook for a room and returns it with its secret token,
+// which is only available here. Room owners and admins may create webhooks; override is
+// for the app admin.
+func (s *ChatService) CreateWebhook(ctx context.Context, roomID string, createdBy int, req models.CreateWebhookRequest, override bool) (*models.RoomWebhook, string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := requireRoomAdmin(ctx, db.Pool, roomID, createdBy, override); err != nil {
+		return nil, "", err
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	var tmpl *string
+	if req.Template != nil && strings.TrimSpace(*req.Template) != "" {
+		tmpl = req.Template
+	}
+	w, err := scanWebhook(db.Pool.QueryRow(ctx, `INSERT INTO room_webhooks (room_id, name, token_hash, template, created_by)
+		VALUES ($1, $2, $3, $4, $5) RETURNING `+webhookColumns, roomID, req.Name, hashWebhookToken(token), tmpl, createdBy))
+	if err != nil {
+		return nil, "", err
+	}
+	return w, token, nil
+}
+
+// ListWebhooks returns a room's webhooks without their tokens, to room owners and admins
+func (s *ChatService) ListWebhooks(ctx context.Context, roomID string, actorID int, override bool) ([]models.RoomWebhook, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := requireRoomAdmin(ctx, db.Pool, roomID, actorID, override); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Pool.Query(ctx, `SELECT `+webhookColumns+` FROM room_webhooks WHERE room_id = $1 ORDER BY id`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.RoomWebhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes a room's webhook; its URL stops working immediately. Room owners and
+// admins only.
+func (s *ChatService) DeleteWebhook(ctx context.Context, roomID string, actorID, webhookID int, override bool) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := requireRoomAdmin(ctx, db.Pool, roomID, actorID, override); err != nil {
+		return err
+	}
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM room_webhooks WHERE id = $1 AND room_id = $2`, webhookID, roomID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AuthenticateWebhook returns the webhook a token belongs to and records its use
+func (s *ChatService) AuthenticateWebhook(ctx context.Context, token string) (*models.RoomWebhook, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	w, err := scanWebhook(db.Pool.QueryRow(ctx, `UPDATE room_webhooks SET last_used_at = NOW() WHERE token_hash = $1 RETURNING `+webhookColumns,
+		hashWebhookToken(token)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidWebhook
+	}
+	if err != nil {
+		return nil, fmt.Errorf("authenticate webhook: %w", err)
+	}
+	return w, nil
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set at link time, e.g.
+//
+//	go build -ldflags "-X chat-backend/internal/utils.Version=1.4.0 -X chat-backend/internal/utils.Commit=$(git rev-parse HEAD)"
+//
+// Without Commit, the VCS stamp Go embeds when building from a git checkout is used.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	BuildTime  string `json:"build_time,omitempty"`
+	CommitTime string `json:"commit_time,omitempty"`
+	Modified   bool   `json:"modified,omitempty"` // Built from a checkout with uncommitted changes
+	GoVersion  string `json:"go_version"`
+}
+
+// Build returns the build metadata of the running binary
+func Build() BuildInfo {
+	info := BuildInfo{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok || info.Commit != "" {
+		return info
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Commit = s.Value
+		case "vcs.time":
+			info.CommitTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
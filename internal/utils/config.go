@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// configKeys maps every variable read through GetEnv and friends to the default it was
+// first read with
+var configKeys sync.Map
+
+func noteConfigKey(key, defaultValue string) {
+	if _, ok := configKeys.Load(key); !ok {
+		configKeys.LoadOrStore(key, defaultValue)
+	}
+}
+
+// secretConfigWords mark variables whose values are never shown
+var secretConfigWords = []string{"SECRET", "PASSWORD", "PASSWD", "TOKEN", "PRIVATE", "CREDENTIAL", "_KEY", "DSN"}
+
+// redactedValue replaces the value of a secret that is set
+const redactedValue = "[redacted]"
+
+// ConfigValue is the effective value of a configuration variable and where it came from
+type ConfigValue struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"` // "env", "dotenv" or "default"
+}
+
+// EffectiveConfig returns every variable the server has read so far with the value in effect,
+// sorted by key. Secrets are redacted, as are passwords in URLs.
+func EffectiveConfig() []ConfigValue {
+	dotEnvMu.Lock()
+	dotEnv := make(map[string]bool, len(fromDotEnv))
+	for key := range fromDotEnv {
+		dotEnv[key] = true
+	}
+	dotEnvMu.Unlock()
+
+	var values []ConfigValue
+	configKeys.Range(func(k, v any) bool {
+		key := k.(string)
+		cv := ConfigValue{Key: key, Value: v.(string), Source: "default"}
+		if value, ok := os.LookupEnv(key); ok {
+			cv.Value, cv.Source = value, "env"
+			if dotEnv[key] {
+				cv.Source = "dotenv"
+			}
+		}
+		cv.Value = redactConfigValue(key, cv.Value)
+		values = append(values, cv)
+		return true
+	})
+	sort.Slice(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+	return values
+}
+
+func redactConfigValue(key, value string) string {
+	if value == "" {
+		return ""
+	}
+	upper := strings.ToUpper(key)
+	for _, w := range secretConfigWords {
+		if strings.Contains(upper, w) {
+			return redactedValue
+		}
+	}
+	if strings.Contains(value, "://") {
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+	}
+	return value
+}
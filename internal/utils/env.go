@@ -3,19 +3,69 @@ package utils
 import (
 	"os"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// fromDotEnv records which variables came from the .env file rather than the process
+// environment; only those are updated by ReloadEnv
+var fromDotEnv = map[string]bool{}
+
+// dotEnvMu guards fromDotEnv, which EffectiveConfig reads while a reload may run
+var dotEnvMu sync.Mutex
+
 // LoadEnv loads environment variables from .env file
 func LoadEnv() error {
 	// Ignore error if .env file doesn't exist (e.g. in production)
-	_ = godotenv.Load()
+	values, err := godotenv.Read()
+	if err != nil {
+		return nil
+	}
+	dotEnvMu.Lock()
+	defer dotEnvMu.Unlock()
+	for key, value := range values {
+		if _, exists := os.LookupEnv(key); !exists {
+			os.Setenv(key, value)
+			fromDotEnv[key] = true
+		}
+	}
+	return nil
+}
+
+// ReloadEnv re-reads the .env file. Variables set by the process environment keep
+// precedence; variables removed from the file are unset.
+func ReloadEnv() error {
+	values, err := godotenv.Read()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	dotEnvMu.Lock()
+	defer dotEnvMu.Unlock()
+	for key := range fromDotEnv {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+			delete(fromDotEnv, key)
+		}
+	}
+	for key, value := range values {
+		if _, exists := os.LookupEnv(key); exists && !fromDotEnv[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		fromDotEnv[key] = true
+	}
 	return nil
 }
 
 // GetEnv returns the value of an environment variable or a default value
 func GetEnv(key, defaultValue string) string {
+	noteConfigKey(key, defaultValue)
+	return lookupEnv(key, defaultValue)
+}
+
+func lookupEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
@@ -24,9 +74,21 @@ func GetEnv(key, defaultValue string) string {
 
 // GetEnvInt returns the value of an environment variable as an integer or a default value
 func GetEnvInt(key string, defaultValue int) int {
-	valueStr := GetEnv(key, "")
+	noteConfigKey(key, strconv.Itoa(defaultValue))
+	valueStr := lookupEnv(key, "")
 	if value, err := strconv.Atoi(valueStr); err == nil {
 		return value
 	}
 	return defaultValue
 }
+
+// GetEnvDuration returns the value of an environment variable parsed as a time.Duration
+// (e.g. "30s", "5m") or a default value
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	noteConfigKey(key, defaultValue.String())
+	valueStr := lookupEnv(key, "")
+	if value, err := time.ParseDuration(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Log levels, from most to least verbose
+const (
+	LevelDebug = iota
+	LevelInfo
+	LevelError
+)
+
+var logLevel atomic.Int32
+
+func init() {
+	logLevel.Store(LevelInfo)
+}
+
+// SetLogLevel sets the level from LOG_LEVEL: "debug", "info" (default) or "error".
+// At "error" the request access log is suppressed.
+func SetLogLevel(level string) error {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		logLevel.Store(LevelDebug)
+	case "", "info":
+		logLevel.Store(LevelInfo)
+	case "error":
+		logLevel.Store(LevelError)
+	default:
+		return fmt.Errorf("unknown log level %q, expected debug, info or error", level)
+	}
+	return nil
+}
+
+// LogEnabled reports whether messages at level are logged
+func LogEnabled(level int) bool {
+	return int32(level) >= logLevel.Load()
+}
+
+// LogDebug logs only at the debug level
+func LogDebug(format string, args ...interface{}) {
+	if LogEnabled(LevelDebug) {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"strconv"
+	"time"
+)
+
+// ParseTimestamp accepts a unix timestamp (seconds or milliseconds) or an RFC3339 string
+func ParseTimestamp(value string) (time.Time, error) {
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// Values below 1e12 are treated as seconds, same heuristic as the seen event
+		if ts < 1_000_000_000_000 {
+			ts = ts * 1000
+		}
+		return time.UnixMilli(ts), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrUnsupportedAudio is returned for files that aren't uncompressed PCM WAV
+var ErrUnsupportedAudio = errors.New("unsupported audio format")
+
+// ErrTrimRange is returned by TrimWAV when the range doesn't fit the recording
+var ErrTrimRange = errors.New("trim range is outside the recording")
+
+// maxFmtChunk bounds the "fmt " chunk, 16 bytes for PCM and 40 for the extensible format,
+// so a crafted size can't make readWAVHeader allocate gigabytes
+const maxFmtChunk = 64
+
+// wavInfo describes the PCM layout of a WAV file and where its samples are
+type wavInfo struct {
+	fmtChunk      []byte // raw "fmt " chunk body, copied as-is when rewriting
+	channels      uint16
+	sampleRate    uint32
+	bitsPerSample uint16
+	dataSize      int64
+}
+
+func (w *wavInfo) frameSize() int64 {
+	return int64(w.channels) * int64(w.bitsPerSample/8)
+}
+
+// readWAVHeader parses the RIFF header and chunks up to "data", leaving f positioned at the
+// first sample. Only 8/16-bit PCM is accepted.
+func readWAVHeader(f io.ReadSeeker) (*wavInfo, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(f, riff[:]); err != nil {
+		return nil, ErrUnsupportedAudio
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, ErrUnsupportedAudio
+	}
+
+	var info wavInfo
+	var haveFmt bool
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(f, hdr[:]); err != nil {
+			return nil, ErrUnsupportedAudio
+		}
+		id := string(hdr[0:4])
+		size := binary.LittleEndian.Uint32(hdr[4:8])
+
+		switch id {
+		case "fmt ":
+			if size < 16 || size > maxFmtChunk {
+				return nil, ErrUnsupportedAudio
+			}
+			buf := make([]byte, size)
+			if _, err := io.ReadFull(f, buf); err != nil {
+				return nil, ErrUnsupportedAudio
+			}
+			if format := binary.LittleEndian.Uint16(buf[0:2]); format != 1 {
+				return nil, ErrUnsupportedAudio
+			}
+			info.fmtChunk = buf
+			info.channels = binary.LittleEndian.Uint16(buf[2:4])
+			info.sampleRate = binary.LittleEndian.Uint32(buf[4:8])
+			info.bitsPerSample = binary.LittleEndian.Uint16(buf[14:16])
+			haveFmt = true
+			if size%2 == 1 {
+				if _, err := f.Seek(1, io.SeekCurrent); err != nil {
+					return nil, ErrUnsupportedAudio
+				}
+			}
+		case "data":
+			if !haveFmt || info.channels == 0 || info.sampleRate == 0 || (info.bitsPerSample != 8 && info.bitsPerSample != 16) {
+				return nil, ErrUnsupportedAudio
+			}
+			info.dataSize = int64(size)
+			return &info, nil
+		default:
+			// Chunks are word aligned
+			skip := int64(size) + int64(size%2)
+			if _, err := f.Seek(skip, io.SeekCurrent); err != nil {
+				return nil, ErrUnsupportedAudio
+			}
+		}
+	}
+}
+
+// AnalyzeWAV reads a PCM WAV file and returns its duration in milliseconds and
+// `buckets` peak values normalized to 0-100, suitable for drawing a waveform.
+// Compressed formats (ogg, webm, mp3, m4a) return ErrUnsupportedAudio.
+func AnalyzeWAV(path string, buckets int) (int64, []int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	info, err := readWAVHeader(f)
+	if err != nil {
+		return 0, nil, err
+	}
+	frameSize := info.frameSize()
+	frames := info.dataSize / frameSize
+	durationMs := frames * 1000 / int64(info.sampleRate)
+	peaks, err := wavPeaks(io.LimitReader(f, info.dataSize), frames, frameSize, info.bitsPerSample, buckets)
+	if err != nil {
+		return 0, nil, err
+	}
+	return durationMs, peaks, nil
+}
+
+// TrimWAV writes the part of the PCM WAV file at src between startMs and endMs to dst.
+// endMs <= 0 keeps everything after startMs. Other chunks (LIST, etc.) are dropped.
+func TrimWAV(src, dst string, startMs, endMs int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := readWAVHeader(in)
+	if err != nil {
+		return err
+	}
+	frameSize := info.frameSize()
+	frames := info.dataSize / frameSize
+	startFrame := startMs * int64(info.sampleRate) / 1000
+	endFrame := frames
+	if endMs > 0 {
+		endFrame = endMs * int64(info.sampleRate) / 1000
+	}
+	if startFrame < 0 || endFrame > frames || startFrame >= endFrame {
+		return ErrTrimRange
+	}
+	if _, err := in.Seek(startFrame*frameSize, io.SeekCurrent); err != nil {
+		return err
+	}
+	dataSize := (endFrame - startFrame) * frameSize
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	fmtSize := int64(len(info.fmtChunk))
+	fmtPad := fmtSize % 2
+	hdr := make([]byte, 0, 20)
+	hdr = append(hdr, "RIFF"...)
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(4+8+fmtSize+fmtPad+8+dataSize+dataSize%2))
+	hdr = append(hdr, "WAVEfmt "...)
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(fmtSize))
+	if _, err := out.Write(hdr); err != nil {
+		return err
+	}
+	if _, err := out.Write(info.fmtChunk); err != nil {
+		return err
+	}
+	if fmtPad == 1 {
+		if _, err := out.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	dataHdr := binary.LittleEndian.AppendUint32([]byte("data"), uint32(dataSize))
+	if _, err := out.Write(dataHdr); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(out, in, dataSize); err != nil {
+		return err
+	}
+	if dataSize%2 == 1 {
+		if _, err := out.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteWAV writes mono 16-bit PCM samples as a WAV file
+func WriteWAV(w io.Writer, sampleRate uint32, samples []int16) error {
+	dataSize := uint32(2 * len(samples))
+	hdr := make([]byte, 0, 44)
+	hdr = append(hdr, "RIFF"...)
+	hdr = binary.LittleEndian.AppendUint32(hdr, 36+dataSize)
+	hdr = append(hdr, "WAVEfmt "...)
+	hdr = binary.LittleEndian.AppendUint32(hdr, 16)
+	hdr = binary.LittleEndian.AppendUint16(hdr, 1) // PCM
+	hdr = binary.LittleEndian.AppendUint16(hdr, 1) // Mono
+	hdr = binary.LittleEndian.AppendUint32(hdr, sampleRate)
+	hdr = binary.LittleEndian.AppendUint32(hdr, sampleRate*2)
+	hdr = binary.LittleEndian.AppendUint16(hdr, 2)
+	hdr = binary.LittleEndian.AppendUint16(hdr, 16)
+	hdr = append(hdr, "data"...)
+	hdr = binary.LittleEndian.AppendUint32(hdr, dataSize)
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, samples)
+}
+
+// wavPeaks computes the max absolute amplitude (first channel) per bucket
+func wavPeaks(r io.Reader, frames, frameSize int64, bits uint16, buckets int) ([]int, error) {
+	if buckets <= 0 || frames == 0 {
+		return nil, nil
+	}
+	perBucket := frames / int64(buckets)
+	if perBucket == 0 {
+		perBucket = 1
+	}
+
+	peaks := make([]int, 0, buckets)
+	frame := make([]byte, frameSize)
+	var peak, count int64
+	for i := int64(0); i < frames; i++ {
+		if _, err := io.ReadFull(r, frame); err != nil {
+			break
+		}
+		var amp int64
+		if bits == 8 {
+			amp = int64(frame[0]) - 128
+			amp = amp * 256
+		} else {
+			amp = int64(int16(binary.LittleEndian.Uint16(frame[0:2])))
+		}
+		if amp < 0 {
+			amp = -amp
+		}
+		if amp > peak {
+			peak = amp
+		}
+		count++
+		if count == perBucket && len(peaks) < buckets {
+			peaks = append(peaks, int(peak*100/32768))
+			peak, count = 0, 0
+		}
+	}
+	if count > 0 && len(peaks) < buckets {
+		peaks = append(peaks, int(peak*100/32768))
+	}
+	return peaks, nil
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnalyzeWAV(t *testing.T) {
+	var buf bytes.Buffer
+	samples := make([]int16, 8000) // Half a second at 16 kHz
+	for i := range samples {
+		samples[i] = int16(i % 16000)
+	}
+	if err := WriteWAV(&buf, 16000, samples); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "voice.wav")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	duration, peaks, err := AnalyzeWAV(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if duration != 500 || len(peaks) != 10 {
+		t.Errorf("AnalyzeWAV = %d ms, %d peaks; want 500 ms, 10 peaks", duration, len(peaks))
+	}
+}
+
+func TestAnalyzeWAVRejectsOversizedFmtChunk(t *testing.T) {
+	for _, size := range []uint32{8, maxFmtChunk + 2, 0xFFFFFFF0} {
+		wav := []byte("RIFF\x00\x00\x00\x00WAVEfmt ")
+		wav = binary.LittleEndian.AppendUint32(wav, size)
+		path := filepath.Join(t.TempDir(), "voice.wav")
+		if err := os.WriteFile(path, wav, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := AnalyzeWAV(path, 10); !errors.Is(err, ErrUnsupportedAudio) {
+			t.Errorf("fmt chunk of %d bytes: err = %v, want ErrUnsupportedAudio", size, err)
+		}
+	}
+}
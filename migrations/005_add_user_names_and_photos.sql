@@ -1,13 +0,0 @@
-ALTER TABLE users
-    ADD COLUMN IF NOT EXISTS first_name VARCHAR(100),
-    ADD COLUMN IF NOT EXISTS last_name VARCHAR(100);
-
-CREATE TABLE IF NOT EXISTS photos (
-    id SERIAL PRIMARY KEY,
-    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-    filename VARCHAR(255) NOT NULL,
-    url TEXT NOT NULL,
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE INDEX IF NOT EXISTS idx_photos_user_id ON photos(user_id);
@@ -1,71 +0,0 @@
-#!/bin/sh
-set -e
-
-echo "Migration entrypoint starting..."
-
-until pg_isready -h db -p 5432 -U "$POSTGRES_USER"; do
-  echo "Waiting for postgres..."
-  sleep 1
-done
-
-# Ensure the target database exists (create if missing)
-exists=$(PGPASSWORD="$POSTGRES_PASSWORD" psql -h db -U "$POSTGRES_USER" -tAc "SELECT 1 FROM pg_database WHERE datname='$POSTGRES_DB'" )
-if [ "$exists" != "1" ]; then
-  echo "Database $POSTGRES_DB does not exist — creating"
-  PGPASSWORD="$POSTGRES_PASSWORD" psql -h db -U "$POSTGRES_USER" -c "CREATE DATABASE \"$POSTGRES_DB\";"
-fi
-
-# Directory for storing backups (can be overridden by setting BACKUP_DIR env var)
-BACKUP_DIR="${BACKUP_DIR:-/backups}"
-mkdir -p "$BACKUP_DIR"
-
-# If the database already exists, take a pre-migration backup so we can restore on failure
-BACKUP_FILE=""
-if [ "$exists" = "1" ]; then
-  BACKUP_FILE="$BACKUP_DIR/pre_migration_$(date +%Y%m%d%H%M%S).sql"
-  echo "Database $POSTGRES_DB exists — creating pre-migration backup: $BACKUP_FILE"
-  PGPASSWORD="$POSTGRES_PASSWORD" pg_dump -h db -U "$POSTGRES_USER" -d "$POSTGRES_DB" -Fp -f "$BACKUP_FILE"
-fi
-
-# By default we DO NOT automatically restore backups on migration failure.
-# Automatic restore is dangerous when migrations are run frequently or concurrently
-# because it can lead to repeated restores / duplicate-data errors. To enable
-# automatic restore you may set the environment variable `AUTO_RESTORE_ON_FAIL=1`.
-# When disabled we leave the pre-migration backup in `$BACKUP_DIR` and exit with
-# a non-zero status so the caller (CI/deploy script) can decide how to proceed.
-AUTO_RESTORE_ON_FAIL="${AUTO_RESTORE_ON_FAIL:-0}"
-
-restore_on_error() {
-  rc=$1
-  if [ "$AUTO_RESTORE_ON_FAIL" = "1" ] && [ -n "$BACKUP_FILE" ] && [ -f "$BACKUP_FILE" ]; then
-    echo "Migration failed (rc=$rc) — restoring database from $BACKUP_FILE"
-    PGPASSWORD="$POSTGRES_PASSWORD" psql -h db -U "$POSTGRES_USER" -d "$POSTGRES_DB" -c "DROP SCHEMA public CASCADE; CREATE SCHEMA public;"
-    PGPASSWORD="$POSTGRES_PASSWORD" psql -h db -U "$POSTGRES_USER" -d "$POSTGRES_DB" -f "$BACKUP_FILE" || {
-      echo "Restore failed. Exiting with original error code $rc"
-      exit 1
-    }
-    echo "Restore complete. Exiting with original error code $rc"
-  else
-    if [ -n "$BACKUP_FILE" ]; then
-      echo "Migration failed (rc=$rc). Pre-migration backup retained at: $BACKUP_FILE"
-    else
-      echo "Migration failed (rc=$rc). No pre-migration backup was created."
-    fi
-  fi
-  exit $rc
-}
-
-# Use EXIT trap to detect failures and optionally restore (opt-in).
-trap 'rc=$?; if [ "$rc" -ne 0 ]; then restore_on_error $rc; fi' EXIT
-
-for f in /migrations/*.sql; do
-  echo "Applying $f"
-  PGPASSWORD="$POSTGRES_PASSWORD" psql -h db -U "$POSTGRES_USER" -d "$POSTGRES_DB" -f "$f"
-done
-
-# If we completed migrations successfully, remove the EXIT trap
-trap - EXIT
-
-echo "Migrations complete."
-
-echo "Migrations complete."